@@ -46,6 +46,7 @@ ln -snf $VTTOP/config $VTROOT/config
 ln -snf $VTTOP/data $VTROOT/data
 ln -snf $VTTOP/py $VTROOT/py-vtdb
 ln -snf $VTTOP/go/cmd/mysqlctl/mysqlctl $VTROOT/bin/mysqlctl
+ln -snf $VTTOP/go/cmd/mysqlctld/mysqlctld $VTROOT/bin/mysqlctld
 ln -snf $VTTOP/go/cmd/normalizer/normalizer $VTROOT/bin/normalizer
 ln -snf $VTTOP/go/cmd/vtaction/vtaction $VTROOT/bin/vtaction
 ln -snf $VTTOP/go/cmd/vtgate/vtgate $VTROOT/bin/vtgate
@@ -54,6 +55,7 @@ ln -snf $VTTOP/go/cmd/vtctl/vtctl $VTROOT/bin/vtctl
 ln -snf $VTTOP/go/cmd/vtctld/vtctld $VTROOT/bin/vtctld
 ln -snf $VTTOP/go/cmd/vtocc/vtocc $VTROOT/bin/vtocc
 ln -snf $VTTOP/go/cmd/vttablet/vttablet $VTROOT/bin/vttablet
+ln -snf $VTTOP/go/cmd/vtjanitor/vtjanitor $VTROOT/bin/vtjanitor
 ln -snf $VTTOP/go/cmd/vttopo/vttopo $VTROOT/bin/vttopo
 ln -snf $VTTOP/go/cmd/zk/zk $VTROOT/bin/zk
 ln -snf $VTTOP/go/cmd/zkctl/zkctl $VTROOT/bin/zkctl
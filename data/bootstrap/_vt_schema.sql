@@ -12,8 +12,34 @@ CREATE TABLE _vt.reparent_log (
   wait_position varchar(255),
   index (last_position));
 
+CREATE TABLE _vt.reparent_journal (
+  time_created_ns bigint primary key,
+  action_name varchar(250) NOT NULL,
+  old_master_alias varchar(32) NOT NULL,
+  new_master_alias varchar(32) NOT NULL,
+  replication_position varchar(255) NOT NULL);
+
 CREATE TABLE _vt.blp_checkpoint (
   source_shard_uid int(10) unsigned NOT NULL,
   group_id varchar(255) default NULL,
   time_updated int(10) unsigned NOT NULL,
   PRIMARY KEY (source_shard_uid));
+
+CREATE TABLE _vt.redo_log_transaction (
+  dtid varbinary(512) NOT NULL,
+  state tinyint NOT NULL,
+  time_created bigint NOT NULL,
+  primary key (dtid));
+
+CREATE TABLE _vt.redo_log_statement (
+  dtid varbinary(512) NOT NULL,
+  id bigint NOT NULL,
+  statement mediumblob NOT NULL,
+  primary key (dtid, id));
+
+CREATE TABLE _vt.dtx (
+  dtid varbinary(512) NOT NULL,
+  state tinyint NOT NULL,
+  time_created bigint NOT NULL,
+  participants varbinary(4096) NOT NULL,
+  primary key (dtid));
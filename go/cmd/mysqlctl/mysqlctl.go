@@ -19,7 +19,7 @@ import (
 
 var port = flag.Int("port", 6612, "vtocc port")
 var mysqlPort = flag.Int("mysql-port", 3306, "mysql port")
-var tabletUid = flag.Uint("tablet-uid", 41983, "tablet uid")
+var tabletUid = flag.Uint("tablet-uid", 41983, "tablet uid, identifies the mysqld instance on this host")
 var mysqlSocket = flag.String("mysql-socket", "", "path to the mysql socket")
 var tabletAddr string
 
@@ -38,10 +38,15 @@ func multisnapshotCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []st
 	tablesString := subFlags.String("tables", "", "dump only this comma separated list of tables")
 	skipSlaveRestart := subFlags.Bool("skip-slave-restart", false, "after the snapshot is done, do not restart slave replication")
 	maximumFilesize := subFlags.Uint64("maximum-file-size", 128*1024*1024, "the maximum size for an uncompressed data file")
+	keyType := subFlags.String("key-type", "uint64", "type of the key column: uint64 or bytes")
 	subFlags.Parse(args)
 	if subFlags.NArg() != 2 {
 		log.Fatalf("action multisnapshot requires <db name> <key name>")
 	}
+	kit, err := key.ParseKeyspaceIdType(*keyType)
+	if err != nil {
+		log.Fatalf("multisnapshot failed: %v", err)
+	}
 
 	shards, err := key.ParseShardingSpec(*spec)
 	if err != nil {
@@ -52,7 +57,7 @@ func multisnapshotCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []st
 		tables = strings.Split(*tablesString, ",")
 	}
 
-	filenames, err := mysqld.CreateMultiSnapshot(shards, subFlags.Arg(0), subFlags.Arg(1), tabletAddr, false, *concurrency, tables, *skipSlaveRestart, *maximumFilesize, nil)
+	filenames, err := mysqld.CreateMultiSnapshot(shards, subFlags.Arg(0), subFlags.Arg(1), kit, tabletAddr, false, *concurrency, tables, *skipSlaveRestart, *maximumFilesize, nil)
 	if err != nil {
 		log.Fatalf("multisnapshot failed: %v", err)
 	} else {
@@ -128,6 +133,15 @@ func shutdownCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string)
 	}
 }
 
+func reinitCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+	waitTime := subFlags.Duration("wait-time", mysqlctl.MysqlWaitTime, "how long to wait for startup")
+	subFlags.Parse(args)
+
+	if err := mysqlctl.ReInit(*waitTime); err != nil {
+		log.Fatalf("failed reinit mysql: %v", err)
+	}
+}
+
 func snapshotCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
 	concurrency := subFlags.Int("concurrency", 4, "how many compression jobs to run simultaneously")
 	subFlags.Parse(args)
@@ -189,6 +203,27 @@ func teardownCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string)
 	}
 }
 
+func listCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+	subFlags.Parse(args)
+
+	uids, err := mysqlctl.ListTabletUids()
+	if err != nil {
+		log.Fatalf("failed listing instances: %v", err)
+	}
+	for _, uid := range uids {
+		mycnf, err := mysqlctl.ReadMycnf(mysqlctl.MycnfFile(uid))
+		if err != nil {
+			log.Errorf("failed reading my.cnf for %v: %v", uid, err)
+			continue
+		}
+		state := "stopped"
+		if _, err := os.Stat(mycnf.SocketFile); err == nil {
+			state = "running"
+		}
+		fmt.Printf("%v\t%v\t%v\t%v\n", uid, mycnf.MysqlPort, mycnf.SocketFile, state)
+	}
+}
+
 type command struct {
 	name   string
 	method func(*mysqlctl.Mysqld, *flag.FlagSet, []string)
@@ -198,13 +233,17 @@ type command struct {
 
 var commands = []command{
 	command{"init", initCmd, "",
-		"Initalizes the directory structure and starts mysqld"},
+		"Initalizes the directory structure, generates my.cnf from the templates and starts mysqld. Fails if the tablet directory was already initialized"},
+	command{"list", listCmd, "",
+		"Lists the mysqld instances initialized on this host, with their uid, port, socket and state"},
 	command{"teardown", teardownCmd, "[-force]",
 		"Shuts mysqld down, and removes the directory"},
 	command{"start", startCmd, "[-wait-time=20s]",
 		"Starts mysqld on an already 'init'-ed directory"},
 	command{"shutdown", shutdownCmd, "[-wait-time=20s]",
 		"Shuts down mysqld, does not remove any file"},
+	command{"reinit", reinitCmd, "[-wait-time=20s]",
+		"Asks mysqlctld (see -mysqlctld-addr) to remove mysqld and its data, and initialize a new one"},
 
 	command{"snapshot", snapshotCmd,
 		"[-concurrency=4] <db name>",
@@ -221,7 +260,7 @@ var commands = []command{
 	command{"multirestore", multiRestoreCmd,
 		"[-force] [-concurrency=3] [-fetch-concurrency=4] [-insert-table-concurrency=4] [-fetch-retry-count=3] [-start=''] [-end=''] [-strategy=] <destination_dbname> <source_host>[/<source_dbname>]...",
 		"Restores a snapshot form multiple hosts"},
-	command{"multisnapshot", multisnapshotCmd, "[-concurrency=8] [-spec='-'] [-tables=''] [-skip-slave-restart] [-maximum-file-size=134217728] <db name> <key name>",
+	command{"multisnapshot", multisnapshotCmd, "[-concurrency=8] [-spec='-'] [-tables=''] [-skip-slave-restart] [-maximum-file-size=134217728] [-key-type=uint64] <db name> <key name>",
 		"Makes a complete snapshot using 'select * into' commands."},
 }
 
@@ -246,7 +285,20 @@ func main() {
 	flag.Parse()
 
 	tabletAddr = fmt.Sprintf("%v:%v", "localhost", *port)
-	mycnf := mysqlctl.NewMycnf(uint32(*tabletUid), *mysqlPort, mysqlctl.VtReplParams{})
+
+	// use the my.cnf of the instance if it was initialized already,
+	// so its port doesn't have to be specified again
+	action := flag.Arg(0)
+	var mycnf *mysqlctl.Mycnf
+	mycnfFile := mysqlctl.MycnfFile(uint32(*tabletUid))
+	if _, statErr := os.Stat(mycnfFile); action != "init" && statErr == nil {
+		var err error
+		if mycnf, err = mysqlctl.ReadMycnf(mycnfFile); err != nil {
+			log.Fatalf("mycnf read failed: %v", err)
+		}
+	} else {
+		mycnf = mysqlctl.NewMycnf(uint32(*tabletUid), *mysqlPort, mysqlctl.VtReplParams{})
+	}
 
 	if *mysqlSocket != "" {
 		mycnf.SocketFile = *mysqlSocket
@@ -258,7 +310,6 @@ func main() {
 	}
 	mysqld := mysqlctl.NewMysqld(mycnf, dbcfgs.Dba, dbcfgs.Repl)
 
-	action := flag.Arg(0)
 	for _, cmd := range commands {
 		if cmd.name == action {
 			subFlags := flag.NewFlagSet(action, flag.ExitOnError)
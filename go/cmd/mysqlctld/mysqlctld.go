@@ -0,0 +1,79 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// mysqlctld is a daemon that starts or initializes mysqld, and
+// provides an RPC interface for vttablet (or mysqlctl) to stop and
+// start mysqld. mysqld keeps running when vttablet is restarted, and
+// it is shut down when mysqlctld exits.
+package main
+
+import (
+	"flag"
+	"os"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/dbconfigs"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/servenv"
+)
+
+var (
+	port        = flag.Int("port", 6612, "port for the server")
+	mysqlPort   = flag.Int("mysql-port", 3306, "mysql port")
+	tabletUid   = flag.Uint("tablet-uid", 41983, "tablet uid")
+	mysqlSocket = flag.String("mysql-socket", "", "path to the mysql socket")
+	waitTime    = flag.Duration("wait-time", mysqlctl.MysqlWaitTime, "how long to wait for mysqld startup or shutdown")
+)
+
+func main() {
+	dbCredentialsFile := dbconfigs.RegisterCommonFlags()
+	flag.Parse()
+	servenv.Init()
+
+	// use the my.cnf of the instance if it was initialized already
+	mycnfFile := mysqlctl.MycnfFile(uint32(*tabletUid))
+	_, statErr := os.Stat(mycnfFile)
+	initialized := statErr == nil
+	var mycnf *mysqlctl.Mycnf
+	if initialized {
+		var err error
+		if mycnf, err = mysqlctl.ReadMycnf(mycnfFile); err != nil {
+			log.Fatalf("mycnf read failed: %v", err)
+		}
+	} else {
+		mycnf = mysqlctl.NewMycnf(uint32(*tabletUid), *mysqlPort, mysqlctl.VtReplParams{})
+	}
+	if *mysqlSocket != "" {
+		mycnf.SocketFile = *mysqlSocket
+	}
+
+	dbcfgs, err := dbconfigs.Init(mycnf.SocketFile, *dbCredentialsFile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	mysqld := mysqlctl.NewMysqld(mycnf, dbcfgs.Dba, dbcfgs.Repl)
+
+	// start mysqld, initializing it first if it was never done
+	if !initialized {
+		log.Infof("mycnf file is missing, initializing mysqld")
+		if err := mysqlctl.Init(mysqld, *waitTime); err != nil {
+			log.Fatalf("failed to initialize mysqld: %v", err)
+		}
+	} else {
+		log.Infof("mycnf file exists, starting mysqld")
+		if err := mysqlctl.Start(mysqld, *waitTime); err != nil {
+			log.Fatalf("failed to start mysqld: %v", err)
+		}
+	}
+
+	servenv.OnClose(func() {
+		log.Infof("mysqlctld shutting down mysqld")
+		if err := mysqlctl.Shutdown(mysqld, true, *waitTime); err != nil {
+			log.Errorf("failed to shutdown mysqld: %v", err)
+		}
+	})
+
+	mysqlctl.RegisterMysqlctlServer(mysqld)
+	servenv.Run(*port)
+}
@@ -0,0 +1,79 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/rpc"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+func init() {
+	addCommand("Generic", command{
+		"GetFlags",
+		commandGetFlags,
+		"<server addr>",
+		"Lists the flags of a vitess server (vttablet, vtgate, vtctld, ...), with their current value. The flags that can be changed with SetFlag are marked with a '*'."})
+	addCommand("Generic", command{
+		"SetFlag",
+		commandSetFlag,
+		"<server addr>,... <flag name> <value>",
+		"Changes a flag of the given vitess servers at runtime, without restarting them. Only some flags can be changed (log verbosity, pool sizes, throttle rates), and the caller needs the dba role if roles are enforced."})
+}
+
+func commandGetFlags(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action GetFlags requires <server addr>")
+	}
+	client, err := bsonrpc.DialHTTP("tcp", subFlags.Arg(0), 10*time.Second, nil)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	var flags servenv.FlagValues
+	if err := client.Call("Flags.GetFlags", rpc.NilRequest, &flags); err != nil {
+		return "", err
+	}
+	for _, fv := range flags.Flags {
+		mutable := ""
+		if fv.Mutable {
+			mutable = " *"
+		}
+		fmt.Printf("%v=%v%v\n", fv.Name, fv.Value, mutable)
+	}
+	return "", nil
+}
+
+func commandSetFlag(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 3 {
+		log.Fatalf("action SetFlag requires <server addr>,... <flag name> <value>")
+	}
+	rec := concurrency.AllErrorRecorder{}
+	for _, addr := range strings.Split(subFlags.Arg(0), ",") {
+		client, err := bsonrpc.DialHTTP("tcp", addr, 10*time.Second, nil)
+		if err != nil {
+			rec.RecordError(fmt.Errorf("%v: %v", addr, err))
+			continue
+		}
+		var fv servenv.FlagValue
+		if err := client.Call("Flags.SetFlag", &servenv.SetFlagArgs{Name: subFlags.Arg(1), Value: subFlags.Arg(2)}, &fv); err != nil {
+			rec.RecordError(fmt.Errorf("%v: %v", addr, err))
+		} else {
+			fmt.Printf("%v: %v=%v\n", addr, fv.Name, fv.Value)
+		}
+		client.Close()
+	}
+	return "", rec.Error()
+}
@@ -0,0 +1,12 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// Imports and registers the worker library, so the Reshard workflow
+// can run the SplitClone and SplitDiff workers.
+
+import (
+	_ "github.com/youtube/vitess/go/vt/worker"
+)
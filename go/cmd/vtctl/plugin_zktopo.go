@@ -10,8 +10,8 @@ package main
 import (
 	"flag"
 	"fmt"
-	"path"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,7 +22,6 @@ import (
 	"github.com/youtube/vitess/go/vt/wrangler"
 	"github.com/youtube/vitess/go/vt/zktopo"
 	"github.com/youtube/vitess/go/zk"
-	"launchpad.net/gozk/zookeeper"
 )
 
 func init() {
@@ -58,12 +57,49 @@ func init() {
 		"(requires zktopo.Server)\n" +
 			"Export the serving graph entries to the zkns format."})
 
+	addCommand("Generic", command{
+		"TopoGC",
+		commandTopoGC,
+		"[-lock-age=<duration>] [-delete] [<keyspace>]",
+		"(requires zktopo.Server)\n" +
+			"Lists the orphaned topology nodes of a keyspace, or of all keyspaces: tablets, serving graph and replication graph entries\n" +
+			"of keyspaces or shards that don't exist, and lock nodes older than -lock-age. Deletes them with -delete."})
+
+	addCommand("Cells", command{
+		"MirrorTablets",
+		commandMirrorTablets,
+		"[-mirror-cell=global] <cell>",
+		"(requires zktopo.Server)\n" +
+			"Copies the tablet records of the cell into a mirror, in the global topology or in another cell, to restore them with RestoreTablets\n" +
+			"if the topology server of the cell is lost. The vtjanitor tablet_mirror module does it periodically."})
+	addCommand("Cells", command{
+		"RestoreTablets",
+		commandRestoreTablets,
+		"[-mirror-cell=global] <cell>",
+		"(requires zktopo.Server)\n" +
+			"Recreates the tablet records of the cell, and their replication graph, from the mirror made by MirrorTablets.\n" +
+			"The serving graph then needs to be rebuilt with RebuildKeyspaceGraph."})
+
 	addCommand("Shards", command{
 		"ListShardActions",
 		commandListShardActions,
-		"<keyspace/shard|zk shard path>",
+		"[-stuck-age=<duration>] <keyspace/shard|zk shard path>",
+		"(requires zktopo.Server)\n" +
+			"List all active actions in a given shard and its tablets, with their age. The ones older than -stuck-age are flagged STUCK."})
+	addCommand("Keyspaces", command{
+		"ListKeyspaceActions",
+		commandListKeyspaceActions,
+		"[-stuck-age=<duration>] <keyspace|zk global keyspace path>",
+		"(requires zktopo.Server)\n" +
+			"List all active actions in a given keyspace, its shards and their tablets, with their age. The ones older than -stuck-age are flagged STUCK."})
+	addCommand("Generic", command{
+		"StuckActions",
+		commandStuckActions,
+		"[-stuck-age=<duration>] [-requeue|-cancel] <keyspace|keyspace/shard> ...",
 		"(requires zktopo.Server)\n" +
-			"List all active actions in a given shard."})
+			"List the actions of the keyspaces or shards, and their tablets, unchanged for longer than -stuck-age.\n" +
+			"-requeue resets the stuck tablet actions so their tablet runs them again. -cancel fails the stuck actions\n" +
+			"and removes them from their queue, which breaks the lock of a shard or keyspace action."})
 
 	resolveWildcards = zkResolveWildcards
 }
@@ -98,6 +134,73 @@ func commandPurgeActions(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []s
 	return "", nil
 }
 
+func commandTopoGC(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	lockAge := subFlags.Duration("lock-age", 24*time.Hour, "how old a lock node has to be to be considered left behind")
+	deleteOrphans := subFlags.Bool("delete", false, "delete the orphaned nodes")
+	subFlags.Parse(args)
+	if subFlags.NArg() > 1 {
+		log.Fatalf("action TopoGC takes at most one <keyspace>")
+	}
+	zkts, ok := wr.TopoServer().(*zktopo.Server)
+	if !ok {
+		return "", fmt.Errorf("TopoGC requires a zktopo.Server")
+	}
+	cells, err := zkts.GetKnownCells()
+	if err != nil {
+		return "", err
+	}
+	orphans, err := zkts.FindOrphans(cells, subFlags.Arg(0), *lockAge)
+	if err != nil {
+		return "", err
+	}
+	for _, orphan := range orphans {
+		if *deleteOrphans {
+			if err := zkts.DeleteOrphan(orphan); err != nil {
+				return "", fmt.Errorf("cannot delete %v: %v", orphan, err)
+			}
+			fmt.Println("deleted", orphan)
+		} else {
+			fmt.Println(orphan)
+		}
+	}
+	return "", nil
+}
+
+func commandMirrorTablets(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	mirrorCell := subFlags.String("mirror-cell", "global", "where to keep the mirror: global, or another cell")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action MirrorTablets requires <cell>")
+	}
+	zkts, ok := wr.TopoServer().(*zktopo.Server)
+	if !ok {
+		return "", fmt.Errorf("MirrorTablets requires a zktopo.Server")
+	}
+	changes, err := zkts.MirrorTablets(subFlags.Arg(0), *mirrorCell)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("%v changes in %v\n", changes, zktopo.TabletMirrorPath(*mirrorCell, subFlags.Arg(0)))
+	return "", nil
+}
+
+func commandRestoreTablets(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	mirrorCell := subFlags.String("mirror-cell", "global", "where the mirror is: global, or another cell")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action RestoreTablets requires <cell>")
+	}
+	zkts, ok := wr.TopoServer().(*zktopo.Server)
+	if !ok {
+		return "", fmt.Errorf("RestoreTablets requires a zktopo.Server")
+	}
+	restored, err := zkts.RestoreTablets(subFlags.Arg(0), *mirrorCell)
+	for _, alias := range restored {
+		fmt.Println("restored", alias)
+	}
+	return "", err
+}
+
 func staleActions(zkts *zktopo.Server, zkActionPath string, maxStaleness time.Duration) ([]*tm.ActionNode, error) {
 	// get the stale strings
 	actionNodes, err := zkts.StaleActions(zkActionPath, maxStaleness, tm.ActionNodeIsStale)
@@ -223,112 +326,217 @@ func commandExportZknsForKeyspace(wr *wrangler.Wrangler, subFlags *flag.FlagSet,
 	return "", wr.ExportZknsForKeyspace(keyspace)
 }
 
-func getActions(zconn zk.Conn, actionPath string) ([]*tm.ActionNode, error) {
-	actions, _, err := zconn.Children(actionPath)
+// queuedAction is an action node, with how long since it was last
+// changed.
+type queuedAction struct {
+	node *tm.ActionNode
+	age  time.Duration
+}
+
+// fmtQueuedAction formats an action, flagged as stuck if it is older
+// than stuckAge.
+func fmtQueuedAction(action queuedAction, stuckAge time.Duration) string {
+	result := fmt.Sprintf("%v %v", fmtAction(action.node), action.age)
+	if stuckAge > 0 && action.age > stuckAge {
+		result += " STUCK"
+	}
+	return result
+}
+
+func getActions(zkts *zktopo.Server, actionPath string) ([]queuedAction, error) {
+	entries, err := zkts.GetActionQueue(actionPath)
 	if err != nil {
 		return nil, fmt.Errorf("getActions failed: %v %v", actionPath, err)
 	}
-	sort.Strings(actions)
-	wg := sync.WaitGroup{}
-	mu := sync.Mutex{}
-	nodes := make([]*tm.ActionNode, 0, len(actions))
-	for _, action := range actions {
-		wg.Add(1)
-		go func(action string) {
-			defer wg.Done()
-			actionNodePath := path.Join(actionPath, action)
-			data, _, err := zconn.Get(actionNodePath)
-			if err != nil && !zookeeper.IsError(err, zookeeper.ZNONODE) {
-				log.Warningf("getActions: %v %v", actionNodePath, err)
-				return
-			}
-			actionNode, err := tm.ActionNodeFromJson(data, actionNodePath)
-			if err != nil {
-				log.Warningf("getActions: %v %v", actionNodePath, err)
-				return
-			}
-			mu.Lock()
-			nodes = append(nodes, actionNode)
-			mu.Unlock()
-		}(action)
+	actions := make([]queuedAction, 0, len(entries))
+	for _, entry := range entries {
+		actionNode, err := tm.ActionNodeFromJson(entry.Data, entry.Path)
+		if err != nil {
+			log.Warningf("getActions: %v %v", entry.Path, err)
+			continue
+		}
+		actions = append(actions, queuedAction{actionNode, entry.Age})
 	}
-	wg.Wait()
-
-	return nodes, nil
+	return actions, nil
 }
 
-func listActionsByShard(ts topo.Server, keyspace, shard string) error {
+// getShardActions returns the actions of a shard, followed by the
+// actions of its tablets sorted by path.
+func getShardActions(ts topo.Server, keyspace, shard string) ([]queuedAction, error) {
 	// only works with Server
 	zkts, ok := ts.(*zktopo.Server)
 	if !ok {
-		return fmt.Errorf("listActionsByShard only works with zktopo.Server")
+		return nil, fmt.Errorf("getShardActions only works with zktopo.Server")
 	}
 
-	// print the shard action nodes
-	shardActionPath := zkts.ShardActionPath(keyspace, shard)
-	shardActionNodes, err := getActions(zkts.GetZConn(), shardActionPath)
+	// the shard action nodes
+	actions, err := getActions(zkts, zkts.ShardActionPath(keyspace, shard))
 	if err != nil {
-		return err
-	}
-	for _, shardAction := range shardActionNodes {
-		fmt.Println(fmtAction(shardAction))
+		return nil, err
 	}
 
-	// get and print the tablet action nodes
+	// the tablet action nodes
 	wg := sync.WaitGroup{}
 	mu := sync.Mutex{}
-	actionMap := make(map[string]*tm.ActionNode)
+	actionMap := make(map[string]queuedAction)
 
 	f := func(actionPath string) {
 		defer wg.Done()
-		actionNodes, err := getActions(zkts.GetZConn(), actionPath)
+		tabletActions, err := getActions(zkts, actionPath)
 		if err != nil {
-			log.Warningf("listActionsByShard %v", err)
+			log.Warningf("getShardActions %v", err)
 			return
 		}
 		mu.Lock()
-		for _, node := range actionNodes {
-			actionMap[node.Path()] = node
+		for _, action := range tabletActions {
+			actionMap[action.node.Path()] = action
 		}
 		mu.Unlock()
 	}
 
 	tabletAliases, err := topo.FindAllTabletAliasesInShard(ts, keyspace, shard)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for _, tabletAlias := range tabletAliases {
-		actionPath := zktopo.TabletActionPathForAlias(tabletAlias)
-		if err != nil {
-			log.Warningf("listActionsByShard %v", err)
-		} else {
-			wg.Add(1)
-			go f(actionPath)
-		}
+		wg.Add(1)
+		go f(zktopo.TabletActionPathForAlias(tabletAlias))
 	}
-
 	wg.Wait()
-	mu.Lock()
-	defer mu.Unlock()
 
-	keys := wrangler.CopyMapKeys(actionMap, []string{}).([]string)
+	keys := make([]string, 0, len(actionMap))
+	for key := range actionMap {
+		keys = append(keys, key)
+	}
 	sort.Strings(keys)
 	for _, key := range keys {
-		action := actionMap[key]
-		if action == nil {
-			log.Warningf("nil action: %v", key)
-		} else {
-			fmt.Println(fmtAction(action))
+		actions = append(actions, actionMap[key])
+	}
+	return actions, nil
+}
+
+// getKeyspaceActions returns the actions of a keyspace, followed by
+// the actions of each of its shards.
+func getKeyspaceActions(ts topo.Server, keyspace string) ([]queuedAction, error) {
+	zkts, ok := ts.(*zktopo.Server)
+	if !ok {
+		return nil, fmt.Errorf("getKeyspaceActions only works with zktopo.Server")
+	}
+
+	actions, err := getActions(zkts, zkts.KeyspaceActionPath(keyspace))
+	if err != nil {
+		return nil, err
+	}
+	shards, err := ts.GetShardNames(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(shards)
+	for _, shard := range shards {
+		shardActions, err := getShardActions(ts, keyspace, shard)
+		if err != nil {
+			return nil, err
 		}
+		actions = append(actions, shardActions...)
 	}
-	return nil
+	return actions, nil
+}
+
+// getActionsParam returns the actions of a <keyspace> or
+// <keyspace/shard> parameter.
+func getActionsParam(ts topo.Server, param string) ([]queuedAction, error) {
+	if param[0] != '/' && !strings.Contains(param, "/") {
+		return getKeyspaceActions(ts, param)
+	}
+	keyspace, shard := shardParamToKeyspaceShard(param)
+	return getShardActions(ts, keyspace, shard)
 }
 
 func commandListShardActions(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	stuckAge := subFlags.Duration("stuck-age", 10*time.Minute, "flag the actions unchanged for longer as stuck")
 	subFlags.Parse(args)
 	if subFlags.NArg() != 1 {
 		log.Fatalf("action ListShardActions requires <keyspace/shard|zk shard path>")
 	}
 	keyspace, shard := shardParamToKeyspaceShard(subFlags.Arg(0))
-	return "", listActionsByShard(wr.TopoServer(), keyspace, shard)
+	actions, err := getShardActions(wr.TopoServer(), keyspace, shard)
+	if err != nil {
+		return "", err
+	}
+	for _, action := range actions {
+		fmt.Println(fmtQueuedAction(action, *stuckAge))
+	}
+	return "", nil
+}
+
+func commandListKeyspaceActions(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	stuckAge := subFlags.Duration("stuck-age", 10*time.Minute, "flag the actions unchanged for longer as stuck")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action ListKeyspaceActions requires <keyspace|zk global keyspace path>")
+	}
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	actions, err := getKeyspaceActions(wr.TopoServer(), keyspace)
+	if err != nil {
+		return "", err
+	}
+	for _, action := range actions {
+		fmt.Println(fmtQueuedAction(action, *stuckAge))
+	}
+	return "", nil
+}
+
+func commandStuckActions(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	stuckAge := subFlags.Duration("stuck-age", 10*time.Minute, "how long since the last change before an action is considered stuck")
+	requeue := subFlags.Bool("requeue", false, "requeue the stuck tablet actions, so their tablet runs them again")
+	cancel := subFlags.Bool("cancel", false, "cancel the stuck actions, failing them for their waiters")
+	subFlags.Parse(args)
+	if subFlags.NArg() == 0 {
+		log.Fatalf("action StuckActions requires <keyspace|keyspace/shard> ...")
+	}
+	if *requeue && *cancel {
+		log.Fatalf("action StuckActions cannot both -requeue and -cancel")
+	}
+	zkts, ok := wr.TopoServer().(*zktopo.Server)
+	if !ok {
+		return "", fmt.Errorf("StuckActions requires a zktopo.Server")
+	}
+
+	errCount := 0
+	for _, param := range subFlags.Args() {
+		actions, err := getActionsParam(zkts, param)
+		if err != nil {
+			errCount++
+			log.Errorf("can't list the actions of %v: %v", param, err)
+			continue
+		}
+		for _, action := range actions {
+			if action.age <= *stuckAge {
+				continue
+			}
+			fmt.Println(fmtQueuedAction(action, *stuckAge))
+
+			node := action.node
+			switch {
+			case *requeue:
+				node.State = tm.ACTION_STATE_QUEUED
+				node.Pid = 0
+				node.Error = ""
+				err = zkts.RequeueAction(node.Path(), tm.ActionNodeToJson(node))
+			case *cancel:
+				node.State = tm.ACTION_STATE_FAILED
+				node.Pid = 0
+				node.Error = fmt.Sprintf("cancelled by StuckActions after %v", action.age)
+				err = zkts.CancelAction(node.Path(), tm.ActionNodeToJson(node))
+			}
+			if err != nil {
+				errCount++
+				log.Errorf("can't fix stuck action %v: %v", node.Path(), err)
+			}
+		}
+	}
+	if errCount > 0 {
+		return "", fmt.Errorf("some errors occurred, check the log")
+	}
+	return "", nil
 }
@@ -26,8 +26,8 @@ func init() {
 	addCommand("Shards", command{
 		"ReparentShard",
 		commandReparentShard,
-		"[-force] [-leave-master-read-only] <keyspace/shard|zk shard path> <tablet alias|zk tablet path>",
-		"Specify which shard to reparent and which tablet should be the new master."})
+		"[-force] [-leave-master-read-only] [-skip-permissions-check] <keyspace/shard|zk shard path> <tablet alias|zk tablet path>",
+		"Specify which shard to reparent and which tablet should be the new master. When the current master is alive, the new master must have the same permissions, unless -skip-permissions-check is set."})
 }
 
 func commandDemoteMaster(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
@@ -51,6 +51,7 @@ func commandReparentTablet(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args [
 func commandReparentShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	leaveMasterReadOnly := subFlags.Bool("leave-master-read-only", false, "leaves the master read-only after reparenting")
 	force := subFlags.Bool("force", false, "will force the reparent even if the master is already correct")
+	skipPermissionsCheck := subFlags.Bool("skip-permissions-check", false, "doesn't check the new master has the same permissions as the current master")
 	subFlags.Parse(args)
 	if subFlags.NArg() != 2 {
 		log.Fatalf("action ReparentShard requires <keyspace/shard|zk shard path> <tablet alias|zk tablet path>")
@@ -58,5 +59,5 @@ func commandReparentShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []
 
 	keyspace, shard := shardParamToKeyspaceShard(subFlags.Arg(0))
 	tabletAlias := tabletParamToTabletAlias(subFlags.Arg(1))
-	return "", wr.ReparentShard(keyspace, shard, tabletAlias, *leaveMasterReadOnly, *force)
+	return "", wr.ReparentShard(keyspace, shard, tabletAlias, *leaveMasterReadOnly, *force, *skipPermissionsCheck)
 }
@@ -6,6 +6,7 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -21,12 +22,14 @@ import (
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/flagutil"
+	"github.com/youtube/vitess/go/jscfg"
 	"github.com/youtube/vitess/go/tb"
 	"github.com/youtube/vitess/go/vt/client2"
 	hk "github.com/youtube/vitess/go/vt/hook"
 	"github.com/youtube/vitess/go/vt/key"
 	_ "github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 	tm "github.com/youtube/vitess/go/vt/tabletmanager"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/wrangler"
@@ -52,22 +55,26 @@ var commands = []commandGroup{
 	commandGroup{
 		"Tablets", []command{
 			command{"InitTablet", commandInitTablet,
-				"[-force] [-parent] [-update] [-db-name-override=<db name>] <tablet alias|zk tablet path> <hostname> <mysql port> <vt port> <keyspace> <shard id> <tablet type> [<parent alias|zk parent alias>]",
+				"[-force] [-parent] [-update] [-join] [-db-name-override=<db name>] <tablet alias|zk tablet path> <hostname> <mysql port> <vt port> <keyspace> <shard id> <tablet type> [<parent alias|zk parent alias>]",
 				"Initializes a tablet in the topology.\n" +
+					"With -join, the tablet record is created or updated, a slave tablet is reparented to the shard master, and a serving tablet is added to the serving graph of its cell. The tablet's vttablet must be running. It is safe to run it again.\n" +
 					"Valid <tablet type>:\n" +
 					"  " + strings.Join(topo.MakeStringTypeList(topo.AllTabletTypes), " ")},
 			command{"UpdateTabletAddrs", commandUpdateTabletAddrs,
-				"[-hostname <hostname>] [-ip-addr <ip addr>] [-mysql-port <mysql port>] [-vt-port <vt port>] [-vts-port <vts port>] <tablet alias|zk tablet path> ",
-				"Updates the addresses of a tablet."},
+				"[-hostname <hostname>] [-ip-addr <ip addr>] [-mysql-port <mysql port>] [-vt-port <vt port>] [-vts-port <vts port>] [-named-ports <name>:<port>,...] <tablet alias|zk tablet path> ",
+				"Updates the addresses of a tablet. The named ports are added to the other ports of the tablet."},
 			command{"ScrapTablet", commandScrapTablet,
 				"[-force] [-skip-rebuild] <tablet alias|zk tablet path>",
-				"Scraps a tablet."},
+				"Scraps a tablet, and removes it from the replication graph and from the serving graph of its cell. With -force, the tablet is not contacted, use it when its host is unreachable."},
+			command{"PurgeScrappedTablets", commandPurgeScrappedTablets,
+				"[-days=7] [<cell>...]",
+				"Deletes the records of the tablets that were scrapped more than the given number of days ago, in the given cells or in all cells."},
 			command{"SetReadOnly", commandSetReadOnly,
 				"[<tablet alias|zk tablet path>]",
-				"Sets the tablet as ReadOnly."},
+				"Sets the mysql of the tablet read-only, checks it took, and records it in the tablet record."},
 			command{"SetReadWrite", commandSetReadWrite,
 				"[<tablet alias|zk tablet path>]",
-				"Sets the tablet as ReadWrite."},
+				"Sets the mysql of the tablet read-write, checks it took, and records it in the tablet record."},
 			command{"ChangeSlaveType", commandChangeSlaveType,
 				"[-force] [-dry-run] <tablet alias|zk tablet path> <tablet type>",
 				"Change the db type for this tablet if possible. This is mostly for arranging replicas - it will not convert a master.\n" +
@@ -79,10 +86,16 @@ var commands = []commandGroup{
 				"Check that the agent is awake and responding - can be blocked by other in-flight operations."},
 			command{"RpcPing", commandRpcPing,
 				"<tablet alias|zk tablet path>",
-				"Check that the agent is awake and responding to RPCs."},
+				"Check that the agent is awake and responding to RPCs, without going through the action queue, and print the round-trip time."},
+			command{"RefreshState", commandRefreshState,
+				"<tablet alias|zk tablet path>",
+				"Make the agent re-read its tablet record and reconcile its serving state with it, without going through the action queue."},
 			command{"Query", commandQuery,
 				"<cell> <keyspace> [<user> <password>] <query>",
 				"Send a SQL query to a tablet."},
+			command{"Explain", commandExplain,
+				"[-bind-variables=<json>] <cell> <keyspace> <query>",
+				"Shows the shards Query would send a SQL query to, and how they are found, without sending it."},
 			command{"Sleep", commandSleep,
 				"<tablet alias|zk tablet path> <duration>",
 				"Block the action queue for the specified duration (mostly for testing)."},
@@ -102,14 +115,29 @@ var commands = []commandGroup{
 				"[-force] [-concurrency=4] [-fetch-concurrency=3] [-fetch-retry-count=3] [-server-mode] <src tablet alias|zk src tablet path> <dst tablet alias|zk dst tablet path> ...",
 				"This performs Snapshot and then Restore on all the targets in parallel. The advantage of having separate actions is that one snapshot can be used for many restores, and it's then easier to spread them over time."},
 			command{"MultiSnapshot", commandMultiSnapshot,
-				"[-force] [-concurrency=8] [-skip-slave-restart] [-maximum-file-size=134217728] -spec='-' -tables='' <tablet alias|zk tablet path> <key name>",
+				"[-force] [-concurrency=8] [-skip-slave-restart] [-maximum-file-size=134217728] [-key-type=uint64] -spec='-' -tables='' <tablet alias|zk tablet path> <key name>",
 				"Locks mysqld and copy compressed data aside."},
 			command{"MultiRestore", commandMultiRestore,
 				"[-force] [-concurrency=4] [-fetch-concurrency=4] [-insert-table-concurrency=4] [-fetch-retry-count=3] [-strategy=] <dst tablet alias|destination zk path> <source zk path>...",
 				"Restores a snapshot from multiple hosts."},
 			command{"ExecuteHook", commandExecuteHook,
 				"<tablet alias|zk tablet path> <hook name> [<param1=value1> <param2=value2> ...]",
-				"This runs the specified hook on the given tablet."},
+				"This runs the specified hook on the given tablet. Hooks are executables in the vthook directory of the tablet host ($VTROOT/vthook, or the directory given to vttablet with -vthook-dir)."},
+			command{"ExecuteFetch", commandExecuteFetch,
+				"[-max-rows=10000] [-want-fields] [-disable-binlogs] <tablet alias|zk tablet path> <sql command>",
+				"Runs the given sql command as the dba user on the remote tablet. With -disable-binlogs, the command won't be replicated."},
+			command{"GetSlaveStatus", commandGetSlaveStatus,
+				"<tablet alias|zk tablet path>",
+				"Outputs a json structure with the replication state of the mysql of the tablet: position, master, running threads and last errors."},
+			command{"StartSlave", commandStartSlave,
+				"<tablet alias|zk tablet path>",
+				"Starts the mysql replication of the tablet."},
+			command{"StopSlave", commandStopSlave,
+				"<tablet alias|zk tablet path>",
+				"Stops the mysql replication of the tablet. It is not restarted automatically."},
+			command{"GetReparentJournal", commandGetReparentJournal,
+				"[-limit=10] <tablet alias|zk tablet path>",
+				"Outputs a json list of the last entries of the reparent journal of the tablet, most recent first. Every reparent writes an entry on the new master, that replicates to the slaves: tablets of the same shard that disagree on their last entry disagree on who the master is."},
 		},
 	},
 	commandGroup{
@@ -117,12 +145,20 @@ var commands = []commandGroup{
 			command{"CreateShard", commandCreateShard,
 				"[-force] [-parent] <keyspace/shard|zk shard path>",
 				"Creates the given shard"},
+			command{"DeleteShard", commandDeleteShard,
+				"[-recursive] [-even-if-serving] <keyspace/shard|zk shard path>",
+				"Deletes the given shard, its replication graph and its serving graph in all its cells. Fails if it still has tablets, unless -recursive is set.\n" +
+					"Even with -recursive, fails if one of its tablets is serving, unless -even-if-serving is set. The keyspace graph has to be rebuilt after."},
 			command{"RebuildShardGraph", commandRebuildShardGraph,
 				"[-cells=a,b] <zk shard path> ... (/zk/global/vt/keyspaces/<keyspace>/shards/<shard>)",
 				"Rebuild the replication graph and shard serving data in zk. This may trigger an update to all connected clients."},
 			command{"ShardExternallyReparented", commandShardExternallyReparented,
 				"[-scrap-stragglers] [-accept-success-percents=80] <keyspace/shard|zk shard path> <tablet alias|zk tablet path>",
 				"Changes metadata to acknowledge a shard master change performed by an external tool."},
+			command{"TabletExternallyReparented", commandTabletExternallyReparented,
+				"[-scrap-stragglers] [-accept-success-percents=80] <tablet alias|zk tablet path|mysql host:port>",
+				"Same as ShardExternallyReparented, for the shard of the given tablet. Meant to be called by an external failover tool (like orchestrator) after it promoted the tablet's mysqld, which can be designated by its address.\n" +
+					"NOTE: with -orchestrator-url, vtctl also puts the master in maintenance in orchestrator while ReparentShard runs."},
 			command{"ValidateShard", commandValidateShard,
 				"[-ping-tablets] <keyspace/shard|zk shard path>",
 				"Validate all nodes reachable from this shard are consistent."},
@@ -147,6 +183,18 @@ var commands = []commandGroup{
 			command{"ShardReplicationFix", commandShardReplicationFix,
 				"<cell> <keyspace/shard|zk shard path>",
 				"Walks through a ShardReplication object and fixes the first error it encrounters"},
+			command{"ListDistributedTransactions", commandListDistributedTransactions,
+				"[-abandon-age=0] <keyspace/shard|zk shard path>",
+				"Lists the in-doubt distributed transactions older than -abandon-age, whose metadata is kept by the master of the given shard (the -dtx-shard of vtgate)."},
+			command{"ResolveDistributedTransaction", commandResolveDistributedTransaction,
+				"[-abandon-age=1m] [-force] <keyspace/shard|zk shard path> <dtid>",
+				"Finishes an in-doubt distributed transaction, whose metadata is kept by the master of the given shard: it is committed on all its participants if the commit decision was made, and rolled back otherwise. A transaction still being prepared is only rolled back if it is older than -abandon-age, or with -force."},
+			command{"GetDiffReports", commandGetDiffReports,
+				"<keyspace/shard|zk shard path>",
+				"Lists the reports of the diff workers (SplitDiff, VerticalSplitDiff) that compared the given destination shard with its source."},
+			command{"GetDiffReport", commandGetDiffReport,
+				"<keyspace/shard|zk shard path> <report id>",
+				"Displays a diff report of the given destination shard: the rows compared, mismatched, extra and missing for each table, with sample primary keys."},
 		},
 	},
 	commandGroup{
@@ -154,6 +202,10 @@ var commands = []commandGroup{
 			command{"CreateKeyspace", commandCreateKeyspace,
 				"[-force] <keyspace name|zk keyspace path>",
 				"Creates the given keyspace"},
+			command{"DeleteKeyspace", commandDeleteKeyspace,
+				"[-recursive] [-even-if-serving] <keyspace name|zk keyspace path>",
+				"Deletes the given keyspace, and its serving graph in all cells. Fails if it still has shards, unless -recursive is set:\n" +
+					"then all its shards are deleted, like DeleteShard -recursive does."},
 			command{"RebuildKeyspaceGraph", commandRebuildKeyspaceGraph,
 				"[-cells=a,b] [-use-served-types] <zk keyspace path> ... (/zk/global/vt/keyspaces/<keyspace>)",
 				"Rebuild the serving data for all shards in this keyspace. This may trigger an update to all connected clients."},
@@ -163,6 +215,71 @@ var commands = []commandGroup{
 			command{"MigrateServedTypes", commandMigrateServedTypes,
 				"[-reverse] <keyspace/source shard|zk source shard path> <served type>",
 				"Migrates a serving type from the source shard to the shards it replicates to. Will also rebuild the serving graph."},
+			command{"GetVSchema", commandGetVSchema,
+				"<keyspace name|zk keyspace path>",
+				"Displays the VSchema of a keyspace, that describes how its tables are sharded."},
+			command{"ApplyVSchema", commandApplyVSchema,
+				"{-vschema=<json> || -vschema-file=<json file>} <keyspace name|zk keyspace path>",
+				"Validates and saves the VSchema of a keyspace."},
+			command{"ValidateVSchema", commandValidateVSchema,
+				"<keyspace name|zk keyspace path>",
+				"Validates the VSchema of a keyspace against the rest of the topology."},
+			command{"SetRoutingRule", commandSetRoutingRule,
+				"[-from-type=<tablet type>] [-to-type=<tablet type>] <from keyspace> <to keyspace>",
+				"Makes vtgate send the queries for a keyspace, and a tablet type if -from-type is set, to another keyspace,\n" +
+					"and another tablet type if -to-type is set. Replaces the existing rule for the same keyspace and type."},
+			command{"ClearRoutingRule", commandClearRoutingRule,
+				"[-from-type=<tablet type>] <from keyspace>",
+				"Removes the routing rule of a keyspace, and tablet type if -from-type is set."},
+			command{"GetRoutingRules", commandGetRoutingRules,
+				"",
+				"Displays the routing rules of vtgate."},
+			command{"Reshard", commandReshard,
+				"[-cell=<cell>] [-exclude-tables=''] [-resolver=numeric] [-key-type=uint64] [-clone-flags=''] [-diff-flags=''] <keyspace name|zk keyspace path> <source shard>,... <destination shard>,... <key name>",
+				"Reshards a keyspace, as a workflow: creates the destination shards, copies the schema and the data from rdonly tablets of the\n" +
+					"source shards, runs a diff on each destination, then migrates the rdonly, replica and master served types.\n" +
+					"The destination shards need tablets before the schema copy. Prints the workflow id, to follow it with GetWorkflows,\n" +
+					"or PauseWorkflow, ResumeWorkflow and RollbackWorkflow it. -clone-flags and -diff-flags are passed to the workers, as in vtworker."},
+			command{"GetWorkflows", commandGetWorkflows,
+				"<keyspace name|zk keyspace path>",
+				"Displays the workflows of a keyspace (planned reparents, served type migrations), with the state of their steps."},
+			command{"PauseWorkflow", commandPauseWorkflow,
+				"<keyspace name|zk keyspace path> <workflow id>",
+				"Asks a running workflow to stop before its next step. It can then be resumed or rolled back."},
+			command{"ResumeWorkflow", commandResumeWorkflow,
+				"<keyspace name|zk keyspace path> <workflow id>",
+				"Runs a failed or paused workflow again, from the step that failed, or the step it was paused before."},
+			command{"RollbackWorkflow", commandRollbackWorkflow,
+				"<keyspace name|zk keyspace path> <workflow id>",
+				"Reverts the steps a workflow ran, in reverse order. Fails if one of them cannot be reverted (like promoting the new master of a reparent)."},
+		},
+	},
+	commandGroup{
+		"Cells", []command{
+			command{"AddCell", commandAddCell,
+				"<cell> <topology server address>",
+				"Registers a new cell in the global topology, with the address of its topology server (for zookeeper, a comma separated list of host:port),\n" +
+					"so all processes can find it without changing their configuration. Creates the cell paths, and rebuilds the serving graph of all keyspaces in the cell."},
+			command{"GetCellInfo", commandGetCellInfo,
+				"<cell>",
+				"Displays the information of a cell registered with AddCell."},
+			command{"UpdateCellInfo", commandUpdateCellInfo,
+				"<cell> <topology server address>",
+				"Changes the address of the topology server of a cell registered with AddCell, for instance to add zookeeper servers.\n" +
+					"The processes use the new address when they connect to the cell again, after their cache of the cell address expires (-zk.cell-cache-ttl)."},
+			command{"RemoveCell", commandRemoveCell,
+				"[-force] <cell>",
+				"Unregisters a cell added with AddCell. Fails if the cell still has tablets, unless -force is set. Removes the serving and replication graphs of the cell."},
+			command{"SetCellsAlias", commandSetCellsAlias,
+				"<alias> <cell1>,<cell2>,...",
+				"Creates or replaces a cells alias, a group of cells like a region. When a cell has no serving tablets of a type in a shard,\n" +
+					"vtgate and the serving graph lookups use the tablets of the other cells of its alias, in order. A cell can only be in one alias."},
+			command{"GetCellsAliases", commandGetCellsAliases,
+				"",
+				"Displays all the cells aliases."},
+			command{"DeleteCellsAlias", commandDeleteCellsAlias,
+				"<alias>",
+				"Deletes a cells alias."},
 		},
 	},
 	commandGroup{
@@ -176,6 +293,11 @@ var commands = []commandGroup{
 			command{"Validate", commandValidate,
 				"[-ping-tablets]",
 				"Validate all nodes reachable from global replication graph and all tablets in all discoverable cells are consistent."},
+			command{"CheckServingGraph", commandCheckServingGraph,
+				"[<cell>...]",
+				"Checks the serving graph of the cells, or of all cells, can be derived from the global keyspace, shard and tablet records:\n" +
+					"no missing or extra types and shards, and key ranges covering each keyspace exactly once per type.\n" +
+					"Prints the findings in json, and fails if there are any."},
 			command{"RebuildReplicationGraph", commandRebuildReplicationGraph,
 				"<cell1|zk local vt path1>,<cell2|zk local vt path2>... <keyspace1>,<keyspace2>,...",
 				"HIDDEN This takes the Thor's hammer approach of recovery and should only be used in emergencies.  cell1,cell2,... are the canonical source of data for the system. This function uses that canonical data to recover the replication graph, at which point further auditing with Validate can reveal any remaining issues."},
@@ -185,6 +307,16 @@ var commands = []commandGroup{
 			command{"ListTablets", commandListTablets,
 				"<tablet alias|zk tablet path> ...",
 				"List specified tablets in an awk-friendly way."},
+			command{"FreezeTopology", commandFreezeTopology,
+				"<reason>",
+				"Freezes the topology: until it is unfrozen, all the changes to the topology fail (in every process, in every cell),\n" +
+					"except the ones from processes started with -topo_bypass_freeze. Use it to block control plane changes during a topology server maintenance, or an incident."},
+			command{"UnfreezeTopology", commandUnfreezeTopology,
+				"",
+				"Unfreezes the topology."},
+			command{"GetTopologyFreeze", commandGetTopologyFreeze,
+				"",
+				"Displays why the topology is frozen, or fails if it is not."},
 		},
 	},
 	commandGroup{
@@ -192,24 +324,42 @@ var commands = []commandGroup{
 			command{"GetSchema", commandGetSchema,
 				"[-tables=<table1>,<table2>,...] [-include-views] <tablet alias|zk tablet path>",
 				"Display the full schema for a tablet, or just the schema for the provided tables."},
+			command{"GetTableStats", commandGetTableStats,
+				"[-buckets=16] <tablet alias|zk tablet path> <table>",
+				"Display the approximate row count and primary key distribution of a table, as used to split it in chunks."},
 			command{"ValidateSchemaShard", commandValidateSchemaShard,
-				"[-include-views] <keyspace/shard|zk shard path>",
+				"[-exclude-tables=''] [-include-views] <keyspace/shard|zk shard path>",
 				"Validate the master schema matches all the slaves."},
 			command{"ValidateSchemaKeyspace", commandValidateSchemaKeyspace,
-				"[-include-views] <keyspace name|zk keyspace path>",
+				"[-exclude-tables=''] [-include-views] <keyspace name|zk keyspace path>",
 				"Validate the master schema from shard 0 matches all the other tablets in the keyspace."},
 			command{"PreflightSchema", commandPreflightSchema,
 				"{-sql=<sql> || -sql-file=<filename>} <tablet alias|zk tablet path>",
-				"Apply the schema change to a temporary database to gather before and after schema and validate the change. The sql can be inlined or read from a file."},
+				"Apply the schema change to a temporary database to gather before and after schema and validate the change, and list the tables it creates, drops or alters. The sql can be inlined or read from a file."},
 			command{"ApplySchema", commandApplySchema,
 				"[-force] {-sql=<sql> || -sql-file=<filename>} [-skip-preflight] [-stop-replication] <tablet alias|zk tablet path>",
 				"Apply the schema change to the specified tablet (allowing replication by default). The sql can be inlined or read from a file. Note this doesn't change any tablet state (doesn't go into 'schema' type)."},
 			command{"ApplySchemaShard", commandApplySchemaShard,
-				"[-force] {-sql=<sql> || -sql-file=<filename>} [-simple] [-new-parent=<zk tablet path>] <keyspace/shard|zk shard path>",
-				"Apply the schema change to the specified shard. If simple is specified, we just apply on the live master. Otherwise we will need to do the shell game. So we will apply the schema change to every single slave. if new_parent is set, we will also reparent (otherwise the master won't be touched at all). Using the force flag will cause a bunch of checks to be ignored, use with care."},
+				"[-force] {-sql=<sql> || -sql-file=<filename>} [-simple] [-new-parent=<zk tablet path>] [-vtgates=<vtgate addr>,...] <keyspace/shard|zk shard path>",
+				"Apply the schema change to the specified shard. If simple is specified, we just apply on the live master. Otherwise we will need to do the shell game. So we will apply the schema change to every single slave. if new_parent is set, we will also reparent (otherwise the master won't be touched at all). Using the force flag will cause a bunch of checks to be ignored, use with care. The schema caches of the vtgates are invalidated after the change."},
 			command{"ApplySchemaKeyspace", commandApplySchemaKeyspace,
-				"[-force] {-sql=<sql> || -sql-file=<filename>} [-simple] <keyspace|zk keyspace path>",
-				"Apply the schema change to the specified keyspace. If simple is specified, we just apply on the live masters. Otherwise we will need to do the shell game on each shard. So we will apply the schema change to every single slave (running in parallel on all shards, but on one host at a time in a given shard). We will not reparent at the end, so the masters won't be touched at all. Using the force flag will cause a bunch of checks to be ignored, use with care."},
+				"[-force] {-sql=<sql> || -sql-file=<filename>} [-simple] [-online] [-vtgates=<vtgate addr>,...] <keyspace|zk keyspace path>",
+				"Apply the schema change to the specified keyspace. If simple is specified, we just apply on the live masters. Otherwise we will need to do the shell game on each shard. So we will apply the schema change to every single slave (running in parallel on all shards, but on one host at a time in a given shard). We will not reparent at the end, so the masters won't be touched at all. Once the change is applied, we verify all the tablets have the new schema (waiting for replication if necessary). Using the force flag will cause a bunch of checks to be ignored, use with care. The schema caches of the vtgates are invalidated after the change. If online is specified, the change is tracked as a schema migration, and applied on the master of each shard, one shard at a time, by the 'online_schema_change' hook (that runs an online schema change tool)."},
+			command{"GetSchemaMigrations", commandGetSchemaMigrations,
+				"<keyspace|zk keyspace path>",
+				"Display the online schema migrations of a keyspace, with their state on each shard."},
+			command{"ThrottleSchemaMigration", commandThrottleSchemaMigration,
+				"[-unthrottle] <keyspace|zk keyspace path> <migration id>",
+				"Throttle an online schema migration: the shard being migrated is paused by the 'online_schema_change_throttle' hook, and no new shard is started until it is unthrottled."},
+			command{"CancelSchemaMigration", commandCancelSchemaMigration,
+				"<keyspace|zk keyspace path> <migration id>",
+				"Cancel an online schema migration. The shard currently being migrated finishes, but no other shard is started."},
+			command{"RetrySchemaMigration", commandRetrySchemaMigration,
+				"[-force] <keyspace|zk keyspace path> <migration id>",
+				"Run a failed or canceled online schema migration again, on all the shards that are not complete. A migration stops at the first shard that fails. Use force if the migration looks like it's still running but the process running it died."},
+			command{"CopySchemaShard", commandCopySchemaShard,
+				"[-tables=<table1>,<table2>,...] [-exclude-tables=''] [-include-views] <src tablet alias|zk src tablet path> <dest keyspace/shard|zk dest shard path>",
+				"Copy the schema from a source tablet to the master of the specified shard. The database is created if it doesn't exist, and the schema replicates to the slaves. Use it to initialize the destination shards before a split clone."},
 
 			command{"ValidateVersionShard", commandValidateVersionShard,
 				"<keyspace/shard|zk shard path>",
@@ -372,6 +522,28 @@ func kquery(ts topo.Server, cell, keyspace, user, password, query string) error
 	return nil
 }
 
+// kexplain prints how kquery would route query.
+func kexplain(ts topo.Server, cell, keyspace, query string, bindVariables map[string]interface{}) error {
+	srvKeyspace, err := ts.GetSrvKeyspace(cell, keyspace)
+	if err != nil {
+		return err
+	}
+	tabletKeys := make([]key.KeyspaceId, len(srvKeyspace.Shards))
+	for i, srvShard := range srvKeyspace.Shards {
+		tabletKeys[i] = srvShard.KeyRange.End
+	}
+	explanation, err := sqlparser.ExplainRouting(query, bindVariables, tabletKeys)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Routing: %v\n", explanation.Routing)
+	for _, index := range explanation.Shards {
+		keyRange := srvKeyspace.Shards[index].KeyRange
+		fmt.Printf("Shard %v (%v-%v): %v\n", index, keyRange.Start.Hex(), keyRange.End.Hex(), explanation.Sql)
+	}
+	return nil
+}
+
 // getFileParam returns a string containing either flag is not "",
 // or the content of the file named flagFile
 func getFileParam(flag, flagFile, name string) string {
@@ -489,6 +661,7 @@ func commandInitTablet(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []str
 		force          = subFlags.Bool("force", false, "will overwrite the node if it already exists")
 		parent         = subFlags.Bool("parent", false, "will create the parent shard and keyspace if they don't exist yet")
 		update         = subFlags.Bool("update", false, "perform update if a tablet with provided alias exists")
+		join           = subFlags.Bool("join", false, "also point replication at the shard master, and add the tablet to the serving graph")
 		tags           flagutil.StringMapValue
 	)
 	subFlags.Var(&tags, "tags", "comma separated list of key:value pairs used to tag the tablet")
@@ -540,6 +713,9 @@ func commandInitTablet(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []str
 		tablet.Parent = tabletRepParamToTabletAlias(subFlags.Arg(7))
 	}
 
+	if *join {
+		return "", wr.InitAndJoinTablet(tablet, *force, *parent)
+	}
 	return "", wr.InitTablet(tablet, *force, *parent, *update)
 }
 
@@ -549,6 +725,7 @@ func commandUpdateTabletAddrs(wr *wrangler.Wrangler, subFlags *flag.FlagSet, arg
 	mysqlPort := subFlags.Int("mysql-port", 0, "mysql port")
 	vtPort := subFlags.Int("vt-port", 0, "vt port")
 	vtsPort := subFlags.Int("vts-port", 0, "vts port")
+	namedPorts := subFlags.String("named-ports", "", "additional ports, as name:port,...")
 	subFlags.Parse(args)
 
 	if subFlags.NArg() != 1 {
@@ -557,6 +734,10 @@ func commandUpdateTabletAddrs(wr *wrangler.Wrangler, subFlags *flag.FlagSet, arg
 	if *ipAddr != "" && net.ParseIP(*ipAddr) == nil {
 		log.Fatalf("malformed address: %v", *ipAddr)
 	}
+	ports, err := topo.ParseNamedPorts(*namedPorts)
+	if err != nil {
+		log.Fatalf("invalid -named-ports: %v", err)
+	}
 
 	tabletAlias := tabletParamToTabletAlias(subFlags.Arg(0))
 	return "", wr.TopoServer().UpdateTabletFields(tabletAlias, func(tablet *topo.Tablet) error {
@@ -566,7 +747,7 @@ func commandUpdateTabletAddrs(wr *wrangler.Wrangler, subFlags *flag.FlagSet, arg
 		if *ipAddr != "" {
 			tablet.IPAddr = *ipAddr
 		}
-		if *vtPort != 0 || *vtsPort != 0 || *mysqlPort != 0 {
+		if *vtPort != 0 || *vtsPort != 0 || *mysqlPort != 0 || len(ports) > 0 {
 			if tablet.Portmap == nil {
 				tablet.Portmap = make(map[string]int)
 			}
@@ -579,6 +760,9 @@ func commandUpdateTabletAddrs(wr *wrangler.Wrangler, subFlags *flag.FlagSet, arg
 			if *mysqlPort != 0 {
 				tablet.Portmap["mysql"] = *mysqlPort
 			}
+			for name, port := range ports {
+				tablet.Portmap[name] = port
+			}
 		}
 		return nil
 	})
@@ -596,6 +780,25 @@ func commandScrapTablet(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []st
 	return wr.Scrap(tabletAlias, *force, *skipRebuild)
 }
 
+func commandPurgeScrappedTablets(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	days := subFlags.Int("days", 7, "how many days the records of scrapped tablets are kept")
+	subFlags.Parse(args)
+
+	cells := subFlags.Args()
+	if len(cells) == 0 {
+		var err error
+		cells, err = wr.TopoServer().GetKnownCells()
+		if err != nil {
+			return "", err
+		}
+	}
+	purged, err := wr.PurgeScrappedTablets(cells, "", "", time.Duration(*days)*24*time.Hour)
+	for _, alias := range purged {
+		fmt.Printf("purged %v\n", alias)
+	}
+	return "", err
+}
+
 func commandSetReadOnly(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	subFlags.Parse(args)
 	if subFlags.NArg() != 1 {
@@ -603,7 +806,7 @@ func commandSetReadOnly(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []st
 	}
 
 	tabletAlias := tabletParamToTabletAlias(subFlags.Arg(0))
-	return wr.ActionInitiator().SetReadOnly(tabletAlias)
+	return "", wr.SetReadOnly(tabletAlias, true)
 }
 
 func commandSetReadWrite(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
@@ -613,7 +816,7 @@ func commandSetReadWrite(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []s
 	}
 
 	tabletAlias := tabletParamToTabletAlias(subFlags.Arg(0))
-	return wr.ActionInitiator().SetReadWrite(tabletAlias)
+	return "", wr.SetReadOnly(tabletAlias, false)
 }
 
 func commandChangeSlaveType(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
@@ -658,7 +861,29 @@ func commandRpcPing(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string
 		log.Fatalf("action Ping requires <tablet alias|zk tablet path>")
 	}
 	tabletAlias := tabletParamToTabletAlias(subFlags.Arg(0))
-	return "", wr.ActionInitiator().RpcPing(tabletAlias, *waitTime)
+	ti, err := wr.TopoServer().GetTablet(tabletAlias)
+	if err != nil {
+		return "", err
+	}
+	latency, err := wr.ActionInitiator().RpcPing(ti, *waitTime)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("%v responded in %v\n", tabletAlias, latency)
+	return "", nil
+}
+
+func commandRefreshState(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action RefreshState requires <tablet alias|zk tablet path>")
+	}
+	tabletAlias := tabletParamToTabletAlias(subFlags.Arg(0))
+	ti, err := wr.TopoServer().GetTablet(tabletAlias)
+	if err != nil {
+		return "", err
+	}
+	return "", wr.ActionInitiator().RpcRefreshState(ti, *waitTime)
 }
 
 func commandQuery(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
@@ -673,6 +898,27 @@ func commandQuery(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string)
 	return "", kquery(wr.TopoServer(), subFlags.Arg(0), subFlags.Arg(1), subFlags.Arg(2), subFlags.Arg(3), subFlags.Arg(4))
 }
 
+func commandExplain(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	bindVariablesJson := subFlags.String("bind-variables", "", "the bind variables of the query, in json")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 3 {
+		log.Fatalf("action Explain requires <cell> <keyspace> <query>")
+	}
+	var bindVariables map[string]interface{}
+	if *bindVariablesJson != "" {
+		if err := json.Unmarshal([]byte(*bindVariablesJson), &bindVariables); err != nil {
+			return "", fmt.Errorf("cannot parse bind variables: %v", err)
+		}
+		// json numbers are floats, but entity ids are integers
+		for name, value := range bindVariables {
+			if f, ok := value.(float64); ok && f == float64(int64(f)) {
+				bindVariables[name] = int64(f)
+			}
+		}
+	}
+	return "", kexplain(wr.TopoServer(), subFlags.Arg(0), subFlags.Arg(1), subFlags.Arg(2), bindVariables)
+}
+
 func commandSleep(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	subFlags.Parse(args)
 	if subFlags.NArg() != 2 {
@@ -785,10 +1031,15 @@ func commandMultiSnapshot(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []
 	tablesString := subFlags.String("tables", "", "dump only this comma separated list of tables")
 	skipSlaveRestart := subFlags.Bool("skip-slave-restart", false, "after the snapshot is done, do not restart slave replication")
 	maximumFilesize := subFlags.Uint64("maximum-file-size", 128*1024*1024, "the maximum size for an uncompressed data file")
+	keyType := subFlags.String("key-type", "uint64", "type of the key column: uint64 or bytes")
 	subFlags.Parse(args)
 	if subFlags.NArg() != 2 {
 		log.Fatalf("action MultiSnapshot requires <src tablet alias|zk src tablet path> <key name>")
 	}
+	kit, err := key.ParseKeyspaceIdType(*keyType)
+	if err != nil {
+		log.Fatalf("multisnapshot failed: %v", err)
+	}
 
 	shards, err := key.ParseShardingSpec(*spec)
 	if err != nil {
@@ -800,7 +1051,7 @@ func commandMultiSnapshot(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []
 	}
 
 	source := tabletParamToTabletAlias(subFlags.Arg(0))
-	filenames, parentAlias, err := wr.MultiSnapshot(shards, source, subFlags.Arg(1), *concurrency, tables, *force, *skipSlaveRestart, *maximumFilesize)
+	filenames, parentAlias, err := wr.MultiSnapshot(shards, source, subFlags.Arg(1), kit, *concurrency, tables, *force, *skipSlaveRestart, *maximumFilesize)
 
 	if err == nil {
 		log.Infof("manifest locations: %v", filenames)
@@ -824,6 +1075,94 @@ func commandExecuteHook(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []st
 	return "", err
 }
 
+func commandExecuteFetch(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	maxRows := subFlags.Int("max-rows", 10000, "maximum number of rows to allow in the result")
+	wantFields := subFlags.Bool("want-fields", false, "also get the field names")
+	disableBinlogs := subFlags.Bool("disable-binlogs", false, "disable writing to binlogs during the query")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action ExecuteFetch requires <tablet alias|zk tablet path> <sql command>")
+	}
+
+	tabletAlias := tabletParamToTabletAlias(subFlags.Arg(0))
+	query := subFlags.Arg(1)
+	qr, err := wr.ExecuteFetch(tabletAlias, query, *maxRows, *wantFields, *disableBinlogs)
+	if err != nil {
+		return "", err
+	}
+	if *wantFields {
+		names := make([]string, len(qr.Fields))
+		for i, field := range qr.Fields {
+			names[i] = field.Name
+		}
+		fmt.Println(strings.Join(names, "\t"))
+	}
+	for _, row := range qr.Rows {
+		values := make([]string, len(row))
+		for i, value := range row {
+			values[i] = value.String()
+		}
+		fmt.Println(strings.Join(values, "\t"))
+	}
+	log.Infof("%v rows affected", qr.RowsAffected)
+	return "", nil
+}
+
+func commandGetReparentJournal(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	limit := subFlags.Int("limit", 10, "maximum number of entries to output")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action GetReparentJournal requires <tablet alias|zk tablet path>")
+	}
+	entries, err := wr.GetReparentJournal(tabletParamToTabletAlias(subFlags.Arg(0)), *limit)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(jscfg.ToJson(entries))
+	return "", nil
+}
+
+func commandGetSlaveStatus(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action GetSlaveStatus requires <tablet alias|zk tablet path>")
+	}
+	ti, err := wr.TopoServer().GetTablet(tabletParamToTabletAlias(subFlags.Arg(0)))
+	if err != nil {
+		return "", err
+	}
+	status, err := wr.ActionInitiator().GetSlaveStatus(ti, *waitTime)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(jscfg.ToJson(status))
+	return "", nil
+}
+
+func commandStartSlave(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action StartSlave requires <tablet alias|zk tablet path>")
+	}
+	ti, err := wr.TopoServer().GetTablet(tabletParamToTabletAlias(subFlags.Arg(0)))
+	if err != nil {
+		return "", err
+	}
+	return "", wr.ActionInitiator().StartSlave(ti, *waitTime)
+}
+
+func commandStopSlave(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action StopSlave requires <tablet alias|zk tablet path>")
+	}
+	ti, err := wr.TopoServer().GetTablet(tabletParamToTabletAlias(subFlags.Arg(0)))
+	if err != nil {
+		return "", err
+	}
+	return "", wr.ActionInitiator().StopSlave(ti, *waitTime)
+}
+
 func commandCreateShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	force := subFlags.Bool("force", false, "will keep going even if the keyspace already exists")
 	parent := subFlags.Bool("parent", false, "creates the parent keyspace if it doesn't exist")
@@ -847,6 +1186,18 @@ func commandCreateShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []st
 	return "", err
 }
 
+func commandDeleteShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	recursive := subFlags.Bool("recursive", false, "also delete the tablets of the shard")
+	evenIfServing := subFlags.Bool("even-if-serving", false, "delete the tablets even if they are serving")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action DeleteShard requires <keyspace/shard|zk shard path>")
+	}
+
+	keyspace, shard := shardParamToKeyspaceShard(subFlags.Arg(0))
+	return "", wr.DeleteShard(keyspace, shard, *recursive, *evenIfServing)
+}
+
 func commandRebuildShardGraph(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	cells := subFlags.String("cells", "", "comma separated list of cells to update")
 	subFlags.Parse(args)
@@ -889,6 +1240,26 @@ func commandShardExternallyReparented(wr *wrangler.Wrangler, subFlags *flag.Flag
 	return "", wr.ShardExternallyReparented(keyspace, shard, tabletAlias, *scrapStragglers, *acceptSuccessPercents)
 }
 
+func commandTabletExternallyReparented(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	scrapStragglers := subFlags.Bool("scrap-stragglers", false, "will scrap the hosts that haven't been reparented")
+	acceptSuccessPercents := subFlags.Int("accept-success-percents", 80, "will declare success if more than that many slaves can be reparented")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action TabletExternallyReparented requires <tablet alias|zk tablet path|mysql host:port>")
+	}
+
+	var tabletAlias topo.TabletAlias
+	if strings.Contains(subFlags.Arg(0), ":") {
+		var err error
+		if tabletAlias, err = wr.FindTabletByMysqlAddr(subFlags.Arg(0)); err != nil {
+			return "", err
+		}
+	} else {
+		tabletAlias = tabletParamToTabletAlias(subFlags.Arg(0))
+	}
+	return "", wr.TabletExternallyReparented(tabletAlias, *scrapStragglers, *acceptSuccessPercents)
+}
+
 func commandValidateShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	pingTablets := subFlags.Bool("ping-tablets", true, "ping all tablets during validate")
 	subFlags.Parse(args)
@@ -927,6 +1298,32 @@ func commandShardReplicationPositions(wr *wrangler.Wrangler, subFlags *flag.Flag
 	return "", nil
 }
 
+func commandListDistributedTransactions(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	abandonAge := subFlags.Duration("abandon-age", 0, "only list the transactions older than this")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action ListDistributedTransactions requires <keyspace/shard|zk shard path>")
+	}
+	keyspace, shard := shardParamToKeyspaceShard(subFlags.Arg(0))
+	dtxs, err := wr.ListDistributedTransactions(keyspace, shard, *abandonAge)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(jscfg.ToJson(dtxs))
+	return "", nil
+}
+
+func commandResolveDistributedTransaction(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	abandonAge := subFlags.Duration("abandon-age", time.Minute, "a transaction still in the PREPARE state is only rolled back if it is older than this, as its vtgate may still be committing it")
+	force := subFlags.Bool("force", false, "roll back a transaction in the PREPARE state whatever its age")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action ResolveDistributedTransaction requires <keyspace/shard|zk shard path> <dtid>")
+	}
+	keyspace, shard := shardParamToKeyspaceShard(subFlags.Arg(0))
+	return "", wr.ResolveDistributedTransaction(keyspace, shard, subFlags.Arg(1), *abandonAge, *force)
+}
+
 func commandListShardTablets(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	subFlags.Parse(args)
 	if subFlags.NArg() != 1 {
@@ -936,6 +1333,46 @@ func commandListShardTablets(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args
 	return "", listTabletsByShard(wr.TopoServer(), keyspace, shard)
 }
 
+func commandGetDiffReports(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action GetDiffReports requires <keyspace/shard|zk shard path>")
+	}
+	keyspace, shard := shardParamToKeyspaceShard(subFlags.Arg(0))
+	uids, err := wr.TopoServer().GetDiffReports(keyspace, shard)
+	if err != nil {
+		return "", err
+	}
+	for _, uid := range uids {
+		dr, err := wr.TopoServer().GetDiffReport(keyspace, shard, uid)
+		if err != nil {
+			return "", err
+		}
+		result := "no difference"
+		switch {
+		case dr.Error != "":
+			result = "error: " + dr.Error
+		case dr.HasDifferences():
+			result = "differences"
+		}
+		fmt.Printf("%v %v %v from %v/%v (%v and %v): %v\n", uid, time.Unix(dr.EndTime, 0).Format(time.RFC3339), dr.Worker, dr.SourceKeyspace, dr.SourceShard, dr.SourceTablet, dr.DestinationTablet, result)
+	}
+	return "", nil
+}
+
+func commandGetDiffReport(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action GetDiffReport requires <keyspace/shard|zk shard path> <report id>")
+	}
+	keyspace, shard := shardParamToKeyspaceShard(subFlags.Arg(0))
+	dr, err := wr.TopoServer().GetDiffReport(keyspace, shard, subFlags.Arg(1))
+	if err == nil {
+		fmt.Println(jscfg.ToJson(dr))
+	}
+	return "", err
+}
+
 func commandSetShardServedTypes(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	subFlags.Parse(args)
 	if subFlags.NArg() != 1 && subFlags.NArg() != 2 {
@@ -1024,6 +1461,17 @@ func commandCreateKeyspace(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args [
 	return "", err
 }
 
+func commandDeleteKeyspace(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	recursive := subFlags.Bool("recursive", false, "also delete the shards of the keyspace, and their tablets")
+	evenIfServing := subFlags.Bool("even-if-serving", false, "delete the tablets even if they are serving")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action DeleteKeyspace requires <keyspace name|zk keyspace path>")
+	}
+
+	return "", wr.DeleteKeyspace(keyspaceParamToKeyspace(subFlags.Arg(0)), *recursive, *evenIfServing)
+}
+
 func commandRebuildKeyspaceGraph(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	cells := subFlags.String("cells", "", "comma separated list of cells to update")
 	useServedTypes := subFlags.Bool("use-served-types", false, "supports overlapping shards for resharding (experimental, do not use yet)")
@@ -1077,6 +1525,238 @@ func commandMigrateServedTypes(wr *wrangler.Wrangler, subFlags *flag.FlagSet, ar
 	return "", wr.MigrateServedTypes(keyspace, shard, servedType, *reverse)
 }
 
+func commandGetVSchema(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action GetVSchema requires <keyspace name|zk keyspace path>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	vschema, err := wr.TopoServer().GetVSchema(keyspace)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(jscfg.ToJson(vschema))
+	return "", nil
+}
+
+func commandApplyVSchema(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	vschemaJson := subFlags.String("vschema", "", "the vschema, in json")
+	vschemaFile := subFlags.String("vschema-file", "", "file containing the vschema, in json")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action ApplyVSchema requires <keyspace name|zk keyspace path>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	vschema := &topo.VSchema{}
+	if err := json.Unmarshal([]byte(getFileParam(*vschemaJson, *vschemaFile, "vschema")), vschema); err != nil {
+		return "", fmt.Errorf("cannot parse vschema: %v", err)
+	}
+	return "", wr.ApplyVSchema(keyspace, vschema)
+}
+
+func commandValidateVSchema(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action ValidateVSchema requires <keyspace name|zk keyspace path>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	return "", wr.ValidateVSchema(keyspace)
+}
+
+func commandSetRoutingRule(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	fromType := subFlags.String("from-type", "", "only route the queries for this tablet type")
+	toType := subFlags.String("to-type", "", "send the queries to this tablet type")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action SetRoutingRule requires <from keyspace> <to keyspace>")
+	}
+
+	return "", wr.SetRoutingRule(subFlags.Arg(0), topo.TabletType(*fromType), subFlags.Arg(1), topo.TabletType(*toType))
+}
+
+func commandClearRoutingRule(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	fromType := subFlags.String("from-type", "", "the tablet type of the rule")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action ClearRoutingRule requires <from keyspace>")
+	}
+
+	return "", wr.ClearRoutingRule(subFlags.Arg(0), topo.TabletType(*fromType))
+}
+
+func commandGetRoutingRules(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 0 {
+		log.Fatalf("action GetRoutingRules doesn't take any parameter")
+	}
+
+	rr, err := wr.TopoServer().GetRoutingRules()
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(jscfg.ToJson(rr))
+	return "", nil
+}
+
+func commandReshard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	cell := subFlags.String("cell", "", "only use rdonly tablets in this cell")
+	excludeTables := subFlags.String("exclude-tables", "", "comma separated list of tables to exclude")
+	resolver := subFlags.String("resolver", "numeric", "keyspace id resolver for the copy")
+	keyType := subFlags.String("key-type", "uint64", "type of the key column: uint64 or bytes")
+	cloneFlags := subFlags.String("clone-flags", "", "flags for the SplitClone worker, like -max-chunks-per-second=10")
+	diffFlags := subFlags.String("diff-flags", "", "flags for the SplitDiff worker, like -reader-count=4")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 4 {
+		log.Fatalf("action Reshard requires <keyspace name|zk keyspace path> <source shard>,... <destination shard>,... <key name>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	uid, err := wr.Reshard(keyspace, strings.Split(subFlags.Arg(1), ","), strings.Split(subFlags.Arg(2), ","), map[string]string{
+		"cell":           *cell,
+		"exclude_tables": *excludeTables,
+		"resolver":       *resolver,
+		"key_name":       subFlags.Arg(3),
+		"key_type":       *keyType,
+		"clone_flags":    *cloneFlags,
+		"diff_flags":     *diffFlags,
+	})
+	if uid != "" {
+		log.Infof("Reshard workflow: %v %v", keyspace, uid)
+	}
+	return "", err
+}
+
+func commandGetWorkflows(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action GetWorkflows requires <keyspace name|zk keyspace path>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	uids, err := wr.TopoServer().GetWorkflows(keyspace)
+	if err != nil {
+		return "", err
+	}
+	for _, uid := range uids {
+		wf, err := wr.TopoServer().GetWorkflow(keyspace, uid)
+		if err != nil {
+			return "", err
+		}
+		fmt.Printf("%v %v %v %v\n", uid, wf.Name, wf.State, wf.Params)
+		for _, step := range wf.Steps {
+			fmt.Printf("  %v %v %v\n", step.Name, step.State, step.Error)
+		}
+	}
+	return "", nil
+}
+
+func commandPauseWorkflow(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action PauseWorkflow requires <keyspace name|zk keyspace path> <workflow id>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	return "", wr.PauseWorkflow(keyspace, subFlags.Arg(1))
+}
+
+func commandResumeWorkflow(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action ResumeWorkflow requires <keyspace name|zk keyspace path> <workflow id>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	return "", wr.ResumeWorkflow(keyspace, subFlags.Arg(1))
+}
+
+func commandRollbackWorkflow(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action RollbackWorkflow requires <keyspace name|zk keyspace path> <workflow id>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	return "", wr.RollbackWorkflow(keyspace, subFlags.Arg(1))
+}
+
+func commandAddCell(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action AddCell requires <cell> <topology server address>")
+	}
+
+	return "", wr.AddCell(subFlags.Arg(0), subFlags.Arg(1))
+}
+
+func commandGetCellInfo(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action GetCellInfo requires <cell>")
+	}
+
+	ci, err := wr.TopoServer().GetCellInfo(subFlags.Arg(0))
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(jscfg.ToJson(ci))
+	return "", nil
+}
+
+func commandUpdateCellInfo(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action UpdateCellInfo requires <cell> <topology server address>")
+	}
+
+	return "", wr.TopoServer().UpdateCellInfo(subFlags.Arg(0), &topo.CellInfo{ServerAddress: subFlags.Arg(1)})
+}
+
+func commandRemoveCell(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	force := subFlags.Bool("force", false, "remove the cell even if it still has tablets")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action RemoveCell requires <cell>")
+	}
+
+	return "", wr.RemoveCell(subFlags.Arg(0), *force)
+}
+
+func commandSetCellsAlias(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action SetCellsAlias requires <alias> <cell1>,<cell2>,...")
+	}
+
+	return "", wr.SetCellsAlias(subFlags.Arg(0), strings.Split(subFlags.Arg(1), ","))
+}
+
+func commandGetCellsAliases(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 0 {
+		log.Fatalf("action GetCellsAliases doesn't take any parameter")
+	}
+
+	aliases, err := wr.TopoServer().GetCellsAliases()
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(jscfg.ToJson(aliases))
+	return "", nil
+}
+
+func commandDeleteCellsAlias(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action DeleteCellsAlias requires <alias>")
+	}
+
+	return "", wr.TopoServer().DeleteCellsAlias(subFlags.Arg(0))
+}
+
 func commandWaitForAction(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	subFlags.Parse(args)
 	if subFlags.NArg() != 1 {
@@ -1107,7 +1787,7 @@ func commandResolve(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string
 		return "", err
 	}
 	for _, addr := range addrs {
-		fmt.Printf("%v:%v\n", addr.Target, addr.Port)
+		fmt.Println(topo.SrvAddr(addr))
 	}
 	return "", nil
 }
@@ -1122,6 +1802,28 @@ func commandValidate(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []strin
 	return "", wr.Validate(*pingTablets)
 }
 
+func commandCheckServingGraph(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+
+	cells := subFlags.Args()
+	if len(cells) == 0 {
+		var err error
+		cells, err = wr.TopoServer().GetKnownCells()
+		if err != nil {
+			return "", err
+		}
+	}
+	findings, err := wr.CheckServingGraph(cells)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(jscfg.ToJson(findings))
+	if len(findings) > 0 {
+		return "", fmt.Errorf("%v serving graph inconsistencies found", len(findings))
+	}
+	return "", nil
+}
+
 func commandRebuildReplicationGraph(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	// This is sort of a nuclear option.
 	subFlags.Parse(args)
@@ -1179,6 +1881,38 @@ func commandListTablets(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []st
 	return "", dumpTablets(wr.TopoServer(), aliases)
 }
 
+func commandFreezeTopology(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action FreezeTopology requires <reason>")
+	}
+
+	return "", wr.TopoServer().FreezeTopology(&topo.Freeze{Reason: subFlags.Arg(0), Time: time.Now().Unix()})
+}
+
+func commandUnfreezeTopology(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 0 {
+		log.Fatalf("action UnfreezeTopology doesn't take any parameter")
+	}
+
+	return "", wr.TopoServer().UnfreezeTopology()
+}
+
+func commandGetTopologyFreeze(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 0 {
+		log.Fatalf("action GetTopologyFreeze doesn't take any parameter")
+	}
+
+	freeze, err := wr.TopoServer().GetTopologyFreeze()
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(jscfg.ToJson(freeze))
+	return "", nil
+}
+
 func commandGetSchema(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	tables := subFlags.String("tables", "", "comma separated tables to gather schema information for")
 	includeViews := subFlags.Bool("include-views", false, "include views in the output")
@@ -1199,7 +1933,22 @@ func commandGetSchema(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []stri
 	return "", err
 }
 
+func commandGetTableStats(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	buckets := subFlags.Int("buckets", 16, "number of buckets for the primary key distribution")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action GetTableStats requires <tablet alias|zk tablet path> <table>")
+	}
+	tabletAlias := tabletParamToTabletAlias(subFlags.Arg(0))
+	ts, err := wr.GetTableStats(tabletAlias, subFlags.Arg(1), *buckets)
+	if err == nil {
+		fmt.Println(jscfg.ToJson(ts))
+	}
+	return "", err
+}
+
 func commandValidateSchemaShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	excludeTables := subFlags.String("exclude-tables", "", "comma separated list of tables to exclude")
 	includeViews := subFlags.Bool("include-views", false, "include views in the validation")
 	subFlags.Parse(args)
 	if subFlags.NArg() != 1 {
@@ -1207,10 +1956,15 @@ func commandValidateSchemaShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, a
 	}
 
 	keyspace, shard := shardParamToKeyspaceShard(subFlags.Arg(0))
-	return "", wr.ValidateSchemaShard(keyspace, shard, *includeViews)
+	var excludeTableArray []string
+	if *excludeTables != "" {
+		excludeTableArray = strings.Split(*excludeTables, ",")
+	}
+	return "", wr.ValidateSchemaShard(keyspace, shard, excludeTableArray, *includeViews)
 }
 
 func commandValidateSchemaKeyspace(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	excludeTables := subFlags.String("exclude-tables", "", "comma separated list of tables to exclude")
 	includeViews := subFlags.Bool("include-views", false, "include views in the validation")
 	subFlags.Parse(args)
 	if subFlags.NArg() != 1 {
@@ -1218,7 +1972,11 @@ func commandValidateSchemaKeyspace(wr *wrangler.Wrangler, subFlags *flag.FlagSet
 	}
 
 	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
-	return "", wr.ValidateSchemaKeyspace(keyspace, *includeViews)
+	var excludeTableArray []string
+	if *excludeTables != "" {
+		excludeTableArray = strings.Split(*excludeTables, ",")
+	}
+	return "", wr.ValidateSchemaKeyspace(keyspace, excludeTableArray, *includeViews)
 }
 
 func commandPreflightSchema(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
@@ -1234,6 +1992,9 @@ func commandPreflightSchema(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args
 	scr, err := wr.PreflightSchema(tabletAlias, change)
 	if err == nil {
 		log.Infof(scr.String())
+		for _, tc := range scr.TableChanges {
+			log.Infof("%v", tc)
+		}
 	}
 	return "", err
 }
@@ -1281,6 +2042,7 @@ func commandApplySchemaShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args
 	sqlFile := subFlags.String("sql-file", "", "file containing the sql commands")
 	simple := subFlags.Bool("simple", false, "just apply change on master and let replication do the rest")
 	newParent := subFlags.String("new-parent", "", "will reparent to this tablet after the change")
+	vtgates := subFlags.String("vtgates", "", "comma-separated list of vtgate addresses whose schema caches are invalidated after the change")
 	subFlags.Parse(args)
 
 	if subFlags.NArg() != 1 {
@@ -1300,6 +2062,7 @@ func commandApplySchemaShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args
 	scr, err := wr.ApplySchemaShard(keyspace, shard, change, newParentAlias, *simple, *force)
 	if err == nil {
 		log.Infof(scr.String())
+		invalidateSchemaCachesAfterChange(*vtgates, keyspace)
 	}
 	return "", err
 }
@@ -1309,6 +2072,8 @@ func commandApplySchemaKeyspace(wr *wrangler.Wrangler, subFlags *flag.FlagSet, a
 	sql := subFlags.String("sql", "", "sql command")
 	sqlFile := subFlags.String("sql-file", "", "file containing the sql commands")
 	simple := subFlags.Bool("simple", false, "just apply change on master and let replication do the rest")
+	online := subFlags.Bool("online", false, "apply the change with the online schema change hook on each master")
+	vtgates := subFlags.String("vtgates", "", "comma-separated list of vtgate addresses whose schema caches are invalidated after the change")
 	subFlags.Parse(args)
 	if subFlags.NArg() != 1 {
 		log.Fatalf("action ApplySchemaKeyspace requires <keyspace|zk keyspace path>")
@@ -1316,13 +2081,104 @@ func commandApplySchemaKeyspace(wr *wrangler.Wrangler, subFlags *flag.FlagSet, a
 
 	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
 	change := getFileParam(*sql, *sqlFile, "sql")
+	if *online {
+		uid, err := wr.ApplySchemaKeyspaceOnline(keyspace, change)
+		if uid != "" {
+			log.Infof("Schema migration %v/%v", keyspace, uid)
+		}
+		return "", err
+	}
 	scr, err := wr.ApplySchemaKeyspace(keyspace, change, *simple, *force)
 	if err == nil {
 		log.Infof(scr.String())
+		invalidateSchemaCachesAfterChange(*vtgates, keyspace)
 	}
 	return "", err
 }
 
+func commandGetSchemaMigrations(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("action GetSchemaMigrations requires <keyspace|zk keyspace path>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	uids, err := wr.TopoServer().GetSchemaMigrations(keyspace)
+	if err != nil {
+		return "", err
+	}
+	for _, uid := range uids {
+		sm, err := wr.TopoServer().GetSchemaMigration(keyspace, uid)
+		if err != nil {
+			return "", err
+		}
+		fmt.Printf("%v %v %v\n", uid, sm.State, sm.Sql)
+		shards := make([]string, 0, len(sm.Shards))
+		for shard := range sm.Shards {
+			shards = append(shards, shard)
+		}
+		sort.Strings(shards)
+		for _, shard := range shards {
+			s := sm.Shards[shard]
+			fmt.Printf("  %v %v attempts=%v %v\n", shard, s.State, s.Attempts, s.Error)
+		}
+	}
+	return "", nil
+}
+
+func commandThrottleSchemaMigration(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	unthrottle := subFlags.Bool("unthrottle", false, "unthrottle the migration instead")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action ThrottleSchemaMigration requires <keyspace|zk keyspace path> <migration id>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	return "", wr.ThrottleSchemaMigration(keyspace, subFlags.Arg(1), !*unthrottle)
+}
+
+func commandCancelSchemaMigration(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action CancelSchemaMigration requires <keyspace|zk keyspace path> <migration id>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	return "", wr.CancelSchemaMigration(keyspace, subFlags.Arg(1))
+}
+
+func commandRetrySchemaMigration(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	force := subFlags.Bool("force", false, "retry the migration even if it looks like it's still running")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action RetrySchemaMigration requires <keyspace|zk keyspace path> <migration id>")
+	}
+
+	keyspace := keyspaceParamToKeyspace(subFlags.Arg(0))
+	return "", wr.RetrySchemaMigration(keyspace, subFlags.Arg(1), *force)
+}
+
+func commandCopySchemaShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	tables := subFlags.String("tables", "", "comma separated list of tables to copy")
+	excludeTables := subFlags.String("exclude-tables", "", "comma separated list of tables to exclude")
+	includeViews := subFlags.Bool("include-views", true, "include views in the copy")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action CopySchemaShard requires <src tablet alias|zk src tablet path> <dest keyspace/shard|zk dest shard path>")
+	}
+	tabletAlias := tabletParamToTabletAlias(subFlags.Arg(0))
+	keyspace, shard := shardParamToKeyspaceShard(subFlags.Arg(1))
+	var tableArray []string
+	if *tables != "" {
+		tableArray = strings.Split(*tables, ",")
+	}
+	var excludeTableArray []string
+	if *excludeTables != "" {
+		excludeTableArray = strings.Split(*excludeTables, ",")
+	}
+	return "", wr.CopySchemaShard(tabletAlias, tableArray, excludeTableArray, *includeViews, keyspace, shard)
+}
+
 func commandValidateVersionShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	subFlags.Parse(args)
 	if subFlags.NArg() != 1 {
@@ -0,0 +1,66 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/rpc"
+	vtgateproto "github.com/youtube/vitess/go/vt/vtgate/proto"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+func init() {
+	addCommand("Schema, Version, Permissions", command{
+		"InvalidateSchemaCache",
+		commandInvalidateSchemaCache,
+		"<vtgate addr>,... <keyspace name|zk keyspace path>",
+		"Drop the cached results of the schema queries of a keyspace from the given vtgates, see the -schema-cache-ttl vtgate flag."})
+}
+
+// invalidateSchemaCaches drops the cached schema query results of
+// keyspace from a comma-separated list of vtgate addresses.
+func invalidateSchemaCaches(vtgates, keyspace string) error {
+	rec := concurrency.AllErrorRecorder{}
+	for _, addr := range strings.Split(vtgates, ",") {
+		client, err := bsonrpc.DialHTTP("tcp", addr, 10*time.Second, nil)
+		if err != nil {
+			rec.RecordError(fmt.Errorf("%v: %v", addr, err))
+			continue
+		}
+		var noOutput rpc.UnusedResponse
+		if err := client.Call("VTGate.InvalidateSchemaCache", &vtgateproto.SchemaCacheInvalidation{Keyspace: keyspace}, &noOutput); err != nil {
+			rec.RecordError(fmt.Errorf("%v: %v", addr, err))
+		}
+		client.Close()
+	}
+	return rec.Error()
+}
+
+// invalidateSchemaCachesAfterChange is called after a schema change:
+// the change is done, so the errors are only logged, and the results
+// expire anyway.
+func invalidateSchemaCachesAfterChange(vtgates, keyspace string) {
+	if vtgates == "" {
+		return
+	}
+	if err := invalidateSchemaCaches(vtgates, keyspace); err != nil {
+		log.Warningf("cannot invalidate the vtgate schema caches: %v", err)
+	}
+}
+
+func commandInvalidateSchemaCache(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 2 {
+		log.Fatalf("action InvalidateSchemaCache requires <vtgate addr>,... <keyspace name|zk keyspace path>")
+	}
+	return "", invalidateSchemaCaches(subFlags.Arg(0), keyspaceParamToKeyspace(subFlags.Arg(1)))
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
 
+	"github.com/youtube/vitess/go/vt/acl"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/wrangler"
 )
@@ -19,6 +21,7 @@ type ActionResult struct {
 func (ar *ActionResult) error(text string) {
 	ar.Error = true
 	ar.Output = text
+	recentErrors.Record(fmt.Errorf("%v %v: %v", ar.Name, ar.Parameters, text))
 }
 
 // action{Keyspace,Shard,Tablet}Method is a function that performs
@@ -69,6 +72,14 @@ func (ar *ActionRepository) ApplyKeyspaceAction(actionName, keyspace string, r *
 		result.error("Unknown keyspace action")
 		return result
 	}
+	if err := acl.CheckHTTP(r, acl.DBA); err != nil {
+		result.error(err.Error())
+		return result
+	}
+	if err := checkLeader(ar.wr.TopoServer()); err != nil {
+		result.error(err.Error())
+		return result
+	}
 	ar.wr.ResetActionTimeout(wrangler.DefaultActionTimeout)
 	output, err := action(ar.wr, keyspace, r)
 	if err != nil {
@@ -87,6 +98,14 @@ func (ar *ActionRepository) ApplyShardAction(actionName, keyspace, shard string,
 		result.error("Unknown shard action")
 		return result
 	}
+	if err := acl.CheckHTTP(r, acl.DBA); err != nil {
+		result.error(err.Error())
+		return result
+	}
+	if err := checkLeader(ar.wr.TopoServer()); err != nil {
+		result.error(err.Error())
+		return result
+	}
 	ar.wr.ResetActionTimeout(wrangler.DefaultActionTimeout)
 	output, err := action(ar.wr, keyspace, shard, r)
 	if err != nil {
@@ -105,6 +124,14 @@ func (ar *ActionRepository) ApplyTabletAction(actionName string, tabletAlias top
 		result.error("Unknown tablet action")
 		return result
 	}
+	if err := acl.CheckHTTP(r, acl.DBA); err != nil {
+		result.error(err.Error())
+		return result
+	}
+	if err := checkLeader(ar.wr.TopoServer()); err != nil {
+		result.error(err.Error())
+		return result
+	}
 	ar.wr.ResetActionTimeout(wrangler.DefaultActionTimeout)
 	output, err := action(ar.wr, tabletAlias, r)
 	if err != nil {
@@ -0,0 +1,104 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// With -leader-election, several vtctld can run at the same time.
+// They all serve the topology browsers, but only the elected leader
+// runs actions. The others are hot standbys, that take over when the
+// leader goes away.
+
+var (
+	leaderElection      = flag.Bool("leader-election", false, "elect a leader among the vtctld instances, only the leader runs actions")
+	leaderElectionRetry = flag.Duration("leader-election-retry", 30*time.Second, "how long to wait before trying again after a failed leader election")
+)
+
+// electLeader is set by the topo.Server plugin. It blocks until this
+// process is the vtctld leader, and returns a channel closed when the
+// leadership is lost, and a function to give it up.
+var electLeader func(ts topo.Server, interrupted chan struct{}) (lost <-chan struct{}, release func(), err error)
+
+// getLeader is set by the topo.Server plugin. It returns the address
+// of the current vtctld leader.
+var getLeader func(ts topo.Server) (string, error)
+
+// isLeader is 1 while this process can run actions.
+var isLeader sync2.AtomicInt32
+
+func init() {
+	isLeader.Set(1)
+}
+
+// startLeaderElection starts the leader election if
+// -leader-election is set. Until elected, this process is a standby.
+func startLeaderElection(ts topo.Server) {
+	if !*leaderElection {
+		return
+	}
+	if electLeader == nil {
+		log.Fatalf("-leader-election is not supported by this topo.Server")
+	}
+	isLeader.Set(0)
+	interrupted := make(chan struct{})
+	servenv.OnClose(func() { close(interrupted) })
+	go runLeaderElection(ts, interrupted)
+}
+
+// runLeaderElection keeps running for the leadership, until
+// interrupted is closed.
+func runLeaderElection(ts topo.Server, interrupted chan struct{}) {
+	for {
+		lost, release, err := electLeader(ts, interrupted)
+		if err == topo.ErrInterrupted {
+			return
+		}
+		if err != nil {
+			log.Errorf("leader election failed, will try again: %v", err)
+			select {
+			case <-interrupted:
+				return
+			case <-time.After(*leaderElectionRetry):
+			}
+			continue
+		}
+
+		log.Infof("elected vtctld leader")
+		isLeader.Set(1)
+		select {
+		case <-lost:
+			log.Warningf("lost vtctld leadership")
+			isLeader.Set(0)
+		case <-interrupted:
+			isLeader.Set(0)
+			release()
+			return
+		}
+		release()
+	}
+}
+
+// checkLeader returns an error if this process is a standby.
+func checkLeader(ts topo.Server) error {
+	if isLeader.Get() == 1 {
+		return nil
+	}
+	leader := "unknown"
+	if getLeader != nil {
+		if addr, err := getLeader(ts); err == nil {
+			leader = addr
+		}
+	}
+	return fmt.Errorf("this vtctld is a standby, actions run on the leader: %v", leader)
+}
@@ -4,10 +4,13 @@
 
 package main
 
-// Imports and register the Zookeeper TopologyServer
+// Imports and register the Zookeeper TopologyServer, and its leader
+// election.
 
 import (
+	"fmt"
 	"html/template"
+	"os"
 	"path"
 	"sort"
 	"strings"
@@ -16,9 +19,16 @@ import (
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/zktopo"
 	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
 )
 
+// vtctldElection is the name of the zktopo election of vtctld.
+const vtctldElection = "vtctld"
+
 func init() {
+	electLeader = zkElectLeader
+	getLeader = zkGetLeader
+
 	// handles /zk paths
 	ts := topo.GetServerByName("zookeeper")
 	if ts == nil {
@@ -29,6 +39,37 @@ func init() {
 	HandleExplorer("zk", "/zk/", "zk.html", NewZkExplorer(ts.(*zktopo.Server).GetZConn()))
 }
 
+func zkElectLeader(ts topo.Server, interrupted chan struct{}) (<-chan struct{}, func(), error) {
+	zkts, ok := ts.(*zktopo.Server)
+	if !ok {
+		return nil, nil, fmt.Errorf("leader election requires a zktopo.Server")
+	}
+	hostname, _ := os.Hostname()
+	leaderPath, err := zkts.ElectGlobalLeader(vtctldElection, fmt.Sprintf("%v:%v", hostname, *port), interrupted)
+	if err != nil {
+		return nil, nil, err
+	}
+	lost, err := zkts.WatchLeader(leaderPath)
+	if err != nil {
+		zkts.ReleaseLeader(leaderPath)
+		return nil, nil, err
+	}
+	release := func() {
+		if err := zkts.ReleaseLeader(leaderPath); err != nil && !zookeeper.IsError(err, zookeeper.ZNONODE) {
+			log.Warningf("cannot release leadership %v: %v", leaderPath, err)
+		}
+	}
+	return lost, release, nil
+}
+
+func zkGetLeader(ts topo.Server) (string, error) {
+	zkts, ok := ts.(*zktopo.Server)
+	if !ok {
+		return "", fmt.Errorf("leader election requires a zktopo.Server")
+	}
+	return zkts.GetGlobalLeader(vtctldElection)
+}
+
 type ZkExplorer struct {
 	zconn zk.Conn
 }
@@ -0,0 +1,52 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// recentErrors keeps the last failed actions.
+var recentErrors = servenv.NewErrorLog(20)
+
+const topologyStatusHTML = `<table>
+  <tr><td>Cells</td><td>{{range .Cells}}{{.}} {{end}}{{if .CellsError}}<b>{{.CellsError}}</b>{{end}}</td></tr>
+  <tr><td>Leadership</td><td>{{.Leadership}}</td></tr>
+  <tr><td>Keyspaces</td><td>{{range .Keyspaces}}{{.}} {{end}}{{if .KeyspacesError}}<b>{{.KeyspacesError}}</b>{{end}}</td></tr>
+</table>`
+
+// addStatusParts adds the vtctld sections to the status page.
+func addStatusParts(ts topo.Server) {
+	servenv.AddStatusPart("Topology", topologyStatusHTML, func() interface{} {
+		data := make(map[string]interface{})
+		switch {
+		case !*leaderElection:
+			data["Leadership"] = "no leader election"
+		case isLeader.Get() == 1:
+			data["Leadership"] = "leader"
+		default:
+			data["Leadership"] = checkLeader(ts).Error()
+		}
+		if cells, err := ts.GetKnownCells(); err != nil {
+			data["CellsError"] = err.Error()
+		} else {
+			sort.Strings(cells)
+			data["Cells"] = cells
+		}
+		if keyspaces, err := ts.GetKeyspaces(); err != nil {
+			data["KeyspacesError"] = err.Error()
+		} else {
+			sort.Strings(keyspaces)
+			data["Keyspaces"] = keyspaces
+		}
+		return data
+	})
+	servenv.AddErrorLogStatusPart("Recent Errors", recentErrors)
+	servenv.AddStatusLink("Topology browser", "/dbtopo")
+	servenv.AddStatusLink("Actions", "/")
+}
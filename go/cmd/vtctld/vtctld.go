@@ -350,6 +350,8 @@ func main() {
 	wr := wrangler.New(ts, 30*time.Second, 30*time.Second)
 
 	actionRepo = NewActionRepository(wr)
+	addStatusParts(ts)
+	startLeaderElection(ts)
 
 	// keyspace actions
 	actionRepo.RegisterKeyspaceAction("ValidateKeyspace",
@@ -359,7 +361,7 @@ func main() {
 
 	actionRepo.RegisterKeyspaceAction("ValidateSchemaKeyspace",
 		func(wr *wrangler.Wrangler, keyspace string, r *http.Request) (string, error) {
-			return "", wr.ValidateSchemaKeyspace(keyspace, false)
+			return "", wr.ValidateSchemaKeyspace(keyspace, nil, false)
 		})
 
 	actionRepo.RegisterKeyspaceAction("ValidateVersionKeyspace",
@@ -380,7 +382,7 @@ func main() {
 
 	actionRepo.RegisterShardAction("ValidateSchemaShard",
 		func(wr *wrangler.Wrangler, keyspace, shard string, r *http.Request) (string, error) {
-			return "", wr.ValidateSchemaShard(keyspace, shard, false)
+			return "", wr.ValidateSchemaShard(keyspace, shard, nil, false)
 		})
 
 	actionRepo.RegisterShardAction("ValidateVersionShard",
@@ -396,7 +398,24 @@ func main() {
 	// tablet actions
 	actionRepo.RegisterTabletAction("RpcPing",
 		func(wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
-			return "", wr.ActionInitiator().RpcPing(tabletAlias, 10*time.Second)
+			ti, err := wr.TopoServer().GetTablet(tabletAlias)
+			if err != nil {
+				return "", err
+			}
+			latency, err := wr.ActionInitiator().RpcPing(ti, 10*time.Second)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%v responded in %v", tabletAlias, latency), nil
+		})
+
+	actionRepo.RegisterTabletAction("RefreshState",
+		func(wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
+			ti, err := wr.TopoServer().GetTablet(tabletAlias)
+			if err != nil {
+				return "", err
+			}
+			return "", wr.ActionInitiator().RpcRefreshState(ti, 10*time.Second)
 		})
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
 )
 
 type simpleStruct struct {
@@ -23,3 +26,18 @@ func TestHtmlize(t *testing.T) {
 		t.Errorf("Wrong html: got %q, expected %q", html, expected)
 	}
 }
+
+func TestCheckLeader(t *testing.T) {
+	defer isLeader.Set(1)
+	if err := checkLeader(nil); err != nil {
+		t.Errorf("without leader election, actions should run: %v", err)
+	}
+
+	savedGetLeader := getLeader
+	defer func() { getLeader = savedGetLeader }()
+	getLeader = func(ts topo.Server) (string, error) { return "leader:8080", nil }
+	isLeader.Set(0)
+	if err := checkLeader(nil); err == nil || !strings.Contains(err.Error(), "leader:8080") {
+		t.Errorf("a standby should name the leader, got %v", err)
+	}
+}
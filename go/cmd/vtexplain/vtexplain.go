@@ -0,0 +1,85 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// vtexplain prints how vtgate would route and rewrite the statements
+// of a sql file, and what each shard would execute, from the VSchema
+// and the shards of a keyspace. It does not connect to any database,
+// and exits with a non-zero status if a statement cannot be explained.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtexplain"
+)
+
+var (
+	keyspace      = flag.String("keyspace", "", "keyspace of the statements")
+	vschemaFile   = flag.String("vschema-file", "", "file containing the vschema of the keyspace, in json, as for vtctl ApplyVSchema")
+	shards        = flag.String("shards", "-", "shards of the keyspace, as a sharding spec: -80- for two shards")
+	sqlFile       = flag.String("sql-file", "", "file containing the statements to explain, separated by semicolons")
+	bindVariables = flag.String("bind-variables", "", "bind variables of the statements, in json")
+	normalize     = flag.Bool("normalize-queries", false, "simulate vtgate -normalize-queries")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 0 || *keyspace == "" || *sqlFile == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var vschema *topo.VSchema
+	if *vschemaFile != "" {
+		data, err := ioutil.ReadFile(*vschemaFile)
+		if err != nil {
+			log.Fatalf("cannot read vschema: %v", err)
+		}
+		vschema = &topo.VSchema{}
+		if err := json.Unmarshal(data, vschema); err != nil {
+			log.Fatalf("cannot parse vschema: %v", err)
+		}
+	}
+	var bv map[string]interface{}
+	if *bindVariables != "" {
+		if err := json.Unmarshal([]byte(*bindVariables), &bv); err != nil {
+			log.Fatalf("cannot parse bind variables: %v", err)
+		}
+		// json numbers are float64, the routing needs integers
+		for name, value := range bv {
+			if f, ok := value.(float64); ok && f == float64(int64(f)) {
+				bv[name] = int64(f)
+			}
+		}
+	}
+	data, err := ioutil.ReadFile(*sqlFile)
+	if err != nil {
+		log.Fatalf("cannot read statements: %v", err)
+	}
+
+	ex, err := vtexplain.NewExplainer(*keyspace, vschema, *shards, *normalize)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	failed := false
+	for _, sql := range vtexplain.SplitStatements(string(data)) {
+		plan, err := ex.Explain(sql, bv)
+		if err != nil {
+			fmt.Printf("%v\n  error: %v\n\n", sql, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%v\n", plan)
+	}
+	log.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
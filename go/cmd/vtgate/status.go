@@ -0,0 +1,30 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/vtgate"
+)
+
+const configStatusHTML = `<table>
+  <tr><td>Cell</td><td>{{.Cell}}</td></tr>
+  <tr><td>Retry delay</td><td>{{.RetryDelay}}</td></tr>
+  <tr><td>Retry count</td><td>{{.RetryCount}}</td></tr>
+</table>`
+
+// addStatusParts adds the vtgate sections to the status page.
+func addStatusParts() {
+	servenv.AddStatusPart("Configuration", configStatusHTML, func() interface{} {
+		return map[string]interface{}{
+			"Cell":       *cell,
+			"RetryDelay": *retryDelay,
+			"RetryCount": *retryCount,
+		}
+	})
+	servenv.AddErrorLogStatusPart("Recent Errors", vtgate.RecentErrors)
+	servenv.AddStatusLink("Query log", *queryLogHandler)
+	servenv.AddStatusLink("Query errors log", *queryLogHandler+"?errors=true")
+}
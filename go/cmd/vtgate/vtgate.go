@@ -21,6 +21,10 @@ var (
 	cell       = flag.String("cell", "test_nj", "cell to use")
 	retryDelay = flag.Duration("retry-delay", 200*time.Millisecond, "retry delay")
 	retryCount = flag.Int("retry-count", 10, "retry count")
+
+	globalFallback = flag.Bool("srv_topo_global_fallback", false, "if the topology server of the cell is down, read the copy of its serving graph saved in the global topology by the keyspace rebuilds (it may be stale)")
+
+	queryLogHandler = flag.String("query-log-stream-handler", "/debug/querylog", "URL handler for streaming queries log")
 )
 
 var topoReader *TopoReader
@@ -35,13 +39,19 @@ func main() {
 	ts := topo.GetServer()
 	defer topo.CloseServers()
 
-	rts := vtgate.NewResilientSrvTopoServer(ts)
+	var sts vtgate.SrvTopoServer = ts
+	if *globalFallback {
+		sts = vtgate.NewGlobalFallbackSrvTopoServer(ts)
+	}
+	rts := vtgate.NewResilientSrvTopoServer(sts)
 
 	topoReader = NewTopoReader(rts)
 	topo.RegisterTopoReader(topoReader)
 
 	blm := vtgate.NewBalancerMap(rts, *cell)
 	vtgate.Init(blm, *retryDelay, *retryCount)
+	vtgate.QueryLogger.ServeLogs(*queryLogHandler)
+	addStatusParts()
 	log.Infof("vtgate listening to port %v", *port)
 	servenv.Run(*port)
 }
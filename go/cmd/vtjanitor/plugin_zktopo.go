@@ -0,0 +1,166 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// Imports and register the Zookeeper topo.Server, and adds the
+// Zookeeper specific leader election and janitor modules.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/janitor"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"launchpad.net/gozk/zookeeper"
+)
+
+var (
+	actionLogKeepCount = flag.Int("actionlog-keep-count", 10, "how many actionlog entries to keep for the shard and each of its tablets")
+	orphanLockAge      = flag.Duration("orphan-lock-age", 24*time.Hour, "how old a lock node has to be for the orphans module to delete it")
+	tabletMirrorCell   = flag.String("tablet-mirror-cell", "global", "where the tablet_mirror module mirrors the tablet records: global, or another cell")
+)
+
+func init() {
+	electShardLeader = zkElectShardLeader
+	janitor.RegisterModule("actionlog", newActionLogModule)
+	janitor.RegisterModule("orphans", newOrphansModule)
+	janitor.RegisterModule("tablet_mirror", newTabletMirrorModule)
+}
+
+func zkElectShardLeader(ts topo.Server, keyspace, shard string, interrupted chan struct{}) (<-chan struct{}, func(), error) {
+	zkts, ok := ts.(*zktopo.Server)
+	if !ok {
+		return nil, nil, fmt.Errorf("leader election requires a zktopo.Server")
+	}
+	hostname, _ := os.Hostname()
+	leaderPath, err := zkts.ElectShardLeader(keyspace, shard, "janitor", fmt.Sprintf("%v:%v", hostname, *port), interrupted)
+	if err != nil {
+		return nil, nil, err
+	}
+	lost, err := zkts.WatchLeader(leaderPath)
+	if err != nil {
+		zkts.ReleaseLeader(leaderPath)
+		return nil, nil, err
+	}
+	release := func() {
+		if err := zkts.ReleaseLeader(leaderPath); err != nil && !zookeeper.IsError(err, zookeeper.ZNONODE) {
+			log.Warningf("cannot release leadership %v: %v", leaderPath, err)
+		}
+	}
+	return lost, release, nil
+}
+
+// actionLogModule prunes the old actionlog entries of the shard and
+// of its tablets.
+type actionLogModule struct {
+	zkts *zktopo.Server
+}
+
+func newActionLogModule(wr *wrangler.Wrangler) (janitor.Module, error) {
+	zkts, ok := wr.TopoServer().(*zktopo.Server)
+	if !ok {
+		return nil, fmt.Errorf("actionlog module requires a zktopo.Server")
+	}
+	return &actionLogModule{zkts: zkts}, nil
+}
+
+func (alm *actionLogModule) Run(keyspace, shard string) ([]string, error) {
+	paths := []string{alm.zkts.ShardActionLogPath(keyspace, shard)}
+	aliases, err := topo.FindAllTabletAliasesInShard(alm.zkts, keyspace, shard)
+	if err != nil && err != topo.ErrPartialResult {
+		return nil, err
+	}
+	for _, alias := range aliases {
+		paths = append(paths, zktopo.TabletActionPathForAlias(alias)+"log")
+	}
+
+	var fixes []string
+	for _, p := range paths {
+		prunedCount, err := alm.zkts.PruneActionLogs(p, *actionLogKeepCount)
+		if prunedCount > 0 {
+			fixes = append(fixes, fmt.Sprintf("pruned %v old entries from %v", prunedCount, p))
+		}
+		if err != nil && !zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return fixes, err
+		}
+	}
+	return fixes, nil
+}
+
+// orphansModule deletes the orphaned nodes of the keyspace of the
+// shard (see zktopo.FindOrphans), in all cells.
+type orphansModule struct {
+	zkts *zktopo.Server
+}
+
+func newOrphansModule(wr *wrangler.Wrangler) (janitor.Module, error) {
+	zkts, ok := wr.TopoServer().(*zktopo.Server)
+	if !ok {
+		return nil, fmt.Errorf("orphans module requires a zktopo.Server")
+	}
+	return &orphansModule{zkts: zkts}, nil
+}
+
+func (om *orphansModule) Run(keyspace, shard string) ([]string, error) {
+	cells, err := om.zkts.GetKnownCells()
+	if err != nil {
+		return nil, err
+	}
+	orphans, err := om.zkts.FindOrphans(cells, keyspace, *orphanLockAge)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixes []string
+	for _, orphan := range orphans {
+		if err := om.zkts.DeleteOrphan(orphan); err != nil {
+			return fixes, err
+		}
+		fixes = append(fixes, fmt.Sprintf("deleted orphan %v", orphan))
+	}
+	return fixes, nil
+}
+
+// tabletMirrorModule mirrors the tablet records of the cells of the
+// shard (see zktopo.MirrorTablets). The cells other than
+// -tablet-mirror-cell are mirrored.
+type tabletMirrorModule struct {
+	zkts *zktopo.Server
+}
+
+func newTabletMirrorModule(wr *wrangler.Wrangler) (janitor.Module, error) {
+	zkts, ok := wr.TopoServer().(*zktopo.Server)
+	if !ok {
+		return nil, fmt.Errorf("tablet_mirror module requires a zktopo.Server")
+	}
+	return &tabletMirrorModule{zkts: zkts}, nil
+}
+
+func (tmm *tabletMirrorModule) Run(keyspace, shard string) ([]string, error) {
+	si, err := tmm.zkts.GetShard(keyspace, shard)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixes []string
+	for _, cell := range si.Cells {
+		if cell == *tabletMirrorCell {
+			continue
+		}
+		changes, err := tmm.zkts.MirrorTablets(cell, *tabletMirrorCell)
+		if changes > 0 {
+			fixes = append(fixes, fmt.Sprintf("mirrored %v tablet records of cell %v", changes, cell))
+		}
+		if err != nil {
+			return fixes, err
+		}
+	}
+	return fixes, nil
+}
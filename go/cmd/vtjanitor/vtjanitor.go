@@ -0,0 +1,123 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+vtjanitor runs the janitor modules on a shard, to fix the drift in
+its topology. Many vtjanitor processes can be started for the same
+shard: they elect a leader in the topology, and only the leader runs
+the modules. The fixes it made are exported in /debug/vars.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/janitor"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+var (
+	port      = flag.Int("port", 8080, "port for the status page")
+	keyspace  = flag.String("keyspace", "", "keyspace to watch")
+	shard     = flag.String("shard", "", "shard to watch")
+	modules   = flag.String("modules", "", "comma separated list of janitor modules to run, all of them if empty")
+	sleepTime = flag.Duration("sleep-time", time.Minute, "how long to sleep between janitor runs")
+)
+
+// electShardLeader is set by the topo.Server plugin. It blocks until
+// this process is the janitor leader for the shard, and returns a
+// channel closed when the leadership is lost, and a function to give
+// it up.
+var electShardLeader func(ts topo.Server, keyspace, shard string, interrupted chan struct{}) (lost <-chan struct{}, release func(), err error)
+
+// runAsLeader runs the janitor whenever this process is the leader,
+// until interrupted is closed.
+func runAsLeader(ts topo.Server, j *janitor.Janitor, interrupted chan struct{}) {
+	if electShardLeader == nil {
+		log.Warningf("no leader election for this topo.Server, running the janitor unconditionally")
+		j.Run(*sleepTime, interrupted)
+		return
+	}
+	for {
+		lost, release, err := electShardLeader(ts, *keyspace, *shard, interrupted)
+		if err == topo.ErrInterrupted {
+			return
+		}
+		if err != nil {
+			log.Errorf("leader election failed, will try again: %v", err)
+			select {
+			case <-interrupted:
+				return
+			case <-time.After(*sleepTime):
+			}
+			continue
+		}
+
+		log.Infof("elected janitor leader for %v/%v", *keyspace, *shard)
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-lost:
+			case <-interrupted:
+			}
+			close(done)
+		}()
+		j.Run(*sleepTime, done)
+		release()
+
+		select {
+		case <-interrupted:
+			return
+		default:
+			log.Warningf("lost janitor leadership for %v/%v", *keyspace, *shard)
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *keyspace == "" || *shard == "" {
+		log.Fatalf("-keyspace and -shard are required")
+	}
+	moduleNames := janitor.ModuleNames()
+	if *modules != "" {
+		moduleNames = strings.Split(*modules, ",")
+	}
+
+	servenv.Init()
+	ts := topo.GetServer()
+	defer topo.CloseServers()
+
+	wr := wrangler.New(ts, 30*time.Second, 30*time.Second)
+	j, err := janitor.New(wr, *keyspace, *shard, moduleNames)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	stats.PublishJSONFunc("JanitorRecentFixes", func() string {
+		data, err := json.Marshal(j.RecentFixes())
+		if err != nil {
+			return "{}"
+		}
+		return string(data)
+	})
+
+	interrupted := make(chan struct{})
+	finished := make(chan struct{})
+	servenv.OnClose(func() {
+		close(interrupted)
+		<-finished
+	})
+	go func() {
+		runAsLeader(ts, j, interrupted)
+		close(finished)
+	}()
+	servenv.Run(*port)
+}
@@ -45,7 +45,7 @@ func main() {
 
 	ts.InitQueryService()
 
-	ts.AllowQueries(dbConfigs.App, schemaOverrides, ts.LoadCustomRules())
+	ts.AllowQueries(dbConfigs, schemaOverrides, ts.LoadCustomRules())
 
 	log.Infof("starting vtocc %v", *port)
 	servenv.OnClose(func() {
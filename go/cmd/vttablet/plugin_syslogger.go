@@ -0,0 +1,12 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// Imports and registers the syslog event publisher, so operational
+// events (reparents, tablet type changes, ...) go to syslog.
+
+import (
+	_ "github.com/youtube/vitess/go/event/syslogger"
+)
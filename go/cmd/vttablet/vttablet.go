@@ -7,10 +7,12 @@ package main
 
 import (
 	"flag"
+	"strings"
 	"time"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/vt/dbconfigs"
+	"github.com/youtube/vitess/go/vt/dtxresolver"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/servenv"
 	ts "github.com/youtube/vitess/go/vt/tabletserver"
@@ -23,11 +25,10 @@ var (
 	tabletPath    = flag.String("tablet-path", "", "tablet alias or path to zk node representing the tablet")
 	mycnfFile     = flag.String("mycnf-file", "", "my.cnf file")
 	overridesFile = flag.String("schema-override", "", "schema overrides file")
-
-	securePort = flag.Int("secure-port", 0, "port for the secure server")
-	cert       = flag.String("cert", "", "cert file")
-	key        = flag.String("key", "", "key file")
-	caCert     = flag.String("ca-cert", "", "ca-cert file")
+	namedPorts    = flag.String("named-ports", "", "additional ports of the tablet, registered in its record and in the serving graph, as name:port,... (for instance grpc:15991)")
+	publishAddr   = flag.String("publish-address", "hostname", "address of the tablet in the serving graph: hostname, or ip for the IP address (IPv4 or IPv6) its hostname resolves to")
+	dtxShard      = flag.String("dtx-shard", "", "keyspace/shard of the unsharded keyspace whose master keeps the metadata of the distributed transactions, as for vtgate. If empty, the abandoned prepared transactions are only resolved by vtgate")
+	dtxAbandonAge = flag.Duration("dtx-abandon-age", time.Minute, "distributed transactions still in the PREPARE state after this are rolled back by the transaction resolver")
 )
 
 func main() {
@@ -37,6 +38,13 @@ func main() {
 	servenv.Init()
 
 	tabletAlias := vttablet.TabletParamToTabletAlias(*tabletPath)
+	ports, err := topo.ParseNamedPorts(*namedPorts)
+	if err != nil {
+		log.Fatalf("invalid -named-ports: %v", err)
+	}
+	if *publishAddr != "hostname" && *publishAddr != "ip" {
+		log.Fatalf("invalid -publish-address %v, expected hostname or ip", *publishAddr)
+	}
 
 	if *mycnfFile == "" {
 		*mycnfFile = mysqlctl.MycnfFile(tabletAlias.Uid)
@@ -53,14 +61,27 @@ func main() {
 	}
 
 	ts.InitQueryService()
+	if *dtxShard != "" {
+		parts := strings.Split(*dtxShard, "/")
+		if len(parts) != 2 {
+			log.Fatalf("invalid -dtx-shard %v, expected keyspace/shard", *dtxShard)
+		}
+		ts.RegisterTransactionResolver(&dtxresolver.TopoTransactionResolver{
+			Server:     topo.GetServer(),
+			Keyspace:   parts[0],
+			Shard:      parts[1],
+			AbandonAge: *dtxAbandonAge,
+		})
+	}
 	mysqlctl.RegisterUpdateStreamService(mycnf)
 
 	// Depends on both query and updateStream.
-	if err := vttablet.InitAgent(tabletAlias, dbcfgs, mycnf, *dbCredentialsFile, *port, *securePort, *mycnfFile, *overridesFile); err != nil {
+	if err := vttablet.InitAgent(tabletAlias, dbcfgs, mycnf, *dbCredentialsFile, *port, *servenv.SecurePort, ports, *publishAddr == "ip", *mycnfFile, *overridesFile); err != nil {
 		log.Fatal(err)
 	}
 
 	vttablet.HttpHandleSnapshots(mycnf, tabletAlias.Uid)
+	servenv.OnTerm(vttablet.EnterLameduck)
 	servenv.OnClose(func() {
 		time.Sleep(5 * time.Millisecond)
 		ts.DisallowQueries()
@@ -68,5 +89,5 @@ func main() {
 		topo.CloseServers()
 		vttablet.CloseAgent()
 	})
-	servenv.RunSecure(*port, *securePort, *cert, *key, *caCert)
+	servenv.Run(*port)
 }
@@ -0,0 +1,84 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/worker"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+func init() {
+	addCommandGroup("Clones", "Workers copying data from one place to another.")
+	addCommand("Clones", command{"SplitClone", commandSplitClone,
+		"[-cell=<cell>] [-exclude-tables=''] [-resolver=numeric] [-source-reader-count=10] [-source-rdonly-count=1] [-destination-writer-count=20] [-insert-batch-size=100] [-min-table-size-for-split=1048576] [-max-chunk-size=67108864] [-max-chunks-per-second=0] [-max-writes-per-second=0] [-max-replication-lag=0] [-resume] <keyspace/shard> <key name>",
+		"Copies the data from an rdonly tablet of the source shard into the masters of\n" +
+			"the destination shards that cover its key range, then sets up filtered\n" +
+			"replication on the destinations. The keyspace id of each row is computed\n" +
+			"by the resolver from <key name>, a comma separated list of columns."})
+	addCommand("Clones", command{"VerticalSplitClone", commandVerticalSplitClone,
+		"[-cell=<cell>] -tables=<table1>,<table2>,... [-source-reader-count=10] [-source-rdonly-count=1] [-destination-writer-count=20] [-insert-batch-size=100] [-min-table-size-for-split=1048576] [-max-chunk-size=67108864] [-max-chunks-per-second=0] [-max-writes-per-second=0] [-max-replication-lag=0] [-resume] <source keyspace/shard> <destination keyspace/shard>",
+		"Copies the listed tables from an rdonly tablet of the source shard into the\n" +
+			"master of the destination shard, then sets up filtered replication of\n" +
+			"these tables on the destination."})
+}
+
+func commandSplitClone(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (worker.Worker, error) {
+	cell := subFlags.String("cell", "", "only use source rdonly tablets in this cell")
+	excludeTables := subFlags.String("exclude-tables", "", "comma separated list of tables to exclude")
+	resolverName := subFlags.String("resolver", "numeric", "keyspace id resolver, one of: "+strings.Join(key.ResolverNames(), ", "))
+	config := worker.CopyConfig{}
+	worker.RegisterCopyFlags(subFlags, &config)
+	if err := subFlags.Parse(args); err != nil {
+		return nil, err
+	}
+	if subFlags.NArg() != 2 {
+		return nil, fmt.Errorf("command SplitClone requires <keyspace/shard> <key name>")
+	}
+
+	keyspace, shard, err := shardParamToKeyspaceShard(subFlags.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	resolver, err := key.GetResolver(*resolverName)
+	if err != nil {
+		return nil, err
+	}
+	var excludeTableArray []string
+	if *excludeTables != "" {
+		excludeTableArray = strings.Split(*excludeTables, ",")
+	}
+	return worker.NewSplitCloneWorker(wr, *cell, keyspace, shard, strings.Split(subFlags.Arg(1), ","), resolver, excludeTableArray, config), nil
+}
+
+func commandVerticalSplitClone(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (worker.Worker, error) {
+	cell := subFlags.String("cell", "", "only use source rdonly tablets in this cell")
+	tables := subFlags.String("tables", "", "comma separated list of tables to copy")
+	config := worker.CopyConfig{}
+	worker.RegisterCopyFlags(subFlags, &config)
+	if err := subFlags.Parse(args); err != nil {
+		return nil, err
+	}
+	if subFlags.NArg() != 2 {
+		return nil, fmt.Errorf("command VerticalSplitClone requires <source keyspace/shard> <destination keyspace/shard>")
+	}
+	if *tables == "" {
+		return nil, fmt.Errorf("command VerticalSplitClone requires -tables")
+	}
+
+	sourceKeyspace, sourceShard, err := shardParamToKeyspaceShard(subFlags.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	destinationKeyspace, destinationShard, err := shardParamToKeyspaceShard(subFlags.Arg(1))
+	if err != nil {
+		return nil, err
+	}
+	return worker.NewVerticalSplitCloneWorker(wr, *cell, sourceKeyspace, sourceShard, destinationKeyspace, destinationShard, strings.Split(*tables, ","), config), nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/worker"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// command describes a vtworker command. Contrary to vtctl commands,
+// the method doesn't run the action, it just creates the worker that
+// will run it. It should not exit the process on invalid parameters,
+// as it is also used by the interactive mode.
+type command struct {
+	name   string
+	method func(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (worker.Worker, error)
+	params string
+	help   string // if help is empty, won't list the command
+}
+
+type commandGroup struct {
+	name        string
+	description string
+	commands    []command
+}
+
+var commands = []commandGroup{
+	commandGroup{
+		"Debugging", "Internal commands to test the vtworker framework.",
+		[]command{
+			command{"Sleep", commandSleep,
+				"<duration>",
+				"For internal tests only. Sleeps for <duration>, reporting progress every second,\n" +
+					"and can be canceled and resumed."},
+		},
+	},
+}
+
+func addCommand(groupName string, c command) {
+	for i, group := range commands {
+		if group.name == groupName {
+			commands[i].commands = append(commands[i].commands, c)
+			return
+		}
+	}
+	panic(fmt.Errorf("Trying to add to missing group %v", groupName))
+}
+
+func addCommandGroup(groupName, description string) {
+	for _, group := range commands {
+		if group.name == groupName {
+			return
+		}
+	}
+	commands = append(commands, commandGroup{groupName, description, nil})
+}
+
+func findCommand(name string) (*command, error) {
+	nameLowerCase := strings.ToLower(name)
+	for _, group := range commands {
+		for _, cmd := range group.commands {
+			if strings.ToLower(cmd.name) == nameLowerCase {
+				return &cmd, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown command: %v", name)
+}
+
+// commandWorker creates the worker for the command line args[0] args[1:].
+func commandWorker(wr *wrangler.Wrangler, args []string) (worker.Worker, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no command specified")
+	}
+	cmd, err := findCommand(args[0])
+	if err != nil {
+		return nil, err
+	}
+	subFlags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	subFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n\n", os.Args[0], cmd.name, cmd.params)
+		fmt.Fprintf(os.Stderr, "%s\n\n", cmd.help)
+		subFlags.PrintDefaults()
+	}
+	return cmd.method(wr, subFlags, args[1:])
+}
+
+// shardParamToKeyspaceShard parses a <keyspace/shard> parameter.
+func shardParamToKeyspaceShard(param string) (string, string, error) {
+	parts := strings.Split(param, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid shard path: %v", param)
+	}
+	return parts[0], parts[1], nil
+}
+
+func commandSleep(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (worker.Worker, error) {
+	if err := subFlags.Parse(args); err != nil {
+		return nil, err
+	}
+	if subFlags.NArg() != 1 {
+		return nil, fmt.Errorf("command Sleep requires <duration>")
+	}
+	duration, err := time.ParseDuration(subFlags.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	return worker.NewSleepWorker(duration), nil
+}
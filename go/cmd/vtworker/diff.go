@@ -0,0 +1,76 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/worker"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+func init() {
+	addCommandGroup("Diffs", "Workers comparing data between two places.")
+	addCommand("Diffs", command{"SplitDiff", commandSplitDiff,
+		"[-cell=<cell>] [-exclude-tables=''] [-key-type=uint64] [-reader-count=10] [-min-table-size-for-split=1048576] [-max-chunk-size=67108864] [-max-chunks-per-second=0] <keyspace/shard> <key name>",
+		"Compares the data of a destination shard of a horizontal split with its\n" +
+			"source shard, for the key range of the destination, using <key name> as\n" +
+			"the keyspace id column. Filtered replication is paused while an rdonly\n" +
+			"tablet on each side is stopped at the same position."})
+	addCommand("Diffs", command{"VerticalSplitDiff", commandVerticalSplitDiff,
+		"[-cell=<cell>] [-reader-count=10] [-min-table-size-for-split=1048576] [-max-chunk-size=67108864] [-max-chunks-per-second=0] <keyspace/shard>",
+		"Compares the tables of a destination shard of a vertical split with the\n" +
+			"same tables in its source shard. Filtered replication is paused while an\n" +
+			"rdonly tablet on each side is stopped at the same position."})
+}
+
+func commandSplitDiff(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (worker.Worker, error) {
+	cell := subFlags.String("cell", "", "only use rdonly tablets in this cell")
+	excludeTables := subFlags.String("exclude-tables", "", "comma separated list of tables to exclude")
+	keyType := subFlags.String("key-type", "uint64", "type of the key column: uint64 or bytes")
+	config := worker.DiffConfig{}
+	worker.RegisterDiffFlags(subFlags, &config)
+	if err := subFlags.Parse(args); err != nil {
+		return nil, err
+	}
+	if subFlags.NArg() != 2 {
+		return nil, fmt.Errorf("command SplitDiff requires <keyspace/shard> <key name>")
+	}
+
+	keyspace, shard, err := shardParamToKeyspaceShard(subFlags.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	kit, err := key.ParseKeyspaceIdType(*keyType)
+	if err != nil {
+		return nil, err
+	}
+	var excludeTableArray []string
+	if *excludeTables != "" {
+		excludeTableArray = strings.Split(*excludeTables, ",")
+	}
+	return worker.NewSplitDiffWorker(wr, *cell, keyspace, shard, subFlags.Arg(1), kit, excludeTableArray, config), nil
+}
+
+func commandVerticalSplitDiff(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (worker.Worker, error) {
+	cell := subFlags.String("cell", "", "only use rdonly tablets in this cell")
+	config := worker.DiffConfig{}
+	worker.RegisterDiffFlags(subFlags, &config)
+	if err := subFlags.Parse(args); err != nil {
+		return nil, err
+	}
+	if subFlags.NArg() != 1 {
+		return nil, fmt.Errorf("command VerticalSplitDiff requires <keyspace/shard>")
+	}
+
+	keyspace, shard, err := shardParamToKeyspaceShard(subFlags.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	return worker.NewVerticalSplitDiffWorker(wr, *cell, keyspace, shard, config), nil
+}
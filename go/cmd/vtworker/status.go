@@ -0,0 +1,314 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/worker"
+)
+
+var (
+	// all the following variables are protected by currentWorkerMutex
+	currentWorkerMutex   sync.Mutex
+	currentWorker        worker.Worker
+	currentWorkerCommand string
+	currentWorkerErr     error
+	currentDone          chan struct{}
+)
+
+// setAndStartWorker makes wrk the current worker and starts it in a
+// go routine. It returns a channel that is closed when the worker is
+// done. Only one worker can run at a time.
+func setAndStartWorker(wrk worker.Worker, command string, args []string) (chan struct{}, error) {
+	currentWorkerMutex.Lock()
+	defer currentWorkerMutex.Unlock()
+	if currentDone != nil {
+		return nil, fmt.Errorf("a worker is already in progress: %v", currentWorkerCommand)
+	}
+
+	currentWorker = wrk
+	currentWorkerErr = nil
+	currentWorkerCommand = strings.Join(append([]string{command}, args...), " ")
+	currentDone = make(chan struct{})
+	checkpointStore.SetCommand(command, args)
+	done := currentDone
+
+	go func() {
+		log.Infof("starting worker: %v", currentWorkerCommand)
+		stopCheckpoints := make(chan struct{})
+		go saveCheckpoints(wrk, stopCheckpoints)
+
+		err := wrk.Run()
+		close(stopCheckpoints)
+		switch err {
+		case nil:
+			log.Infof("worker done")
+			if err := checkpointStore.Clear(); err != nil {
+				log.Warningf("cannot clear checkpoint: %v", err)
+			}
+		case worker.ErrInterrupted:
+			log.Infof("worker canceled")
+			saveCheckpoint(wrk)
+		default:
+			log.Errorf("worker failed: %v", err)
+			saveCheckpoint(wrk)
+		}
+
+		currentWorkerMutex.Lock()
+		currentWorkerErr = err
+		currentDone = nil
+		currentWorkerMutex.Unlock()
+		close(done)
+	}()
+
+	return done, nil
+}
+
+// cancelCurrentWorker cancels the running worker, if any, and
+// returns the channel that will be closed when it is done.
+func cancelCurrentWorker() chan struct{} {
+	currentWorkerMutex.Lock()
+	defer currentWorkerMutex.Unlock()
+	if currentDone == nil {
+		return nil
+	}
+	currentWorker.Cancel()
+	return currentDone
+}
+
+func saveCheckpoint(wrk worker.Worker) {
+	if err := checkpointStore.Save(wrk); err != nil {
+		log.Warningf("cannot save checkpoint: %v", err)
+	}
+}
+
+// saveCheckpoints regularly saves the worker state until stop is closed.
+func saveCheckpoints(wrk worker.Worker, stop chan struct{}) {
+	if checkpointStore == nil {
+		return
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(*checkpointInterval):
+			saveCheckpoint(wrk)
+		}
+	}
+}
+
+const indexHTML = `
+<!DOCTYPE html>
+<head>
+  <title>Worker Action Index</title>
+</head>
+<body>
+  <h1>Worker Action Index</h1>
+  {{range $i, $group := . }}
+    <li><b>{{$group.Name}}</b>: {{$group.Description}}</li>
+    <ul>
+    {{range $j, $cmd := $group.Commands }}
+      <li>{{$cmd.Name}} {{$cmd.Params}}<br/>
+        <form action="/start" method="POST">
+          <input type="hidden" name="command" value="{{$cmd.Name}}"/>
+          <input type="text" name="args" size="60"/>
+          <input type="submit" value="Start"/>
+        </form>
+      </li>
+    {{end}}
+    </ul>
+  {{end}}
+</body>
+`
+
+const statusHTML = `
+<!DOCTYPE html>
+<head>
+  <title>Worker Status</title>
+  {{if .Running}}<meta http-equiv="refresh" content="5">{{end}}
+</head>
+<body>
+  <h1>Worker Status</h1>
+  {{if .Command}}
+    <b>Command:</b> {{.Command}}</br>
+    {{.Status}}
+    {{if .Running}}
+      <form action="/cancel" method="POST"><input type="submit" value="Cancel"/></form>
+    {{else}}
+      <form action="/reset" method="POST"><input type="submit" value="Reset Job"/></form>
+    {{end}}
+  {{else}}
+    This worker is idle.</br>
+    <a href="/">Toplevel Menu</a>
+  {{end}}
+</body>
+`
+
+// workerStatusHTML is the worker section of /debug/status
+const workerStatusHTML = `
+  {{if .Command}}
+    <b>Command:</b> {{.Command}} ({{if .Running}}running{{else}}done{{end}})</br>
+    {{if .Err}}<b>Error:</b> {{.Err}}</br>{{end}}
+    {{.Status}}
+  {{else}}
+    This worker is idle.
+  {{end}}
+  <a href="/status">Worker status page</a>
+`
+
+var (
+	indexTemplate  = template.Must(template.New("index").Parse(indexHTML))
+	statusTemplate = template.Must(template.New("status").Parse(statusHTML))
+)
+
+type indexCommand struct {
+	Name   string
+	Params string
+}
+
+type indexGroup struct {
+	Name        string
+	Description string
+	Commands    []indexCommand
+}
+
+func httpError(w http.ResponseWriter, format string, err error) {
+	log.Errorf(format, err)
+	http.Error(w, fmt.Sprintf(format, err), http.StatusInternalServerError)
+}
+
+// requirePost fails the requests that change the worker state but
+// are not a POST, so a link or a crawler cannot start or cancel a
+// worker. It returns false if the request was failed.
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != "POST" {
+		http.Error(w, "the worker can only be changed by a POST", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func initStatusHandling() {
+	servenv.AddStatusPart("Worker", workerStatusHTML, func() interface{} {
+		currentWorkerMutex.Lock()
+		wrk := currentWorker
+		data := map[string]interface{}{
+			"Command": currentWorkerCommand,
+			"Running": currentDone != nil,
+			"Err":     currentWorkerErr,
+		}
+		currentWorkerMutex.Unlock()
+
+		if wrk != nil {
+			data["Status"] = wrk.StatusAsHTML()
+		}
+		return data
+	})
+
+	// the index page lists the commands, and lets the user start one
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		groups := make([]indexGroup, 0, len(commands))
+		for _, group := range commands {
+			ig := indexGroup{Name: group.name, Description: group.description}
+			for _, cmd := range group.commands {
+				if cmd.help == "" {
+					continue
+				}
+				ig.Commands = append(ig.Commands, indexCommand{cmd.name, cmd.params})
+			}
+			groups = append(groups, ig)
+		}
+		if err := indexTemplate.Execute(w, groups); err != nil {
+			httpError(w, "cannot execute template: %v", err)
+		}
+	})
+
+	http.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		if !requirePost(w, r) {
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			httpError(w, "cannot parse form: %v", err)
+			return
+		}
+		command := r.FormValue("command")
+		args := strings.Fields(r.FormValue("args"))
+		wrk, err := commandWorker(wr, append([]string{command}, args...))
+		if err != nil {
+			httpError(w, "cannot create worker: %v", err)
+			return
+		}
+		if _, err := setAndStartWorker(wrk, command, args); err != nil {
+			httpError(w, "cannot start worker: %v", err)
+			return
+		}
+		http.Redirect(w, r, "/status", http.StatusSeeOther)
+	})
+
+	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		currentWorkerMutex.Lock()
+		wrk := currentWorker
+		data := map[string]interface{}{
+			"Command": currentWorkerCommand,
+			"Running": currentDone != nil,
+		}
+		currentWorkerMutex.Unlock()
+
+		if r.FormValue("format") == "text" {
+			if wrk == nil {
+				fmt.Fprintf(w, "This worker is idle.\n")
+				return
+			}
+			fmt.Fprintf(w, "Command: %v\n%v", data["Command"], wrk.StatusAsText())
+			return
+		}
+
+		if wrk != nil {
+			data["Status"] = wrk.StatusAsHTML()
+		}
+		if err := statusTemplate.Execute(w, data); err != nil {
+			httpError(w, "cannot execute template: %v", err)
+		}
+	})
+
+	http.HandleFunc("/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if !requirePost(w, r) {
+			return
+		}
+		if cancelCurrentWorker() == nil {
+			http.Error(w, "no worker running", http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/status", http.StatusSeeOther)
+	})
+
+	http.HandleFunc("/reset", func(w http.ResponseWriter, r *http.Request) {
+		if !requirePost(w, r) {
+			return
+		}
+		currentWorkerMutex.Lock()
+		defer currentWorkerMutex.Unlock()
+		if currentDone != nil {
+			http.Error(w, "worker still running, cancel it first", http.StatusBadRequest)
+			return
+		}
+		currentWorker = nil
+		currentWorkerCommand = ""
+		currentWorkerErr = nil
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+vtworker is the main program to run a worker job.
+
+It has two modes: single command or interactive.
+  - in single command, it will start the job passed in from the command line,
+    and exit when it is done.
+  - in interactive mode, it will wait for commands started from the
+    web interface, on the -port.
+
+In both modes, the status of the current job is available on /status.
+If -checkpoint-file is set, the state of resumable workers is
+regularly saved to that file, and a job can be restarted from it
+with -resume after vtworker was restarted.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/servenv"
+	tm "github.com/youtube/vitess/go/vt/tabletmanager"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/worker"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+var (
+	port               = flag.Int("port", 8080, "port for the status / interactive mode")
+	checkpointFile     = flag.String("checkpoint-file", "", "if set, the state of resumable workers is saved in this file")
+	checkpointInterval = flag.Duration("checkpoint-interval", 30*time.Second, "how often to save the worker state to -checkpoint-file")
+	resume             = flag.Bool("resume", false, "restart the job saved in -checkpoint-file")
+)
+
+var (
+	wr              *wrangler.Wrangler
+	checkpointStore *worker.CheckpointStore
+)
+
+func installSignalHandlers() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-sigChan
+		// we got a signal, cancel the current worker, and
+		// interrupt anything waiting on a lock or an action
+		log.Infof("received signal, canceling current worker")
+		cancelCurrentWorker()
+		tm.SignalInterrupt()
+		wrangler.SignalInterrupt()
+	}()
+}
+
+// startFromArgs creates and starts the worker for the command line.
+func startFromArgs(args []string) (chan struct{}, error) {
+	wrk, err := commandWorker(wr, args)
+	if err != nil {
+		return nil, err
+	}
+	return setAndStartWorker(wrk, args[0], args[1:])
+}
+
+// startFromCheckpoint re-creates the worker saved in the checkpoint
+// file, restores its state, and starts it.
+func startFromCheckpoint() (chan struct{}, error) {
+	cp, err := checkpointStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load checkpoint: %v", err)
+	}
+	if cp == nil {
+		return nil, fmt.Errorf("no checkpoint to resume from in %v", *checkpointFile)
+	}
+	log.Infof("resuming %v %v from checkpoint saved at %v", cp.Command, cp.Args, cp.Time)
+	wrk, err := commandWorker(wr, append([]string{cp.Command}, cp.Args...))
+	if err != nil {
+		return nil, err
+	}
+	r, ok := wrk.(worker.Resumable)
+	if !ok {
+		return nil, fmt.Errorf("command %v cannot be resumed", cp.Command)
+	}
+	if err := r.RestoreCheckpoint(cp.State); err != nil {
+		return nil, fmt.Errorf("cannot restore checkpoint: %v", err)
+	}
+	return setAndStartWorker(wrk, cp.Command, cp.Args)
+}
+
+func main() {
+	flag.Parse()
+	args := flag.Args()
+	if *resume && *checkpointFile == "" {
+		log.Fatalf("-resume requires -checkpoint-file")
+	}
+
+	servenv.Init()
+	defer servenv.Close()
+
+	ts := topo.GetServer()
+	defer topo.CloseServers()
+
+	wr = wrangler.New(ts, 30*time.Second, 30*time.Second)
+	checkpointStore = worker.NewCheckpointStore(*checkpointFile)
+
+	installSignalHandlers()
+	initStatusHandling()
+
+	if len(args) == 0 && !*resume {
+		// interactive mode, wait for commands from the web page
+		servenv.Run(*port)
+		if done := cancelCurrentWorker(); done != nil {
+			<-done
+		}
+		return
+	}
+
+	var done chan struct{}
+	var err error
+	if *resume {
+		done, err = startFromCheckpoint()
+	} else {
+		done, err = startFromArgs(args)
+	}
+	if err != nil {
+		log.Errorf("cannot start worker: %v", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// serve the status page while the worker is running
+	go servenv.Run(*port)
+	<-done
+
+	currentWorkerMutex.Lock()
+	err = currentWorkerErr
+	currentWorkerMutex.Unlock()
+	if err != nil {
+		log.Errorf("worker failed: %v", err)
+		servenv.Close()
+		topo.CloseServers()
+		os.Exit(255)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package event provides a decoupled way to publish events within a
+// process. Listeners are functions taking a single argument, the
+// type of events they want to receive. Dispatch calls all the
+// listeners whose argument type is the type of the event, or an
+// interface the event implements.
+//
+// For instance:
+//
+//	event.AddListener(func(ev *MyEvent) { ... })
+//	event.AddListener(func(ev fmt.Stringer) { ... })
+//	event.Dispatch(&MyEvent{...}) // calls both listeners if *MyEvent is a fmt.Stringer
+package event
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	listenersMutex sync.RWMutex
+	listeners      = make(map[reflect.Type][]reflect.Value)
+)
+
+// AddListener registers a listener function. It panics if fn is not
+// a function with exactly one argument.
+func AddListener(fn interface{}) {
+	fnType := reflect.TypeOf(fn)
+	if fnType == nil || fnType.Kind() != reflect.Func || fnType.NumIn() != 1 {
+		panic(fmt.Errorf("event listener must be a function with one argument, got %T", fn))
+	}
+
+	listenersMutex.Lock()
+	defer listenersMutex.Unlock()
+	argType := fnType.In(0)
+	listeners[argType] = append(listeners[argType], reflect.ValueOf(fn))
+}
+
+// Dispatch sends an event to all the listeners that accept it. The
+// listeners are called synchronously, in the calling goroutine.
+func Dispatch(ev interface{}) {
+	evType := reflect.TypeOf(ev)
+	if evType == nil {
+		return
+	}
+	args := []reflect.Value{reflect.ValueOf(ev)}
+
+	listenersMutex.RLock()
+	var matching []reflect.Value
+	for argType, fns := range listeners {
+		if argType == evType || (argType.Kind() == reflect.Interface && evType.Implements(argType)) {
+			matching = append(matching, fns...)
+		}
+	}
+	listenersMutex.RUnlock()
+
+	for _, fn := range matching {
+		fn.Call(args)
+	}
+}
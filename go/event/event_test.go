@@ -0,0 +1,55 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"testing"
+)
+
+type testInterface interface {
+	name() string
+}
+
+type testEvent1 struct{}
+
+func (testEvent1) name() string { return "testEvent1" }
+
+type testEvent2 struct{}
+
+func TestDispatch(t *testing.T) {
+	var got1, got2, gotInterface []string
+	AddListener(func(ev testEvent1) { got1 = append(got1, "testEvent1") })
+	AddListener(func(ev *testEvent2) { got2 = append(got2, "testEvent2") })
+	AddListener(func(ev testInterface) { gotInterface = append(gotInterface, ev.name()) })
+
+	Dispatch(testEvent1{})
+	Dispatch(&testEvent2{})
+	Dispatch(testEvent2{})
+	Dispatch("no listener for this one")
+	Dispatch(nil)
+
+	if len(got1) != 1 {
+		t.Errorf("testEvent1 listener: want 1 call, got %v", got1)
+	}
+	if len(got2) != 1 {
+		t.Errorf("*testEvent2 listener: want 1 call, got %v", got2)
+	}
+	if len(gotInterface) != 1 || gotInterface[0] != "testEvent1" {
+		t.Errorf("interface listener: want [testEvent1], got %v", gotInterface)
+	}
+}
+
+func TestAddListenerBadFunction(t *testing.T) {
+	for _, fn := range []interface{}{nil, 12, func() {}, func(a, b int) {}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("AddListener(%#v) should have panicked", fn)
+				}
+			}()
+			AddListener(fn)
+		}()
+	}
+}
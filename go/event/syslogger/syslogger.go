@@ -0,0 +1,77 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package syslogger publishes events to the local syslog. Importing
+// it registers an event listener for all the events that implement
+// Syslogger.
+package syslogger
+
+import (
+	"log/syslog"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/event"
+)
+
+// Syslogger is the interface events implement to be sent to syslog.
+type Syslogger interface {
+	// Syslog returns the severity the event should be logged at,
+	// and the message.
+	Syslog() (syslog.Priority, string)
+}
+
+// syslogWriter is the subset of *syslog.Writer we use.
+type syslogWriter interface {
+	Alert(string) error
+	Crit(string) error
+	Debug(string) error
+	Emerg(string) error
+	Err(string) error
+	Info(string) error
+	Notice(string) error
+	Warning(string) error
+}
+
+// writer is where the events go, nil if syslog is not available.
+var writer syslogWriter
+
+func listener(ev Syslogger) {
+	if writer == nil {
+		return
+	}
+	severity, msg := ev.Syslog()
+	var err error
+	switch severity & 7 {
+	case syslog.LOG_EMERG:
+		err = writer.Emerg(msg)
+	case syslog.LOG_ALERT:
+		err = writer.Alert(msg)
+	case syslog.LOG_CRIT:
+		err = writer.Crit(msg)
+	case syslog.LOG_ERR:
+		err = writer.Err(msg)
+	case syslog.LOG_WARNING:
+		err = writer.Warning(msg)
+	case syslog.LOG_NOTICE:
+		err = writer.Notice(msg)
+	case syslog.LOG_INFO:
+		err = writer.Info(msg)
+	case syslog.LOG_DEBUG:
+		err = writer.Debug(msg)
+	}
+	if err != nil {
+		log.Errorf("cannot write event to syslog: %v", err)
+	}
+}
+
+func init() {
+	// the tag is the process name
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, "")
+	if err != nil {
+		log.Errorf("cannot connect to syslog, events will not be published: %v", err)
+	} else {
+		writer = w
+	}
+	event.AddListener(listener)
+}
@@ -0,0 +1,53 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syslogger
+
+import (
+	"log/syslog"
+	"testing"
+
+	"github.com/youtube/vitess/go/event"
+)
+
+type fakeWriter struct {
+	messages []string
+}
+
+func (fw *fakeWriter) write(severity, msg string) error {
+	fw.messages = append(fw.messages, severity+": "+msg)
+	return nil
+}
+
+func (fw *fakeWriter) Alert(msg string) error   { return fw.write("ALERT", msg) }
+func (fw *fakeWriter) Crit(msg string) error    { return fw.write("CRIT", msg) }
+func (fw *fakeWriter) Debug(msg string) error   { return fw.write("DEBUG", msg) }
+func (fw *fakeWriter) Emerg(msg string) error   { return fw.write("EMERG", msg) }
+func (fw *fakeWriter) Err(msg string) error     { return fw.write("ERR", msg) }
+func (fw *fakeWriter) Info(msg string) error    { return fw.write("INFO", msg) }
+func (fw *fakeWriter) Notice(msg string) error  { return fw.write("NOTICE", msg) }
+func (fw *fakeWriter) Warning(msg string) error { return fw.write("WARNING", msg) }
+
+type testEvent struct {
+	priority syslog.Priority
+	message  string
+}
+
+func (ev *testEvent) Syslog() (syslog.Priority, string) {
+	return ev.priority, ev.message
+}
+
+func TestSyslogger(t *testing.T) {
+	fw := &fakeWriter{}
+	writer = fw
+
+	event.Dispatch(&testEvent{syslog.LOG_INFO, "reparent finished"})
+	event.Dispatch(&testEvent{syslog.LOG_ERR | syslog.LOG_DAEMON, "reparent failed"})
+	event.Dispatch("not a Syslogger")
+
+	want := []string{"INFO: reparent finished", "ERR: reparent failed"}
+	if len(fw.messages) != len(want) || fw.messages[0] != want[0] || fw.messages[1] != want[1] {
+		t.Errorf("want %v, got %v", want, fw.messages)
+	}
+}
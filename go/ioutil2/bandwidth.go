@@ -0,0 +1,90 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ioutil2
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// BandwidthLimiter limits the number of bytes per second going
+// through it. It can be shared by multiple readers and writers,
+// from multiple go routines, to limit their total bandwidth.
+// A nil *BandwidthLimiter is valid, and doesn't limit anything.
+type BandwidthLimiter struct {
+	mu             sync.Mutex
+	bytesPerSecond int64
+	// next is when the next transfer is allowed
+	next time.Time
+}
+
+// NewBandwidthLimiter returns a BandwidthLimiter allowing
+// bytesPerSecond bytes per second. It returns nil if bytesPerSecond
+// is not positive, i.e. if there is no limit.
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &BandwidthLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// Wait accounts for n bytes transferred, and blocks until the
+// transfer of more bytes is allowed.
+func (bl *BandwidthLimiter) Wait(n int) {
+	if bl == nil || n <= 0 {
+		return
+	}
+	bl.mu.Lock()
+	now := time.Now()
+	if bl.next.Before(now) {
+		// we were idle, don't give credit for it
+		bl.next = now
+	}
+	bl.next = bl.next.Add(time.Duration(int64(n) * int64(time.Second) / bl.bytesPerSecond))
+	wait := bl.next.Sub(now)
+	bl.mu.Unlock()
+	time.Sleep(wait)
+}
+
+type limitedReader struct {
+	r  io.Reader
+	bl *BandwidthLimiter
+}
+
+// NewLimitedReader returns a Reader that reads from r, at the rate
+// allowed by bl.
+func NewLimitedReader(r io.Reader, bl *BandwidthLimiter) io.Reader {
+	if bl == nil {
+		return r
+	}
+	return &limitedReader{r, bl}
+}
+
+func (lr *limitedReader) Read(p []byte) (n int, err error) {
+	n, err = lr.r.Read(p)
+	lr.bl.Wait(n)
+	return
+}
+
+type limitedWriter struct {
+	w  io.Writer
+	bl *BandwidthLimiter
+}
+
+// NewLimitedWriter returns a Writer that writes to w, at the rate
+// allowed by bl.
+func NewLimitedWriter(w io.Writer, bl *BandwidthLimiter) io.Writer {
+	if bl == nil {
+		return w
+	}
+	return &limitedWriter{w, bl}
+}
+
+func (lw *limitedWriter) Write(p []byte) (n int, err error) {
+	n, err = lw.w.Write(p)
+	lw.bl.Wait(n)
+	return
+}
@@ -0,0 +1,60 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ioutil2
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiterNil(t *testing.T) {
+	if bl := NewBandwidthLimiter(0); bl != nil {
+		t.Fatalf("NewBandwidthLimiter(0) should return nil: %v", bl)
+	}
+	r := bytes.NewReader(make([]byte, 10))
+	if lr := NewLimitedReader(r, nil); lr != io.Reader(r) {
+		t.Errorf("NewLimitedReader with no limit should return the original reader")
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	// 100 kB/s, reading 50 kB should take about half a second
+	bl := NewBandwidthLimiter(100 * 1024)
+	start := time.Now()
+	data, err := ioutil.ReadAll(NewLimitedReader(bytes.NewReader(make([]byte, 50*1024)), bl))
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if len(data) != 50*1024 {
+		t.Errorf("got %v bytes, expected %v", len(data), 50*1024)
+	}
+	if d := time.Now().Sub(start); d < 400*time.Millisecond || d > 2*time.Second {
+		t.Errorf("reading took %v, expected about 500ms", d)
+	}
+}
+
+func TestLimitedWriterShared(t *testing.T) {
+	// two writers sharing 100 kB/s, writing 25 kB each
+	bl := NewBandwidthLimiter(100 * 1024)
+	start := time.Now()
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			w := NewLimitedWriter(ioutil.Discard, bl)
+			for j := 0; j < 25; j++ {
+				w.Write(make([]byte, 1024))
+			}
+			done <- struct{}{}
+		}()
+	}
+	<-done
+	<-done
+	if d := time.Now().Sub(start); d < 400*time.Millisecond || d > 2*time.Second {
+		t.Errorf("writing took %v, expected about 500ms", d)
+	}
+}
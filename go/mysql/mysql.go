@@ -36,6 +36,7 @@ const (
 	DUP_ENTRY         = C.ER_DUP_ENTRY
 	LOCK_WAIT_TIMEOUT = C.ER_LOCK_WAIT_TIMEOUT
 	LOCK_DEADLOCK     = C.ER_LOCK_DEADLOCK
+	ACCESS_DENIED     = C.ER_ACCESS_DENIED_ERROR
 )
 
 type SqlError struct {
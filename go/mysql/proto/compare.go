@@ -0,0 +1,75 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"bytes"
+	"math/big"
+	"strconv"
+
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+// The field types of the numeric columns. These numbers match the
+// values of mysql_com.h.
+const (
+	VT_DECIMAL    = 0
+	VT_TINY       = 1
+	VT_SHORT      = 2
+	VT_LONG       = 3
+	VT_FLOAT      = 4
+	VT_DOUBLE     = 5
+	VT_LONGLONG   = 8
+	VT_INT24      = 9
+	VT_YEAR       = 13
+	VT_NEWDECIMAL = 246
+)
+
+// IsNumericType returns true if MySQL sorts the values of a field of
+// type fieldType as numbers.
+func IsNumericType(fieldType int64) bool {
+	switch fieldType {
+	case VT_DECIMAL, VT_TINY, VT_SHORT, VT_LONG, VT_FLOAT, VT_DOUBLE, VT_LONGLONG, VT_INT24, VT_YEAR, VT_NEWDECIMAL:
+		return true
+	}
+	return false
+}
+
+// CompareValues compares two values of a field of type fieldType, in
+// the order of MySQL for a binary collation: NULL first, then the
+// numeric types as numbers, and the other types byte by byte. The
+// values of the other collations cannot be compared outside of MySQL:
+// the callers have to sort them with a binary collation, or only
+// compare numbers. The values are parsed whatever their sqltypes
+// type, since they all decode as strings from bson.
+func CompareValues(fieldType int64, a, b sqltypes.Value) int {
+	switch {
+	case a.IsNull() && b.IsNull():
+		return 0
+	case a.IsNull():
+		return -1
+	case b.IsNull():
+		return 1
+	}
+	if IsNumericType(fieldType) {
+		if ai, err := strconv.ParseInt(a.String(), 10, 64); err == nil {
+			if bi, err := strconv.ParseInt(b.String(), 10, 64); err == nil {
+				switch {
+				case ai < bi:
+					return -1
+				case ai > bi:
+					return 1
+				}
+				return 0
+			}
+		}
+		ar, aok := new(big.Rat).SetString(a.String())
+		br, bok := new(big.Rat).SetString(b.String())
+		if aok && bok {
+			return ar.Cmp(br)
+		}
+	}
+	return bytes.Compare(a.Raw(), b.Raw())
+}
@@ -0,0 +1,42 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"testing"
+
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+func TestCompareValues(t *testing.T) {
+	str := func(s string) sqltypes.Value {
+		return sqltypes.MakeString([]byte(s))
+	}
+	testCases := []struct {
+		fieldType int64
+		a, b      sqltypes.Value
+		want      int
+	}{
+		{VT_LONG, sqltypes.NULL, sqltypes.NULL, 0},
+		{VT_LONG, sqltypes.NULL, sqltypes.MakeNumeric([]byte("1")), -1},
+		{253, str("a"), sqltypes.NULL, 1},
+		{VT_LONG, sqltypes.MakeNumeric([]byte("9")), sqltypes.MakeNumeric([]byte("10")), -1},
+		{VT_NEWDECIMAL, sqltypes.MakeNumeric([]byte("-2")), sqltypes.MakeFractional([]byte("-2.5")), 1},
+		{VT_NEWDECIMAL, sqltypes.MakeFractional([]byte("1.50")), sqltypes.MakeFractional([]byte("1.5")), 0},
+		{VT_LONGLONG, sqltypes.MakeNumeric([]byte("18446744073709551615")), sqltypes.MakeNumeric([]byte("1")), 1},
+		{253, sqltypes.MakeString([]byte("b")), sqltypes.MakeString([]byte("ab")), 1},
+		// the values decoded from bson are strings
+		{VT_LONG, str("9"), str("10"), -1},
+		{VT_DOUBLE, str("1e3"), str("999.5"), 1},
+		// numbers in a string column are compared as strings
+		{253, str("9"), str("10"), 1},
+		{253, str("B"), str("a"), -1},
+	}
+	for _, tc := range testCases {
+		if got := CompareValues(tc.fieldType, tc.a, tc.b); got != tc.want {
+			t.Errorf("CompareValues(%v, %v, %v): got %v, want %v", tc.fieldType, tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -8,7 +8,6 @@ This packages contains a few utility functions for network related functions.
 package netutil
 
 import (
-	"fmt"
 	"math/rand"
 	"net"
 	"os"
@@ -79,13 +78,19 @@ func SplitHostPort(addr string) (string, int, error) {
 	if err != nil {
 		return "", 0, err
 	}
-	p, err := strconv.ParseInt(port, 10, 16)
+	p, err := strconv.ParseUint(port, 10, 16)
 	if err != nil {
 		return "", 0, err
 	}
 	return host, int(p), nil
 }
 
+// JoinHostPort is an extension to net.JoinHostPort that takes an
+// integer port. IPv6 literals are enclosed in brackets.
+func JoinHostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
 // FullyQualifiedHostname returns the full hostname with domain
 func FullyQualifiedHostname() (string, error) {
 	hostname, err := os.Hostname()
@@ -123,7 +128,7 @@ func ResolveAddr(addr string) (string, error) {
 			return "", err
 		}
 	}
-	return fmt.Sprintf("%v:%v", host, port), nil
+	return JoinHostPort(host, port), nil
 }
 
 // ResolveIpAddr resolves the address:port part into an IP address:port pair
@@ -14,7 +14,8 @@ import (
 )
 
 var (
-	CLOSED_ERR = fmt.Errorf("ResourcePool is closed")
+	CLOSED_ERR  = fmt.Errorf("ResourcePool is closed")
+	TIMEOUT_ERR = fmt.Errorf("ResourcePool Get timed out")
 )
 
 // Factory is a function that can be used to create a resource.
@@ -35,8 +36,9 @@ type ResourcePool struct {
 	idleTimeout sync2.AtomicDuration
 
 	// stats
-	waitCount sync2.AtomicInt64
-	waitTime  sync2.AtomicDuration
+	waitCount    sync2.AtomicInt64
+	waitTime     sync2.AtomicDuration
+	waitTimeouts sync2.AtomicInt64
 }
 
 type resourceWrapper struct {
@@ -84,17 +86,24 @@ func (rp *ResourcePool) IsClosed() (closed bool) {
 // has not been reached, it will create a new one using the factory. Otherwise,
 // it will indefinitely wait till the next resource becomes available.
 func (rp *ResourcePool) Get() (resource Resource, err error) {
-	return rp.get(true)
+	return rp.get(true, 0)
+}
+
+// GetWithTimeout is like Get, but it only waits for timeout for a
+// resource to become available. It then returns TIMEOUT_ERR.
+// A timeout of 0 means no timeout.
+func (rp *ResourcePool) GetWithTimeout(timeout time.Duration) (resource Resource, err error) {
+	return rp.get(true, timeout)
 }
 
 // TryGet will return the next available resource. If none is available, and capacity
 // has not been reached, it will create a new one using the factory. Otherwise,
 // it will return nil with no error.
 func (rp *ResourcePool) TryGet() (resource Resource, err error) {
-	return rp.get(false)
+	return rp.get(false, 0)
 }
 
-func (rp *ResourcePool) get(wait bool) (resource Resource, err error) {
+func (rp *ResourcePool) get(wait bool, waitTimeout time.Duration) (resource Resource, err error) {
 	if rp == nil {
 		return nil, CLOSED_ERR
 	}
@@ -108,7 +117,19 @@ func (rp *ResourcePool) get(wait bool) (resource Resource, err error) {
 			return nil, nil
 		}
 		startTime := time.Now()
-		wrapper, ok = <-rp.resources
+		if waitTimeout == 0 {
+			wrapper, ok = <-rp.resources
+		} else {
+			timer := time.NewTimer(waitTimeout)
+			select {
+			case wrapper, ok = <-rp.resources:
+				timer.Stop()
+			case <-timer.C:
+				rp.recordWait(startTime)
+				rp.waitTimeouts.Add(1)
+				return nil, TIMEOUT_ERR
+			}
+		}
 		rp.recordWait(startTime)
 	}
 	if !ok {
@@ -232,6 +253,15 @@ func (rp *ResourcePool) Available() int64 {
 	return int64(len(rp.resources))
 }
 
+// InUse returns the number of resources that were handed out with
+// Get and not Put back yet.
+func (rp *ResourcePool) InUse() int64 {
+	if rp == nil {
+		return 0
+	}
+	return rp.capacity.Get() - int64(len(rp.resources))
+}
+
 func (rp *ResourcePool) MaxCap() int64 {
 	if rp == nil {
 		return 0
@@ -259,3 +289,12 @@ func (rp *ResourcePool) IdleTimeout() time.Duration {
 	}
 	return rp.idleTimeout.Get()
 }
+
+// WaitTimeouts returns the number of GetWithTimeout calls that
+// timed out.
+func (rp *ResourcePool) WaitTimeouts() int64 {
+	if rp == nil {
+		return 0
+	}
+	return rp.waitTimeouts.Get()
+}
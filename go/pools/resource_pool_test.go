@@ -514,3 +514,36 @@ func TestNil(t *testing.T) {
 		t.Errorf("want zeroes, got %v %v %v %v %v %v", c, a, mx, wc, wt, it)
 	}
 }
+
+func TestGetWithTimeout(t *testing.T) {
+	lastId.Set(0)
+	count.Set(0)
+	p := NewResourcePool(PoolFactory, 1, 1, time.Second)
+	defer p.Close()
+
+	r, err := p.GetWithTimeout(time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if p.InUse() != 1 {
+		t.Errorf("expecting 1 in use, received %d", p.InUse())
+	}
+	if _, err := p.GetWithTimeout(10 * time.Millisecond); err != TIMEOUT_ERR {
+		t.Errorf("expecting %v, received %v", TIMEOUT_ERR, err)
+	}
+	if p.WaitCount() != 1 || p.WaitTimeouts() != 1 || p.WaitTime() < 10*time.Millisecond {
+		t.Errorf("bad wait stats: %v %v %v", p.WaitCount(), p.WaitTimeouts(), p.WaitTime())
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		p.Put(r)
+	}()
+	if r, err = p.GetWithTimeout(time.Second); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	p.Put(r)
+	if p.InUse() != 0 {
+		t.Errorf("expecting 0 in use, received %d", p.InUse())
+	}
+}
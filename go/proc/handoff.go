@@ -0,0 +1,159 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	log "github.com/golang/glog"
+)
+
+// This file contains the socket handoff: on SIGUSR2, the server
+// starts a new copy of its binary (usually just upgraded), passing it
+// its listening sockets. The new process serves on the sockets as soon
+// as it is ready, without binding the ports again, so no connection is
+// refused during the restart. It then sends SIGUSR1 to the old
+// process, which stops like for a regular successor, finishing the
+// requests of its current connections first.
+
+const (
+	// listenFdEnv is the environment variable giving the file
+	// descriptor of the inherited listening socket to the new
+	// process.
+	listenFdEnv = "VT_LISTEN_FD"
+
+	// secureListenFdEnv is the same for the listening socket of
+	// the secure server, if there is one.
+	secureListenFdEnv = "VT_SECURE_LISTEN_FD"
+)
+
+var (
+	handoffMu             sync.Mutex
+	handoffListener       *net.TCPListener
+	secureHandoffListener *net.TCPListener
+)
+
+// setHandoffListener records in slot a listener that is passed to the
+// new process on SIGUSR2.
+func setHandoffListener(slot **net.TCPListener, l net.Listener) {
+	handoffMu.Lock()
+	defer handoffMu.Unlock()
+	if tl, ok := l.(*net.TCPListener); ok {
+		*slot = tl
+	}
+}
+
+// inheritListener returns the listening socket passed by the previous
+// process as the file descriptor fd.
+func inheritListener(fd string) (net.Listener, error) {
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inherited listener fd: %v", fd)
+	}
+	f := os.NewFile(uintptr(n), "listener")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use inherited listener %v: %v", fd, err)
+	}
+	return l, nil
+}
+
+// listenInherited returns the listening socket passed by the previous
+// process, and tells it that we are taking over.
+func listenInherited(fd string) (net.Listener, error) {
+	os.Setenv(listenFdEnv, "")
+	l, err := inheritListener(fd)
+	if err != nil {
+		return nil, err
+	}
+	setHandoffListener(&handoffListener, l)
+	if err := syscall.Kill(os.Getppid(), syscall.SIGUSR1); err != nil {
+		log.Errorf("cannot signal the previous process %v: %v", os.Getppid(), err)
+	}
+	return Published(l, "ConnCount", "ConnAccepted"), nil
+}
+
+// ListenSecure returns a listener on addr for the secure server, that
+// the caller wraps with TLS. After a socket handoff, it is the
+// listening socket passed by the previous process. Otherwise addr is
+// bound: the previous process releases it before the main port, so it
+// is free once Listen returned.
+func ListenSecure(addr string) (l net.Listener, err error) {
+	if fd := os.Getenv(secureListenFdEnv); fd != "" {
+		os.Setenv(secureListenFdEnv, "")
+		l, err = inheritListener(fd)
+	} else {
+		l, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	setHandoffListener(&secureHandoffListener, l)
+	return l, nil
+}
+
+// handoff starts a new copy of the binary, with the same arguments,
+// and passes it the listening socket.
+func handoff() error {
+	handoffMu.Lock()
+	tl, stl := handoffListener, secureHandoffListener
+	handoffMu.Unlock()
+	if tl == nil {
+		return fmt.Errorf("no listener to hand off")
+	}
+	f, err := tl.File()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// the extra files are fds 3 and up in the new process
+	files := []*os.File{f}
+	env := append(handoffEnv(), listenFdEnv+"=3")
+	if stl != nil {
+		sf, err := stl.File()
+		if err != nil {
+			return err
+		}
+		defer sf.Close()
+		files = append(files, sf)
+		env = append(env, secureListenFdEnv+"=4")
+	}
+
+	binary, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(binary, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = env
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.Infof("started %v (pid %v) to take over the listening socket", binary, cmd.Process.Pid)
+	return cmd.Process.Release()
+}
+
+// handoffEnv returns our environment without the file descriptors we
+// inherited, if any: the new process gets its own.
+func handoffEnv() []string {
+	var env []string
+	for _, v := range os.Environ() {
+		if strings.HasPrefix(v, listenFdEnv+"=") || strings.HasPrefix(v, secureListenFdEnv+"=") {
+			continue
+		}
+		env = append(env, v)
+	}
+	return env
+}
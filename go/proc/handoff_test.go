@@ -0,0 +1,88 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestInheritListener(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("could not initialize listener: %v", err)
+	}
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+	// the original listener is closed, like in the previous process
+	l.Close()
+
+	inherited, err := inheritListener(fmt.Sprintf("%v", f.Fd()))
+	if err != nil {
+		t.Fatalf("inheritListener failed: %v", err)
+	}
+	defer inherited.Close()
+	if inherited.Addr().String() != l.Addr().String() {
+		t.Errorf("inherited listener on %v, want %v", inherited.Addr(), l.Addr())
+	}
+	conn, err := net.Dial("tcp", inherited.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	accepted, err := inherited.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	accepted.Close()
+
+	if _, err := inheritListener("invalid"); err == nil {
+		t.Errorf("inheritListener of an invalid fd should have failed")
+	}
+}
+
+func TestListenSecure(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("could not initialize listener: %v", err)
+	}
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+	l.Close()
+	defer os.Setenv(secureListenFdEnv, "")
+	os.Setenv(secureListenFdEnv, fmt.Sprintf("%v", f.Fd()))
+	inherited, err := ListenSecure("localhost:0")
+	if err != nil {
+		t.Fatalf("ListenSecure failed: %v", err)
+	}
+	defer inherited.Close()
+	if inherited.Addr().String() != l.Addr().String() {
+		t.Errorf("inherited secure listener on %v, want %v", inherited.Addr(), l.Addr())
+	}
+	if os.Getenv(secureListenFdEnv) != "" {
+		t.Errorf("%v should be cleared once inherited", secureListenFdEnv)
+	}
+	handoffMu.Lock()
+	recorded := secureHandoffListener
+	handoffMu.Unlock()
+	if recorded == nil || recorded.Addr().String() != l.Addr().String() {
+		t.Errorf("inherited secure listener is not handed off: %v", recorded)
+	}
+
+	os.Setenv(listenFdEnv, "3")
+	os.Setenv(secureListenFdEnv, "4")
+	defer os.Setenv(listenFdEnv, "")
+	for _, v := range handoffEnv() {
+		if v == listenFdEnv+"=3" || v == secureListenFdEnv+"=4" {
+			t.Errorf("handoffEnv should not pass our inherited fds: %v", v)
+		}
+	}
+}
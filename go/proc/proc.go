@@ -27,8 +27,12 @@ const pidURL = "/debug/pid"
 // Before creating the listener, it checks to see if there is another
 // server already using the port. If there is one, it sends a USR1
 // signal requesting the server to shutdown, and then attempts to
-// to create the listener.
+// to create the listener. If the process was started by a socket
+// handoff (see handoff.go), it uses the inherited listener instead.
 func Listen(port string) (l net.Listener, err error) {
+	if fd := os.Getenv(listenFdEnv); fd != "" {
+		return listenInherited(fd)
+	}
 	killPredecessor(port)
 	return listen(port)
 }
@@ -38,15 +42,25 @@ func Listen(port string) (l net.Listener, err error) {
 // SIGUSR1, and returns when the signal is received. A new server that comes
 // up will query this URL. If it receives a valid response, it will send a
 // SIGUSR1 signal and attempt to bind to the port the current server is using.
+// On SIGUSR2, it hands off the listening socket to a new copy of the
+// binary, and keeps waiting for its SIGUSR1.
 func Wait() os.Signal {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGTERM, syscall.SIGUSR1)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
 
 	http.HandleFunc(pidURL, func(r http.ResponseWriter, req *http.Request) {
 		r.Write(strconv.AppendInt(nil, int64(os.Getpid()), 10))
 	})
 
-	return <-c
+	for {
+		sig := <-c
+		if sig != syscall.SIGUSR2 {
+			return sig
+		}
+		if err := handoff(); err != nil {
+			log.Errorf("socket handoff failed, still serving: %v", err)
+		}
+	}
 }
 
 // ListenAndServe combines Listen and Wait to also run an http
@@ -101,5 +115,9 @@ func listen(port string) (l net.Listener, err error) {
 		}
 		break
 	}
-	return Published(l, "ConnCount", "ConnAccepted"), err
+	if err != nil {
+		return nil, err
+	}
+	setHandoffListener(&handoffListener, l)
+	return Published(l, "ConnCount", "ConnAccepted"), nil
 }
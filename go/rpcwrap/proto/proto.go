@@ -3,4 +3,9 @@ package proto
 type Context struct {
 	RemoteAddr string
 	Username   string
+
+	// CertCommonName and CertOrganizationalUnits describe the
+	// client certificate, when the client used TLS and presented one.
+	CertCommonName          string
+	CertOrganizationalUnits []string
 }
@@ -94,6 +94,19 @@ func dialHTTP(network, address, codecName string, cFactory ClientCodecFactory, a
 	}
 
 	if config != nil {
+		if config.ServerName == "" && !config.InsecureSkipVerify {
+			// verify the server certificate against the host we dialed
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			config = &tls.Config{
+				Certificates: config.Certificates,
+				RootCAs:      config.RootCAs,
+				ServerName:   host,
+			}
+		}
 		conn = tls.Client(conn, config)
 	}
 
@@ -171,7 +184,7 @@ func (h *rpcHandler) ServeHTTP(c http.ResponseWriter, req *http.Request) {
 	}
 	io.WriteString(conn, "HTTP/1.0 "+connected+"\n\n")
 	codec := h.cFactory(NewBufferedConnection(conn))
-	context := &proto.Context{RemoteAddr: req.RemoteAddr}
+	context := newContext(req)
 	if h.useAuth {
 		if authenticated, err := auth.Authenticate(codec, context); !authenticated {
 			if err != nil {
@@ -184,6 +197,18 @@ func (h *rpcHandler) ServeHTTP(c http.ResponseWriter, req *http.Request) {
 	h.ServeCodecWithContext(codec, context)
 }
 
+// newContext returns the context of a request, with the identity of
+// the client certificate if there is one.
+func newContext(req *http.Request) *proto.Context {
+	context := &proto.Context{RemoteAddr: req.RemoteAddr}
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		subject := req.TLS.PeerCertificates[0].Subject
+		context.CertCommonName = subject.CommonName
+		context.CertOrganizationalUnits = subject.OrganizationalUnit
+	}
+	return context
+}
+
 func GetRpcPath(codecName string, auth bool) string {
 	path := "/_" + codecName + "_rpc_"
 	if auth {
@@ -199,7 +224,7 @@ type httpHandler struct {
 func (hh *httpHandler) ServeHTTP(c http.ResponseWriter, req *http.Request) {
 	conn := &httpConnectionBroker{c, req.Body}
 	codec := hh.cFactory(conn)
-	if err := rpc.ServeRequestWithContext(codec, &proto.Context{RemoteAddr: req.RemoteAddr}); err != nil {
+	if err := rpc.ServeRequestWithContext(codec, newContext(req)); err != nil {
 		log.Errorf("rpcwrap: %v", err)
 	}
 }
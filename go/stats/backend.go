@@ -0,0 +1,64 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Backend exports the stats variables using a method other than
+// /debug/vars, for instance to a monitoring system. A backend reads
+// the variables when it needs them, with expvar.Do. Backends register
+// themselves with RegisterBackend, usually in an init() function, and
+// the program enables the ones it wants with StartBackends.
+type Backend interface {
+	// Start is called once, when the backend is enabled.
+	Start() error
+}
+
+var (
+	backendsMu sync.Mutex
+	backends   = make(map[string]Backend)
+)
+
+// RegisterBackend registers a Backend under a name.
+func RegisterBackend(name string, b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, ok := backends[name]; ok {
+		panic(fmt.Errorf("stats backend %v is already registered", name))
+	}
+	backends[name] = b
+}
+
+// BackendNames returns the sorted names of the registered backends.
+func BackendNames() []string {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartBackends starts the given backends.
+func StartBackends(names []string) error {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	for _, name := range names {
+		b, ok := backends[name]
+		if !ok {
+			return fmt.Errorf("unknown stats backend %v", name)
+		}
+		if err := b.Start(); err != nil {
+			return fmt.Errorf("cannot start stats backend %v: %v", name, err)
+		}
+	}
+	return nil
+}
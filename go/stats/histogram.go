@@ -105,6 +105,21 @@ func (h *Histogram) Counts() map[string]int64 {
 	return counts
 }
 
+// Cutoffs returns the cutoffs of the buckets.
+func (h *Histogram) Cutoffs() []int64 {
+	return h.cutoffs
+}
+
+// Buckets returns the counts of each bucket. There is one more bucket
+// than cutoffs, for the values higher than the last cutoff.
+func (h *Histogram) Buckets() []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	buckets := make([]int64, len(h.buckets))
+	copy(buckets, h.buckets)
+	return buckets
+}
+
 func (h *Histogram) CountLabel() string {
 	return h.countLabel
 }
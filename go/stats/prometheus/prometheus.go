@@ -0,0 +1,198 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package prometheus is a stats backend that exports the stats
+// variables on /metrics, in the Prometheus text format:
+//   - Int, Float, Duration and their Func variants are gauges
+//     (durations are in seconds).
+//   - Counters are counters, with one 'key' label per entry.
+//   - Matrix variables are gauges, with the two matrix labels.
+//   - Histograms are histograms, and Timings are histograms in
+//     seconds with one 'category' label per entry.
+//   - States are gauges of the current state.
+//
+// Other variables are not exported.
+package prometheus
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+)
+
+type backend struct{}
+
+func init() {
+	stats.RegisterBackend("prometheus", backend{})
+}
+
+func (backend) Start() error {
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+	return nil
+}
+
+// writeMetrics writes all the supported stats variables to w.
+func writeMetrics(w io.Writer) {
+	vars := make(map[string]expvar.Var)
+	names := make([]string, 0, 64)
+	expvar.Do(func(kv expvar.KeyValue) {
+		vars[kv.Key] = kv.Value
+		names = append(names, kv.Key)
+	})
+	sort.Strings(names)
+
+	b := bufio.NewWriter(w)
+	for _, name := range names {
+		writeVar(b, metricName(name), vars[name])
+	}
+	b.Flush()
+}
+
+func writeVar(w io.Writer, name string, v expvar.Var) {
+	switch v := v.(type) {
+	case *stats.Int:
+		writeGauge(w, name, float64(v.Get()))
+	case stats.IntFunc:
+		writeGauge(w, name, float64(v()))
+	case *expvar.Int:
+		writeGauge(w, name, float64(v.Value()))
+	case *stats.Float:
+		writeGauge(w, name, v.Get())
+	case stats.FloatFunc:
+		writeGauge(w, name, v())
+	case *expvar.Float:
+		writeGauge(w, name, v.Value())
+	case *stats.Duration:
+		writeGauge(w, name, v.Get().Seconds())
+	case stats.DurationFunc:
+		writeGauge(w, name, v().Seconds())
+	case *stats.States:
+		writeGauge(w, name, float64(v.Get()))
+	case *stats.Counters:
+		writeCounts(w, name, "counter", v.Counts())
+	case stats.CountersFunc:
+		writeCounts(w, name, "gauge", v.Counts())
+	case stats.MatrixType:
+		writeMatrix(w, name, v)
+	case *stats.Histogram:
+		fmt.Fprintf(w, "# TYPE %v histogram\n", name)
+		writeHistogram(w, name, "", v, 1)
+	case *stats.Timings:
+		fmt.Fprintf(w, "# TYPE %v histogram\n", name)
+		histograms := v.Histograms()
+		categories := make([]string, 0, len(histograms))
+		for category := range histograms {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		for _, category := range categories {
+			writeHistogram(w, name, label("category", category), histograms[category], float64(time.Second))
+		}
+	}
+}
+
+func writeGauge(w io.Writer, name string, value float64) {
+	fmt.Fprintf(w, "# TYPE %v gauge\n%v %v\n", name, name, formatValue(value))
+}
+
+func writeCounts(w io.Writer, name, metricType string, counts map[string]int64) {
+	fmt.Fprintf(w, "# TYPE %v %v\n", name, metricType)
+	for _, key := range sortedKeys(counts) {
+		fmt.Fprintf(w, "%v{%v} %v\n", name, label("key", key), counts[key])
+	}
+}
+
+func writeMatrix(w io.Writer, name string, m stats.MatrixType) {
+	fmt.Fprintf(w, "# TYPE %v gauge\n", name)
+	labelX, labelY := labelName(m.LabelX()), labelName(m.LabelY())
+	data := m.Data()
+	xs := make([]string, 0, len(data))
+	for x := range data {
+		xs = append(xs, x)
+	}
+	sort.Strings(xs)
+	for _, x := range xs {
+		for _, y := range sortedKeys(data[x]) {
+			fmt.Fprintf(w, "%v{%v,%v} %v\n", name, label(labelX, x), label(labelY, y), data[x][y])
+		}
+	}
+}
+
+// writeHistogram writes the cumulative buckets of a histogram. The
+// values are divided by 'unit'. labels are added to every line.
+func writeHistogram(w io.Writer, name, labels string, h *stats.Histogram, unit float64) {
+	prefix := ""
+	if labels != "" {
+		prefix = labels + ","
+	}
+	cutoffs := h.Cutoffs()
+	buckets := h.Buckets()
+	count := int64(0)
+	for i, cutoff := range cutoffs {
+		count += buckets[i]
+		fmt.Fprintf(w, "%v_bucket{%vle=\"%v\"} %v\n", name, prefix, formatValue(float64(cutoff)/unit), count)
+	}
+	count += buckets[len(buckets)-1]
+	fmt.Fprintf(w, "%v_bucket{%vle=\"+Inf\"} %v\n", name, prefix, count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%v_sum%v %v\n", name, labels, formatValue(float64(h.Total())/unit))
+	fmt.Fprintf(w, "%v_count%v %v\n", name, labels, count)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricName converts a stats variable name to a valid metric name.
+func metricName(name string) string {
+	return sanitize(name, true)
+}
+
+// labelName converts a matrix label to a valid label name.
+func labelName(name string) string {
+	return strings.ToLower(sanitize(name, false))
+}
+
+func sanitize(name string, allowColon bool) string {
+	result := []byte(name)
+	for i, c := range result {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		case c == ':' && allowColon:
+		default:
+			result[i] = '_'
+		}
+	}
+	return string(result)
+}
+
+func label(name, value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+	return fmt.Sprintf("%v=\"%v\"", name, value)
+}
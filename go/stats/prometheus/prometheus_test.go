@@ -0,0 +1,65 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	stats.NewInt("PromInt").Set(12)
+	stats.Publish("PromDuration", stats.DurationFunc(func() time.Duration { return 1500 * time.Millisecond }))
+	c := stats.NewCounters("PromCounters")
+	c.Add("a\"b", 2)
+	m := stats.NewMatrix("PromMatrix", "Table", "Plan")
+	m.Add("t1", "PASS_SELECT", 3)
+	h := stats.NewHistogram("PromHistogram", []int64{1, 5})
+	h.Add(1)
+	h.Add(3)
+	h.Add(10)
+	tm := stats.NewTimings("PromTimings")
+	tm.Add("Select", 2*time.Millisecond)
+
+	b := &bytes.Buffer{}
+	writeMetrics(b)
+	got := b.String()
+	for _, want := range []string{
+		"# TYPE PromInt gauge\nPromInt 12\n",
+		"PromDuration 1.5\n",
+		"# TYPE PromCounters counter\nPromCounters{key=\"a\\\"b\"} 2\n",
+		"PromMatrix{table=\"t1\",plan=\"PASS_SELECT\"} 3\n",
+		"# TYPE PromHistogram histogram\n" +
+			"PromHistogram_bucket{le=\"1\"} 1\n" +
+			"PromHistogram_bucket{le=\"5\"} 2\n" +
+			"PromHistogram_bucket{le=\"+Inf\"} 3\n" +
+			"PromHistogram_sum 14\n" +
+			"PromHistogram_count 3\n",
+		"PromTimings_bucket{category=\"Select\",le=\"0.005\"} 1\n",
+		"PromTimings_sum{category=\"Select\"} 0.002\n",
+		"PromTimings_count{category=\"Select\"} 1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in output:\n%v", want, got)
+		}
+	}
+}
+
+func TestMetricName(t *testing.T) {
+	for in, want := range map[string]string{
+		"Queries":         "Queries",
+		"ZkCachedConn.a":  "ZkCachedConn_a",
+		"2xx-responses":   "_xx_responses",
+		"ns:subsystem_ok": "ns:subsystem_ok",
+	} {
+		if got := metricName(in); got != want {
+			t.Errorf("metricName(%v) = %v, want %v", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package push
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+)
+
+func init() {
+	stats.RegisterBackend("graphite", &pushBackend{name: "graphite", format: formatGraphite})
+}
+
+// formatGraphite uses the Graphite plaintext protocol:
+//
+//	<path> <value> <timestamp>
+//
+// Graphite has no tags, so the tag values are part of the path. The
+// global tags (sorted by name) come first, then the variable name,
+// then the values of its own tags, for instance:
+//
+//	vitess.cell1.test_keyspace.Queries.PASS_SELECT.count
+func formatGraphite(w io.Writer, prefix string, globals map[string]string, points []point, now time.Time) {
+	timestamp := now.Unix()
+	for _, p := range points {
+		var components []string
+		if prefix != "" {
+			components = append(components, graphiteComponent(prefix))
+		}
+		for _, tag := range sortedTagNames(globals) {
+			components = append(components, graphiteComponent(globals[tag]))
+		}
+
+		// the histogram suffixes go at the end
+		name, suffix := p.name, ""
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name, suffix = name[:i], name[i+1:]
+		}
+		components = append(components, graphiteComponent(name))
+		for _, tag := range sortedTagNames(p.tags) {
+			if _, ok := globals[tag]; ok {
+				continue
+			}
+			components = append(components, graphiteComponent(p.tags[tag]))
+		}
+		if suffix != "" {
+			components = append(components, suffix)
+		}
+		fmt.Fprintf(w, "%v %v %v\n", strings.Join(components, "."), strconv.FormatFloat(p.value, 'g', -1, 64), timestamp)
+	}
+}
+
+// graphiteComponent replaces the characters that cannot be in a
+// Graphite path component.
+func graphiteComponent(value string) string {
+	result := []byte(value)
+	for i, c := range result {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_':
+		default:
+			result[i] = '_'
+		}
+	}
+	return string(result)
+}
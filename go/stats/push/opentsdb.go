@@ -0,0 +1,56 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package push
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+)
+
+func init() {
+	stats.RegisterBackend("opentsdb", &pushBackend{name: "opentsdb", format: formatOpenTSDB})
+}
+
+// formatOpenTSDB uses the OpenTSDB telnet protocol:
+//
+//	put <prefix>.<name> <timestamp> <value> <tag>=<value> ...
+//
+// OpenTSDB requires at least one tag, so a 'host' tag is always added.
+func formatOpenTSDB(w io.Writer, prefix string, globals map[string]string, points []point, now time.Time) {
+	timestamp := now.Unix()
+	for _, p := range points {
+		name := openTSDBName(p.name)
+		if prefix != "" {
+			name = openTSDBName(prefix) + "." + name
+		}
+		fmt.Fprintf(w, "put %v %v %v", name, timestamp, strconv.FormatFloat(p.value, 'g', -1, 64))
+		if _, ok := p.tags["host"]; !ok {
+			fmt.Fprintf(w, " host=%v", openTSDBName(hostname))
+		}
+		for _, tag := range sortedTagNames(p.tags) {
+			fmt.Fprintf(w, " %v=%v", openTSDBName(tag), openTSDBName(p.tags[tag]))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// openTSDBName replaces the characters OpenTSDB doesn't accept in
+// metric names and tags.
+func openTSDBName(name string) string {
+	result := []byte(name)
+	for i, c := range result {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == '/':
+		default:
+			result[i] = '_'
+		}
+	}
+	return string(result)
+}
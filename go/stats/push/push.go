@@ -0,0 +1,240 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package push contains the stats backends that periodically send
+// all the stats variables to a monitoring system: 'opentsdb' and
+// 'graphite'. Each data point is tagged with the -stats-push-tags,
+// and the tags set by the program with SetTag (vttablet sets the
+// cell, keyspace, shard and tablet_type tags for instance).
+//
+// The variables are flattened like this:
+//   - Int, Float, Duration and their Func variants are one point
+//     (durations are in seconds).
+//   - Counters have one point per entry, with a 'key' tag.
+//   - Matrix variables have one point per cell, tagged with the
+//     two matrix labels.
+//   - Histograms have a '.count' and a '.total' point, and Timings
+//     have the same per category, with a 'category' tag.
+//   - States are a point with the current state.
+package push
+
+import (
+	"expvar"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+)
+
+var (
+	pushAddr     = flag.String("stats-push-addr", "", "host:port of the OpenTSDB or Graphite server the stats are pushed to")
+	pushInterval = flag.Duration("stats-push-interval", time.Minute, "how often the stats are pushed")
+	pushPrefix   = flag.String("stats-push-prefix", "vitess", "prefix of the pushed metric names")
+	pushTags     = flag.String("stats-push-tags", "", "comma separated list of tag=value added to all the pushed points")
+)
+
+const pushTimeout = 30 * time.Second
+
+var (
+	pushCount  = stats.NewCounters("StatsPushCount")
+	pushErrors = stats.NewCounters("StatsPushErrors")
+)
+
+var (
+	tagsMu sync.Mutex
+	tags   = make(map[string]string)
+)
+
+// SetTag sets a tag added to all the pushed points. An empty value
+// removes the tag.
+func SetTag(name, value string) {
+	tagsMu.Lock()
+	defer tagsMu.Unlock()
+	if value == "" {
+		delete(tags, name)
+	} else {
+		tags[name] = value
+	}
+}
+
+func globalTags() map[string]string {
+	tagsMu.Lock()
+	defer tagsMu.Unlock()
+	result := make(map[string]string, len(tags))
+	for k, v := range tags {
+		result[k] = v
+	}
+	return result
+}
+
+// point is one flattened value.
+type point struct {
+	name  string
+	tags  map[string]string
+	value float64
+}
+
+// formatter writes points in the format of a monitoring system.
+type formatter func(w io.Writer, prefix string, globals map[string]string, points []point, now time.Time)
+
+// pushBackend is a stats.Backend that pushes all the points every
+// -stats-push-interval.
+type pushBackend struct {
+	name   string
+	format formatter
+}
+
+func (pb *pushBackend) Start() error {
+	if *pushAddr == "" {
+		return fmt.Errorf("-stats-push-addr is required")
+	}
+	if *pushTags != "" {
+		for _, tag := range strings.Split(*pushTags, ",") {
+			parts := strings.SplitN(tag, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid -stats-push-tags entry: %v", tag)
+			}
+			SetTag(parts[0], parts[1])
+		}
+	}
+	go func() {
+		for {
+			time.Sleep(*pushInterval)
+			if err := pb.push(); err != nil {
+				log.Warningf("cannot push stats to %v %v: %v", pb.name, *pushAddr, err)
+				pushErrors.Add(pb.name, 1)
+			} else {
+				pushCount.Add(pb.name, 1)
+			}
+		}
+	}()
+	return nil
+}
+
+func (pb *pushBackend) push() error {
+	conn, err := net.DialTimeout("tcp", *pushAddr, pushTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(pushTimeout))
+	return pb.write(conn, time.Now())
+}
+
+// write formats all the points to w. It only returns the write errors.
+func (pb *pushBackend) write(w io.Writer, now time.Time) error {
+	ew := &errWriter{w: w}
+	globals := globalTags()
+	pb.format(ew, *pushPrefix, globals, collect(globals), now)
+	return ew.err
+}
+
+// errWriter remembers the first write error, and ignores the
+// following writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	var n int
+	n, ew.err = ew.w.Write(p)
+	return n, ew.err
+}
+
+// collect flattens all the supported stats variables. globals are
+// added to the tags of every point.
+func collect(globals map[string]string) []point {
+	var points []point
+	add := func(name string, value float64, kv ...string) {
+		t := make(map[string]string, len(globals)+len(kv)/2)
+		for k, v := range globals {
+			t[k] = v
+		}
+		for i := 0; i < len(kv); i += 2 {
+			t[kv[i]] = kv[i+1]
+		}
+		points = append(points, point{name: name, tags: t, value: value})
+	}
+	addHistogram := func(name string, h *stats.Histogram, unit float64, kv ...string) {
+		add(name+".count", float64(h.Count()), kv...)
+		add(name+".total", float64(h.Total())/unit, kv...)
+	}
+
+	expvar.Do(func(kv expvar.KeyValue) {
+		name := kv.Key
+		switch v := kv.Value.(type) {
+		case *stats.Int:
+			add(name, float64(v.Get()))
+		case stats.IntFunc:
+			add(name, float64(v()))
+		case *expvar.Int:
+			add(name, float64(v.Value()))
+		case *stats.Float:
+			add(name, v.Get())
+		case stats.FloatFunc:
+			add(name, v())
+		case *expvar.Float:
+			add(name, v.Value())
+		case *stats.Duration:
+			add(name, v.Get().Seconds())
+		case stats.DurationFunc:
+			add(name, v().Seconds())
+		case *stats.States:
+			add(name, float64(v.Get()))
+		case *stats.Counters:
+			for key, count := range v.Counts() {
+				add(name, float64(count), "key", key)
+			}
+		case stats.CountersFunc:
+			for key, count := range v.Counts() {
+				add(name, float64(count), "key", key)
+			}
+		case stats.MatrixType:
+			labelX, labelY := strings.ToLower(v.LabelX()), strings.ToLower(v.LabelY())
+			for x, row := range v.Data() {
+				for y, count := range row {
+					add(name, float64(count), labelX, x, labelY, y)
+				}
+			}
+		case *stats.Histogram:
+			addHistogram(name, v, 1)
+		case *stats.Timings:
+			for category, h := range v.Histograms() {
+				addHistogram(name, h, float64(time.Second), "category", category)
+			}
+		}
+	})
+	return points
+}
+
+// sortedTagNames returns the tag names of a point in a stable order.
+func sortedTagNames(t map[string]string) []string {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hostname is the default 'host' tag
+var hostname = func() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return h
+}()
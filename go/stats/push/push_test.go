@@ -0,0 +1,74 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package push
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+)
+
+var testTime = time.Unix(1380000000, 0)
+
+func testPoints() (map[string]string, []point) {
+	globals := map[string]string{"cell": "nyc", "keyspace": "test_keyspace"}
+	return globals, []point{
+		{name: "Queries.count", tags: map[string]string{"cell": "nyc", "keyspace": "test_keyspace", "category": "PASS_SELECT"}, value: 12},
+		{name: "ConnPoolAvailable", tags: map[string]string{"cell": "nyc", "keyspace": "test_keyspace"}, value: 1.5},
+	}
+}
+
+func TestFormatOpenTSDB(t *testing.T) {
+	globals, points := testPoints()
+	b := &bytes.Buffer{}
+	formatOpenTSDB(b, "vitess", globals, points, testTime)
+	host := openTSDBName(hostname)
+	want := "put vitess.Queries.count 1380000000 12 host=" + host + " category=PASS_SELECT cell=nyc keyspace=test_keyspace\n" +
+		"put vitess.ConnPoolAvailable 1380000000 1.5 host=" + host + " cell=nyc keyspace=test_keyspace\n"
+	if got := b.String(); got != want {
+		t.Errorf("formatOpenTSDB:\ngot:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestFormatGraphite(t *testing.T) {
+	globals, points := testPoints()
+	b := &bytes.Buffer{}
+	formatGraphite(b, "vitess", globals, points, testTime)
+	want := "vitess.nyc.test_keyspace.Queries.PASS_SELECT.count 12 1380000000\n" +
+		"vitess.nyc.test_keyspace.ConnPoolAvailable 1.5 1380000000\n"
+	if got := b.String(); got != want {
+		t.Errorf("formatGraphite:\ngot:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	c := stats.NewCounters("PushCounters")
+	c.Add("a", 3)
+	tm := stats.NewTimings("PushTimings")
+	tm.Add("Select", 2*time.Second)
+
+	found := 0
+	for _, p := range collect(map[string]string{"cell": "nyc"}) {
+		if p.tags["cell"] != "nyc" {
+			t.Errorf("missing global tag: %v", p)
+		}
+		switch {
+		case p.name == "PushCounters" && p.tags["key"] == "a" && p.value == 3:
+			found++
+		case p.name == "PushTimings.count" && p.tags["category"] == "Select" && p.value == 1:
+			found++
+		case p.name == "PushTimings.total" && p.tags["category"] == "Select" && p.value == 2:
+			found++
+		case strings.HasPrefix(p.name, "Push"):
+			t.Errorf("unexpected point: %v", p)
+		}
+	}
+	if found != 3 {
+		t.Errorf("collect found %v of the 3 expected points", found)
+	}
+}
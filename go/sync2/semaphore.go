@@ -47,6 +47,17 @@ func (sem *Semaphore) Acquire() bool {
 	}
 }
 
+// TryAcquire acquires a semaphore if one is available right away,
+// and returns false otherwise.
+func (sem *Semaphore) TryAcquire() bool {
+	select {
+	case <-sem.slots:
+		return true
+	default:
+		return false
+	}
+}
+
 // Release releases the acquired semaphore. You must
 // not release more than the number of semaphores you've
 // acquired.
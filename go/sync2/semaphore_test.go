@@ -39,3 +39,17 @@ func TestSemaTimeout(t *testing.T) {
 		t.Errorf("want true, got false")
 	}
 }
+
+func TestSemaTryAcquire(t *testing.T) {
+	s := NewSemaphore(1, 0)
+	if !s.TryAcquire() {
+		t.Errorf("want true, got false")
+	}
+	if s.TryAcquire() {
+		t.Errorf("want false, got true")
+	}
+	s.Release()
+	if !s.TryAcquire() {
+		t.Errorf("want true, got false")
+	}
+}
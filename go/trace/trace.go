@@ -0,0 +1,258 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package trace records spans of work across processes, to see where
+// a slow request spent its time.
+//
+// The span context is propagated with the SQL statements themselves,
+// as a trailing comment: /* trace:<trace id>:<span id> */. vttablet
+// already keeps the trailing comments of a query out of its plan
+// cache and sends them to MySQL, so the comment reaches every tier,
+// including the MySQL logs. A client starts a trace by adding that
+// comment to its query, and each tier replaces it with the context of
+// its own span.
+//
+// Finished spans are sent to the Recorder selected with
+// -trace-recorder. If no recorder is selected, no span is created.
+package trace
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+var (
+	recorderName = flag.String("trace-recorder", "", "where to send the finished trace spans ('log'), tracing is disabled if empty")
+	sampleRate   = flag.Float64("trace-sample-rate", 1.0, "fraction of the requests without a trace context that start a new trace")
+)
+
+// SpanContext identifies a span across processes.
+type SpanContext struct {
+	TraceId uint64
+	SpanId  uint64
+}
+
+// IsZero returns true if the context doesn't identify a span.
+func (sc SpanContext) IsZero() bool {
+	return sc.TraceId == 0
+}
+
+func (sc SpanContext) String() string {
+	return fmt.Sprintf("%016x:%016x", sc.TraceId, sc.SpanId)
+}
+
+// Comment returns the SQL comment that carries the context.
+func (sc SpanContext) Comment() string {
+	return "/* trace:" + sc.String() + " */"
+}
+
+var commentRegexp = regexp.MustCompile(`/\* trace:([0-9a-f]{16}):([0-9a-f]{16}) \*/`)
+
+// ParseComment finds the span context in the comments of a SQL
+// statement. It returns the zero SpanContext if there is none.
+func ParseComment(sql string) SpanContext {
+	m := commentRegexp.FindStringSubmatch(sql)
+	if m == nil {
+		return SpanContext{}
+	}
+	traceId, err1 := strconv.ParseUint(m[1], 16, 64)
+	spanId, err2 := strconv.ParseUint(m[2], 16, 64)
+	if err1 != nil || err2 != nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceId: traceId, SpanId: spanId}
+}
+
+// ReplaceComment sets the span context comment of a SQL statement,
+// replacing the existing one, or adding it at the end.
+func ReplaceComment(sql string, sc SpanContext) string {
+	if commentRegexp.MatchString(sql) {
+		return commentRegexp.ReplaceAllLiteralString(sql, sc.Comment())
+	}
+	return sql + " " + sc.Comment()
+}
+
+// Span is a unit of work. A nil *Span is valid, and does nothing:
+// it is returned when tracing is disabled or the request is not
+// traced.
+type Span struct {
+	Name        string
+	Context     SpanContext
+	ParentId    uint64
+	Start       time.Time
+	End         time.Time
+	Annotations map[string]string
+
+	mu sync.Mutex
+}
+
+// Recorder receives the finished spans. It has to be thread-safe.
+type Recorder interface {
+	Record(span *Span)
+}
+
+var (
+	recordersMu sync.Mutex
+	recorders   = make(map[string]Recorder)
+	recorder    Recorder
+	initOnce    sync.Once
+)
+
+// RegisterRecorder registers a Recorder under a name, to be selected
+// with -trace-recorder.
+func RegisterRecorder(name string, r Recorder) {
+	recordersMu.Lock()
+	defer recordersMu.Unlock()
+	if _, ok := recorders[name]; ok {
+		log.Fatalf("trace recorder %v already exists", name)
+	}
+	recorders[name] = r
+}
+
+// currentRecorder returns the selected Recorder, or nil.
+func currentRecorder() Recorder {
+	initOnce.Do(func() {
+		if *recorderName == "" {
+			return
+		}
+		recordersMu.Lock()
+		defer recordersMu.Unlock()
+		r, ok := recorders[*recorderName]
+		if !ok {
+			log.Errorf("unknown trace recorder %v, tracing is disabled", *recorderName)
+			return
+		}
+		recorder = r
+	})
+	return recorder
+}
+
+// Enabled returns true if spans are recorded.
+func Enabled() bool {
+	return currentRecorder() != nil
+}
+
+// StartSqlSpan starts a span for the processing of a SQL statement,
+// as a child of the span in its comment. If there is no such comment
+// and root is set, the span starts a new trace. It returns the span
+// and the statement carrying the context of the new span. If no span
+// is started, sql is returned unchanged.
+func StartSqlSpan(name, sql string, root bool) (*Span, string) {
+	if !Enabled() {
+		return nil, sql
+	}
+	parent := ParseComment(sql)
+	var span *Span
+	if parent.IsZero() && root {
+		span = NewRootSpan(name)
+	} else {
+		span = NewChildSpan(parent, name)
+	}
+	if span == nil {
+		return nil, sql
+	}
+	return span, ReplaceComment(sql, span.Context)
+}
+
+// NewRootSpan starts a new trace, if tracing is enabled and the
+// request is sampled.
+func NewRootSpan(name string) *Span {
+	if currentRecorder() == nil || rand.Float64() >= *sampleRate {
+		return nil
+	}
+	return newSpan(name, SpanContext{TraceId: newId()}, 0)
+}
+
+// NewChildSpan starts a span in the trace of parent. It returns nil
+// if parent is the zero SpanContext.
+func NewChildSpan(parent SpanContext, name string) *Span {
+	if parent.IsZero() || currentRecorder() == nil {
+		return nil
+	}
+	return newSpan(name, SpanContext{TraceId: parent.TraceId}, parent.SpanId)
+}
+
+// NewSpan is NewChildSpan if parent is set, and NewRootSpan otherwise.
+func NewSpan(parent SpanContext, name string) *Span {
+	if parent.IsZero() {
+		return NewRootSpan(name)
+	}
+	return NewChildSpan(parent, name)
+}
+
+func newSpan(name string, sc SpanContext, parentId uint64) *Span {
+	sc.SpanId = newId()
+	return &Span{
+		Name:        name,
+		Context:     sc,
+		ParentId:    parentId,
+		Start:       time.Now(),
+		Annotations: make(map[string]string),
+	}
+}
+
+func newId() uint64 {
+	for {
+		if id := uint64(rand.Int63())<<1 | uint64(rand.Int63()&1); id != 0 {
+			return id
+		}
+	}
+}
+
+// SpanContext returns the context of the span, or the zero
+// SpanContext for a nil span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.Context
+}
+
+// Annotate adds a key/value annotation to the span.
+func (s *Span) Annotate(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Annotations[key] = fmt.Sprintf("%v", value)
+}
+
+// Finish ends the span and records it.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.End = time.Now()
+	s.mu.Unlock()
+	if r := currentRecorder(); r != nil {
+		r.Record(s)
+	}
+}
+
+// Duration returns how long the span lasted.
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// logRecorder logs the finished spans.
+type logRecorder struct{}
+
+func (logRecorder) Record(s *Span) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log.Infof("trace span %v parent=%016x %v %v %v", s.Context, s.ParentId, s.Name, s.Duration(), s.Annotations)
+}
+
+func init() {
+	RegisterRecorder("log", logRecorder{})
+}
@@ -0,0 +1,89 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"sync"
+	"testing"
+)
+
+type memoryRecorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (mr *memoryRecorder) Record(s *Span) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.spans = append(mr.spans, s)
+}
+
+var testRecorder = &memoryRecorder{}
+
+func init() {
+	RegisterRecorder("test", testRecorder)
+	*recorderName = "test"
+}
+
+func TestComment(t *testing.T) {
+	sc := SpanContext{TraceId: 0x1234, SpanId: 0xabcd}
+	sql := "select * from t " + sc.Comment()
+	if got := ParseComment(sql); got != sc {
+		t.Errorf("ParseComment(%v) = %v, want %v", sql, got, sc)
+	}
+	if got := ParseComment("select 1 /* other */"); !got.IsZero() {
+		t.Errorf("ParseComment without trace = %v", got)
+	}
+
+	other := SpanContext{TraceId: 0x1234, SpanId: 0xef}
+	want := "select * from t /* trace:0000000000001234:00000000000000ef */"
+	if got := ReplaceComment(sql, other); got != want {
+		t.Errorf("ReplaceComment = %v, want %v", got, want)
+	}
+	if got := ReplaceComment("select * from t", other); got != want {
+		t.Errorf("ReplaceComment = %v, want %v", got, want)
+	}
+}
+
+func TestSqlSpans(t *testing.T) {
+	// no trace context and not a root: nothing happens
+	span, sql := StartSqlSpan("child", "select 1", false)
+	if span != nil || sql != "select 1" {
+		t.Errorf("StartSqlSpan without context: %v %v", span, sql)
+	}
+
+	root, sql := StartSqlSpan("root", "select 1", true)
+	if root == nil {
+		t.Fatalf("StartSqlSpan didn't start a root span")
+	}
+	child, sql := StartSqlSpan("child", sql, false)
+	if child == nil {
+		t.Fatalf("StartSqlSpan didn't start a child span")
+	}
+	if child.Context.TraceId != root.Context.TraceId || child.ParentId != root.Context.SpanId {
+		t.Errorf("bad child span %v for root %v", child.Context, root.Context)
+	}
+	if ParseComment(sql) != child.Context {
+		t.Errorf("sql %v doesn't carry the child context %v", sql, child.Context)
+	}
+	child.Annotate("shard", "-80")
+	child.Finish()
+	root.Finish()
+
+	if len(testRecorder.spans) != 2 || testRecorder.spans[0] != child || testRecorder.spans[1] != root {
+		t.Errorf("bad recorded spans: %v", testRecorder.spans)
+	}
+	if child.Annotations["shard"] != "-80" {
+		t.Errorf("missing annotation: %v", child.Annotations)
+	}
+
+	// a nil span is a no-op
+	var s *Span
+	s.Annotate("a", 1)
+	s.Finish()
+	if !s.SpanContext().IsZero() {
+		t.Errorf("nil span has a context")
+	}
+}
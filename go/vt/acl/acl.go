@@ -0,0 +1,144 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package acl maps the callers to vitess roles, using the subject of
+// their TLS client certificate, so access can be granted by role
+// instead of by IP address.
+//
+// The mapping is a JSON file given with -role-mapping, whose keys
+// are 'cn:<common name>' or 'ou:<organizational unit>', and values
+// are role names, for instance:
+//
+//	{"cn:vtctld": "dba", "ou:frontend": "app", "ou:prober": "monitoring"}
+//
+// A common name mapping takes precedence over the organizational
+// units. When no mapping is configured, roles are not enforced.
+package acl
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	log "github.com/golang/glog"
+	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+)
+
+// The vitess roles.
+const (
+	APP        = "app"
+	DBA        = "dba"
+	MONITORING = "monitoring"
+)
+
+var roleMappingFile = flag.String("role-mapping", "", "JSON file mapping client certificate subjects ('cn:<name>' or 'ou:<unit>') to roles (app, dba, monitoring), if empty roles are not enforced")
+
+var (
+	mappingOnce sync.Once
+	mapping     map[string]string
+)
+
+func loadMapping() {
+	if *roleMappingFile == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(*roleMappingFile)
+	if err != nil {
+		log.Fatalf("cannot read role mapping: %v", err)
+	}
+	m, err := parseMapping(data)
+	if err != nil {
+		log.Fatalf("cannot parse role mapping %v: %v", *roleMappingFile, err)
+	}
+	mapping = m
+}
+
+func parseMapping(data []byte) (map[string]string, error) {
+	m := make(map[string]string)
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	for subject, role := range m {
+		switch role {
+		case APP, DBA, MONITORING:
+		default:
+			return nil, fmt.Errorf("unknown role %v for %v", role, subject)
+		}
+	}
+	return m, nil
+}
+
+// SetMapping replaces the role mapping. A nil mapping disables role
+// enforcement. It is meant for tests.
+func SetMapping(m map[string]string) {
+	mappingOnce.Do(func() {})
+	mapping = m
+}
+
+// Enabled returns true if roles are enforced.
+func Enabled() bool {
+	mappingOnce.Do(loadMapping)
+	return mapping != nil
+}
+
+// Role returns the role of the certificate subject, and false if it
+// doesn't have one.
+func Role(commonName string, organizationalUnits []string) (string, bool) {
+	mappingOnce.Do(loadMapping)
+	if role, ok := mapping["cn:"+commonName]; ok && commonName != "" {
+		return role, true
+	}
+	for _, ou := range organizationalUnits {
+		if role, ok := mapping["ou:"+ou]; ok {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// RoleFromContext returns the role of the caller of an RPC.
+func RoleFromContext(context *rpcproto.Context) (string, bool) {
+	if context == nil {
+		return "", false
+	}
+	return Role(context.CertCommonName, context.CertOrganizationalUnits)
+}
+
+// RoleFromRequest returns the role of the caller of an HTTP request.
+func RoleFromRequest(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return "", false
+	}
+	subject := r.TLS.PeerCertificates[0].Subject
+	return Role(subject.CommonName, subject.OrganizationalUnit)
+}
+
+// Allowed returns true if role is one of the allowed roles.
+func Allowed(role string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == role {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHTTP returns an error if roles are enforced and the caller of
+// the request doesn't have one of the allowed roles.
+func CheckHTTP(r *http.Request, allowed ...string) error {
+	if !Enabled() {
+		return nil
+	}
+	role, ok := RoleFromRequest(r)
+	if !ok {
+		return fmt.Errorf("access denied: no role for caller %v", r.RemoteAddr)
+	}
+	if !Allowed(role, allowed) {
+		return fmt.Errorf("access denied: role %v of caller %v is not one of %v", role, r.RemoteAddr, allowed)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"testing"
+)
+
+func TestParseMapping(t *testing.T) {
+	if _, err := parseMapping([]byte(`{"cn:vtctld": "dba", "ou:frontend": "app"}`)); err != nil {
+		t.Errorf("parseMapping: %v", err)
+	}
+	if _, err := parseMapping([]byte(`{"cn:vtctld": "root"}`)); err == nil {
+		t.Errorf("parseMapping should have failed with an unknown role")
+	}
+}
+
+func requestFrom(cn string, ous ...string) *http.Request {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn, OrganizationalUnit: ous}}
+	return &http.Request{
+		RemoteAddr: "1.2.3.4:5",
+		TLS:        &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+	}
+}
+
+func TestRoles(t *testing.T) {
+	defer SetMapping(nil)
+	SetMapping(nil)
+	if err := CheckHTTP(&http.Request{}, DBA); err != nil {
+		t.Errorf("roles should not be enforced without a mapping: %v", err)
+	}
+
+	SetMapping(map[string]string{"cn:vtctld": DBA, "ou:frontend": APP, "ou:prober": MONITORING})
+	cases := []struct {
+		cn   string
+		ous  []string
+		role string
+	}{
+		{"vtctld", []string{"frontend"}, DBA},
+		{"web1", []string{"other", "frontend"}, APP},
+		{"web1", []string{"other"}, ""},
+		{"", []string{"prober"}, MONITORING},
+	}
+	for _, c := range cases {
+		role, ok := Role(c.cn, c.ous)
+		if role != c.role || ok != (c.role != "") {
+			t.Errorf("Role(%v, %v): want %v, got %v %v", c.cn, c.ous, c.role, role, ok)
+		}
+	}
+
+	if err := CheckHTTP(requestFrom("vtctld"), DBA); err != nil {
+		t.Errorf("dba should be allowed: %v", err)
+	}
+	if err := CheckHTTP(requestFrom("web1", "frontend"), DBA); err == nil {
+		t.Errorf("app should not be allowed")
+	}
+	if err := CheckHTTP(&http.Request{}, DBA); err == nil {
+		t.Errorf("a caller without certificate should not be allowed")
+	}
+}
@@ -9,11 +9,13 @@
 package tablet
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/youtube/vitess/go/db"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
@@ -21,6 +23,7 @@ import (
 	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
 	"github.com/youtube/vitess/go/sqltypes"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/vttls"
 )
 
 var (
@@ -72,14 +75,25 @@ func (conn *Conn) shard() string {
 }
 
 // parseDbi parses the dbi and a URL. The dbi may or may not contain
-// the scheme part.
+// the scheme part. The 'vttps' scheme connects using TLS, with the
+// optional 'cert', 'key' and 'ca' query parameters.
 func parseDbi(dbi string) (*url.URL, error) {
-	if !strings.HasPrefix(dbi, "vttp://") {
+	if !strings.HasPrefix(dbi, "vttp://") && !strings.HasPrefix(dbi, "vttps://") {
 		dbi = "vttp://" + dbi
 	}
 	return url.Parse(dbi)
 }
 
+// tlsConfig returns the TLS configuration to use, or nil if the
+// connection is not encrypted.
+func (conn *Conn) tlsConfig() (*tls.Config, error) {
+	if conn.dbi.Scheme != "vttps" {
+		return nil, nil
+	}
+	params := conn.dbi.Query()
+	return vttls.ClientConfig(params.Get("cert"), params.Get("key"), params.Get("ca"), "")
+}
+
 func DialTablet(dbi string, stream bool) (conn *Conn, err error) {
 	conn = new(Conn)
 	if conn.dbi, err = parseDbi(dbi); err != nil {
@@ -120,10 +134,15 @@ func (conn *Conn) dial() (err error) {
 		return err
 	}
 
+	config, err := conn.tlsConfig()
+	if err != nil {
+		return err
+	}
+
 	if useAuth {
-		conn.rpcClient, err = bsonrpc.DialAuthHTTP("tcp", conn.dbi.Host, user, password, 0, nil)
+		conn.rpcClient, err = bsonrpc.DialAuthHTTP("tcp", conn.dbi.Host, user, password, 0, config)
 	} else {
-		conn.rpcClient, err = bsonrpc.DialHTTP("tcp", conn.dbi.Host, 0, nil)
+		conn.rpcClient, err = bsonrpc.DialHTTP("tcp", conn.dbi.Host, 0, config)
 	}
 
 	if err != nil {
@@ -205,6 +224,49 @@ func (conn *Conn) Rollback() error {
 	return conn.fmtErr(conn.rpcClient.Call("SqlQuery.Rollback", &conn.Session, &noOutput))
 }
 
+// CommitPrepared commits the prepared distributed transaction dtid.
+func (conn *Conn) CommitPrepared(dtid string) error {
+	req := &tproto.PreparedTransaction{Dtid: dtid, SessionId: conn.SessionId}
+	var noOutput string
+	return conn.fmtErr(conn.rpcClient.Call("SqlQuery.CommitPrepared", req, &noOutput))
+}
+
+// RollbackPrepared rolls back the prepared distributed transaction
+// dtid, or the transaction originalId if it was not prepared.
+func (conn *Conn) RollbackPrepared(dtid string, originalId int64) error {
+	req := &tproto.PreparedTransaction{Dtid: dtid, TransactionId: originalId, SessionId: conn.SessionId}
+	var noOutput string
+	return conn.fmtErr(conn.rpcClient.Call("SqlQuery.RollbackPrepared", req, &noOutput))
+}
+
+// SetTransactionState changes the state of a distributed transaction
+// in the transaction metadata of the tablet.
+func (conn *Conn) SetTransactionState(dtid string, from, to int64) error {
+	req := &tproto.DtxStateChange{Dtid: dtid, From: from, To: to, SessionId: conn.SessionId}
+	var noOutput string
+	return conn.fmtErr(conn.rpcClient.Call("SqlQuery.SetTransactionState", req, &noOutput))
+}
+
+// ConcludeTransaction deletes a distributed transaction from the
+// transaction metadata of the tablet.
+func (conn *Conn) ConcludeTransaction(dtid string) error {
+	req := &tproto.PreparedTransaction{Dtid: dtid, SessionId: conn.SessionId}
+	var noOutput string
+	return conn.fmtErr(conn.rpcClient.Call("SqlQuery.ConcludeTransaction", req, &noOutput))
+}
+
+// ReadTransactions returns the distributed transaction dtid, or the
+// ones older than abandonAge if dtid is empty, from the transaction
+// metadata of the tablet.
+func (conn *Conn) ReadTransactions(dtid string, abandonAge time.Duration) ([]tproto.DistributedTransaction, error) {
+	req := &tproto.DtxQuery{Dtid: dtid, AbandonAge: int64(abandonAge), SessionId: conn.SessionId}
+	var reply tproto.DistributedTransactionList
+	if err := conn.rpcClient.Call("SqlQuery.ReadTransactions", req, &reply); err != nil {
+		return nil, conn.fmtErr(err)
+	}
+	return reply.List, nil
+}
+
 // driver.Tx interface (forwarded to Conn)
 func (tx *Tx) Commit() error {
 	return tx.conn.Commit()
@@ -0,0 +1,182 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dbconfigs
+
+// This file contains the pluggable sources of db passwords. A user
+// can have more than one password: while a password is rotated, both
+// the new and the old one are listed, and connections try them in
+// order. The sources are read every time a connection is opened, so
+// a tablet picks up new passwords without a restart.
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/mysql"
+)
+
+var (
+	dbCredentialsServer     = flag.String("db-credentials-server", "file", "db credentials server type (file or command)")
+	dbCredentialsCommand    = flag.String("db-credentials-command", "", "command printing the json list of passwords of the user given as argument (for -db-credentials-server=command)")
+	dbCredentialsCommandTTL = flag.Duration("db-credentials-command-ttl", time.Minute, "how long the output of -db-credentials-command is cached")
+
+	// ErrUnknownUser is returned by credentials servers that don't
+	// know about a user.
+	ErrUnknownUser = errors.New("unknown user")
+)
+
+// CredentialsServer is the interface for a source of db passwords.
+type CredentialsServer interface {
+	// GetPasswords returns the passwords of user, the one to try
+	// first at the beginning of the list.
+	GetPasswords(user string) ([]string, error)
+}
+
+// AllCredentialsServers contains all the known CredentialsServer
+// implementations. Plugins register here in their init.
+var AllCredentialsServers = make(map[string]CredentialsServer)
+
+// GetCredentialsServer returns the CredentialsServer selected by
+// -db-credentials-server.
+func GetCredentialsServer() CredentialsServer {
+	cs, ok := AllCredentialsServers[*dbCredentialsServer]
+	if !ok {
+		panic(fmt.Errorf("Invalid credential server: %v", *dbCredentialsServer))
+	}
+	return cs
+}
+
+// FileCredentialsServer reads the passwords from a json file mapping
+// users to their list of passwords. The file is read again whenever
+// its modification time changes.
+type FileCredentialsServer struct {
+	mu          sync.Mutex
+	file        string
+	modTime     time.Time
+	credentials map[string][]string
+}
+
+// SetFile sets the file to read the passwords from.
+func (fcs *FileCredentialsServer) SetFile(file string) {
+	fcs.mu.Lock()
+	defer fcs.mu.Unlock()
+	fcs.file = file
+	fcs.modTime = time.Time{}
+	fcs.credentials = nil
+}
+
+func (fcs *FileCredentialsServer) GetPasswords(user string) ([]string, error) {
+	fcs.mu.Lock()
+	defer fcs.mu.Unlock()
+	if fcs.file == "" {
+		return nil, ErrUnknownUser
+	}
+
+	fi, err := os.Stat(fcs.file)
+	if err != nil {
+		return nil, err
+	}
+	if fcs.credentials == nil || !fi.ModTime().Equal(fcs.modTime) {
+		credentials := make(map[string][]string)
+		if err := jscfg.ReadJson(fcs.file, &credentials); err != nil {
+			return nil, err
+		}
+		log.Infof("loaded db credentials from %v", fcs.file)
+		fcs.credentials = credentials
+		fcs.modTime = fi.ModTime()
+	}
+
+	passwords, ok := fcs.credentials[user]
+	if !ok || len(passwords) == 0 {
+		return nil, ErrUnknownUser
+	}
+	return passwords, nil
+}
+
+// CommandCredentialsServer runs -db-credentials-command with the user
+// as argument. The command prints the json list of passwords of the
+// user, or nothing if it doesn't know about it.
+type CommandCredentialsServer struct {
+	mu    sync.Mutex
+	cache map[string]cachedPasswords
+}
+
+type cachedPasswords struct {
+	passwords []string
+	expires   time.Time
+}
+
+func (ccs *CommandCredentialsServer) GetPasswords(user string) ([]string, error) {
+	if *dbCredentialsCommand == "" {
+		return nil, ErrUnknownUser
+	}
+
+	ccs.mu.Lock()
+	defer ccs.mu.Unlock()
+	if cp, ok := ccs.cache[user]; ok && time.Now().Before(cp.expires) {
+		return cp.passwords, nil
+	}
+
+	output, err := exec.Command(*dbCredentialsCommand, user).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v failed: %v", *dbCredentialsCommand, err)
+	}
+	var passwords []string
+	if len(output) != 0 {
+		if err := json.Unmarshal(output, &passwords); err != nil {
+			return nil, fmt.Errorf("cannot parse the output of %v: %v", *dbCredentialsCommand, err)
+		}
+	}
+	if len(passwords) == 0 {
+		return nil, ErrUnknownUser
+	}
+
+	if ccs.cache == nil {
+		ccs.cache = make(map[string]cachedPasswords)
+	}
+	ccs.cache[user] = cachedPasswords{passwords, time.Now().Add(*dbCredentialsCommandTTL)}
+	return passwords, nil
+}
+
+var fileCredentialsServer = &FileCredentialsServer{}
+
+func init() {
+	AllCredentialsServers["file"] = fileCredentialsServer
+	AllCredentialsServers["command"] = &CommandCredentialsServer{}
+}
+
+// MysqlConnect opens a connection with params, trying all the
+// passwords of the user in turn until one is accepted. If the
+// credentials server doesn't know the user, params.Pass is used.
+func MysqlConnect(params mysql.ConnectionParams) (*mysql.Connection, error) {
+	passwords, err := GetCredentialsServer().GetPasswords(params.Uname)
+	switch err {
+	case nil:
+	case ErrUnknownUser:
+		return mysql.Connect(params)
+	default:
+		return nil, err
+	}
+
+	for _, password := range passwords {
+		params.Pass = password
+		conn, err := mysql.Connect(params)
+		if err == nil {
+			return conn, nil
+		}
+		if sqlErr, ok := err.(*mysql.SqlError); !ok || sqlErr.Number() != mysql.ACCESS_DENIED {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("none of the %v passwords of %v was accepted", len(passwords), params.Uname)
+}
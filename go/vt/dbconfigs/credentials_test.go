@@ -0,0 +1,77 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dbconfigs
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileCredentialsServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "db_credentials.json")
+
+	fcs := &FileCredentialsServer{}
+	if _, err := fcs.GetPasswords("vt_app"); err != ErrUnknownUser {
+		t.Errorf("no file should mean unknown user: %v", err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(`{"vt_app": ["old"]}`), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	fcs.SetFile(file)
+	passwords, err := fcs.GetPasswords("vt_app")
+	if err != nil || !reflect.DeepEqual(passwords, []string{"old"}) {
+		t.Errorf("GetPasswords: got %v, %v", passwords, err)
+	}
+	if _, err := fcs.GetPasswords("vt_dba"); err != ErrUnknownUser {
+		t.Errorf("vt_dba should be unknown: %v", err)
+	}
+
+	// rotation: the new password is added, the file is reloaded
+	if err := ioutil.WriteFile(file, []byte(`{"vt_app": ["new", "old"]}`), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	passwords, err = fcs.GetPasswords("vt_app")
+	if err != nil || !reflect.DeepEqual(passwords, []string{"new", "old"}) {
+		t.Errorf("GetPasswords after rotation: got %v, %v", passwords, err)
+	}
+}
+
+func TestCommandCredentialsServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	command := path.Join(dir, "get_passwords.sh")
+	script := "#!/bin/sh\nif [ \"$1\" = vt_app ]; then echo '[\"p1\", \"p2\"]'; fi\n"
+	if err := ioutil.WriteFile(command, []byte(script), 0700); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	*dbCredentialsCommand = command
+	defer func() { *dbCredentialsCommand = "" }()
+
+	ccs := &CommandCredentialsServer{}
+	passwords, err := ccs.GetPasswords("vt_app")
+	if err != nil || !reflect.DeepEqual(passwords, []string{"p1", "p2"}) {
+		t.Errorf("GetPasswords: got %v, %v", passwords, err)
+	}
+	if _, err := ccs.GetPasswords("vt_dba"); err != ErrUnknownUser {
+		t.Errorf("vt_dba should be unknown: %v", err)
+	}
+}
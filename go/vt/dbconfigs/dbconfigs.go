@@ -12,7 +12,6 @@ import (
 	"strconv"
 
 	log "github.com/golang/glog"
-	"github.com/youtube/vitess/go/jscfg"
 	"github.com/youtube/vitess/go/mysql"
 )
 
@@ -98,26 +97,30 @@ func (dbcfgs DBConfigs) Redacted() DBConfigs {
 	return dbcfgs
 }
 
-// Map user to a list of passwords. Right now we only use the first.
-type dbCredentials map[string][]string
-
+// Init fills in the db configs from the flags. dbCredentialsFile is
+// used by the 'file' credentials server. The passwords of the users
+// are initialized with the first password returned by the selected
+// credentials server, but connections should be opened with
+// MysqlConnect so the other passwords are tried too.
 func Init(socketFile, dbCredentialsFile string) (DBConfigs, error) {
 	var err error
 	if dbCredentialsFile != "" {
-		dbCreds := make(dbCredentials)
-		if err = jscfg.ReadJson(dbCredentialsFile, &dbCreds); err != nil {
-			return dbConfigs, err
-		}
-		if passwd, ok := dbCreds[dbConfigs.App.Uname]; ok {
-			dbConfigs.App.Pass = passwd[0]
-		}
-		if passwd, ok := dbCreds[dbConfigs.Dba.Uname]; ok {
-			dbConfigs.Dba.Pass = passwd[0]
-		}
-		if passwd, ok := dbCreds[dbConfigs.Repl.Uname]; ok {
-			dbConfigs.Repl.Pass = passwd[0]
+		fileCredentialsServer.SetFile(dbCredentialsFile)
+	}
+	cs := GetCredentialsServer()
+	for _, connParams := range []*mysql.ConnectionParams{&dbConfigs.App.ConnectionParams, &dbConfigs.Dba, &dbConfigs.Repl} {
+		passwords, perr := cs.GetPasswords(connParams.Uname)
+		switch perr {
+		case nil:
+			connParams.Pass = passwords[0]
+		case ErrUnknownUser:
+		default:
+			err = perr
 		}
 	}
+	if err != nil {
+		return dbConfigs, err
+	}
 	if socketFile != "" {
 		dbConfigs.App.UnixSocket = socketFile
 		dbConfigs.Dba.UnixSocket = socketFile
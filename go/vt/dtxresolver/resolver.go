@@ -0,0 +1,150 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dtxresolver finishes the in-doubt distributed transactions,
+// whose metadata is kept by the master of an unsharded shard (see
+// go/vt/vtgate/dtx.go). It is shared by the resolver of vtgate, the
+// watchdog of vttablet and the ResolveDistributedTransaction command
+// of vtctl, so they make the same decisions.
+//
+// A transaction in the COMMIT state is committed on all its
+// participants, a transaction in the ROLLBACK state is rolled back.
+// A transaction still in the PREPARE state is rolled back only once
+// it is older than the abandon age, unless forced: before that, its
+// vtgate may still be preparing or committing it.
+package dtxresolver
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+// MetadataConn is a connection to the master that keeps the metadata
+// of the distributed transactions.
+type MetadataConn interface {
+	SetTransactionState(dtid string, from, to int64) error
+	ConcludeTransaction(dtid string) error
+	ReadTransactions(dtid string, abandonAge time.Duration) ([]tproto.DistributedTransaction, error)
+}
+
+// ParticipantConn is a connection to the master of a participant of
+// a distributed transaction.
+type ParticipantConn interface {
+	CommitPrepared(dtid string) error
+	RollbackPrepared(dtid string, originalId int64) error
+	Close() error
+}
+
+// DialFunc connects to the master of a participant.
+type DialFunc func(keyspace, shard string) (ParticipantConn, error)
+
+// Resolver makes the decisions of the distributed transactions, and
+// applies them to their participants.
+type Resolver struct {
+	metadata MetadataConn
+	dial     DialFunc
+}
+
+// NewResolver creates a Resolver for the metadata of metadata, that
+// connects to the participants with dial.
+func NewResolver(metadata MetadataConn, dial DialFunc) *Resolver {
+	return &Resolver{metadata: metadata, dial: dial}
+}
+
+// Decide makes the commit or the rollback decision of a transaction
+// in the PREPARE state. It returns the decision that was made, which
+// is the other one if somebody else decided first.
+func (r *Resolver) Decide(dtid string, commit bool) (committed bool, err error) {
+	state := int64(tproto.DTX_ROLLBACK)
+	if commit {
+		state = tproto.DTX_COMMIT
+	}
+	err = r.metadata.SetTransactionState(dtid, tproto.DTX_PREPARE, state)
+	if err == nil {
+		return commit, nil
+	}
+	// somebody else decided, or the state changed before
+	// the error: read it back
+	dtxs, rerr := r.metadata.ReadTransactions(dtid, 0)
+	if rerr != nil {
+		return false, err
+	}
+	if len(dtxs) != 1 {
+		return false, fmt.Errorf("distributed transaction %v not found", dtid)
+	}
+	switch dtxs[0].State {
+	case tproto.DTX_COMMIT:
+		return true, nil
+	case tproto.DTX_ROLLBACK:
+		return false, nil
+	}
+	return false, err
+}
+
+// Conclude deletes the metadata of a finished transaction.
+func (r *Resolver) Conclude(dtid string) error {
+	return r.metadata.ConcludeTransaction(dtid)
+}
+
+// ResolveParticipants commits or rolls back the prepared transaction
+// of all the participants.
+func (r *Resolver) ResolveParticipants(dtid string, commit bool, participants []tproto.DtxParticipant) error {
+	rec := concurrency.AllErrorRecorder{}
+	for _, p := range participants {
+		conn, err := r.dial(p.Keyspace, p.Shard)
+		if err != nil {
+			rec.RecordError(fmt.Errorf("%v/%v: %v", p.Keyspace, p.Shard, err))
+			continue
+		}
+		if commit {
+			err = conn.CommitPrepared(dtid)
+		} else {
+			err = conn.RollbackPrepared(dtid, 0)
+		}
+		if err != nil {
+			rec.RecordError(fmt.Errorf("%v/%v: %v", p.Keyspace, p.Shard, err))
+		}
+		conn.Close()
+	}
+	return rec.Error()
+}
+
+// Resolve finishes a distributed transaction: it is committed if the
+// commit decision was made, and rolled back otherwise. A transaction
+// in the PREPARE state younger than abandonAge is left alone, unless
+// force is set.
+func (r *Resolver) Resolve(dtx *tproto.DistributedTransaction, abandonAge time.Duration, force bool) error {
+	committed := dtx.State == tproto.DTX_COMMIT
+	if dtx.State == tproto.DTX_PREPARE {
+		if age := time.Now().Sub(time.Unix(0, dtx.TimeCreated)); age < abandonAge && !force {
+			return fmt.Errorf("distributed transaction %v is being prepared for %v only, less than the abandon age %v: its coordinator may still finish it", dtx.Dtid, age, abandonAge)
+		}
+		var err error
+		if committed, err = r.Decide(dtx.Dtid, false); err != nil {
+			return err
+		}
+	}
+	log.Infof("resolving distributed transaction %v: committed %v", dtx.Dtid, committed)
+	if err := r.ResolveParticipants(dtx.Dtid, committed, dtx.Participants); err != nil {
+		return fmt.Errorf("cannot resolve distributed transaction %v: %v", dtx.Dtid, err)
+	}
+	return r.Conclude(dtx.Dtid)
+}
+
+// ResolveTransaction reads the metadata of dtid, and resolves it like
+// Resolve.
+func (r *Resolver) ResolveTransaction(dtid string, abandonAge time.Duration, force bool) error {
+	dtxs, err := r.metadata.ReadTransactions(dtid, 0)
+	if err != nil {
+		return err
+	}
+	if len(dtxs) != 1 {
+		return fmt.Errorf("distributed transaction %v not found", dtid)
+	}
+	return r.Resolve(&dtxs[0], abandonAge, force)
+}
@@ -0,0 +1,149 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dtxresolver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+// fakeMetadata keeps the metadata in memory.
+type fakeMetadata struct {
+	dtxs map[string]*tproto.DistributedTransaction
+}
+
+func (fm *fakeMetadata) SetTransactionState(dtid string, from, to int64) error {
+	dtx, ok := fm.dtxs[dtid]
+	if !ok || dtx.State != from {
+		return fmt.Errorf("cannot change the state of %v", dtid)
+	}
+	dtx.State = to
+	return nil
+}
+
+func (fm *fakeMetadata) ConcludeTransaction(dtid string) error {
+	delete(fm.dtxs, dtid)
+	return nil
+}
+
+func (fm *fakeMetadata) ReadTransactions(dtid string, abandonAge time.Duration) ([]tproto.DistributedTransaction, error) {
+	var dtxs []tproto.DistributedTransaction
+	if dtx, ok := fm.dtxs[dtid]; ok {
+		dtxs = append(dtxs, *dtx)
+	}
+	return dtxs, nil
+}
+
+// fakeParticipant records the resolutions of a participant.
+type fakeParticipant struct {
+	commits, rollbacks int
+}
+
+func (fp *fakeParticipant) CommitPrepared(dtid string) error {
+	fp.commits++
+	return nil
+}
+
+func (fp *fakeParticipant) RollbackPrepared(dtid string, originalId int64) error {
+	fp.rollbacks++
+	return nil
+}
+
+func (fp *fakeParticipant) Close() error {
+	return nil
+}
+
+func newTestResolver(dtxs ...*tproto.DistributedTransaction) (*Resolver, *fakeMetadata, map[string]*fakeParticipant) {
+	fm := &fakeMetadata{dtxs: make(map[string]*tproto.DistributedTransaction)}
+	for _, dtx := range dtxs {
+		fm.dtxs[dtx.Dtid] = dtx
+	}
+	participants := map[string]*fakeParticipant{"ks/0": {}, "ks/1": {}}
+	dial := func(keyspace, shard string) (ParticipantConn, error) {
+		fp, ok := participants[keyspace+"/"+shard]
+		if !ok {
+			return nil, fmt.Errorf("no master")
+		}
+		return fp, nil
+	}
+	return NewResolver(fm, dial), fm, participants
+}
+
+var testParticipants = []tproto.DtxParticipant{{Keyspace: "ks", Shard: "0"}, {Keyspace: "ks", Shard: "1"}}
+
+func TestResolveCommitted(t *testing.T) {
+	r, fm, participants := newTestResolver(&tproto.DistributedTransaction{Dtid: "a", State: tproto.DTX_COMMIT, TimeCreated: time.Now().UnixNano(), Participants: testParticipants})
+	if err := r.ResolveTransaction("a", time.Minute, false); err != nil {
+		t.Fatalf("ResolveTransaction: %v", err)
+	}
+	if participants["ks/0"].commits != 1 || participants["ks/1"].commits != 1 {
+		t.Errorf("want a commit on each participant, got %v and %v", participants["ks/0"].commits, participants["ks/1"].commits)
+	}
+	if len(fm.dtxs) != 0 {
+		t.Errorf("the metadata was not concluded: %v", fm.dtxs)
+	}
+	if err := r.ResolveTransaction("a", time.Minute, false); err == nil {
+		t.Errorf("ResolveTransaction of an unknown transaction should have failed")
+	}
+}
+
+func TestResolvePrepared(t *testing.T) {
+	// a young transaction in the PREPARE state is left alone
+	dtx := &tproto.DistributedTransaction{Dtid: "a", State: tproto.DTX_PREPARE, TimeCreated: time.Now().UnixNano(), Participants: testParticipants}
+	r, fm, participants := newTestResolver(dtx)
+	if err := r.ResolveTransaction("a", time.Minute, false); err == nil || !strings.Contains(err.Error(), "abandon age") {
+		t.Errorf("want abandon age error, got %v", err)
+	}
+	if dtx.State != tproto.DTX_PREPARE || participants["ks/0"].rollbacks != 0 {
+		t.Errorf("a young transaction was rolled back")
+	}
+
+	// unless forced
+	if err := r.ResolveTransaction("a", time.Minute, true); err != nil {
+		t.Fatalf("forced ResolveTransaction: %v", err)
+	}
+	if participants["ks/0"].rollbacks != 1 || participants["ks/1"].rollbacks != 1 || len(fm.dtxs) != 0 {
+		t.Errorf("want a rollback on each participant, got %v and %v, metadata %v", participants["ks/0"].rollbacks, participants["ks/1"].rollbacks, fm.dtxs)
+	}
+
+	// an old one is rolled back
+	old := &tproto.DistributedTransaction{Dtid: "b", State: tproto.DTX_PREPARE, TimeCreated: time.Now().Add(-time.Hour).UnixNano(), Participants: testParticipants[:1]}
+	r, fm, participants = newTestResolver(old)
+	if err := r.ResolveTransaction("b", time.Minute, false); err != nil {
+		t.Fatalf("ResolveTransaction: %v", err)
+	}
+	if participants["ks/0"].rollbacks != 1 || len(fm.dtxs) != 0 {
+		t.Errorf("the abandoned transaction was not rolled back")
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	dtx := &tproto.DistributedTransaction{Dtid: "a", State: tproto.DTX_ROLLBACK, Participants: []tproto.DtxParticipant{{Keyspace: "ks", Shard: "0"}, {Keyspace: "other", Shard: "0"}}}
+	r, fm, participants := newTestResolver(dtx)
+	if err := r.ResolveTransaction("a", time.Minute, false); err == nil || !strings.Contains(err.Error(), "other/0") {
+		t.Errorf("want an error for other/0, got %v", err)
+	}
+	if participants["ks/0"].rollbacks != 1 || len(fm.dtxs) != 1 {
+		t.Errorf("the reachable participant should be rolled back, and the metadata kept")
+	}
+}
+
+func TestDecide(t *testing.T) {
+	r, _, _ := newTestResolver(&tproto.DistributedTransaction{Dtid: "a", State: tproto.DTX_PREPARE})
+	if committed, err := r.Decide("a", true); err != nil || !committed {
+		t.Errorf("Decide: got %v %v", committed, err)
+	}
+	// the second decision returns the first one
+	if committed, err := r.Decide("a", false); err != nil || !committed {
+		t.Errorf("Decide after a commit decision: got %v %v", committed, err)
+	}
+	if _, err := r.Decide("unknown", false); err == nil {
+		t.Errorf("Decide of an unknown transaction should have failed")
+	}
+}
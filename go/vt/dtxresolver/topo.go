@@ -0,0 +1,69 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dtxresolver
+
+import (
+	"fmt"
+	"time"
+
+	tabletclient "github.com/youtube/vitess/go/vt/client2/tablet"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// This file contains the resolution of the distributed transactions
+// outside of vtgate, by vtctl and vttablet, that find the masters of
+// the shards in the topology.
+
+// DialShardMaster connects to the query service of the master of a
+// shard.
+func DialShardMaster(ts topo.Server, keyspace, shard string) (*tabletclient.Conn, error) {
+	si, err := ts.GetShard(keyspace, shard)
+	if err != nil {
+		return nil, err
+	}
+	if si.MasterAlias.IsZero() {
+		return nil, fmt.Errorf("shard %v/%v has no master", keyspace, shard)
+	}
+	ti, err := ts.GetTablet(si.MasterAlias)
+	if err != nil {
+		return nil, err
+	}
+	return tabletclient.DialTablet(fmt.Sprintf("%v/%v/%v", ti.Addr(), keyspace, shard), false)
+}
+
+// ResolveWithTopo resolves the distributed transaction dtid, whose
+// metadata is in keyspace/shard, like Resolver.ResolveTransaction.
+func ResolveWithTopo(ts topo.Server, keyspace, shard, dtid string, abandonAge time.Duration, force bool) error {
+	conn, err := DialShardMaster(ts, keyspace, shard)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	resolver := NewResolver(conn, func(keyspace, shard string) (ParticipantConn, error) {
+		pconn, err := DialShardMaster(ts, keyspace, shard)
+		if err != nil {
+			return nil, err
+		}
+		return pconn, nil
+	})
+	return resolver.ResolveTransaction(dtid, abandonAge, force)
+}
+
+// TopoTransactionResolver is the resolver of the watchdog of
+// vttablet, for the metadata kept in Keyspace/Shard. It implements
+// tabletserver.TransactionResolver.
+type TopoTransactionResolver struct {
+	Server     topo.Server
+	Keyspace   string
+	Shard      string
+	AbandonAge time.Duration
+}
+
+// ResolveTransaction resolves the distributed transaction dtid. It
+// is only rolled back if it is still in the PREPARE state after
+// AbandonAge.
+func (tr *TopoTransactionResolver) ResolveTransaction(dtid string) error {
+	return ResolveWithTopo(tr.Server, tr.Keyspace, tr.Shard, dtid, tr.AbandonAge, false)
+}
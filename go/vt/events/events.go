@@ -0,0 +1,50 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package events defines the structures of the operational events
+// dispatched with the event package, for instance when a shard is
+// reparented or a tablet changes type.
+package events
+
+import (
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// Reparent is dispatched when a reparent starts, and when it
+// finishes or fails.
+type Reparent struct {
+	Keyspace  string
+	Shard     string
+	OldMaster topo.TabletAlias
+	NewMaster topo.TabletAlias
+	Status    string
+}
+
+// TabletChange is dispatched when a tablet changes type.
+type TabletChange struct {
+	Alias    topo.TabletAlias
+	Keyspace string
+	Shard    string
+	OldType  topo.TabletType
+	NewType  topo.TabletType
+	Status   string
+}
+
+// SchemaChange is dispatched when a schema change has been applied
+// to a shard, or failed.
+type SchemaChange struct {
+	Keyspace string
+	Shard    string
+	Change   string
+	Status   string
+}
+
+// Backup is dispatched when a tablet snapshot has completed or failed.
+type Backup struct {
+	Alias        topo.TabletAlias
+	Keyspace     string
+	Shard        string
+	ManifestPath string
+	Status       string
+}
@@ -0,0 +1,33 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package events
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// The events implement syslogger.Syslogger, so they are published to
+// syslog when the syslogger package is linked in.
+
+func (r *Reparent) Syslog() (syslog.Priority, string) {
+	return syslog.LOG_INFO, fmt.Sprintf("%v/%v [reparent %v -> %v] %v",
+		r.Keyspace, r.Shard, r.OldMaster, r.NewMaster, r.Status)
+}
+
+func (tc *TabletChange) Syslog() (syslog.Priority, string) {
+	return syslog.LOG_INFO, fmt.Sprintf("%v/%v/%v [tablet %v -> %v] %v",
+		tc.Keyspace, tc.Shard, tc.Alias, tc.OldType, tc.NewType, tc.Status)
+}
+
+func (sc *SchemaChange) Syslog() (syslog.Priority, string) {
+	return syslog.LOG_INFO, fmt.Sprintf("%v/%v [schema change] %v: %q",
+		sc.Keyspace, sc.Shard, sc.Status, sc.Change)
+}
+
+func (b *Backup) Syslog() (syslog.Priority, string) {
+	return syslog.LOG_INFO, fmt.Sprintf("%v/%v/%v [backup %v] %v",
+		b.Keyspace, b.Shard, b.Alias, b.ManifestPath, b.Status)
+}
@@ -6,6 +6,7 @@ package hook
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
@@ -18,6 +19,8 @@ import (
 	vtenv "github.com/youtube/vitess/go/vt/env"
 )
 
+var hookDir = flag.String("vthook-dir", "", "directory the hooks are read from, defaults to $VTROOT/vthook")
+
 type Hook struct {
 	Name       string
 	Parameters []string
@@ -59,17 +62,21 @@ func (hook *Hook) Execute() (result *HookResult) {
 		return result
 	}
 
-	// find our root
-	root, err := vtenv.VtRoot()
-	if err != nil {
-		result.ExitStatus = HOOK_VTROOT_ERROR
-		result.Stdout = "Cannot get VTROOT: " + err.Error() + "\n"
-		return result
+	// find our hooks directory
+	dir := *hookDir
+	if dir == "" {
+		root, err := vtenv.VtRoot()
+		if err != nil {
+			result.ExitStatus = HOOK_VTROOT_ERROR
+			result.Stdout = "Cannot get VTROOT: " + err.Error() + "\n"
+			return result
+		}
+		dir = path.Join(root, "vthook")
 	}
 
 	// see if the hook exists
-	vthook := path.Join(root, "vthook", hook.Name)
-	_, err = os.Stat(vthook)
+	vthook := path.Join(dir, hook.Name)
+	_, err := os.Stat(vthook)
 	if err != nil {
 		if os.IsNotExist(err) {
 			result.ExitStatus = HOOK_DOES_NOT_EXIST
@@ -0,0 +1,57 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hook
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestExecute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vthook")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	*hookDir = dir
+	defer func() { *hookDir = "" }()
+
+	script := "#!/bin/sh\necho out $1 $TABLET_ALIAS\necho err >&2\nexit 3\n"
+	if err := ioutil.WriteFile(path.Join(dir, "test_hook"), []byte(script), 0755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	h := NewHook("test_hook", []string{"--param"})
+	h.ExtraEnv = map[string]string{"TABLET_ALIAS": "cell-1"}
+	hr := h.Execute()
+	if hr.ExitStatus != 3 {
+		t.Errorf("unexpected exit status: %v", hr.ExitStatus)
+	}
+	if hr.Stdout != "out --param cell-1\n" {
+		t.Errorf("unexpected stdout: %q", hr.Stdout)
+	}
+	if !strings.HasPrefix(hr.Stderr, "err\n") {
+		t.Errorf("unexpected stderr: %q", hr.Stderr)
+	}
+	if err := h.ExecuteOptional(); err == nil {
+		t.Errorf("ExecuteOptional should have failed")
+	}
+
+	hr = NewSimpleHook("missing_hook").Execute()
+	if hr.ExitStatus != HOOK_DOES_NOT_EXIST {
+		t.Errorf("unexpected exit status for missing hook: %v", hr.ExitStatus)
+	}
+	if err := NewSimpleHook("missing_hook").ExecuteOptional(); err != nil {
+		t.Errorf("ExecuteOptional should ignore missing hooks: %v", err)
+	}
+
+	hr = NewSimpleHook("../test_hook").Execute()
+	if hr.ExitStatus != HOOK_INVALID_NAME {
+		t.Errorf("unexpected exit status for invalid name: %v", hr.ExitStatus)
+	}
+}
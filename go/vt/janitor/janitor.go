@@ -0,0 +1,158 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package janitor contains the janitor, which periodically looks for
+// drift in the topology of a shard and fixes it. The work is done by
+// modules, registered with RegisterModule. Every fix a module makes
+// is logged, counted in the JanitorFixes stats, and kept in the list
+// of recent fixes.
+package janitor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// how many recent fixes we remember
+const maxRecentFixes = 100
+
+var (
+	fixCount   = stats.NewCounters("JanitorFixes")
+	errorCount = stats.NewCounters("JanitorErrors")
+)
+
+// Module is one janitor task.
+type Module interface {
+	// Run does one pass of the module on the shard. It returns a
+	// description of each fix it made.
+	Run(keyspace, shard string) ([]string, error)
+}
+
+// ModuleFactory creates a Module.
+type ModuleFactory func(wr *wrangler.Wrangler) (Module, error)
+
+var modules = make(map[string]ModuleFactory)
+
+// RegisterModule registers a janitor module under a name. It is meant
+// to be called from init() functions.
+func RegisterModule(name string, factory ModuleFactory) {
+	if _, ok := modules[name]; ok {
+		panic(fmt.Errorf("janitor module %v is already registered", name))
+	}
+	modules[name] = factory
+}
+
+// ModuleNames returns the sorted list of registered modules.
+func ModuleNames() []string {
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Fix is the record of one fix made by a module.
+type Fix struct {
+	Time        time.Time
+	Module      string
+	Description string
+}
+
+func (f Fix) String() string {
+	return fmt.Sprintf("%v %v: %v", f.Time.Format(time.RFC3339), f.Module, f.Description)
+}
+
+// Janitor runs a list of modules on a shard.
+type Janitor struct {
+	keyspace string
+	shard    string
+	names    []string
+	modules  map[string]Module
+
+	mu     sync.Mutex
+	recent []Fix
+}
+
+// New creates a Janitor for the shard, running the given modules.
+func New(wr *wrangler.Wrangler, keyspace, shard string, moduleNames []string) (*Janitor, error) {
+	j := &Janitor{
+		keyspace: keyspace,
+		shard:    shard,
+		names:    moduleNames,
+		modules:  make(map[string]Module),
+	}
+	for _, name := range moduleNames {
+		factory, ok := modules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown janitor module %v, known modules are %v", name, ModuleNames())
+		}
+		m, err := factory(wr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create janitor module %v: %v", name, err)
+		}
+		j.modules[name] = m
+	}
+	return j, nil
+}
+
+// RunOnce runs every module once. A failing module doesn't prevent
+// the others from running, the first error is returned.
+func (j *Janitor) RunOnce() error {
+	var firstErr error
+	for _, name := range j.names {
+		fixes, err := j.modules[name].Run(j.keyspace, j.shard)
+		for _, description := range fixes {
+			j.report(name, description)
+		}
+		if err != nil {
+			log.Errorf("janitor module %v failed on %v/%v: %v", name, j.keyspace, j.shard, err)
+			errorCount.Add(name, 1)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Run runs all the modules every interval, until done is closed.
+func (j *Janitor) Run(interval time.Duration, done <-chan struct{}) {
+	for {
+		j.RunOnce()
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (j *Janitor) report(module, description string) {
+	fix := Fix{Time: time.Now(), Module: module, Description: description}
+	log.Infof("janitor fix on %v/%v: %v", j.keyspace, j.shard, fix)
+	fixCount.Add(module, 1)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.recent = append(j.recent, fix)
+	if len(j.recent) > maxRecentFixes {
+		j.recent = j.recent[len(j.recent)-maxRecentFixes:]
+	}
+}
+
+// RecentFixes returns the most recent fixes, oldest first.
+func (j *Janitor) RecentFixes() []Fix {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	result := make([]Fix, len(j.recent))
+	copy(result, j.recent)
+	return result
+}
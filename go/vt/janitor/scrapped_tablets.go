@@ -0,0 +1,41 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package janitor
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+var scrapRetention = flag.Duration("scrap-retention", 7*24*time.Hour, "how long the scrapped_tablets module keeps the records of scrapped tablets")
+
+// scrappedTabletsModule deletes the records of the tablets of the
+// shard that were scrapped more than -scrap-retention ago, in all
+// cells.
+type scrappedTabletsModule struct {
+	wr *wrangler.Wrangler
+}
+
+func init() {
+	RegisterModule("scrapped_tablets", func(wr *wrangler.Wrangler) (Module, error) {
+		return &scrappedTabletsModule{wr: wr}, nil
+	})
+}
+
+func (stm *scrappedTabletsModule) Run(keyspace, shard string) ([]string, error) {
+	cells, err := stm.wr.TopoServer().GetKnownCells()
+	if err != nil {
+		return nil, err
+	}
+	purged, err := stm.wr.PurgeScrappedTablets(cells, keyspace, shard, *scrapRetention)
+	fixes := make([]string, len(purged))
+	for i, alias := range purged {
+		fixes[i] = fmt.Sprintf("purged tablet %v, scrapped more than %v ago", alias, *scrapRetention)
+	}
+	return fixes, err
+}
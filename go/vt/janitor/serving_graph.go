@@ -0,0 +1,110 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package janitor
+
+import (
+	"fmt"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// servingGraphModule compares the serving graph of the shard in each
+// of its cells with the tablets of the shard. If an endpoint belongs
+// to a tablet that was deleted or changed, or a serving tablet is
+// missing, the serving graph of the cell is rebuilt.
+type servingGraphModule struct {
+	wr *wrangler.Wrangler
+}
+
+func init() {
+	RegisterModule("serving_graph", func(wr *wrangler.Wrangler) (Module, error) {
+		return &servingGraphModule{wr: wr}, nil
+	})
+}
+
+func (sgm *servingGraphModule) Run(keyspace, shard string) ([]string, error) {
+	ts := sgm.wr.TopoServer()
+	si, err := ts.GetShard(keyspace, shard)
+	if err != nil {
+		return nil, err
+	}
+	tabletMap, err := wrangler.GetTabletMapForShard(ts, keyspace, shard)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixes []string
+	for _, cell := range si.Cells {
+		drift, err := sgm.servingGraphDrift(si, tabletMap, cell)
+		if err != nil {
+			return fixes, err
+		}
+		if len(drift) == 0 {
+			continue
+		}
+		if err := sgm.wr.RebuildShardGraph(keyspace, shard, []string{cell}); err != nil {
+			return fixes, fmt.Errorf("cannot rebuild serving graph of %v/%v in cell %v: %v", keyspace, shard, cell, err)
+		}
+		for _, d := range drift {
+			fixes = append(fixes, fmt.Sprintf("rebuilt serving graph of %v/%v in cell %v: %v", keyspace, shard, cell, d))
+		}
+	}
+	return fixes, nil
+}
+
+// servingGraphDrift returns the differences between the serving
+// graph in a cell and what it should contain according to the
+// tablets, using the same rules as the shard rebuild.
+func (sgm *servingGraphModule) servingGraphDrift(si *topo.ShardInfo, tabletMap map[topo.TabletAlias]*topo.TabletInfo, cell string) ([]string, error) {
+	ts := sgm.wr.TopoServer()
+	keyspace, shard := si.Keyspace(), si.ShardName()
+
+	// what the serving graph should contain
+	expected := make(map[topo.TabletType]map[uint32]bool)
+	for alias, ti := range tabletMap {
+		if alias.Cell != cell || !ti.IsServingType() {
+			continue
+		}
+		if ti.Type != topo.TYPE_MASTER && ti.Parent != si.MasterAlias {
+			continue
+		}
+		if expected[ti.Type] == nil {
+			expected[ti.Type] = make(map[uint32]bool)
+		}
+		expected[ti.Type][alias.Uid] = true
+	}
+
+	// what it contains
+	endPointsPerType, err := ts.GetEndPointsPerShard(cell, keyspace, shard)
+	if err != nil && err != topo.ErrNoNode {
+		return nil, err
+	}
+	var drift []string
+	seen := make(map[topo.TabletType]map[uint32]bool)
+	for tabletType, addrs := range endPointsPerType {
+		seen[tabletType] = make(map[uint32]bool)
+		for _, entry := range addrs.Entries {
+			seen[tabletType][entry.Uid] = true
+			if expected[tabletType][entry.Uid] {
+				continue
+			}
+			alias := topo.TabletAlias{Cell: cell, Uid: entry.Uid}
+			if _, ok := tabletMap[alias]; !ok {
+				drift = append(drift, fmt.Sprintf("pruned %v endpoint of deleted tablet %v", tabletType, alias))
+			} else {
+				drift = append(drift, fmt.Sprintf("pruned stale %v endpoint of tablet %v", tabletType, alias))
+			}
+		}
+	}
+	for tabletType, uids := range expected {
+		for uid := range uids {
+			if !seen[tabletType][uid] {
+				drift = append(drift, fmt.Sprintf("added missing %v endpoint of tablet %v", tabletType, topo.TabletAlias{Cell: cell, Uid: uid}))
+			}
+		}
+	}
+	return drift, nil
+}
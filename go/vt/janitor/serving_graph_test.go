@@ -0,0 +1,100 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package janitor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+func createTestTablet(t *testing.T, wr *wrangler.Wrangler, uid uint32, tabletType topo.TabletType, parent topo.TabletAlias) topo.TabletAlias {
+	state := topo.STATE_READ_ONLY
+	if tabletType == topo.TYPE_MASTER {
+		state = topo.STATE_READ_WRITE
+	}
+	tablet := &topo.Tablet{
+		Parent:   parent,
+		Alias:    topo.TabletAlias{Cell: "cell1", Uid: uid},
+		Hostname: fmt.Sprintf("host%v", uid),
+		Portmap: map[string]int{
+			"vt":    8100 + int(uid),
+			"mysql": 3300 + int(uid),
+		},
+		IPAddr:   fmt.Sprintf("%v.0.0.1", 100+uid),
+		Keyspace: "test_keyspace",
+		Shard:    "0",
+		Type:     tabletType,
+		State:    state,
+	}
+	if err := wr.InitTablet(tablet, false, true, false); err != nil {
+		t.Fatalf("cannot create tablet %v: %v", uid, err)
+	}
+	return tablet.Alias
+}
+
+func TestServingGraphModule(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := wrangler.New(ts, time.Minute, time.Second)
+	wr.UseRPCs = false
+
+	masterAlias := createTestTablet(t, wr, 0, topo.TYPE_MASTER, topo.TabletAlias{})
+	replicaAlias := createTestTablet(t, wr, 1, topo.TYPE_REPLICA, masterAlias)
+	createTestTablet(t, wr, 2, topo.TYPE_REPLICA, masterAlias)
+	if err := wr.RebuildShardGraph("test_keyspace", "0", nil); err != nil {
+		t.Fatalf("RebuildShardGraph: %v", err)
+	}
+
+	j, err := New(wr, "test_keyspace", "0", []string{"serving_graph"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// nothing to fix
+	if err := j.RunOnce(); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if fixes := j.RecentFixes(); len(fixes) != 0 {
+		t.Errorf("unexpected fixes: %v", fixes)
+	}
+
+	// delete a replica, its endpoint should be pruned
+	if err := ts.DeleteTablet(replicaAlias); err != nil {
+		t.Fatalf("DeleteTablet: %v", err)
+	}
+	if err := j.RunOnce(); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if fixes := j.RecentFixes(); len(fixes) != 1 || fixes[0].Module != "serving_graph" {
+		t.Errorf("unexpected fixes: %v", fixes)
+	}
+	addrs, err := ts.GetEndPoints("cell1", "test_keyspace", "0", topo.TYPE_REPLICA)
+	if err != nil {
+		t.Fatalf("GetEndPoints: %v", err)
+	}
+	if len(addrs.Entries) != 1 || addrs.Entries[0].Uid != 2 {
+		t.Errorf("bad replica endpoints after fix: %v", addrs.Entries)
+	}
+
+	// and the next run has nothing to do
+	if err := j.RunOnce(); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if fixes := j.RecentFixes(); len(fixes) != 1 {
+		t.Errorf("unexpected fixes: %v", fixes)
+	}
+}
+
+func TestUnknownModule(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := wrangler.New(ts, time.Minute, time.Second)
+	if _, err := New(wr, "test_keyspace", "0", []string{"no_such_module"}); err == nil {
+		t.Errorf("New with an unknown module should fail")
+	}
+}
@@ -41,6 +41,46 @@ func (kid *KeyspaceId) UnmarshalJSON(data []byte) (err error) {
 	return err
 }
 
+// KeyspaceIdType describes how the keyspace ids of a keyspace are
+// stored in its keyspace id column.
+type KeyspaceIdType string
+
+const (
+	// KIT_UINT64 is an unsigned 64 bits integer column, the
+	// default when no type is given.
+	KIT_UINT64 = KeyspaceIdType("uint64")
+
+	// KIT_BYTES is a binary column, of any length.
+	KIT_BYTES = KeyspaceIdType("bytes")
+)
+
+// ParseKeyspaceIdType returns the KeyspaceIdType named s. An empty
+// string is KIT_UINT64.
+func ParseKeyspaceIdType(s string) (KeyspaceIdType, error) {
+	switch KeyspaceIdType(s) {
+	case "", KIT_UINT64:
+		return KIT_UINT64, nil
+	case KIT_BYTES:
+		return KIT_BYTES, nil
+	}
+	return "", fmt.Errorf("unknown keyspace id type %q, should be %v or %v", s, KIT_UINT64, KIT_BYTES)
+}
+
+// SqlLiteral returns the literal to compare kid with a keyspace id
+// column of type kit: the number made of the first 8 bytes of kid,
+// padded with zeros, for KIT_UINT64, and a hex literal for KIT_BYTES.
+func (kit KeyspaceIdType) SqlLiteral(kid KeyspaceId) string {
+	if kit == KIT_BYTES {
+		if kid == "" {
+			return "''"
+		}
+		return "0x" + string(kid.Hex())
+	}
+	buf := make([]byte, 8)
+	copy(buf, []byte(kid))
+	return fmt.Sprintf("%v", binary.BigEndian.Uint64(buf))
+}
+
 // Uint64Key is a uint64 that can be converted into a KeyspaceId.
 type Uint64Key uint64
 
@@ -205,26 +245,27 @@ func ParseShardingSpec(spec string) (KeyRangeArray, error) {
 	if len(parts) == 1 {
 		return nil, fmt.Errorf("malformed spec: doesn't define a range: %q", spec)
 	}
-	old := parts[0]
 	ranges := make([]KeyRange, len(parts)-1)
+	s, err := HexKeyspaceId(parts[0]).Unhex()
+	if err != nil {
+		return nil, err
+	}
 
 	for i, p := range parts[1:] {
 		if p == "" && i != (len(parts)-2) {
 			return nil, fmt.Errorf("malformed spec: MinKey/MaxKey cannot be in the middle of the spec: %q", spec)
 		}
-		if p != "" && p <= old {
-			return nil, fmt.Errorf("malformed spec: shard limits should be in order: %q", spec)
-		}
-		s, err := HexKeyspaceId(old).Unhex()
-		if err != nil {
-			return nil, err
-		}
 		e, err := HexKeyspaceId(p).Unhex()
 		if err != nil {
 			return nil, err
 		}
+		// compare the keyspace ids, not their hex strings, so
+		// limits of any length and case are ordered correctly
+		if e != MaxKey && e <= s {
+			return nil, fmt.Errorf("malformed spec: shard limits should be in order: %q", spec)
+		}
 		ranges[i] = KeyRange{Start: s, End: e}
-		old = p
+		s = e
 	}
 	return ranges, nil
 }
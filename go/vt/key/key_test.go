@@ -106,12 +106,21 @@ func TestParseShardingSpec(t *testing.T) {
 			{Start: x40, End: x80},
 			{Start: x80, End: MaxKey},
 		},
+		// binary limits of different lengths and cases
+		"-40-8000000000000000000000000000000a-A0-": {
+			{Start: MinKey, End: KeyspaceId("\x40")},
+			{Start: KeyspaceId("\x40"), End: KeyspaceId("\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0a")},
+			{Start: KeyspaceId("\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0a"), End: KeyspaceId("\xa0")},
+			{Start: KeyspaceId("\xa0"), End: MaxKey},
+		},
 	}
 	badTable := []string{
 		"4000000000000000",
 		"---",
 		"4000000000000000--8000000000000000",
 		"4000000000000000-3000000000000000", // not in order
+		"a0-B0-b0",                          // not in order either
+		"-8-",                               // odd length
 	}
 	for key, wanted := range goodTable {
 		r, err := ParseShardingSpec(key)
@@ -233,3 +242,30 @@ func TestIntersectOverlap(t *testing.T) {
 		}
 	}
 }
+
+func TestKeyspaceIdType(t *testing.T) {
+	for _, s := range []string{"", "uint64", "bytes"} {
+		if _, err := ParseKeyspaceIdType(s); err != nil {
+			t.Errorf("ParseKeyspaceIdType(%q): %v", s, err)
+		}
+	}
+	if _, err := ParseKeyspaceIdType("int"); err == nil {
+		t.Errorf("ParseKeyspaceIdType(int) should fail")
+	}
+
+	table := []struct {
+		kit  KeyspaceIdType
+		kid  KeyspaceId
+		want string
+	}{
+		{KIT_UINT64, KeyspaceId("\x80"), "9223372036854775808"},
+		{KIT_UINT64, Uint64Key(12345).KeyspaceId(), "12345"},
+		{KIT_BYTES, KeyspaceId("\x80"), "0x80"},
+		{KIT_BYTES, KeyspaceId("\x01\xab\x00"), "0x01AB00"},
+	}
+	for _, x := range table {
+		if got := x.kit.SqlLiteral(x.kid); got != x.want {
+			t.Errorf("%v.SqlLiteral(%v) = %v, want %v", x.kit, x.kid.Hex(), got, x.want)
+		}
+	}
+}
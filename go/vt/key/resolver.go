@@ -0,0 +1,120 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package key
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// KeyspaceIdResolver computes the keyspace id of a row from the
+// values of its sharding columns, in their mysql text form. It is
+// used by vtgate to route queries, by the split clone to send rows
+// to their destination shards, and by filtered replication.
+type KeyspaceIdResolver interface {
+	Resolve(values [][]byte) (KeyspaceId, error)
+}
+
+// Registry for KeyspaceIdResolver implementations.
+var resolvers = make(map[string]KeyspaceIdResolver)
+
+// RegisterResolver adds a KeyspaceIdResolver. If a resolver with
+// that name already exists, panics. Call this in the 'init'
+// function in your module.
+func RegisterResolver(name string, resolver KeyspaceIdResolver) {
+	if resolvers[name] != nil {
+		panic(fmt.Errorf("Duplicate KeyspaceIdResolver registration for %v", name))
+	}
+	resolvers[name] = resolver
+}
+
+// GetResolver returns the resolver registered as name. An empty
+// name is the numeric resolver.
+func GetResolver(name string) (KeyspaceIdResolver, error) {
+	if name == "" {
+		name = "numeric"
+	}
+	resolver, ok := resolvers[name]
+	if !ok {
+		return nil, fmt.Errorf("no KeyspaceIdResolver named %v, have %v", name, ResolverNames())
+	}
+	return resolver, nil
+}
+
+// ResolverNames returns the sorted names of the registered resolvers.
+func ResolverNames() []string {
+	names := make([]string, 0, len(resolvers))
+	for name := range resolvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NumericResolver uses the value of a single unsigned integer column
+// as the keyspace id, so rows are split in numeric ranges.
+type NumericResolver struct{}
+
+func (NumericResolver) Resolve(values [][]byte) (KeyspaceId, error) {
+	if len(values) != 1 {
+		return "", fmt.Errorf("numeric keyspace id needs 1 value, got %v", len(values))
+	}
+	i, err := strconv.ParseUint(string(values[0]), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid numeric keyspace id %q: %v", values[0], err)
+	}
+	return Uint64Key(i).KeyspaceId(), nil
+}
+
+// BytesResolver uses the value of a single binary column as the
+// keyspace id, for KIT_BYTES keyspaces.
+type BytesResolver struct{}
+
+func (BytesResolver) Resolve(values [][]byte) (KeyspaceId, error) {
+	if len(values) != 1 {
+		return "", fmt.Errorf("binary keyspace id needs 1 value, got %v", len(values))
+	}
+	return KeyspaceId(values[0]), nil
+}
+
+// HexResolver decodes a single hex value into the keyspace id. It is
+// used by filtered replication for KIT_BYTES keyspaces, whose
+// keyspace_id comments are in hex.
+type HexResolver struct{}
+
+func (HexResolver) Resolve(values [][]byte) (KeyspaceId, error) {
+	if len(values) != 1 {
+		return "", fmt.Errorf("hex keyspace id needs 1 value, got %v", len(values))
+	}
+	return HexKeyspaceId(values[0]).Unhex()
+}
+
+// HashResolver uses the first 8 bytes of the md5 of the values as
+// the keyspace id, so rows are spread evenly between shards. It
+// works with any number of columns.
+type HashResolver struct{}
+
+func (HashResolver) Resolve(values [][]byte) (KeyspaceId, error) {
+	if len(values) == 0 {
+		return "", fmt.Errorf("hash keyspace id needs at least 1 value")
+	}
+	h := md5.New()
+	for _, v := range values {
+		// the length prefix keeps ("ab", "c") and ("a", "bc") apart
+		binary.Write(h, binary.BigEndian, uint32(len(v)))
+		h.Write(v)
+	}
+	return KeyspaceId(h.Sum(nil)[:8]), nil
+}
+
+func init() {
+	RegisterResolver("numeric", NumericResolver{})
+	RegisterResolver("bytes", BytesResolver{})
+	RegisterResolver("hex", HexResolver{})
+	RegisterResolver("hash", HashResolver{})
+}
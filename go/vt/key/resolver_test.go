@@ -0,0 +1,57 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package key
+
+import (
+	"testing"
+)
+
+func resolve(t *testing.T, name string, values ...string) KeyspaceId {
+	resolver, err := GetResolver(name)
+	if err != nil {
+		t.Fatalf("GetResolver(%v): %v", name, err)
+	}
+	b := make([][]byte, len(values))
+	for i, v := range values {
+		b[i] = []byte(v)
+	}
+	kid, err := resolver.Resolve(b)
+	if err != nil {
+		t.Fatalf("Resolve(%v): %v", values, err)
+	}
+	return kid
+}
+
+func TestResolvers(t *testing.T) {
+	if kid := resolve(t, "", "1"); kid != Uint64Key(1).KeyspaceId() {
+		t.Errorf("numeric: want %v, got %v", Uint64Key(1).KeyspaceId().Hex(), kid.Hex())
+	}
+	if _, err := (NumericResolver{}).Resolve([][]byte{[]byte("a")}); err == nil {
+		t.Errorf("numeric resolver should reject non numbers")
+	}
+	if _, err := (NumericResolver{}).Resolve([][]byte{[]byte("1"), []byte("2")}); err == nil {
+		t.Errorf("numeric resolver should reject composite keys")
+	}
+
+	if kid := resolve(t, "bytes", "\x01\x02"); kid != KeyspaceId("\x01\x02") {
+		t.Errorf("bytes: want 0102, got %v", kid.Hex())
+	}
+	if kid := resolve(t, "hex", "0102AB"); kid != KeyspaceId("\x01\x02\xab") {
+		t.Errorf("hex: want 0102AB, got %v", kid.Hex())
+	}
+
+	k1 := resolve(t, "hash", "ab", "c")
+	k2 := resolve(t, "hash", "a", "bc")
+	if len(k1) != 8 || k1 == k2 {
+		t.Errorf("hash: want 2 different 8 bytes keyspace ids, got %v and %v", k1.Hex(), k2.Hex())
+	}
+	if k := resolve(t, "hash", "ab", "c"); k != k1 {
+		t.Errorf("hash is not stable: %v and %v", k1.Hex(), k.Hex())
+	}
+
+	if _, err := GetResolver("unknown"); err == nil {
+		t.Errorf("GetResolver(unknown) should fail")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"time"
 
 	log "github.com/golang/glog"
@@ -17,6 +18,7 @@ import (
 	"github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/rpcplus"
 	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/dbconfigs"
 	"github.com/youtube/vitess/go/vt/key"
 )
 
@@ -98,7 +100,7 @@ func (dc *DBClient) handleError(err error) {
 
 func (dc *DBClient) Connect() error {
 	var err error
-	dc.dbConn, err = mysql.Connect(*dc.dbConfig)
+	dc.dbConn, err = dbconfigs.MysqlConnect(*dc.dbConfig)
 	if err != nil {
 		return fmt.Errorf("error in connecting to mysql db, err %v", err)
 	}
@@ -190,17 +192,39 @@ type BinlogPlayer struct {
 	addr      string
 	dbClient  VtClient
 	keyRange  key.KeyRange
+	tables    []string
 	blpPos    BlpPosition
 	blplStats *blplStats
+
+	// if stopAtGroupId is not empty, the player stops once it has
+	// applied the transaction with that group id
+	stopAtGroupId string
+}
+
+// NewBinlogPlayer returns a BinlogPlayer that will replicate from
+// startPosition. If stopAtGroupId is not empty, ApplyBinlogEvents
+// will return once that group id has been reached.
+func NewBinlogPlayer(dbClient VtClient, addr string, keyRange key.KeyRange, startPosition *BlpPosition, stopAtGroupId string) *BinlogPlayer {
+	return &BinlogPlayer{
+		addr:          addr,
+		dbClient:      dbClient,
+		keyRange:      keyRange,
+		blpPos:        *startPosition,
+		blplStats:     NewBlplStats(),
+		stopAtGroupId: stopAtGroupId,
+	}
 }
 
-func NewBinlogPlayer(dbClient VtClient, addr string, keyRange key.KeyRange, startPosition *BlpPosition) *BinlogPlayer {
+// NewBinlogPlayerTables returns a BinlogPlayer that will replicate
+// the provided tables, instead of a keyrange.
+func NewBinlogPlayerTables(dbClient VtClient, addr string, tables []string, startPosition *BlpPosition, stopAtGroupId string) *BinlogPlayer {
 	return &BinlogPlayer{
-		addr:      addr,
-		dbClient:  dbClient,
-		keyRange:  keyRange,
-		blpPos:    *startPosition,
-		blplStats: NewBlplStats(),
+		addr:          addr,
+		dbClient:      dbClient,
+		tables:        tables,
+		blpPos:        *startPosition,
+		blplStats:     NewBlplStats(),
+		stopAtGroupId: stopAtGroupId,
 	}
 }
 
@@ -273,6 +297,26 @@ func (blp *BinlogPlayer) processTransaction(tx *BinlogTransaction) (ok bool, err
 	return true, nil
 }
 
+// reachedStopPosition returns true if the player has applied
+// stopAtGroupId (group ids are increasing integers).
+func (blp *BinlogPlayer) reachedStopPosition() (bool, error) {
+	if blp.stopAtGroupId == "" {
+		return false, nil
+	}
+	stop, err := strconv.ParseInt(blp.stopAtGroupId, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid stop group id %v: %v", blp.stopAtGroupId, err)
+	}
+	if blp.blpPos.GroupId == "" {
+		return false, nil
+	}
+	current, err := strconv.ParseInt(blp.blpPos.GroupId, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid current group id %v: %v", blp.blpPos.GroupId, err)
+	}
+	return current >= stop, nil
+}
+
 func (blp *BinlogPlayer) exec(sql string) (*proto.QueryResult, error) {
 	queryStartTime := time.Now()
 	qr, err := blp.dbClient.ExecuteFetch(sql, 0, false)
@@ -287,13 +331,28 @@ func (blp *BinlogPlayer) exec(sql string) (*proto.QueryResult, error) {
 // ApplyBinlogEvents makes a gob rpc request to BinlogServer
 // and processes the events.
 func (blp *BinlogPlayer) ApplyBinlogEvents(interrupted chan struct{}) error {
-	log.Infof("BinlogPlayer client %v for keyrange '%v-%v' starting @ '%v', server: %v",
-		blp.blpPos.Uid,
-		blp.keyRange.Start.Hex(),
-		blp.keyRange.End.Hex(),
-		blp.blpPos.GroupId,
-		blp.addr,
-	)
+	if len(blp.tables) > 0 {
+		log.Infof("BinlogPlayer client %v for tables %v starting @ '%v', server: %v",
+			blp.blpPos.Uid,
+			blp.tables,
+			blp.blpPos.GroupId,
+			blp.addr,
+		)
+	} else {
+		log.Infof("BinlogPlayer client %v for keyrange '%v-%v' starting @ '%v', server: %v",
+			blp.blpPos.Uid,
+			blp.keyRange.Start.Hex(),
+			blp.keyRange.End.Hex(),
+			blp.blpPos.GroupId,
+			blp.addr,
+		)
+	}
+	if reached, err := blp.reachedStopPosition(); err != nil || reached {
+		if reached {
+			log.Infof("BinlogPlayer client %v already at stop position %v", blp.blpPos.Uid, blp.stopAtGroupId)
+		}
+		return err
+	}
 	rpcClient, err := rpcplus.DialHTTP("tcp", blp.addr)
 	defer rpcClient.Close()
 	if err != nil {
@@ -302,11 +361,20 @@ func (blp *BinlogPlayer) ApplyBinlogEvents(interrupted chan struct{}) error {
 	}
 
 	responseChan := make(chan *BinlogTransaction)
-	req := &KeyrangeRequest{
-		Keyrange: blp.keyRange,
-		GroupId:  blp.blpPos.GroupId,
+	var resp *rpcplus.Call
+	if len(blp.tables) > 0 {
+		req := &TablesRequest{
+			Tables:  blp.tables,
+			GroupId: blp.blpPos.GroupId,
+		}
+		resp = rpcClient.StreamGo("UpdateStream.StreamTables", req, responseChan)
+	} else {
+		req := &KeyrangeRequest{
+			Keyrange: blp.keyRange,
+			GroupId:  blp.blpPos.GroupId,
+		}
+		resp = rpcClient.StreamGo("UpdateStream.StreamKeyrange", req, responseChan)
 	}
-	resp := rpcClient.StreamGo("UpdateStream.StreamKeyrange", req, responseChan)
 
 processLoop:
 	for {
@@ -326,6 +394,12 @@ processLoop:
 				log.Infof("Retrying txn")
 				time.Sleep(1 * time.Second)
 			}
+			if reached, err := blp.reachedStopPosition(); err != nil || reached {
+				if reached {
+					log.Infof("BinlogPlayer client %v reached stop position %v", blp.blpPos.Uid, blp.stopAtGroupId)
+				}
+				return err
+			}
 		case <-interrupted:
 			return nil
 		}
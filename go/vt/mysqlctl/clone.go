@@ -328,6 +328,14 @@ func (mysqld *Mysqld) CreateSnapshot(dbName, sourceAddr string, allowHierarchica
 	if snapshotErr != nil {
 		return "", slaveStartRequired, readOnly, snapshotErr
 	}
+
+	// let the hook know where the manifest is
+	h := hook.NewHook("postflight_snapshot", []string{"--manifest=" + smFile})
+	h.ExtraEnv = hookExtraEnv
+	if err = h.ExecuteOptional(); err != nil {
+		return "", slaveStartRequired, readOnly, err
+	}
+
 	relative, err := filepath.Rel(mysqld.SnapshotDir, smFile)
 	if err != nil {
 		return "", slaveStartRequired, readOnly, nil
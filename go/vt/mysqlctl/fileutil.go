@@ -8,6 +8,7 @@ import (
 	"bufio"
 	//	"crypto/md5"
 	"encoding/hex"
+	"flag"
 	"fmt"
 	"hash"
 	//	"hash/crc64"
@@ -24,6 +25,7 @@ import (
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/cgzip"
+	"github.com/youtube/vitess/go/ioutil2"
 	"github.com/youtube/vitess/go/vt/key"
 )
 
@@ -33,6 +35,25 @@ var (
 	failureCounter   = 0
 )
 
+// partialFileSuffix is appended to the name of a file being fetched.
+const partialFileSuffix = ".partial"
+
+var snapshotFetchMaxRate = flag.Int64("snapshot-fetch-max-rate", 0, "maximum rate (in bytes per second) for all snapshot files fetched by this process, 0 for unlimited")
+
+var (
+	fetchBandwidthLimiterOnce sync.Once
+	fetchBandwidthLimiter     *ioutil2.BandwidthLimiter
+)
+
+// getFetchBandwidthLimiter returns the BandwidthLimiter shared by
+// all fetches, created from the command line flag on first use.
+func getFetchBandwidthLimiter() *ioutil2.BandwidthLimiter {
+	fetchBandwidthLimiterOnce.Do(func() {
+		fetchBandwidthLimiter = ioutil2.NewBandwidthLimiter(*snapshotFetchMaxRate)
+	})
+	return fetchBandwidthLimiter
+}
+
 func init() {
 	_, statErr := os.Stat("/tmp/vtSimulateFetchFailures")
 	simulateFailures = statErr == nil
@@ -349,10 +370,11 @@ func fetchSnapshotManifest(addr, dbName string, keyRange key.KeyRange) (*SplitSn
 	return ssm, nil
 }
 
-// fetchFile fetches data from the web server.  It then sends it to a
-// tee, which on one side has an hash checksum reader, and on the other
-// a gunzip reader writing to a file.  It will compare the hash
-// checksum after the copy is done.
+// fetchFile fetches data from the web server into dstFilename. The
+// data as served (possibly compressed) is first saved into a partial
+// file, so a transfer that failed can be resumed where it stopped by
+// the next call. Once the whole file was received, its hash checksum
+// is verified, and it is uncompressed if needed into dstFilename.
 func fetchFile(srcUrl, srcHash, dstFilename string) error {
 	log.Infof("fetchFile: starting to fetch %v from %v", dstFilename, srcUrl)
 
@@ -362,23 +384,77 @@ func fetchFile(srcUrl, srcHash, dstFilename string) error {
 		return dirErr
 	}
 
+	// get all the data in the partial file
+	partialFilename := dstFilename + partialFileSuffix
+	if err := downloadFile(srcUrl, partialFilename); err != nil {
+		return err
+	}
+
+	// check the hash
+	hash, err := hashFile(partialFilename)
+	if err != nil {
+		return err
+	}
+	if srcHash != hash {
+		// the data we have is bad, we need to start from scratch
+		os.Remove(partialFilename)
+		return fmt.Errorf("hash mismatch for %v, %v != %v", dstFilename, srcHash, hash)
+	}
+
+	// we're good
+	log.Infof("fetched snapshot file: %v", dstFilename)
+	return uncompressFile(partialFilename, dstFilename, strings.HasSuffix(srcUrl, ".gz"))
+}
+
+// downloadFile appends the data from srcUrl to partialFilename,
+// starting where the previous transfer stopped if the file already
+// exists.
+func downloadFile(srcUrl, partialFilename string) error {
+	var offset int64
+	if fi, err := os.Stat(partialFilename); err == nil {
+		offset = fi.Size()
+	}
+
 	// open the URL
 	req, err := http.NewRequest("GET", srcUrl, nil)
 	if err != nil {
 		return fmt.Errorf("NewRequest failed for %v: %v", srcUrl, err)
 	}
-	// we set the 'gzip' encoding ourselves so the library doesn't
-	// do it for us and ends up using go gzip (we want to use our own
-	// cgzip which is much faster)
-	req.Header.Set("Accept-Encoding", "gzip")
+	if offset > 0 {
+		// resume the transfer. The server won't compress a range
+		// on the fly.
+		log.Infof("downloadFile: resuming %v at offset %v", srcUrl, offset)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+	} else {
+		// we set the 'gzip' encoding ourselves so the library
+		// doesn't do it for us and ends up using go gzip (we want
+		// to use our own cgzip which is much faster)
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode != 200 {
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// we're getting the whole file
+		flags |= os.O_TRUNC
+	case http.StatusPartialContent:
+		var start int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+			return fmt.Errorf("failed fetching %v: unexpected Content-Range %q for offset %v", srcUrl, resp.Header.Get("Content-Range"), offset)
+		}
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		// we already have all the data, the hash check will
+		// tell us if it's right
+		return nil
+	default:
 		return fmt.Errorf("failed fetching %v: %v", srcUrl, resp.Status)
 	}
-	defer resp.Body.Close()
 
 	// see if we need some uncompression
 	var reader io.Reader = resp.Body
@@ -395,6 +471,68 @@ func fetchFile(srcUrl, srcHash, dstFilename string) error {
 			return fmt.Errorf("unsupported Content-Encoding: %v", ce)
 		}
 	}
+	reader = ioutil2.NewLimitedReader(reader, getFetchBandwidthLimiter())
+
+	// see if we need to introduce failures
+	if simulateFailures {
+		failureCounter++
+		if failureCounter%10 == 0 {
+			return fmt.Errorf("Simulated error")
+		}
+	}
+
+	// copy the data into the partial file. We keep what we got
+	// even if the copy fails.
+	dstFile, err := os.OpenFile(partialFilename, flags, 0664)
+	if err != nil {
+		return err
+	}
+	dst := bufio.NewWriterSize(dstFile, 2*1024*1024)
+	_, err = io.Copy(dst, reader)
+	if flushErr := dst.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := dstFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// hashFile returns the hash checksum of a file.
+func hashFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := newHasher()
+	if _, err := io.Copy(hasher, bufio.NewReaderSize(f, 2*1024*1024)); err != nil {
+		return "", err
+	}
+	return hasher.HashString(), nil
+}
+
+// uncompressFile moves srcFilename to dstFilename, uncompressing it
+// if necessary.
+func uncompressFile(srcFilename, dstFilename string, compressed bool) error {
+	if !compressed {
+		if err := os.Chmod(srcFilename, 0664); err != nil {
+			return err
+		}
+		return os.Rename(srcFilename, dstFilename)
+	}
+
+	srcFile, err := os.Open(srcFilename)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	gz, err := cgzip.NewReader(bufio.NewReaderSize(srcFile, 2*1024*1024))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
 
 	// create a temporary file to uncompress to
 	dir, filePrefix := path.Split(dstFilename)
@@ -410,58 +548,23 @@ func fetchFile(srcUrl, srcHash, dstFilename string) error {
 		os.Remove(dstFile.Name())
 	}()
 
-	// create a buffering output
 	dst := bufio.NewWriterSize(dstFile, 2*1024*1024)
-
-	// create hash to write the compressed data to
-	hasher := newHasher()
-
-	// create a Tee: we split the HTTP input into the hasher
-	// and into the gunziper
-	tee := io.TeeReader(reader, hasher)
-
-	// create the uncompresser
-	var decompressor io.Reader
-	if strings.HasSuffix(srcUrl, ".gz") {
-		gz, err := cgzip.NewReader(tee)
-		if err != nil {
-			return err
-		}
-		defer gz.Close()
-		decompressor = gz
-	} else {
-		decompressor = tee
-	}
-
-	// see if we need to introduce failures
-	if simulateFailures {
-		failureCounter++
-		if failureCounter%10 == 0 {
-			return fmt.Errorf("Simulated error")
-		}
-	}
-
-	// copy the data. Will also write to the hasher
-	if _, err = io.Copy(dst, decompressor); err != nil {
+	if _, err = io.Copy(dst, gz); err != nil {
 		return err
 	}
-
-	// check the hash
-	hash := hasher.HashString()
-	if srcHash != hash {
-		return fmt.Errorf("hash mismatch for %v, %v != %v", dstFilename, srcHash, hash)
+	if err := dst.Flush(); err != nil {
+		return err
 	}
-
-	// we're good
-	log.Infof("fetched snapshot file: %v", dstFilename)
-	dst.Flush()
 	dstFile.Close()
 
 	// atomically move uncompressed file
 	if err := os.Chmod(dstFile.Name(), 0664); err != nil {
 		return err
 	}
-	return os.Rename(dstFile.Name(), dstFilename)
+	if err := os.Rename(dstFile.Name(), dstFilename); err != nil {
+		return err
+	}
+	return os.Remove(srcFilename)
 }
 
 // fetchFileWithRetry fetches data from the web server, retrying a few
@@ -552,6 +655,8 @@ func fetchFiles(snapshotManifest *SnapshotManifest, destinationPath string, fetc
 	// FIXME(alainjobart) it seems extreme to delete all files if
 	// the last one failed. Maybe we shouldn't, and if a file already
 	// exists, we hash it before retransmitting.
+	// Note the partial files are kept, so the next restore can
+	// resume the transfers.
 	if err != nil {
 		log.Infof("Error happened, deleting all the files we already got")
 		for _, fi := range snapshotManifest.Files {
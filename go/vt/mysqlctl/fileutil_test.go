@@ -0,0 +1,92 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestFetchFileResume(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	hasher := newHasher()
+	hasher.Write(data)
+	hash := hasher.HashString()
+
+	// the first request is interrupted half way, the next ones
+	// are served by the library, which supports ranges
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		if len(ranges) == 1 {
+			rw.Header().Set("Content-Length", fmt.Sprintf("%v", len(data)))
+			rw.WriteHeader(http.StatusOK)
+			rw.Write(data[:len(data)/2])
+			return
+		}
+		http.ServeContent(rw, req, "file", time.Now(), bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "fetchfile")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	dst := path.Join(dir, "file")
+
+	if err := fetchFile(server.URL+"/file", hash, dst); err == nil {
+		t.Fatalf("first fetchFile should have failed")
+	}
+	fi, err := os.Stat(dst + partialFileSuffix)
+	if err != nil || fi.Size() != int64(len(data)/2) {
+		t.Fatalf("unexpected partial file after failure: %v %v", fi, err)
+	}
+
+	if err := fetchFile(server.URL+"/file", hash, dst); err != nil {
+		t.Fatalf("second fetchFile failed: %v", err)
+	}
+	if expected := fmt.Sprintf("bytes=%v-", len(data)/2); len(ranges) != 2 || ranges[1] != expected {
+		t.Errorf("unexpected ranges: %v, expected %v", ranges, expected)
+	}
+	got, err := ioutil.ReadFile(dst)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("unexpected fetched file (%v bytes): %v", len(got), err)
+	}
+	if _, err := os.Stat(dst + partialFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("partial file should be gone: %v", err)
+	}
+}
+
+func TestFetchFileBadHash(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.ServeContent(rw, req, "file", time.Now(), bytes.NewReader([]byte("some data")))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "fetchfile")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	dst := path.Join(dir, "file")
+
+	if err := fetchFile(server.URL+"/file", "badhash", dst); err == nil {
+		t.Fatalf("fetchFile should have failed")
+	}
+	if _, err := os.Stat(dst + partialFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("partial file with bad data should be gone: %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("destination file should not exist: %v", err)
+	}
+}
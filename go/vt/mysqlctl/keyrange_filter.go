@@ -6,7 +6,6 @@ package mysqlctl
 
 import (
 	"bytes"
-	"strconv"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/vt/key"
@@ -16,10 +15,11 @@ var KEYSPACE_ID_COMMENT = []byte("/* EMD keyspace_id:")
 var SPACE = []byte(" ")
 
 // KeyrangeFilterFunc returns a function that calls sendReply only if statements
-// in the transaction match the specified keyrange. The resulting function can be
-// passed into the BinlogStreamer: bls.Stream(file, pos, sendTransaction) ->
-// bls.Stream(file, pos, KeyrangeFilterFunc(sendTransaction))
-func KeyrangeFilterFunc(keyrange key.KeyRange, sendReply sendTransactionFunc) sendTransactionFunc {
+// in the transaction match the specified keyrange. The keyspace id of a statement
+// is computed by resolver from the value of its keyspace_id comment. The resulting
+// function can be passed into the BinlogStreamer: bls.Stream(file, pos, sendTransaction) ->
+// bls.Stream(file, pos, KeyrangeFilterFunc(resolver, keyrange, sendTransaction))
+func KeyrangeFilterFunc(resolver key.KeyspaceIdResolver, keyrange key.KeyRange, sendReply sendTransactionFunc) sendTransactionFunc {
 	return func(reply *BinlogTransaction) error {
 		matched := false
 		filtered := make([]Statement, 0, len(reply.Statements))
@@ -44,13 +44,13 @@ func KeyrangeFilterFunc(keyrange key.KeyRange, sendReply sendTransactionFunc) se
 					log.Errorf("Error parsing keyspace id: %s", string(statement.Sql))
 					continue
 				}
-				id, err := strconv.ParseUint(string(statement.Sql[idstart:idstart+idend]), 10, 64)
+				id, err := resolver.Resolve([][]byte{statement.Sql[idstart : idstart+idend]})
 				if err != nil {
 					// TODO(sougou): increment error counter
-					log.Errorf("Error parsing keyspace id: %s", string(statement.Sql))
+					log.Errorf("Error parsing keyspace id: %s: %v", string(statement.Sql), err)
 					continue
 				}
-				if !keyrange.Contains(key.Uint64Key(id).KeyspaceId()) {
+				if !keyrange.Contains(id) {
 					continue
 				}
 				filtered = append(filtered, statement)
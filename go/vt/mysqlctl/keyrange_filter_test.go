@@ -33,7 +33,7 @@ func TestKeyrangeFilterPass(t *testing.T) {
 		GroupId: "1",
 	}
 	var got string
-	f := KeyrangeFilterFunc(testKeyrange, func(reply *BinlogTransaction) error {
+	f := KeyrangeFilterFunc(key.NumericResolver{}, testKeyrange, func(reply *BinlogTransaction) error {
 		got = bltToString(reply)
 		return nil
 	})
@@ -58,7 +58,7 @@ func TestKeyrangeFilterSkip(t *testing.T) {
 		GroupId: "1",
 	}
 	var got string
-	f := KeyrangeFilterFunc(testKeyrange, func(reply *BinlogTransaction) error {
+	f := KeyrangeFilterFunc(key.NumericResolver{}, testKeyrange, func(reply *BinlogTransaction) error {
 		got = bltToString(reply)
 		return nil
 	})
@@ -83,7 +83,7 @@ func TestKeyrangeFilterDDL(t *testing.T) {
 		GroupId: "1",
 	}
 	var got string
-	f := KeyrangeFilterFunc(testKeyrange, func(reply *BinlogTransaction) error {
+	f := KeyrangeFilterFunc(key.NumericResolver{}, testKeyrange, func(reply *BinlogTransaction) error {
 		got = bltToString(reply)
 		return nil
 	})
@@ -114,7 +114,7 @@ func TestKeyrangeFilterMalformed(t *testing.T) {
 		GroupId: "1",
 	}
 	var got string
-	f := KeyrangeFilterFunc(testKeyrange, func(reply *BinlogTransaction) error {
+	f := KeyrangeFilterFunc(key.NumericResolver{}, testKeyrange, func(reply *BinlogTransaction) error {
 		got = bltToString(reply)
 		return nil
 	})
@@ -125,6 +125,35 @@ func TestKeyrangeFilterMalformed(t *testing.T) {
 	}
 }
 
+func TestKeyrangeFilterBytes(t *testing.T) {
+	input := BinlogTransaction{
+		Statements: []Statement{
+			{
+				Category: BL_DML,
+				Sql:      []byte("dml1 /* EMD keyspace_id:7FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF */"),
+			}, {
+				Category: BL_DML,
+				Sql:      []byte("dml2 /* EMD keyspace_id:80000000000000000000000000000001 */"),
+			},
+		},
+		GroupId: "1",
+	}
+	var got string
+	kr, err := key.ParseKeyRangeParts("80", "")
+	if err != nil {
+		t.Fatalf("ParseKeyRangeParts failed: %v", err)
+	}
+	f := KeyrangeFilterFunc(key.HexResolver{}, kr, func(reply *BinlogTransaction) error {
+		got = bltToString(reply)
+		return nil
+	})
+	f(&input)
+	want := `statement: <4, "dml2 /* EMD keyspace_id:80000000000000000000000000000001 */"> position: "1" `
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
 func bltToString(tx *BinlogTransaction) string {
 	result := ""
 	for _, statement := range tx.Statements {
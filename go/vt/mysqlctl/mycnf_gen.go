@@ -10,7 +10,10 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
+	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/youtube/vitess/go/vt/env"
@@ -75,6 +78,32 @@ func MycnfFile(uid uint32) string {
 	return path.Join(TabletDir(uid), "my.cnf")
 }
 
+// ListTabletUids returns the uids of the mysqld instances that were
+// initialized on this host, i.e. the tablet directories that have a
+// my.cnf file. They are sorted.
+func ListTabletUids() ([]uint32, error) {
+	// ReadDir sorts by name, and the uids are zero-padded
+	files, err := ioutil.ReadDir(env.VtDataRoot())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]uint32, 0, len(files))
+	for _, fi := range files {
+		if !fi.IsDir() || !strings.HasPrefix(fi.Name(), "vt_") {
+			continue
+		}
+		uid, err := strconv.ParseUint(fi.Name()[3:], 10, 32)
+		if err != nil || TabletDir(uint32(uid)) != path.Join(env.VtDataRoot(), fi.Name()) {
+			continue
+		}
+		if _, err := os.Stat(MycnfFile(uint32(uid))); err != nil {
+			continue
+		}
+		result = append(result, uint32(uid))
+	}
+	return result, nil
+}
+
 func TopLevelDirs() []string {
 	return []string{dataDir, innodbDir, relayLogDir, binLogDir}
 }
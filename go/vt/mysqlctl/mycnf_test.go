@@ -6,6 +6,7 @@ package mysqlctl
 
 import (
 	"io/ioutil"
+	"os"
 	"path"
 	"testing"
 
@@ -51,3 +52,41 @@ func TestMycnf(t *testing.T) {
 		t.Logf("socket file %v", mycnf.SocketFile)
 	}
 }
+
+func TestListTabletUids(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mycnf_test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	oldDataRoot := os.Getenv("VTDATAROOT")
+	os.Setenv("VTDATAROOT", dir)
+	defer os.Setenv("VTDATAROOT", oldDataRoot)
+
+	// two initialized instances, one without a my.cnf, and a few
+	// directories that are not tablets
+	for _, uid := range []uint32{62344, 41983, 100} {
+		if err := os.MkdirAll(TabletDir(uid), 0775); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if uid == 100 {
+			continue
+		}
+		if err := ioutil.WriteFile(MycnfFile(uid), []byte("[mysqld]\n"), 0664); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	for _, name := range []string{"snapshot", "vt_abc", "vt_12"} {
+		if err := os.MkdirAll(path.Join(dir, name), 0775); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+	}
+
+	uids, err := ListTabletUids()
+	if err != nil {
+		t.Fatalf("ListTabletUids: %v", err)
+	}
+	if len(uids) != 2 || uids[0] != 41983 || uids[1] != 62344 {
+		t.Errorf("ListTabletUids: got %v", uids)
+	}
+}
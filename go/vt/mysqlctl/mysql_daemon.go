@@ -13,6 +13,16 @@ type MysqlDaemon interface {
 	// GetMasterAddr returns the mysql master address, as shown by
 	// 'show slave status'.
 	GetMasterAddr() (string, error)
+
+	// IsReadOnly returns the value of the read_only variable.
+	IsReadOnly() (bool, error)
+
+	// SetReadOnly sets the read_only variable.
+	SetReadOnly(on bool) error
+
+	// DemoteMaster makes a master read-only (and super_read_only
+	// if possible), and returns its position.
+	DemoteMaster() (*ReplicationPosition, error)
 }
 
 // FakeMysqlDaemon implements MysqlDaemon and allows the user to fake
@@ -21,6 +31,15 @@ type FakeMysqlDaemon struct {
 	// will be returned by GetMasterAddr(). Set to "" to return
 	// ErrNotSlave, or to "ERROR" to return an error.
 	MasterAddr string
+
+	// ReadOnly is the value of read_only, changed by SetReadOnly.
+	ReadOnly bool
+
+	// ReadOnlyStuck makes SetReadOnly silently leave ReadOnly alone.
+	ReadOnlyStuck bool
+
+	// MasterPosition is returned by DemoteMaster().
+	MasterPosition ReplicationPosition
 }
 
 func (fmd *FakeMysqlDaemon) GetMasterAddr() (string, error) {
@@ -32,3 +51,22 @@ func (fmd *FakeMysqlDaemon) GetMasterAddr() (string, error) {
 	}
 	return fmd.MasterAddr, nil
 }
+
+func (fmd *FakeMysqlDaemon) IsReadOnly() (bool, error) {
+	return fmd.ReadOnly, nil
+}
+
+func (fmd *FakeMysqlDaemon) SetReadOnly(on bool) error {
+	if !fmd.ReadOnlyStuck {
+		fmd.ReadOnly = on
+	}
+	return nil
+}
+
+func (fmd *FakeMysqlDaemon) DemoteMaster() (*ReplicationPosition, error) {
+	if err := fmd.SetReadOnly(true); err != nil {
+		return nil, err
+	}
+	position := fmd.MasterPosition
+	return &position, nil
+}
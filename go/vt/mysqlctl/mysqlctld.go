@@ -0,0 +1,100 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"errors"
+	"flag"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	rpc "github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	vtrpc "github.com/youtube/vitess/go/vt/rpc"
+)
+
+// This file contains the RPC service exported by mysqlctld, a daemon
+// that owns the mysqld process, and the client used to talk to it.
+// When -mysqlctld-addr is set, Start and Shutdown ask mysqlctld to
+// start and stop mysqld, instead of doing it in this process. That
+// way mysqld is not tied to the lifecycle of the process using it.
+
+var mysqlctldAddr = flag.String("mysqlctld-addr", "", "address of the mysqlctld daemon managing mysqld, if empty mysqld is started and stopped directly")
+
+// how long we wait to connect to mysqlctld
+const mysqlctldConnectTimeout = 10 * time.Second
+
+var errNoMysqlctld = errors.New("mysqld is not managed by mysqlctld, use -mysqlctld-addr")
+
+type StartArgs struct {
+	MysqlWaitTime time.Duration
+}
+
+type ShutdownArgs struct {
+	WaitForMysqld bool
+	MysqlWaitTime time.Duration
+}
+
+// MysqlctlServer is the RPC service exported by mysqlctld. The
+// service name to use is 'MysqlctlServer'. Only one operation runs at
+// a time.
+type MysqlctlServer struct {
+	mu     sync.Mutex
+	mysqld *Mysqld
+}
+
+// Start starts mysqld, and waits for it to be ready.
+func (ms *MysqlctlServer) Start(args *StartArgs, reply *vtrpc.UnusedResponse) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return startLocal(ms.mysqld, args.MysqlWaitTime)
+}
+
+// Shutdown stops mysqld.
+func (ms *MysqlctlServer) Shutdown(args *ShutdownArgs, reply *vtrpc.UnusedResponse) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return shutdownLocal(ms.mysqld, args.WaitForMysqld, args.MysqlWaitTime)
+}
+
+// ReInit tears down the existing mysqld and its data, and creates a
+// brand new one.
+func (ms *MysqlctlServer) ReInit(args *StartArgs, reply *vtrpc.UnusedResponse) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if err := Teardown(ms.mysqld, true); err != nil {
+		return err
+	}
+	return Init(ms.mysqld, args.MysqlWaitTime)
+}
+
+// RegisterMysqlctlServer registers the MysqlctlServer RPC service
+// for the given mysqld.
+func RegisterMysqlctlServer(mysqld *Mysqld) {
+	rpc.Register(&MysqlctlServer{mysqld: mysqld})
+}
+
+// callMysqlctld calls a MysqlctlServer method on the mysqlctld
+// daemon at -mysqlctld-addr.
+func callMysqlctld(method string, args interface{}) error {
+	log.Infof("calling mysqlctld %v: MysqlctlServer.%v", *mysqlctldAddr, method)
+	rpcClient, err := bsonrpc.DialHTTP("tcp", *mysqlctldAddr, mysqlctldConnectTimeout, nil)
+	if err != nil {
+		return err
+	}
+	defer rpcClient.Close()
+	var reply vtrpc.UnusedResponse
+	return rpcClient.Call("MysqlctlServer."+method, args, &reply)
+}
+
+// ReInit asks mysqlctld to tear down mysqld and create a new one.
+// It only works when mysqld is managed by mysqlctld.
+func ReInit(mysqlWaitTime time.Duration) error {
+	if *mysqlctldAddr == "" {
+		return errNoMysqlctld
+	}
+	return callMysqlctld("ReInit", &StartArgs{MysqlWaitTime: mysqlWaitTime})
+}
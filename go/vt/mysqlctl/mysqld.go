@@ -25,6 +25,7 @@ import (
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/mysql"
 	"github.com/youtube/vitess/go/netutil"
+	"github.com/youtube/vitess/go/vt/dbconfigs"
 	vtenv "github.com/youtube/vitess/go/vt/env"
 	"github.com/youtube/vitess/go/vt/hook"
 )
@@ -64,7 +65,7 @@ func NewMysqld(config *Mycnf, dba, repl mysql.ConnectionParams) *Mysqld {
 	superParams := dba
 	superParams.DbName = ""
 	createSuperConnection := func() (*mysql.Connection, error) {
-		return mysql.Connect(superParams)
+		return dbconfigs.MysqlConnect(superParams)
 	}
 	return &Mysqld{config,
 		dba,
@@ -75,7 +76,16 @@ func NewMysqld(config *Mycnf, dba, repl mysql.ConnectionParams) *Mysqld {
 	}
 }
 
+// Start starts mysqld, using mysqlctld if -mysqlctld-addr is set,
+// and waits for it to be ready.
 func Start(mt *Mysqld, mysqlWaitTime time.Duration) error {
+	if *mysqlctldAddr != "" {
+		return callMysqlctld("Start", &StartArgs{MysqlWaitTime: mysqlWaitTime})
+	}
+	return startLocal(mt, mysqlWaitTime)
+}
+
+func startLocal(mt *Mysqld, mysqlWaitTime time.Duration) error {
 	var name string
 
 	// try the mysqld start hook, if any
@@ -103,11 +113,11 @@ func Start(mt *Mysqld, mysqlWaitTime time.Duration) error {
 		log.Infof("mysqlctl.Start mysqlWaitTime:%v %#v", mysqlWaitTime, cmd)
 		_, err = cmd.StderrPipe()
 		if err != nil {
-			return nil
+			return err
 		}
 		err = cmd.Start()
 		if err != nil {
-			return nil
+			return err
 		}
 
 		// wait so we don't get a bunch of defunct processes
@@ -141,6 +151,13 @@ This can actually take a *long* time if the buffer cache needs to be fully
 flushed - on the order of 20-30 minutes.
 */
 func Shutdown(mt *Mysqld, waitForMysqld bool, mysqlWaitTime time.Duration) error {
+	if *mysqlctldAddr != "" {
+		return callMysqlctld("Shutdown", &ShutdownArgs{WaitForMysqld: waitForMysqld, MysqlWaitTime: mysqlWaitTime})
+	}
+	return shutdownLocal(mt, waitForMysqld, mysqlWaitTime)
+}
+
+func shutdownLocal(mt *Mysqld, waitForMysqld bool, mysqlWaitTime time.Duration) error {
 	log.Infof("mysqlctl.Shutdown")
 	// possibly mysql is already shutdown, check for a few files first
 	_, socketPathErr := os.Stat(mt.config.SocketFile)
@@ -209,8 +226,15 @@ func execCmd(name string, args, env []string, dir string) (cmd *exec.Cmd, err er
 	return cmd, err
 }
 
+// Init creates the tablet directories, generates my.cnf from the
+// templates, and starts a new mysqld with the bootstrap database. It
+// refuses to run on a tablet directory that was already initialized,
+// as that would overwrite the existing data: use Teardown first.
 func Init(mt *Mysqld, mysqlWaitTime time.Duration) error {
 	log.Infof("mysqlctl.Init")
+	if err := mt.checkNotInitialized(); err != nil {
+		return err
+	}
 	err := mt.createDirs()
 	if err != nil {
 		log.Errorf("%s", err.Error())
@@ -284,6 +308,27 @@ func Init(mt *Mysqld, mysqlWaitTime time.Duration) error {
 	return mt.executeSuperQueryList(sqlCmds)
 }
 
+// checkNotInitialized returns an error if a previous Init left
+// a my.cnf file or some data files behind.
+func (mt *Mysqld) checkNotInitialized() error {
+	if _, err := os.Stat(mt.config.path); err == nil {
+		return fmt.Errorf("%v already exists, mysqld was already initialized, use teardown first", mt.config.path)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	files, err := ioutil.ReadDir(mt.config.DataDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(files) > 0 {
+		return fmt.Errorf("%v is not empty, mysqld was already initialized, use teardown first", mt.config.DataDir)
+	}
+	return nil
+}
+
 func (mt *Mysqld) createDirs() error {
 	log.Infof("creating directory %s", mt.TabletDir)
 	if err := os.MkdirAll(mt.TabletDir, 0775); err != nil {
@@ -383,7 +428,7 @@ func (mysqld *Mysqld) Port() int {
 
 func (mysqld *Mysqld) Addr() string {
 	hostname := netutil.FullyQualifiedHostnameOrPanic()
-	return fmt.Sprintf("%v:%v", hostname, mysqld.config.MysqlPort)
+	return netutil.JoinHostPort(hostname, mysqld.config.MysqlPort)
 }
 
 func (mysqld *Mysqld) IpAddr() string {
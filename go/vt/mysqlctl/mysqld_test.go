@@ -5,6 +5,9 @@
 package mysqlctl
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 )
 
@@ -48,3 +51,46 @@ func TestStartShutdown(t *testing.T) {
 		t.Errorf("Teardown(1) err: %v", err)
 	}
 }
+
+func TestCheckNotInitialized(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mysqld_test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	mycnf := NewMycnf(0, 3700, VtReplParams{})
+	mycnf.path = path.Join(dir, "my.cnf")
+	mycnf.DataDir = path.Join(dir, "data")
+	mysqld := NewMysqld(mycnf, DefaultDbaParams, DefaultReplParams)
+
+	// nothing there yet
+	if err := mysqld.checkNotInitialized(); err != nil {
+		t.Errorf("checkNotInitialized(empty): %v", err)
+	}
+
+	// empty data directory is fine
+	if err := os.Mkdir(mycnf.DataDir, 0775); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := mysqld.checkNotInitialized(); err != nil {
+		t.Errorf("checkNotInitialized(empty data dir): %v", err)
+	}
+
+	// data files are not
+	if err := ioutil.WriteFile(path.Join(mycnf.DataDir, "ibdata1"), []byte("data"), 0664); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := mysqld.checkNotInitialized(); err == nil {
+		t.Errorf("checkNotInitialized(data files) should have failed")
+	}
+
+	// and neither is an existing my.cnf
+	os.RemoveAll(mycnf.DataDir)
+	if err := ioutil.WriteFile(mycnf.path, []byte("[mysqld]\n"), 0664); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := mysqld.checkNotInitialized(); err == nil {
+		t.Errorf("checkNotInitialized(my.cnf) should have failed")
+	}
+}
@@ -13,9 +13,21 @@ import (
 
 // if the master is still alive, then we need to demote it gracefully
 // make it read-only, flush the writes and get the position
+//
+// super_read_only is also set when mysqld has it, so the SUPER users
+// (like the dba connections) cannot write either.
 func (mysqld *Mysqld) DemoteMaster() (*ReplicationPosition, error) {
 	// label as TYPE_REPLICA
-	mysqld.SetReadOnly(true)
+	if err := mysqld.SetReadOnly(true); err != nil {
+		return nil, err
+	}
+	switch err := mysqld.SetSuperReadOnly(true); err {
+	case nil:
+	case ErrNoSuperReadOnly:
+		log.Warningf("mysqld has no super_read_only, the demoted master is only read_only")
+	default:
+		return nil, err
+	}
 	cmds := []string{
 		"FLUSH TABLES WITH READ LOCK",
 		"UNLOCK TABLES",
@@ -31,7 +43,11 @@ func (mysqld *Mysqld) DemoteMaster() (*ReplicationPosition, error) {
 // replicationState: info slaves need to reparent themselves
 // waitPosition: slaves can wait for this position when restarting replication
 // timePromoted: this timestamp (unix nanoseconds) is inserted into _vt.replication_log to verify the replication config
-func (mysqld *Mysqld) PromoteSlave(setReadWrite bool, hookExtraEnv map[string]string) (replicationState *ReplicationState, waitPosition *ReplicationPosition, timePromoted int64, err error) {
+//
+// journal is completed with timePromoted and the new position, and
+// inserted into _vt.reparent_journal before the wait-point, so the
+// slaves have it once they reach waitPosition.
+func (mysqld *Mysqld) PromoteSlave(setReadWrite bool, hookExtraEnv map[string]string, journal *ReparentJournalEntry) (replicationState *ReplicationState, waitPosition *ReplicationPosition, timePromoted int64, err error) {
 	if err = mysqld.StopSlave(hookExtraEnv); err != nil {
 		return
 	}
@@ -67,9 +83,14 @@ func (mysqld *Mysqld) PromoteSlave(setReadWrite bool, hookExtraEnv map[string]st
 	newAddr := replicationState.MasterAddr()
 	newPos := replicationState.ReplicationPosition.MapKey()
 	timePromoted = time.Now().UnixNano()
-	// write a row to verify that replication is functioning
+	journal.TimeCreatedNs = timePromoted
+	journal.Position = newPos
+	// write a row to verify that replication is functioning, and
+	// record the reparent in the journal
 	cmds = []string{
 		fmt.Sprintf("INSERT INTO _vt.replication_log (time_created_ns, note) VALUES (%v, 'reparent check')", timePromoted),
+		createReparentJournal,
+		insertReparentJournal(journal),
 	}
 	if err = mysqld.executeSuperQueryList(cmds); err != nil {
 		return
@@ -118,7 +139,10 @@ func (mysqld *Mysqld) RestartSlave(replicationState *ReplicationState, waitPosit
 		return err
 	}
 
-	return mysqld.CheckReplication(timeCheck)
+	if err := mysqld.CheckReplication(timeCheck); err != nil {
+		return err
+	}
+	return mysqld.checkReparentJournal(timeCheck)
 }
 
 // Check for the magic row inserted under controlled reparenting.
@@ -0,0 +1,107 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/youtube/vitess/go/mysql/proto"
+)
+
+/*
+The reparent journal is the durable history of the reparents of a
+shard: every new master inserts a row into _vt.reparent_journal when
+it is promoted, and the slaves get the row through replication. Two
+tablets of a shard that don't agree on the last row of their journal
+don't agree on who the master is.
+*/
+
+// The table is also created on the fly, for the databases that were
+// bootstrapped before it existed. The statement is replicated, so
+// the slaves create it too.
+const createReparentJournal = `CREATE TABLE IF NOT EXISTS _vt.reparent_journal (
+  time_created_ns bigint primary key,
+  action_name varchar(250) NOT NULL,
+  old_master_alias varchar(32) NOT NULL,
+  new_master_alias varchar(32) NOT NULL,
+  replication_position varchar(255) NOT NULL)`
+
+// ReparentJournalEntry is a row of _vt.reparent_journal.
+type ReparentJournalEntry struct {
+	TimeCreatedNs int64
+
+	// Action is the action that promoted the new master.
+	Action string
+
+	// OldMaster is the alias of the previous master, empty if
+	// the new master was not a slave.
+	OldMaster string
+	NewMaster string
+
+	// Position is the replication position of the new master
+	// right after its promotion.
+	Position string
+}
+
+func (entry *ReparentJournalEntry) String() string {
+	return fmt.Sprintf("ReparentJournalEntry{%v %v %v -> %v at %v}", entry.TimeCreatedNs, entry.Action, entry.OldMaster, entry.NewMaster, entry.Position)
+}
+
+func insertReparentJournal(entry *ReparentJournalEntry) string {
+	return fmt.Sprintf("INSERT INTO _vt.reparent_journal (time_created_ns, action_name, old_master_alias, new_master_alias, replication_position) VALUES (%v, '%v', '%v', '%v', '%v')", entry.TimeCreatedNs, entry.Action, entry.OldMaster, entry.NewMaster, entry.Position)
+}
+
+// ReparentJournalQuery returns the query that reads the last limit
+// entries of the reparent journal, most recent first.
+func ReparentJournalQuery(limit int) string {
+	return fmt.Sprintf("SELECT time_created_ns, action_name, old_master_alias, new_master_alias, replication_position FROM _vt.reparent_journal ORDER BY time_created_ns DESC LIMIT %v", limit)
+}
+
+// ReparentJournalFromQueryResult converts the result of
+// ReparentJournalQuery into journal entries.
+func ReparentJournalFromQueryResult(qr *proto.QueryResult) ([]*ReparentJournalEntry, error) {
+	entries := make([]*ReparentJournalEntry, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		if len(row) != 5 {
+			return nil, fmt.Errorf("unexpected reparent journal row: %v", row)
+		}
+		timeCreatedNs, err := strconv.ParseInt(row[0].String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad reparent journal time %v: %v", row[0].String(), err)
+		}
+		entries = append(entries, &ReparentJournalEntry{
+			TimeCreatedNs: timeCreatedNs,
+			Action:        row[1].String(),
+			OldMaster:     row[2].String(),
+			NewMaster:     row[3].String(),
+			Position:      row[4].String(),
+		})
+	}
+	return entries, nil
+}
+
+// ReadReparentJournal returns the last limit entries of the reparent
+// journal, most recent first.
+func (mysqld *Mysqld) ReadReparentJournal(limit int) ([]*ReparentJournalEntry, error) {
+	qr, err := mysqld.fetchSuperQuery(ReparentJournalQuery(limit))
+	if err != nil {
+		return nil, err
+	}
+	return ReparentJournalFromQueryResult(qr)
+}
+
+// checkReparentJournal checks the journal entry of a reparent was
+// replicated.
+func (mysqld *Mysqld) checkReparentJournal(timeCreatedNs int64) error {
+	qr, err := mysqld.fetchSuperQuery(fmt.Sprintf("SELECT new_master_alias FROM _vt.reparent_journal WHERE time_created_ns = %v", timeCreatedNs))
+	if err != nil {
+		return err
+	}
+	if len(qr.Rows) != 1 {
+		return fmt.Errorf("reparent journal entry %v was not replicated - unexpected row count %v", timeCreatedNs, len(qr.Rows))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+func TestReparentJournalFromQueryResult(t *testing.T) {
+	row := func(values ...string) []sqltypes.Value {
+		result := make([]sqltypes.Value, len(values))
+		for i, v := range values {
+			result[i] = sqltypes.MakeString([]byte(v))
+		}
+		return result
+	}
+	qr := &proto.QueryResult{Rows: [][]sqltypes.Value{
+		row("2000", "PromoteSlave", "cell1-0000000100", "cell1-0000000101", "vt-bin.000001:120"),
+		row("1000", "PromoteSlave", "", "cell1-0000000100", "vt-bin.000001:98"),
+	}}
+	want := []*ReparentJournalEntry{
+		&ReparentJournalEntry{2000, "PromoteSlave", "cell1-0000000100", "cell1-0000000101", "vt-bin.000001:120"},
+		&ReparentJournalEntry{1000, "PromoteSlave", "", "cell1-0000000100", "vt-bin.000001:98"},
+	}
+	got, err := ReparentJournalFromQueryResult(qr)
+	if err != nil {
+		t.Fatalf("ReparentJournalFromQueryResult: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReparentJournalFromQueryResult: got %v, want %v", got, want)
+	}
+
+	qr.Rows = append(qr.Rows, row("not a time", "PromoteSlave", "", "", ""))
+	if _, err := ReparentJournalFromQueryResult(qr); err == nil {
+		t.Errorf("ReparentJournalFromQueryResult with a bad time should have failed")
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/netutil"
 	"github.com/youtube/vitess/go/vt/hook"
 )
 
@@ -76,17 +77,16 @@ type ReplicationState struct {
 }
 
 func (rs ReplicationState) MasterAddr() string {
-	return fmt.Sprintf("%v:%v", rs.MasterHost, rs.MasterPort)
+	return netutil.JoinHostPort(rs.MasterHost, rs.MasterPort)
 }
 
 func NewReplicationState(masterAddr string) (*ReplicationState, error) {
-	addrPieces := strings.Split(masterAddr, ":")
-	port, err := strconv.Atoi(addrPieces[1])
+	host, port, err := netutil.SplitHostPort(masterAddr)
 	if err != nil {
 		return nil, err
 	}
 	return &ReplicationState{MasterConnectRetry: 10,
-		MasterHost: addrPieces[0], MasterPort: port}, nil
+		MasterHost: host, MasterPort: port}, nil
 }
 
 var changeMasterCmd = `CHANGE MASTER TO
@@ -195,7 +195,7 @@ func (mysqld *Mysqld) GetMasterAddr() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	masterAddr := slaveStatus["Master_Host"] + ":" + slaveStatus["Master_Port"]
+	masterAddr := net.JoinHostPort(slaveStatus["Master_Host"], slaveStatus["Master_Port"])
 	return masterAddr, nil
 }
 
@@ -223,9 +223,39 @@ func (mysqld *Mysqld) SetReadOnly(on bool) error {
 	return mysqld.executeSuperQuery(query)
 }
 
+// SetSuperReadOnly sets the super_read_only variable, and checks its
+// new value. Setting read_only to OFF also sets it to OFF.
+func (mysqld *Mysqld) SetSuperReadOnly(on bool) error {
+	value := "OFF"
+	if on {
+		value = "ON"
+	}
+	if err := mysqld.executeSuperQuery("SET GLOBAL super_read_only = " + value); err != nil {
+		if strings.Contains(err.Error(), "Unknown system variable") {
+			return ErrNoSuperReadOnly
+		}
+		return err
+	}
+	qr, err := mysqld.fetchSuperQuery("SHOW VARIABLES LIKE 'super_read_only'")
+	if err != nil {
+		return err
+	}
+	if len(qr.Rows) != 1 {
+		return ErrNoSuperReadOnly
+	}
+	if qr.Rows[0][1].String() != value {
+		return fmt.Errorf("super_read_only is %v after setting it to %v", qr.Rows[0][1].String(), value)
+	}
+	return nil
+}
+
 var (
 	ErrNotSlave  = errors.New("no slave status")
 	ErrNotMaster = errors.New("no master status")
+
+	// ErrNoSuperReadOnly is returned by SetSuperReadOnly when
+	// mysqld doesn't have super_read_only.
+	ErrNoSuperReadOnly = errors.New("no super_read_only variable in mysql")
 )
 
 func (mysqld *Mysqld) slaveStatus() (map[string]string, error) {
@@ -318,11 +348,79 @@ func (mysqld *Mysqld) WaitMasterPos(rp *ReplicationPosition, waitTimeout int) er
 	return nil
 }
 
+// WaitForMinimumGroupId waits until the slave has applied at least
+// the transaction with the given group id.
+func (mysqld *Mysqld) WaitForMinimumGroupId(groupId string, waitTimeout time.Duration) error {
+	target, err := strconv.ParseInt(groupId, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid group id %v: %v", groupId, err)
+	}
+	timeOut := time.Now().Add(waitTimeout)
+	for {
+		pos, err := mysqld.SlaveStatus()
+		if err != nil {
+			return err
+		}
+		if pos.MasterLogGroupId != "" {
+			current, err := strconv.ParseInt(pos.MasterLogGroupId, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid slave group id %v: %v", pos.MasterLogGroupId, err)
+			}
+			if current >= target {
+				return nil
+			}
+		}
+		if time.Now().After(timeOut) {
+			return fmt.Errorf("WaitForMinimumGroupId(%v) timed out, current group id is %v", groupId, pos.MasterLogGroupId)
+		}
+
+		log.Infof("Sleeping 1 second waiting for replication to reach group id %v, currently at %v", groupId, pos.MasterLogGroupId)
+		time.Sleep(1 * time.Second)
+	}
+}
+
 func (mysqld *Mysqld) SlaveStatus() (*ReplicationPosition, error) {
 	fields, err := mysqld.slaveStatus()
 	if err != nil {
 		return nil, err
 	}
+	return slaveStatusPosition(fields), nil
+}
+
+// ReplicationStatus is the state of replication on a slave, as
+// shown by 'show slave status'.
+type ReplicationStatus struct {
+	Position        ReplicationPosition
+	MasterHost      string
+	MasterPort      int
+	SlaveIORunning  bool
+	SlaveSQLRunning bool
+	LastIOError     string
+	LastSQLError    string
+}
+
+// ReplicationStatus returns the state of replication, or ErrNotSlave
+// if the server is not a slave.
+func (mysqld *Mysqld) ReplicationStatus() (*ReplicationStatus, error) {
+	fields, err := mysqld.slaveStatus()
+	if err != nil {
+		return nil, err
+	}
+	port, _ := strconv.Atoi(fields["Master_Port"])
+	return &ReplicationStatus{
+		Position:        *slaveStatusPosition(fields),
+		MasterHost:      fields["Master_Host"],
+		MasterPort:      port,
+		SlaveIORunning:  fields["Slave_IO_Running"] == "Yes",
+		SlaveSQLRunning: fields["Slave_SQL_Running"] == "Yes",
+		LastIOError:     fields["Last_IO_Error"],
+		LastSQLError:    fields["Last_SQL_Error"],
+	}, nil
+}
+
+// slaveStatusPosition returns the position from the fields of 'show
+// slave status'.
+func slaveStatusPosition(fields map[string]string) *ReplicationPosition {
 	pos := new(ReplicationPosition)
 	// Use Relay_Master_Log_File for the SQL thread postion.
 	pos.MasterLogFile = fields["Relay_Master_Log_File"]
@@ -340,7 +438,7 @@ func (mysqld *Mysqld) SlaveStatus() (*ReplicationPosition, error) {
 		// replications isn't running - report it as invalid since it won't resolve itself.
 		pos.SecondsBehindMaster = InvalidLagSeconds
 	}
-	return pos, nil
+	return pos
 }
 
 /*
@@ -549,6 +647,25 @@ func (mysqld *Mysqld) fetchSuperQuery(query string) (*proto.QueryResult, error)
 	return qr, nil
 }
 
+// ExecuteFetch runs an arbitrary query with the dba credentials, and
+// returns up to maxrows rows.
+// ExecuteFetch runs a query with the dba credentials. If disableBinlogs
+// is set, the query is not written to the binary logs, so it won't
+// replicate.
+func (mysqld *Mysqld) ExecuteFetch(query string, maxrows int, wantfields, disableBinlogs bool) (*proto.QueryResult, error) {
+	conn, connErr := mysqld.createConnection()
+	if connErr != nil {
+		return nil, connErr
+	}
+	defer conn.Close()
+	if disableBinlogs {
+		if _, err := conn.ExecuteFetch("SET sql_log_bin = OFF", 0, false); err != nil {
+			return nil, err
+		}
+	}
+	return conn.ExecuteFetch(query, maxrows, wantfields)
+}
+
 func (mysqld *Mysqld) executeSuperQueryList(queryList []string) error {
 	conn, connErr := mysqld.createConnection()
 	if connErr != nil {
@@ -652,6 +769,22 @@ type BlpPosition struct {
 	GroupId string
 }
 
+// BlpPositionList is the list of positions of all the binlog
+// players running on a tablet.
+type BlpPositionList struct {
+	Entries []BlpPosition
+}
+
+// FindBlpPositionById returns the position for the given player uid.
+func (bpl *BlpPositionList) FindBlpPositionById(id uint32) (*BlpPosition, error) {
+	for _, pos := range bpl.Entries {
+		if pos.Uid == id {
+			return &pos, nil
+		}
+	}
+	return nil, fmt.Errorf("BlpPosition for id %v not found", id)
+}
+
 func (mysqld *Mysqld) WaitBlpPos(bp *BlpPosition, waitTimeout int) error {
 	timeOut := time.Now().Add(time.Duration(waitTimeout) * time.Second)
 	for {
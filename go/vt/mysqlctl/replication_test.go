@@ -0,0 +1,39 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"testing"
+)
+
+func TestSlaveStatusPosition(t *testing.T) {
+	fields := map[string]string{
+		"Relay_Master_Log_File": "vt-bin.000002",
+		"Exec_Master_Log_Pos":   "1024",
+		"Master_Log_File":       "vt-bin.000003",
+		"Read_Master_Log_Pos":   "98",
+		"Exec_Master_Group_ID":  "12",
+		"Slave_IO_Running":      "Yes",
+		"Slave_SQL_Running":     "Yes",
+		"Seconds_Behind_Master": "7",
+	}
+	want := ReplicationPosition{
+		MasterLogFile:       "vt-bin.000002",
+		MasterLogPosition:   1024,
+		MasterLogGroupId:    "12",
+		MasterLogFileIo:     "vt-bin.000003",
+		MasterLogPositionIo: 98,
+		SecondsBehindMaster: 7,
+	}
+	if got := slaveStatusPosition(fields); *got != want {
+		t.Errorf("slaveStatusPosition: got %#v, want %#v", got, want)
+	}
+
+	// a stopped slave has an invalid lag
+	fields["Slave_SQL_Running"] = "No"
+	if got := slaveStatusPosition(fields); got.SecondsBehindMaster != InvalidLagSeconds {
+		t.Errorf("slaveStatusPosition with a stopped slave: got lag %v", got.SecondsBehindMaster)
+	}
+}
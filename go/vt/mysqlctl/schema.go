@@ -23,11 +23,12 @@ const (
 )
 
 type TableDefinition struct {
-	Name       string   // the table name
-	Schema     string   // the SQL to run to create the table
-	Columns    []string // the columns in the order that will be used to dump and load the data
-	Type       string   // TABLE_BASE_TABLE or TABLE_VIEW
-	DataLength uint64   // how much space the data file takes.
+	Name              string   // the table name
+	Schema            string   // the SQL to run to create the table
+	Columns           []string // the columns in the order that will be used to dump and load the data
+	PrimaryKeyColumns []string // the columns used by the table's primary key, in order
+	Type              string   // TABLE_BASE_TABLE or TABLE_VIEW
+	DataLength        uint64   // how much space the data file takes.
 }
 
 // helper methods for sorting
@@ -79,6 +80,56 @@ func (sd *SchemaDefinition) generateSchemaVersion() {
 	sd.Version = hex.EncodeToString(hasher.Sum(nil))
 }
 
+// FilterTables returns a copy of the SchemaDefinition without the
+// tables in excludeTables.
+func (sd *SchemaDefinition) FilterTables(excludeTables []string) *SchemaDefinition {
+	if len(excludeTables) == 0 {
+		return sd
+	}
+	excluded := make(map[string]bool, len(excludeTables))
+	for _, table := range excludeTables {
+		excluded[table] = true
+	}
+
+	result := &SchemaDefinition{DatabaseSchema: sd.DatabaseSchema}
+	result.TableDefinitions = make([]TableDefinition, 0, len(sd.TableDefinitions))
+	for _, td := range sd.TableDefinitions {
+		if !excluded[td.Name] {
+			result.TableDefinitions = append(result.TableDefinitions, td)
+		}
+	}
+	result.generateSchemaVersion()
+	return result
+}
+
+// ToSQLStrings returns the statements to create the database (if it
+// doesn't exist), its tables, and then its views, using databaseName
+// as the database name.
+func (sd *SchemaDefinition) ToSQLStrings(databaseName string) ([]string, error) {
+	params := map[string]string{"DatabaseName": databaseName}
+	createDatabase, err := fillStringTemplate(sd.DatabaseSchema, params)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(sd.TableDefinitions)+1)
+	result = append(result, strings.Replace(createDatabase, "CREATE DATABASE", "CREATE DATABASE IF NOT EXISTS", 1))
+
+	// views will probably depend on tables, so they go last
+	views := make([]string, 0, 5)
+	for _, td := range sd.TableDefinitions {
+		if td.Type == TABLE_VIEW {
+			createView, err := fillStringTemplate(td.Schema, params)
+			if err != nil {
+				return nil, err
+			}
+			views = append(views, createView)
+		} else {
+			result = append(result, td.Schema)
+		}
+	}
+	return append(result, views...), nil
+}
+
 func (sd *SchemaDefinition) GetTable(table string) (td *TableDefinition, ok bool) {
 	for _, td := range sd.TableDefinitions {
 		if td.Name == table {
@@ -227,6 +278,13 @@ func (mysqld *Mysqld) GetSchema(dbName string, tables []string, includeViews boo
 			return nil, err
 		}
 		sd.TableDefinitions[i].Columns = columns
+		if tableType == TABLE_BASE_TABLE {
+			pkColumns, err := mysqld.GetPrimaryKeyColumns(dbName, tableName)
+			if err != nil {
+				return nil, err
+			}
+			sd.TableDefinitions[i].PrimaryKeyColumns = pkColumns
+		}
 		sd.TableDefinitions[i].Type = tableType
 		sd.TableDefinitions[i].DataLength = dataLength
 	}
@@ -254,6 +312,53 @@ func (mysqld *Mysqld) GetColumns(dbName, table string) ([]string, error) {
 
 }
 
+// GetPrimaryKeyColumns returns the primary key columns of table, in
+// the order they appear in the index.
+func (mysqld *Mysqld) GetPrimaryKeyColumns(dbName, table string) ([]string, error) {
+	qr, err := mysqld.fetchSuperQuery(fmt.Sprintf("show index from %v.%v", dbName, table))
+	if err != nil {
+		return nil, err
+	}
+	keyNameIndex := -1
+	seqInIndexIndex := -1
+	columnNameIndex := -1
+	for i, field := range qr.Fields {
+		switch field.Name {
+		case "Key_name":
+			keyNameIndex = i
+		case "Seq_in_index":
+			seqInIndexIndex = i
+		case "Column_name":
+			columnNameIndex = i
+		}
+	}
+	if keyNameIndex == -1 || seqInIndexIndex == -1 || columnNameIndex == -1 {
+		return nil, fmt.Errorf("unknown columns in 'show index' result: %v", qr.Fields)
+	}
+
+	columns := make([]string, 0, 5)
+	var expectedIndex int64 = 1
+	for _, row := range qr.Rows {
+		// skip non-primary keys
+		if row[keyNameIndex].String() != "PRIMARY" {
+			continue
+		}
+
+		// check the Seq_in_index is always increasing
+		seqInIndex, err := row[seqInIndexIndex].ParseInt64()
+		if err != nil {
+			return nil, err
+		}
+		if seqInIndex != expectedIndex {
+			return nil, fmt.Errorf("unexpected index: %v != %v", seqInIndex, expectedIndex)
+		}
+		expectedIndex++
+
+		columns = append(columns, row[columnNameIndex].String())
+	}
+	return columns, nil
+}
+
 type SchemaChange struct {
 	Sql              string
 	Force            bool
@@ -265,13 +370,87 @@ type SchemaChange struct {
 type SchemaChangeResult struct {
 	BeforeSchema *SchemaDefinition
 	AfterSchema  *SchemaDefinition
+
+	// TableChanges lists the tables affected by the change. It is
+	// only filled in by PreflightSchemaChange.
+	TableChanges []TableChange
+}
+
+const (
+	TABLE_CHANGE_CREATED = "created"
+	TABLE_CHANGE_DROPPED = "dropped"
+	TABLE_CHANGE_ALTERED = "altered"
+)
+
+// TableChange describes how a schema change affects a table.
+type TableChange struct {
+	Name   string
+	Change string // TABLE_CHANGE_CREATED, TABLE_CHANGE_DROPPED or TABLE_CHANGE_ALTERED
+
+	// the table schema before and after the change, empty if the
+	// table didn't exist.
+	BeforeSchema string
+	AfterSchema  string
+
+	// DataLength is the current size of the table data. Altering a
+	// big table can take a long time.
+	DataLength uint64
+}
+
+func (tc TableChange) String() string {
+	if tc.Change == TABLE_CHANGE_CREATED {
+		return fmt.Sprintf("table %v will be %v", tc.Name, tc.Change)
+	}
+	return fmt.Sprintf("table %v will be %v (data length %v)", tc.Name, tc.Change, tc.DataLength)
+}
+
+// DiffSchemaTables returns the base tables that are created, dropped
+// or altered between two SchemaDefinition. Both table lists have to
+// be sorted by name.
+func DiffSchemaTables(before, after *SchemaDefinition) []TableChange {
+	baseTables := func(sd *SchemaDefinition) []TableDefinition {
+		result := make([]TableDefinition, 0, len(sd.TableDefinitions))
+		for _, td := range sd.TableDefinitions {
+			if td.Type == TABLE_BASE_TABLE {
+				result = append(result, td)
+			}
+		}
+		return result
+	}
+	left := baseTables(before)
+	right := baseTables(after)
+
+	result := make([]TableChange, 0, 5)
+	leftIndex := 0
+	rightIndex := 0
+	for leftIndex < len(left) || rightIndex < len(right) {
+		switch {
+		case rightIndex == len(right) || (leftIndex < len(left) && left[leftIndex].Name < right[rightIndex].Name):
+			result = append(result, TableChange{Name: left[leftIndex].Name, Change: TABLE_CHANGE_DROPPED, BeforeSchema: left[leftIndex].Schema, DataLength: left[leftIndex].DataLength})
+			leftIndex++
+		case leftIndex == len(left) || left[leftIndex].Name > right[rightIndex].Name:
+			result = append(result, TableChange{Name: right[rightIndex].Name, Change: TABLE_CHANGE_CREATED, AfterSchema: right[rightIndex].Schema})
+			rightIndex++
+		default:
+			if left[leftIndex].Schema != right[rightIndex].Schema {
+				result = append(result, TableChange{Name: left[leftIndex].Name, Change: TABLE_CHANGE_ALTERED, BeforeSchema: left[leftIndex].Schema, AfterSchema: right[rightIndex].Schema, DataLength: left[leftIndex].DataLength})
+			}
+			leftIndex++
+			rightIndex++
+		}
+	}
+	return result
 }
 
 func (scr *SchemaChangeResult) String() string {
 	return jscfg.ToJson(scr)
 }
 
-func (mysqld *Mysqld) PreflightSchemaChange(dbName string, change string) (*SchemaChangeResult, error) {
+// PreflightSchemaChange applies the change to a scratch copy of the
+// database schema (without any data), in the _vt_preflight
+// database, and returns the schema before and after the change, as
+// well as the list of affected tables.
+func (mysqld *Mysqld) PreflightSchemaChange(dbName string, change string) (result *SchemaChangeResult, err error) {
 	// gather current schema on real database
 	beforeSchema, err := mysqld.GetSchema(dbName, nil, true)
 	if err != nil {
@@ -292,6 +471,16 @@ func (mysqld *Mysqld) PreflightSchemaChange(dbName string, change string) (*Sche
 		return nil, err
 	}
 
+	// clean up the extra database, even if the change fails
+	defer func() {
+		sql := "SET sql_log_bin = 0;\n"
+		sql += "DROP DATABASE _vt_preflight;\n"
+		if cleanErr := mysqld.ExecuteMysqlCommand(sql); cleanErr != nil {
+			result = nil
+			err = replaceError(err, cleanErr)
+		}
+	}()
+
 	// apply schema change to the temporary database
 	sql = "SET sql_log_bin = 0;\n"
 	sql += "USE _vt_preflight;\n"
@@ -306,14 +495,11 @@ func (mysqld *Mysqld) PreflightSchemaChange(dbName string, change string) (*Sche
 		return nil, err
 	}
 
-	// and clean up the extra database
-	sql = "SET sql_log_bin = 0;\n"
-	sql += "DROP DATABASE _vt_preflight;\n"
-	if err = mysqld.ExecuteMysqlCommand(sql); err != nil {
-		return nil, err
-	}
-
-	return &SchemaChangeResult{beforeSchema, afterSchema}, nil
+	return &SchemaChangeResult{
+		BeforeSchema: beforeSchema,
+		AfterSchema:  afterSchema,
+		TableChanges: DiffSchemaTables(beforeSchema, afterSchema),
+	}, nil
 }
 
 func (mysqld *Mysqld) ApplySchemaChange(dbName string, change *SchemaChange) (*SchemaChangeResult, error) {
@@ -336,7 +522,7 @@ func (mysqld *Mysqld) ApplySchemaChange(dbName string, change *SchemaChange) (*S
 					// no diff between the schema we expect
 					// after the change and the current
 					// schema, we already applied it
-					return &SchemaChangeResult{beforeSchema, beforeSchema}, nil
+					return &SchemaChangeResult{BeforeSchema: beforeSchema, AfterSchema: beforeSchema}, nil
 				}
 			}
 
@@ -383,5 +569,5 @@ func (mysqld *Mysqld) ApplySchemaChange(dbName string, change *SchemaChange) (*S
 		}
 	}
 
-	return &SchemaChangeResult{beforeSchema, afterSchema}, nil
+	return &SchemaChangeResult{BeforeSchema: beforeSchema, AfterSchema: afterSchema}, nil
 }
@@ -55,3 +55,88 @@ func TestSchemaDiff(t *testing.T) {
 	sd2.TableDefinitions = append(sd2.TableDefinitions, TableDefinition{Name: "table2", Schema: "schema3", Type: TABLE_BASE_TABLE})
 	testDiff(t, sd1, sd2, "sd1", "sd2", []string{"sd1 and sd2 disagree on schema for table table2:\nschema2\n differs from:\nschema3"})
 }
+
+func TestDiffSchemaTables(t *testing.T) {
+	before := &SchemaDefinition{TableDefinitions: []TableDefinition{
+		{Name: "altered", Schema: "schema1", Type: TABLE_BASE_TABLE, DataLength: 100},
+		{Name: "dropped", Schema: "schema2", Type: TABLE_BASE_TABLE, DataLength: 200},
+		{Name: "same", Schema: "schema3", Type: TABLE_BASE_TABLE},
+		{Name: "view", Schema: "view1", Type: TABLE_VIEW},
+	}}
+	after := &SchemaDefinition{TableDefinitions: []TableDefinition{
+		{Name: "altered", Schema: "schema1bis", Type: TABLE_BASE_TABLE},
+		{Name: "created", Schema: "schema4", Type: TABLE_BASE_TABLE},
+		{Name: "same", Schema: "schema3", Type: TABLE_BASE_TABLE},
+	}}
+	expected := []TableChange{
+		{Name: "altered", Change: TABLE_CHANGE_ALTERED, BeforeSchema: "schema1", AfterSchema: "schema1bis", DataLength: 100},
+		{Name: "created", Change: TABLE_CHANGE_CREATED, AfterSchema: "schema4"},
+		{Name: "dropped", Change: TABLE_CHANGE_DROPPED, BeforeSchema: "schema2", DataLength: 200},
+	}
+	got := DiffSchemaTables(before, after)
+	if len(got) != len(expected) {
+		t.Fatalf("DiffSchemaTables returned %v, expected %v", got, expected)
+	}
+	for i, tc := range got {
+		if tc != expected[i] {
+			t.Errorf("DiffSchemaTables[%v] = %#v, expected %#v", i, tc, expected[i])
+		}
+	}
+
+	if got := DiffSchemaTables(before, before); len(got) != 0 {
+		t.Errorf("DiffSchemaTables on the same schema returned %v", got)
+	}
+}
+
+func TestFilterTables(t *testing.T) {
+	sd := &SchemaDefinition{TableDefinitions: []TableDefinition{
+		{Name: "table1", Schema: "schema1", Type: TABLE_BASE_TABLE},
+		{Name: "table2", Schema: "schema2", Type: TABLE_BASE_TABLE},
+		{Name: "table3", Schema: "schema3", Type: TABLE_BASE_TABLE},
+	}}
+	sd.generateSchemaVersion()
+
+	if got := sd.FilterTables(nil); got != sd {
+		t.Errorf("FilterTables(nil) should return the original SchemaDefinition")
+	}
+
+	got := sd.FilterTables([]string{"table2", "unknown"})
+	if len(got.TableDefinitions) != 2 || got.TableDefinitions[0].Name != "table1" || got.TableDefinitions[1].Name != "table3" {
+		t.Errorf("unexpected filtered tables: %v", got.TableDefinitions)
+	}
+	if got.Version == sd.Version {
+		t.Errorf("filtered schema should have a different version")
+	}
+	if len(sd.TableDefinitions) != 3 {
+		t.Errorf("FilterTables modified the original SchemaDefinition: %v", sd.TableDefinitions)
+	}
+}
+
+func TestToSQLStrings(t *testing.T) {
+	sd := &SchemaDefinition{
+		DatabaseSchema: "CREATE DATABASE `{{.DatabaseName}}` /*!40100 DEFAULT CHARACTER SET utf8 */",
+		TableDefinitions: []TableDefinition{
+			{Name: "table1", Schema: "CREATE TABLE `table1` (id int)", Type: TABLE_BASE_TABLE},
+			{Name: "view1", Schema: "CREATE VIEW `{{.DatabaseName}}`.`view1` AS SELECT id FROM `{{.DatabaseName}}`.`table1`", Type: TABLE_VIEW},
+			{Name: "table2", Schema: "CREATE TABLE `table2` (id int)", Type: TABLE_BASE_TABLE},
+		},
+	}
+	got, err := sd.ToSQLStrings("vt_test")
+	if err != nil {
+		t.Fatalf("ToSQLStrings failed: %v", err)
+	}
+	expected := []string{
+		"CREATE DATABASE IF NOT EXISTS `vt_test` /*!40100 DEFAULT CHARACTER SET utf8 */",
+		"CREATE TABLE `table1` (id int)",
+		"CREATE TABLE `table2` (id int)",
+		"CREATE VIEW `vt_test`.`view1` AS SELECT id FROM `vt_test`.`table1`",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("ToSQLStrings returned %v, expected %v", got, expected)
+	}
+	for i, sql := range got {
+		if sql != expected[i] {
+			t.Errorf("ToSQLStrings[%v] = %q, expected %q", i, sql, expected[i])
+		}
+	}
+}
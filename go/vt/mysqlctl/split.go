@@ -376,14 +376,50 @@ func (nhw *namedHasherWriter) SnapshotFiles() ([]SnapshotFile, error) {
 	return nhw.snapshotFiles, nil
 }
 
-func (mysqld *Mysqld) dumpTable(td TableDefinition, dbName, keyName, mainCloneSourcePath string, cloneSourcePaths map[key.KeyRange]string, maximumFilesize uint64) (map[key.KeyRange][]SnapshotFile, error) {
-	filename := path.Join(mainCloneSourcePath, td.Name+".csv")
-	selectIntoOutfile := `SELECT {{.KeyspaceIdColumnName}}, {{.Columns}} INTO OUTFILE "{{.TableOutputPath}}" CHARACTER SET binary FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '\\' LINES TERMINATED BY '\n' FROM {{.TableName}}`
+// keyRangeFilter returns the WHERE clause to only select the rows
+// whose keyspace id, stored as a keyType in column keyName, is in
+// the key range. It returns an empty string for the full key range.
+func keyRangeFilter(keyName string, keyType key.KeyspaceIdType, kr key.KeyRange) string {
+	conditions := make([]string, 0, 2)
+	if kr.Start != key.MinKey {
+		conditions = append(conditions, fmt.Sprintf("%v >= %v", keyName, keyType.SqlLiteral(kr.Start)))
+	}
+	if kr.End != key.MaxKey {
+		conditions = append(conditions, fmt.Sprintf("%v < %v", keyName, keyType.SqlLiteral(kr.End)))
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// dumpTable dumps the rows of a table for each key range into
+// compressed files in the matching cloneSourcePaths. Each key range
+// is dumped with its own query, using a WHERE clause on keyName, so
+// we only read the rows we need, once.
+func (mysqld *Mysqld) dumpTable(td TableDefinition, dbName, keyName string, keyType key.KeyspaceIdType, mainCloneSourcePath string, cloneSourcePaths map[key.KeyRange]string, maximumFilesize uint64) (map[key.KeyRange][]SnapshotFile, error) {
+	snapshotFiles := make(map[key.KeyRange][]SnapshotFile)
+	for kr, cloneSourcePath := range cloneSourcePaths {
+		files, err := mysqld.dumpTableKeyRange(td, dbName, keyName, keyType, mainCloneSourcePath, cloneSourcePath, kr, maximumFilesize)
+		if err != nil {
+			return nil, err
+		}
+		snapshotFiles[kr] = files
+	}
+	return snapshotFiles, nil
+}
+
+// dumpTableKeyRange dumps the rows of a table in the key range into
+// compressed files in cloneSourcePath.
+func (mysqld *Mysqld) dumpTableKeyRange(td TableDefinition, dbName, keyName string, keyType key.KeyspaceIdType, mainCloneSourcePath, cloneSourcePath string, kr key.KeyRange, maximumFilesize uint64) ([]SnapshotFile, error) {
+	filename := path.Join(mainCloneSourcePath, td.Name+"."+string(kr.Start.Hex())+"-"+string(kr.End.Hex())+".csv")
+	selectIntoOutfile := `SELECT {{.KeyspaceIdColumnName}}, {{.Columns}} INTO OUTFILE "{{.TableOutputPath}}" CHARACTER SET binary FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '\\' LINES TERMINATED BY '\n' FROM {{.TableName}}{{.KeyRangeFilter}}`
 	queryParams := map[string]string{
 		"TableName":            dbName + "." + td.Name,
 		"Columns":              strings.Join(td.Columns, ", "),
 		"KeyspaceIdColumnName": keyName,
 		"TableOutputPath":      filename,
+		"KeyRangeFilter":       keyRangeFilter(keyName, keyType, kr),
 	}
 	sio, err := fillStringTemplate(selectIntoOutfile, queryParams)
 	if err != nil {
@@ -405,15 +441,10 @@ func (mysqld *Mysqld) dumpTable(td TableDefinition, dbName, keyName, mainCloneSo
 		}
 	}()
 
-	hasherWriters := make(map[key.KeyRange]*namedHasherWriter)
-
-	for kr, cloneSourcePath := range cloneSourcePaths {
-		filenamePattern := path.Join(cloneSourcePath, td.Name+".%v.csv.gz")
-		w, err := newCompressedNamedHasherWriter(filenamePattern, mysqld.SnapshotDir, td.Name, maximumFilesize)
-		if err != nil {
-			return nil, err
-		}
-		hasherWriters[kr] = w
+	filenamePattern := path.Join(cloneSourcePath, td.Name+".%v.csv.gz")
+	hasherWriter, err := newCompressedNamedHasherWriter(filenamePattern, mysqld.SnapshotDir, td.Name, maximumFilesize)
+	if err != nil {
+		return nil, err
 	}
 
 	splitter := csvsplitter.NewKeyspaceCSVReader(file, ',')
@@ -425,28 +456,18 @@ func (mysqld *Mysqld) dumpTable(td TableDefinition, dbName, keyName, mainCloneSo
 		if err != nil {
 			return nil, err
 		}
-		for kr, w := range hasherWriters {
-			if kr.Contains(keyspaceId) {
-				_, err = w.Write(line)
-				if err != nil {
-					return nil, err
-				}
-				break
-			}
+		if !kr.Contains(keyspaceId) {
+			return nil, fmt.Errorf("table %v: dumped row with keyspace id %v is not in key range %v", td.Name, keyspaceId.Hex(), kr)
 		}
-	}
-
-	snapshotFiles := make(map[key.KeyRange][]SnapshotFile)
-	for i, hw := range hasherWriters {
-		if snapshotFiles[i], err = hw.SnapshotFiles(); err != nil {
+		if _, err = hasherWriter.Write(line); err != nil {
 			return nil, err
 		}
 	}
 
-	return snapshotFiles, nil
+	return hasherWriter.SnapshotFiles()
 }
 
-func (mysqld *Mysqld) CreateMultiSnapshot(keyRanges []key.KeyRange, dbName, keyName string, sourceAddr string, allowHierarchicalReplication bool, snapshotConcurrency int, tables []string, skipSlaveRestart bool, maximumFilesize uint64, hookExtraEnv map[string]string) (snapshotManifestFilenames []string, err error) {
+func (mysqld *Mysqld) CreateMultiSnapshot(keyRanges []key.KeyRange, dbName, keyName string, keyType key.KeyspaceIdType, sourceAddr string, allowHierarchicalReplication bool, snapshotConcurrency int, tables []string, skipSlaveRestart bool, maximumFilesize uint64, hookExtraEnv map[string]string) (snapshotManifestFilenames []string, err error) {
 	if dbName == "" {
 		err = fmt.Errorf("no database name provided")
 		return
@@ -511,7 +532,7 @@ func (mysqld *Mysqld) CreateMultiSnapshot(keyRanges []key.KeyRange, dbName, keyN
 			// we just skip views here
 			return nil
 		}
-		snapshotFiles, err := mysqld.dumpTable(table, dbName, keyName, mainCloneSourcePath, cloneSourcePaths, maximumFilesize)
+		snapshotFiles, err := mysqld.dumpTable(table, dbName, keyName, keyType, mainCloneSourcePath, cloneSourcePaths, maximumFilesize)
 		if err != nil {
 			return
 		}
@@ -0,0 +1,41 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/key"
+)
+
+func TestKeyRangeFilter(t *testing.T) {
+	table := []struct {
+		start, end string
+		filter     string
+	}{
+		{"", "", ""},
+		{"", "80", " WHERE keyspace_id < 9223372036854775808"},
+		{"80", "", " WHERE keyspace_id >= 9223372036854775808"},
+		{"40", "c0", " WHERE keyspace_id >= 4611686018427387904 AND keyspace_id < 13835058055282163712"},
+	}
+	for _, entry := range table {
+		kr, err := key.ParseKeyRangeParts(entry.start, entry.end)
+		if err != nil {
+			t.Fatalf("ParseKeyRangeParts(%v, %v) failed: %v", entry.start, entry.end, err)
+		}
+		if filter := keyRangeFilter("keyspace_id", key.KIT_UINT64, kr); filter != entry.filter {
+			t.Errorf("keyRangeFilter(%v) = %q, expected %q", kr, filter, entry.filter)
+		}
+	}
+
+	kr, err := key.ParseKeyRangeParts("40", "80000000000000000000000000000001")
+	if err != nil {
+		t.Fatalf("ParseKeyRangeParts failed: %v", err)
+	}
+	want := " WHERE keyspace_id >= 0x40 AND keyspace_id < 0x80000000000000000000000000000001"
+	if filter := keyRangeFilter("keyspace_id", key.KIT_BYTES, kr); filter != want {
+		t.Errorf("keyRangeFilter(%v) = %q, expected %q", kr, filter, want)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/youtube/vitess/go/mysql/proto"
+)
+
+// TableStatsBucket is an interval of the first primary key column of
+// a table, that ends where the next bucket starts, and the estimated
+// number of rows in it.
+type TableStatsBucket struct {
+	Start int64
+	Rows  uint64
+}
+
+// TableStats are the approximate statistics of a table, used to split
+// it in chunks of similar sizes. The buckets are only computed for
+// tables whose first primary key column is an integer.
+type TableStats struct {
+	Name       string
+	RowCount   uint64
+	DataLength uint64
+
+	PrimaryKeyColumn string
+	Min              int64
+	Max              int64
+	Buckets          []TableStatsBucket
+}
+
+func (ts *TableStats) String() string {
+	return fmt.Sprintf("%v: %v rows, %v bytes, %v buckets on %v", ts.Name, ts.RowCount, ts.DataLength, len(ts.Buckets), ts.PrimaryKeyColumn)
+}
+
+// parseUint64 reads an unsigned value, NULL is 0.
+func parseUint64(qr *proto.QueryResult, row, col int) (uint64, error) {
+	if qr.Rows[row][col].IsNull() {
+		return 0, nil
+	}
+	return strconv.ParseUint(qr.Rows[row][col].String(), 10, 64)
+}
+
+// bucketStarts splits [min, max] in count intervals of the same width,
+// and returns their starts.
+func bucketStarts(min, max int64, count int) []int64 {
+	span := uint64(max-min) + 1
+	if uint64(count) > span {
+		count = int(span)
+	}
+	starts := make([]int64, count)
+	c := uint64(count)
+	for i := uint64(0); i < c; i++ {
+		starts[i] = min + int64(span/c*i+span%c*i/c)
+	}
+	return starts
+}
+
+// GetTableStats returns the statistics of a table. The row count and
+// the data length come from information_schema, and the buckets from
+// index dives: the row estimates of MySQL for bucketCount intervals
+// of the same width between the min and max primary key values.
+func (mysqld *Mysqld) GetTableStats(dbName, table string, bucketCount int) (*TableStats, error) {
+	ts := &TableStats{Name: table}
+	qr, err := mysqld.fetchSuperQuery(fmt.Sprintf("SELECT table_rows, data_length FROM information_schema.tables WHERE table_schema = '%v' AND table_name = '%v'", dbName, table))
+	if err != nil {
+		return nil, err
+	}
+	if len(qr.Rows) != 1 {
+		return nil, fmt.Errorf("unknown table %v", table)
+	}
+	if ts.RowCount, err = parseUint64(qr, 0, 0); err != nil {
+		return nil, err
+	}
+	if ts.DataLength, err = parseUint64(qr, 0, 1); err != nil {
+		return nil, err
+	}
+
+	pkColumns, err := mysqld.GetPrimaryKeyColumns(dbName, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkColumns) == 0 || bucketCount <= 0 {
+		return ts, nil
+	}
+	pk := pkColumns[0]
+	ts.PrimaryKeyColumn = pk
+	qr, err = mysqld.fetchSuperQuery(fmt.Sprintf("SELECT MIN(%v), MAX(%v) FROM %v.%v", pk, pk, dbName, table))
+	if err != nil {
+		return nil, err
+	}
+	if len(qr.Rows) != 1 || qr.Rows[0][0].IsNull() || qr.Rows[0][1].IsNull() {
+		// empty table
+		return ts, nil
+	}
+	if ts.Min, err = strconv.ParseInt(qr.Rows[0][0].String(), 10, 64); err != nil {
+		// not an integer, no buckets
+		return ts, nil
+	}
+	if ts.Max, err = strconv.ParseInt(qr.Rows[0][1].String(), 10, 64); err != nil {
+		return ts, nil
+	}
+
+	starts := bucketStarts(ts.Min, ts.Max, bucketCount)
+	ts.Buckets = make([]TableStatsBucket, len(starts))
+	for i, start := range starts {
+		ts.Buckets[i].Start = start
+		query := fmt.Sprintf("EXPLAIN SELECT %v FROM %v.%v WHERE %v >= %v", pk, dbName, table, pk, start)
+		if i < len(starts)-1 {
+			query += fmt.Sprintf(" AND %v < %v", pk, starts[i+1])
+		}
+		qr, err := mysqld.fetchSuperQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		for col, field := range qr.Fields {
+			if field.Name == "rows" && len(qr.Rows) > 0 {
+				if ts.Buckets[i].Rows, err = parseUint64(qr, 0, col); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return ts, nil
+}
+
+// ChunkBoundaries returns up to count-1 increasing values of the
+// first primary key column, that split the table in count chunks of
+// about the same number of rows. The rows are assumed to be evenly
+// distributed inside a bucket.
+func (ts *TableStats) ChunkBoundaries(count int) []int64 {
+	if len(ts.Buckets) == 0 || count <= 1 {
+		return nil
+	}
+	rows := make([]float64, len(ts.Buckets))
+	var total float64
+	for i, b := range ts.Buckets {
+		rows[i] = float64(b.Rows)
+		total += rows[i]
+	}
+	if total == 0 {
+		// no estimate, assume a uniform distribution
+		for i := range rows {
+			rows[i] = 1
+		}
+		total = float64(len(rows))
+	}
+
+	result := make([]int64, 0, count-1)
+	bucket := 0
+	var before float64 // rows before the current bucket
+	for k := 1; k < count; k++ {
+		target := total * float64(k) / float64(count)
+		for bucket < len(rows)-1 && before+rows[bucket] < target {
+			before += rows[bucket]
+			bucket++
+		}
+		start := ts.Buckets[bucket].Start
+		end := ts.Max + 1
+		if bucket < len(rows)-1 {
+			end = ts.Buckets[bucket+1].Start
+		}
+		boundary := start
+		if rows[bucket] > 0 {
+			boundary += int64(float64(end-start) * (target - before) / rows[bucket])
+		}
+		if boundary <= ts.Min || boundary > ts.Max || (len(result) > 0 && boundary <= result[len(result)-1]) {
+			continue
+		}
+		result = append(result, boundary)
+	}
+	return result
+}
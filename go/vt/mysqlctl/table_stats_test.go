@@ -0,0 +1,45 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBucketStarts(t *testing.T) {
+	if got, want := bucketStarts(0, 99, 4), []int64{0, 25, 50, 75}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bucketStarts(0, 99, 4): got %v, want %v", got, want)
+	}
+	if got, want := bucketStarts(10, 12, 10), []int64{10, 11, 12}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bucketStarts(10, 12, 10): got %v, want %v", got, want)
+	}
+}
+
+func TestChunkBoundaries(t *testing.T) {
+	// uniform distribution
+	ts := &TableStats{Min: 0, Max: 99, Buckets: []TableStatsBucket{{0, 10}, {25, 10}, {50, 10}, {75, 10}}}
+	if got, want := ts.ChunkBoundaries(4), []int64{25, 50, 75}; !reflect.DeepEqual(got, want) {
+		t.Errorf("uniform: got %v, want %v", got, want)
+	}
+
+	// most of the rows are in the first bucket
+	ts.Buckets = []TableStatsBucket{{0, 90}, {25, 10}, {50, 0}, {75, 0}}
+	if got, want := ts.ChunkBoundaries(2), []int64{13}; !reflect.DeepEqual(got, want) {
+		t.Errorf("skewed: got %v, want %v", got, want)
+	}
+
+	// no estimates
+	ts.Buckets = []TableStatsBucket{{0, 0}, {50, 0}}
+	if got, want := ts.ChunkBoundaries(2), []int64{50}; !reflect.DeepEqual(got, want) {
+		t.Errorf("no estimates: got %v, want %v", got, want)
+	}
+
+	// no buckets
+	ts.Buckets = nil
+	if got := ts.ChunkBoundaries(2); got != nil {
+		t.Errorf("no buckets: got %v", got)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+
+	log "github.com/golang/glog"
+)
+
+// TablesFilterFunc returns a function that calls sendReply only if statements
+// in the transaction match the specified tables. The resulting function can be
+// passed into the BinlogStreamer: bls.Stream(file, pos, sendTransaction) ->
+// bls.Stream(file, pos, TablesFilterFunc(sendTransaction))
+func TablesFilterFunc(tables []string, sendReply sendTransactionFunc) sendTransactionFunc {
+	return func(reply *BinlogTransaction) error {
+		matched := false
+		filtered := make([]Statement, 0, len(reply.Statements))
+		for _, statement := range reply.Statements {
+			switch statement.Category {
+			case BL_SET:
+				filtered = append(filtered, statement)
+			case BL_DDL:
+				filtered = append(filtered, statement)
+				matched = true
+			case BL_DML:
+				tableIndex := bytes.LastIndex(statement.Sql, STREAM_COMMENT_START)
+				if tableIndex == -1 {
+					// TODO(sougou): increment error counter
+					log.Errorf("Error parsing table name: %s", string(statement.Sql))
+					continue
+				}
+				tableStart := tableIndex + len(STREAM_COMMENT_START)
+				tableEnd := bytes.Index(statement.Sql[tableStart:], SPACE)
+				if tableEnd == -1 {
+					// TODO(sougou): increment error counter
+					log.Errorf("Error parsing table name: %s", string(statement.Sql))
+					continue
+				}
+				tableName := string(statement.Sql[tableStart : tableStart+tableEnd])
+				for _, t := range tables {
+					if t == tableName {
+						filtered = append(filtered, statement)
+						matched = true
+						break
+					}
+				}
+			}
+		}
+		if matched {
+			reply.Statements = filtered
+		} else {
+			reply.Statements = nil
+		}
+		return sendReply(reply)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"testing"
+)
+
+var testTables = []string{
+	"included1",
+	"included2",
+}
+
+func TestTablesFilterPass(t *testing.T) {
+	input := BinlogTransaction{
+		Statements: []Statement{
+			{
+				Category: BL_SET,
+				Sql:      []byte("set1"),
+			}, {
+				Category: BL_DML,
+				Sql:      []byte("dml1 /* _stream included1 (id ) (500 ); */"),
+			}, {
+				Category: BL_DML,
+				Sql:      []byte("dml2 /* _stream excluded1 (id ) (500 ); */"),
+			},
+		},
+		GroupId: "1",
+	}
+	var got string
+	f := TablesFilterFunc(testTables, func(reply *BinlogTransaction) error {
+		got = bltToString(reply)
+		return nil
+	})
+	f(&input)
+	want := `statement: <6, "set1"> statement: <4, "dml1 /* _stream included1 (id ) (500 ); */"> position: "1" `
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestTablesFilterSkip(t *testing.T) {
+	input := BinlogTransaction{
+		Statements: []Statement{
+			{
+				Category: BL_SET,
+				Sql:      []byte("set1"),
+			}, {
+				Category: BL_DML,
+				Sql:      []byte("dml1 /* _stream excluded1 (id ) (500 ); */"),
+			},
+		},
+		GroupId: "1",
+	}
+	var got string
+	f := TablesFilterFunc(testTables, func(reply *BinlogTransaction) error {
+		got = bltToString(reply)
+		return nil
+	})
+	f(&input)
+	want := `position: "1" `
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestTablesFilterMalformed(t *testing.T) {
+	input := BinlogTransaction{
+		Statements: []Statement{
+			{
+				Category: BL_SET,
+				Sql:      []byte("set1"),
+			}, {
+				Category: BL_DML,
+				Sql:      []byte("ddl"),
+			}, {
+				Category: BL_DML,
+				Sql:      []byte("dml1 /* _stream included1*/"),
+			},
+		},
+		GroupId: "1",
+	}
+	var got string
+	f := TablesFilterFunc(testTables, func(reply *BinlogTransaction) error {
+		got = bltToString(reply)
+		return nil
+	})
+	f(&input)
+	want := `position: "1" `
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
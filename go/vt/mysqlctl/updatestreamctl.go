@@ -4,6 +4,7 @@
 package mysqlctl
 
 import (
+	"flag"
 	"fmt"
 	"sync"
 
@@ -17,6 +18,8 @@ import (
 
 /* API and config for UpdateStream Service */
 
+var keyspaceIdResolver = flag.String("keyspace-id-resolver", "numeric", "resolver that computes the keyspace ids of the keyspace_id comments of statements, for filtered replication: numeric for uint64 keyspace ids, hex for binary ones")
+
 const (
 	DISABLED int64 = iota
 	ENABLED
@@ -43,6 +46,11 @@ type KeyrangeRequest struct {
 	Keyrange key.KeyRange
 }
 
+type TablesRequest struct {
+	GroupId string
+	Tables  []string
+}
+
 type streamer interface {
 	Stop()
 }
@@ -204,6 +212,27 @@ func (updateStream *UpdateStream) ServeUpdateStream(req *UpdateStreamRequest, se
 }
 
 func (updateStream *UpdateStream) StreamKeyrange(req *KeyrangeRequest, sendReply func(reply interface{}) error) (err error) {
+	resolver, err := key.GetResolver(*keyspaceIdResolver)
+	if err != nil {
+		return err
+	}
+	// Calls cascade like this: BinlogStreamer->KeyrangeFilterFunc->func(*BinlogTransaction)->sendReply
+	return updateStream.streamTransactions(req.GroupId, func(send sendTransactionFunc) sendTransactionFunc {
+		return KeyrangeFilterFunc(resolver, req.Keyrange, send)
+	}, sendReply)
+}
+
+func (updateStream *UpdateStream) StreamTables(req *TablesRequest, sendReply func(reply interface{}) error) (err error) {
+	// Calls cascade like this: BinlogStreamer->TablesFilterFunc->func(*BinlogTransaction)->sendReply
+	return updateStream.streamTransactions(req.GroupId, func(send sendTransactionFunc) sendTransactionFunc {
+		return TablesFilterFunc(req.Tables, send)
+	}, sendReply)
+}
+
+// streamTransactions streams the binlog transactions from groupId,
+// through the filter built by newFilter, to sendReply. It has the
+// setup shared by StreamKeyrange and StreamTables.
+func (updateStream *UpdateStream) streamTransactions(groupId string, newFilter func(sendTransactionFunc) sendTransactionFunc, sendReply func(reply interface{}) error) (err error) {
 	defer func() {
 		if x := recover(); x != nil {
 			err = x.(error)
@@ -220,7 +249,7 @@ func (updateStream *UpdateStream) StreamKeyrange(req *KeyrangeRequest, sendReply
 	updateStream.actionLock.Unlock()
 	defer updateStream.stateWaitGroup.Done()
 
-	rp, err := updateStream.mysqld.BinlogInfo(req.GroupId)
+	rp, err := updateStream.mysqld.BinlogInfo(groupId)
 	if err != nil {
 		return fmt.Errorf("error computing start position: %v", err)
 	}
@@ -230,8 +259,7 @@ func (updateStream *UpdateStream) StreamKeyrange(req *KeyrangeRequest, sendReply
 	updateStream.streams.Add(bls)
 	defer updateStream.streams.Delete(bls)
 
-	// Calls cascade like this: BinlogStreamer->KeyrangeFilterFunc->func(*BinlogTransaction)->sendReply
-	f := KeyrangeFilterFunc(req.Keyrange, func(reply *BinlogTransaction) error {
+	f := newFilter(func(reply *BinlogTransaction) error {
 		return sendReply(reply)
 	})
 	return bls.Stream(rp.MasterLogFile, int64(rp.MasterLogPosition), f)
@@ -0,0 +1,233 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package servenv
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/acl"
+)
+
+// This file contains the configuration file of the servers: a JSON
+// object with the values of the flags, for instance:
+//
+//	{"queryserver-config-pool-size": 32, "v": 1, "port": 15101}
+//
+// The flags set on the command line take precedence. The file is
+// read again on SIGHUP or /debug/config/reload, and the flags that
+// were changed in the file are updated if they can be changed at
+// runtime (see RegisterMutableFlag), the other ones need a restart.
+// /debug/config exports the effective configuration, in the same
+// format.
+
+var configFile = flag.String("config-file", "", "JSON file with the values of the flags, as {\"<flag name>\": <value>, ...}. The command line flags take precedence. The file is read again on SIGHUP or /debug/config/reload")
+
+var (
+	configMu sync.Mutex
+	// commandLineFlags are the flags set on the command line, the
+	// configuration file doesn't change them.
+	commandLineFlags map[string]bool
+	// loadedConfig is the content of the configuration file, as
+	// last loaded.
+	loadedConfig map[string]string
+)
+
+// ConfigReload describes what a reload of the configuration file did.
+type ConfigReload struct {
+	// Changed are the flags that were updated.
+	Changed []string
+	// NeedRestart are the flags that were changed in the file, but
+	// cannot be changed at runtime.
+	NeedRestart []string
+}
+
+// parseConfig parses the content of a configuration file, and returns
+// the values of the flags as strings.
+func parseConfig(data []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	config := make(map[string]string, len(raw))
+	for name, value := range raw {
+		if flag.Lookup(name) == nil {
+			return nil, fmt.Errorf("unknown flag %v", name)
+		}
+		switch value := value.(type) {
+		case string:
+			config[name] = value
+		case json.Number:
+			config[name] = value.String()
+		case bool:
+			config[name] = strconv.FormatBool(value)
+		default:
+			return nil, fmt.Errorf("invalid value for flag %v: %v", name, value)
+		}
+	}
+	return config, nil
+}
+
+func readConfig(filename string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data)
+}
+
+// configChanges returns the flags that changed between two versions of
+// the configuration file, with their new value. A flag removed from
+// the file goes back to its default value.
+func configChanges(previous, current map[string]string) map[string]string {
+	changes := make(map[string]string)
+	for name, value := range current {
+		if old, ok := previous[name]; !ok || old != value {
+			changes[name] = value
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			changes[name] = flag.Lookup(name).DefValue
+		}
+	}
+	return changes
+}
+
+// loadConfig applies the configuration file, if any, to the flags
+// that were not set on the command line. It is called by Init, right
+// after the flags were parsed.
+func loadConfig() {
+	if *configFile == "" {
+		return
+	}
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	commandLineFlags = make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		commandLineFlags[f.Name] = true
+	})
+	config, err := readConfig(*configFile)
+	if err != nil {
+		log.Fatalf("cannot read configuration file %v: %v", *configFile, err)
+	}
+	for name, value := range config {
+		if commandLineFlags[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			log.Fatalf("invalid value in configuration file %v: -%v=%v: %v", *configFile, name, value, err)
+		}
+	}
+	loadedConfig = config
+
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP)
+		for _ = range c {
+			if _, err := ReloadConfig(); err != nil {
+				log.Errorf("cannot reload configuration file: %v", err)
+			}
+		}
+	}()
+}
+
+// ReloadConfig reads the configuration file again, and updates the
+// mutable flags that were changed in the file.
+func ReloadConfig() (*ConfigReload, error) {
+	if *configFile == "" {
+		return nil, fmt.Errorf("no configuration file")
+	}
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	config, err := readConfig(*configFile)
+	if err != nil {
+		return nil, err
+	}
+	changes := configChanges(loadedConfig, config)
+	names := make([]string, 0, len(changes))
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := &ConfigReload{}
+	for _, name := range names {
+		if commandLineFlags[name] {
+			continue
+		}
+		mutableFlagsMu.Lock()
+		_, mutable := mutableFlags[name]
+		mutableFlagsMu.Unlock()
+		if !mutable {
+			log.Warningf("flag -%v changed in configuration file %v, restart to apply it", name, *configFile)
+			result.NeedRestart = append(result.NeedRestart, name)
+			continue
+		}
+		if _, err := SetFlag(name, changes[name]); err != nil {
+			return result, err
+		}
+		result.Changed = append(result.Changed, name)
+	}
+	loadedConfig = config
+	log.Infof("configuration file %v reloaded: changed %v, need restart %v", *configFile, result.Changed, result.NeedRestart)
+	return result, nil
+}
+
+func init() {
+	onInit(func() {
+		http.HandleFunc("/debug/config", serveConfig)
+		http.HandleFunc("/debug/config/reload", serveConfigReload)
+	})
+}
+
+// serveConfig returns the effective configuration, in the format of
+// the configuration file. The secret values are hidden.
+func serveConfig(w http.ResponseWriter, r *http.Request) {
+	config := make(map[string]string)
+	for _, fv := range CurrentFlags() {
+		config[fv.Name] = fv.Value
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
+
+// serveConfigReload reloads the configuration file. If roles are
+// enforced, the caller needs the dba role.
+func serveConfigReload(w http.ResponseWriter, r *http.Request) {
+	if err := acl.CheckHTTP(r, acl.DBA); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	result, err := ReloadConfig()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Errorf("cannot encode configuration reload: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package servenv
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	flag.Int("test-config-int", 1, "test flag")
+	flag.Bool("test-config-bool", false, "test flag")
+	flag.String("test-config-string", "", "test flag")
+
+	got, err := parseConfig([]byte(`{"test-config-int": 12345678901, "test-config-bool": true, "test-config-string": "a"}`))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	want := map[string]string{"test-config-int": "12345678901", "test-config-bool": "true", "test-config-string": "a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseConfig: got %v, want %v", got, want)
+	}
+	if _, err := parseConfig([]byte(`{"test-config-unknown": 1}`)); err == nil {
+		t.Errorf("parseConfig of an unknown flag should have failed")
+	}
+	if _, err := parseConfig([]byte(`{"test-config-string": ["a"]}`)); err == nil {
+		t.Errorf("parseConfig of a list should have failed")
+	}
+
+	got = configChanges(
+		map[string]string{"test-config-int": "2", "test-config-bool": "true", "test-config-string": "a"},
+		map[string]string{"test-config-int": "3", "test-config-string": "a"})
+	want = map[string]string{"test-config-int": "3", "test-config-bool": "false"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("configChanges: got %v, want %v", got, want)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	mutable := flag.Int("test-reload-mutable", 1, "test flag")
+	fixed := flag.Int("test-reload-fixed", 1, "test flag")
+	RegisterMutableFlag("test-reload-mutable", nil)
+
+	dir, err := ioutil.TempDir("", "config_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "config.json")
+	if err := ioutil.WriteFile(filename, []byte(`{"test-reload-mutable": 2, "test-reload-fixed": 2}`), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	*configFile = filename
+	defer func() { *configFile = "" }()
+
+	loadConfig()
+	if *mutable != 2 || *fixed != 2 {
+		t.Errorf("configuration file not loaded: %v %v", *mutable, *fixed)
+	}
+
+	if err := ioutil.WriteFile(filename, []byte(`{"test-reload-mutable": 3, "test-reload-fixed": 3}`), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	result, err := ReloadConfig()
+	if err != nil {
+		t.Fatalf("ReloadConfig failed: %v", err)
+	}
+	want := &ConfigReload{Changed: []string{"test-reload-mutable"}, NeedRestart: []string{"test-reload-fixed"}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("ReloadConfig: got %#v, want %#v", result, want)
+	}
+	if *mutable != 3 || *fixed != 2 {
+		t.Errorf("unexpected flags after reload: %v %v", *mutable, *fixed)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package servenv
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/rpcwrap"
+	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+	"github.com/youtube/vitess/go/vt/acl"
+	"github.com/youtube/vitess/go/vt/rpc"
+)
+
+// This file contains the flag registry: /debug/flags lists the
+// current value of all the flags of the process, and the Flags RPC
+// service lets callers with the dba role change the flags that were
+// registered as mutable, without restarting the process.
+
+var (
+	mutableFlagsMu sync.Mutex
+	mutableFlags   = make(map[string]func() error)
+)
+
+// RegisterMutableFlag allows the flag to be changed at runtime with
+// SetFlag. apply is called after the value of the flag changed, to
+// propagate it to the running components, and the previous value is
+// restored if it fails. apply can be nil if the flag is read each
+// time it is used.
+func RegisterMutableFlag(name string, apply func() error) {
+	mutableFlagsMu.Lock()
+	defer mutableFlagsMu.Unlock()
+	if _, ok := mutableFlags[name]; ok {
+		log.Fatalf("mutable flag %v registered twice", name)
+	}
+	mutableFlags[name] = apply
+}
+
+// FlagValue is the current value of a flag.
+type FlagValue struct {
+	Name    string
+	Value   string
+	Default string
+	Usage   string
+	Mutable bool
+}
+
+// FlagValues is the list of the flags of a process.
+type FlagValues struct {
+	Flags []FlagValue
+}
+
+// isSecretFlag returns true for the flags whose value is not
+// displayed, like the database passwords.
+func isSecretFlag(name string) bool {
+	return strings.Contains(name, "pass") || strings.Contains(name, "secret")
+}
+
+func newFlagValue(f *flag.Flag, mutable bool) FlagValue {
+	fv := FlagValue{
+		Name:    f.Name,
+		Value:   f.Value.String(),
+		Default: f.DefValue,
+		Usage:   f.Usage,
+		Mutable: mutable,
+	}
+	if isSecretFlag(f.Name) {
+		if fv.Value != "" {
+			fv.Value = "<hidden>"
+		}
+		if fv.Default != "" {
+			fv.Default = "<hidden>"
+		}
+	}
+	return fv
+}
+
+// CurrentFlags returns all the flags of the process, sorted by name.
+func CurrentFlags() []FlagValue {
+	mutableFlagsMu.Lock()
+	defer mutableFlagsMu.Unlock()
+	var result []FlagValue
+	flag.VisitAll(func(f *flag.Flag) {
+		_, mutable := mutableFlags[f.Name]
+		result = append(result, newFlagValue(f, mutable))
+	})
+	return result
+}
+
+// SetFlag changes the value of a mutable flag, and returns its new
+// value.
+func SetFlag(name, value string) (FlagValue, error) {
+	mutableFlagsMu.Lock()
+	defer mutableFlagsMu.Unlock()
+	apply, ok := mutableFlags[name]
+	if !ok {
+		return FlagValue{}, fmt.Errorf("flag %v cannot be changed at runtime", name)
+	}
+	f := flag.Lookup(name)
+	if f == nil {
+		return FlagValue{}, fmt.Errorf("unknown flag %v", name)
+	}
+	previous := f.Value.String()
+	if err := flag.Set(name, value); err != nil {
+		return FlagValue{}, fmt.Errorf("cannot set -%v=%v: %v", name, value, err)
+	}
+	if apply != nil {
+		if err := apply(); err != nil {
+			if rerr := flag.Set(name, previous); rerr != nil {
+				log.Errorf("cannot restore -%v=%v: %v", name, previous, rerr)
+			}
+			return FlagValue{}, fmt.Errorf("cannot apply -%v=%v: %v", name, value, err)
+		}
+	}
+	log.Infof("flag -%v changed from %q to %q", name, previous, value)
+	return newFlagValue(f, true), nil
+}
+
+// SetFlagArgs are the arguments of Flags.SetFlag.
+type SetFlagArgs struct {
+	Name  string
+	Value string
+}
+
+// Flags is the RPC service of the flag registry.
+type Flags struct{}
+
+// GetFlags returns all the flags of the process.
+func (*Flags) GetFlags(context *rpcproto.Context, noInput *rpc.UnusedRequest, reply *FlagValues) error {
+	reply.Flags = CurrentFlags()
+	return nil
+}
+
+// SetFlag changes a mutable flag. If roles are enforced, the caller
+// needs the dba role.
+func (*Flags) SetFlag(context *rpcproto.Context, args *SetFlagArgs, reply *FlagValue) error {
+	if acl.Enabled() {
+		role, ok := acl.RoleFromContext(context)
+		if !ok {
+			return fmt.Errorf("access denied: no role for caller %v", context.RemoteAddr)
+		}
+		if !acl.Allowed(role, []string{acl.DBA}) {
+			return fmt.Errorf("access denied: role %v of caller %v cannot change flags", role, context.RemoteAddr)
+		}
+	}
+	fv, err := SetFlag(args.Name, args.Value)
+	if err != nil {
+		return err
+	}
+	*reply = fv
+	return nil
+}
+
+func init() {
+	onInit(func() {
+		rpcwrap.RegisterAuthenticated(&Flags{})
+		http.HandleFunc("/debug/flags", serveFlags)
+	})
+}
+
+// serveFlags returns the current value of all the flags, as text or
+// as JSON if format=json is set. The mutable flags are marked with a
+// '*' in the text format.
+func serveFlags(w http.ResponseWriter, r *http.Request) {
+	flags := CurrentFlags()
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(flags); err != nil {
+			log.Errorf("cannot encode flags: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	for _, fv := range flags {
+		mutable := ""
+		if fv.Mutable {
+			mutable = " *"
+		}
+		fmt.Fprintf(w, "%v=%v%v\n", fv.Name, fv.Value, mutable)
+	}
+}
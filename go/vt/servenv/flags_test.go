@@ -0,0 +1,61 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package servenv
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+)
+
+func TestSetFlag(t *testing.T) {
+	size := flag.Int("test-mutable-size", 10, "test flag")
+	flag.String("test-fixed", "value", "test flag")
+	flag.String("test-db-pass", "secret", "test flag")
+	applied := 0
+	RegisterMutableFlag("test-mutable-size", func() error {
+		if *size < 0 {
+			return fmt.Errorf("negative size")
+		}
+		applied = *size
+		return nil
+	})
+
+	fv, err := SetFlag("test-mutable-size", "20")
+	if err != nil {
+		t.Fatalf("SetFlag failed: %v", err)
+	}
+	if fv.Value != "20" || fv.Default != "10" || !fv.Mutable || applied != 20 {
+		t.Errorf("unexpected result: %#v, applied %v", fv, applied)
+	}
+	if _, err := SetFlag("test-mutable-size", "-1"); err == nil {
+		t.Errorf("SetFlag with a failing apply should have failed")
+	}
+	if *size != 20 || applied != 20 {
+		t.Errorf("failed SetFlag was not reverted: %v, applied %v", *size, applied)
+	}
+	if _, err := SetFlag("test-fixed", "other"); err == nil {
+		t.Errorf("SetFlag of a flag that is not mutable should have failed")
+	}
+
+	found := 0
+	for _, fv := range CurrentFlags() {
+		switch fv.Name {
+		case "test-fixed":
+			found++
+			if fv.Value != "value" || fv.Mutable {
+				t.Errorf("unexpected test-fixed: %#v", fv)
+			}
+		case "test-db-pass":
+			found++
+			if fv.Value != "<hidden>" || fv.Default != "<hidden>" {
+				t.Errorf("secret flag is displayed: %#v", fv)
+			}
+		}
+	}
+	if found != 2 {
+		t.Errorf("missing flags in CurrentFlags")
+	}
+}
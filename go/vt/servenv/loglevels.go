@@ -0,0 +1,89 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package servenv
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/acl"
+)
+
+// runtimeLogFlags are the glog flags that can be changed at runtime
+// through /debug/loglevels, without restarting the process: the
+// global verbosity for log.V(n), the per-module verbosity (for
+// instance vmodule=query_engine=2,scatter_conn=1), and the lowest
+// severity that is also written to stderr.
+var runtimeLogFlags = []string{"v", "vmodule", "stderrthreshold"}
+
+func init() {
+	for _, name := range runtimeLogFlags {
+		RegisterMutableFlag(name, nil)
+	}
+	onInit(func() {
+		http.HandleFunc("/debug/loglevels", serveLogLevels)
+	})
+}
+
+// serveLogLevels sets the log flags passed as parameters, and then
+// returns the current value of all the log flags, as text or as JSON
+// if format=json is set. The flags are changed through SetFlag, only
+// by a POST, and if roles are enforced the caller needs the dba role.
+func serveLogLevels(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	changed := false
+	for _, name := range runtimeLogFlags {
+		if _, ok := r.Form[name]; ok {
+			changed = true
+		}
+	}
+	if changed {
+		if r.Method != "POST" {
+			http.Error(w, "log flags can only be changed by a POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := acl.CheckHTTP(r, acl.DBA); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	for _, name := range runtimeLogFlags {
+		if _, ok := r.Form[name]; !ok {
+			continue
+		}
+		value := r.Form.Get(name)
+		if _, err := SetFlag(name, value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Infof("log flag -%v set to %q by %v", name, value, r.RemoteAddr)
+	}
+
+	current := make(map[string]string, len(runtimeLogFlags))
+	for _, name := range runtimeLogFlags {
+		if f := flag.Lookup(name); f != nil {
+			current[name] = f.Value.String()
+		}
+	}
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(current); err != nil {
+			log.Errorf("cannot encode log flags: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	for _, name := range runtimeLogFlags {
+		if value, ok := current[name]; ok {
+			fmt.Fprintf(w, "%v=%v\n", name, value)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package servenv
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/acl"
+)
+
+func logLevelsRequest(t *testing.T, method, query string) *httptest.ResponseRecorder {
+	var r *http.Request
+	var err error
+	if method == "POST" {
+		r, err = http.NewRequest(method, "/debug/loglevels", strings.NewReader(query))
+		if r != nil {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		r, err = http.NewRequest(method, "/debug/loglevels?"+query, nil)
+	}
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	w := httptest.NewRecorder()
+	serveLogLevels(w, r)
+	return w
+}
+
+func TestServeLogLevels(t *testing.T) {
+	previous := flag.Lookup("v").Value.String()
+	defer flag.Set("v", previous)
+	defer acl.SetMapping(nil)
+	acl.SetMapping(nil)
+
+	w := logLevelsRequest(t, "GET", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "v="+previous+"\n") {
+		t.Errorf("GET: got %v %q", w.Code, w.Body.String())
+	}
+
+	w = logLevelsRequest(t, "GET", url.Values{"v": {"3"}}.Encode())
+	if w.Code != http.StatusMethodNotAllowed || flag.Lookup("v").Value.String() != previous {
+		t.Errorf("GET should not change the flags: got %v, v=%v", w.Code, flag.Lookup("v").Value)
+	}
+
+	w = logLevelsRequest(t, "POST", url.Values{"v": {"3"}, "format": {"json"}}.Encode())
+	if w.Code != http.StatusOK || flag.Lookup("v").Value.String() != "3" || !strings.Contains(w.Body.String(), `"v":"3"`) {
+		t.Errorf("POST: got %v %q, v=%v", w.Code, w.Body.String(), flag.Lookup("v").Value)
+	}
+
+	if w = logLevelsRequest(t, "POST", url.Values{"v": {"verbose"}}.Encode()); w.Code != http.StatusBadRequest {
+		t.Errorf("POST of an invalid value: got %v", w.Code)
+	}
+	if w = logLevelsRequest(t, "POST", url.Values{"v": {"3"}}.Encode()); w.Code != http.StatusOK {
+		t.Errorf("POST: got %v", w.Code)
+	}
+
+	acl.SetMapping(map[string]string{"cn:vtctld": acl.DBA})
+	w = logLevelsRequest(t, "POST", url.Values{"v": {"1"}}.Encode())
+	if w.Code != http.StatusForbidden || flag.Lookup("v").Value.String() != "3" {
+		t.Errorf("POST without the dba role: got %v, v=%v", w.Code, flag.Lookup("v").Value)
+	}
+	if w = logLevelsRequest(t, "GET", ""); w.Code != http.StatusOK {
+		t.Errorf("GET should not need a role: got %v", w.Code)
+	}
+}
@@ -1,22 +1,30 @@
 package servenv
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
+	"syscall"
+	"time"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/proc"
+	"github.com/youtube/vitess/go/sync2"
 )
 
 var (
+	lameduckPeriod = flag.Duration("lameduck-period", 50*time.Millisecond, "how long the server keeps serving after SIGTERM, while its clients move to other servers, before it stops")
+
 	onCloseHooks hooks
+	onTermHooks  hooks
+	lameduck     sync2.AtomicInt32
 )
 
 // Run starts listening for RPC and HTTP requests on the given port,
-// and blocks until it the process gets a signal.
+// and on -secure-port with TLS if it is set, and blocks until the
+// process gets a signal.
 func Run(port int) {
-	onRunHooks.Fire()
-	RunSecure(port, 0, "", "", "")
+	RunSecure(port, *SecurePort, *certFile, *keyFile, *caCertFile)
 }
 
 // RunSecure is like Run, but it additionally listens for RPC and HTTP
@@ -37,15 +45,48 @@ func RunSecure(port int, securePort int, cert, key, caCert string) {
 		log.Infof("listening on secure port %v", securePort)
 		SecureServe(fmt.Sprintf(":%d", securePort), cert, key, caCert)
 	}
-	proc.Wait()
+	if proc.Wait() == syscall.SIGTERM {
+		// A successor taking over the port sends SIGUSR1 instead,
+		// and is waiting for it: no lameduck period then.
+		enterLameduck()
+	}
+	// Stop accepting connections: after a socket handoff, the new
+	// process is accepting them on the same socket. The secure port
+	// is released first, the successor binds it after the main one.
+	closeSecureListener()
+	l.Close()
 	Close()
 }
 
+// enterLameduck runs the OnTerm hooks, and keeps serving for
+// -lameduck-period.
+func enterLameduck() {
+	log.Infof("entering lameduck mode for %v", *lameduckPeriod)
+	lameduck.Set(1)
+	onTermHooks.Fire()
+	time.Sleep(*lameduckPeriod)
+	log.Infof("lameduck period is over, shutting down")
+}
+
+// IsLameduck returns true once the process got SIGTERM: it still
+// serves, but its health checks should fail so its clients go away.
+func IsLameduck() bool {
+	return lameduck.Get() != 0
+}
+
 // Close runs any registered exit hooks in parallel.
 func Close() {
 	onCloseHooks.Fire()
 }
 
+// OnTerm registers f to be run when the process gets SIGTERM, at the
+// beginning of its lameduck period: it should make the clients stop
+// sending new requests, while the current ones are still served. All
+// hooks are run in parallel.
+func OnTerm(f func()) {
+	onTermHooks.Add(f)
+}
+
 // OnClose registers f to be run at the end of the app lifecycle. All
 // hooks are run in parallel.
 func OnClose(f func()) {
@@ -0,0 +1,32 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package servenv
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLameduck(t *testing.T) {
+	*lameduckPeriod = 10 * time.Millisecond
+	healthy := make(chan bool, 1)
+	OnTerm(func() {
+		healthy <- IsLameduck()
+	})
+	if IsLameduck() {
+		t.Fatalf("lameduck before SIGTERM")
+	}
+	start := time.Now()
+	enterLameduck()
+	if !IsLameduck() {
+		t.Errorf("not lameduck after enterLameduck")
+	}
+	if !<-healthy {
+		t.Errorf("OnTerm hook was run before the lameduck mode started")
+	}
+	if time.Now().Sub(start) < *lameduckPeriod {
+		t.Errorf("lameduck period was too short: %v", time.Now().Sub(start))
+	}
+}
@@ -6,53 +6,71 @@ package servenv
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"flag"
-	"io/ioutil"
+	"fmt"
 	"net/http"
+	"sync"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/proc"
+	"github.com/youtube/vitess/go/vt/vttls"
 )
 
 var (
 	secureThrottle  = flag.Int64("secure-accept-rate", 64, "Maximum number of secure connection accepts per second")
 	secureMaxBuffer = flag.Int("secure-max-buffer", 1500, "Maximum number of secure accepts allowed to accumulate")
-)
 
-// SecureListen obtains a listener that accepts
-// secure connections
-func SecureServe(addr string, certFile, keyFile, caFile string) {
-	config := tls.Config{}
+	// SecurePort is the port serving RPC and HTTP over TLS, if not 0.
+	SecurePort = flag.Int("secure-port", 0, "port for the secure server, serving RPCs and HTTP over TLS")
+	certFile   = flag.String("cert", "", "certificate file of the secure server")
+	keyFile    = flag.String("key", "", "key file of the secure server")
+	caCertFile = flag.String("ca-cert", "", "if set, clients of the secure server have to present a certificate signed by this CA")
 
-	// load the server cert / key
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		log.Fatalf("%s", err)
-	}
-	config.Certificates = []tls.Certificate{cert}
-
-	// load the ca if necessary
-	// FIXME(alainjobart) this doesn't quite work yet, have
-	// to investigate
-	if caFile != "" {
-		config.ClientCAs = x509.NewCertPool()
+	// secureListener is the throttled listener of the secure server,
+	// so -secure-accept-rate can be changed at runtime.
+	secureListenerMu sync.Mutex
+	secureListener   *ThrottledListener
+)
 
-		pemCerts, err := ioutil.ReadFile(caFile)
-		if err != nil {
-			log.Fatalf("%s", err)
+func init() {
+	RegisterMutableFlag("secure-accept-rate", func() error {
+		if *secureThrottle <= 0 {
+			return fmt.Errorf("secure-accept-rate must be positive")
 		}
-		if !config.ClientCAs.AppendCertsFromPEM(pemCerts) {
-			log.Fatalf("%s", err)
+		secureListenerMu.Lock()
+		defer secureListenerMu.Unlock()
+		if secureListener != nil {
+			secureListener.SetMaxRate(*secureThrottle)
 		}
+		return nil
+	})
+}
 
-		config.ClientAuth = tls.RequireAndVerifyClientCert
+// SecureServe serves RPC and HTTP requests over TLS on addr, using
+// the given certificate and key. If caFile is set, the clients have
+// to present a certificate signed by it.
+func SecureServe(addr string, certFile, keyFile, caFile string) {
+	config, err := vttls.ServerConfig(certFile, keyFile, caFile)
+	if err != nil {
+		log.Fatalf("cannot load the secure server configuration: %v", err)
 	}
-	l, err := tls.Listen("tcp", addr, &config)
+	l, err := proc.ListenSecure(addr)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
-	throttled := NewThrottledListener(l, *secureThrottle, *secureMaxBuffer)
+	throttled := NewThrottledListener(tls.NewListener(l, config), *secureThrottle, *secureMaxBuffer)
+	secureListenerMu.Lock()
+	secureListener = throttled.(*ThrottledListener)
+	secureListenerMu.Unlock()
 	cl := proc.Published(throttled, "SecureConnections", "SecureAccepts")
 	go http.Serve(cl, nil)
 }
+
+// closeSecureListener stops accepting secure connections.
+func closeSecureListener() {
+	secureListenerMu.Lock()
+	defer secureListenerMu.Unlock()
+	if secureListener != nil {
+		secureListener.Close()
+	}
+}
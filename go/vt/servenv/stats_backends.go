@@ -0,0 +1,24 @@
+package servenv
+
+import (
+	"flag"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	_ "github.com/youtube/vitess/go/stats/prometheus"
+	_ "github.com/youtube/vitess/go/stats/push"
+)
+
+var statsBackends = flag.String("stats-backends", "prometheus", "comma separated list of stats backends to enable, in addition to /debug/vars (prometheus, opentsdb, graphite)")
+
+func init() {
+	onInit(func() {
+		if *statsBackends == "" {
+			return
+		}
+		if err := stats.StartBackends(strings.Split(*statsBackends, ",")); err != nil {
+			log.Fatalf("%v, known backends are %v", err, stats.BackendNames())
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package servenv
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// This file contains the /debug/status page framework. Every binary
+// gets the same page, with a header describing the process, the
+// sections the binary registered, and links to the /debug endpoints.
+
+var (
+	serverStart = time.Now()
+
+	statusMu       sync.Mutex
+	statusSections []statusSection
+	statusLinks    = []statusLink{
+		{"Exported variables", "/debug/vars"},
+		{"Prometheus metrics", "/metrics"},
+		{"Profiling", "/debug/pprof/"},
+		{"Log levels", "/debug/loglevels"},
+		{"Flags", "/debug/flags"},
+		{"Configuration", "/debug/config"},
+		{"Flush logs", "/debug/flushlogs"},
+	}
+)
+
+type statusSection struct {
+	Banner   string
+	template *template.Template
+	f        func() interface{}
+}
+
+type statusLink struct {
+	Name string
+	Url  string
+}
+
+// AddStatusPart adds a section to the status page. frag is an HTML
+// template fragment, executed with the result of f every time the
+// page is rendered.
+func AddStatusPart(banner, frag string, f func() interface{}) {
+	t := template.Must(template.New(banner).Parse(frag))
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	statusSections = append(statusSections, statusSection{Banner: banner, template: t, f: f})
+}
+
+// AddStatusSection adds a text section to the status page.
+func AddStatusSection(banner string, f func() string) {
+	AddStatusPart(banner, `<pre>{{.}}</pre>`, func() interface{} { return f() })
+}
+
+// AddStatusLink adds a link to the list of /debug endpoints at the
+// bottom of the status page.
+func AddStatusLink(name, url string) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	statusLinks = append(statusLinks, statusLink{name, url})
+}
+
+const statusHTML = `<!DOCTYPE html>
+<html>
+<head>
+<title>{{.Binary}} status</title>
+<style>
+  body { font-family: sans-serif; }
+  h2 { background-color: #ddd; padding: 0.2em; }
+  table { border-collapse: collapse; }
+  td, th { border: 1px solid #999; padding: 0.2em 0.5em; }
+</style>
+</head>
+<body>
+<h1>{{.Binary}} on {{.Hostname}}</h1>
+<p>
+  Pid {{.Pid}}, started {{.Started}}, running for {{.Uptime}}.<br/>
+  Current time: {{.Now}}
+</p>
+{{range .Sections}}
+<h2>{{.Banner}}</h2>
+{{.Content}}
+{{end}}
+<h2>Debug endpoints</h2>
+<ul>
+{{range .Links}}  <li><a href="{{.Url}}">{{.Name}}</a></li>
+{{end}}</ul>
+</body>
+</html>
+`
+
+var statusTemplate = template.Must(template.New("status").Parse(statusHTML))
+
+type renderedSection struct {
+	Banner  string
+	Content template.HTML
+}
+
+func serveStatus(w http.ResponseWriter, r *http.Request) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown host"
+	}
+
+	statusMu.Lock()
+	sections := make([]statusSection, len(statusSections))
+	copy(sections, statusSections)
+	links := make([]statusLink, len(statusLinks))
+	copy(links, statusLinks)
+	statusMu.Unlock()
+
+	rendered := make([]renderedSection, len(sections))
+	for i, s := range sections {
+		buf := &bytes.Buffer{}
+		if err := s.template.Execute(buf, s.f()); err != nil {
+			buf.Reset()
+			fmt.Fprintf(buf, "<b>cannot render section: %v</b>", template.HTMLEscapeString(err.Error()))
+		}
+		rendered[i] = renderedSection{Banner: s.Banner, Content: template.HTML(buf.String())}
+	}
+
+	now := time.Now()
+	data := map[string]interface{}{
+		"Binary":   path.Base(os.Args[0]),
+		"Hostname": hostname,
+		"Pid":      os.Getpid(),
+		"Started":  serverStart,
+		"Uptime":   now.Sub(serverStart),
+		"Now":      now,
+		"Sections": rendered,
+		"Links":    links,
+	}
+	if err := statusTemplate.Execute(w, data); err != nil {
+		log.Errorf("cannot render status page: %v", err)
+	}
+}
+
+// ErrorLog keeps the most recent errors of a process, so they can be
+// displayed on its status page.
+type ErrorLog struct {
+	mu     sync.Mutex
+	size   int
+	errors []TimedError
+}
+
+// TimedError is an error with the time it happened.
+type TimedError struct {
+	Time  time.Time
+	Error string
+}
+
+// NewErrorLog returns an ErrorLog keeping the size most recent errors.
+func NewErrorLog(size int) *ErrorLog {
+	return &ErrorLog{size: size}
+}
+
+// Record adds an error to the log, dropping the oldest one if needed.
+func (el *ErrorLog) Record(err error) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	el.errors = append(el.errors, TimedError{time.Now(), err.Error()})
+	if len(el.errors) > el.size {
+		el.errors = el.errors[len(el.errors)-el.size:]
+	}
+}
+
+// Errors returns the recorded errors, most recent first.
+func (el *ErrorLog) Errors() []TimedError {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	result := make([]TimedError, len(el.errors))
+	for i, e := range el.errors {
+		result[len(el.errors)-1-i] = e
+	}
+	return result
+}
+
+// ErrorLogStatusHTML is a status part fragment to display an ErrorLog.
+const ErrorLogStatusHTML = `{{if .}}<table>
+  <tr><th>Time</th><th>Error</th></tr>
+  {{range .}}<tr><td>{{.Time}}</td><td>{{.Error}}</td></tr>
+  {{end}}
+</table>{{else}}No recent errors.{{end}}`
+
+// AddErrorLogStatusPart adds a section displaying the errors of el.
+func AddErrorLogStatusPart(banner string, el *ErrorLog) {
+	AddStatusPart(banner, ErrorLogStatusHTML, func() interface{} {
+		return el.Errors()
+	})
+}
+
+func init() {
+	onInit(func() {
+		http.HandleFunc("/debug/status", serveStatus)
+	})
+}
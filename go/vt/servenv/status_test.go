@@ -0,0 +1,44 @@
+package servenv
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorLog(t *testing.T) {
+	el := NewErrorLog(2)
+	for i := 0; i < 3; i++ {
+		el.Record(fmt.Errorf("error %v", i))
+	}
+	errors := el.Errors()
+	if len(errors) != 2 || errors[0].Error != "error 2" || errors[1].Error != "error 1" {
+		t.Errorf("want the two last errors, most recent first, got %v", errors)
+	}
+}
+
+func TestStatusPage(t *testing.T) {
+	el := NewErrorLog(10)
+	el.Record(fmt.Errorf("<bad> things"))
+	AddStatusSection("Text Section", func() string { return "some text" })
+	AddStatusPart("Broken Section", "{{.Missing}}", func() interface{} { return 12 })
+	AddErrorLogStatusPart("Errors", el)
+	AddStatusLink("Test link", "/debug/test")
+
+	response := httptest.NewRecorder()
+	serveStatus(response, nil)
+	body := response.Body.String()
+	for _, want := range []string{
+		"<h2>Text Section</h2>",
+		"<pre>some text</pre>",
+		"cannot render section",
+		"&lt;bad&gt; things",
+		`<a href="/debug/test">Test link</a>`,
+		`<a href="/debug/vars">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("status page doesn't contain %q:\n%v", want, body)
+		}
+	}
+}
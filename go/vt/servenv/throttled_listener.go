@@ -7,13 +7,15 @@ package servenv
 import (
 	"net"
 	"time"
+
+	"github.com/youtube/vitess/go/sync2"
 )
 
 // ThrottledListener throttles the number connections
 // accepted to the specified rate.
 type ThrottledListener struct {
 	net.Listener
-	minDelay   time.Duration
+	minDelay   sync2.AtomicDuration
 	connBuffer chan net.Conn
 	lastError  error
 }
@@ -24,13 +26,18 @@ type ThrottledListener struct {
 func NewThrottledListener(l net.Listener, maxRate int64, maxBuffer int) net.Listener {
 	tln := &ThrottledListener{
 		Listener:   l,
-		minDelay:   time.Duration(1e9 / maxRate),
+		minDelay:   sync2.AtomicDuration(1e9 / maxRate),
 		connBuffer: make(chan net.Conn, maxBuffer),
 	}
 	go tln.acceptLoop()
 	return tln
 }
 
+// SetMaxRate changes the maximum rate of accepts per second.
+func (tln *ThrottledListener) SetMaxRate(maxRate int64) {
+	tln.minDelay.Set(time.Duration(1e9 / maxRate))
+}
+
 func (tln *ThrottledListener) acceptLoop() {
 	for {
 		c, err := tln.Listener.Accept()
@@ -56,7 +63,7 @@ func (tln *ThrottledListener) acceptLoop() {
 func (tln *ThrottledListener) Accept() (c net.Conn, err error) {
 	// We assume Accept is called in a tight loop.
 	// So we can just sleep for minDelay.
-	time.Sleep(tln.minDelay)
+	time.Sleep(tln.minDelay.Get())
 	c = <-tln.connBuffer
 	// If the channel is closed, return lastError.
 	if c == nil {
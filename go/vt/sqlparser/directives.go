@@ -0,0 +1,102 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Comment directives let a query override the default behavior of
+// vttablet and vtgate, for instance:
+// select /*vt+ SKIP_CONSOLIDATOR QUERY_TIMEOUT_MS=30000 */ * from t
+// They can be anywhere in the query, including in trailing comments.
+const (
+	DIRECTIVE_PREFIX = "/*vt+"
+
+	// DIRECTIVE_SKIP_CONSOLIDATOR makes vttablet send the query to
+	// MySQL even if an identical query is already running.
+	DIRECTIVE_SKIP_CONSOLIDATOR = "SKIP_CONSOLIDATOR"
+
+	// DIRECTIVE_QUERY_TIMEOUT_MS replaces the query timeout of
+	// vttablet, in milliseconds.
+	DIRECTIVE_QUERY_TIMEOUT_MS = "QUERY_TIMEOUT_MS"
+
+	// DIRECTIVE_ALLOW_FULL_SCAN lets vtgate send a lookup query to
+	// all the shards of the keyspace when the lookup column is not
+	// bound.
+	DIRECTIVE_ALLOW_FULL_SCAN = "ALLOW_FULL_SCAN"
+
+	// DIRECTIVE_SHARD makes vtgate send a lookup query to the
+	// given shard, without reading the lookup table.
+	DIRECTIVE_SHARD = "SHARD"
+
+	// DIRECTIVE_MIN_GROUP_ID makes vttablet fail the query if its
+	// mysqld has not applied the given replication group id yet.
+	DIRECTIVE_MIN_GROUP_ID = "MIN_GROUP_ID"
+
+	// DIRECTIVE_READ_AFTER_WRITE replaces the read-after-write
+	// consistency of the vtgate session for the query: "master",
+	// "replica" or "none".
+	DIRECTIVE_READ_AFTER_WRITE = "READ_AFTER_WRITE"
+)
+
+// Directives are the NAME or NAME=value settings of the comment
+// directives of a query. Names without a value are set to "".
+type Directives map[string]string
+
+// ParseDirectives returns the comment directives of sql, or nil if
+// it has none.
+func ParseDirectives(sql string) Directives {
+	if !strings.Contains(sql, DIRECTIVE_PREFIX) {
+		return nil
+	}
+	var directives Directives
+	tkn := NewStringTokenizer(sql)
+	for {
+		node := tkn.Scan()
+		switch node.Type {
+		case 0, LEX_ERROR:
+			return directives
+		case COMMENT:
+			comment := string(node.Value)
+			if !strings.HasPrefix(comment, DIRECTIVE_PREFIX) {
+				continue
+			}
+			comment = strings.TrimSuffix(strings.TrimSpace(comment), "*/")
+			for _, field := range strings.Fields(comment[len(DIRECTIVE_PREFIX):]) {
+				if directives == nil {
+					directives = make(Directives)
+				}
+				parts := strings.SplitN(field, "=", 2)
+				if len(parts) == 2 {
+					directives[parts[0]] = parts[1]
+				} else {
+					directives[parts[0]] = ""
+				}
+			}
+		}
+	}
+}
+
+// IsSet returns true if the directive is present.
+func (d Directives) IsSet(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// GetInt returns the value of an integer directive, or def if it is
+// missing or is not an integer.
+func (d Directives) GetInt(name string, def int64) int64 {
+	value, ok := d[name]
+	if !ok {
+		return def
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return def
+	}
+	return i
+}
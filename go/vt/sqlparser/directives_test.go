@@ -0,0 +1,41 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDirectives(t *testing.T) {
+	testCases := []struct {
+		sql  string
+		want Directives
+	}{
+		{"select * from t", nil},
+		{"select /* vt+ A */ * from t", nil},
+		{"select /*vt+ SKIP_CONSOLIDATOR QUERY_TIMEOUT_MS=100 */ * from t", Directives{"SKIP_CONSOLIDATOR": "", "QUERY_TIMEOUT_MS": "100"}},
+		{"select * from t where a = '/*vt+ SHARD=0 */'", nil},
+		{"select * from t /* trace */ /*vt+ SHARD=-80*/", Directives{"SHARD": "-80"}},
+		{"select /*vt+ A */ * from t /*vt+ B=1 */", Directives{"A": "", "B": "1"}},
+	}
+	for _, tc := range testCases {
+		if got := ParseDirectives(tc.sql); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseDirectives(%q): want %v, got %v", tc.sql, tc.want, got)
+		}
+	}
+
+	d := ParseDirectives("select /*vt+ QUERY_TIMEOUT_MS=100 BAD=x FLAG */ 1")
+	if !d.IsSet("FLAG") || d.IsSet("OTHER") {
+		t.Errorf("IsSet: want FLAG only, got %v", d)
+	}
+	if d.GetInt("QUERY_TIMEOUT_MS", 0) != 100 || d.GetInt("BAD", 5) != 5 || d.GetInt("OTHER", 7) != 7 {
+		t.Errorf("GetInt: unexpected values for %v", d)
+	}
+	var empty Directives
+	if empty.IsSet("FLAG") || empty.GetInt("QUERY_TIMEOUT_MS", 3) != 3 {
+		t.Errorf("nil directives should have no values")
+	}
+}
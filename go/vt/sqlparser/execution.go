@@ -153,6 +153,18 @@ type ExecPlan struct {
 	// PLAN_SET
 	SetKey   string
 	SetValue interface{}
+
+	// For selects, the row count of the limit clause, or nil
+	// if there is none.
+	Limit interface{}
+
+	// For updates and deletes, true if the where clause restricts
+	// the first primary key column.
+	WhereOnPK bool
+
+	// For PLAN_PASS_DML, true if the statement is an insert the
+	// other insert plans could not be used for.
+	PassInsert bool
 }
 
 type DDLPlan struct {
@@ -244,6 +256,7 @@ func (node *Node) execAnalyzeSql(getTable TableGetter) (plan *ExecPlan) {
 func (node *Node) execAnalyzeSelect(getTable TableGetter) (plan *ExecPlan) {
 	// Default plan
 	plan = &ExecPlan{PlanId: PLAN_PASS_SELECT, FieldQuery: node.GenerateFieldQuery(), FullQuery: node.GenerateSelectLimitQuery()}
+	plan.Limit = node.execAnalyzeLimit()
 
 	// There are bind variables in the SELECT list
 	if plan.FieldQuery == nil {
@@ -347,7 +360,7 @@ func (node *Node) execAnalyzeSelect(getTable TableGetter) (plan *ExecPlan) {
 }
 
 func (node *Node) execAnalyzeInsert(getTable TableGetter) (plan *ExecPlan) {
-	plan = &ExecPlan{PlanId: PLAN_PASS_DML, FullQuery: node.GenerateFullQuery()}
+	plan = &ExecPlan{PlanId: PLAN_PASS_DML, FullQuery: node.GenerateFullQuery(), PassInsert: true}
 	tableName := string(node.At(INSERT_TABLE_OFFSET).Value)
 	tableInfo := plan.setTableInfo(tableName, getTable)
 
@@ -370,6 +383,7 @@ func (node *Node) execAnalyzeInsert(getTable TableGetter) (plan *ExecPlan) {
 	rowValues := node.At(INSERT_VALUES_OFFSET) // VALUES/SELECT
 	if rowValues.Type == SELECT {
 		plan.PlanId = PLAN_INSERT_SUBQUERY
+		plan.PassInsert = false
 		plan.OuterQuery = node.GenerateInsertOuterQuery()
 		plan.Subquery = rowValues.GenerateSelectLimitQuery()
 		// Column list syntax is a subset of select expressions
@@ -388,6 +402,7 @@ func (node *Node) execAnalyzeInsert(getTable TableGetter) (plan *ExecPlan) {
 	rowList := rowValues.At(0) // VALUES->NODE_LIST
 	if pkValues := getInsertPKValues(pkColumnNumbers, rowList, tableInfo); pkValues != nil {
 		plan.PlanId = PLAN_INSERT_PK
+		plan.PassInsert = false
 		plan.OuterQuery = plan.FullQuery
 		plan.PKValues = pkValues
 	}
@@ -406,6 +421,7 @@ func (node *Node) execAnalyzeUpdate(getTable TableGetter) (plan *ExecPlan) {
 		plan.Reason = REASON_TABLE_NOINDEX
 		return plan
 	}
+	plan.WhereOnPK = isPKRange(node.At(UPDATE_WHERE_OFFSET).execAnalyzeWhere(), tableInfo.Indexes[0])
 
 	var ok bool
 	if plan.SecondaryPKValues, ok = node.At(UPDATE_LIST_OFFSET).execAnalyzeUpdateExpressions(tableInfo.Indexes[0]); !ok {
@@ -445,6 +461,7 @@ func (node *Node) execAnalyzeDelete(getTable TableGetter) (plan *ExecPlan) {
 		plan.Reason = REASON_TABLE_NOINDEX
 		return plan
 	}
+	plan.WhereOnPK = isPKRange(node.At(DELETE_WHERE_OFFSET).execAnalyzeWhere(), tableInfo.Indexes[0])
 
 	plan.PlanId = PLAN_DML_SUBQUERY
 	plan.OuterQuery = node.GenerateDeleteOuterQuery(tableInfo.Indexes[0])
@@ -496,6 +513,28 @@ func (node *ExecPlan) setTableInfo(tableName string, getTable TableGetter) *sche
 //-----------------------------------------------
 // Select
 
+// execAnalyzeLimit returns the row count of the limit clause of a
+// select: a sqltypes.Value, a bind variable name starting with ':',
+// or nil if there is no limit. The limit of a union is the one
+// the grammar attaches to its last select.
+func (node *Node) execAnalyzeLimit() interface{} {
+	switch node.Type {
+	case SELECT:
+		limit := node.At(SELECT_LIMIT_OFFSET)
+		if limit.Len() == 0 {
+			return nil
+		}
+		rowCount := limit.At(limit.Len() - 1)
+		switch rowCount.Type {
+		case NUMBER, VALUE_ARG:
+			return asInterface(rowCount)
+		}
+	case UNION, UNION_ALL, MINUS, EXCEPT, INTERSECT:
+		return node.At(1).execAnalyzeLimit()
+	}
+	return nil
+}
+
 func (node *Node) execAnalyzeSelectStructure() bool {
 	switch node.Type {
 	case UNION, UNION_ALL, MINUS, EXCEPT, INTERSECT:
@@ -652,8 +691,14 @@ func (node *Node) execAnalyzeID() *Node {
 
 func (node *Node) execAnalyzeValue() *Node {
 	switch node.Type {
-	case STRING, NUMBER, VALUE_ARG:
+	case STRING, NUMBER:
 		return node
+	case VALUE_ARG:
+		// The number of values of a list bind variable is
+		// only known at execution time.
+		if !isListArg(node.Value) {
+			return node
+		}
 	}
 	return nil
 }
@@ -826,6 +871,20 @@ func getSelectPKValues(conditions []*Node, pkIndex *schema.Index) (planId PlanTy
 	return PLAN_PK_EQUAL, pkValues
 }
 
+// isPKRange returns true if one of the conditions restricts the
+// first column of the primary key.
+func isPKRange(conditions []*Node, pkIndex *schema.Index) bool {
+	for _, condition := range conditions {
+		switch condition.Type {
+		case '=', '<', '>', LE, GE, NULL_SAFE_EQUAL, IN, BETWEEN:
+			if string(condition.At(0).Value) == pkIndex.Columns[0] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func getPKValues(conditions []*Node, pkIndex *schema.Index) (pkValues []interface{}) {
 	pkIndexScore := NewIndexScore(pkIndex)
 	pkValues = make([]interface{}, len(pkIndexScore.ColumnMatch))
@@ -0,0 +1,71 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"github.com/youtube/vitess/go/vt/key"
+)
+
+// The routings reported by ExplainRouting.
+const (
+	// ROUTING_VALUE is used for inserts, that go to the shard of
+	// the entity_id of their first row.
+	ROUTING_VALUE = "VALUE"
+
+	// ROUTING_CONDITION is used when the where clause restricts
+	// entity_id.
+	ROUTING_CONDITION = "CONDITION"
+
+	// ROUTING_UNION is used for unions, that go to the shards of
+	// each of their sides.
+	ROUTING_UNION = "UNION"
+
+	// ROUTING_SCATTER is used when the query goes to all the shards.
+	ROUTING_SCATTER = "SCATTER"
+)
+
+// RoutingExplanation describes how GetShardList routes a query.
+type RoutingExplanation struct {
+	Routing string
+	// Shards are the indexes of the target shards in tabletKeys.
+	Shards []int
+	// Sql is the query as MySQL would get it, with the bind
+	// variables substituted.
+	Sql string
+}
+
+// ExplainRouting returns how GetShardList would route sql, without
+// sending it anywhere.
+func ExplainRouting(sql string, bindVariables map[string]interface{}, tabletKeys []key.KeyspaceId) (explanation *RoutingExplanation, err error) {
+	defer handleError(&err)
+
+	tree, err := Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	plan := tree.getRoutingPlan()
+	generated, err := tree.GenerateFullQuery().GenerateQuery(bindVariables, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &RoutingExplanation{
+		Routing: plan.routing(),
+		Shards:  shardListFromPlan(plan, bindVariables, tabletKeys),
+		Sql:     string(generated),
+	}, nil
+}
+
+func (plan *RoutingPlan) routing() string {
+	switch plan.routingType {
+	case ROUTE_BY_VALUE:
+		return ROUTING_VALUE
+	case ROUTE_BY_UNION:
+		return ROUTING_UNION
+	}
+	if plan.criteria == nil {
+		return ROUTING_SCATTER
+	}
+	return ROUTING_CONDITION
+}
@@ -0,0 +1,41 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/key"
+)
+
+func TestExplainRouting(t *testing.T) {
+	tabletKeys := []key.KeyspaceId{"\x00\x00\x00\x00\x00\x00\x00\x04", ""}
+	bindVariables := map[string]interface{}{"id": 5, "ids": []interface{}{1, 6}}
+	testCases := []struct {
+		sql  string
+		want RoutingExplanation
+	}{
+		{"select * from t where entity_id = :id", RoutingExplanation{ROUTING_CONDITION, []int{1}, "select * from t where entity_id = 5"}},
+		{"select * from t where entity_id in (::ids)", RoutingExplanation{ROUTING_CONDITION, []int{0, 1}, "select * from t where entity_id in (1, 6)"}},
+		{"select * from t where name = 'x'", RoutingExplanation{ROUTING_SCATTER, []int{0, 1}, "select * from t where name = 'x'"}},
+		{"insert into t(entity_id) values (2)", RoutingExplanation{ROUTING_VALUE, []int{0}, "insert into t(entity_id) values (2)"}},
+		{"select * from t where entity_id = 1 union select * from u where entity_id = 1", RoutingExplanation{ROUTING_UNION, []int{0}, "select * from t where entity_id = 1 union select * from u where entity_id = 1"}},
+	}
+	for _, tc := range testCases {
+		got, err := ExplainRouting(tc.sql, bindVariables, tabletKeys)
+		if err != nil {
+			t.Errorf("ExplainRouting(%q): %v", tc.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("ExplainRouting(%q): want %+v, got %+v", tc.sql, tc.want, *got)
+		}
+	}
+
+	if _, err := ExplainRouting("select * from t where entity_id = :missing", bindVariables, tabletKeys); err == nil {
+		t.Errorf("ExplainRouting with a missing bind variable should fail")
+	}
+}
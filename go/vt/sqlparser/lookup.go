@@ -0,0 +1,151 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// InsertRows looks for an insert into one of tables, and returns the
+// table, its column list, and the values of each row: int64 or uint64
+// for numbers, string for strings, nil for null, and the bound value
+// for bind variables. Queries that are not inserts into one of tables,
+// or that cannot be parsed, return an empty table name.
+func InsertRows(sql string, bindVariables map[string]interface{}, tables map[string]bool) (table string, columns []string, rows [][]interface{}, err error) {
+	defer handleError(&err)
+
+	tree, perr := Parse(sql)
+	if perr != nil || tree.Type != INSERT {
+		return "", nil, nil, nil
+	}
+	table = string(tree.At(INSERT_TABLE_OFFSET).Value)
+	if !tables[table] {
+		return "", nil, nil, nil
+	}
+
+	columnList := tree.At(INSERT_COLUMN_LIST_OFFSET)
+	if columnList.Len() == 0 {
+		panic(NewParserError("insert into %s needs a column list", table))
+	}
+	columns = make([]string, columnList.Len())
+	for i := range columns {
+		columns[i] = string(columnList.At(i).Value)
+	}
+
+	values := tree.At(INSERT_VALUES_OFFSET)
+	if values.Type != VALUES {
+		panic(NewParserError("insert into %s cannot use a select", table))
+	}
+	rowList := values.At(0)
+	rows = make([][]interface{}, rowList.Len())
+	for i := range rows {
+		row := rowList.At(i)
+		if row.Type != '(' || row.At(0).Type != NODE_LIST || row.At(0).Len() != len(columns) {
+			panic(NewParserError("insert into %s: column count doesn't match value count", table))
+		}
+		rows[i] = make([]interface{}, len(columns))
+		for j := range columns {
+			rows[i][j] = row.At(0).At(j).value(bindVariables)
+		}
+	}
+	return table, columns, rows, nil
+}
+
+func (node *Node) value(bindVariables map[string]interface{}) interface{} {
+	switch node.Type {
+	case NULL:
+		return nil
+	case STRING:
+		return string(node.Value)
+	case NUMBER:
+		if v, err := strconv.ParseInt(string(node.Value), 10, 64); err == nil {
+			return v
+		}
+		if v, err := strconv.ParseUint(string(node.Value), 10, 64); err == nil {
+			return v
+		}
+		panic(NewParserError("%s is not an integer", node.Value))
+	case VALUE_ARG:
+		v, ok := bindVariables[string(node.Value[1:])]
+		if !ok {
+			panic(NewParserError("missing bind variable %s", node.Value))
+		}
+		return v
+	}
+	panic(NewParserError("%s is not a simple value", node.String()))
+}
+
+// SelectForDelete looks for a delete from one of the tables of
+// columns, and returns the table and a query that selects the given
+// columns of the rows it will delete, locking them. Queries that are
+// not deletes from one of the tables of columns, or that cannot be
+// parsed, return an empty table name.
+func SelectForDelete(sql string, columns map[string][]string) (table, selectSql string, err error) {
+	defer handleError(&err)
+
+	tree, perr := Parse(sql)
+	if perr != nil || tree.Type != DELETE {
+		return "", "", nil
+	}
+	table = string(tree.At(DELETE_TABLE_OFFSET).Value)
+	selectColumns, ok := columns[table]
+	if !ok {
+		return "", "", nil
+	}
+	buf := NewTrackedBuffer(nil)
+	buf.Fprintf("select %s from %v%v%v%v for update",
+		strings.Join(selectColumns, ", "),
+		tree.At(DELETE_TABLE_OFFSET),
+		tree.At(DELETE_WHERE_OFFSET),
+		tree.At(DELETE_ORDER_OFFSET),
+		tree.At(DELETE_LIMIT_OFFSET),
+	)
+	return table, buf.String(), nil
+}
+
+// UpdatedColumns looks for an update of one of tables, and returns
+// the table and the lower-cased names of the columns it sets. Queries
+// that are not updates of one of tables, or that cannot be parsed,
+// return an empty table name.
+func UpdatedColumns(sql string, tables map[string]bool) (table string, columns []string, err error) {
+	defer handleError(&err)
+
+	tree, perr := Parse(sql)
+	if perr != nil || tree.Type != UPDATE {
+		return "", nil, nil
+	}
+	table = string(tree.At(UPDATE_TABLE_OFFSET).Value)
+	if !tables[table] {
+		return "", nil, nil
+	}
+	updateList := tree.At(UPDATE_LIST_OFFSET)
+	columns = make([]string, updateList.Len())
+	for i := range columns {
+		columns[i] = updateList.At(i).At(0).columnName()
+	}
+	return table, columns, nil
+}
+
+// CheckUpdate rejects the updates of one of tables that set one of
+// its protected columns, compared case-insensitively. vtgate protects
+// the sharding and lookup columns of the tables with lookups: the row
+// would have to move to another shard, or the lookup tables would
+// point to the wrong keyspace ids.
+func CheckUpdate(sql string, tables map[string]bool, protectedColumns map[string][]string) error {
+	table, updated, err := UpdatedColumns(sql, tables)
+	if err != nil || table == "" {
+		return err
+	}
+	for _, column := range updated {
+		for _, protected := range protectedColumns[table] {
+			if strings.EqualFold(column, protected) {
+				return fmt.Errorf("update of %v cannot change %v: it is a sharding or lookup column", table, protected)
+			}
+		}
+	}
+	return nil
+}
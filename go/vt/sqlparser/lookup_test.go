@@ -0,0 +1,94 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInsertRows(t *testing.T) {
+	tables := map[string]bool{"user": true}
+	bindVars := map[string]interface{}{"name": "bob"}
+	table, columns, rows, err := InsertRows("insert into user(id, Name) values (1, 'a'), (18446744073709551615, :name), (-2, null)", bindVars, tables)
+	if err != nil {
+		t.Fatalf("InsertRows: %v", err)
+	}
+	wantRows := [][]interface{}{
+		{int64(1), "a"},
+		{uint64(18446744073709551615), "bob"},
+		{int64(-2), nil},
+	}
+	if table != "user" || !reflect.DeepEqual(columns, []string{"id", "name"}) || !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("InsertRows: got %v %v %#v", table, columns, rows)
+	}
+
+	for _, sql := range []string{"select * from user", "insert into other(a) values (1)", "not sql"} {
+		if table, _, _, err := InsertRows(sql, nil, tables); table != "" || err != nil {
+			t.Errorf("InsertRows(%q): want nothing, got %v %v", sql, table, err)
+		}
+	}
+	for _, sql := range []string{
+		"insert into user values (1, 2)",
+		"insert into user(a) select a from other",
+		"insert into user(a, b) values (1)",
+		"insert into user(a) values (:missing)",
+		"insert into user(a) values (1.5)",
+		"insert into user(a) values (1+1)",
+	} {
+		if _, _, _, err := InsertRows(sql, nil, tables); err == nil {
+			t.Errorf("InsertRows(%q) should fail", sql)
+		}
+	}
+}
+
+func TestSelectForDelete(t *testing.T) {
+	columns := map[string][]string{"user": {"id", "name"}}
+	testCases := []struct {
+		in, table, out string
+	}{
+		{"delete from user where id = :id", "user", "select id, name from user where id = :id for update"},
+		{"delete from user order by id limit 10", "user", "select id, name from user order by id asc limit 10 for update"},
+		{"delete from other where id = 1", "", ""},
+		{"select * from user", "", ""},
+	}
+	for _, tc := range testCases {
+		table, out, err := SelectForDelete(tc.in, columns)
+		if err != nil {
+			t.Errorf("SelectForDelete(%q): %v", tc.in, err)
+			continue
+		}
+		if table != tc.table || out != tc.out {
+			t.Errorf("SelectForDelete(%q): want %q %q, got %q %q", tc.in, tc.table, tc.out, table, out)
+		}
+	}
+}
+
+func TestUpdatedColumns(t *testing.T) {
+	tables := map[string]bool{"user": true}
+	table, columns, err := UpdatedColumns("update user set Name = 'a', age = age + 1 where id = 1", tables)
+	if err != nil || table != "user" || !reflect.DeepEqual(columns, []string{"name", "age"}) {
+		t.Errorf("UpdatedColumns: got %v %v %v", table, columns, err)
+	}
+	for _, sql := range []string{"update other set a = 1", "delete from user", "not sql"} {
+		if table, _, err := UpdatedColumns(sql, tables); table != "" || err != nil {
+			t.Errorf("UpdatedColumns(%q): want nothing, got %v %v", sql, table, err)
+		}
+	}
+}
+
+func TestCheckUpdate(t *testing.T) {
+	tables := map[string]bool{"user": true}
+	protected := map[string][]string{"user": {"id", "Name"}}
+	if err := CheckUpdate("update user set NAME = 'a' where id = 1", tables, protected); err == nil || !strings.Contains(err.Error(), "cannot change Name") {
+		t.Errorf("CheckUpdate of a protected column: got %v", err)
+	}
+	for _, sql := range []string{"update user set age = 1 where id = 1", "update other set id = 1", "delete from user", "not sql"} {
+		if err := CheckUpdate(sql, tables, protected); err != nil {
+			t.Errorf("CheckUpdate(%q): %v", sql, err)
+		}
+	}
+}
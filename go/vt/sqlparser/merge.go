@@ -0,0 +1,203 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MergeOrder is a column the results of a select are sorted by.
+type MergeOrder struct {
+	// Index is the position of the column in the results, or -1
+	// if it has to be found by Name, when the select list has a
+	// '*'.
+	Index int
+	Name  string
+	Desc  bool
+}
+
+// MergePlan describes how the results of a select sent to several
+// shards have to be merged, so they look like the results of the same
+// query on a single database.
+type MergePlan struct {
+	// Sql is the query to send to each shard. A limit with an
+	// offset is replaced by a limit of offset+count rows, the
+	// offset can only be applied once the results are merged.
+	Sql string
+
+	// Order is the order by clause of the query. Each shard
+	// returns sorted results, that only need to be merge-sorted.
+	Order []MergeOrder
+
+	// Offset and Limit are the limit clause of the query. Limit is
+	// -1 if there is none.
+	Offset int64
+	Limit  int64
+
+	// Aggregates is set if all the selected expressions are counts
+	// or sums, without group by: the merged result is one row,
+	// whose values are the sums of the values of the shards.
+	Aggregates bool
+}
+
+// AnalyzeMerge returns the MergePlan of sql, or nil if the results of
+// its shards can just be concatenated: for the statements that are not
+// selects, the unions, the selects without order by, limit or
+// aggregates, the selects ordered by something else than their
+// selected columns, and the selects with a having clause or a
+// distinct, whose shard results cannot be combined.
+func AnalyzeMerge(sql string, bindVariables map[string]interface{}) (plan *MergePlan, err error) {
+	defer handleError(&err)
+
+	tree, perr := Parse(sql)
+	if perr != nil || tree.Type != SELECT {
+		return nil, nil
+	}
+	// the shards filter their own groups with the having clause,
+	// and only de-duplicate their own rows
+	if tree.At(SELECT_HAVING_OFFSET).Len() > 0 || tree.At(SELECT_DISTINCT_OFFSET).Type == DISTINCT {
+		return nil, nil
+	}
+	plan = &MergePlan{Sql: sql, Limit: -1}
+	selectExprs := tree.At(SELECT_EXPR_OFFSET)
+	if tree.At(SELECT_GROUP_OFFSET).Len() == 0 && selectExprs.areMergeableAggregates() {
+		plan.Aggregates = true
+		return plan, nil
+	}
+
+	if order := tree.At(SELECT_ORDER_OFFSET); order.Len() > 0 {
+		plan.Order = selectExprs.mergeOrder(order.At(0))
+		if plan.Order == nil {
+			return nil, nil
+		}
+	}
+
+	limit := tree.At(SELECT_LIMIT_OFFSET)
+	switch limit.Len() {
+	case 0:
+		if plan.Order == nil {
+			return nil, nil
+		}
+	case 1:
+		plan.Limit = limit.At(0).limitValue(bindVariables)
+	case 2:
+		plan.Offset = limit.At(0).limitValue(bindVariables)
+		plan.Limit = limit.At(1).limitValue(bindVariables)
+		if plan.Offset != 0 {
+			limit.Sub = []*Node{NewSimpleParseNode(NUMBER, strconv.FormatInt(plan.Offset+plan.Limit, 10))}
+			plan.Sql = tree.String() + trailingComments(sql)
+		}
+	}
+	return plan, nil
+}
+
+// areMergeableAggregates returns true if all the select expressions
+// are counts or sums, that can be added up across shards.
+func (node *Node) areMergeableAggregates() bool {
+	for _, expr := range node.Sub {
+		if expr.Type == AS {
+			expr = expr.At(0)
+		}
+		if expr.Type != FUNCTION || expr.Len() != 1 {
+			// a second sub node is a distinct
+			return false
+		}
+		switch strings.ToLower(string(expr.Value)) {
+		case "count", "sum":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// mergeOrder resolves the order list against the select expressions,
+// or returns nil if an order is not a selected column.
+func (node *Node) mergeOrder(orderList *Node) []MergeOrder {
+	// the names of the select expressions, nil if there is a '*'
+	var names map[string]int
+	for i, expr := range node.Sub {
+		if expr.Type == SELECT_STAR || (expr.Type == '.' && expr.At(1).Type == SELECT_STAR) {
+			names = nil
+			break
+		}
+		if names == nil {
+			names = make(map[string]int)
+		}
+		if expr.Type == AS {
+			names[strings.ToLower(string(expr.At(1).Value))] = i
+			expr = expr.At(0)
+		}
+		if name := expr.columnName(); name != "" {
+			if _, ok := names[name]; !ok {
+				names[name] = i
+			}
+		}
+	}
+
+	orders := make([]MergeOrder, orderList.Len())
+	for i, order := range orderList.Sub {
+		orders[i].Desc = order.Type == DESC
+		expr := order.At(0)
+		if expr.Type == NUMBER {
+			position, err := strconv.Atoi(string(expr.Value))
+			if err != nil || position < 1 || position > node.Len() || names == nil {
+				return nil
+			}
+			orders[i].Index = position - 1
+			continue
+		}
+		name := expr.columnName()
+		if name == "" {
+			return nil
+		}
+		if names == nil {
+			orders[i].Index = -1
+			orders[i].Name = name
+			continue
+		}
+		index, ok := names[name]
+		if !ok {
+			return nil
+		}
+		orders[i].Index = index
+	}
+	return orders
+}
+
+// columnName returns the lower-cased name of a column, or "" if node
+// is not a column.
+func (node *Node) columnName() string {
+	switch node.Type {
+	case ID:
+		return strings.ToLower(string(node.Value))
+	case '.':
+		return node.At(1).columnName()
+	}
+	return ""
+}
+
+func (node *Node) limitValue(bindVariables map[string]interface{}) int64 {
+	switch v := node.value(bindVariables).(type) {
+	case int64:
+		if v >= 0 {
+			return v
+		}
+	case uint64:
+		return int64(v)
+	case int:
+		if v >= 0 {
+			return int64(v)
+		}
+	case int32:
+		if v >= 0 {
+			return int64(v)
+		}
+	case uint32:
+		return int64(v)
+	}
+	panic(NewParserError("%s is not a valid limit", node.String()))
+}
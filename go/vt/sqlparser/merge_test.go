@@ -0,0 +1,67 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeMerge(t *testing.T) {
+	bindVars := map[string]interface{}{"count": int64(10), "offset": 5}
+	testCases := []struct {
+		in   string
+		want *MergePlan
+	}{
+		{"select a from t", nil},
+		{"insert into t(a) values (1)", nil},
+		{"select a from t union select a from u order by a", nil},
+		{"select a, b from t order by c", nil},
+		{"select a, b from t order by a + b limit 1", nil},
+		{"select count(*), sum(a) as s from t", &MergePlan{Sql: "select count(*), sum(a) as s from t", Limit: -1, Aggregates: true}},
+		{"select count(distinct a) from t", nil},
+		{"select a, count(*) from t group by a", nil},
+		{"select count(*) from t having count(*) > 100", nil},
+		{"select a from t group by a having count(*) > 1 order by a limit 10", nil},
+		{"select distinct a from t order by a", nil},
+		{"select distinct a from t limit 10", nil},
+		{"select a, b as c from t order by c desc, t.a", &MergePlan{
+			Sql:   "select a, b as c from t order by c desc, t.a",
+			Order: []MergeOrder{{Index: 1, Desc: true}, {Index: 0}},
+			Limit: -1,
+		}},
+		{"select a, b from t order by 2 limit :count", &MergePlan{
+			Sql:   "select a, b from t order by 2 limit :count",
+			Order: []MergeOrder{{Index: 1}},
+			Limit: 10,
+		}},
+		{"select * from t order by A", &MergePlan{
+			Sql:   "select * from t order by A",
+			Order: []MergeOrder{{Index: -1, Name: "a"}},
+			Limit: -1,
+		}},
+		{"select a from t limit 3", &MergePlan{Sql: "select a from t limit 3", Limit: 3}},
+		{"select a from t order by a limit :offset, 3 /* trailing */", &MergePlan{
+			Sql:    "select a from t order by a asc limit 8 /* trailing */",
+			Order:  []MergeOrder{{Index: 0}},
+			Offset: 5,
+			Limit:  3,
+		}},
+	}
+	for _, tc := range testCases {
+		got, err := AnalyzeMerge(tc.in, bindVars)
+		if err != nil {
+			t.Errorf("AnalyzeMerge(%q): %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("AnalyzeMerge(%q): want %#v, got %#v", tc.in, tc.want, got)
+		}
+	}
+
+	if _, err := AnalyzeMerge("select a from t limit :missing", bindVars); err == nil {
+		t.Errorf("AnalyzeMerge with a missing bind variable should fail")
+	}
+}
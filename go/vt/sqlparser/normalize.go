@@ -0,0 +1,124 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Normalize replaces the string and integer literals of a select,
+// insert, update or delete with generated bind variables, so that
+// queries that only differ by their values share a plan. Literals in
+// order by and group by clauses are column positions, and are kept.
+// It returns the new query and a copy of bindVariables with the
+// generated values, or false if nothing was replaced. Queries that
+// cannot be parsed are left for the caller to report. Trailing
+// comments are preserved.
+func Normalize(sql string, bindVariables map[string]interface{}) (string, map[string]interface{}, bool) {
+	tree, err := Parse(sql)
+	if err != nil {
+		return sql, bindVariables, false
+	}
+	switch tree.Type {
+	case SELECT, INSERT, UPDATE, DELETE, UNION, UNION_ALL, MINUS, EXCEPT, INTERSECT:
+	default:
+		return sql, bindVariables, false
+	}
+
+	nz := &normalizer{
+		bindVariables: make(map[string]interface{}, len(bindVariables)),
+		used:          make(map[string]bool),
+	}
+	for k, v := range bindVariables {
+		nz.bindVariables[k] = v
+		nz.used[k] = true
+	}
+	tree.collectBindVars(nz.used)
+	tree.normalize(nz)
+	if nz.count == 0 {
+		return sql, bindVariables, false
+	}
+	return tree.String() + trailingComments(sql), nz.bindVariables, true
+}
+
+type normalizer struct {
+	bindVariables map[string]interface{}
+	used          map[string]bool
+	count         int
+	next          int
+}
+
+// replace turns node into a bind variable bound to value.
+func (nz *normalizer) replace(node *Node, value interface{}) {
+	var name string
+	for {
+		name = fmt.Sprintf("_vtn%d", nz.next)
+		nz.next++
+		if !nz.used[name] {
+			break
+		}
+	}
+	nz.used[name] = true
+	nz.bindVariables[name] = value
+	nz.count++
+	node.Type = VALUE_ARG
+	node.Value = []byte(":" + name)
+}
+
+func (node *Node) collectBindVars(used map[string]bool) {
+	if node.Type == VALUE_ARG {
+		used[strings.TrimLeft(string(node.Value), ":")] = true
+	}
+	for _, sub := range node.Sub {
+		sub.collectBindVars(used)
+	}
+}
+
+func (node *Node) normalize(nz *normalizer) {
+	switch node.Type {
+	case ORDER, GROUP:
+		return
+	case STRING:
+		nz.replace(node, string(node.Value))
+		return
+	case NUMBER:
+		// Other numbers, like floats or hex values, could
+		// change if they were encoded again.
+		if v, err := strconv.ParseInt(string(node.Value), 10, 64); err == nil {
+			nz.replace(node, v)
+		} else if v, err := strconv.ParseUint(string(node.Value), 10, 64); err == nil {
+			nz.replace(node, v)
+		}
+		return
+	}
+	for _, sub := range node.Sub {
+		sub.normalize(nz)
+	}
+}
+
+// trailingComments returns the comments that follow the last token
+// of sql, with the blanks before them.
+func trailingComments(sql string) string {
+	tkn := NewStringTokenizer(sql)
+	end := 0
+	for {
+		node := tkn.Scan()
+		switch node.Type {
+		case 0, LEX_ERROR:
+			if strings.TrimSpace(sql[end:]) == "" {
+				return ""
+			}
+			return sql[end:]
+		case COMMENT:
+		default:
+			end = tkn.position - 1
+			if end > len(sql) {
+				end = len(sql)
+			}
+		}
+	}
+}
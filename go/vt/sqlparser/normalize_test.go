@@ -0,0 +1,63 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		in       string
+		bindVars map[string]interface{}
+		out      string
+		outVars  map[string]interface{}
+	}{
+		{
+			"select a from t where id = 12 and name = 'bob'",
+			nil,
+			"select a from t where id = :_vtn0 and name = :_vtn1",
+			map[string]interface{}{"_vtn0": int64(12), "_vtn1": "bob"},
+		},
+		{
+			"select a, count(*) from t where x > 18446744073709551615 group by 1 order by 2 limit 10",
+			nil,
+			"select a, count(*) from t where x > :_vtn0 group by 1 order by 2 asc limit :_vtn1",
+			map[string]interface{}{"_vtn0": uint64(18446744073709551615), "_vtn1": int64(10)},
+		},
+		{
+			"insert into t(a, b, c) values (1, :_vtn0, 1.5) /* trace 42 */",
+			map[string]interface{}{"_vtn1": "taken"},
+			"insert into t(a, b, c) values (:_vtn2, :_vtn0, 1.5) /* trace 42 */",
+			map[string]interface{}{"_vtn1": "taken", "_vtn2": int64(1)},
+		},
+		{
+			"update /* comment */ t set a = 'x' where id in (1, 2)",
+			nil,
+			"update /* comment */ t set a = :_vtn0 where id in (:_vtn1, :_vtn2)",
+			map[string]interface{}{"_vtn0": "x", "_vtn1": int64(1), "_vtn2": int64(2)},
+		},
+	}
+	for _, tc := range testCases {
+		out, outVars, ok := Normalize(tc.in, tc.bindVars)
+		if !ok || out != tc.out || !reflect.DeepEqual(outVars, tc.outVars) {
+			t.Errorf("Normalize(%q): want %q %v, got %q %v %v", tc.in, tc.out, tc.outVars, out, outVars, ok)
+		}
+	}
+
+	for _, sql := range []string{
+		"select * from t where id = :id",
+		"select * from t where x = 0x1f",
+		"create table t(id int)",
+		"select * from",
+	} {
+		bindVars := map[string]interface{}{"id": 1}
+		out, outVars, ok := Normalize(sql, bindVars)
+		if ok || out != sql || !reflect.DeepEqual(outVars, bindVars) {
+			t.Errorf("Normalize(%q) changed the query: %q %v", sql, out, outVars)
+		}
+	}
+}
@@ -44,6 +44,28 @@ func (pq *ParsedQuery) GenerateQuery(bindVariables map[string]interface{}, listV
 			supplied = listVariables[index]
 		} else if varName[0] == '*' {
 			supplied = listVariables
+		} else if varName[0] == ':' {
+			list, ok := bindVariables[varName[1:]]
+			if !ok {
+				return nil, NewParserError("Missing bind var %s", varName[1:])
+			}
+			values, ok := list.([]interface{})
+			if !ok {
+				return nil, NewParserError("Expecting a list for bind var %s, got %T", varName[1:], list)
+			}
+			if len(values) == 0 {
+				return nil, NewParserError("Empty list supplied for bind var %s", varName[1:])
+			}
+			for i, v := range values {
+				if i != 0 {
+					buf.WriteString(", ")
+				}
+				if err := EncodeValue(buf, v); err != nil {
+					return nil, err
+				}
+			}
+			current = loc.Offset + loc.Length
+			continue
 		} else {
 			var ok bool
 			supplied, ok = bindVariables[varName]
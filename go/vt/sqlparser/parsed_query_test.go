@@ -0,0 +1,65 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"testing"
+)
+
+func TestListBindVariables(t *testing.T) {
+	tree, err := Parse("select * from a where id in (::ids) and name = :name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := NewTrackedBuffer(nil)
+	buf.Fprintf("%v", tree)
+	pq := buf.ParsedQuery()
+
+	testCases := []struct {
+		bindVariables map[string]interface{}
+		want          string
+	}{
+		{
+			map[string]interface{}{"ids": []interface{}{1, "b"}, "name": "c"},
+			"select * from a where id in (1, 'b') and name = 'c'",
+		},
+		{
+			map[string]interface{}{"ids": []interface{}{int64(2)}, "name": "c"},
+			"select * from a where id in (2) and name = 'c'",
+		},
+		{
+			map[string]interface{}{"ids": []interface{}{}, "name": "c"},
+			"Empty list supplied for bind var ids",
+		},
+		{
+			map[string]interface{}{"ids": 1, "name": "c"},
+			"Expecting a list for bind var ids, got int",
+		},
+		{
+			map[string]interface{}{"name": "c"},
+			"Missing bind var ids",
+		},
+		{
+			map[string]interface{}{"ids": []interface{}{1}, "name": []interface{}{"c"}},
+			"Unsupported bind variable type []interface {}: [c]",
+		},
+	}
+	for _, tc := range testCases {
+		got, err := pq.GenerateQuery(tc.bindVariables, nil)
+		if err != nil {
+			if err.Error() != tc.want {
+				t.Errorf("GenerateQuery(%v): want %v, got error %v", tc.bindVariables, tc.want, err)
+			}
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("GenerateQuery(%v): want %v, got %s", tc.bindVariables, tc.want, got)
+		}
+	}
+
+	if _, err := Parse("select * from a where id in (::)"); err == nil {
+		t.Errorf("Parse: want error for an empty list bind variable name")
+	}
+}
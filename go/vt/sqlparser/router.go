@@ -5,6 +5,7 @@
 package sqlparser
 
 import (
+	"sort"
 	"strconv"
 
 	"github.com/youtube/vitess/go/vt/key"
@@ -13,6 +14,7 @@ import (
 const (
 	ROUTE_BY_CONDITION = iota
 	ROUTE_BY_VALUE
+	ROUTE_BY_UNION
 )
 
 const (
@@ -25,6 +27,11 @@ const (
 type RoutingPlan struct {
 	routingType int
 	criteria    *Node
+	// subPlans are the plans of both sides of a union.
+	subPlans []*RoutingPlan
+	// ordered is set for unions that end with an order by or a
+	// limit, which cannot be applied shard by shard.
+	ordered bool
 }
 
 func GetShardList(sql string, bindVariables map[string]interface{}, tabletKeys []key.KeyspaceId) (shardlist []int, err error) {
@@ -37,40 +44,94 @@ func GetShardList(sql string, bindVariables map[string]interface{}, tabletKeys [
 func buildPlan(sql string) (plan *RoutingPlan) {
 	tree, err := Parse(sql)
 	if err != nil {
+		if isMultiTableDelete(sql) {
+			panic(NewParserError("multi-table delete is not supported, delete from each table on its own"))
+		}
 		panic(err)
 	}
 	return tree.getRoutingPlan()
 }
 
+// isMultiTableDelete returns true for the two forms of multi-table
+// deletes, 'delete a, b from ...' and 'delete from a, b using ...'.
+// The grammar only has single table deletes, so they fail to parse.
+func isMultiTableDelete(sql string) bool {
+	tkn := NewStringTokenizer(sql)
+	next := func() int {
+		node := tkn.Scan()
+		for node.Type == COMMENT {
+			node = tkn.Scan()
+		}
+		return node.Type
+	}
+	if next() != DELETE {
+		return false
+	}
+	if next() != FROM {
+		return true
+	}
+	if next() != ID {
+		return false
+	}
+	switch next() {
+	case ',', USING:
+		return true
+	}
+	return false
+}
+
 func shardListFromPlan(plan *RoutingPlan, bindVariables map[string]interface{}, tabletKeys []key.KeyspaceId) (shardList []int) {
-	if plan.routingType == ROUTE_BY_VALUE {
+	switch plan.routingType {
+	case ROUTE_BY_VALUE:
 		index := plan.criteria.findInsertShard(bindVariables, tabletKeys)
 		return []int{index}
+	case ROUTE_BY_UNION:
+		shardset := make(map[int]bool)
+		for _, subPlan := range plan.subPlans {
+			for _, index := range shardListFromPlan(subPlan, bindVariables, tabletKeys) {
+				shardset[index] = true
+			}
+		}
+		if plan.ordered && len(shardset) > 1 {
+			panic(NewParserError("union with order by or limit has multiple shard targets"))
+		}
+		return makeSortedList(shardset)
 	}
 
 	if plan.criteria == nil {
 		return makeList(0, len(tabletKeys))
 	}
+	return plan.criteria.findConditionShardList(bindVariables, tabletKeys)
+}
 
-	switch plan.criteria.Type {
+func (node *Node) findConditionShardList(bindVariables map[string]interface{}, tabletKeys []key.KeyspaceId) []int {
+	switch node.Type {
 	case '=', NULL_SAFE_EQUAL:
-		index := plan.criteria.At(1).findShard(bindVariables, tabletKeys)
+		index := node.At(1).findShard(bindVariables, tabletKeys)
 		return []int{index}
 	case '<', LE:
-		index := plan.criteria.At(1).findShard(bindVariables, tabletKeys)
+		index := node.At(1).findShard(bindVariables, tabletKeys)
 		return makeList(0, index+1)
 	case '>', GE:
-		index := plan.criteria.At(1).findShard(bindVariables, tabletKeys)
+		index := node.At(1).findShard(bindVariables, tabletKeys)
 		return makeList(index, len(tabletKeys))
 	case IN:
-		return plan.criteria.At(1).findShardList(bindVariables, tabletKeys)
+		return node.At(1).findShardList(bindVariables, tabletKeys)
 	case BETWEEN:
-		start := plan.criteria.At(1).findShard(bindVariables, tabletKeys)
-		last := plan.criteria.At(2).findShard(bindVariables, tabletKeys)
+		start := node.At(1).findShard(bindVariables, tabletKeys)
+		last := node.At(2).findShard(bindVariables, tabletKeys)
 		if last < start {
 			start, last = last, start
 		}
 		return makeList(start, last+1)
+	case OR:
+		shardset := make(map[int]bool)
+		for i := 0; i < 2; i++ {
+			for _, index := range node.At(i).findConditionShardList(bindVariables, tabletKeys) {
+				shardset[index] = true
+			}
+		}
+		return makeSortedList(shardset)
 	}
 	return makeList(0, len(tabletKeys))
 }
@@ -89,6 +150,25 @@ func (node *Node) getRoutingPlan() (plan *RoutingPlan) {
 	var where *Node
 	plan.routingType = ROUTE_BY_CONDITION
 	switch node.Type {
+	case MINUS, EXCEPT, INTERSECT:
+		// The rows of one side have to be compared with the rows
+		// of the other side on all the shards.
+		panic(NewParserError("%s is not supported", node.Value))
+	case UNION, UNION_ALL:
+		// Each side is routed on its own, and the union needs the
+		// shards of both. The grammar attaches a trailing order by
+		// or limit to the last select, but MySQL applies it to the
+		// whole union.
+		plan.routingType = ROUTE_BY_UNION
+		plan.subPlans = []*RoutingPlan{node.At(0).getRoutingPlan(), node.At(1).getRoutingPlan()}
+		for _, subPlan := range plan.subPlans {
+			plan.ordered = plan.ordered || subPlan.ordered
+		}
+		last := node.At(1)
+		if last.Type == SELECT && (last.At(SELECT_ORDER_OFFSET).Len() > 0 || last.At(SELECT_LIMIT_OFFSET).Len() > 0) {
+			plan.ordered = true
+		}
+		return plan
 	case SELECT:
 		where = node.At(SELECT_WHERE_OFFSET)
 	case UPDATE:
@@ -116,6 +196,14 @@ func (node *Node) routingAnalyzeValues() *Node {
 
 func (node *Node) routingAnalyzeBoolean() *Node {
 	switch node.Type {
+	case OR:
+		// Both sides must be routable, the shards of either can
+		// have matching rows.
+		left := node.At(0).routingAnalyzeBoolean()
+		right := node.At(1).routingAnalyzeBoolean()
+		if left != nil && right != nil {
+			return NewParseNode(OR, node.Value).PushTwo(left, right)
+		}
 	case AND:
 		left := node.At(0).routingAnalyzeBoolean()
 		right := node.At(1).routingAnalyzeBoolean()
@@ -163,13 +251,17 @@ func (node *Node) routingAnalyzeValue() int {
 		return node.At(0).routingAnalyzeValue()
 	case NODE_LIST:
 		for i := 0; i < node.Len(); i++ {
-			if node.At(i).routingAnalyzeValue() != VALUE_NODE {
+			if n := node.At(i); n.routingAnalyzeValue() != VALUE_NODE && !(n.Type == VALUE_ARG && isListArg(n.Value)) {
 				return OTHER_NODE
 			}
 		}
 		return LIST_NODE
-	case STRING, NUMBER, VALUE_ARG:
+	case STRING, NUMBER:
 		return VALUE_NODE
+	case VALUE_ARG:
+		if !isListArg(node.Value) {
+			return VALUE_NODE
+		}
 	}
 	return OTHER_NODE
 }
@@ -181,16 +273,26 @@ func (node *Node) findShardList(bindVariables map[string]interface{}, tabletKeys
 		return node.At(0).findShardList(bindVariables, tabletKeys)
 	case NODE_LIST:
 		for i := 0; i < node.Len(); i++ {
-			index := node.At(i).findShard(bindVariables, tabletKeys)
+			n := node.At(i)
+			if n.Type == VALUE_ARG && isListArg(n.Value) {
+				for _, value := range n.findListBindValue(bindVariables) {
+					shardset[key.FindShardForValue(key.EncodeValue(value), tabletKeys)] = true
+				}
+				continue
+			}
+			index := n.findShard(bindVariables, tabletKeys)
 			shardset[index] = true
 		}
 	}
-	shardlist := make([]int, len(shardset))
-	index := 0
+	return makeSortedList(shardset)
+}
+
+func makeSortedList(shardset map[int]bool) []int {
+	shardlist := make([]int, 0, len(shardset))
 	for k := range shardset {
-		shardlist[index] = k
-		index++
+		shardlist = append(shardlist, k)
 	}
+	sort.Ints(shardlist)
 	return shardlist
 }
 
@@ -243,6 +345,18 @@ func (node *Node) findBindValue(bindVariables map[string]interface{}) interface{
 	return value
 }
 
+func (node *Node) findListBindValue(bindVariables map[string]interface{}) []interface{} {
+	value, ok := bindVariables[string(node.Value[2:])]
+	if !ok {
+		panic(NewParserError("No bind variable for %s", node.Value))
+	}
+	values, ok := value.([]interface{})
+	if !ok || len(values) == 0 {
+		panic(NewParserError("Expecting a non-empty list for %s", node.Value))
+	}
+	return values
+}
+
 func makeList(start, end int) []int {
 	list := make([]int, end-start)
 	for i := start; i < end; i++ {
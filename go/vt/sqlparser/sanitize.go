@@ -0,0 +1,96 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"flag"
+	"fmt"
+)
+
+// Sanitization modes for -query-sanitization. SANITIZE_HASH replaces
+// every value with a short hash, so identical values can still be
+// correlated across log lines. SANITIZE_STRIP replaces them with '?'.
+const (
+	SANITIZE_NONE  = "none"
+	SANITIZE_HASH  = "hash"
+	SANITIZE_STRIP = "strip"
+)
+
+var querySanitization = flag.String("query-sanitization", SANITIZE_NONE, "how literal values and bind variables are removed from the queries in errors and logs: none, hash or strip")
+
+// SanitizationEnabled returns true if queries are sanitized.
+func SanitizationEnabled() bool {
+	return *querySanitization != SANITIZE_NONE
+}
+
+// Sanitize returns sql with its string and number literals replaced
+// according to -query-sanitization. The rest of the query is left
+// as is. If the query cannot be tokenized, everything from the
+// offending token on is replaced.
+func Sanitize(sql string) string {
+	return sanitize(sql, *querySanitization)
+}
+
+func sanitize(sql, mode string) string {
+	if mode == SANITIZE_NONE {
+		return sql
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, len(sql)))
+	tkn := NewStringTokenizer(sql)
+	last := 0
+	for {
+		// Skip the blanks here to know where the token starts.
+		if tkn.lastChar == 0 {
+			tkn.Next()
+		}
+		tkn.skipBlank()
+		start := tkn.position - 1
+		node := tkn.Scan()
+		end := tkn.position - 1
+		if end > len(sql) {
+			end = len(sql)
+		}
+		switch node.Type {
+		case 0:
+			buf.WriteString(sql[last:])
+			return buf.String()
+		case LEX_ERROR:
+			buf.WriteString(sql[last:start])
+			buf.WriteString(sanitizeValue(sql[start:], mode))
+			return buf.String()
+		case STRING, NUMBER:
+			buf.WriteString(sql[last:start])
+			buf.WriteString(sanitizeValue(sql[start:end], mode))
+			last = end
+		}
+	}
+}
+
+func sanitizeValue(value, mode string) string {
+	if mode == SANITIZE_HASH {
+		return fmt.Sprintf("#%x", sha1.Sum([]byte(value)))[:9]
+	}
+	return "?"
+}
+
+// SanitizeBindVariables returns a copy of bindVars with the values
+// replaced according to -query-sanitization. Stripped values are
+// replaced by their type.
+func SanitizeBindVariables(bindVars map[string]interface{}) map[string]interface{} {
+	if !SanitizationEnabled() || bindVars == nil {
+		return bindVars
+	}
+	out := make(map[string]interface{}, len(bindVars))
+	for k, v := range bindVars {
+		if *querySanitization == SANITIZE_HASH {
+			out[k] = sanitizeValue(fmt.Sprintf("%v", v), SANITIZE_HASH)
+		} else {
+			out[k] = fmt.Sprintf("%T", v)
+		}
+	}
+	return out
+}
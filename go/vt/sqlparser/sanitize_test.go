@@ -0,0 +1,60 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	testCases := []struct {
+		in, out string
+	}{
+		{"select * from t", "select * from t"},
+		{"select a from t where id = 12 and name = 'bob'", "select a from t where id = ? and name = ?"},
+		{"insert into t(a, b) values (1.5e3, \"it's\"), (-2, 'a\\'b')", "insert into t(a, b) values (?, ?), (-?, ?)"},
+		{"select * from t where id = :id /* trace 42 */", "select * from t where id = :id /* trace 42 */"},
+		{"select `col 1` from t where x in (0x1f, .5)", "select `col 1` from t where x in (?, ?)"},
+		{"select * from t where name = 'unterminated", "select * from t where name = ?"},
+	}
+	for _, tc := range testCases {
+		if got := sanitize(tc.in, SANITIZE_STRIP); got != tc.out {
+			t.Errorf("sanitize(%q): want %q, got %q", tc.in, tc.out, got)
+		}
+		if got := sanitize(tc.in, SANITIZE_NONE); got != tc.in {
+			t.Errorf("sanitize(%q, none) changed the query: %q", tc.in, got)
+		}
+	}
+
+	hashed := sanitize("select * from t where a = 'secret' and b = 'secret' and c = 'other'", SANITIZE_HASH)
+	if strings.Contains(hashed, "secret") || strings.Contains(hashed, "other") {
+		t.Errorf("hashed query contains values: %q", hashed)
+	}
+	parts := strings.Split(hashed, " ")
+	if parts[7] != parts[11] || parts[7] == parts[15] || len(parts[7]) != 9 {
+		t.Errorf("identical values should have identical hashes: %q", hashed)
+	}
+}
+
+func TestSanitizeBindVariables(t *testing.T) {
+	bindVars := map[string]interface{}{"id": 1, "name": "bob"}
+	if got := SanitizeBindVariables(bindVars); got["name"] != "bob" {
+		t.Errorf("bind variables should not be sanitized by default: %v", got)
+	}
+
+	*querySanitization = SANITIZE_STRIP
+	defer func() { *querySanitization = SANITIZE_NONE }()
+	got := SanitizeBindVariables(bindVars)
+	if got["id"] != "int" || got["name"] != "string" {
+		t.Errorf("stripped bind variables should be their types: %v", got)
+	}
+	if bindVars["name"] != "bob" {
+		t.Errorf("the original bind variables were modified: %v", bindVars)
+	}
+	if Sanitize("select 'bob'") != "select ?" {
+		t.Errorf("Sanitize should use -query-sanitization")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// RewriteSequenceInsert looks for an insert into one of the tables
+// of columns, which maps table names to the column whose values come
+// from a sequence. The values of that column that are missing or null
+// (literally, or as a bind variable bound to nil) are replaced with
+// new bind variables. It returns the rewritten query, the table, and
+// the names of the new bind variables, in row order. Queries that are
+// not such inserts, or that cannot be parsed, are returned as is,
+// with no bind variables.
+func RewriteSequenceInsert(sql string, bindVariables map[string]interface{}, columns map[string]string) (newSql, table string, args []string, err error) {
+	defer handleError(&err)
+
+	tree, perr := Parse(sql)
+	if perr != nil || tree.Type != INSERT {
+		return sql, "", nil, nil
+	}
+	table = string(tree.At(INSERT_TABLE_OFFSET).Value)
+	column, ok := columns[table]
+	if !ok {
+		return sql, "", nil, nil
+	}
+
+	columnList := tree.At(INSERT_COLUMN_LIST_OFFSET)
+	if columnList.Len() == 0 {
+		panic(NewParserError("insert into %s needs a column list to generate %s", table, column))
+	}
+	index := -1
+	for i := 0; i < columnList.Len(); i++ {
+		if bytes.EqualFold(columnList.At(i).Value, []byte(column)) {
+			index = i
+			break
+		}
+	}
+
+	rows := tree.At(INSERT_VALUES_OFFSET)
+	if rows.Type != VALUES {
+		if index == -1 {
+			panic(NewParserError("insert into %s from a select cannot generate %s", table, column))
+		}
+		return sql, table, nil, nil
+	}
+	if index == -1 {
+		columnList.Push(NewSimpleParseNode(ID, column))
+	}
+	rowList := rows.At(0)
+	for i := 0; i < rowList.Len(); i++ {
+		row := rowList.At(i)
+		if row.Type != '(' || row.At(0).Type != NODE_LIST {
+			panic(NewParserError("insert into %s is too complex to generate %s", table, column))
+		}
+		values := row.At(0)
+		arg := fmt.Sprintf(":_seq_%d", len(args))
+		switch {
+		case index == -1:
+			values.Push(NewSimpleParseNode(VALUE_ARG, arg))
+		case index >= values.Len():
+			panic(NewParserError("insert into %s: column count doesn't match value count", table))
+		case values.At(index).isNullValue(bindVariables):
+			values.Set(index, NewSimpleParseNode(VALUE_ARG, arg))
+		default:
+			continue
+		}
+		args = append(args, arg[1:])
+	}
+	if len(args) == 0 {
+		return sql, table, nil, nil
+	}
+	return tree.String(), table, args, nil
+}
+
+func (node *Node) isNullValue(bindVariables map[string]interface{}) bool {
+	switch node.Type {
+	case NULL:
+		return true
+	case VALUE_ARG:
+		v, ok := bindVariables[string(node.Value[1:])]
+		return ok && v == nil
+	}
+	return false
+}
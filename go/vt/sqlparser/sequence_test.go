@@ -0,0 +1,46 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRewriteSequenceInsert(t *testing.T) {
+	columns := map[string]string{"user": "id"}
+	bindVars := map[string]interface{}{"nil_id": nil, "id": 12}
+	testCases := []struct {
+		in, out string
+		args    []string
+	}{
+		{"select * from user", "select * from user", nil},
+		{"insert into other(a) values (1)", "insert into other(a) values (1)", nil},
+		{"insert into user(id, a) values (1, 2)", "insert into user(id, a) values (1, 2)", nil},
+		{"insert into user(a) values (1), (2)", "insert into user(a, id) values (1, :_seq_0), (2, :_seq_1)", []string{"_seq_0", "_seq_1"}},
+		{"insert into user(ID, a) values (null, 1), (:id, 2), (:nil_id, 3)", "insert into user(id, a) values (:_seq_0, 1), (:id, 2), (:_seq_1, 3)", []string{"_seq_0", "_seq_1"}},
+		{"insert into user(id) select id from other", "insert into user(id) select id from other", nil},
+	}
+	for _, tc := range testCases {
+		out, _, args, err := RewriteSequenceInsert(tc.in, bindVars, columns)
+		if err != nil {
+			t.Errorf("RewriteSequenceInsert(%q): %v", tc.in, err)
+			continue
+		}
+		if out != tc.out || !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("RewriteSequenceInsert(%q): want %q %v, got %q %v", tc.in, tc.out, tc.args, out, args)
+		}
+	}
+
+	for _, sql := range []string{
+		"insert into user values (1, 2)",
+		"insert into user(a) select a from other",
+		"insert into user(a, id) values (1)",
+	} {
+		if _, _, _, err := RewriteSequenceInsert(sql, nil, columns); err == nil {
+			t.Errorf("RewriteSequenceInsert(%q) should fail", sql)
+		}
+	}
+}
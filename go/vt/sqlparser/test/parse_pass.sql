@@ -97,6 +97,7 @@ select /* non-escape */ '\x' from t#select /* non-escape */ 'x' from t
 select /* unescaped backslash */ '\n' from t
 select /* value argument */ :a from t
 select /* value argument with dot */ :a.b from t
+select /* list argument */ * from t where a in (::list)
 select /* null */ null from t
 select /* octal */ 010 from t
 select /* hex */ 0xf0 from t
@@ -228,7 +228,13 @@ func (tkn *Tokenizer) skipBlank() {
 func (tkn *Tokenizer) scanIdentifier(Type int) *Node {
 	buffer := bytes.NewBuffer(make([]byte, 0, 8))
 	buffer.WriteByte(byte(unicode.ToLower(rune(tkn.lastChar))))
-	for tkn.Next(); isLetter(tkn.lastChar) || isDigit(tkn.lastChar); tkn.Next() {
+	tkn.Next()
+	if tkn.lastChar == ':' {
+		// ::name is a list bind variable
+		buffer.WriteByte(':')
+		tkn.Next()
+	}
+	for ; isLetter(tkn.lastChar) || isDigit(tkn.lastChar); tkn.Next() {
 		buffer.WriteByte(byte(unicode.ToLower(rune(tkn.lastChar))))
 	}
 	if keywordId, found := keywords[buffer.String()]; found {
@@ -240,10 +246,16 @@ func (tkn *Tokenizer) scanIdentifier(Type int) *Node {
 func (tkn *Tokenizer) scanBindVar(Type int) *Node {
 	buffer := bytes.NewBuffer(make([]byte, 0, 8))
 	buffer.WriteByte(byte(unicode.ToLower(rune(tkn.lastChar))))
-	for tkn.Next(); isLetter(tkn.lastChar) || isDigit(tkn.lastChar) || tkn.lastChar == '.'; tkn.Next() {
+	tkn.Next()
+	if tkn.lastChar == ':' {
+		// ::name is a list bind variable
+		buffer.WriteByte(':')
+		tkn.Next()
+	}
+	for ; isLetter(tkn.lastChar) || isDigit(tkn.lastChar) || tkn.lastChar == '.'; tkn.Next() {
 		buffer.WriteByte(byte(tkn.lastChar))
 	}
-	if buffer.Len() == 1 {
+	if buffer.Len() == 1 || isListArg(buffer.Bytes()) && buffer.Len() == 2 {
 		return NewParseNode(LEX_ERROR, buffer.Bytes())
 	}
 	if keywordId, found := keywords[buffer.String()]; found {
@@ -252,6 +264,13 @@ func (tkn *Tokenizer) scanBindVar(Type int) *Node {
 	return NewParseNode(Type, buffer.Bytes())
 }
 
+// isListArg returns true for the value of a list bind variable,
+// ::name, which is expanded to the comma separated list of the
+// values it is bound to.
+func isListArg(value []byte) bool {
+	return len(value) > 1 && value[1] == ':'
+}
+
 func (tkn *Tokenizer) scanMantissa(base int, buffer *bytes.Buffer) {
 	for digitVal(tkn.lastChar) < base {
 		tkn.ConsumeNext(buffer)
@@ -55,6 +55,12 @@ const (
 	// StopSlave will stop MySQL replication.
 	TABLET_ACTION_STOP_SLAVE = "StopSlave"
 
+	// StartSlave will start MySQL replication.
+	TABLET_ACTION_START_SLAVE = "StartSlave"
+
+	// GetSlaveStatus returns the MySQL replication state.
+	TABLET_ACTION_GET_SLAVE_STATUS = "GetSlaveStatus"
+
 	TABLET_ACTION_BREAK_SLAVES        = "BreakSlaves"
 	TABLET_ACTION_MASTER_POSITION     = "MasterPosition"
 	TABLET_ACTION_REPARENT_POSITION   = "ReparentPosition"
@@ -63,12 +69,32 @@ const (
 	TABLET_ACTION_WAIT_BLP_POSITION   = "WaitBlpPosition"
 	TABLET_ACTION_SCRAP               = "Scrap"
 	TABLET_ACTION_GET_SCHEMA          = "GetSchema"
+	TABLET_ACTION_GET_TABLE_STATS     = "GetTableStats"
 	TABLET_ACTION_PREFLIGHT_SCHEMA    = "PreflightSchema"
 	TABLET_ACTION_APPLY_SCHEMA        = "ApplySchema"
 	TABLET_ACTION_GET_PERMISSIONS     = "GetPermissions"
 	TABLET_ACTION_EXECUTE_HOOK        = "ExecuteHook"
 	TABLET_ACTION_GET_SLAVES          = "GetSlaves"
 
+	// ExecuteFetch runs a query on the tablet's MySQL instance
+	// as the dba user. Used by vtworker to read and write data,
+	// and by 'vtctl ExecuteFetch' for operational queries.
+	TABLET_ACTION_EXECUTE_FETCH = "ExecuteFetch"
+
+	// StopSlaveMinimum waits until replication reaches at least
+	// a given group id, and stops it.
+	TABLET_ACTION_STOP_SLAVE_MINIMUM = "StopSlaveMinimum"
+
+	// StopBlp, StartBlp and RunBlpUntil control the binlog
+	// players doing filtered replication on a master.
+	TABLET_ACTION_STOP_BLP      = "StopBlp"
+	TABLET_ACTION_START_BLP     = "StartBlp"
+	TABLET_ACTION_RUN_BLP_UNTIL = "RunBlpUntil"
+
+	// RefreshState makes the tablet re-read its topology record
+	// and reconcile its serving state with it.
+	TABLET_ACTION_REFRESH_STATE = "RefreshState"
+
 	TABLET_ACTION_SNAPSHOT            = "Snapshot"
 	TABLET_ACTION_SNAPSHOT_SOURCE_END = "SnapshotSourceEnd"
 	TABLET_ACTION_RESERVE_FOR_RESTORE = "ReserveForRestore"
@@ -206,10 +232,14 @@ func ActionNodeFromJson(data, path string) (*ActionNode, error) {
 	case KEYSPACE_ACTION_APPLY_SCHEMA:
 		node.args = &ApplySchemaKeyspaceArgs{}
 
-	case TABLET_ACTION_GET_SCHEMA, TABLET_ACTION_GET_PERMISSIONS,
+	case TABLET_ACTION_GET_SCHEMA, TABLET_ACTION_GET_TABLE_STATS, TABLET_ACTION_GET_PERMISSIONS,
 		TABLET_ACTION_SLAVE_POSITION, TABLET_ACTION_WAIT_SLAVE_POSITION,
 		TABLET_ACTION_MASTER_POSITION, TABLET_ACTION_STOP_SLAVE,
-		TABLET_ACTION_GET_SLAVES, TABLET_ACTION_WAIT_BLP_POSITION:
+		TABLET_ACTION_GET_SLAVES, TABLET_ACTION_WAIT_BLP_POSITION,
+		TABLET_ACTION_EXECUTE_FETCH, TABLET_ACTION_STOP_SLAVE_MINIMUM,
+		TABLET_ACTION_STOP_BLP, TABLET_ACTION_START_BLP,
+		TABLET_ACTION_RUN_BLP_UNTIL, TABLET_ACTION_REFRESH_STATE,
+		TABLET_ACTION_START_SLAVE, TABLET_ACTION_GET_SLAVE_STATUS:
 		return nil, fmt.Errorf("rpc-only action: %v", node.Action)
 
 	default:
@@ -19,8 +19,10 @@ import (
 	"time"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/event"
 	"github.com/youtube/vitess/go/tb"
 	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/events"
 	"github.com/youtube/vitess/go/vt/hook"
 	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
@@ -170,7 +172,7 @@ func (ta *TabletActor) dispatchAction(actionNode *ActionNode) (err error) {
 	case TABLET_ACTION_CHANGE_TYPE:
 		err = ta.changeType(actionNode)
 	case TABLET_ACTION_DEMOTE_MASTER:
-		err = ta.demoteMaster()
+		err = demoteMaster(ta.ts, ta.mysqlDaemon, ta.tabletAlias)
 	case TABLET_ACTION_MULTI_SNAPSHOT:
 		err = ta.multiSnapshot(actionNode)
 	case TABLET_ACTION_MULTI_RESTORE:
@@ -199,9 +201,9 @@ func (ta *TabletActor) dispatchAction(actionNode *ActionNode) (err error) {
 	case TABLET_ACTION_EXECUTE_HOOK:
 		err = ta.executeHook(actionNode)
 	case TABLET_ACTION_SET_RDONLY:
-		err = ta.setReadOnly(true)
+		err = setReadOnly(ta.ts, ta.mysqlDaemon, ta.tabletAlias, true)
 	case TABLET_ACTION_SET_RDWR:
-		err = ta.setReadOnly(false)
+		err = setReadOnly(ta.ts, ta.mysqlDaemon, ta.tabletAlias, false)
 	case TABLET_ACTION_SLEEP:
 		err = ta.sleep(actionNode)
 	case TABLET_ACTION_REPARENT_POSITION:
@@ -211,10 +213,14 @@ func (ta *TabletActor) dispatchAction(actionNode *ActionNode) (err error) {
 	case TABLET_ACTION_SNAPSHOT_SOURCE_END:
 		err = ta.snapshotSourceEnd(actionNode)
 
-	case TABLET_ACTION_GET_SCHEMA, TABLET_ACTION_GET_PERMISSIONS,
+	case TABLET_ACTION_GET_SCHEMA, TABLET_ACTION_GET_TABLE_STATS, TABLET_ACTION_GET_PERMISSIONS,
 		TABLET_ACTION_SLAVE_POSITION, TABLET_ACTION_WAIT_SLAVE_POSITION,
 		TABLET_ACTION_MASTER_POSITION, TABLET_ACTION_STOP_SLAVE,
-		TABLET_ACTION_GET_SLAVES, TABLET_ACTION_WAIT_BLP_POSITION:
+		TABLET_ACTION_GET_SLAVES, TABLET_ACTION_WAIT_BLP_POSITION,
+		TABLET_ACTION_EXECUTE_FETCH, TABLET_ACTION_STOP_SLAVE_MINIMUM,
+		TABLET_ACTION_STOP_BLP, TABLET_ACTION_START_BLP,
+		TABLET_ACTION_RUN_BLP_UNTIL, TABLET_ACTION_REFRESH_STATE,
+		TABLET_ACTION_START_SLAVE, TABLET_ACTION_GET_SLAVE_STATUS:
 		err = TabletActorError("Operation " + actionNode.Action + "  only supported as RPC")
 	default:
 		err = TabletActorError("invalid action: " + actionNode.Action)
@@ -248,13 +254,21 @@ func (ta *TabletActor) sleep(actionNode *ActionNode) error {
 	return nil
 }
 
-func (ta *TabletActor) setReadOnly(rdonly bool) error {
-	err := ta.mysqld.SetReadOnly(rdonly)
-	if err != nil {
+// setReadOnly changes the read_only variable of mysql, checks it
+// took, and records the new state in the tablet record.
+func setReadOnly(ts topo.Server, mysqlDaemon mysqlctl.MysqlDaemon, tabletAlias topo.TabletAlias, rdonly bool) error {
+	if err := mysqlDaemon.SetReadOnly(rdonly); err != nil {
 		return err
 	}
+	readOnly, err := mysqlDaemon.IsReadOnly()
+	if err != nil {
+		return fmt.Errorf("cannot verify read_only: %v", err)
+	}
+	if readOnly != rdonly {
+		return fmt.Errorf("read_only is %v after setting it to %v", readOnly, rdonly)
+	}
 
-	tablet, err := ta.ts.GetTablet(ta.tabletAlias)
+	tablet, err := ts.GetTablet(tabletAlias)
 	if err != nil {
 		return err
 	}
@@ -263,7 +277,7 @@ func (ta *TabletActor) setReadOnly(rdonly bool) error {
 	} else {
 		tablet.State = topo.STATE_READ_WRITE
 	}
-	return topo.UpdateTablet(ta.ts, tablet)
+	return topo.UpdateTablet(ts, tablet)
 }
 
 func (ta *TabletActor) changeType(actionNode *ActionNode) error {
@@ -271,21 +285,30 @@ func (ta *TabletActor) changeType(actionNode *ActionNode) error {
 	return ChangeType(ta.ts, ta.tabletAlias, *dbType, true /*runHooks*/)
 }
 
-func (ta *TabletActor) demoteMaster() error {
-	_, err := ta.mysqld.DemoteMaster()
-	if err != nil {
+// demoteMaster fences a master: its mysql is made read-only and
+// checked, then its tablet record is fenced, so the change callbacks
+// stop its query service.
+func demoteMaster(ts topo.Server, mysqlDaemon mysqlctl.MysqlDaemon, tabletAlias topo.TabletAlias) error {
+	if _, err := mysqlDaemon.DemoteMaster(); err != nil {
 		return err
 	}
+	readOnly, err := mysqlDaemon.IsReadOnly()
+	if err != nil {
+		return fmt.Errorf("cannot verify read_only: %v", err)
+	}
+	if !readOnly {
+		return fmt.Errorf("demoted master is not read_only")
+	}
 
-	tablet, err := ta.ts.GetTablet(ta.tabletAlias)
+	tablet, err := ts.GetTablet(tabletAlias)
 	if err != nil {
 		return err
 	}
-	tablet.State = topo.STATE_READ_ONLY
+	tablet.State = topo.STATE_FENCED
 	// NOTE(msolomon) there is no serving graph update - the master tablet will
-	// be replaced. Even though writes may fail, reads will succeed. It will be
-	// less noisy to simply leave the entry until well promote the master.
-	return topo.UpdateTablet(ta.ts, tablet)
+	// be replaced. Writes and reads will fail until we promote the new
+	// master.
+	return topo.UpdateTablet(ts, tablet)
 }
 
 func (ta *TabletActor) promoteSlave(actionNode *ActionNode) error {
@@ -296,11 +319,15 @@ func (ta *TabletActor) promoteSlave(actionNode *ActionNode) error {
 
 	// Perform the action.
 	rsd := &RestartSlaveData{Parent: tablet.Alias, Force: (tablet.Parent.Uid == topo.NO_TABLET)}
-	rsd.ReplicationState, rsd.WaitPosition, rsd.TimePromoted, err = ta.mysqld.PromoteSlave(false, ta.hookExtraEnv())
+	journal := &mysqlctl.ReparentJournalEntry{Action: actionNode.Action, NewMaster: tablet.Alias.String()}
+	if !rsd.Force {
+		journal.OldMaster = tablet.Parent.String()
+	}
+	rsd.ReplicationState, rsd.WaitPosition, rsd.TimePromoted, err = ta.mysqld.PromoteSlave(false, ta.hookExtraEnv(), journal)
 	if err != nil {
 		return err
 	}
-	log.Infof("PromoteSlave %v", rsd.String())
+	log.Infof("PromoteSlave %v %v", rsd.String(), journal.String())
 	actionNode.reply = rsd
 
 	return updateReplicationGraphForPromotedSlave(ta.ts, tablet)
@@ -555,9 +582,19 @@ func (ta *TabletActor) snapshot(actionNode *ActionNode) error {
 	}
 
 	filename, slaveStartRequired, readOnly, err := ta.mysqld.CreateSnapshot(tablet.DbName(), tablet.Addr(), false, args.Concurrency, args.ServerMode, ta.hookExtraEnv())
+	ev := &events.Backup{
+		Alias:        ta.tabletAlias,
+		Keyspace:     tablet.Keyspace,
+		Shard:        tablet.Shard,
+		ManifestPath: filename,
+		Status:       "completed",
+	}
 	if err != nil {
+		ev.Status = "failed: " + err.Error()
+		event.Dispatch(ev)
 		return err
 	}
+	event.Dispatch(ev)
 
 	sr := &SnapshotReply{ManifestPath: filename, SlaveStartRequired: slaveStartRequired, ReadOnly: readOnly}
 	if tablet.Parent.Uid == topo.NO_TABLET {
@@ -753,7 +790,7 @@ func (ta *TabletActor) multiSnapshot(actionNode *ActionNode) error {
 		return fmt.Errorf("expected backup type, not %v: %v", tablet.Type, ta.tabletAlias)
 	}
 
-	filenames, err := ta.mysqld.CreateMultiSnapshot(args.KeyRanges, tablet.DbName(), args.KeyName, tablet.Addr(), false, args.Concurrency, args.Tables, args.SkipSlaveRestart, args.MaximumFilesize, ta.hookExtraEnv())
+	filenames, err := ta.mysqld.CreateMultiSnapshot(args.KeyRanges, tablet.DbName(), args.KeyName, args.KeyType, tablet.Addr(), false, args.Concurrency, args.Tables, args.SkipSlaveRestart, args.MaximumFilesize, ta.hookExtraEnv())
 	if err != nil {
 		return err
 	}
@@ -824,6 +861,9 @@ func Scrap(ts topo.Server, tabletAlias topo.TabletAlias, force bool) error {
 	// If you are already scrap, skip updating replication data. It won't
 	// be there anyway.
 	wasAssigned := tablet.IsAssigned()
+	if tablet.Type != topo.TYPE_SCRAP {
+		tablet.ScrapTime = time.Now().Unix()
+	}
 	tablet.Type = topo.TYPE_SCRAP
 	tablet.Parent = topo.TabletAlias{}
 	// Update the tablet first, since that is canonical.
@@ -890,6 +930,14 @@ func ChangeType(ts topo.Server, tabletAlias topo.TabletAlias, newType topo.Table
 		}
 	}
 
+	ev := &events.TabletChange{
+		Alias:    tabletAlias,
+		Keyspace: tablet.Keyspace,
+		Shard:    tablet.Shard,
+		OldType:  tablet.Type,
+		NewType:  newType,
+		Status:   "changed",
+	}
 	tablet.Type = newType
 	if newType == topo.TYPE_IDLE {
 		if tablet.Parent.IsZero() {
@@ -925,5 +973,9 @@ func ChangeType(ts topo.Server, tabletAlias topo.TabletAlias, newType topo.Table
 		tablet.Shard = ""
 		tablet.KeyRange = key.KeyRange{}
 	}
-	return topo.UpdateTablet(ts, tablet)
+	if err := topo.UpdateTablet(ts, tablet); err != nil {
+		return err
+	}
+	event.Dispatch(ev)
+	return nil
 }
@@ -27,6 +27,7 @@ import (
 	"github.com/youtube/vitess/go/vt/dbconfigs"
 	"github.com/youtube/vitess/go/vt/env"
 	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/tabletserver"
 	"github.com/youtube/vitess/go/vt/topo"
 )
@@ -43,6 +44,24 @@ type tabletChangeItem struct {
 	queuedTime time.Time
 }
 
+// BinlogPlayerMap is the interface the agent uses to control the
+// binlog players doing filtered replication on a master. It is
+// implemented by vttablet.
+type BinlogPlayerMap interface {
+	// BlpPositionList returns the current position of all players
+	BlpPositionList() (*mysqlctl.BlpPositionList, error)
+
+	// Stop stops all the players
+	Stop()
+
+	// Start restarts the players stopped by Stop
+	Start()
+
+	// RunUntil restarts the stopped players until they reach
+	// the given positions
+	RunUntil(blpPositionList *mysqlctl.BlpPositionList, waitTimeout time.Duration) error
+}
+
 type ActionAgent struct {
 	ts                topo.Server
 	tabletAlias       topo.TabletAlias
@@ -50,6 +69,13 @@ type ActionAgent struct {
 	MycnfFile         string // my.cnf file
 	DbCredentialsFile string // File that contains db credentials
 
+	// BinlogPlayerMap is set by vttablet, and may be nil
+	BinlogPlayerMap BinlogPlayerMap
+
+	// PublishIPAddr is set by vttablet to publish the IP address
+	// of the tablet in the serving graph, instead of its hostname.
+	PublishIPAddr bool
+
 	done chan struct{} // closed when we are done.
 
 	// actionMutex is there to run only one action at a time. If
@@ -237,25 +263,34 @@ func (agent *ActionAgent) verifyServingAddrs() error {
 	return agent.ts.UpdateTabletEndpoint(agent.Tablet().Tablet.Alias.Cell, agent.Tablet().Keyspace, agent.Tablet().Shard, agent.Tablet().Type, addr)
 }
 
+// RemoveServingAddr removes the address of the tablet from the serving
+// graph, so the clients stop sending it queries. It is added back by
+// verifyServingAddrs when the tablet starts again.
+func (agent *ActionAgent) RemoveServingAddr() error {
+	tablet := agent.Tablet()
+	if !tablet.IsServingType() {
+		return nil
+	}
+	return agent.ts.RemoveTabletEndpoint(tablet.Alias.Cell, tablet.Keyspace, tablet.Shard, tablet.Type, tablet.Alias.Uid)
+}
+
 func EndPointForTablet(tablet *topo.Tablet) (*topo.EndPoint, error) {
-	entry := topo.NewAddr(tablet.Alias.Uid, tablet.Hostname)
+	entry := topo.NewAddr(tablet.Alias.Uid, tablet.EndPointHost())
 	if err := tablet.ValidatePortmap(); err != nil {
 		return nil, err
 	}
 
 	// TODO(szopa): Rename _vtocc to vt.
-	entry.NamedPortMap = map[string]int{
-		"_vtocc": tablet.Portmap["vt"],
-		"_mysql": tablet.Portmap["mysql"],
-	}
-	if port, ok := tablet.Portmap["vts"]; ok {
-		entry.NamedPortMap["_vts"] = port
+	for name, port := range tablet.Portmap {
+		entry.NamedPortMap[topo.EndPointPortName(name)] = port
 	}
 	return entry, nil
 }
 
 // bindAddr: the address for the query service advertised by this agent
-func (agent *ActionAgent) Start(mysqlPort, vtPort, vtsPort int) error {
+// namedPorts are the additional ports of the tablet (see
+// topo.ParseNamedPorts), they replace the ones of the previous run.
+func (agent *ActionAgent) Start(mysqlPort, vtPort, vtsPort int, namedPorts map[string]int) error {
 	var err error
 	if err = agent.readTablet(); err != nil {
 		return err
@@ -280,6 +315,7 @@ func (agent *ActionAgent) Start(mysqlPort, vtPort, vtsPort int) error {
 	f := func(tablet *topo.Tablet) error {
 		tablet.Hostname = hostname
 		tablet.IPAddr = ipAddr
+		tablet.PublishIPAddr = agent.PublishIPAddr
 		if tablet.Portmap == nil {
 			tablet.Portmap = make(map[string]int)
 		}
@@ -290,6 +326,14 @@ func (agent *ActionAgent) Start(mysqlPort, vtPort, vtsPort int) error {
 		} else {
 			delete(tablet.Portmap, "vts")
 		}
+		for name := range tablet.Portmap {
+			if !topo.IsReservedPortName(name) {
+				delete(tablet.Portmap, name)
+			}
+		}
+		for name, port := range namedPorts {
+			tablet.Portmap[name] = port
+		}
 		return nil
 	}
 	if err := agent.ts.UpdateTabletFields(agent.Tablet().Alias, f); err != nil {
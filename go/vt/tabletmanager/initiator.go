@@ -20,6 +20,7 @@ import (
 	"time"
 
 	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/vt/hook"
 	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
@@ -86,13 +87,20 @@ func (ai *ActionInitiator) Ping(tabletAlias topo.TabletAlias) (actionPath string
 	return ai.writeTabletAction(tabletAlias, &ActionNode{Action: TABLET_ACTION_PING})
 }
 
-func (ai *ActionInitiator) RpcPing(tabletAlias topo.TabletAlias, waitTime time.Duration) error {
-	tablet, err := ai.ts.GetTablet(tabletAlias)
-	if err != nil {
-		return err
+// RpcPing checks the tablet responds to RPCs, without going through
+// its action queue, and returns the round-trip time.
+func (ai *ActionInitiator) RpcPing(tablet *topo.TabletInfo, waitTime time.Duration) (time.Duration, error) {
+	start := time.Now()
+	if err := ai.rpc.Ping(tablet, waitTime); err != nil {
+		return 0, err
 	}
+	return time.Now().Sub(start), nil
+}
 
-	return ai.rpc.Ping(tablet, waitTime)
+// RpcRefreshState makes the tablet re-read its record and reconcile
+// its serving state with it, without going through its action queue.
+func (ai *ActionInitiator) RpcRefreshState(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return ai.rpc.RefreshState(tablet, waitTime)
 }
 
 func (ai *ActionInitiator) Sleep(tabletAlias topo.TabletAlias, duration time.Duration) (actionPath string, err error) {
@@ -107,6 +115,10 @@ func (ai *ActionInitiator) RpcChangeType(tablet *topo.TabletInfo, dbType topo.Ta
 	return ai.rpc.ChangeType(tablet, dbType, waitTime)
 }
 
+func (ai *ActionInitiator) ExecuteFetch(tablet *topo.TabletInfo, query string, maxRows int, wantFields, disableBinlogs bool, waitTime time.Duration) (*mproto.QueryResult, error) {
+	return ai.rpc.ExecuteFetch(tablet, query, maxRows, wantFields, disableBinlogs, waitTime)
+}
+
 func (ai *ActionInitiator) SetReadOnly(tabletAlias topo.TabletAlias) (actionPath string, err error) {
 	return ai.writeTabletAction(tabletAlias, &ActionNode{Action: TABLET_ACTION_SET_RDONLY})
 }
@@ -115,10 +127,22 @@ func (ai *ActionInitiator) SetReadWrite(tabletAlias topo.TabletAlias) (actionPat
 	return ai.writeTabletAction(tabletAlias, &ActionNode{Action: TABLET_ACTION_SET_RDWR})
 }
 
+func (ai *ActionInitiator) RpcSetReadOnly(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return ai.rpc.SetReadOnly(tablet, waitTime)
+}
+
+func (ai *ActionInitiator) RpcSetReadWrite(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return ai.rpc.SetReadWrite(tablet, waitTime)
+}
+
 func (ai *ActionInitiator) DemoteMaster(tabletAlias topo.TabletAlias) (actionPath string, err error) {
 	return ai.writeTabletAction(tabletAlias, &ActionNode{Action: TABLET_ACTION_DEMOTE_MASTER})
 }
 
+func (ai *ActionInitiator) RpcDemoteMaster(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return ai.rpc.DemoteMaster(tablet, waitTime)
+}
+
 type SnapshotArgs struct {
 	Concurrency int
 	ServerMode  bool
@@ -153,6 +177,7 @@ func (ai *ActionInitiator) SnapshotSourceEnd(tabletAlias topo.TabletAlias, args
 
 type MultiSnapshotArgs struct {
 	KeyName          string
+	KeyType          key.KeyspaceIdType
 	KeyRanges        []key.KeyRange
 	Tables           []string
 	Concurrency      int
@@ -232,6 +257,30 @@ func (ai *ActionInitiator) StopSlave(tablet *topo.TabletInfo, waitTime time.Dura
 	return ai.rpc.StopSlave(tablet, waitTime)
 }
 
+func (ai *ActionInitiator) StartSlave(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return ai.rpc.StartSlave(tablet, waitTime)
+}
+
+func (ai *ActionInitiator) GetSlaveStatus(tablet *topo.TabletInfo, waitTime time.Duration) (*mysqlctl.ReplicationStatus, error) {
+	return ai.rpc.GetSlaveStatus(tablet, waitTime)
+}
+
+func (ai *ActionInitiator) StopSlaveMinimum(tablet *topo.TabletInfo, groupId string, waitTime time.Duration) (*mysqlctl.ReplicationPosition, error) {
+	return ai.rpc.StopSlaveMinimum(tablet, groupId, waitTime)
+}
+
+func (ai *ActionInitiator) StopBlp(tablet *topo.TabletInfo, waitTime time.Duration) (*mysqlctl.BlpPositionList, error) {
+	return ai.rpc.StopBlp(tablet, waitTime)
+}
+
+func (ai *ActionInitiator) StartBlp(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return ai.rpc.StartBlp(tablet, waitTime)
+}
+
+func (ai *ActionInitiator) RunBlpUntil(tablet *topo.TabletInfo, positions *mysqlctl.BlpPositionList, waitTime time.Duration) (*mysqlctl.ReplicationPosition, error) {
+	return ai.rpc.RunBlpUntil(tablet, positions, waitTime)
+}
+
 func (ai *ActionInitiator) WaitBlpPosition(tabletAlias topo.TabletAlias, blpPosition mysqlctl.BlpPosition, waitTime time.Duration) error {
 	tablet, err := ai.ts.GetTablet(tabletAlias)
 	if err != nil {
@@ -271,6 +320,10 @@ func (ai *ActionInitiator) GetSchema(tablet *topo.TabletInfo, tables []string, i
 	return ai.rpc.GetSchema(tablet, tables, includeViews, waitTime)
 }
 
+func (ai *ActionInitiator) GetTableStats(tablet *topo.TabletInfo, table string, bucketCount int, waitTime time.Duration) (*mysqlctl.TableStats, error) {
+	return ai.rpc.GetTableStats(tablet, table, bucketCount, waitTime)
+}
+
 func (ai *ActionInitiator) PreflightSchema(tabletAlias topo.TabletAlias, change string) (actionPath string, err error) {
 	return ai.writeTabletAction(tabletAlias, &ActionNode{Action: TABLET_ACTION_PREFLIGHT_SCHEMA, args: &change})
 }
@@ -292,6 +345,12 @@ func (ai *ActionInitiator) ExecuteHook(tabletAlias topo.TabletAlias, _hook *hook
 	return ai.writeTabletAction(tabletAlias, &ActionNode{Action: TABLET_ACTION_EXECUTE_HOOK, args: _hook})
 }
 
+// RpcExecuteHook runs a hook on the tablet without going through its
+// action queue, so it can run while an action is in progress.
+func (ai *ActionInitiator) RpcExecuteHook(tablet *topo.TabletInfo, _hook *hook.Hook, waitTime time.Duration) (*hook.HookResult, error) {
+	return ai.rpc.ExecuteHook(tablet, _hook, waitTime)
+}
+
 type SlaveList struct {
 	Addrs []string
 }
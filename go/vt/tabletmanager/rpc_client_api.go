@@ -8,6 +8,8 @@ import (
 	"time"
 
 	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/hook"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/topo"
 )
@@ -24,6 +26,10 @@ type TabletManagerConn interface {
 	// GetSchema asks the remote tablet for its database schema
 	GetSchema(tablet *topo.TabletInfo, tables []string, includeViews bool, waitTime time.Duration) (*mysqlctl.SchemaDefinition, error)
 
+	// GetTableStats asks the remote tablet for the approximate
+	// statistics of a table, with bucketCount buckets
+	GetTableStats(tablet *topo.TabletInfo, table string, bucketCount int, waitTime time.Duration) (*mysqlctl.TableStats, error)
+
 	// GetPermissions asks the remote tablet for its permissions list
 	GetPermissions(tablet *topo.TabletInfo, waitTime time.Duration) (*mysqlctl.Permissions, error)
 
@@ -31,9 +37,34 @@ type TabletManagerConn interface {
 	// Various read-write methods
 	//
 
+	// RefreshState asks the remote tablet to re-read its topology
+	// record, and to reconcile its serving state with it
+	RefreshState(tablet *topo.TabletInfo, waitTime time.Duration) error
+
+	// SetReadOnly makes the mysql of the remote tablet read-only,
+	// and records it in the tablet record
+	SetReadOnly(tablet *topo.TabletInfo, waitTime time.Duration) error
+
+	// SetReadWrite makes the mysql of the remote tablet read-write,
+	// and records it in the tablet record
+	SetReadWrite(tablet *topo.TabletInfo, waitTime time.Duration) error
+
+	// DemoteMaster fences the remote master: its mysql is made
+	// read-only, its tablet record fenced, and it waits for its
+	// query service to stop
+	DemoteMaster(tablet *topo.TabletInfo, waitTime time.Duration) error
+
 	// ChangeType asks the remote tablet to change its type
 	ChangeType(tablet *topo.TabletInfo, dbType topo.TabletType, waitTime time.Duration) error
 
+	// ExecuteFetch executes a query remotely using the DBA pool.
+	// If disableBinlogs is set, the query won't be replicated.
+	ExecuteFetch(tablet *topo.TabletInfo, query string, maxRows int, wantFields, disableBinlogs bool, waitTime time.Duration) (*mproto.QueryResult, error)
+
+	// ExecuteHook runs a hook on the remote tablet, without the
+	// action lock: it can run while an action is in progress
+	ExecuteHook(tablet *topo.TabletInfo, hk *hook.Hook, waitTime time.Duration) (*hook.HookResult, error)
+
 	//
 	// Replication related methods
 	//
@@ -51,6 +82,16 @@ type TabletManagerConn interface {
 	// StopSlave stops the mysql replication
 	StopSlave(tablet *topo.TabletInfo, waitTime time.Duration) error
 
+	// StartSlave starts the mysql replication
+	StartSlave(tablet *topo.TabletInfo, waitTime time.Duration) error
+
+	// GetSlaveStatus returns the tablet's mysql replication state
+	GetSlaveStatus(tablet *topo.TabletInfo, waitTime time.Duration) (*mysqlctl.ReplicationStatus, error)
+
+	// StopSlaveMinimum stops the mysql replication after it reaches
+	// at least the provided group id
+	StopSlaveMinimum(tablet *topo.TabletInfo, groupId string, waitTime time.Duration) (*mysqlctl.ReplicationPosition, error)
+
 	// GetSlaves returns the addresses of the slaves
 	GetSlaves(tablet *topo.TabletInfo, waitTime time.Duration) (*SlaveList, error)
 
@@ -58,6 +99,18 @@ type TabletManagerConn interface {
 	// position in replication
 	WaitBlpPosition(tablet *topo.TabletInfo, blpPosition mysqlctl.BlpPosition, waitTime time.Duration) error
 
+	// StopBlp asks the tablet to stop all its binlog players,
+	// and returns the current position for all of them
+	StopBlp(tablet *topo.TabletInfo, waitTime time.Duration) (*mysqlctl.BlpPositionList, error)
+
+	// StartBlp asks the tablet to restart its binlog players
+	StartBlp(tablet *topo.TabletInfo, waitTime time.Duration) error
+
+	// RunBlpUntil asks the tablet to restart its binlog players until
+	// they reach the given positions, and returns the tablet's
+	// master position
+	RunBlpUntil(tablet *topo.TabletInfo, positions *mysqlctl.BlpPositionList, waitTime time.Duration) (*mysqlctl.ReplicationPosition, error)
+
 	//
 	// Reparenting related functions
 	//
@@ -5,13 +5,27 @@
 package tabletmanager
 
 import (
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"time"
 
+	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/netutil"
 	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	"github.com/youtube/vitess/go/vt/hook"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/rpc"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vttls"
+)
+
+var (
+	tabletManagerSecure = flag.Bool("tablet-manager-secure", false, "use TLS to send the tablet manager RPCs, on the secure port of the tablets")
+	tabletManagerCert   = flag.String("tablet-manager-cert", "", "client certificate to present to the tablets, with -tablet-manager-secure")
+	tabletManagerKey    = flag.String("tablet-manager-key", "", "client key for -tablet-manager-cert")
+	tabletManagerCaCert = flag.String("tablet-manager-ca-cert", "", "CA to verify the tablet certificates with, with -tablet-manager-secure (if empty, they are not verified)")
 )
 
 func init() {
@@ -24,12 +38,58 @@ type GoRpcTabletManagerConn struct {
 	ts topo.Server
 }
 
+// rpcAddr returns the address to send the RPCs to a tablet.
+func rpcAddr(tablet *topo.Tablet) (string, error) {
+	if !*tabletManagerSecure {
+		return tablet.Addr(), nil
+	}
+	port, ok := tablet.Portmap["vts"]
+	if !ok {
+		return "", fmt.Errorf("tablet has no secure port")
+	}
+	return netutil.JoinHostPort(tablet.Hostname, port), nil
+}
+
+// movedAddr reads the record of a tablet we couldn't connect to, and
+// returns its new address if it moved since the caller read it.
+func (client *GoRpcTabletManagerConn) movedAddr(tablet *topo.TabletInfo, addr string) (string, bool) {
+	ti, err := client.ts.GetTablet(tablet.Alias)
+	if err != nil {
+		log.Warningf("cannot read tablet %v again: %v", tablet.Alias, err)
+		return "", false
+	}
+	newAddr, err := rpcAddr(ti.Tablet)
+	if err != nil || newAddr == addr {
+		return "", false
+	}
+	log.Infof("tablet %v moved from %v to %v", tablet.Alias, addr, newAddr)
+	return newAddr, true
+}
+
 func (client *GoRpcTabletManagerConn) rpcCallTablet(tablet *topo.TabletInfo, name string, args, reply interface{}, waitTime time.Duration) error {
 
 	// create the RPC client, using waitTime as the connect
 	// timeout, and starting the overall timeout as well
 	timer := time.After(waitTime)
-	rpcClient, err := bsonrpc.DialHTTP("tcp", tablet.Addr(), waitTime, nil)
+	addr, err := rpcAddr(tablet.Tablet)
+	if err != nil {
+		return fmt.Errorf("RPC error for %v: %v", tablet.Alias, err)
+	}
+	var config *tls.Config
+	if *tabletManagerSecure {
+		if config, err = vttls.ClientConfig(*tabletManagerCert, *tabletManagerKey, *tabletManagerCaCert, ""); err != nil {
+			return fmt.Errorf("RPC error for %v: %v", tablet.Alias, err)
+		}
+	}
+	// the host name is resolved again for each connection. If we
+	// can't connect, the tablet may also have moved to another
+	// host since its record was read: try its current address.
+	rpcClient, err := bsonrpc.DialHTTP("tcp", addr, waitTime, config)
+	if err != nil {
+		if newAddr, ok := client.movedAddr(tablet, addr); ok {
+			rpcClient, err = bsonrpc.DialHTTP("tcp", newAddr, waitTime, config)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("RPC error for %v: %v", tablet.Alias, err.Error())
 	}
@@ -73,6 +133,14 @@ func (client *GoRpcTabletManagerConn) GetSchema(tablet *topo.TabletInfo, tables
 	return &sd, nil
 }
 
+func (client *GoRpcTabletManagerConn) GetTableStats(tablet *topo.TabletInfo, table string, bucketCount int, waitTime time.Duration) (*mysqlctl.TableStats, error) {
+	var ts mysqlctl.TableStats
+	if err := client.rpcCallTablet(tablet, TABLET_ACTION_GET_TABLE_STATS, &GetTableStatsArgs{Table: table, BucketCount: bucketCount}, &ts, waitTime); err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
+
 func (client *GoRpcTabletManagerConn) GetPermissions(tablet *topo.TabletInfo, waitTime time.Duration) (*mysqlctl.Permissions, error) {
 	var p mysqlctl.Permissions
 	if err := client.rpcCallTablet(tablet, TABLET_ACTION_GET_PERMISSIONS, "", &p, waitTime); err != nil {
@@ -85,10 +153,44 @@ func (client *GoRpcTabletManagerConn) GetPermissions(tablet *topo.TabletInfo, wa
 // Various read-write methods
 //
 
+func (client *GoRpcTabletManagerConn) RefreshState(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return client.rpcCallTablet(tablet, TABLET_ACTION_REFRESH_STATE, "", rpc.NilResponse, waitTime)
+}
+
+func (client *GoRpcTabletManagerConn) SetReadOnly(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return client.rpcCallTablet(tablet, TABLET_ACTION_SET_RDONLY, "", rpc.NilResponse, waitTime)
+}
+
+func (client *GoRpcTabletManagerConn) SetReadWrite(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return client.rpcCallTablet(tablet, TABLET_ACTION_SET_RDWR, "", rpc.NilResponse, waitTime)
+}
+
+func (client *GoRpcTabletManagerConn) DemoteMaster(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return client.rpcCallTablet(tablet, TABLET_ACTION_DEMOTE_MASTER, &DemoteMasterArgs{
+		WaitTimeout: int(waitTime / time.Second),
+	}, rpc.NilResponse, waitTime)
+}
+
 func (client *GoRpcTabletManagerConn) ChangeType(tablet *topo.TabletInfo, dbType topo.TabletType, waitTime time.Duration) error {
 	return client.rpcCallTablet(tablet, TABLET_ACTION_CHANGE_TYPE, &dbType, rpc.NilResponse, waitTime)
 }
 
+func (client *GoRpcTabletManagerConn) ExecuteFetch(tablet *topo.TabletInfo, query string, maxRows int, wantFields, disableBinlogs bool, waitTime time.Duration) (*mproto.QueryResult, error) {
+	var qr mproto.QueryResult
+	if err := client.rpcCallTablet(tablet, TABLET_ACTION_EXECUTE_FETCH, &ExecuteFetchArgs{Query: query, MaxRows: maxRows, WantFields: wantFields, DisableBinlogs: disableBinlogs}, &qr, waitTime); err != nil {
+		return nil, err
+	}
+	return &qr, nil
+}
+
+func (client *GoRpcTabletManagerConn) ExecuteHook(tablet *topo.TabletInfo, hk *hook.Hook, waitTime time.Duration) (*hook.HookResult, error) {
+	var hr hook.HookResult
+	if err := client.rpcCallTablet(tablet, TABLET_ACTION_EXECUTE_HOOK, hk, &hr, waitTime); err != nil {
+		return nil, err
+	}
+	return &hr, nil
+}
+
 //
 // Replication related methods
 //
@@ -124,6 +226,29 @@ func (client *GoRpcTabletManagerConn) StopSlave(tablet *topo.TabletInfo, waitTim
 	return client.rpcCallTablet(tablet, TABLET_ACTION_STOP_SLAVE, "", rpc.NilResponse, waitTime)
 }
 
+func (client *GoRpcTabletManagerConn) StartSlave(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return client.rpcCallTablet(tablet, TABLET_ACTION_START_SLAVE, "", rpc.NilResponse, waitTime)
+}
+
+func (client *GoRpcTabletManagerConn) GetSlaveStatus(tablet *topo.TabletInfo, waitTime time.Duration) (*mysqlctl.ReplicationStatus, error) {
+	var rs mysqlctl.ReplicationStatus
+	if err := client.rpcCallTablet(tablet, TABLET_ACTION_GET_SLAVE_STATUS, "", &rs, waitTime); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+func (client *GoRpcTabletManagerConn) StopSlaveMinimum(tablet *topo.TabletInfo, groupId string, waitTime time.Duration) (*mysqlctl.ReplicationPosition, error) {
+	var rp mysqlctl.ReplicationPosition
+	if err := client.rpcCallTablet(tablet, TABLET_ACTION_STOP_SLAVE_MINIMUM, &StopSlaveMinimumArgs{
+		GroupId:     groupId,
+		WaitTimeout: int(waitTime / time.Second),
+	}, &rp, waitTime); err != nil {
+		return nil, err
+	}
+	return &rp, nil
+}
+
 func (client *GoRpcTabletManagerConn) GetSlaves(tablet *topo.TabletInfo, waitTime time.Duration) (*SlaveList, error) {
 	var sl SlaveList
 	if err := client.rpcCallTablet(tablet, TABLET_ACTION_GET_SLAVES, "", &sl, waitTime); err != nil {
@@ -139,6 +264,29 @@ func (client *GoRpcTabletManagerConn) WaitBlpPosition(tablet *topo.TabletInfo, b
 	}, rpc.NilResponse, waitTime)
 }
 
+func (client *GoRpcTabletManagerConn) StopBlp(tablet *topo.TabletInfo, waitTime time.Duration) (*mysqlctl.BlpPositionList, error) {
+	var bpl mysqlctl.BlpPositionList
+	if err := client.rpcCallTablet(tablet, TABLET_ACTION_STOP_BLP, rpc.NilRequest, &bpl, waitTime); err != nil {
+		return nil, err
+	}
+	return &bpl, nil
+}
+
+func (client *GoRpcTabletManagerConn) StartBlp(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return client.rpcCallTablet(tablet, TABLET_ACTION_START_BLP, rpc.NilRequest, rpc.NilResponse, waitTime)
+}
+
+func (client *GoRpcTabletManagerConn) RunBlpUntil(tablet *topo.TabletInfo, positions *mysqlctl.BlpPositionList, waitTime time.Duration) (*mysqlctl.ReplicationPosition, error) {
+	var rp mysqlctl.ReplicationPosition
+	if err := client.rpcCallTablet(tablet, TABLET_ACTION_RUN_BLP_UNTIL, &RunBlpUntilArgs{
+		BlpPositionList: *positions,
+		WaitTimeout:     int(waitTime / time.Second),
+	}, &rp, waitTime); err != nil {
+		return nil, err
+	}
+	return &rp, nil
+}
+
 //
 // Reparenting related functions
 //
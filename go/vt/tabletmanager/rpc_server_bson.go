@@ -5,11 +5,17 @@
 package tabletmanager
 
 import (
+	"fmt"
+	"time"
+
 	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/rpcwrap"
 	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+	"github.com/youtube/vitess/go/vt/hook"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/rpc"
+	"github.com/youtube/vitess/go/vt/tabletserver"
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
@@ -66,6 +72,27 @@ func (tm *TabletManager) GetSchema(context *rpcproto.Context, args *GetSchemaArg
 	})
 }
 
+type GetTableStatsArgs struct {
+	Table       string
+	BucketCount int
+}
+
+func (tm *TabletManager) GetTableStats(context *rpcproto.Context, args *GetTableStatsArgs, reply *mysqlctl.TableStats) error {
+	return tm.rpcWrap(context.RemoteAddr, TABLET_ACTION_GET_TABLE_STATS, args, reply, func() error {
+		// read the tablet to get the dbname
+		tablet, err := tm.agent.ts.GetTablet(tm.agent.tabletAlias)
+		if err != nil {
+			return err
+		}
+
+		ts, err := tm.mysqld.GetTableStats(tablet.DbName(), args.Table, args.BucketCount)
+		if err == nil {
+			*reply = *ts
+		}
+		return err
+	})
+}
+
 func (tm *TabletManager) GetPermissions(context *rpcproto.Context, args *rpc.UnusedRequest, reply *mysqlctl.Permissions) error {
 	return tm.rpcWrap(context.RemoteAddr, TABLET_ACTION_GET_PERMISSIONS, args, reply, func() error {
 		p, err := tm.mysqld.GetPermissions()
@@ -80,12 +107,83 @@ func (tm *TabletManager) GetPermissions(context *rpcproto.Context, args *rpc.Unu
 // Various read-write methods
 //
 
+// RefreshState doesn't do anything by itself: the tablet record is
+// re-read, and the serving state reconciled with it, after all
+// locked actions.
+func (tm *TabletManager) RefreshState(context *rpcproto.Context, args *rpc.UnusedRequest, reply *rpc.UnusedResponse) error {
+	return tm.rpcWrapLockAction(context.RemoteAddr, TABLET_ACTION_REFRESH_STATE, args, reply, func() error {
+		return nil
+	})
+}
+
+func (tm *TabletManager) SetReadOnly(context *rpcproto.Context, args *rpc.UnusedRequest, reply *rpc.UnusedResponse) error {
+	return tm.rpcWrapLockAction(context.RemoteAddr, TABLET_ACTION_SET_RDONLY, args, reply, func() error {
+		return setReadOnly(tm.agent.ts, tm.mysqld, tm.agent.tabletAlias, true)
+	})
+}
+
+func (tm *TabletManager) SetReadWrite(context *rpcproto.Context, args *rpc.UnusedRequest, reply *rpc.UnusedResponse) error {
+	return tm.rpcWrapLockAction(context.RemoteAddr, TABLET_ACTION_SET_RDWR, args, reply, func() error {
+		return setReadOnly(tm.agent.ts, tm.mysqld, tm.agent.tabletAlias, false)
+	})
+}
+
+type DemoteMasterArgs struct {
+	WaitTimeout int // seconds to wait for the query service to stop
+}
+
+// DemoteMaster returns once the query service of the fenced master
+// is stopped by the change callbacks, that run after the action.
+func (tm *TabletManager) DemoteMaster(context *rpcproto.Context, args *DemoteMasterArgs, reply *rpc.UnusedResponse) error {
+	if err := tm.rpcWrapLockAction(context.RemoteAddr, TABLET_ACTION_DEMOTE_MASTER, args, reply, func() error {
+		return demoteMaster(tm.agent.ts, tm.mysqld, tm.agent.tabletAlias)
+	}); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(time.Duration(args.WaitTimeout) * time.Second)
+	for tabletserver.IsServing() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("query service of fenced master %v still serving after %vs", tm.agent.tabletAlias, args.WaitTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
 func (tm *TabletManager) ChangeType(context *rpcproto.Context, args *topo.TabletType, reply *rpc.UnusedResponse) error {
 	return tm.rpcWrapLockAction(context.RemoteAddr, TABLET_ACTION_CHANGE_TYPE, args, reply, func() error {
 		return ChangeType(tm.agent.ts, tm.agent.tabletAlias, *args, true /*runHooks*/)
 	})
 }
 
+type ExecuteFetchArgs struct {
+	Query          string
+	MaxRows        int
+	WantFields     bool
+	DisableBinlogs bool
+}
+
+func (tm *TabletManager) ExecuteFetch(context *rpcproto.Context, args *ExecuteFetchArgs, reply *mproto.QueryResult) error {
+	return tm.rpcWrap(context.RemoteAddr, TABLET_ACTION_EXECUTE_FETCH, args, reply, func() error {
+		qr, err := tm.mysqld.ExecuteFetch(args.Query, args.MaxRows, args.WantFields, args.DisableBinlogs)
+		if err == nil {
+			*reply = *qr
+		}
+		return err
+	})
+}
+
+// ExecuteHook doesn't take the action lock, unlike the ExecuteHook
+// action: it is used to signal a hook run by an action in progress,
+// for instance to throttle an online schema change.
+func (tm *TabletManager) ExecuteHook(context *rpcproto.Context, args *hook.Hook, reply *hook.HookResult) error {
+	return tm.rpcWrap(context.RemoteAddr, TABLET_ACTION_EXECUTE_HOOK, args, reply, func() error {
+		configureTabletHook(args, tm.agent.tabletAlias)
+		*reply = *args.Execute()
+		return nil
+	})
+}
+
 //
 // Replication related methods
 //
@@ -135,6 +233,43 @@ func (tm *TabletManager) StopSlave(context *rpcproto.Context, args *rpc.UnusedRe
 	})
 }
 
+func (tm *TabletManager) StartSlave(context *rpcproto.Context, args *rpc.UnusedRequest, reply *rpc.UnusedResponse) error {
+	return tm.rpcWrapLock(context.RemoteAddr, TABLET_ACTION_START_SLAVE, args, reply, func() error {
+		return tm.mysqld.StartSlave(map[string]string{"TABLET_ALIAS": tm.agent.tabletAlias.String()})
+	})
+}
+
+func (tm *TabletManager) GetSlaveStatus(context *rpcproto.Context, args *rpc.UnusedRequest, reply *mysqlctl.ReplicationStatus) error {
+	return tm.rpcWrap(context.RemoteAddr, TABLET_ACTION_GET_SLAVE_STATUS, args, reply, func() error {
+		status, err := tm.mysqld.ReplicationStatus()
+		if err == nil {
+			*reply = *status
+		}
+		return err
+	})
+}
+
+type StopSlaveMinimumArgs struct {
+	GroupId     string
+	WaitTimeout int // seconds
+}
+
+func (tm *TabletManager) StopSlaveMinimum(context *rpcproto.Context, args *StopSlaveMinimumArgs, reply *mysqlctl.ReplicationPosition) error {
+	return tm.rpcWrapLock(context.RemoteAddr, TABLET_ACTION_STOP_SLAVE_MINIMUM, args, reply, func() error {
+		if err := tm.mysqld.WaitForMinimumGroupId(args.GroupId, time.Duration(args.WaitTimeout)*time.Second); err != nil {
+			return err
+		}
+		if err := tm.mysqld.StopSlave(map[string]string{"TABLET_ALIAS": tm.agent.tabletAlias.String()}); err != nil {
+			return err
+		}
+		position, err := tm.mysqld.SlaveStatus()
+		if err == nil {
+			*reply = *position
+		}
+		return err
+	})
+}
+
 func (tm *TabletManager) GetSlaves(context *rpcproto.Context, args *rpc.UnusedRequest, reply *SlaveList) error {
 	return tm.rpcWrap(context.RemoteAddr, TABLET_ACTION_GET_SLAVES, args, reply, func() error {
 		var err error
@@ -154,6 +289,51 @@ func (tm *TabletManager) WaitBlpPosition(context *rpcproto.Context, args *WaitBl
 	})
 }
 
+func (tm *TabletManager) StopBlp(context *rpcproto.Context, args *rpc.UnusedRequest, reply *mysqlctl.BlpPositionList) error {
+	return tm.rpcWrapLock(context.RemoteAddr, TABLET_ACTION_STOP_BLP, args, reply, func() error {
+		if tm.agent.BinlogPlayerMap == nil {
+			return fmt.Errorf("No BinlogPlayerMap configured")
+		}
+		tm.agent.BinlogPlayerMap.Stop()
+		positions, err := tm.agent.BinlogPlayerMap.BlpPositionList()
+		if err == nil {
+			*reply = *positions
+		}
+		return err
+	})
+}
+
+func (tm *TabletManager) StartBlp(context *rpcproto.Context, args *rpc.UnusedRequest, reply *rpc.UnusedResponse) error {
+	return tm.rpcWrapLock(context.RemoteAddr, TABLET_ACTION_START_BLP, args, reply, func() error {
+		if tm.agent.BinlogPlayerMap == nil {
+			return fmt.Errorf("No BinlogPlayerMap configured")
+		}
+		tm.agent.BinlogPlayerMap.Start()
+		return nil
+	})
+}
+
+type RunBlpUntilArgs struct {
+	BlpPositionList mysqlctl.BlpPositionList
+	WaitTimeout     int // seconds
+}
+
+func (tm *TabletManager) RunBlpUntil(context *rpcproto.Context, args *RunBlpUntilArgs, reply *mysqlctl.ReplicationPosition) error {
+	return tm.rpcWrapLock(context.RemoteAddr, TABLET_ACTION_RUN_BLP_UNTIL, args, reply, func() error {
+		if tm.agent.BinlogPlayerMap == nil {
+			return fmt.Errorf("No BinlogPlayerMap configured")
+		}
+		if err := tm.agent.BinlogPlayerMap.RunUntil(&args.BlpPositionList, time.Duration(args.WaitTimeout)*time.Second); err != nil {
+			return err
+		}
+		position, err := tm.mysqld.MasterStatus()
+		if err == nil {
+			*reply = *position
+		}
+		return err
+	})
+}
+
 //
 // Reparenting related functions
 //
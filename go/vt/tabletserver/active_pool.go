@@ -15,6 +15,10 @@ import (
 	"github.com/youtube/vitess/go/timer"
 )
 
+// ActivePool keeps track of the running queries, and kills the ones
+// that run for longer than the query timeout. The kills are issued
+// with connections from connPool, which is opened and closed by the
+// caller.
 type ActivePool struct {
 	pool     *pools.Numbered
 	timeout  sync2.AtomicDuration
@@ -22,11 +26,11 @@ type ActivePool struct {
 	ticks    *timer.Timer
 }
 
-func NewActivePool(name string, queryTimeout, idleTimeout time.Duration) *ActivePool {
+func NewActivePool(name string, queryTimeout time.Duration, connPool *ConnectionPool) *ActivePool {
 	ap := &ActivePool{
 		pool:     pools.NewNumbered(),
 		timeout:  sync2.AtomicDuration(queryTimeout),
-		connPool: NewConnectionPool("", 1, idleTimeout),
+		connPool: connPool,
 		ticks:    timer.NewTimer(queryTimeout / 10),
 	}
 	stats.Publish(name+"Size", stats.IntFunc(ap.pool.Size))
@@ -37,14 +41,12 @@ func NewActivePool(name string, queryTimeout, idleTimeout time.Duration) *Active
 	return ap
 }
 
-func (ap *ActivePool) Open(ConnFactory CreateConnectionFunc) {
-	ap.connPool.Open(ConnFactory)
+func (ap *ActivePool) Open() {
 	ap.ticks.Start(func() { ap.QueryKiller() })
 }
 
 func (ap *ActivePool) Close() {
 	ap.ticks.Stop()
-	ap.connPool.Close()
 	ap.pool = pools.NewNumbered()
 }
 
@@ -58,7 +60,11 @@ func (ap *ActivePool) kill(connid int64) {
 	ap.Remove(connid)
 	killStats.Add("Queries", 1)
 	log.Infof("killing query %d", connid)
-	killConn := ap.connPool.Get()
+	killConn, err := ap.connPool.SafeGet()
+	if err != nil {
+		log.Errorf("Could not get a connection to kill query %d: %v", connid, err)
+		return
+	}
 	defer killConn.Recycle()
 	sql := fmt.Sprintf("kill %d", connid)
 	if _, err := killConn.ExecuteFetch(sql, 10000, false); err != nil {
@@ -83,10 +89,6 @@ func (ap *ActivePool) SetTimeout(timeout time.Duration) {
 	ap.ticks.SetInterval(timeout / 10)
 }
 
-func (ap *ActivePool) SetIdleTimeout(idleTimeout time.Duration) {
-	ap.connPool.SetIdleTimeout(idleTimeout)
-}
-
 func (ap *ActivePool) StatsJSON() string {
 	s, t := ap.Stats()
 	return fmt.Sprintf("{\"Size\": %v, \"Timeout\": %v}", s, int64(t))
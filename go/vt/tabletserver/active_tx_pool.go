@@ -40,6 +40,7 @@ const (
 	TX_COMMIT   = "commit"
 	TX_ROLLBACK = "rollback"
 	TX_KILL     = "kill"
+	TX_PREPARE  = "prepare"
 )
 
 type ActiveTxPool struct {
@@ -167,6 +168,10 @@ type TxConnection struct {
 	dirtyTables   map[string]DirtyKeys
 	queries       []string
 	conclusion    string
+
+	// statements are the successful statements of the
+	// transaction, saved in the redo log when it's prepared
+	statements []string
 }
 
 func newTxConnection(conn PoolConnection, transactionId int64, pool *ActiveTxPool) *TxConnection {
@@ -202,11 +207,17 @@ func (txc *TxConnection) RecordQuery(query string) {
 }
 
 func (txc *TxConnection) discard(conclusion string) {
+	txc.release(conclusion)
+	txc.PoolConnection.Recycle()
+}
+
+// release removes the transaction from the pool, without recycling
+// its connection.
+func (txc *TxConnection) release(conclusion string) {
 	txc.conclusion = conclusion
 	txc.endTime = time.Now()
 	TxLogger.Send(txc)
 	txc.pool.pool.Unregister(txc.transactionId)
-	txc.PoolConnection.Recycle()
 }
 
 func (txc *TxConnection) Format(params url.Values) string {
@@ -5,6 +5,7 @@
 package tabletserver
 
 import (
+	"github.com/youtube/vitess/go/trace"
 	"github.com/youtube/vitess/go/vt/tabletserver/proto"
 )
 
@@ -36,6 +37,21 @@ func restoreTrailing(sql []byte, bindVars map[string]interface{}) []byte {
 	return sql
 }
 
+// startTraceSpan starts the trace span of a query, as a child of the
+// span in its trailing comment, and puts the new span in the comment
+// so the MySQL queries carry it. stripTrailing has to be called first.
+func startTraceSpan(name string, bindVars map[string]interface{}) *trace.Span {
+	comment, ok := bindVars[TRAILING_COMMENT].(string)
+	if !ok {
+		return nil
+	}
+	span, comment := trace.StartSqlSpan(name, comment, false)
+	if span != nil {
+		bindVars[TRAILING_COMMENT] = comment
+	}
+	return span
+}
+
 // matchComments matches trailing comments. If no comment was found,
 // it returns -1. Otherwise, it returns the position where the query ends
 // before the trailing comments begin.
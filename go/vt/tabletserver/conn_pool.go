@@ -8,8 +8,10 @@ import (
 	"sync"
 	"time"
 
+	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/pools"
 	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
 )
 
 // ConnectionPool re-exposes ResourcePool as a pool of DBConnection objects
@@ -18,6 +20,14 @@ type ConnectionPool struct {
 	connections *pools.ResourcePool
 	capacity    int
 	idleTimeout time.Duration
+	waitTimeout sync2.AtomicDuration
+	prefill     bool
+
+	// connections older than maxLifetime are closed and replaced
+	// when they are taken from the pool.
+	connFactory      CreateConnectionFunc
+	maxLifetime      sync2.AtomicDuration
+	lifetimeRecycles sync2.AtomicInt64
 }
 
 func NewConnectionPool(name string, capacity int, idleTimeout time.Duration) *ConnectionPool {
@@ -27,13 +37,39 @@ func NewConnectionPool(name string, capacity int, idleTimeout time.Duration) *Co
 	}
 	stats.Publish(name+"Capacity", stats.IntFunc(cp.Capacity))
 	stats.Publish(name+"Available", stats.IntFunc(cp.Available))
+	stats.Publish(name+"InUse", stats.IntFunc(cp.InUse))
 	stats.Publish(name+"MaxCap", stats.IntFunc(cp.MaxCap))
 	stats.Publish(name+"WaitCount", stats.IntFunc(cp.WaitCount))
 	stats.Publish(name+"WaitTime", stats.DurationFunc(cp.WaitTime))
+	stats.Publish(name+"WaitTimeouts", stats.IntFunc(cp.WaitTimeouts))
 	stats.Publish(name+"IdleTimeout", stats.DurationFunc(cp.IdleTimeout))
+	stats.Publish(name+"MaxLifetime", stats.DurationFunc(cp.maxLifetime.Get))
+	stats.Publish(name+"LifetimeRecycles", stats.IntFunc(cp.lifetimeRecycles.Get))
 	return cp
 }
 
+// SetWaitTimeout sets how long Get waits for a connection before
+// failing. 0 means Get waits forever.
+func (cp *ConnectionPool) SetWaitTimeout(waitTimeout time.Duration) {
+	cp.waitTimeout.Set(waitTimeout)
+}
+
+// SetMaxLifetime sets the maximum age of the connections. Older
+// connections are replaced before being handed out, so connections
+// that went stale (failovers, VIP moves, wait_timeout) are renewed
+// before they fail queries. 0 means no limit.
+func (cp *ConnectionPool) SetMaxLifetime(maxLifetime time.Duration) {
+	cp.maxLifetime.Set(maxLifetime)
+}
+
+// SetPrefill makes Open create all the connections of the pool
+// upfront, instead of on demand.
+func (cp *ConnectionPool) SetPrefill(prefill bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.prefill = prefill
+}
+
 func (cp *ConnectionPool) pool() (p *pools.ResourcePool) {
 	cp.mu.Lock()
 	p = cp.connections
@@ -44,14 +80,35 @@ func (cp *ConnectionPool) pool() (p *pools.ResourcePool) {
 func (cp *ConnectionPool) Open(connFactory CreateConnectionFunc) {
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
+	cp.connFactory = connFactory
 	f := func() (pools.Resource, error) {
 		c, err := connFactory()
 		if err != nil {
 			return nil, err
 		}
-		return &pooledConnection{c, cp}, nil
+		return &pooledConnection{c, cp, time.Now()}, nil
 	}
 	cp.connections = pools.NewResourcePool(f, cp.capacity, cp.capacity, cp.idleTimeout)
+	if cp.prefill {
+		cp.fill()
+	}
+}
+
+// fill creates all the connections of the pool. Failures are only
+// logged, the missing connections will be created on demand.
+func (cp *ConnectionPool) fill() {
+	conns := make([]pools.Resource, 0, cp.capacity)
+	for i := 0; i < cp.capacity; i++ {
+		conn, err := cp.connections.TryGet()
+		if err != nil {
+			log.Warningf("connection pool prefill failed: %v", err)
+			break
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		cp.connections.Put(conn)
+	}
 }
 
 func (cp *ConnectionPool) Close() {
@@ -65,20 +122,27 @@ func (cp *ConnectionPool) Close() {
 
 // You must call Recycle on the PoolConnection once done.
 func (cp *ConnectionPool) Get() PoolConnection {
-	r, err := cp.pool().Get()
+	r, err := cp.pool().GetWithTimeout(cp.waitTimeout.Get())
+	if err == pools.TIMEOUT_ERR {
+		panic(NewTabletError(RETRY, "connection pool wait timed out"))
+	}
 	if err != nil {
 		panic(NewTabletErrorSql(FATAL, err))
 	}
-	return r.(*pooledConnection)
+	return cp.mustRenew(r)
 }
 
 // You must call Recycle on the PoolConnection once done.
 func (cp *ConnectionPool) SafeGet() (PoolConnection, error) {
-	r, err := cp.pool().Get()
+	r, err := cp.pool().GetWithTimeout(cp.waitTimeout.Get())
+	if err != nil {
+		return nil, err
+	}
+	pc, err := cp.renew(r)
 	if err != nil {
 		return nil, err
 	}
-	return r.(*pooledConnection), nil
+	return pc, nil
 }
 
 // You must call Recycle on the PoolConnection once done.
@@ -90,19 +154,69 @@ func (cp *ConnectionPool) TryGet() PoolConnection {
 	if r == nil {
 		return nil
 	}
-	return r.(*pooledConnection)
+	return cp.mustRenew(r)
+}
+
+// TryGetWithTimeout is like TryGet, but it waits for timeout for a
+// connection to become available before returning nil.
+// You must call Recycle on the PoolConnection once done.
+func (cp *ConnectionPool) TryGetWithTimeout(timeout time.Duration) PoolConnection {
+	if timeout == 0 {
+		return cp.TryGet()
+	}
+	r, err := cp.pool().GetWithTimeout(timeout)
+	if err == pools.TIMEOUT_ERR {
+		return nil
+	}
+	if err != nil {
+		panic(NewTabletErrorSql(FATAL, err))
+	}
+	return cp.mustRenew(r)
+}
+
+// renew replaces the connection r with a new one if it is older
+// than the max lifetime. If the new connection cannot be created,
+// the slot is given back to the pool.
+func (cp *ConnectionPool) renew(r pools.Resource) (*pooledConnection, error) {
+	pc := r.(*pooledConnection)
+	maxLifetime := cp.maxLifetime.Get()
+	if maxLifetime == 0 || time.Now().Sub(pc.timeCreated) < maxLifetime {
+		return pc, nil
+	}
+	cp.lifetimeRecycles.Add(1)
+	pc.Close()
+	cp.mu.Lock()
+	connFactory := cp.connFactory
+	cp.mu.Unlock()
+	c, err := connFactory()
+	if err != nil {
+		cp.Put(nil)
+		return nil, err
+	}
+	return &pooledConnection{c, cp, time.Now()}, nil
+}
+
+func (cp *ConnectionPool) mustRenew(r pools.Resource) PoolConnection {
+	pc, err := cp.renew(r)
+	if err != nil {
+		panic(NewTabletErrorSql(FATAL, err))
+	}
+	return pc
 }
 
 func (cp *ConnectionPool) Put(conn PoolConnection) {
 	cp.pool().Put(conn)
 }
 
+// SetCapacity changes the capacity of the pool. If the pool is
+// closed, the capacity is used when it is opened again.
 func (cp *ConnectionPool) SetCapacity(capacity int) (err error) {
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
-	err = cp.connections.SetCapacity(capacity)
-	if err != nil {
-		return err
+	if cp.connections != nil {
+		if err = cp.connections.SetCapacity(capacity); err != nil {
+			return err
+		}
 	}
 	cp.capacity = capacity
 	return nil
@@ -127,6 +241,10 @@ func (cp *ConnectionPool) Available() int64 {
 	return cp.pool().Available()
 }
 
+func (cp *ConnectionPool) InUse() int64 {
+	return cp.pool().InUse()
+}
+
 func (cp *ConnectionPool) MaxCap() int64 {
 	return cp.pool().MaxCap()
 }
@@ -139,6 +257,10 @@ func (cp *ConnectionPool) WaitTime() time.Duration {
 	return cp.pool().WaitTime()
 }
 
+func (cp *ConnectionPool) WaitTimeouts() int64 {
+	return cp.pool().WaitTimeouts()
+}
+
 func (cp *ConnectionPool) IdleTimeout() time.Duration {
 	return cp.pool().IdleTimeout()
 }
@@ -146,7 +268,8 @@ func (cp *ConnectionPool) IdleTimeout() time.Duration {
 // pooledConnection re-exposes DBConnection as a PoolConnection
 type pooledConnection struct {
 	*DBConnection
-	pool *ConnectionPool
+	pool        *ConnectionPool
+	timeCreated time.Time
 }
 
 func (pc *pooledConnection) Recycle() {
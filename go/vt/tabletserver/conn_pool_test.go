@@ -0,0 +1,87 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/mysql"
+)
+
+func TestConnectionPoolPrefillAndWaits(t *testing.T) {
+	created := 0
+	connFactory := func() (*DBConnection, error) {
+		created++
+		return &DBConnection{}, nil
+	}
+
+	cp := NewConnectionPool("", 2, time.Minute)
+	cp.SetPrefill(true)
+	cp.SetWaitTimeout(10 * time.Millisecond)
+	cp.Open(connFactory)
+	if created != 2 || cp.Available() != 2 || cp.InUse() != 0 {
+		t.Errorf("prefill: created %v connections, %v available, %v in use", created, cp.Available(), cp.InUse())
+	}
+
+	c1 := cp.Get()
+	c2 := cp.TryGetWithTimeout(time.Millisecond)
+	if c2 == nil || cp.InUse() != 2 {
+		t.Fatalf("should get the two connections, %v in use", cp.InUse())
+	}
+	if created != 2 {
+		t.Errorf("prefilled connections should be reused, created %v", created)
+	}
+
+	if c := cp.TryGetWithTimeout(time.Millisecond); c != nil {
+		t.Errorf("TryGetWithTimeout should time out on an exhausted pool")
+	}
+	func() {
+		defer func() {
+			terr, ok := recover().(*TabletError)
+			if !ok || terr.ErrorType != RETRY {
+				t.Errorf("Get should fail with a retry error on timeout, got %v", terr)
+			}
+		}()
+		cp.Get()
+	}()
+	if cp.WaitCount() != 2 || cp.WaitTimeouts() != 2 {
+		t.Errorf("want 2 waits and 2 timeouts, got %v and %v", cp.WaitCount(), cp.WaitTimeouts())
+	}
+
+	cp.Put(c1)
+	cp.Put(c2)
+	if cp.InUse() != 0 {
+		t.Errorf("want 0 in use, got %v", cp.InUse())
+	}
+}
+
+func TestConnectionPoolMaxLifetime(t *testing.T) {
+	created := 0
+	connFactory := func() (*DBConnection, error) {
+		created++
+		return &DBConnection{&mysql.Connection{}}, nil
+	}
+
+	cp := NewConnectionPool("", 1, time.Minute)
+	cp.Open(connFactory)
+	c := cp.Get()
+	cp.Put(c)
+	if c = cp.Get(); created != 1 {
+		t.Errorf("connection without max lifetime should be reused, created %v", created)
+	}
+	cp.Put(c)
+
+	cp.SetMaxLifetime(time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	c = cp.Get()
+	if created != 2 || cp.lifetimeRecycles.Get() != 1 {
+		t.Errorf("old connection should be replaced, created %v, recycled %v", created, cp.lifetimeRecycles.Get())
+	}
+	cp.Put(c)
+	if cp.InUse() != 0 {
+		t.Errorf("want 0 in use, got %v", cp.InUse())
+	}
+}
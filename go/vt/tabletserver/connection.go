@@ -12,6 +12,7 @@ import (
 	"github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/dbconfigs"
 )
 
 var mysqlStats *stats.Timings
@@ -131,7 +132,7 @@ func (conn *DBConnection) VerifyStrict() bool {
 }
 
 func CreateGenericConnection(info mysql.ConnectionParams) (*DBConnection, error) {
-	c, err := mysql.Connect(info)
+	c, err := dbconfigs.MysqlConnect(info)
 	return &DBConnection{c}, err
 }
 
@@ -56,6 +56,10 @@ func (co *Consolidator) Create(sql string) (r *Result, created bool) {
 func (co *Consolidator) ServeHTTP(response http.ResponseWriter, request *http.Request) {
 	items := co.consolidations.Items()
 	response.Header().Set("Content-Type", "text/plain")
+	co.mu.Lock()
+	executing := len(co.queries)
+	co.mu.Unlock()
+	response.Write([]byte(fmt.Sprintf("Executing: %d\n", executing)))
 	if items == nil {
 		response.Write([]byte("empty\n"))
 		return
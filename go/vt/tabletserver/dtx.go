@@ -0,0 +1,159 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+/*
+This file contains the transaction metadata of the distributed
+transactions: vtgate records the participants and the state of its
+distributed transactions in the _vt.dtx table of the master of an
+unsharded keyspace, so they can be resolved if vtgate dies in the
+middle of the two-phase commit. See go/vt/vtgate/dtx.go.
+*/
+
+const createDtxTable = `CREATE TABLE IF NOT EXISTS _vt.dtx (
+  dtid varbinary(512) NOT NULL,
+  state tinyint NOT NULL,
+  time_created bigint NOT NULL,
+  participants varbinary(4096) NOT NULL,
+  primary key (dtid))`
+
+// encodeParticipants returns the participants as a list of
+// keyspace/shard, separated by commas.
+func encodeParticipants(participants []proto.DtxParticipant) string {
+	names := make([]string, len(participants))
+	for i, p := range participants {
+		names[i] = p.Keyspace + "/" + p.Shard
+	}
+	return strings.Join(names, ",")
+}
+
+func decodeParticipants(value string) ([]proto.DtxParticipant, error) {
+	if value == "" {
+		return nil, nil
+	}
+	names := strings.Split(value, ",")
+	participants := make([]proto.DtxParticipant, len(names))
+	for i, name := range names {
+		parts := strings.SplitN(name, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid participant %v", name)
+		}
+		participants[i] = proto.DtxParticipant{Keyspace: parts[0], Shard: parts[1]}
+	}
+	return participants, nil
+}
+
+// dtxFromQueryResult converts the rows of the _vt.dtx table.
+func dtxFromQueryResult(qr *mproto.QueryResult) ([]proto.DistributedTransaction, error) {
+	result := make([]proto.DistributedTransaction, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		if len(row) != 4 {
+			return nil, fmt.Errorf("unexpected dtx row: %v", row)
+		}
+		state, err := strconv.ParseInt(row[1].String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state for transaction %v: %v", row[0].String(), err)
+		}
+		timeCreated, err := strconv.ParseInt(row[2].String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time_created for transaction %v: %v", row[0].String(), err)
+		}
+		participants, err := decodeParticipants(row[3].String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid participants for transaction %v: %v", row[0].String(), err)
+		}
+		result = append(result, proto.DistributedTransaction{
+			Dtid:         row[0].String(),
+			State:        state,
+			TimeCreated:  timeCreated,
+			Participants: participants,
+		})
+	}
+	return result, nil
+}
+
+// CreateTransaction records a new distributed transaction, in the
+// PREPARE state. It fails if the dtid already exists.
+func (qe *QueryEngine) CreateTransaction(logStats *sqlQueryStats, dtx *proto.DistributedTransaction) {
+	qe.mu.RLock()
+	defer qe.mu.RUnlock()
+	qe.ensureTwoPCTables()
+
+	if len(dtx.Participants) == 0 {
+		panic(NewTabletError(FAIL, "transaction %v has no participant", dtx.Dtid))
+	}
+	query := fmt.Sprintf("insert into _vt.dtx(dtid, state, time_created, participants) values (%s, %d, %d, %s)", encodeString(dtx.Dtid), proto.DTX_PREPARE, time.Now().UnixNano(), encodeString(encodeParticipants(dtx.Participants)))
+	if err := qe.execInTransaction([]string{query}); err != nil {
+		panic(err)
+	}
+}
+
+// SetTransactionState moves a distributed transaction to a new
+// state. It fails if the transaction is not in the expected state,
+// so only one of the commit and the rollback decisions can be made.
+func (qe *QueryEngine) SetTransactionState(logStats *sqlQueryStats, change *proto.DtxStateChange) {
+	qe.mu.RLock()
+	defer qe.mu.RUnlock()
+	qe.ensureTwoPCTables()
+
+	conn := qe.txPool.Get()
+	defer conn.Recycle()
+	query := fmt.Sprintf("update _vt.dtx set state = %d where dtid = %s and state = %d", change.To, encodeString(change.Dtid), change.From)
+	qr, err := conn.ExecuteFetch(query, 1, false)
+	if err != nil {
+		panic(NewTabletErrorSql(FAIL, err))
+	}
+	if qr.RowsAffected != 1 {
+		panic(NewTabletError(FAIL, "transaction %v is not in the %v state", change.Dtid, proto.DtxStateNames[change.From]))
+	}
+}
+
+// ConcludeTransaction deletes the metadata of a distributed
+// transaction, once all its participants are resolved.
+func (qe *QueryEngine) ConcludeTransaction(logStats *sqlQueryStats, dtid string) {
+	qe.mu.RLock()
+	defer qe.mu.RUnlock()
+	qe.ensureTwoPCTables()
+
+	if err := qe.execInTransaction([]string{fmt.Sprintf("delete from _vt.dtx where dtid = %s", encodeString(dtid))}); err != nil {
+		panic(err)
+	}
+}
+
+// ReadTransactions returns the metadata of a distributed transaction,
+// or of the transactions older than abandonAge if dtid is empty.
+func (qe *QueryEngine) ReadTransactions(logStats *sqlQueryStats, dtid string, abandonAge time.Duration) []proto.DistributedTransaction {
+	qe.mu.RLock()
+	defer qe.mu.RUnlock()
+	qe.ensureTwoPCTables()
+
+	query := "select dtid, state, time_created, participants from _vt.dtx where "
+	if dtid != "" {
+		query += "dtid = " + encodeString(dtid)
+	} else {
+		query += fmt.Sprintf("time_created < %d order by time_created", time.Now().Add(-abandonAge).UnixNano())
+	}
+	conn := qe.txPool.Get()
+	defer conn.Recycle()
+	qr, err := conn.ExecuteFetch(query, int(qe.maxResultSize.Get()), false)
+	if err != nil {
+		panic(NewTabletErrorSql(FAIL, err))
+	}
+	result, err := dtxFromQueryResult(qr)
+	if err != nil {
+		panic(NewTabletError(FAIL, "%v", err))
+	}
+	return result
+}
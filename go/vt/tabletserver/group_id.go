@@ -0,0 +1,90 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"strconv"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+// This file contains the vttablet side of the read-after-write
+// consistency of vtgate: the commits return the replication group id
+// of the master, and the reads of a session that wrote are sent with
+// the MIN_GROUP_ID directive, so a slave that is behind refuses them.
+
+// ERR_BEHIND_GROUP_ID starts the message of the errors of the queries
+// whose MIN_GROUP_ID was not reached.
+const ERR_BEHIND_GROUP_ID = "behind group id"
+
+// readGroupId returns the group id of the last transaction applied by
+// mysqld: Exec_Master_Group_ID on a slave, Group_ID on a master.
+func (qe *QueryEngine) readGroupId() (int64, error) {
+	conn := qe.dbaPool.Get()
+	defer conn.Recycle()
+
+	value := ""
+	qr, err := conn.ExecuteFetch("SHOW SLAVE STATUS", 1, true)
+	if err != nil {
+		return 0, err
+	}
+	if len(qr.Rows) == 1 {
+		for i, field := range qr.Fields {
+			if field.Name == "Exec_Master_Group_ID" {
+				value = qr.Rows[0][i].String()
+			}
+		}
+	} else {
+		qr, err = conn.ExecuteFetch("SHOW MASTER STATUS", 1, false)
+		if err != nil {
+			return 0, err
+		}
+		if len(qr.Rows) == 1 && len(qr.Rows[0]) >= 5 {
+			value = qr.Rows[0][4].String()
+		}
+	}
+	if value == "" {
+		return 0, NewTabletError(FAIL, "this db does not support group id")
+	}
+	groupId, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	// group ids only go up, so the cache is good enough for
+	// all the queries that wait for a smaller one
+	qe.groupIdCache.Set(groupId)
+	return groupId, nil
+}
+
+// checkMinGroupId panics if the query has a MIN_GROUP_ID directive
+// that mysqld has not reached yet.
+func (qe *QueryEngine) checkMinGroupId(logStats *sqlQueryStats) {
+	minGroupId := logStats.directives.GetInt(sqlparser.DIRECTIVE_MIN_GROUP_ID, 0)
+	if minGroupId == 0 || qe.groupIdCache.Get() >= minGroupId {
+		return
+	}
+	groupId, err := qe.readGroupId()
+	if err != nil {
+		panic(NewTabletError(FAIL, "cannot read group id: %v", err))
+	}
+	if groupId < minGroupId {
+		panic(NewTabletError(FAIL, "%v %v, at %v", ERR_BEHIND_GROUP_ID, minGroupId, groupId))
+	}
+}
+
+// CommitGroupId returns the group id to return after a commit, or ""
+// if the commit group ids are not reported.
+func (qe *QueryEngine) CommitGroupId() string {
+	if !qe.reportCommitGroupId {
+		return ""
+	}
+	groupId, err := qe.readGroupId()
+	if err != nil {
+		log.Warningf("cannot read the commit group id: %v", err)
+		return ""
+	}
+	return strconv.FormatInt(groupId, 10)
+}
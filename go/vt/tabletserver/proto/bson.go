@@ -75,37 +75,54 @@ func DecodeBindVariablesBson(buf *bytes.Buffer, kind byte) (bindVars map[string]
 	bindVars = make(map[string]interface{})
 	for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
 		key := bson.ReadCString(buf)
-		switch kind {
-		case bson.Number:
-			ui64 := bson.Pack.Uint64(buf.Next(8))
-			bindVars[key] = math.Float64frombits(ui64)
-		case bson.String:
-			l := int(bson.Pack.Uint32(buf.Next(4)))
-			bindVars[key] = buf.Next(l - 1)
-			buf.ReadByte()
-		case bson.Binary:
-			l := int(bson.Pack.Uint32(buf.Next(4)))
-			buf.ReadByte()
-			bindVars[key] = buf.Next(l)
-		case bson.Int:
-			bindVars[key] = int32(bson.Pack.Uint32(buf.Next(4)))
-		case bson.Long:
-			bindVars[key] = int64(bson.Pack.Uint64(buf.Next(8)))
-		case bson.Ulong:
-			bindVars[key] = bson.Pack.Uint64(buf.Next(8))
-		case bson.Datetime:
-			i64 := int64(bson.Pack.Uint64(buf.Next(8)))
-			// micro->nano->UTC
-			bindVars[key] = time.Unix(0, i64*1e6).UTC()
-		case bson.Null:
-			bindVars[key] = nil
-		default:
-			panic(bson.NewBsonError("don't know how to handle kind %v yet", kind))
-		}
+		bindVars[key] = decodeBindValueBson(buf, kind)
 	}
 	return
 }
 
+// decodeBindValueBson decodes a single bind variable. Arrays are
+// decoded as []interface{}, for list bind variables.
+func decodeBindValueBson(buf *bytes.Buffer, kind byte) interface{} {
+	switch kind {
+	case bson.Number:
+		ui64 := bson.Pack.Uint64(buf.Next(8))
+		return math.Float64frombits(ui64)
+	case bson.String:
+		l := int(bson.Pack.Uint32(buf.Next(4)))
+		s := buf.Next(l - 1)
+		buf.ReadByte()
+		return s
+	case bson.Binary:
+		l := int(bson.Pack.Uint32(buf.Next(4)))
+		buf.ReadByte()
+		return buf.Next(l)
+	case bson.Int:
+		return int32(bson.Pack.Uint32(buf.Next(4)))
+	case bson.Long:
+		return int64(bson.Pack.Uint64(buf.Next(8)))
+	case bson.Ulong:
+		return bson.Pack.Uint64(buf.Next(8))
+	case bson.Datetime:
+		i64 := int64(bson.Pack.Uint64(buf.Next(8)))
+		// micro->nano->UTC
+		return time.Unix(0, i64*1e6).UTC()
+	case bson.Null:
+		return nil
+	case bson.Array:
+		bson.Next(buf, 4)
+		values := make([]interface{}, 0, 8)
+		kind = bson.NextByte(buf)
+		for i := 0; kind != bson.EOO; i++ {
+			bson.ExpectIndex(buf, i)
+			values = append(values, decodeBindValueBson(buf, kind))
+			kind = bson.NextByte(buf)
+		}
+		return values
+	default:
+		panic(bson.NewBsonError("don't know how to handle kind %v yet", kind))
+	}
+}
+
 // String prints a readable version of Query, and also truncates
 // data if it's too long
 func (query *Query) String() string {
@@ -85,6 +85,28 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+func TestQueryListBindVariables(t *testing.T) {
+	custom := Query{
+		Sql:           "select * from a where id in (::ids)",
+		BindVariables: map[string]interface{}{"ids": []interface{}{int64(1), "b", nil}},
+	}
+	encoded, err := bson.Marshal(&custom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unmarshalled Query
+	if err := bson.Unmarshal(encoded, &unmarshalled); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := unmarshalled.BindVariables["ids"].([]interface{})
+	if !ok || len(got) != 3 {
+		t.Fatalf("want a list of 3 values, got %#v", unmarshalled.BindVariables["ids"])
+	}
+	if got[0].(int64) != 1 || string(got[1].([]byte)) != "b" || got[2] != nil {
+		t.Errorf("want [1 b <nil>], got %#v", got)
+	}
+}
+
 type reflectSession struct {
 	TransactionId int64
 	ConnectionId  int64
@@ -28,6 +28,20 @@ type SqlQuery interface {
 	Execute(context *rpcproto.Context, query *Query, reply *mproto.QueryResult) error
 	StreamExecute(context *rpcproto.Context, query *Query, sendReply func(reply interface{}) error) error
 	ExecuteBatch(context *rpcproto.Context, queryList *QueryList, reply *QueryResultList) error
+
+	GetSequenceValues(context *rpcproto.Context, req *SequenceRequest, reply *SequenceValues) error
+
+	// Two-phase commit of the distributed transactions.
+	Prepare(context *rpcproto.Context, req *PreparedTransaction, noOutput *string) error
+	CommitPrepared(context *rpcproto.Context, req *PreparedTransaction, noOutput *string) error
+	RollbackPrepared(context *rpcproto.Context, req *PreparedTransaction, noOutput *string) error
+
+	// Transaction metadata of the distributed transactions, kept
+	// by the master of an unsharded keyspace.
+	CreateTransaction(context *rpcproto.Context, req *DistributedTransaction, noOutput *string) error
+	SetTransactionState(context *rpcproto.Context, req *DtxStateChange, noOutput *string) error
+	ConcludeTransaction(context *rpcproto.Context, req *PreparedTransaction, noOutput *string) error
+	ReadTransactions(context *rpcproto.Context, req *DtxQuery, reply *DistributedTransactionList) error
 }
 
 // helper method to register the server (does interface checking)
@@ -63,3 +63,76 @@ type DmlType struct {
 type DDLInvalidate struct {
 	DDL string
 }
+
+type SequenceRequest struct {
+	Sequence  string
+	Count     int64
+	SessionId int64
+}
+
+type SequenceValues struct {
+	First int64
+}
+
+// PreparedTransaction identifies a distributed transaction on a
+// tablet. TransactionId is the id of the transaction to prepare, or
+// the id of the transaction to roll back if it was not prepared yet.
+type PreparedTransaction struct {
+	Dtid          string
+	TransactionId int64
+	SessionId     int64
+}
+
+// The states of a distributed transaction in the transaction
+// metadata (the _vt.dtx table). A transaction is created in the
+// PREPARE state, and goes to COMMIT or ROLLBACK once: COMMIT is the
+// commit decision.
+const (
+	DTX_PREPARE  = 0
+	DTX_COMMIT   = 1
+	DTX_ROLLBACK = 2
+)
+
+var DtxStateNames = map[int64]string{
+	DTX_PREPARE:  "PREPARE",
+	DTX_COMMIT:   "COMMIT",
+	DTX_ROLLBACK: "ROLLBACK",
+}
+
+// DtxParticipant is a shard taking part in a distributed transaction.
+type DtxParticipant struct {
+	Keyspace string
+	Shard    string
+}
+
+// DistributedTransaction is the metadata of a distributed
+// transaction.
+type DistributedTransaction struct {
+	Dtid         string
+	State        int64
+	TimeCreated  int64
+	Participants []DtxParticipant
+	SessionId    int64
+}
+
+type DistributedTransactionList struct {
+	List []DistributedTransaction
+}
+
+// DtxStateChange moves the distributed transaction Dtid from the
+// state From to the state To.
+type DtxStateChange struct {
+	Dtid      string
+	From      int64
+	To        int64
+	SessionId int64
+}
+
+// DtxQuery reads the metadata of the distributed transaction Dtid
+// if it's set, or of all the transactions created more than
+// AbandonAge nanoseconds ago.
+type DtxQuery struct {
+	Dtid       string
+	AbandonAge int64
+	SessionId  int64
+}
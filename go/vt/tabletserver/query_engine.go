@@ -14,6 +14,8 @@ import (
 	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/stats"
 	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/trace"
 	"github.com/youtube/vitess/go/vt/dbconfigs"
 	"github.com/youtube/vitess/go/vt/schema"
 	"github.com/youtube/vitess/go/vt/sqlparser"
@@ -42,6 +44,8 @@ type QueryEngine struct {
 	streamTokens   *sync2.Semaphore
 	reservedPool   *ReservedPool
 	txPool         *ConnectionPool
+	txPoolTimeout  sync2.AtomicDuration
+	dbaPool        *ConnectionPool
 	activeTxPool   *ActiveTxPool
 	activePool     *ActivePool
 	consolidator   *Consolidator
@@ -50,6 +54,26 @@ type QueryEngine struct {
 
 	maxResultSize    sync2.AtomicInt64
 	streamBufferSize sync2.AtomicInt64
+
+	normalizeQueries bool
+
+	// two-phase commit, see twopc.go
+	twoPCEnabled       bool
+	twoPCAbandonAge    time.Duration
+	twoPCTicks         *timer.Timer
+	preparedPool       *PreparedPool
+	twoPCTablesMu      sync.Mutex
+	twoPCTablesCreated bool
+
+	// read-after-write consistency, see group_id.go
+	reportCommitGroupId bool
+	groupIdCache        sync2.AtomicInt64
+
+	// warmup, see warmup.go
+	warmupFile        string
+	warmupQueryCount  int
+	warmupConcurrency int
+	warmupTimeout     time.Duration
 }
 
 type CompiledPlan struct {
@@ -67,6 +91,7 @@ var (
 	resultStats           *stats.Histogram
 	spotCheckCount        *stats.Int
 	QPSRates              *stats.Rates
+	normalizeStats        *stats.Counters
 )
 
 var resultBuckets = []int64{0, 1, 5, 10, 50, 100, 500, 1000, 5000, 10000}
@@ -86,14 +111,27 @@ func NewQueryEngine(config Config) *QueryEngine {
 	qe.streamTokens = sync2.NewSemaphore(config.StreamExecThrottle, time.Duration(config.StreamWaitTimeout*1e9))
 	qe.reservedPool = NewReservedPool("ReservedPool")
 	qe.txPool = NewConnectionPool("TransactionPool", config.TransactionCap, time.Duration(config.IdleTimeout*1e9)) // connections in pool has to be > transactionCap
+	qe.txPoolTimeout = sync2.AtomicDuration(config.TxPoolTimeout * 1e9)
+	qe.dbaPool = NewConnectionPool("DbaPool", config.DbaPoolSize, time.Duration(config.IdleTimeout*1e9))
+	for _, pool := range []*ConnectionPool{qe.connPool, qe.streamConnPool, qe.dbaPool} {
+		pool.SetWaitTimeout(time.Duration(config.PoolTimeout * 1e9))
+	}
+	for _, pool := range []*ConnectionPool{qe.connPool, qe.txPool, qe.dbaPool} {
+		pool.SetPrefill(config.PoolPrefill)
+	}
+	qe.setMaxConnLifetime(time.Duration(config.MaxConnLifetime * 1e9))
 	qe.activeTxPool = NewActiveTxPool("ActiveTransactionPool", time.Duration(config.TransactionTimeout*1e9))
-	qe.activePool = NewActivePool("ActivePool", time.Duration(config.QueryTimeout*1e9), time.Duration(config.IdleTimeout*1e9))
+	qe.activePool = NewActivePool("ActivePool", time.Duration(config.QueryTimeout*1e9), qe.dbaPool)
 	qe.consolidator = NewConsolidator()
 	qe.spotCheckFreq = sync2.AtomicInt64(config.SpotCheckRatio * SPOT_CHECK_MULTIPLIER)
 	qe.maxResultSize = sync2.AtomicInt64(config.MaxResultSize)
 	qe.streamBufferSize = sync2.AtomicInt64(config.StreamBufferSize)
+	slowQueryThreshold.Set(time.Duration(config.SlowQueryThreshold * 1e9))
+	redactSlowQueryBindVars = config.RedactSlowQueries
+	qe.normalizeQueries = config.NormalizeQueries
 	stats.Publish("MaxResultSize", stats.IntFunc(qe.maxResultSize.Get))
 	stats.Publish("StreamBufferSize", stats.IntFunc(qe.streamBufferSize.Get))
+	stats.Publish("TransactionPoolTimeout", stats.DurationFunc(qe.txPoolTimeout.Get))
 	queryStats = stats.NewTimings("Queries")
 	QPSRates = stats.NewRates("QPS", queryStats, 15, 60*time.Second)
 	waitStats = stats.NewTimings("Waits")
@@ -104,15 +142,50 @@ func NewQueryEngine(config Config) *QueryEngine {
 		return float64(qe.spotCheckFreq.Get()) / SPOT_CHECK_MULTIPLIER
 	}))
 	spotCheckCount = stats.NewInt("SpotCheckCount")
+	normalizeStats = stats.NewCounters("QueryNormalizations")
+	qe.twoPCEnabled = config.TwoPCEnable
+	qe.twoPCAbandonAge = time.Duration(config.TwoPCAbandonAge * 1e9)
+	qe.twoPCTicks = timer.NewTimer(qe.twoPCAbandonAge / 2)
+	qe.reportCommitGroupId = config.ReportCommitGroupId
+	qe.warmupFile = config.WarmupFile
+	qe.warmupQueryCount = config.WarmupQueryCount
+	qe.warmupConcurrency = config.WarmupConcurrency
+	qe.warmupTimeout = time.Duration(config.WarmupTimeout * 1e9)
+	qe.preparedPool = NewPreparedPool()
+	stats.Publish("PreparedTransactions", stats.IntFunc(qe.preparedPool.Size))
+	twoPCStats = stats.NewCounters("TwoPC")
 	return qe
 }
 
-func (qe *QueryEngine) Open(dbconfig dbconfigs.DBConfig, schemaOverrides []SchemaOverride, qrs *QueryRules) {
+// normalize replaces the literals of the query with bind variables,
+// if the query engine is configured to. Trailing comments have to be
+// stripped first.
+func (qe *QueryEngine) normalize(logStats *sqlQueryStats, query *proto.Query) {
+	if !qe.normalizeQueries {
+		return
+	}
+	sql, bindVars, ok := sqlparser.Normalize(query.Sql, query.BindVariables)
+	if !ok {
+		normalizeStats.Add("Unchanged", 1)
+		return
+	}
+	normalizeStats.Add("Normalized", 1)
+	query.Sql = sql
+	query.BindVariables = bindVars
+	logStats.BindVariables = bindVars
+}
+
+func (qe *QueryEngine) Open(dbcfgs dbconfigs.DBConfigs, schemaOverrides []SchemaOverride, qrs *QueryRules) {
 	// Wait for Close, in case it's running
 	qe.mu.Lock()
 	defer qe.mu.Unlock()
 
-	connFactory := GenericConnectionCreator(dbconfig.MysqlParams())
+	connFactory := GenericConnectionCreator(dbcfgs.App.MysqlParams())
+	// vtocc only has an app config, it kills its queries as the app user
+	dbaConnFactory := connFactory
+	if dbcfgs.Dba.Uname != "" {
+		dbaConnFactory = GenericConnectionCreator(dbcfgs.Dba)
+	}
 
 	start := time.Now().UnixNano()
 	qe.cachePool.Open()
@@ -123,18 +196,24 @@ func (qe *QueryEngine) Open(dbconfig dbconfigs.DBConfig, schemaOverrides []Schem
 	qe.reservedPool.Open(connFactory)
 	qe.txPool.Open(connFactory)
 	qe.activeTxPool.Open()
-	qe.activePool.Open(connFactory)
+	qe.dbaPool.Open(dbaConnFactory)
+	qe.activePool.Open()
+	qe.openTwoPC()
 }
 
 func (qe *QueryEngine) Close() {
+	qe.stopTwoPCWatchdog()
 	qe.activeTxPool.WaitForEmpty()
 	// Ensure all read locks are released (no more queries being served)
 	qe.mu.Lock()
 	defer qe.mu.Unlock()
 
 	qe.activePool.Close()
+	qe.dbaPool.Close()
+	qe.saveWarmupQueries()
 	qe.schemaInfo.Close()
 	qe.activeTxPool.Close()
+	qe.closeTwoPC()
 	qe.txPool.Close()
 	qe.reservedPool.Close()
 	qe.streamConnPool.Close()
@@ -149,7 +228,7 @@ func (qe *QueryEngine) Begin(logStats *sqlQueryStats, connectionId int64) (trans
 	var conn PoolConnection
 	if connectionId != 0 {
 		conn = qe.reservedPool.Get(connectionId)
-	} else if conn = qe.txPool.TryGet(); conn == nil {
+	} else if conn = qe.txPool.TryGetWithTimeout(qe.txPoolTimeout.Get()); conn == nil {
 		panic(NewTabletError(TX_POOL_FULL, "Transaction pool connection limit exceeded"))
 	}
 	transactionId, err := qe.activeTxPool.SafeBegin(conn)
@@ -217,21 +296,38 @@ func (qe *QueryEngine) Execute(logStats *sqlQueryStats, query *proto.Query) (rep
 	}
 	logStats.BindVariables = query.BindVariables
 	logStats.OriginalSql = query.Sql
+	logStats.directives = sqlparser.ParseDirectives(query.Sql)
+	qe.checkMinGroupId(logStats)
 	// cheap hack: strip trailing comment into a special bind var
 	stripTrailing(query)
+	qe.normalize(logStats, query)
+	logStats.span = startTraceSpan("vttablet.Execute", query.BindVariables)
+	defer logStats.span.Finish()
 	basePlan := qe.schemaInfo.GetPlan(logStats, query.Sql)
 	planName := basePlan.PlanId.String()
 	logStats.PlanType = planName
+	logStats.span.Annotate("plan", planName)
 	defer func(start time.Time) {
 		duration := time.Now().Sub(start)
 		queryStats.Add(planName, duration)
 		if reply == nil {
 			basePlan.AddStats(1, duration, 0, 1)
+			qe.schemaInfo.tablePlanStats.Add(basePlan, duration, 0, 0, 1)
 		} else {
 			basePlan.AddStats(1, duration, int64(len(reply.Rows)), 0)
+			var rowsAffected int64
+			if !basePlan.PlanId.IsSelect() {
+				rowsAffected = int64(reply.RowsAffected)
+			} else if qe.warmupFile != "" {
+				basePlan.setSample(query.BindVariables)
+			}
+			qe.schemaInfo.tablePlanStats.Add(basePlan, duration, int64(len(reply.Rows)), rowsAffected, 0)
 		}
 	}(time.Now())
 
+	checkTableAcl(logStats, basePlan)
+	checkStrictMode(basePlan, query.Sql, query.BindVariables)
+
 	// Run it by the rules engine
 	action, desc := basePlan.Rules.getAction(logStats.RemoteAddr(), logStats.Username(), query.BindVariables)
 	if action == QR_FAIL_QUERY {
@@ -322,8 +418,13 @@ func (qe *QueryEngine) StreamExecute(logStats *sqlQueryStats, query *proto.Query
 	}
 	logStats.BindVariables = query.BindVariables
 	logStats.OriginalSql = query.Sql
+	logStats.directives = sqlparser.ParseDirectives(query.Sql)
+	qe.checkMinGroupId(logStats)
 	// cheap hack: strip trailing comment into a special bind var
 	stripTrailing(query)
+	qe.normalize(logStats, query)
+	logStats.span = startTraceSpan("vttablet.StreamExecute", query.BindVariables)
+	defer logStats.span.Finish()
 
 	fullQuery := qe.schemaInfo.GetStreamPlan(query.Sql)
 	logStats.PlanType = "SELECT_STREAM"
@@ -704,7 +805,10 @@ func (qe *QueryEngine) execSet(logStats *sqlQueryStats, conn PoolConnection, pla
 		qe.connPool.SetIdleTimeout(time.Duration(t))
 		qe.streamConnPool.SetIdleTimeout(time.Duration(t))
 		qe.txPool.SetIdleTimeout(time.Duration(t))
-		qe.activePool.SetIdleTimeout(time.Duration(t))
+		qe.dbaPool.SetIdleTimeout(time.Duration(t))
+		qe.schemaInfo.connPool.SetIdleTimeout(time.Duration(t))
+	case "vt_max_conn_lifetime":
+		qe.setMaxConnLifetime(time.Duration(plan.SetValue.(float64) * 1e9))
 	case "vt_spot_check_ratio":
 		qe.spotCheckFreq.Set(int64(plan.SetValue.(float64) * SPOT_CHECK_MULTIPLIER))
 	default:
@@ -713,8 +817,28 @@ func (qe *QueryEngine) execSet(logStats *sqlQueryStats, conn PoolConnection, pla
 	return &mproto.QueryResult{}
 }
 
+func (qe *QueryEngine) setMaxConnLifetime(maxLifetime time.Duration) {
+	for _, pool := range []*ConnectionPool{qe.connPool, qe.streamConnPool, qe.txPool, qe.dbaPool, qe.schemaInfo.connPool} {
+		pool.SetMaxLifetime(maxLifetime)
+	}
+}
+
 func (qe *QueryEngine) qFetch(logStats *sqlQueryStats, parsed_query *sqlparser.ParsedQuery, bindVars map[string]interface{}, listVars []sqltypes.Value) (result *mproto.QueryResult) {
 	sql := qe.generateFinalSql(parsed_query, bindVars, listVars, nil)
+	if logStats.directives.IsSet(sqlparser.DIRECTIVE_SKIP_CONSOLIDATOR) {
+		waitingForConnectionStart := time.Now()
+		conn, err := qe.connPool.SafeGet()
+		logStats.WaitingForConnection += time.Now().Sub(waitingForConnectionStart)
+		if err != nil {
+			panic(NewTabletErrorSql(FATAL, err))
+		}
+		defer conn.Recycle()
+		result, err := qe.executeSql(logStats, conn, sql, false)
+		if err != nil {
+			panic(err)
+		}
+		return result
+	}
 	q, ok := qe.consolidator.Create(string(sql))
 	if ok {
 		defer q.Broadcast()
@@ -777,8 +901,19 @@ func (qe *QueryEngine) generateFinalSql(parsed_query *sqlparser.ParsedQuery, bin
 
 func (qe *QueryEngine) executeSql(logStats *sqlQueryStats, conn PoolConnection, sql string, wantfields bool) (*mproto.QueryResult, error) {
 	connid := conn.Id()
-	qe.activePool.Put(connid)
-	defer qe.activePool.Remove(connid)
+	if timeout := logStats.directives.GetInt(sqlparser.DIRECTIVE_QUERY_TIMEOUT_MS, -1); timeout >= 0 {
+		// The query replaces the timeout of the active pool,
+		// 0 means it is never killed.
+		if timeout > 0 {
+			killer := time.AfterFunc(time.Duration(timeout)*time.Millisecond, func() {
+				qe.activePool.kill(connid)
+			})
+			defer killer.Stop()
+		}
+	} else {
+		qe.activePool.Put(connid)
+		defer qe.activePool.Remove(connid)
+	}
 
 	logStats.QuerySources |= QUERY_SOURCE_MYSQL
 	logStats.NumberOfQueries += 1
@@ -787,13 +922,18 @@ func (qe *QueryEngine) executeSql(logStats *sqlQueryStats, conn PoolConnection,
 	// NOTE(szopa): I am not doing this measurement inside
 	// conn.ExecuteFetch because that would require changing the
 	// PoolConnection interface. Same applies to executeStreamSql.
+	mysqlSpan := trace.NewChildSpan(logStats.span.SpanContext(), "mysql")
 	fetchStart := time.Now()
 	result, err := conn.ExecuteFetch(sql, int(qe.maxResultSize.Get()), wantfields)
 	logStats.MysqlResponseTime += time.Now().Sub(fetchStart)
+	mysqlSpan.Finish()
 
 	if err != nil {
 		return nil, NewTabletErrorSql(FAIL, err)
 	}
+	if txc, ok := conn.(*TxConnection); ok {
+		txc.statements = append(txc.statements, sql)
+	}
 	return result, nil
 }
 
@@ -815,6 +955,8 @@ func (qe *QueryEngine) executeStreamSql(logStats *sqlQueryStats, conn PoolConnec
 	logStats.QuerySources |= QUERY_SOURCE_MYSQL
 	logStats.NumberOfQueries += 1
 	logStats.AddRewrittenSql(sql)
+	mysqlSpan := trace.NewChildSpan(logStats.span.SpanContext(), "mysql")
+	defer mysqlSpan.Finish()
 	fetchStart := time.Now()
 	err := conn.ExecuteStreamFetch(
 		sql,
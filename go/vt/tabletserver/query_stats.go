@@ -0,0 +1,157 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// QueryStatsTable aggregates the stats of all the queries executed
+// by (table, plan type). Unlike the per-plan stats, they are not lost
+// when a plan is evicted from the query cache.
+type QueryStatsTable struct {
+	mu    sync.Mutex
+	stats map[tablePlan]*TablePlanStats
+}
+
+type tablePlan struct {
+	table string
+	plan  string
+}
+
+// TablePlanStats are the aggregated stats for one (table, plan type).
+type TablePlanStats struct {
+	Table        string
+	Plan         string
+	QueryCount   int64
+	Time         time.Duration
+	RowsReturned int64
+	RowsAffected int64
+	ErrorCount   int64
+}
+
+// AvgTime returns the average time spent per query.
+func (tps *TablePlanStats) AvgTime() time.Duration {
+	if tps.QueryCount == 0 {
+		return 0
+	}
+	return tps.Time / time.Duration(tps.QueryCount)
+}
+
+func NewQueryStatsTable() *QueryStatsTable {
+	return &QueryStatsTable{stats: make(map[tablePlan]*TablePlanStats)}
+}
+
+// Add records one query for the plan. Queries that don't have a
+// table (joins) are reported as table 'Join'.
+func (qst *QueryStatsTable) Add(plan *ExecPlan, duration time.Duration, rowsReturned, rowsAffected, errorCount int64) {
+	table := plan.TableName
+	if table == "" {
+		table = "Join"
+	}
+	key := tablePlan{table, plan.PlanId.String()}
+
+	qst.mu.Lock()
+	defer qst.mu.Unlock()
+	tps, ok := qst.stats[key]
+	if !ok {
+		tps = &TablePlanStats{Table: key.table, Plan: key.plan}
+		qst.stats[key] = tps
+	}
+	tps.QueryCount++
+	tps.Time += duration
+	tps.RowsReturned += rowsReturned
+	tps.RowsAffected += rowsAffected
+	tps.ErrorCount += errorCount
+}
+
+// Snapshot returns a copy of all the stats, the most expensive ones
+// (by total time) first.
+func (qst *QueryStatsTable) Snapshot() []TablePlanStats {
+	qst.mu.Lock()
+	result := make([]TablePlanStats, 0, len(qst.stats))
+	for _, tps := range qst.stats {
+		result = append(result, *tps)
+	}
+	qst.mu.Unlock()
+	sort.Sort(byTime(result))
+	return result
+}
+
+// matrix returns one of the stats as a table -> plan -> value map.
+func (qst *QueryStatsTable) matrix(f func(*TablePlanStats) int64) map[string]map[string]int64 {
+	qst.mu.Lock()
+	defer qst.mu.Unlock()
+	result := make(map[string]map[string]int64)
+	for key, tps := range qst.stats {
+		planStats, ok := result[key.table]
+		if !ok {
+			planStats = make(map[string]int64)
+			result[key.table] = planStats
+		}
+		planStats[key.plan] = f(tps)
+	}
+	return result
+}
+
+type byTime []TablePlanStats
+
+func (bt byTime) Len() int           { return len(bt) }
+func (bt byTime) Swap(i, j int)      { bt[i], bt[j] = bt[j], bt[i] }
+func (bt byTime) Less(i, j int) bool { return bt[i].Time > bt[j].Time }
+
+var queryzTemplate = template.Must(template.New("queryz").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>Queryz</title>
+<style>
+  table { border-collapse: collapse; }
+  td, th { border: 1px solid #999; padding: 0.2em 0.5em; }
+  td.num { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Query stats by table and plan, most expensive first</h1>
+<table>
+  <tr>
+    <th>Table</th>
+    <th>Plan</th>
+    <th>Count</th>
+    <th>Time</th>
+    <th>Avg time</th>
+    <th>Rows returned</th>
+    <th>Rows affected</th>
+    <th>Errors</th>
+  </tr>
+  {{range .}}
+  <tr>
+    <td>{{.Table}}</td>
+    <td>{{.Plan}}</td>
+    <td class="num">{{.QueryCount}}</td>
+    <td class="num">{{.Time}}</td>
+    <td class="num">{{.AvgTime}}</td>
+    <td class="num">{{.RowsReturned}}</td>
+    <td class="num">{{.RowsAffected}}</td>
+    <td class="num">{{.ErrorCount}}</td>
+  </tr>
+  {{end}}
+</table>
+</body>
+</html>
+`))
+
+// ServeHTTP serves the /queryz page.
+func (qst *QueryStatsTable) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := queryzTemplate.Execute(response, qst.Snapshot()); err != nil {
+		log.Errorf("queryz: %v", err)
+	}
+}
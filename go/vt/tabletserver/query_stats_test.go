@@ -0,0 +1,53 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+func TestQueryStatsTable(t *testing.T) {
+	qst := NewQueryStatsTable()
+	pkEqual := &ExecPlan{ExecPlan: &sqlparser.ExecPlan{TableName: "t1", PlanId: sqlparser.PLAN_PK_EQUAL}}
+	dml := &ExecPlan{ExecPlan: &sqlparser.ExecPlan{TableName: "t1", PlanId: sqlparser.PLAN_DML_PK}}
+	join := &ExecPlan{ExecPlan: &sqlparser.ExecPlan{PlanId: sqlparser.PLAN_PASS_SELECT}}
+
+	qst.Add(pkEqual, time.Millisecond, 1, 0, 0)
+	qst.Add(pkEqual, 3*time.Millisecond, 0, 0, 1)
+	qst.Add(dml, time.Millisecond, 0, 5, 0)
+	qst.Add(join, 10*time.Millisecond, 100, 0, 0)
+
+	snapshot := qst.Snapshot()
+	if len(snapshot) != 3 {
+		t.Fatalf("want 3 entries, got %v", snapshot)
+	}
+	if snapshot[0].Table != "Join" || snapshot[0].Plan != "PASS_SELECT" || snapshot[0].RowsReturned != 100 {
+		t.Errorf("most expensive entry should be the join: %#v", snapshot[0])
+	}
+	want := TablePlanStats{Table: "t1", Plan: "PK_EQUAL", QueryCount: 2, Time: 4 * time.Millisecond, RowsReturned: 1, ErrorCount: 1}
+	if snapshot[1] != want {
+		t.Errorf("want %#v, got %#v", want, snapshot[1])
+	}
+	if avg := snapshot[1].AvgTime(); avg != 2*time.Millisecond {
+		t.Errorf("AvgTime: want 2ms, got %v", avg)
+	}
+
+	rowsAffected := qst.matrix(func(tps *TablePlanStats) int64 { return tps.RowsAffected })
+	if rowsAffected["t1"]["DML_PK"] != 5 {
+		t.Errorf("bad rows affected matrix: %v", rowsAffected)
+	}
+
+	response := httptest.NewRecorder()
+	qst.ServeHTTP(response, nil)
+	body := response.Body.String()
+	if strings.Index(body, "<td>Join</td>") > strings.Index(body, "<td>t1</td>") {
+		t.Errorf("queryz is not sorted by cost: %v", body)
+	}
+}
@@ -6,6 +6,7 @@ package tabletserver
 
 import (
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
@@ -14,6 +15,7 @@ import (
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
 	"github.com/youtube/vitess/go/vt/dbconfigs"
+	"github.com/youtube/vitess/go/vt/servenv"
 	"github.com/youtube/vitess/go/vt/tabletserver/proto"
 )
 
@@ -27,6 +29,10 @@ func init() {
 	flag.IntVar(&qsConfig.PoolSize, "queryserver-config-pool-size", DefaultQsConfig.PoolSize, "query server pool size")
 	flag.IntVar(&qsConfig.StreamPoolSize, "queryserver-config-stream-pool-size", DefaultQsConfig.StreamPoolSize, "query server stream pool size")
 	flag.IntVar(&qsConfig.TransactionCap, "queryserver-config-transaction-cap", DefaultQsConfig.TransactionCap, "query server transaction cap")
+	flag.IntVar(&qsConfig.DbaPoolSize, "queryserver-config-dba-pool-size", DefaultQsConfig.DbaPoolSize, "query server dba pool size, used to kill queries")
+	flag.Float64Var(&qsConfig.PoolTimeout, "queryserver-config-pool-timeout", DefaultQsConfig.PoolTimeout, "how many seconds queries wait for a connection from the query, stream and dba pools before failing, 0 waits forever")
+	flag.Float64Var(&qsConfig.TxPoolTimeout, "queryserver-config-txpool-timeout", DefaultQsConfig.TxPoolTimeout, "how many seconds Begin waits for a connection from the transaction pool before failing with tx_pool_full, 0 fails immediately")
+	flag.BoolVar(&qsConfig.PoolPrefill, "queryserver-config-pool-prefill", DefaultQsConfig.PoolPrefill, "open all the connections of the query, transaction and dba pools when the query service starts")
 	flag.Float64Var(&qsConfig.TransactionTimeout, "queryserver-config-transaction-timeout", DefaultQsConfig.TransactionTimeout, "query server transaction timeout")
 	flag.IntVar(&qsConfig.MaxResultSize, "queryserver-config-max-result-size", DefaultQsConfig.MaxResultSize, "query server max result size")
 	flag.IntVar(&qsConfig.StreamBufferSize, "queryserver-config-stream-buffer-size", DefaultQsConfig.StreamBufferSize, "query server stream buffer size")
@@ -34,9 +40,20 @@ func init() {
 	flag.Float64Var(&qsConfig.SchemaReloadTime, "queryserver-config-schema-reload-time", DefaultQsConfig.SchemaReloadTime, "query server schema reload time")
 	flag.Float64Var(&qsConfig.QueryTimeout, "queryserver-config-query-timeout", DefaultQsConfig.QueryTimeout, "query server query timeout")
 	flag.Float64Var(&qsConfig.IdleTimeout, "queryserver-config-idle-timeout", DefaultQsConfig.IdleTimeout, "query server idle timeout")
+	flag.Float64Var(&qsConfig.MaxConnLifetime, "queryserver-config-max-conn-lifetime", DefaultQsConfig.MaxConnLifetime, "mysql connections older than this many seconds are replaced when taken from their pool, 0 means no limit")
 	flag.Float64Var(&qsConfig.SpotCheckRatio, "queryserver-config-spot-check-ratio", DefaultQsConfig.SpotCheckRatio, "query server rowcache spot check frequency")
 	flag.IntVar(&qsConfig.StreamExecThrottle, "queryserver-config-stream-exec-throttle", DefaultQsConfig.StreamExecThrottle, "Maximum number of simultaneous streaming requests that can wait for results")
 	flag.Float64Var(&qsConfig.StreamWaitTimeout, "queryserver-config-stream-exec-timeout", DefaultQsConfig.StreamWaitTimeout, "Timeout for stream-exec-throttle")
+	flag.Float64Var(&qsConfig.SlowQueryThreshold, "queryserver-config-slow-query-threshold", DefaultQsConfig.SlowQueryThreshold, "queries taking longer than this many seconds are logged, 0 disables the slow query log")
+	flag.BoolVar(&qsConfig.RedactSlowQueries, "queryserver-config-redact-slow-queries", DefaultQsConfig.RedactSlowQueries, "only log the type of the bind variables of slow queries, not their values")
+	flag.BoolVar(&qsConfig.NormalizeQueries, "queryserver-config-normalize-queries", DefaultQsConfig.NormalizeQueries, "replace the literals of queries with bind variables before planning them, so queries that only differ by their values share a plan")
+	flag.BoolVar(&qsConfig.TwoPCEnable, "queryserver-config-twopc-enable", DefaultQsConfig.TwoPCEnable, "accept the two-phase commit of distributed transactions")
+	flag.Float64Var(&qsConfig.TwoPCAbandonAge, "queryserver-config-twopc-abandon-age", DefaultQsConfig.TwoPCAbandonAge, "prepared transactions older than this many seconds are resolved by the transaction resolver, 0 disables the watchdog")
+	flag.StringVar(&qsConfig.WarmupFile, "queryserver-config-warmup-file", DefaultQsConfig.WarmupFile, "file where the most frequent select queries are saved when the query service stops, and replayed from before it serves again. Empty disables the warmup")
+	flag.IntVar(&qsConfig.WarmupQueryCount, "queryserver-config-warmup-query-count", DefaultQsConfig.WarmupQueryCount, "number of queries saved for the warmup")
+	flag.IntVar(&qsConfig.WarmupConcurrency, "queryserver-config-warmup-concurrency", DefaultQsConfig.WarmupConcurrency, "number of warmup queries replayed concurrently")
+	flag.Float64Var(&qsConfig.WarmupTimeout, "queryserver-config-warmup-timeout", DefaultQsConfig.WarmupTimeout, "maximum duration of the warmup, in seconds")
+	flag.BoolVar(&qsConfig.ReportCommitGroupId, "queryserver-config-report-commit-group-id", DefaultQsConfig.ReportCommitGroupId, "return the replication group id of mysqld after each commit, for the read-after-write consistency of vtgate")
 	flag.StringVar(&qsConfig.RowCache.Binary, "rowcache-bin", DefaultQsConfig.RowCache.Binary, "rowcache binary file")
 	flag.IntVar(&qsConfig.RowCache.Memory, "rowcache-m", DefaultQsConfig.RowCache.Memory, "rowcache max memory usage in MB")
 	flag.StringVar(&qsConfig.RowCache.Socket, "rowcache-s", DefaultQsConfig.RowCache.Socket, "rowcache socket path to listen on")
@@ -44,6 +61,44 @@ func init() {
 	flag.IntVar(&qsConfig.RowCache.Connections, "rowcache-c", DefaultQsConfig.RowCache.Connections, "rowcache max simultaneous connections")
 	flag.IntVar(&qsConfig.RowCache.Threads, "rowcache-t", DefaultQsConfig.RowCache.Threads, "rowcache number of threads")
 	flag.BoolVar(&qsConfig.RowCache.LockPaged, "rowcache-k", DefaultQsConfig.RowCache.LockPaged, "whether rowcache locks down paged memory")
+	registerMutableFlags()
+}
+
+// registerMutableFlags allows the pool sizes and the result limits to
+// be changed at runtime, see servenv.SetFlag. The new values are
+// applied to the query engine like the equivalent set statements.
+func registerMutableFlags() {
+	apply := func(f func(qe *QueryEngine) error) func() error {
+		return func() error {
+			if SqlQueryRpcService == nil {
+				return nil
+			}
+			return f(SqlQueryRpcService.qe)
+		}
+	}
+	servenv.RegisterMutableFlag("queryserver-config-pool-size", apply(func(qe *QueryEngine) error {
+		return qe.connPool.SetCapacity(qsConfig.PoolSize)
+	}))
+	servenv.RegisterMutableFlag("queryserver-config-stream-pool-size", apply(func(qe *QueryEngine) error {
+		return qe.streamConnPool.SetCapacity(qsConfig.StreamPoolSize)
+	}))
+	servenv.RegisterMutableFlag("queryserver-config-transaction-cap", apply(func(qe *QueryEngine) error {
+		return qe.txPool.SetCapacity(qsConfig.TransactionCap)
+	}))
+	servenv.RegisterMutableFlag("queryserver-config-query-cache-size", apply(func(qe *QueryEngine) error {
+		if qsConfig.QueryCacheSize <= 0 {
+			return fmt.Errorf("query cache size out of range %v", qsConfig.QueryCacheSize)
+		}
+		qe.schemaInfo.SetQueryCacheSize(qsConfig.QueryCacheSize)
+		return nil
+	}))
+	servenv.RegisterMutableFlag("queryserver-config-max-result-size", apply(func(qe *QueryEngine) error {
+		if qsConfig.MaxResultSize < 1 {
+			return fmt.Errorf("max result size out of range %v", qsConfig.MaxResultSize)
+		}
+		qe.maxResultSize.Set(int64(qsConfig.MaxResultSize))
+		return nil
+	}))
 }
 
 type RowCacheConfig struct {
@@ -88,6 +143,10 @@ type Config struct {
 	PoolSize           int
 	StreamPoolSize     int
 	TransactionCap     int
+	DbaPoolSize        int
+	PoolTimeout        float64
+	TxPoolTimeout      float64
+	PoolPrefill        bool
 	TransactionTimeout float64
 	MaxResultSize      int
 	StreamBufferSize   int
@@ -95,10 +154,23 @@ type Config struct {
 	SchemaReloadTime   float64
 	QueryTimeout       float64
 	IdleTimeout        float64
+	MaxConnLifetime    float64
 	RowCache           RowCacheConfig
 	SpotCheckRatio     float64
 	StreamExecThrottle int
 	StreamWaitTimeout  float64
+	SlowQueryThreshold float64
+	RedactSlowQueries  bool
+	NormalizeQueries   bool
+	TwoPCEnable        bool
+	TwoPCAbandonAge    float64
+
+	ReportCommitGroupId bool
+
+	WarmupFile        string
+	WarmupQueryCount  int
+	WarmupConcurrency int
+	WarmupTimeout     float64
 }
 
 // DefaultQSConfig is the default value for the query service config.
@@ -113,17 +185,34 @@ var DefaultQsConfig = Config{
 	PoolSize:           16,
 	StreamPoolSize:     750,
 	TransactionCap:     20,
+	DbaPoolSize:        2,
+	PoolTimeout:        0,
+	TxPoolTimeout:      0,
+	PoolPrefill:        false,
 	TransactionTimeout: 30,
 	MaxResultSize:      10000,
 	QueryCacheSize:     5000,
 	SchemaReloadTime:   30 * 60,
 	QueryTimeout:       0,
 	IdleTimeout:        30 * 60,
+	MaxConnLifetime:    0,
 	StreamBufferSize:   32 * 1024,
 	RowCache:           RowCacheConfig{Memory: -1, TcpPort: -1, Connections: -1, Threads: -1},
 	SpotCheckRatio:     0,
 	StreamExecThrottle: 8,
 	StreamWaitTimeout:  4 * 60,
+	SlowQueryThreshold: 0,
+	RedactSlowQueries:  false,
+	NormalizeQueries:   false,
+	TwoPCEnable:        false,
+	TwoPCAbandonAge:    0,
+
+	ReportCommitGroupId: false,
+
+	WarmupFile:        "",
+	WarmupQueryCount:  100,
+	WarmupConcurrency: 2,
+	WarmupTimeout:     30,
 }
 
 var qsConfig Config
@@ -142,9 +231,11 @@ func RegisterQueryService() {
 
 // AllowQueries can take an indefinite amount of time to return because
 // it keeps retrying until it obtains a valid connection to the database.
-func AllowQueries(dbconfig dbconfigs.DBConfig, schemaOverrides []SchemaOverride, qrs *QueryRules) {
+// Queries are served with the app config, the dba config is used
+// for the dba pool.
+func AllowQueries(dbcfgs dbconfigs.DBConfigs, schemaOverrides []SchemaOverride, qrs *QueryRules) {
 	defer logError()
-	SqlQueryRpcService.allowQueries(dbconfig, schemaOverrides, qrs)
+	SqlQueryRpcService.allowQueries(dbcfgs, schemaOverrides, qrs)
 }
 
 // DisallowQueries can take a long time to return (not indefinite) because
@@ -155,6 +246,24 @@ func DisallowQueries() {
 	SqlQueryRpcService.disallowQueries()
 }
 
+// IsServing returns true until the query service is completely
+// stopped, with all its queries and transactions done.
+func IsServing() bool {
+	return SqlQueryRpcService.state.Get() != NOT_SERVING
+}
+
+// RecoverPreparedTransactions prepares again the distributed
+// transactions of the redo log, when the tablet becomes the master.
+func RecoverPreparedTransactions() {
+	defer logError()
+	if !SqlQueryRpcService.qe.twoPCEnabled {
+		return
+	}
+	if count := SqlQueryRpcService.qe.RecoverPrepared(); count > 0 {
+		log.Infof("recovered %v prepared transactions", count)
+	}
+}
+
 // Reload the schema. If the query service is not running, nothing will happen
 func ReloadSchema() {
 	defer logError()
@@ -189,6 +298,9 @@ func GetQueryRules() (qrs *QueryRules) {
 // connect to the database and serving traffic) or an error explaining
 // the unhealthiness otherwise.
 func IsHealthy() error {
+	if servenv.IsLameduck() {
+		return NewTabletError(RETRY, "lameduck")
+	}
 	return SqlQueryRpcService.Execute(
 		new(rpcproto.Context),
 		&proto.Query{Sql: "select 1 from dual", SessionId: SqlQueryRpcService.sessionId},
@@ -200,6 +312,7 @@ func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
 	if err := IsHealthy(); err != nil {
 		w.Write([]byte("notok"))
+		return
 	}
 	w.Write([]byte("ok"))
 }
@@ -209,7 +322,10 @@ func healthCheck(w http.ResponseWriter, r *http.Request) {
 func InitQueryService() {
 	SqlQueryLogger.ServeLogs(*queryLogHandler)
 	TxLogger.ServeLogs(*txLogHandler)
+	LoadTableAcl()
+	LoadStrictModeOverrides()
 	RegisterQueryService()
+	addStatusParts()
 }
 
 // LoadCustomRules returns custom rules as specified by the command
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -37,6 +38,10 @@ type ExecPlan struct {
 	Time       time.Duration
 	RowCount   int64
 	ErrorCount int64
+
+	// sampleBindVars are the bind variables of one execution,
+	// for the warmup (see warmup.go)
+	sampleBindVars map[string]interface{}
 }
 
 func (*ExecPlan) Size() int {
@@ -83,6 +88,7 @@ type SchemaInfo struct {
 	reloadTime     time.Duration
 	lastChange     time.Time
 	ticks          *timer.Timer
+	tablePlanStats *QueryStatsTable
 }
 
 func NewSchemaInfo(queryCacheSize int, reloadTime time.Duration, idleTimeout time.Duration) *SchemaInfo {
@@ -93,6 +99,7 @@ func NewSchemaInfo(queryCacheSize int, reloadTime time.Duration, idleTimeout tim
 		connPool:       NewConnectionPool("", 2, idleTimeout),
 		reloadTime:     reloadTime,
 		ticks:          timer.NewTimer(reloadTime),
+		tablePlanStats: NewQueryStatsTable(),
 	}
 	stats.Publish("QueryCacheLength", stats.IntFunc(si.queries.Length))
 	stats.Publish("QueryCacheSize", stats.IntFunc(si.queries.Size))
@@ -108,10 +115,13 @@ func NewSchemaInfo(queryCacheSize int, reloadTime time.Duration, idleTimeout tim
 	stats.Publish("QueryCounts", stats.NewMatrixFunc("Table", "Plan", si.getQueryCount))
 	stats.Publish("QueryTimesNs", stats.NewMatrixFunc("Table", "Plan", si.getQueryTime))
 	stats.Publish("QueryRowCounts", stats.NewMatrixFunc("Table", "Plan", si.getQueryRowCount))
+	stats.Publish("QueryRowsAffected", stats.NewMatrixFunc("Table", "Plan", si.getQueryRowsAffected))
 	stats.Publish("QueryErrorCounts", stats.NewMatrixFunc("Table", "Plan", si.getQueryErrorCount))
 	http.Handle("/debug/query_plans", si)
 	http.Handle("/debug/query_stats", si)
 	http.Handle("/debug/table_stats", si)
+	http.Handle("/debug/schema", si)
+	http.Handle("/queryz", si.tablePlanStats)
 	return si
 }
 
@@ -423,59 +433,33 @@ func (si *SchemaInfo) getTableInvalidations() map[string]int64 {
 }
 
 func (si *SchemaInfo) getQueryCount() map[string]map[string]int64 {
-	f := func(plan *ExecPlan) int64 {
-		queryCount, _, _, _ := plan.Stats()
-		return queryCount
-	}
-	return si.getQueryStats(f)
+	return si.tablePlanStats.matrix(func(tps *TablePlanStats) int64 {
+		return tps.QueryCount
+	})
 }
 
 func (si *SchemaInfo) getQueryTime() map[string]map[string]int64 {
-	f := func(plan *ExecPlan) int64 {
-		_, time, _, _ := plan.Stats()
-		return int64(time)
-	}
-	return si.getQueryStats(f)
+	return si.tablePlanStats.matrix(func(tps *TablePlanStats) int64 {
+		return int64(tps.Time)
+	})
 }
 
 func (si *SchemaInfo) getQueryRowCount() map[string]map[string]int64 {
-	f := func(plan *ExecPlan) int64 {
-		_, _, rowCount, _ := plan.Stats()
-		return rowCount
-	}
-	return si.getQueryStats(f)
+	return si.tablePlanStats.matrix(func(tps *TablePlanStats) int64 {
+		return tps.RowsReturned
+	})
 }
 
-func (si *SchemaInfo) getQueryErrorCount() map[string]map[string]int64 {
-	f := func(plan *ExecPlan) int64 {
-		_, _, _, errorCount := plan.Stats()
-		return errorCount
-	}
-	return si.getQueryStats(f)
+func (si *SchemaInfo) getQueryRowsAffected() map[string]map[string]int64 {
+	return si.tablePlanStats.matrix(func(tps *TablePlanStats) int64 {
+		return tps.RowsAffected
+	})
 }
 
-type queryStatsFunc func(*ExecPlan) int64
-
-func (si *SchemaInfo) getQueryStats(f queryStatsFunc) map[string]map[string]int64 {
-	keys := si.queries.Keys()
-	qstats := make(map[string]map[string]int64)
-	for _, v := range keys {
-		if plan := si.getQuery(v); plan != nil {
-			table := plan.TableName
-			if table == "" {
-				table = "Join"
-			}
-			planType := plan.PlanId.String()
-			data := f(plan)
-			queryStats, ok := qstats[table]
-			if !ok {
-				queryStats = make(map[string]int64)
-				qstats[table] = queryStats
-			}
-			queryStats[planType] += data
-		}
-	}
-	return qstats
+func (si *SchemaInfo) getQueryErrorCount() map[string]map[string]int64 {
+	return si.tablePlanStats.matrix(func(tps *TablePlanStats) int64 {
+		return tps.ErrorCount
+	})
 }
 
 type perQueryStats struct {
@@ -501,6 +485,8 @@ func (si *SchemaInfo) ServeHTTP(response http.ResponseWriter, request *http.Requ
 				} else {
 					response.Write(b)
 				}
+				queryCount, duration, rowCount, errorCount := plan.Stats()
+				response.Write([]byte(fmt.Sprintf("\nHits: %d, Time: %v, Rows: %d, Errors: %d", queryCount, duration, rowCount, errorCount)))
 				response.Write(([]byte)("\n\n"))
 			}
 		}
@@ -545,11 +531,85 @@ func (si *SchemaInfo) ServeHTTP(response http.ResponseWriter, request *http.Requ
 		}
 		fmt.Fprintf(response, "\"Totals\": {\"Hits\": %v, \"Absent\": %v, \"Misses\": %v, \"Invalidations\": %v}\n", totals.hits, totals.absent, totals.misses, totals.invalidations)
 		response.Write([]byte("}\n"))
+	} else if request.URL.Path == "/debug/schema" {
+		response.Header().Set("Content-Type", "application/json; charset=utf-8")
+		si.mu.Lock()
+		tables := make([]debugTable, 0, len(si.tables))
+		for _, ti := range si.tables {
+			tables = append(tables, newDebugTable(ti))
+		}
+		si.mu.Unlock()
+		sort.Sort(debugTables(tables))
+		if b, err := json.MarshalIndent(tables, "", "  "); err != nil {
+			response.Write([]byte(err.Error()))
+		} else {
+			response.Write(b)
+		}
 	} else {
 		response.WriteHeader(http.StatusNotFound)
 	}
 }
 
+var (
+	columnCategoryNames = map[int]string{
+		schema.CAT_OTHER:     "other",
+		schema.CAT_NUMBER:    "number",
+		schema.CAT_VARBINARY: "varbinary",
+	}
+	cacheTypeNames = map[int]string{
+		schema.CACHE_NONE: "none",
+		schema.CACHE_RW:   "read-write",
+		schema.CACHE_W:    "write",
+	}
+)
+
+// debugColumn and debugTable are the loaded schema of a table, as
+// displayed by /debug/schema.
+type debugColumn struct {
+	Name     string
+	Category string
+	IsAuto   bool
+	Default  sqltypes.Value
+}
+
+type debugTable struct {
+	Name      string
+	Columns   []debugColumn
+	PKColumns []string
+	Indexes   []*schema.Index
+	CacheType string
+	Sequence  bool
+}
+
+func newDebugTable(ti *TableInfo) debugTable {
+	dt := debugTable{
+		Name:      ti.Name,
+		Columns:   make([]debugColumn, len(ti.Columns)),
+		PKColumns: make([]string, len(ti.PKColumns)),
+		Indexes:   ti.Indexes,
+		CacheType: cacheTypeNames[ti.CacheType],
+		Sequence:  ti.Sequence != nil,
+	}
+	for i, col := range ti.Columns {
+		dt.Columns[i] = debugColumn{
+			Name:     col.Name,
+			Category: columnCategoryNames[col.Category],
+			IsAuto:   col.IsAuto,
+			Default:  col.Default,
+		}
+	}
+	for i := range ti.PKColumns {
+		dt.PKColumns[i] = ti.GetPKColumn(i).Name
+	}
+	return dt
+}
+
+type debugTables []debugTable
+
+func (dts debugTables) Len() int           { return len(dts) }
+func (dts debugTables) Less(i, j int) bool { return dts[i].Name < dts[j].Name }
+func (dts debugTables) Swap(i, j int)      { dts[i], dts[j] = dts[j], dts[i] }
+
 func applyFieldFilter(columnNumbers []int, input []mproto.Field) (output []mproto.Field) {
 	output = make([]mproto.Field, len(columnNumbers))
 	for colIndex, colPointer := range columnNumbers {
@@ -0,0 +1,38 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/schema"
+)
+
+func TestDebugTable(t *testing.T) {
+	ti := &TableInfo{Table: schema.NewTable("test_table")}
+	ti.AddColumn("id", "bigint(20)", sqltypes.Value{}, "auto_increment")
+	ti.AddColumn("name", "varbinary(64)", sqltypes.MakeString([]byte("none")), "")
+	if err := ti.SetPK([]string{"id"}); err != nil {
+		t.Fatalf("SetPK failed: %v", err)
+	}
+	ti.CacheType = schema.CACHE_RW
+
+	got := newDebugTable(ti)
+	want := debugTable{
+		Name: "test_table",
+		Columns: []debugColumn{
+			{Name: "id", Category: "number", IsAuto: true},
+			{Name: "name", Category: "varbinary", Default: sqltypes.MakeString([]byte("none"))},
+		},
+		PKColumns: []string{"id"},
+		Indexes:   ti.Indexes,
+		CacheType: "read-write",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newDebugTable:\ngot  %#v\nwant %#v", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"fmt"
+	"sync"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+)
+
+// SEQUENCE_COMMENT marks the tables that back a sequence. Such a
+// table lives in an unsharded keyspace, and has a single row with
+// id 0, the next value to hand out and the number of values to
+// reserve at a time:
+//
+//	create table user_seq(id int, next_id bigint, cache bigint, primary key(id)) comment 'vitess_sequence'
+//	insert into user_seq(id, next_id, cache) values(0, 1, 1000)
+//
+// The values are reserved in blocks of cache, so a restart of the
+// tablet leaves a gap in the sequence, but never reuses a value.
+const SEQUENCE_COMMENT = "vitess_sequence"
+
+// sequence is the block of values reserved from a sequence table
+// that have not been handed out yet: [next, last).
+type sequence struct {
+	mu         sync.Mutex
+	next, last int64
+}
+
+// GetSequenceValues returns the first of count consecutive values
+// of the sequence backed by the table name.
+func (qe *QueryEngine) GetSequenceValues(logStats *sqlQueryStats, name string, count int64) int64 {
+	qe.mu.RLock()
+	defer qe.mu.RUnlock()
+
+	if count <= 0 {
+		panic(NewTabletError(FAIL, "invalid number of sequence values: %v", count))
+	}
+	tableInfo := qe.schemaInfo.GetTable(name)
+	if tableInfo == nil || tableInfo.Sequence == nil {
+		panic(NewTabletError(FAIL, "%s is not a sequence", name))
+	}
+	seq := tableInfo.Sequence
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+	if seq.last-seq.next < count {
+		seq.next, seq.last = qe.reserveSequenceBlock(logStats, name, count)
+	}
+	first := seq.next
+	seq.next += count
+	return first
+}
+
+// reserveSequenceBlock moves the next_id of the sequence table name
+// forward by its cache size, or by count if it's bigger, and returns
+// the reserved block.
+func (qe *QueryEngine) reserveSequenceBlock(logStats *sqlQueryStats, name string, count int64) (next, last int64) {
+	conn := qe.txPool.Get()
+	transactionId, err := qe.activeTxPool.SafeBegin(conn)
+	if err != nil {
+		conn.Recycle()
+		panic(err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			qe.activeTxPool.Rollback(transactionId)
+		}
+	}()
+	execute := func(sql string) *mproto.QueryResult {
+		conn := qe.activeTxPool.Get(transactionId)
+		defer conn.Recycle()
+		result, err := qe.executeSql(logStats, conn, sql, false)
+		if err != nil {
+			panic(err)
+		}
+		return result
+	}
+
+	result := execute(fmt.Sprintf("select next_id, cache from %s where id = 0 for update", name))
+	if len(result.Rows) != 1 {
+		panic(NewTabletError(FAIL, "sequence %s has no row with id 0", name))
+	}
+	next, err = result.Rows[0][0].ParseInt64()
+	if err != nil {
+		panic(NewTabletError(FAIL, "invalid next_id for sequence %s: %v", name, err))
+	}
+	cache, err := result.Rows[0][1].ParseInt64()
+	if err != nil || cache <= 0 {
+		panic(NewTabletError(FAIL, "invalid cache for sequence %s: %v", name, result.Rows[0][1].String()))
+	}
+	if cache < count {
+		cache = count
+	}
+	last = next + cache
+	execute(fmt.Sprintf("update %s set next_id = %d where id = 0", name, last))
+
+	committed = true
+	if _, err := qe.activeTxPool.SafeCommit(transactionId); err != nil {
+		panic(err)
+	}
+	return next, last
+}
@@ -0,0 +1,60 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+// Queries that take longer than slowQueryThreshold are logged with
+// their plan, caller and bind variables. A zero threshold disables
+// the slow query log. They go through the regular log, so they are
+// rotated with it.
+var (
+	slowQueryThreshold      sync2.AtomicDuration
+	redactSlowQueryBindVars bool
+	slowQueryCount          = stats.NewInt("SlowQueryCount")
+)
+
+func init() {
+	stats.Publish("SlowQueryThreshold", stats.DurationFunc(slowQueryThreshold.Get))
+}
+
+// logSlowQuery logs the query if it took longer than the threshold.
+func (stats *sqlQueryStats) logSlowQuery() {
+	threshold := slowQueryThreshold.Get()
+	if threshold == 0 || stats.TotalTime() < threshold {
+		return
+	}
+	slowQueryCount.Add(1)
+	var bindVars string
+	if redactSlowQueryBindVars || sqlparser.SanitizationEnabled() {
+		bindVars = stats.RedactedBindVariables()
+	} else {
+		bindVars = stats.FmtBindVariables(false)
+	}
+	log.Warningf("Slow query (%v): method %v, caller %v (%v), plan %v, sql %q, bind variables %v, error %q",
+		stats.TotalTime(), stats.Method, stats.Username(), stats.RemoteAddr(), stats.PlanType, sqlparser.Sanitize(stats.OriginalSql), bindVars, stats.ErrorStr())
+}
+
+// RedactedBindVariables returns the map of bind variables as JSON,
+// with only the type of each value.
+func (stats *sqlQueryStats) RedactedBindVariables() string {
+	out := make(map[string]string, len(stats.BindVariables))
+	for k, v := range stats.BindVariables {
+		out[k] = fmt.Sprintf("%T", v)
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
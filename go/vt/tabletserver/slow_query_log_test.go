@@ -0,0 +1,35 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/rpcwrap/proto"
+)
+
+func TestSlowQueryLog(t *testing.T) {
+	stats := newSqlQueryStats("Execute", &proto.Context{RemoteAddr: "1.2.3.4", Username: "user"})
+	stats.BindVariables = map[string]interface{}{"id": 1, "name": "secret"}
+	if got, want := stats.RedactedBindVariables(), `{"id":"int","name":"string"}`; got != want {
+		t.Errorf("RedactedBindVariables: want %v, got %v", want, got)
+	}
+
+	defer slowQueryThreshold.Set(0)
+	slowQueryThreshold.Set(time.Hour)
+	before := slowQueryCount.Get()
+	stats.Send()
+	if slowQueryCount.Get() != before {
+		t.Errorf("fast query was logged as slow")
+	}
+
+	slowQueryThreshold.Set(time.Nanosecond)
+	stats.StartTime = time.Now().Add(-time.Second)
+	stats.Send()
+	if slowQueryCount.Get() != before+1 {
+		t.Errorf("slow query was not logged")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/tb"
 	"github.com/youtube/vitess/go/vt/dbconfigs"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 	"github.com/youtube/vitess/go/vt/tabletserver/proto"
 )
 
@@ -64,8 +65,23 @@ type SqlQuery struct {
 	qe        *QueryEngine
 	sessionId int64
 	dbconfig  dbconfigs.DBConfig
+
+	// the most recent state transitions, for the status page
+	transitionsMu sync.Mutex
+	transitions   []stateTransition
+}
+
+// stateTransition records one state change of the query service.
+type stateTransition struct {
+	From string
+	To   string
+	Time time.Time
 }
 
+// maxStateTransitions is the number of transitions kept for the
+// status page.
+const maxStateTransitions = 10
+
 func NewSqlQuery(config Config) *SqlQuery {
 	sq := &SqlQuery{}
 	sq.qe = NewQueryEngine(config)
@@ -82,11 +98,32 @@ func (sq *SqlQuery) GetState() string {
 }
 
 func (sq *SqlQuery) setState(state int64) {
-	log.Infof("SqlQuery state: %v -> %v", stateName[sq.state.Get()], stateName[state])
+	from := stateName[sq.state.Get()]
+	log.Infof("SqlQuery state: %v -> %v", from, stateName[state])
 	sq.state.Set(state)
+
+	sq.transitionsMu.Lock()
+	defer sq.transitionsMu.Unlock()
+	sq.transitions = append(sq.transitions, stateTransition{from, stateName[state], time.Now()})
+	if len(sq.transitions) > maxStateTransitions {
+		sq.transitions = sq.transitions[len(sq.transitions)-maxStateTransitions:]
+	}
 }
 
-func (sq *SqlQuery) allowQueries(dbconfig dbconfigs.DBConfig, schemaOverrides []SchemaOverride, qrs *QueryRules) {
+// stateTransitions returns the most recent state transitions, the
+// latest first.
+func (sq *SqlQuery) stateTransitions() []stateTransition {
+	sq.transitionsMu.Lock()
+	defer sq.transitionsMu.Unlock()
+	result := make([]stateTransition, len(sq.transitions))
+	for i, t := range sq.transitions {
+		result[len(sq.transitions)-1-i] = t
+	}
+	return result
+}
+
+func (sq *SqlQuery) allowQueries(dbcfgs dbconfigs.DBConfigs, schemaOverrides []SchemaOverride, qrs *QueryRules) {
+	dbconfig := dbcfgs.App
 	sq.statemu.Lock()
 	v := sq.state.Get()
 	switch v {
@@ -104,7 +141,7 @@ func (sq *SqlQuery) allowQueries(dbconfig dbconfigs.DBConfig, schemaOverrides []
 	// Try connecting. disallowQueries can change the state to ABORT during this time.
 	waitTime := time.Second
 	for {
-		c, err := mysql.Connect(dbconfig.MysqlParams())
+		c, err := dbconfigs.MysqlConnect(dbconfig.MysqlParams())
 		if err == nil {
 			c.Close()
 			break
@@ -142,7 +179,8 @@ func (sq *SqlQuery) allowQueries(dbconfig dbconfigs.DBConfig, schemaOverrides []
 		sq.setState(SERVING)
 	}()
 
-	sq.qe.Open(dbconfig, schemaOverrides, qrs)
+	sq.qe.Open(dbcfgs, schemaOverrides, qrs)
+	sq.qe.Warmup()
 	sq.dbconfig = dbconfig
 	sq.sessionId = Rand()
 	log.Infof("Session id: %d", sq.sessionId)
@@ -167,7 +205,9 @@ func (sq *SqlQuery) disallowQueries() {
 	}()
 
 	log.Infof("Stopping query service: %d", sq.sessionId)
+	start := time.Now()
 	sq.qe.Close()
+	log.Infof("Query service drained in %v", time.Now().Sub(start))
 	sq.sessionId = 0
 	sq.dbconfig = dbconfigs.DBConfig{}
 }
@@ -220,6 +260,8 @@ func (sq *SqlQuery) Begin(context *rpcproto.Context, session *proto.Session, txI
 	return nil
 }
 
+// Commit commits a transaction. With -queryserver-config-report-commit-group-id,
+// the reply is the replication group id of mysqld after the commit.
 func (sq *SqlQuery) Commit(context *rpcproto.Context, session *proto.Session, noOutput *string) (err error) {
 	logStats := newSqlQueryStats("Commit", context)
 	logStats.OriginalSql = "commit"
@@ -227,6 +269,7 @@ func (sq *SqlQuery) Commit(context *rpcproto.Context, session *proto.Session, no
 	sq.checkState(session.SessionId, true)
 
 	sq.qe.Commit(logStats, session.TransactionId)
+	*noOutput = sq.qe.CommitGroupId()
 	return nil
 }
 
@@ -268,15 +311,27 @@ func (sq *SqlQuery) invalidateForDDL(ddlInvalidate *proto.DDLInvalidate) {
 	sq.qe.InvalidateForDDL(ddlInvalidate)
 }
 
+// sanitizedQuery formats query for errors and logs, with its values
+// removed according to -query-sanitization.
+func sanitizedQuery(query *proto.Query) string {
+	if !sqlparser.SanitizationEnabled() {
+		return fmt.Sprintf("%v", query)
+	}
+	sanitized := *query
+	sanitized.Sql = sqlparser.Sanitize(query.Sql)
+	sanitized.BindVariables = sqlparser.SanitizeBindVariables(query.BindVariables)
+	return fmt.Sprintf("%v", &sanitized)
+}
+
 func handleExecError(query *proto.Query, err *error, logStats *sqlQueryStats) {
 	if logStats != nil {
-		logStats.Send()
+		defer logStats.sendWithError(err)
 	}
 	if x := recover(); x != nil {
 		terr, ok := x.(*TabletError)
 		if !ok {
-			log.Errorf("Uncaught panic for %v:\n%v\n%s", query, x, tb.Stack(4))
-			*err = NewTabletError(FAIL, "%v: uncaught panic for %v", x, query)
+			log.Errorf("Uncaught panic for %v:\n%v\n%s", sanitizedQuery(query), x, tb.Stack(4))
+			*err = NewTabletError(FAIL, "%v: uncaught panic for %v", x, sanitizedQuery(query))
 			errorStats.Add("Panic", 1)
 			return
 		}
@@ -286,7 +341,7 @@ func handleExecError(query *proto.Query, err *error, logStats *sqlQueryStats) {
 		if terr.ErrorType == RETRY || terr.ErrorType == TX_POOL_FULL || terr.SqlError == mysql.DUP_ENTRY {
 			return
 		}
-		log.Errorf("%s: %v", terr.Message, query)
+		log.Errorf("%s: %v", terr.Message, sanitizedQuery(query))
 	}
 }
 
@@ -390,6 +445,101 @@ func (sq *SqlQuery) ExecuteBatch(context *rpcproto.Context, queryList *proto.Que
 	return nil
 }
 
+// GetSequenceValues reserves req.Count consecutive values from a
+// sequence table, and returns the first one.
+func (sq *SqlQuery) GetSequenceValues(context *rpcproto.Context, req *proto.SequenceRequest, reply *proto.SequenceValues) (err error) {
+	logStats := newSqlQueryStats("GetSequenceValues", context)
+	logStats.OriginalSql = req.Sequence
+	defer handleError(&err, logStats)
+	sq.checkState(req.SessionId, false)
+
+	reply.First = sq.qe.GetSequenceValues(logStats, req.Sequence, req.Count)
+	return nil
+}
+
+// Prepare prepares the transaction req.TransactionId as the
+// distributed transaction req.Dtid, see twopc.go.
+func (sq *SqlQuery) Prepare(context *rpcproto.Context, req *proto.PreparedTransaction, noOutput *string) (err error) {
+	logStats := newSqlQueryStats("Prepare", context)
+	logStats.OriginalSql = "prepare"
+	defer handleError(&err, logStats)
+	sq.checkState(req.SessionId, true)
+
+	sq.qe.Prepare(logStats, req.TransactionId, req.Dtid)
+	return nil
+}
+
+// CommitPrepared commits the prepared transaction req.Dtid. The reply
+// is the same as Commit.
+func (sq *SqlQuery) CommitPrepared(context *rpcproto.Context, req *proto.PreparedTransaction, noOutput *string) (err error) {
+	logStats := newSqlQueryStats("CommitPrepared", context)
+	logStats.OriginalSql = "commit prepared"
+	defer handleError(&err, logStats)
+	sq.checkState(req.SessionId, true)
+
+	sq.qe.CommitPrepared(logStats, req.Dtid)
+	*noOutput = sq.qe.CommitGroupId()
+	return nil
+}
+
+// RollbackPrepared rolls back the prepared transaction req.Dtid, or
+// the transaction req.TransactionId if it was not prepared.
+func (sq *SqlQuery) RollbackPrepared(context *rpcproto.Context, req *proto.PreparedTransaction, noOutput *string) (err error) {
+	logStats := newSqlQueryStats("RollbackPrepared", context)
+	logStats.OriginalSql = "rollback prepared"
+	defer handleError(&err, logStats)
+	sq.checkState(req.SessionId, true)
+
+	sq.qe.RollbackPrepared(logStats, req.Dtid, req.TransactionId)
+	return nil
+}
+
+// CreateTransaction records the metadata of a new distributed
+// transaction, see dtx.go.
+func (sq *SqlQuery) CreateTransaction(context *rpcproto.Context, req *proto.DistributedTransaction, noOutput *string) (err error) {
+	logStats := newSqlQueryStats("CreateTransaction", context)
+	logStats.OriginalSql = req.Dtid
+	defer handleError(&err, logStats)
+	sq.checkState(req.SessionId, false)
+
+	sq.qe.CreateTransaction(logStats, req)
+	return nil
+}
+
+// SetTransactionState changes the state of a distributed transaction.
+func (sq *SqlQuery) SetTransactionState(context *rpcproto.Context, req *proto.DtxStateChange, noOutput *string) (err error) {
+	logStats := newSqlQueryStats("SetTransactionState", context)
+	logStats.OriginalSql = req.Dtid
+	defer handleError(&err, logStats)
+	sq.checkState(req.SessionId, true)
+
+	sq.qe.SetTransactionState(logStats, req)
+	return nil
+}
+
+// ConcludeTransaction deletes the metadata of a distributed
+// transaction.
+func (sq *SqlQuery) ConcludeTransaction(context *rpcproto.Context, req *proto.PreparedTransaction, noOutput *string) (err error) {
+	logStats := newSqlQueryStats("ConcludeTransaction", context)
+	logStats.OriginalSql = req.Dtid
+	defer handleError(&err, logStats)
+	sq.checkState(req.SessionId, true)
+
+	sq.qe.ConcludeTransaction(logStats, req.Dtid)
+	return nil
+}
+
+// ReadTransactions returns the metadata of distributed transactions.
+func (sq *SqlQuery) ReadTransactions(context *rpcproto.Context, req *proto.DtxQuery, reply *proto.DistributedTransactionList) (err error) {
+	logStats := newSqlQueryStats("ReadTransactions", context)
+	logStats.OriginalSql = req.Dtid
+	defer handleError(&err, logStats)
+	sq.checkState(req.SessionId, false)
+
+	reply.List = sq.qe.ReadTransactions(logStats, req.Dtid, time.Duration(req.AbandonAge))
+	return nil
+}
+
 func (sq *SqlQuery) statsJSON() string {
 	buf := bytes.NewBuffer(make([]byte, 0, 128))
 	fmt.Fprintf(buf, "{")
@@ -400,6 +550,7 @@ func (sq *SqlQuery) statsJSON() string {
 	fmt.Fprintf(buf, "\n \"ConnPool\": %v,", sq.qe.connPool.StatsJSON())
 	fmt.Fprintf(buf, "\n \"StreamConnPool\": %v,", sq.qe.streamConnPool.StatsJSON())
 	fmt.Fprintf(buf, "\n \"TxPool\": %v,", sq.qe.txPool.StatsJSON())
+	fmt.Fprintf(buf, "\n \"DbaPool\": %v,", sq.qe.dbaPool.StatsJSON())
 	fmt.Fprintf(buf, "\n \"ActiveTxPool\": %v,", sq.qe.activeTxPool.StatsJSON())
 	fmt.Fprintf(buf, "\n \"ActivePool\": %v,", sq.qe.activePool.StatsJSON())
 	fmt.Fprintf(buf, "\n \"MaxResultSize\": %v,", sq.qe.maxResultSize.Get())
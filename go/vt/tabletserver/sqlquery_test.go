@@ -0,0 +1,44 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestStateTransitions(t *testing.T) {
+	sq := &SqlQuery{}
+	sq.setState(CONNECTING)
+	sq.setState(INITIALIZING)
+	sq.setState(SERVING)
+	for i := 0; i < maxStateTransitions; i++ {
+		sq.setState(SHUTTING_DOWN)
+		sq.setState(NOT_SERVING)
+	}
+	sq.setState(CONNECTING)
+
+	transitions := sq.stateTransitions()
+	if len(transitions) != maxStateTransitions {
+		t.Fatalf("want %v transitions, got %v", maxStateTransitions, len(transitions))
+	}
+	if transitions[0].From != "NOT_SERVING" || transitions[0].To != "CONNECTING" {
+		t.Errorf("latest transition should be first: %#v", transitions[0])
+	}
+	if transitions[1].Time.After(transitions[0].Time) {
+		t.Errorf("transitions are not sorted: %v", transitions)
+	}
+
+	buf := &bytes.Buffer{}
+	tmpl := template.Must(template.New("status").Parse(queryServiceStatusHTML))
+	if err := tmpl.Execute(buf, map[string]interface{}{"State": sq.GetState(), "Transitions": transitions}); err != nil {
+		t.Fatalf("cannot render status: %v", err)
+	}
+	if !strings.Contains(buf.String(), "<td>NOT_SERVING</td><td>CONNECTING</td>") {
+		t.Errorf("transitions missing from status: %v", buf.String())
+	}
+}
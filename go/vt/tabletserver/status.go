@@ -0,0 +1,45 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"github.com/youtube/vitess/go/vt/servenv"
+)
+
+const queryServiceStatusHTML = `<table>
+  <tr><td>State</td><td>{{.State}}{{with .Transitions}} since {{(index . 0).Time}}{{end}}</td></tr>
+  <tr><td>Errors</td><td>{{range $k, $v := .Errors}}{{$k}}: {{$v}} {{end}}</td></tr>
+</table>
+{{with .Transitions}}<p>Recent state transitions:</p>
+<table>
+  <tr><th>Time</th><th>From</th><th>To</th></tr>
+  {{range .}}<tr><td>{{.Time}}</td><td>{{.From}}</td><td>{{.To}}</td></tr>
+  {{end}}
+</table>{{end}}`
+
+// addStatusParts adds the query service section and links to the
+// status page.
+func addStatusParts() {
+	servenv.AddStatusPart("Query Service", queryServiceStatusHTML, func() interface{} {
+		data := map[string]interface{}{
+			"State":       SqlQueryRpcService.GetState(),
+			"Transitions": SqlQueryRpcService.stateTransitions(),
+		}
+		if errorStats != nil {
+			data["Errors"] = errorStats.Counts()
+		}
+		return data
+	})
+	servenv.AddStatusLink("Query log", *queryLogHandler)
+	servenv.AddStatusLink("Query errors log", *queryLogHandler+"?errors=true")
+	servenv.AddStatusLink("Transaction log", *txLogHandler)
+	servenv.AddStatusLink("Query stats by table and plan", "/queryz")
+	servenv.AddStatusLink("Query plans", "/debug/query_plans")
+	servenv.AddStatusLink("Query stats", "/debug/query_stats")
+	servenv.AddStatusLink("Table stats", "/debug/table_stats")
+	servenv.AddStatusLink("Schema", "/debug/schema")
+	servenv.AddStatusLink("Consolidations", "/debug/consolidations")
+	servenv.AddStatusLink("Health", "/debug/health")
+}
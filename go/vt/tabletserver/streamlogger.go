@@ -15,6 +15,8 @@ import (
 	"github.com/youtube/vitess/go/rpcwrap/proto"
 	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/streamlog"
+	"github.com/youtube/vitess/go/trace"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 )
 
 var SqlQueryLogger = streamlog.New("SqlQuery", 50)
@@ -43,7 +45,10 @@ type sqlQueryStats struct {
 	CacheInvalidations   int64
 	QuerySources         byte
 	Rows                 [][]sqltypes.Value
+	Error                error
 	context              *proto.Context
+	span                 *trace.Span
+	directives           sqlparser.Directives
 }
 
 func newSqlQueryStats(methodName string, context *proto.Context) *sqlQueryStats {
@@ -53,9 +58,18 @@ func newSqlQueryStats(methodName string, context *proto.Context) *sqlQueryStats
 
 func (stats *sqlQueryStats) Send() {
 	stats.EndTime = time.Now()
+	stats.logSlowQuery()
 	SqlQueryLogger.Send(stats)
 }
 
+// sendWithError records the error the query returned, if any, and
+// sends the stats. It is meant to be deferred after the query panic
+// has been recovered into err.
+func (stats *sqlQueryStats) sendWithError(err *error) {
+	stats.Error = *err
+	stats.Send()
+}
+
 func (stats *sqlQueryStats) AddRewrittenSql(sql string) {
 	stats.rewrittenSqls = append(stats.rewrittenSqls, sql)
 }
@@ -67,6 +81,13 @@ func (stats *sqlQueryStats) TotalTime() time.Duration {
 // RewrittenSql returns a semicolon separated list of SQL statements
 // that were executed.
 func (stats *sqlQueryStats) RewrittenSql() string {
+	if sqlparser.SanitizationEnabled() {
+		sqls := make([]string, len(stats.rewrittenSqls))
+		for i, sql := range stats.rewrittenSqls {
+			sqls[i] = sqlparser.Sanitize(sql)
+		}
+		return strings.Join(sqls, "; ")
+	}
 	return strings.Join(stats.rewrittenSqls, "; ")
 }
 
@@ -91,7 +112,9 @@ func (stats *sqlQueryStats) SizeOfResponse() int {
 // and length.
 func (stats *sqlQueryStats) FmtBindVariables(full bool) string {
 	var out map[string]interface{}
-	if full {
+	if sqlparser.SanitizationEnabled() {
+		out = sqlparser.SanitizeBindVariables(stats.BindVariables)
+	} else if full {
 		out = stats.BindVariables
 	} else {
 		// NOTE(szopa): I am getting rid of potentially large bind
@@ -148,11 +171,24 @@ func (log *sqlQueryStats) Username() string {
 	return log.context.Username
 }
 
-// String returns a tab separated list of logged fields.
+// ErrorStr returns the error message, or an empty string if the
+// query succeeded.
+func (log *sqlQueryStats) ErrorStr() string {
+	if log.Error == nil {
+		return ""
+	}
+	return log.Error.Error()
+}
+
+// Format returns a tab separated list of logged fields. If the
+// 'errors' parameter is set, successful queries are not returned.
 func (log *sqlQueryStats) Format(params url.Values) string {
+	if _, errorsOnly := params["errors"]; errorsOnly && log.Error == nil {
+		return ""
+	}
 	_, fullBindParams := params["full"]
 	return fmt.Sprintf(
-		"%v\t%v\t%v\t%v\t%v\t%v\t%v\t%q\t%v\t%v\t%q\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t\n",
+		"%v\t%v\t%v\t%v\t%v\t%v\t%v\t%q\t%v\t%v\t%q\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%q\t\n",
 		log.Method,
 		log.RemoteAddr(),
 		log.Username(),
@@ -160,7 +196,7 @@ func (log *sqlQueryStats) Format(params url.Values) string {
 		log.EndTime,
 		log.TotalTime().Seconds(),
 		log.PlanType,
-		log.OriginalSql,
+		sqlparser.Sanitize(log.OriginalSql),
 		log.FmtBindVariables(fullBindParams),
 		log.NumberOfQueries,
 		log.RewrittenSql(),
@@ -171,5 +207,8 @@ func (log *sqlQueryStats) Format(params url.Values) string {
 		log.CacheHits,
 		log.CacheMisses,
 		log.CacheAbsent,
-		log.CacheInvalidations)
+		log.CacheInvalidations,
+		len(log.BindVariables),
+		log.RowsAffected,
+		log.ErrorStr())
 }
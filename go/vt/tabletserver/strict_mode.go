@@ -0,0 +1,146 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+// The checks of strict mode. Tables can be exempted from each of
+// them with -strict-mode-overrides.
+const (
+	// STRICT_UNBOUNDED_DML rejects updates and deletes whose where
+	// clause doesn't restrict the first primary key column.
+	STRICT_UNBOUNDED_DML = "UNBOUNDED_DML"
+
+	// STRICT_UNLIMITED_SELECT rejects selects that are not primary
+	// key lookups and have no limit, or a limit above
+	// -strict-mode-select-limit.
+	STRICT_UNLIMITED_SELECT = "UNLIMITED_SELECT"
+
+	// STRICT_DDL rejects DDLs sent through the query service.
+	// Schema changes should go through vtctl.
+	STRICT_DDL = "DDL"
+)
+
+var (
+	strictMode              = flag.Bool("strict-mode", false, "reject unbounded updates and deletes, unlimited selects and DDLs, see -strict-mode-overrides")
+	strictModeSelectLimit   = flag.Int64("strict-mode-select-limit", 10000, "the largest limit allowed for selects in strict mode")
+	strictModeOverridesFile = flag.String("strict-mode-overrides", "", "JSON file mapping tables to the strict mode checks they are exempt from: UNBOUNDED_DML, UNLIMITED_SELECT or DDL. A table name ending with '*' is a prefix")
+	strictModeRejections    = stats.NewCounters("StrictModeRejections")
+)
+
+// StrictModeOverrides maps tables to the strict mode checks they
+// are exempt from. A table name ending with '*' is a prefix.
+type StrictModeOverrides map[string][]string
+
+// strictModeOverrides are the overrides in use, nil if there are none.
+var strictModeOverrides StrictModeOverrides
+
+// LoadStrictModeOverrides loads the overrides from -strict-mode-overrides.
+func LoadStrictModeOverrides() {
+	if *strictModeOverridesFile == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(*strictModeOverridesFile)
+	if err != nil {
+		log.Fatalf("cannot read strict mode overrides: %v", err)
+	}
+	if err := json.Unmarshal(data, &strictModeOverrides); err != nil {
+		log.Fatalf("cannot parse strict mode overrides %v: %v", *strictModeOverridesFile, err)
+	}
+}
+
+// exempts returns true if table is exempt from check.
+func (smo StrictModeOverrides) exempts(table, check string) bool {
+	for t, checks := range smo {
+		if t != table && !(strings.HasSuffix(t, "*") && strings.HasPrefix(table, t[:len(t)-1])) {
+			continue
+		}
+		for _, c := range checks {
+			if c == check {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// check returns an error if the plan fails one of the strict mode
+// checks its table is not exempt from.
+func (smo StrictModeOverrides) check(plan *ExecPlan, sql string, bindVars map[string]interface{}, selectLimit int64) error {
+	var check, table string
+	switch {
+	case plan.PlanId == sqlparser.PLAN_DDL:
+		check, table = STRICT_DDL, sqlparser.DDLParse(sql).TableName
+	case plan.PlanId == sqlparser.PLAN_PK_EQUAL || plan.PlanId == sqlparser.PLAN_PK_IN:
+		return nil
+	case plan.PlanId.IsSelect():
+		// dual has a single row
+		if plan.TableName == "dual" || withinLimit(plan.Limit, bindVars, selectLimit) {
+			return nil
+		}
+		check, table = STRICT_UNLIMITED_SELECT, plan.TableName
+	case plan.PlanId == sqlparser.PLAN_INSERT_PK || plan.PlanId == sqlparser.PLAN_INSERT_SUBQUERY:
+		return nil
+	case plan.PlanId == sqlparser.PLAN_PASS_DML || plan.PlanId == sqlparser.PLAN_DML_SUBQUERY:
+		// inserts can be pass through DMLs too
+		if plan.WhereOnPK || plan.PassInsert {
+			return nil
+		}
+		check, table = STRICT_UNBOUNDED_DML, plan.TableName
+	default:
+		return nil
+	}
+	if smo.exempts(table, check) {
+		return nil
+	}
+	strictModeRejections.Add(check, 1)
+	return fmt.Errorf("strict mode: %v not allowed on table %v", check, table)
+}
+
+// withinLimit returns true if limit, as found in a plan, is not
+// above max.
+func withinLimit(limit interface{}, bindVars map[string]interface{}, max int64) bool {
+	var value sqltypes.Value
+	switch v := limit.(type) {
+	case sqltypes.Value:
+		value = v
+	case string:
+		bound, ok := bindVars[v[1:]]
+		if !ok {
+			return false
+		}
+		var err error
+		if value, err = sqltypes.BuildValue(bound); err != nil {
+			return false
+		}
+	default:
+		return false
+	}
+	n, err := strconv.ParseInt(value.String(), 10, 64)
+	return err == nil && n <= max
+}
+
+// checkStrictMode panics with a TabletError if strict mode is on
+// and the plan fails one of its checks.
+func checkStrictMode(plan *ExecPlan, sql string, bindVars map[string]interface{}) {
+	if !*strictMode {
+		return
+	}
+	if err := strictModeOverrides.check(plan, sql, bindVars, *strictModeSelectLimit); err != nil {
+		panic(NewTabletError(FAIL, "%v", err))
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+func TestStrictMode(t *testing.T) {
+	smo := StrictModeOverrides{
+		"big":    {STRICT_UNLIMITED_SELECT},
+		"tmp_*":  {STRICT_DDL, STRICT_UNBOUNDED_DML},
+		"events": {STRICT_UNBOUNDED_DML},
+	}
+	plan := func(sql string, table string, planId sqlparser.PlanType, limit interface{}, whereOnPK bool) *ExecPlan {
+		return &ExecPlan{ExecPlan: &sqlparser.ExecPlan{
+			TableName: table,
+			PlanId:    planId,
+			FullQuery: &sqlparser.ParsedQuery{Query: sql},
+			Limit:     limit,
+			WhereOnPK: whereOnPK,
+		}}
+	}
+	passInsert := plan("insert into user values (1)", "user", sqlparser.PLAN_PASS_DML, nil, false)
+	passInsert.PassInsert = true
+	bindVars := map[string]interface{}{"small": 10, "large": 100000}
+
+	cases := []struct {
+		sql     string
+		plan    *ExecPlan
+		allowed bool
+	}{
+		{"select * from user where id = 1", plan("select * from user where id = 1", "user", sqlparser.PLAN_PK_EQUAL, nil, false), true},
+		{"select * from user", plan("select * from user", "user", sqlparser.PLAN_PASS_SELECT, nil, false), false},
+		{"select * from user limit 10", plan("select * from user limit 10", "user", sqlparser.PLAN_PASS_SELECT, sqltypes.MakeNumeric([]byte("10")), false), true},
+		{"select * from user limit 20000", plan("select * from user limit 20000", "user", sqlparser.PLAN_PASS_SELECT, sqltypes.MakeNumeric([]byte("20000")), false), false},
+		{"select * from user limit :small", plan("select * from user limit :small", "user", sqlparser.PLAN_SELECT_SUBQUERY, ":small", false), true},
+		{"select * from user limit :large", plan("select * from user limit :large", "user", sqlparser.PLAN_PASS_SELECT, ":large", false), false},
+		{"select * from big", plan("select * from big", "big", sqlparser.PLAN_PASS_SELECT, nil, false), true},
+		{"select 1 from dual", plan("select 1 from dual", "dual", sqlparser.PLAN_PASS_SELECT, nil, false), true},
+		{"delete from user", plan("delete from user", "user", sqlparser.PLAN_DML_SUBQUERY, nil, false), false},
+		{"delete from user where id > 1", plan("delete from user where id > 1", "user", sqlparser.PLAN_DML_SUBQUERY, nil, true), true},
+		{"delete from user where id = 1", plan("delete from user where id = 1", "user", sqlparser.PLAN_DML_PK, nil, true), true},
+		{"update events set a = 1", plan("update events set a = 1", "events", sqlparser.PLAN_PASS_DML, nil, false), true},
+		{"update tmp_1 set a = 1", plan("update tmp_1 set a = 1", "tmp_1", sqlparser.PLAN_PASS_DML, nil, false), true},
+		{"insert into user values (1)", passInsert, true},
+		{"insert into user(id) values (1)", plan("insert into user(id) values (1)", "user", sqlparser.PLAN_INSERT_PK, nil, false), true},
+		{"insert into user(id) select id from other", plan("insert into user(id) select id from other", "user", sqlparser.PLAN_INSERT_SUBQUERY, nil, false), true},
+		// a pass through DML is only exempt as an insert by its plan
+		{"/* insert */ update user set a = 1", plan("/* insert */ update user set a = 1", "user", sqlparser.PLAN_PASS_DML, nil, false), false},
+		{"alter table user add column a int", plan("", "", sqlparser.PLAN_DDL, nil, false), false},
+		{"alter table tmp_user add column a int", plan("", "", sqlparser.PLAN_DDL, nil, false), true},
+	}
+	before := strictModeRejections.Counts()
+	for _, c := range cases {
+		err := smo.check(c.plan, c.sql, bindVars, 10000)
+		if (err == nil) != c.allowed {
+			t.Errorf("check(%v): want allowed=%v, got %v", c.sql, c.allowed, err)
+		}
+	}
+	after := strictModeRejections.Counts()
+	for check, want := range map[string]int64{STRICT_UNLIMITED_SELECT: 3, STRICT_UNBOUNDED_DML: 2, STRICT_DDL: 1} {
+		if got := after[check] - before[check]; got != want {
+			t.Errorf("want %v rejections of %v, got %v", want, check, got)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	log "github.com/golang/glog"
+	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+	"github.com/youtube/vitess/go/vt/acl"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+var tableAclConfig = flag.String("table-acl-config", "", "JSON file listing the roles allowed to read, write and alter tables, only enforced with -role-mapping")
+
+// TableAclEntry lists the roles allowed to access a group of
+// tables. A table name ending with '*' is a prefix.
+type TableAclEntry struct {
+	Tables  []string
+	Readers []string
+	Writers []string
+	Admins  []string
+}
+
+// TableAcl is the list of table ACL entries. The first entry that
+// matches a table is used. Tables that don't match any entry are
+// not restricted.
+type TableAcl []TableAclEntry
+
+// tableAcl is the table ACL in use, nil if there is none.
+var tableAcl TableAcl
+
+// LoadTableAcl loads the table ACL from -table-acl-config.
+func LoadTableAcl() {
+	if *tableAclConfig == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(*tableAclConfig)
+	if err != nil {
+		log.Fatalf("cannot read table ACL config: %v", err)
+	}
+	if err := json.Unmarshal(data, &tableAcl); err != nil {
+		log.Fatalf("cannot parse table ACL config %v: %v", *tableAclConfig, err)
+	}
+}
+
+func (ta TableAcl) entry(table string) *TableAclEntry {
+	for i, e := range ta {
+		for _, t := range e.Tables {
+			if t == table || (strings.HasSuffix(t, "*") && strings.HasPrefix(table, t[:len(t)-1])) {
+				return &ta[i]
+			}
+		}
+	}
+	return nil
+}
+
+// check returns an error if the caller is not allowed to run the plan.
+func (ta TableAcl) check(context *rpcproto.Context, plan *ExecPlan) error {
+	if plan.TableName == "" || plan.PlanId == sqlparser.PLAN_SET {
+		return nil
+	}
+	e := ta.entry(plan.TableName)
+	if e == nil {
+		return nil
+	}
+	var allowed []string
+	var access string
+	switch {
+	case plan.PlanId.IsSelect():
+		allowed, access = e.Readers, "read"
+	case plan.PlanId == sqlparser.PLAN_DDL:
+		allowed, access = e.Admins, "alter"
+	default:
+		allowed, access = e.Writers, "write"
+	}
+	role, ok := acl.RoleFromContext(context)
+	if !ok {
+		return fmt.Errorf("table acl error: caller has no role, cannot %v table %v", access, plan.TableName)
+	}
+	if !acl.Allowed(role, allowed) {
+		return fmt.Errorf("table acl error: role %v cannot %v table %v", role, access, plan.TableName)
+	}
+	return nil
+}
+
+// checkTableAcl panics with a TabletError if roles are enforced and
+// the caller is not allowed to run the plan.
+func checkTableAcl(logStats *sqlQueryStats, plan *ExecPlan) {
+	if tableAcl == nil || !acl.Enabled() {
+		return
+	}
+	if err := tableAcl.check(logStats.context, plan); err != nil {
+		panic(NewTabletError(FAIL, "%v", err))
+	}
+}
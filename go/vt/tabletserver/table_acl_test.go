@@ -0,0 +1,48 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+
+	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+	"github.com/youtube/vitess/go/vt/acl"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+func TestTableAcl(t *testing.T) {
+	defer acl.SetMapping(nil)
+	acl.SetMapping(map[string]string{"ou:frontend": acl.APP, "ou:dbas": acl.DBA})
+	ta := TableAcl{
+		{Tables: []string{"user", "user_*"}, Readers: []string{acl.APP, acl.DBA}, Writers: []string{acl.APP}, Admins: []string{acl.DBA}},
+	}
+	app := &rpcproto.Context{CertCommonName: "web1", CertOrganizationalUnits: []string{"frontend"}}
+	dba := &rpcproto.Context{CertCommonName: "me", CertOrganizationalUnits: []string{"dbas"}}
+	nobody := &rpcproto.Context{RemoteAddr: "1.2.3.4:5"}
+	plan := func(table string, planId sqlparser.PlanType) *ExecPlan {
+		return &ExecPlan{ExecPlan: &sqlparser.ExecPlan{TableName: table, PlanId: planId}}
+	}
+
+	cases := []struct {
+		context *rpcproto.Context
+		plan    *ExecPlan
+		allowed bool
+	}{
+		{app, plan("user", sqlparser.PLAN_PK_EQUAL), true},
+		{app, plan("user_extra", sqlparser.PLAN_DML_PK), true},
+		{app, plan("user", sqlparser.PLAN_DDL), false},
+		{dba, plan("user", sqlparser.PLAN_DDL), true},
+		{dba, plan("user", sqlparser.PLAN_INSERT_PK), false},
+		{nobody, plan("user", sqlparser.PLAN_PASS_SELECT), false},
+		{nobody, plan("other", sqlparser.PLAN_PASS_SELECT), true},
+		{nobody, plan("", sqlparser.PLAN_PASS_SELECT), true},
+	}
+	for _, c := range cases {
+		err := ta.check(c.context, c.plan)
+		if (err == nil) != c.allowed {
+			t.Errorf("check(%v, %v %v): want allowed=%v, got %v", c.context, c.plan.TableName, c.plan.PlanId, c.allowed, err)
+		}
+	}
+}
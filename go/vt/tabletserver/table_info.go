@@ -18,6 +18,8 @@ import (
 type TableInfo struct {
 	*schema.Table
 	Cache *RowCache
+	// Sequence is set for the sequence tables, see sequence.go.
+	Sequence *sequence
 	// stats updated by sqlquery.go
 	hits, absent, misses, invalidations sync2.AtomicInt64
 }
@@ -27,6 +29,12 @@ func NewTableInfo(conn PoolConnection, tableName string, tableType string, creat
 		return &TableInfo{Table: schema.NewTable(tableName)}
 	}
 	ti = loadTableInfo(conn, tableName)
+	if ti == nil {
+		return nil
+	}
+	if strings.Contains(comment, SEQUENCE_COMMENT) {
+		ti.Sequence = &sequence{}
+	}
 	ti.initRowCache(conn, tableType, createTime, comment, cachePool)
 	return ti
 }
@@ -133,6 +141,11 @@ func (ti *TableInfo) initRowCache(conn PoolConnection, tableType string, createT
 		return
 	}
 
+	if ti.Sequence != nil {
+		log.Infof("%s is a sequence. Will not be cached.", ti.Name)
+		return
+	}
+
 	if tableType == "VIEW" {
 		log.Infof("%s is a view. Will not be cached.", ti.Name)
 		return
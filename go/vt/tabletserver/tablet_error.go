@@ -10,6 +10,7 @@ import (
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/mysql"
 	"github.com/youtube/vitess/go/tb"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 )
 
 const (
@@ -36,6 +37,11 @@ func NewTabletError(errorType int, format string, args ...interface{}) *TabletEr
 }
 
 func NewTabletErrorSql(errorType int, err error) *TabletError {
+	if sqlErr, ok := err.(*mysql.SqlError); ok && sqlErr.Query != "" && sqlparser.SanitizationEnabled() {
+		sanitized := *sqlErr
+		sanitized.Query = sqlparser.Sanitize(sqlErr.Query)
+		err = &sanitized
+	}
 	te := NewTabletError(errorType, "%s", err)
 	if sqlErr, ok := err.(hasNumber); ok {
 		te.SqlError = sqlErr.Number()
@@ -82,7 +88,7 @@ func (te *TabletError) RecordStats() {
 
 func handleError(err *error, logStats *sqlQueryStats) {
 	if logStats != nil {
-		logStats.Send()
+		defer logStats.sendWithError(err)
 	}
 	if x := recover(); x != nil {
 		terr, ok := x.(*TabletError)
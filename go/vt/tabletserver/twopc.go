@@ -0,0 +1,464 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/stats"
+)
+
+/*
+This file contains the participant side of the two-phase commit of
+the distributed transactions, identified by their dtid.
+
+Prepare moves a transaction out of the active transaction pool into
+the prepared pool: its connection stays open, so its locks are
+held, and the timeout doesn't apply to it any more. The statements
+of the transaction are saved in the redo log (the
+_vt.redo_log_transaction and _vt.redo_log_statement tables) in their
+own transaction first, so a new master can prepare the transaction
+again: RecoverPrepared replays the redo log of the tablet, and is
+called when a tablet becomes the master.
+
+CommitPrepared deletes the redo log of the transaction inside the
+transaction itself, and commits it. RollbackPrepared deletes the
+redo log, and rolls the transaction back.
+
+A transaction whose redo log cannot be replayed, or whose commit
+failed, is marked as failed in the redo log, and needs a manual fix.
+
+The watchdog looks for the prepared transactions older than the
+abandon age, whose coordinator is most likely gone, and asks the
+registered TransactionResolver to finish them. vttablet registers the
+resolver of go/vt/dtxresolver when it is started with -dtx-shard;
+otherwise only the resolver of vtgate finishes them.
+*/
+
+const (
+	REDO_STATE_FAILED   = 0
+	REDO_STATE_PREPARED = 1
+)
+
+var createTwoPCTables = []string{
+	"CREATE DATABASE IF NOT EXISTS _vt",
+	`CREATE TABLE IF NOT EXISTS _vt.redo_log_transaction (
+  dtid varbinary(512) NOT NULL,
+  state tinyint NOT NULL,
+  time_created bigint NOT NULL,
+  primary key (dtid))`,
+	`CREATE TABLE IF NOT EXISTS _vt.redo_log_statement (
+  dtid varbinary(512) NOT NULL,
+  id bigint NOT NULL,
+  statement mediumblob NOT NULL,
+  primary key (dtid, id))`,
+	createDtxTable,
+}
+
+var twoPCStats *stats.Counters
+
+// TransactionResolver finishes distributed transactions.
+type TransactionResolver interface {
+	// ResolveTransaction finds out if the distributed transaction
+	// dtid was committed or not, and calls CommitPrepared or
+	// RollbackPrepared on all its participants.
+	ResolveTransaction(dtid string) error
+}
+
+var transactionResolver TransactionResolver
+
+// RegisterTransactionResolver sets the resolver the watchdog uses
+// for the abandoned prepared transactions.
+func RegisterTransactionResolver(resolver TransactionResolver) {
+	if transactionResolver != nil {
+		log.Fatalf("transaction resolver already registered")
+	}
+	transactionResolver = resolver
+}
+
+// preparedTx is a transaction in the prepared pool.
+type preparedTx struct {
+	conn        *TxConnection
+	prepareTime time.Time
+}
+
+// PreparedPool holds the prepared transactions by dtid.
+type PreparedPool struct {
+	mu  sync.Mutex
+	txs map[string]*preparedTx
+}
+
+func NewPreparedPool() *PreparedPool {
+	return &PreparedPool{txs: make(map[string]*preparedTx)}
+}
+
+// Put adds a prepared transaction. It fails if the dtid is already
+// prepared.
+func (pp *PreparedPool) Put(dtid string, ptx *preparedTx) error {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if _, ok := pp.txs[dtid]; ok {
+		return fmt.Errorf("transaction %v is already prepared", dtid)
+	}
+	pp.txs[dtid] = ptx
+	return nil
+}
+
+// Take removes a prepared transaction from the pool, and returns it,
+// or nil if it's not in the pool.
+func (pp *PreparedPool) Take(dtid string) *preparedTx {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	ptx := pp.txs[dtid]
+	delete(pp.txs, dtid)
+	return ptx
+}
+
+// TakeAll empties the pool, and returns its transactions.
+func (pp *PreparedPool) TakeAll() []*preparedTx {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	result := make([]*preparedTx, 0, len(pp.txs))
+	for _, ptx := range pp.txs {
+		result = append(result, ptx)
+	}
+	pp.txs = make(map[string]*preparedTx)
+	return result
+}
+
+// Has returns if a transaction is prepared.
+func (pp *PreparedPool) Has(dtid string) bool {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	_, ok := pp.txs[dtid]
+	return ok
+}
+
+// Abandoned returns the sorted dtids of the transactions prepared
+// more than age ago.
+func (pp *PreparedPool) Abandoned(age time.Duration) []string {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	var result []string
+	for dtid, ptx := range pp.txs {
+		if time.Now().Sub(ptx.prepareTime) > age {
+			result = append(result, dtid)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (pp *PreparedPool) Size() int64 {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	return int64(len(pp.txs))
+}
+
+// encodeString returns s as a quoted sql string.
+func encodeString(s string) string {
+	buf := &bytes.Buffer{}
+	sqltypes.MakeString([]byte(s)).EncodeSql(buf)
+	return buf.String()
+}
+
+// insertRedoQueries returns the queries that save the redo log of a
+// transaction.
+func insertRedoQueries(dtid string, statements []string, timeCreated int64) []string {
+	queries := []string{fmt.Sprintf("insert into _vt.redo_log_transaction(dtid, state, time_created) values (%s, %d, %d)", encodeString(dtid), REDO_STATE_PREPARED, timeCreated)}
+	if len(statements) == 0 {
+		return queries
+	}
+	buf := bytes.NewBufferString("insert into _vt.redo_log_statement(dtid, id, statement) values ")
+	for i, statement := range statements {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(buf, "(%s, %d, %s)", encodeString(dtid), i+1, encodeString(statement))
+	}
+	return append(queries, buf.String())
+}
+
+// deleteRedoQueries returns the queries that delete the redo log of
+// a transaction.
+func deleteRedoQueries(dtid string) []string {
+	return []string{
+		fmt.Sprintf("delete from _vt.redo_log_statement where dtid = %s", encodeString(dtid)),
+		fmt.Sprintf("delete from _vt.redo_log_transaction where dtid = %s", encodeString(dtid)),
+	}
+}
+
+// checkTwoPC panics if the two-phase commits are disabled.
+func (qe *QueryEngine) checkTwoPC() {
+	if !qe.twoPCEnabled {
+		panic(NewTabletError(FAIL, "two-phase commit is disabled"))
+	}
+}
+
+// openTwoPC starts the watchdog. It is called by Open.
+func (qe *QueryEngine) openTwoPC() {
+	qe.twoPCTablesCreated = false
+	if qe.twoPCEnabled && qe.twoPCAbandonAge > 0 {
+		qe.twoPCTicks.Start(func() { qe.twoPCWatchdog() })
+	}
+}
+
+// stopTwoPCWatchdog stops the watchdog. It is called by Close,
+// before qe.mu is locked, as the watchdog may run transactions.
+func (qe *QueryEngine) stopTwoPCWatchdog() {
+	if qe.twoPCEnabled && qe.twoPCAbandonAge > 0 {
+		qe.twoPCTicks.Stop()
+	}
+}
+
+// closeTwoPC rolls back the prepared transactions, by closing their
+// connection. Their redo log is kept for the next master.
+func (qe *QueryEngine) closeTwoPC() {
+	for _, ptx := range qe.preparedPool.TakeAll() {
+		log.Infof("closing prepared transaction %d", ptx.conn.transactionId)
+		ptx.conn.PoolConnection.Close()
+		ptx.conn.PoolConnection.Recycle()
+	}
+}
+
+// ensureTwoPCTables creates the redo log and transaction metadata
+// tables if they don't exist.
+func (qe *QueryEngine) ensureTwoPCTables() {
+	qe.twoPCTablesMu.Lock()
+	defer qe.twoPCTablesMu.Unlock()
+	if qe.twoPCTablesCreated {
+		return
+	}
+	conn := qe.dbaPool.Get()
+	defer conn.Recycle()
+	for _, query := range createTwoPCTables {
+		if _, err := conn.ExecuteFetch(query, 1, false); err != nil {
+			panic(NewTabletErrorSql(FAIL, err))
+		}
+	}
+	qe.twoPCTablesCreated = true
+}
+
+// execInTransaction runs queries in a new transaction.
+func (qe *QueryEngine) execInTransaction(queries []string) error {
+	conn := qe.txPool.Get()
+	defer conn.Recycle()
+	if _, err := conn.ExecuteFetch(BEGIN, 1, false); err != nil {
+		return NewTabletErrorSql(FAIL, err)
+	}
+	for _, query := range queries {
+		if _, err := conn.ExecuteFetch(query, 1, false); err != nil {
+			conn.ExecuteFetch(ROLLBACK, 1, false)
+			return NewTabletErrorSql(FAIL, err)
+		}
+	}
+	if _, err := conn.ExecuteFetch(COMMIT, 1, false); err != nil {
+		return NewTabletErrorSql(FAIL, err)
+	}
+	return nil
+}
+
+// markRedoFailed marks the redo log of a transaction as failed, so
+// it's not replayed.
+func (qe *QueryEngine) markRedoFailed(dtid string) {
+	twoPCStats.Add("RedoFailed", 1)
+	if err := qe.execInTransaction([]string{fmt.Sprintf("update _vt.redo_log_transaction set state = %d where dtid = %s", REDO_STATE_FAILED, encodeString(dtid))}); err != nil {
+		log.Errorf("cannot mark the redo log of transaction %v as failed: %v", dtid, err)
+	}
+}
+
+// Prepare saves the redo log of a transaction, and moves it to the
+// prepared pool. If it fails, the transaction is still active.
+func (qe *QueryEngine) Prepare(logStats *sqlQueryStats, transactionId int64, dtid string) {
+	qe.mu.RLock()
+	defer qe.mu.RUnlock()
+	qe.checkTwoPC()
+	qe.ensureTwoPCTables()
+
+	conn := qe.activeTxPool.Get(transactionId)
+	if len(conn.dirtyTables) != 0 {
+		// the rowcache couldn't be invalidated after a recovery
+		conn.Recycle()
+		panic(NewTabletError(FAIL, "cannot prepare transaction %v, it changed cached tables", dtid))
+	}
+	if err := qe.execInTransaction(insertRedoQueries(dtid, conn.statements, time.Now().UnixNano())); err != nil {
+		conn.Recycle()
+		panic(err)
+	}
+	if err := qe.preparedPool.Put(dtid, &preparedTx{conn, time.Now()}); err != nil {
+		conn.Recycle()
+		panic(NewTabletError(FAIL, "%v", err))
+	}
+	conn.release(TX_PREPARE)
+	twoPCStats.Add("Prepare", 1)
+}
+
+// CommitPrepared commits a prepared transaction. A transaction that
+// is not prepared any more was already resolved, unless its redo log
+// failed.
+func (qe *QueryEngine) CommitPrepared(logStats *sqlQueryStats, dtid string) {
+	qe.mu.RLock()
+	defer qe.mu.RUnlock()
+	qe.checkTwoPC()
+
+	ptx := qe.preparedPool.Take(dtid)
+	if ptx == nil {
+		qe.checkRedoNotFailed(dtid)
+		return
+	}
+	conn := ptx.conn
+	defer conn.PoolConnection.Recycle()
+	for _, query := range append(deleteRedoQueries(dtid), COMMIT) {
+		if _, err := conn.ExecuteFetch(query, 1, false); err != nil {
+			// the transaction is gone, and cannot be replayed
+			// safely any more
+			conn.PoolConnection.Close()
+			qe.markRedoFailed(dtid)
+			panic(NewTabletErrorSql(FAIL, err))
+		}
+	}
+	twoPCStats.Add("CommitPrepared", 1)
+}
+
+// RollbackPrepared deletes the redo log of a transaction, and rolls
+// it back. If the transaction was not prepared yet, originalId is
+// the id of the active transaction to roll back instead, or 0.
+func (qe *QueryEngine) RollbackPrepared(logStats *sqlQueryStats, dtid string, originalId int64) {
+	qe.mu.RLock()
+	defer qe.mu.RUnlock()
+	qe.checkTwoPC()
+	qe.ensureTwoPCTables()
+
+	if err := qe.execInTransaction(deleteRedoQueries(dtid)); err != nil {
+		panic(err)
+	}
+	twoPCStats.Add("RollbackPrepared", 1)
+	if ptx := qe.preparedPool.Take(dtid); ptx != nil {
+		conn := ptx.conn
+		defer conn.PoolConnection.Recycle()
+		if _, err := conn.ExecuteFetch(ROLLBACK, 1, false); err != nil {
+			conn.PoolConnection.Close()
+			panic(NewTabletErrorSql(FAIL, err))
+		}
+		return
+	}
+	if originalId != 0 {
+		qe.rollbackIfActive(originalId)
+	}
+}
+
+// rollbackIfActive rolls back an active transaction, if it's still
+// there.
+func (qe *QueryEngine) rollbackIfActive(transactionId int64) {
+	defer func() {
+		if x := recover(); x != nil {
+			if terr, ok := x.(*TabletError); !ok || terr.ErrorType != NOT_IN_TX {
+				panic(x)
+			}
+		}
+	}()
+	qe.activeTxPool.Rollback(transactionId)
+}
+
+// checkRedoNotFailed panics if the redo log of a transaction failed.
+func (qe *QueryEngine) checkRedoNotFailed(dtid string) {
+	qe.ensureTwoPCTables()
+	conn := qe.txPool.Get()
+	defer conn.Recycle()
+	qr, err := conn.ExecuteFetch(fmt.Sprintf("select state from _vt.redo_log_transaction where dtid = %s", encodeString(dtid)), 1, false)
+	if err != nil {
+		panic(NewTabletErrorSql(FAIL, err))
+	}
+	if len(qr.Rows) == 1 && qr.Rows[0][0].String() == fmt.Sprintf("%d", REDO_STATE_FAILED) {
+		panic(NewTabletError(FAIL, "transaction %v failed to be prepared again or committed, it needs a manual fix", dtid))
+	}
+}
+
+// RecoverPrepared prepares again the transactions of the redo log
+// that are not in the prepared pool. It returns how many it
+// prepared.
+func (qe *QueryEngine) RecoverPrepared() int {
+	qe.mu.RLock()
+	defer qe.mu.RUnlock()
+	qe.checkTwoPC()
+	qe.ensureTwoPCTables()
+
+	conn := qe.txPool.Get()
+	defer conn.Recycle()
+	qr, err := conn.ExecuteFetch(fmt.Sprintf("select dtid, time_created from _vt.redo_log_transaction where state = %d", REDO_STATE_PREPARED), 10000, false)
+	if err != nil {
+		panic(NewTabletErrorSql(FAIL, err))
+	}
+	recovered := 0
+	for _, row := range qr.Rows {
+		dtid := row[0].String()
+		if qe.preparedPool.Has(dtid) {
+			continue
+		}
+		timeCreated, err := strconv.ParseInt(row[1].String(), 10, 64)
+		if err != nil {
+			panic(NewTabletError(FAIL, "invalid time_created for transaction %v: %v", dtid, err))
+		}
+		sqr, err := conn.ExecuteFetch(fmt.Sprintf("select statement from _vt.redo_log_statement where dtid = %s order by id", encodeString(dtid)), 10000, false)
+		if err != nil {
+			panic(NewTabletErrorSql(FAIL, err))
+		}
+		statements := make([]string, len(sqr.Rows))
+		for i, srow := range sqr.Rows {
+			statements[i] = srow[0].String()
+		}
+		if err := qe.replayRedo(dtid, statements, time.Unix(0, timeCreated)); err != nil {
+			log.Errorf("cannot prepare transaction %v again: %v", dtid, err)
+			qe.markRedoFailed(dtid)
+			continue
+		}
+		recovered++
+	}
+	twoPCStats.Add("Recovered", int64(recovered))
+	return recovered
+}
+
+// replayRedo runs the statements of a transaction in a new
+// transaction, and puts it in the prepared pool.
+func (qe *QueryEngine) replayRedo(dtid string, statements []string, prepareTime time.Time) error {
+	conn := qe.txPool.Get()
+	if _, err := conn.ExecuteFetch(BEGIN, 1, false); err != nil {
+		conn.Recycle()
+		return err
+	}
+	for _, statement := range statements {
+		if _, err := conn.ExecuteFetch(statement, int(qe.maxResultSize.Get()), false); err != nil {
+			conn.ExecuteFetch(ROLLBACK, 1, false)
+			conn.Recycle()
+			return err
+		}
+	}
+	txc := newTxConnection(conn, qe.activeTxPool.lastId.Add(1), qe.activeTxPool)
+	txc.statements = statements
+	return qe.preparedPool.Put(dtid, &preparedTx{txc, prepareTime})
+}
+
+// twoPCWatchdog asks the transaction resolver to finish the prepared
+// transactions older than the abandon age.
+func (qe *QueryEngine) twoPCWatchdog() {
+	for _, dtid := range qe.preparedPool.Abandoned(qe.twoPCAbandonAge) {
+		twoPCStats.Add("Abandoned", 1)
+		if transactionResolver == nil {
+			log.Warningf("prepared transaction %v is abandoned, and there is no transaction resolver: set -dtx-shard", dtid)
+			continue
+		}
+		log.Infof("resolving abandoned prepared transaction %v", dtid)
+		if err := transactionResolver.ResolveTransaction(dtid); err != nil {
+			log.Errorf("cannot resolve abandoned transaction %v: %v", dtid, err)
+		}
+	}
+}
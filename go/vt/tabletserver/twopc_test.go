@@ -0,0 +1,167 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+func TestPreparedPool(t *testing.T) {
+	pp := NewPreparedPool()
+	old := &preparedTx{prepareTime: time.Now().Add(-time.Hour)}
+	recent := &preparedTx{prepareTime: time.Now()}
+	if err := pp.Put("old", old); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := pp.Put("recent", recent); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := pp.Put("old", recent); err == nil {
+		t.Errorf("Put of a prepared dtid should have failed")
+	}
+	if pp.Size() != 2 || !pp.Has("old") {
+		t.Errorf("unexpected pool: %v", pp.txs)
+	}
+
+	if got := pp.Abandoned(time.Minute); !reflect.DeepEqual(got, []string{"old"}) {
+		t.Errorf("Abandoned: got %v, want [old]", got)
+	}
+	if got := pp.Take("old"); got != old {
+		t.Errorf("Take: got %v, want %v", got, old)
+	}
+	if got := pp.Take("old"); got != nil {
+		t.Errorf("second Take: got %v, want nil", got)
+	}
+	if got := pp.TakeAll(); len(got) != 1 || got[0] != recent {
+		t.Errorf("TakeAll: got %v", got)
+	}
+	if pp.Size() != 0 {
+		t.Errorf("pool not empty after TakeAll")
+	}
+}
+
+func TestRedoQueries(t *testing.T) {
+	got := insertRedoQueries("ks:0:1", []string{"insert into a values (1)", "update a set b = 'c'"}, 10)
+	want := []string{
+		"insert into _vt.redo_log_transaction(dtid, state, time_created) values ('ks:0:1', 1, 10)",
+		"insert into _vt.redo_log_statement(dtid, id, statement) values ('ks:0:1', 1, 'insert into a values (1)'), ('ks:0:1', 2, 'update a set b = \\'c\\'')",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("insertRedoQueries:\ngot  %#v\nwant %#v", got, want)
+	}
+	if got := insertRedoQueries("ks:0:2", nil, 10); len(got) != 1 {
+		t.Errorf("insertRedoQueries without statements: %#v", got)
+	}
+	want = []string{
+		"delete from _vt.redo_log_statement where dtid = 'ks:0:1'",
+		"delete from _vt.redo_log_transaction where dtid = 'ks:0:1'",
+	}
+	if got := deleteRedoQueries("ks:0:1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("deleteRedoQueries:\ngot  %#v\nwant %#v", got, want)
+	}
+}
+
+func TestDtxFromQueryResult(t *testing.T) {
+	participants := []proto.DtxParticipant{{Keyspace: "user", Shard: "-80"}, {Keyspace: "user", Shard: "80-"}}
+	encoded := encodeParticipants(participants)
+	if encoded != "user/-80,user/80-" {
+		t.Errorf("encodeParticipants: got %v", encoded)
+	}
+	qr := &mproto.QueryResult{Rows: [][]sqltypes.Value{{
+		sqltypes.MakeString([]byte("user:-80:12")),
+		sqltypes.MakeString([]byte("1")),
+		sqltypes.MakeString([]byte("1000")),
+		sqltypes.MakeString([]byte(encoded)),
+	}}}
+	got, err := dtxFromQueryResult(qr)
+	if err != nil {
+		t.Fatalf("dtxFromQueryResult failed: %v", err)
+	}
+	want := []proto.DistributedTransaction{{Dtid: "user:-80:12", State: proto.DTX_COMMIT, TimeCreated: 1000, Participants: participants}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dtxFromQueryResult:\ngot  %#v\nwant %#v", got, want)
+	}
+	if _, err := decodeParticipants("user"); err == nil {
+		t.Errorf("decodeParticipants of an invalid participant should have failed")
+	}
+}
+
+// expectTabletError runs action, and checks it panics with a
+// TabletError containing want.
+func expectTabletError(t *testing.T, name, want string, action func()) {
+	defer func() {
+		x := recover()
+		terr, ok := x.(*TabletError)
+		if !ok || !strings.Contains(terr.Error(), want) {
+			t.Errorf("%v: got %v, want a TabletError containing %q", name, x, want)
+		}
+	}()
+	action()
+}
+
+func TestTwoPCDisabled(t *testing.T) {
+	qe := &QueryEngine{preparedPool: NewPreparedPool()}
+	expectTabletError(t, "Prepare", "two-phase commit is disabled", func() { qe.Prepare(nil, 1, "ks:0:1") })
+	expectTabletError(t, "CommitPrepared", "two-phase commit is disabled", func() { qe.CommitPrepared(nil, "ks:0:1") })
+	expectTabletError(t, "RollbackPrepared", "two-phase commit is disabled", func() { qe.RollbackPrepared(nil, "ks:0:1", 1) })
+	expectTabletError(t, "RecoverPrepared", "two-phase commit is disabled", func() { qe.RecoverPrepared() })
+}
+
+// fakeResolver records the transactions it resolves, and fails for
+// the ones in failures.
+type fakeResolver struct {
+	resolved []string
+	failures map[string]bool
+}
+
+func (fr *fakeResolver) ResolveTransaction(dtid string) error {
+	fr.resolved = append(fr.resolved, dtid)
+	if fr.failures[dtid] {
+		return fmt.Errorf("cannot resolve %v", dtid)
+	}
+	return nil
+}
+
+func TestTwoPCWatchdog(t *testing.T) {
+	savedStats := twoPCStats
+	defer func() {
+		twoPCStats = savedStats
+		transactionResolver = nil
+	}()
+	twoPCStats = stats.NewCounters("")
+
+	qe := &QueryEngine{preparedPool: NewPreparedPool(), twoPCAbandonAge: time.Minute}
+	for _, dtid := range []string{"ks:0:2", "ks:0:1"} {
+		qe.preparedPool.Put(dtid, &preparedTx{prepareTime: time.Now().Add(-time.Hour)})
+	}
+	qe.preparedPool.Put("ks:0:3", &preparedTx{prepareTime: time.Now()})
+
+	// without a resolver, the abandoned transactions are only
+	// counted
+	transactionResolver = nil
+	qe.twoPCWatchdog()
+	if got := twoPCStats.Counts()["Abandoned"]; got != 2 {
+		t.Errorf("Abandoned without a resolver: got %v, want 2", got)
+	}
+
+	fr := &fakeResolver{failures: map[string]bool{"ks:0:1": true}}
+	RegisterTransactionResolver(fr)
+	qe.twoPCWatchdog()
+	if want := []string{"ks:0:1", "ks:0:2"}; !reflect.DeepEqual(fr.resolved, want) {
+		t.Errorf("resolved: got %v, want %v", fr.resolved, want)
+	}
+	if got := twoPCStats.Counts()["Abandoned"]; got != 4 {
+		t.Errorf("Abandoned: got %v, want 4", got)
+	}
+}
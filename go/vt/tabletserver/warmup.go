@@ -0,0 +1,175 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/bson"
+	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+/*
+This file contains the warmup of the query service: when it stops,
+the most frequent select queries of the plan cache are saved in a
+local file, with the bind variables of one of their executions. When
+it starts again, they are replayed at a low concurrency before the
+query service is serving, so the plan cache, the rowcache and the
+MySQL buffer pool are not cold.
+*/
+
+var warmupStats = stats.NewCounters("Warmup")
+
+// setSample records the bind variables of an execution of the plan,
+// for the warmup. Only the first ones are kept.
+func (ep *ExecPlan) setSample(bindVars map[string]interface{}) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if ep.sampleBindVars != nil {
+		return
+	}
+	ep.sampleBindVars = make(map[string]interface{}, len(bindVars))
+	for k, v := range bindVars {
+		if k == TRAILING_COMMENT {
+			continue
+		}
+		ep.sampleBindVars[k] = v
+	}
+}
+
+type warmupQuery struct {
+	query proto.BoundQuery
+	count int64
+}
+
+type warmupQueries []warmupQuery
+
+func (wqs warmupQueries) Len() int           { return len(wqs) }
+func (wqs warmupQueries) Swap(i, j int)      { wqs[i], wqs[j] = wqs[j], wqs[i] }
+func (wqs warmupQueries) Less(i, j int) bool { return wqs[i].count > wqs[j].count }
+
+// topQueries returns the count most executed queries of the plan
+// cache that have a sample.
+func (si *SchemaInfo) topQueries(count int) []proto.BoundQuery {
+	var wqs warmupQueries
+	for _, sql := range si.queries.Keys() {
+		plan := si.getQuery(sql)
+		if plan == nil {
+			continue
+		}
+		plan.mu.Lock()
+		if plan.sampleBindVars != nil {
+			wqs = append(wqs, warmupQuery{
+				query: proto.BoundQuery{Sql: sql, BindVariables: plan.sampleBindVars},
+				count: plan.QueryCount,
+			})
+		}
+		plan.mu.Unlock()
+	}
+	sort.Sort(wqs)
+	if len(wqs) > count {
+		wqs = wqs[:count]
+	}
+	result := make([]proto.BoundQuery, len(wqs))
+	for i, wq := range wqs {
+		result[i] = wq.query
+	}
+	return result
+}
+
+// saveWarmupQueries writes the top queries to the warmup file.
+func (qe *QueryEngine) saveWarmupQueries() {
+	if qe.warmupFile == "" {
+		return
+	}
+	queries := qe.schemaInfo.topQueries(qe.warmupQueryCount)
+	data, err := bson.Marshal(&proto.QueryList{Queries: queries})
+	if err != nil {
+		log.Warningf("cannot encode the warmup queries: %v", err)
+		return
+	}
+	tmp := qe.warmupFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		log.Warningf("cannot save the warmup queries: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, qe.warmupFile); err != nil {
+		log.Warningf("cannot save the warmup queries: %v", err)
+		return
+	}
+	log.Infof("saved %v warmup queries in %v", len(queries), qe.warmupFile)
+}
+
+// loadWarmupQueries reads the warmup file.
+func loadWarmupQueries(file string) ([]proto.BoundQuery, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var ql proto.QueryList
+	if err := bson.Unmarshal(data, &ql); err != nil {
+		return nil, err
+	}
+	return ql.Queries, nil
+}
+
+// Warmup replays the saved queries, with warmupConcurrency goroutines,
+// until they are all done or warmupTimeout is reached. The errors are
+// only counted.
+func (qe *QueryEngine) Warmup() {
+	if qe.warmupFile == "" {
+		return
+	}
+	queries, err := loadWarmupQueries(qe.warmupFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warningf("cannot load the warmup queries: %v", err)
+		}
+		return
+	}
+	log.Infof("replaying %v warmup queries", len(queries))
+	start := time.Now()
+	deadline := start.Add(qe.warmupTimeout)
+	work := make(chan proto.BoundQuery)
+	var wg sync.WaitGroup
+	for i := 0; i < qe.warmupConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range work {
+				qe.warmupExecute(q)
+			}
+		}()
+	}
+	for _, q := range queries {
+		if time.Now().After(deadline) {
+			log.Warningf("warmup timed out")
+			warmupStats.Add("Timeouts", 1)
+			break
+		}
+		work <- q
+	}
+	close(work)
+	wg.Wait()
+	log.Infof("warmup done in %v", time.Now().Sub(start))
+}
+
+func (qe *QueryEngine) warmupExecute(q proto.BoundQuery) {
+	defer func() {
+		if x := recover(); x != nil {
+			warmupStats.Add("Errors", 1)
+		}
+	}()
+	logStats := newSqlQueryStats("Warmup", &rpcproto.Context{RemoteAddr: "warmup"})
+	qe.Execute(logStats, &proto.Query{Sql: q.Sql, BindVariables: q.BindVariables})
+	warmupStats.Add("Queries", 1)
+}
@@ -0,0 +1,60 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/youtube/vitess/go/cache"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+func TestWarmupQueries(t *testing.T) {
+	si := &SchemaInfo{queries: cache.NewLRUCache(10)}
+	addPlan := func(sql string, count int64, bindVars map[string]interface{}) {
+		plan := &ExecPlan{ExecPlan: &sqlparser.ExecPlan{PlanId: sqlparser.PLAN_PK_EQUAL}, QueryCount: count}
+		if bindVars != nil {
+			plan.setSample(bindVars)
+		}
+		si.queries.Set(sql, plan)
+	}
+	addPlan("select a from t where id = :id", 10, map[string]interface{}{"id": 1, TRAILING_COMMENT: "/* trace */"})
+	addPlan("select b from t", 50, map[string]interface{}{})
+	addPlan("select c from t", 100, nil)
+	addPlan("select d from t", 1, map[string]interface{}{})
+
+	queries := si.topQueries(2)
+	if len(queries) != 2 || queries[0].Sql != "select b from t" || queries[1].Sql != "select a from t where id = :id" {
+		t.Fatalf("unexpected top queries: %v", queries)
+	}
+	if _, ok := queries[1].BindVariables[TRAILING_COMMENT]; ok {
+		t.Errorf("the trailing comment should not be in the sample: %v", queries[1].BindVariables)
+	}
+
+	// the first sample is kept
+	plan := si.getQuery("select a from t where id = :id")
+	plan.setSample(map[string]interface{}{"id": 2})
+	if plan.sampleBindVars["id"] != 1 {
+		t.Errorf("the sample should not have changed: %v", plan.sampleBindVars)
+	}
+
+	dir, err := ioutil.TempDir("", "warmup")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	qe := &QueryEngine{schemaInfo: si, warmupFile: path.Join(dir, "warmup"), warmupQueryCount: 10}
+	qe.saveWarmupQueries()
+	loaded, err := loadWarmupQueries(qe.warmupFile)
+	if err != nil {
+		t.Fatalf("loadWarmupQueries failed: %v", err)
+	}
+	if len(loaded) != 3 || loaded[2].Sql != "select d from t" || loaded[1].BindVariables["id"] != int64(1) {
+		t.Errorf("unexpected loaded queries: %#v", loaded)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+import (
+	log "github.com/golang/glog"
+)
+
+// CellInfo describes a cell registered in the global topology, so
+// processes can find its topology server without a local
+// configuration change.
+type CellInfo struct {
+	// ServerAddress is the address of the topology server of the
+	// cell, like a comma separated list of zookeeper servers.
+	ServerAddress string
+}
+
+// CellsAlias is a group of cells, like the cells of a region. When a
+// cell has no serving address for a tablet type in a shard, serving
+// graph lookups fall back to the other cells of its alias, in order.
+// A cell can only be in one alias.
+type CellsAlias struct {
+	Cells []string
+}
+
+// EndPointsReader is the part of Server that GetEndPointsWithFallback
+// uses. vtgate.SrvTopoServer implements it too.
+type EndPointsReader interface {
+	GetCellsAliases() (map[string]*CellsAlias, error)
+	GetEndPoints(cell, keyspace, shard string, tabletType TabletType) (*EndPoints, error)
+}
+
+// SiblingCells returns the other cells of the alias the cell is in,
+// in the order of the alias.
+func SiblingCells(aliases map[string]*CellsAlias, cell string) []string {
+	for _, ca := range aliases {
+		if !inCellList(cell, ca.Cells) {
+			continue
+		}
+		result := make([]string, 0, len(ca.Cells)-1)
+		for _, c := range ca.Cells {
+			if c != cell {
+				result = append(result, c)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// inCellList returns true if the cell is in the list.
+func inCellList(cell string, cells []string) bool {
+	for _, c := range cells {
+		if c == cell {
+			return true
+		}
+	}
+	return false
+}
+
+// GetEndPointsWithFallback returns the serving addresses of a tablet
+// type in a shard, in the given cell if it has any, or else in the
+// first sibling cell of its alias that has some. If no cell has any,
+// it returns the result of the given cell.
+func GetEndPointsWithFallback(ts EndPointsReader, cell, keyspace, shard string, tabletType TabletType) (*EndPoints, error) {
+	addrs, err := ts.GetEndPoints(cell, keyspace, shard, tabletType)
+	if err == nil && len(addrs.Entries) > 0 {
+		return addrs, nil
+	}
+
+	aliases, aerr := ts.GetCellsAliases()
+	if aerr != nil {
+		log.Warningf("GetCellsAliases failed, not falling back from cell %v: %v", cell, aerr)
+		return addrs, err
+	}
+	for _, sibling := range SiblingCells(aliases, cell) {
+		saddrs, serr := ts.GetEndPoints(sibling, keyspace, shard, tabletType)
+		if serr == nil && len(saddrs.Entries) > 0 {
+			log.Infof("no %v endpoints for %v/%v in cell %v, using cell %v", tabletType, keyspace, shard, cell, sibling)
+			return saddrs, nil
+		}
+	}
+	return addrs, err
+}
@@ -0,0 +1,60 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+// This file contains the DiffReport object, the persisted result of
+// the diff workers.
+
+// TableDiffReport is the result of the comparison of one table.
+type TableDiffReport struct {
+	ProcessedRows  int
+	MatchingRows   int
+	MismatchedRows int
+	ExtraRowsLeft  int
+	ExtraRowsRight int
+
+	// Samples has the first differences, with their primary keys.
+	Samples []string
+}
+
+// HasDifferences returns true if the table has any difference.
+func (tdr *TableDiffReport) HasDifferences() bool {
+	return tdr.MismatchedRows > 0 || tdr.ExtraRowsLeft > 0 || tdr.ExtraRowsRight > 0
+}
+
+// DiffReport is the result of a diff worker, comparing the data of a
+// destination shard (the right side) with the data of its source
+// shard (the left side). It is stored in the global topology with
+// the destination shard, so the cutover to the destination shard can
+// be audited.
+type DiffReport struct {
+	// Worker is the name of the worker, like SplitDiff.
+	Worker string
+
+	SourceKeyspace    string
+	SourceShard       string
+	SourceTablet      TabletAlias
+	DestinationTablet TabletAlias
+
+	// StartTime and EndTime are in seconds since the epoch.
+	StartTime int64
+	EndTime   int64
+
+	// Error is the error the diff returned, if any: it failed
+	// before comparing all the tables, or found differences.
+	Error string
+
+	Tables map[string]*TableDiffReport
+}
+
+// HasDifferences returns true if any table has a difference.
+func (dr *DiffReport) HasDifferences() bool {
+	for _, tdr := range dr.Tables {
+		if tdr.HasDifferences() {
+			return true
+		}
+	}
+	return false
+}
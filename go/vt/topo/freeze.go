@@ -0,0 +1,39 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+import (
+	"flag"
+	"fmt"
+)
+
+// This file contains the topology freeze: while the topology is
+// frozen, all the calls that change it fail with a FrozenError, so
+// no control plane change can happen during a maintenance of the
+// topology servers, or an incident. The processes started with
+// -topo_bypass_freeze (the ones of the operators) can still change
+// it.
+
+// BypassFreeze is set for processes that can change the topology
+// while it is frozen.
+var BypassFreeze = flag.Bool("topo_bypass_freeze", false, "allow this process to change the topology while it is frozen")
+
+// Freeze describes why the topology is frozen.
+type Freeze struct {
+	Reason string
+
+	// Time is when the topology was frozen, in seconds since epoch.
+	Time int64
+}
+
+// FrozenError is returned by the calls that change the topology
+// while it is frozen.
+type FrozenError struct {
+	Freeze *Freeze
+}
+
+func (e *FrozenError) Error() string {
+	return fmt.Sprintf("the topology is frozen, it cannot be changed (reason: %v), unfreeze it with 'vtctl UnfreezeTopology' or use -topo_bypass_freeze", e.Freeze.Reason)
+}
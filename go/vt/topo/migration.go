@@ -0,0 +1,74 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+// This file contains the SchemaMigration object, used to track online
+// schema changes.
+
+// MigrationState is the state of a SchemaMigration, or of one of its
+// shards.
+type MigrationState string
+
+const (
+	// the migration (or shard) hasn't been started yet
+	MIGRATION_PENDING = MigrationState("pending")
+
+	// the migration (or shard) is running
+	MIGRATION_RUNNING = MigrationState("running")
+
+	// the migration won't start any new shard until it is unthrottled
+	MIGRATION_THROTTLED = MigrationState("throttled")
+
+	// the migration (or shard) was applied successfully
+	MIGRATION_COMPLETE = MigrationState("complete")
+
+	// the migration (or shard) failed, it can be retried
+	MIGRATION_FAILED = MigrationState("failed")
+
+	// the migration was canceled, it won't start any new shard
+	MIGRATION_CANCELED = MigrationState("canceled")
+)
+
+// IsDone returns true if the migration (or shard) won't make any
+// more progress unless it is retried.
+func (state MigrationState) IsDone() bool {
+	return state == MIGRATION_COMPLETE || state == MIGRATION_FAILED || state == MIGRATION_CANCELED
+}
+
+// ShardMigration is the state of a SchemaMigration on one shard.
+type ShardMigration struct {
+	State MigrationState
+
+	// Attempts is the number of times the change was started
+	// on this shard.
+	Attempts int
+
+	// Error is the error of the last failed attempt.
+	Error string
+}
+
+// SchemaMigration is an online schema change, applied with an
+// external online schema change tool on the master of every shard of
+// a keyspace. It is stored in the global topology, so the migration
+// can be throttled, canceled or retried from another process.
+type SchemaMigration struct {
+	Sql    string
+	State  MigrationState
+	Shards map[string]*ShardMigration
+}
+
+// NewSchemaMigration returns a SchemaMigration with all the shards
+// in the MIGRATION_PENDING state.
+func NewSchemaMigration(sql string, shards []string) *SchemaMigration {
+	sm := &SchemaMigration{
+		Sql:    sql,
+		State:  MIGRATION_PENDING,
+		Shards: make(map[string]*ShardMigration, len(shards)),
+	}
+	for _, shard := range shards {
+		sm.Shards[shard] = &ShardMigration{State: MIGRATION_PENDING}
+	}
+	return sm
+}
@@ -33,8 +33,8 @@ const (
 )
 
 type EndPoint struct {
-	Uid          uint32         `json:"uid"` // Keep track of which tablet this corresponds to.
-	Host         string         `json:"host"`
+	Uid          uint32         `json:"uid"`  // Keep track of which tablet this corresponds to.
+	Host         string         `json:"host"` // a hostname, an IPv4 or an IPv6 address (without brackets)
 	NamedPortMap map[string]int `json:"named_port_map"`
 }
 
@@ -42,6 +42,26 @@ type EndPoints struct {
 	Entries []EndPoint `json:"entries"`
 }
 
+// EndPointPortName returns the name of a tablet port in the serving
+// graph: the vt port is DefaultPortName for compatibility, and the
+// other ports are prefixed with '_'.
+func EndPointPortName(name string) string {
+	if name == "vt" {
+		return DefaultPortName
+	}
+	return "_" + name
+}
+
+// Addr returns the host:port address of a named port of the end
+// point, and fails if it doesn't have it.
+func (ep *EndPoint) Addr(namedPort string) (string, error) {
+	port, ok := ep.NamedPortMap[namedPort]
+	if !ok {
+		return "", fmt.Errorf("end point %v has no %v port", ep.Uid, namedPort)
+	}
+	return netutil.JoinHostPort(ep.Host, port), nil
+}
+
 func NewAddr(uid uint32, host string) *EndPoint {
 	return &EndPoint{Uid: uid, Host: host, NamedPortMap: make(map[string]int)}
 }
@@ -74,7 +94,7 @@ func NewEndPoints() *EndPoints {
 }
 
 func LookupVtName(ts Server, cell, keyspace, shard string, tabletType TabletType, namedPort string) ([]*net.SRV, error) {
-	addrs, err := ts.GetEndPoints(cell, keyspace, shard, tabletType)
+	addrs, err := GetEndPointsWithFallback(ts, cell, keyspace, shard, tabletType)
 	if err != nil {
 		return nil, fmt.Errorf("LookupVtName(%v,%v,%v,%v) failed: %v", cell, keyspace, shard, tabletType, err)
 	}
@@ -110,5 +130,5 @@ func SrvEntries(addrs *EndPoints, namedPort string) (srvs []*net.SRV, err error)
 }
 
 func SrvAddr(srv *net.SRV) string {
-	return fmt.Sprintf("%s:%d", srv.Target, srv.Port)
+	return netutil.JoinHostPort(srv.Target, int(srv.Port))
 }
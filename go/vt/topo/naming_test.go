@@ -0,0 +1,72 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNamedPorts(t *testing.T) {
+	got, err := ParseNamedPorts("grpc:15991,debug:15102")
+	if err != nil {
+		t.Fatalf("ParseNamedPorts failed: %v", err)
+	}
+	want := map[string]int{"grpc": 15991, "debug": 15102}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseNamedPorts: got %v, want %v", got, want)
+	}
+	if got, err := ParseNamedPorts(""); err != nil || len(got) != 0 {
+		t.Errorf("ParseNamedPorts(\"\"): %v %v", got, err)
+	}
+	for _, invalid := range []string{"grpc", "grpc:x", "grpc:0", ":15991", "vt:15991"} {
+		if _, err := ParseNamedPorts(invalid); err == nil {
+			t.Errorf("ParseNamedPorts(%v) should have failed", invalid)
+		}
+	}
+}
+
+func TestEndPointAddr(t *testing.T) {
+	ep := NewAddr(1, "host1")
+	ep.NamedPortMap[EndPointPortName("vt")] = 15101
+	ep.NamedPortMap[EndPointPortName("grpc")] = 15991
+	if addr, err := ep.Addr(DefaultPortName); err != nil || addr != "host1:15101" {
+		t.Errorf("Addr(vt): %v %v", addr, err)
+	}
+	if addr, err := ep.Addr("_grpc"); err != nil || addr != "host1:15991" {
+		t.Errorf("Addr(grpc): %v %v", addr, err)
+	}
+	if _, err := ep.Addr("_vts"); err == nil {
+		t.Errorf("Addr of a missing port should have failed")
+	}
+}
+
+func TestIPv6Addrs(t *testing.T) {
+	tablet := &Tablet{
+		Hostname: "host1",
+		IPAddr:   "2001:db8::1",
+		Portmap:  map[string]int{"vt": 15101, "mysql": 3306},
+	}
+	if got := tablet.MysqlIpAddr(); got != "[2001:db8::1]:3306" {
+		t.Errorf("MysqlIpAddr: got %v", got)
+	}
+	if got := tablet.EndPointHost(); got != "host1" {
+		t.Errorf("EndPointHost: got %v, want host1", got)
+	}
+	tablet.PublishIPAddr = true
+	if got := tablet.EndPointHost(); got != "2001:db8::1" {
+		t.Errorf("EndPointHost: got %v, want 2001:db8::1", got)
+	}
+
+	ep := NewAddr(1, tablet.EndPointHost())
+	ep.NamedPortMap[DefaultPortName] = 15101
+	if addr, err := ep.Addr(DefaultPortName); err != nil || addr != "[2001:db8::1]:15101" {
+		t.Errorf("Addr(vt): %v %v", addr, err)
+	}
+	srvs, err := SrvEntries(&EndPoints{Entries: []EndPoint{*ep}}, "")
+	if err != nil || len(srvs) != 1 || SrvAddr(srvs[0]) != "[2001:db8::1]:15101" {
+		t.Errorf("SrvEntries: %v %v", srvs, err)
+	}
+}
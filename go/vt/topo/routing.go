@@ -0,0 +1,83 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+// This file contains the routing rules of vtgate. They are stored in
+// the global topology, and redirect the queries for a keyspace and
+// tablet type to another keyspace or tablet type, during a migration
+// or an incident, without changing the clients.
+
+// RoutingRule redirects the queries for FromKeyspace, and
+// FromTabletType if set, to ToKeyspace, and ToTabletType if set.
+type RoutingRule struct {
+	FromKeyspace   string
+	FromTabletType TabletType
+	ToKeyspace     string
+	ToTabletType   TabletType
+}
+
+// RoutingRules are all the routing rules. A keyspace and tablet type
+// is redirected only once, the rule for its type taking precedence
+// over the rule for all types.
+type RoutingRules struct {
+	Rules []*RoutingRule
+}
+
+// NewRoutingRules returns an empty RoutingRules.
+func NewRoutingRules() *RoutingRules {
+	return &RoutingRules{Rules: make([]*RoutingRule, 0)}
+}
+
+// find returns the index of the rule for keyspace and tabletType, or
+// -1. An empty tabletType looks for the rule for all types.
+func (rr *RoutingRules) find(keyspace string, tabletType TabletType) int {
+	for i, rule := range rr.Rules {
+		if rule.FromKeyspace == keyspace && rule.FromTabletType == tabletType {
+			return i
+		}
+	}
+	return -1
+}
+
+// Route returns the keyspace and tablet type the queries for
+// keyspace and tabletType go to.
+func (rr *RoutingRules) Route(keyspace string, tabletType TabletType) (string, TabletType) {
+	if rr == nil {
+		return keyspace, tabletType
+	}
+	i := rr.find(keyspace, tabletType)
+	if i == -1 {
+		i = rr.find(keyspace, "")
+	}
+	if i == -1 {
+		return keyspace, tabletType
+	}
+	rule := rr.Rules[i]
+	if rule.ToTabletType != "" {
+		tabletType = rule.ToTabletType
+	}
+	return rule.ToKeyspace, tabletType
+}
+
+// SetRule adds a rule, or replaces the rule with the same
+// FromKeyspace and FromTabletType.
+func (rr *RoutingRules) SetRule(rule *RoutingRule) {
+	if i := rr.find(rule.FromKeyspace, rule.FromTabletType); i != -1 {
+		rr.Rules[i] = rule
+		return
+	}
+	rr.Rules = append(rr.Rules, rule)
+}
+
+// ClearRule removes the rule for keyspace and tabletType, and returns
+// false if there was none.
+func (rr *RoutingRules) ClearRule(keyspace string, tabletType TabletType) bool {
+	i := rr.find(keyspace, tabletType)
+	if i == -1 {
+		return false
+	}
+	rr.Rules = append(rr.Rules[:i], rr.Rules[i+1:]...)
+	return true
+}
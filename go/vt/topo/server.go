@@ -64,6 +64,57 @@ type Server interface {
 	// They shall be sorted.
 	GetKnownCells() ([]string, error)
 
+	// CreateCell registers a cell in the global topology, with
+	// the information to reach its topology server, and creates
+	// the paths the cell needs in it.
+	// Can return ErrNodeExists if it is already registered.
+	CreateCell(cell string, ci *CellInfo) error
+
+	// GetCellInfo returns the information of a registered cell.
+	// Can return ErrNoNode if the cell is not registered.
+	GetCellInfo(cell string) (*CellInfo, error)
+
+	// UpdateCellInfo changes the information of a registered
+	// cell, for instance when its topology server moves. The
+	// processes use the new address after their cache of the
+	// cell expires.
+	// Can return ErrNoNode if the cell is not registered.
+	UpdateCellInfo(cell string, ci *CellInfo) error
+
+	// DeleteCell unregisters a cell. The data in the cell is
+	// left alone.
+	// Can return ErrNoNode if the cell is not registered.
+	DeleteCell(cell string) error
+
+	// SaveCellsAlias creates or replaces a cells alias.
+	SaveCellsAlias(alias string, ca *CellsAlias) error
+
+	// GetCellsAliases returns all the cells aliases, by name.
+	GetCellsAliases() (map[string]*CellsAlias, error)
+
+	// DeleteCellsAlias deletes a cells alias.
+	// Can return ErrNoNode.
+	DeleteCellsAlias(alias string) error
+
+	//
+	// Topology freeze, global.
+	//
+
+	// FreezeTopology freezes the topology: until it is unfrozen,
+	// all the calls that change the topology (in any cell) fail
+	// with a FrozenError, unless the process runs with
+	// BypassFreeze.
+	// Can return ErrNodeExists if it is already frozen.
+	FreezeTopology(freeze *Freeze) error
+
+	// UnfreezeTopology unfreezes the topology.
+	// Can return ErrNoNode if it is not frozen.
+	UnfreezeTopology() error
+
+	// GetTopologyFreeze returns why the topology is frozen.
+	// Can return ErrNoNode if it is not frozen.
+	GetTopologyFreeze() (*Freeze, error)
+
 	//
 	// Keyspace management, global.
 	//
@@ -79,6 +130,12 @@ type Server interface {
 	// Use with caution.
 	DeleteKeyspaceShards(keyspace string) error
 
+	// DeleteKeyspace deletes the keyspace, and all its global
+	// data (actions, migrations, workflows, ...).
+	// Can return ErrNoNode if it doesn't exist, or ErrNotEmpty if
+	// it still has shards.
+	DeleteKeyspace(keyspace string) error
+
 	//
 	// Shard management, global.
 	//
@@ -107,6 +164,91 @@ type Server interface {
 	// or if DeleteKeyspaceShards was called. They shall be sorted.
 	GetShardNames(keyspace string) ([]string, error)
 
+	// DeleteShard deletes the shard, and all its global data.
+	// Can return ErrNoNode.
+	DeleteShard(keyspace, shard string) error
+
+	//
+	// Schema migration management, global.
+	//
+
+	// CreateSchemaMigration stores a new SchemaMigration for
+	// the keyspace, and returns its unique id.
+	CreateSchemaMigration(keyspace string, sm *SchemaMigration) (string, error)
+
+	// UpdateSchemaMigrationFields updates the current
+	// SchemaMigration record with new values.
+	// Can return ErrNoNode if the migration doesn't exist.
+	UpdateSchemaMigrationFields(keyspace, uid string, update func(*SchemaMigration) error) error
+
+	// GetSchemaMigration reads a SchemaMigration.
+	// Can return ErrNoNode.
+	GetSchemaMigration(keyspace, uid string) (*SchemaMigration, error)
+
+	// GetSchemaMigrations returns the ids of all the
+	// migrations of a keyspace. They shall be sorted.
+	GetSchemaMigrations(keyspace string) ([]string, error)
+
+	//
+	// Workflow management, global.
+	//
+
+	// CreateWorkflow stores a new Workflow for the keyspace, and
+	// returns its unique id.
+	CreateWorkflow(keyspace string, wf *Workflow) (string, error)
+
+	// UpdateWorkflowFields updates the current Workflow record
+	// with new values.
+	// Can return ErrNoNode if the workflow doesn't exist.
+	UpdateWorkflowFields(keyspace, uid string, update func(*Workflow) error) error
+
+	// GetWorkflow reads a Workflow.
+	// Can return ErrNoNode.
+	GetWorkflow(keyspace, uid string) (*Workflow, error)
+
+	// GetWorkflows returns the ids of all the workflows of a
+	// keyspace. They shall be sorted.
+	GetWorkflows(keyspace string) ([]string, error)
+
+	//
+	// Diff reports management, global.
+	//
+
+	// CreateDiffReport stores a new DiffReport for a destination
+	// shard, and returns its unique id.
+	CreateDiffReport(keyspace, shard string, dr *DiffReport) (string, error)
+
+	// GetDiffReport reads a DiffReport.
+	// Can return ErrNoNode.
+	GetDiffReport(keyspace, shard, uid string) (*DiffReport, error)
+
+	// GetDiffReports returns the ids of all the diff reports of a
+	// shard. They shall be sorted.
+	GetDiffReports(keyspace, shard string) ([]string, error)
+
+	//
+	// VSchema management, global.
+	//
+
+	// SaveVSchema creates or replaces the VSchema of a keyspace.
+	// Can return ErrNoNode if the keyspace doesn't exist.
+	SaveVSchema(keyspace string, vschema *VSchema) error
+
+	// GetVSchema reads the VSchema of a keyspace.
+	// Can return ErrNoNode.
+	GetVSchema(keyspace string) (*VSchema, error)
+
+	//
+	// Routing rules management, global.
+	//
+
+	// SaveRoutingRules replaces the routing rules of vtgate.
+	SaveRoutingRules(rr *RoutingRules) error
+
+	// GetRoutingRules returns the routing rules of vtgate, empty
+	// if they were never saved.
+	GetRoutingRules() (*RoutingRules, error)
+
 	//
 	// Tablet management, per cell.
 	//
@@ -144,6 +286,11 @@ type Server interface {
 	// Can return ErrNoNode if no tablet was ever created in that cell.
 	GetTabletsByCell(cell string) ([]TabletAlias, error)
 
+	// GetTabletMapForCell returns all the tablets in the given
+	// cell, with their data, reading them all at once.
+	// Can return ErrNoNode if no tablet was ever created in that cell.
+	GetTabletMapForCell(cell string) (map[TabletAlias]*TabletInfo, error)
+
 	//
 	// Replication graph management, per cell.
 	//
@@ -184,6 +331,11 @@ type Server interface {
 	// Can return ErrNoNode.
 	GetEndPoints(cell, keyspace, shard string, tabletType TabletType) (*EndPoints, error)
 
+	// GetEndPointsPerShard returns the EndPoints lists of all the
+	// serving types of a shard, reading them all at once.
+	// Can return ErrNoNode.
+	GetEndPointsPerShard(cell, keyspace, shard string) (map[TabletType]*EndPoints, error)
+
 	// DeleteSrvTabletType deletes the serving records for a cell,
 	// keyspace, shard, tabletType.
 	// Can return ErrNoNode.
@@ -197,6 +349,11 @@ type Server interface {
 	// Can return ErrNoNode.
 	GetSrvShard(cell, keyspace, shard string) (*SrvShard, error)
 
+	// DeleteSrvShard deletes a SrvShard record, and the serving
+	// records of all its tablet types.
+	// Can return ErrNoNode.
+	DeleteSrvShard(cell, keyspace, shard string) error
+
 	// UpdateSrvKeyspace updates the serving records for a cell, keyspace.
 	UpdateSrvKeyspace(cell, keyspace string, srvKeyspace *SrvKeyspace) error
 
@@ -204,16 +361,41 @@ type Server interface {
 	// Can return ErrNoNode.
 	GetSrvKeyspace(cell, keyspace string) (*SrvKeyspace, error)
 
+	// DeleteSrvKeyspace deletes a SrvKeyspace record, and all
+	// the serving records of its shards.
+	// Can return ErrNoNode.
+	DeleteSrvKeyspace(cell, keyspace string) error
+
 	// GetSrvKeyspaceNames returns the list of visible Keyspaces
 	// in this cell. They shall be sorted.
 	GetSrvKeyspaceNames(cell string) ([]string, error)
 
+	// UpdateSrvKeyspaceMirror saves the copy of the serving graph
+	// of a keyspace in a cell, in the global topology.
+	UpdateSrvKeyspaceMirror(cell, keyspace string, mirror *SrvKeyspaceMirror) error
+
+	// GetSrvKeyspaceMirror reads the copy of the serving graph of
+	// a keyspace in a cell from the global topology.
+	// Can return ErrNoNode.
+	GetSrvKeyspaceMirror(cell, keyspace string) (*SrvKeyspaceMirror, error)
+
+	// GetSrvKeyspaceMirrorNames returns the keyspaces that have a
+	// copy of their serving graph in a cell. They shall be sorted.
+	GetSrvKeyspaceMirrorNames(cell string) ([]string, error)
+
 	// UpdateTabletEndpoint updates a single tablet record in the
 	// already computed serving graph. The update has to be somewhat
 	// atomic, so it requires Server intrisic knowledge.
 	// If the node doesn't exist, it is not updated, this is not an error.
 	UpdateTabletEndpoint(cell, keyspace, shard string, tabletType TabletType, addr *EndPoint) error
 
+	// RemoveTabletEndpoint removes a single tablet record from the
+	// already computed serving graph, with the same atomicity as
+	// UpdateTabletEndpoint. It is used by the tablets going into
+	// lameduck, so the clients stop sending them queries.
+	// If the node or the record don't exist, this is not an error.
+	RemoveTabletEndpoint(cell, keyspace, shard string, tabletType TabletType, uid uint32) error
+
 	//
 	// Keyspace and Shard locks for actions, global.
 	//
@@ -307,6 +489,24 @@ type Server interface {
 	UnblockTabletAction(actionPath string) error
 }
 
+// DeadlineServer is implemented by the Servers that can bound the
+// duration of their calls.
+type DeadlineServer interface {
+	// WithDeadline returns a Server with the same data, whose
+	// calls fail once deadline is reached, or interrupted is
+	// closed, instead of blocking on a hung backend.
+	WithDeadline(deadline time.Time, interrupted chan struct{}) Server
+}
+
+// WithDeadline returns a version of ts whose calls respect deadline
+// and interrupted, or ts itself if it is not a DeadlineServer.
+func WithDeadline(ts Server, deadline time.Time, interrupted chan struct{}) Server {
+	if dts, ok := ts.(DeadlineServer); ok {
+		return dts.WithDeadline(deadline, interrupted)
+	}
+	return ts
+}
+
 // Registry for Server implementations.
 var serverImpls map[string]Server = make(map[string]Server)
 
@@ -36,7 +36,9 @@ type SourceShard struct {
 	// the source shard keyrange
 	KeyRange key.KeyRange
 
-	// we could add other filtering information, like table list, ...
+	// Tables is the list of tables to replicate, for vertical
+	// splits. If empty, the KeyRange is used instead.
+	Tables []string
 }
 
 func (source *SourceShard) String() string {
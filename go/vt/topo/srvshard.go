@@ -213,6 +213,23 @@ type SrvKeyspace struct {
 	version int64
 }
 
+// SrvKeyspaceMirror is a copy of the serving graph of a keyspace in a
+// cell, saved in the global topology by the keyspace rebuilds. The
+// clients of the cell can read it when the topology server of the
+// cell is down.
+// In zk, it is in /zk/global/vt/ns_mirrors/<cell>/<keyspace>
+type SrvKeyspaceMirror struct {
+	SrvKeyspace *SrvKeyspace
+
+	// EndPoints are the serving addresses of the cell, per shard
+	// and tablet type.
+	EndPoints map[string]map[TabletType]*EndPoints
+
+	// RebuildTime is when the mirror was saved, in seconds since
+	// the epoch.
+	RebuildTime int64
+}
+
 func NewSrvKeyspace(version int64) *SrvKeyspace {
 	return &SrvKeyspace{
 		version: version,
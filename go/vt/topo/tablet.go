@@ -12,6 +12,7 @@ import (
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/netutil"
 	"github.com/youtube/vitess/go/vt/key"
 )
 
@@ -285,7 +286,8 @@ func IsSlaveType(tt TabletType) bool {
 	return true
 }
 
-// TabletState describe if the tablet is read-only or read-write.
+// TabletState describe if the tablet is read-only or read-write,
+// or fenced.
 type TabletState string
 
 const (
@@ -295,6 +297,10 @@ const (
 	// The normal state for a slave, or temporarily a master. Not
 	// to be confused with type, which implies a workload.
 	STATE_READ_ONLY = TabletState("ReadOnly")
+
+	// A master being demoted by a reparent: it is read-only, and
+	// doesn't serve queries any more.
+	STATE_FENCED = TabletState("Fenced")
 )
 
 // Tablet is a pure data struct for information serialized into json
@@ -304,7 +310,11 @@ type Tablet struct {
 
 	Alias    TabletAlias
 	Hostname string
-	IPAddr   string
+	IPAddr   string // may be an IPv6 address
+
+	// PublishIPAddr is true if the tablet is published in the
+	// serving graph with IPAddr instead of Hostname.
+	PublishIPAddr bool
 
 	// Named port names. Currently supported ports: vt, vts,
 	// mysql.
@@ -322,6 +332,11 @@ type Tablet struct {
 	// hard to rename.
 	DbNameOverride string
 	KeyRange       key.KeyRange
+
+	// ScrapTime is when the tablet was scrapped, in seconds since
+	// the epoch. The record of a scrapped tablet, and its action
+	// history, are kept until it is purged.
+	ScrapTime int64
 }
 
 // ValidatePortmap returns an error if the tablet's portmap doesn't
@@ -336,16 +351,65 @@ func (tablet *Tablet) ValidatePortmap() error {
 	return nil
 }
 
+// reservedPortNames are the tablet ports that are always registered
+// by vttablet, see ParseNamedPorts.
+var reservedPortNames = []string{"vt", "vts", "mysql"}
+
+// IsReservedPortName returns true for the ports that vttablet always
+// registers.
+func IsReservedPortName(name string) bool {
+	for _, reserved := range reservedPortNames {
+		if name == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNamedPorts parses the additional ports of a tablet, given as
+// name:port,... (for instance grpc:15991,debug:15102). The reserved
+// port names (vt, vts, mysql) cannot be used.
+func ParseNamedPorts(value string) (map[string]int, error) {
+	result := make(map[string]int)
+	if value == "" {
+		return result, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid named port %v, expected name:port", pair)
+		}
+		if IsReservedPortName(parts[0]) {
+			return nil, fmt.Errorf("port name %v is reserved", parts[0])
+		}
+		port, err := strconv.Atoi(parts[1])
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port for %v: %v", parts[0], parts[1])
+		}
+		result[parts[0]] = port
+	}
+	return result, nil
+}
+
 func (tablet *Tablet) Addr() string {
-	return fmt.Sprintf("%v:%v", tablet.Hostname, tablet.Portmap["vt"])
+	return netutil.JoinHostPort(tablet.Hostname, tablet.Portmap["vt"])
 }
 
 func (tablet *Tablet) MysqlAddr() string {
-	return fmt.Sprintf("%v:%v", tablet.Hostname, tablet.Portmap["mysql"])
+	return netutil.JoinHostPort(tablet.Hostname, tablet.Portmap["mysql"])
 }
 
 func (tablet *Tablet) MysqlIpAddr() string {
-	return fmt.Sprintf("%v:%v", tablet.IPAddr, tablet.Portmap["mysql"])
+	return netutil.JoinHostPort(tablet.IPAddr, tablet.Portmap["mysql"])
+}
+
+// EndPointHost returns the host of the tablet in the serving graph:
+// its IP address if it publishes it, its hostname otherwise.
+func (tablet *Tablet) EndPointHost() string {
+	if tablet.PublishIPAddr && tablet.IPAddr != "" {
+		return tablet.IPAddr
+	}
+	return tablet.Hostname
 }
 
 // DbName is usually implied by keyspace. Having the shard information in the
@@ -0,0 +1,96 @@
+// package test contains utilities to test topo.Server
+// implementations. If you are testing your implementation, you will
+// want to call CheckAll in your test method. For an example, look at
+// the tests in github.com/youtube/vitess/go/vt/zktopo.
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func CheckCell(t *testing.T, ts topo.Server) {
+	if _, err := ts.GetCellInfo("cell2"); err != topo.ErrNoNode {
+		t.Errorf("GetCellInfo(missing): %v", err)
+	}
+	if err := ts.DeleteCell("cell2"); err != topo.ErrNoNode {
+		t.Errorf("DeleteCell(missing): %v", err)
+	}
+	if err := ts.UpdateCellInfo("cell2", &topo.CellInfo{ServerAddress: "cell2host:2181"}); err != topo.ErrNoNode {
+		t.Errorf("UpdateCellInfo(missing): %v", err)
+	}
+
+	ci := &topo.CellInfo{ServerAddress: "cell2host:2181"}
+	if err := ts.CreateCell("cell2", ci); err != nil {
+		t.Fatalf("CreateCell: %v", err)
+	}
+	if err := ts.CreateCell("cell2", ci); err != topo.ErrNodeExists {
+		t.Errorf("CreateCell(again): %v", err)
+	}
+	if got, err := ts.GetCellInfo("cell2"); err != nil || *got != *ci {
+		t.Errorf("GetCellInfo: %v %v", got, err)
+	}
+	cells, err := ts.GetKnownCells()
+	if err != nil {
+		t.Fatalf("GetKnownCells: %v", err)
+	}
+	found := false
+	for _, cell := range cells {
+		found = found || cell == "cell2"
+	}
+	if !found {
+		t.Errorf("GetKnownCells should have the new cell: %v", cells)
+	}
+	if aliases, err := ts.GetTabletsByCell("cell2"); err != nil || len(aliases) != 0 {
+		t.Errorf("GetTabletsByCell(new cell): %v %v", aliases, err)
+	}
+
+	ci.ServerAddress = "cell2host:2181,cell2host2:2181"
+	if err := ts.UpdateCellInfo("cell2", ci); err != nil {
+		t.Errorf("UpdateCellInfo: %v", err)
+	}
+	if got, err := ts.GetCellInfo("cell2"); err != nil || *got != *ci {
+		t.Errorf("GetCellInfo(updated): %v %v", got, err)
+	}
+
+	if err := ts.DeleteCell("cell2"); err != nil {
+		t.Errorf("DeleteCell: %v", err)
+	}
+	if _, err := ts.GetCellInfo("cell2"); err != topo.ErrNoNode {
+		t.Errorf("GetCellInfo(deleted): %v", err)
+	}
+}
+
+func CheckCellsAlias(t *testing.T, ts topo.Server) {
+	if aliases, err := ts.GetCellsAliases(); err != nil || len(aliases) != 0 {
+		t.Errorf("GetCellsAliases(empty): %v %v", aliases, err)
+	}
+	if err := ts.DeleteCellsAlias("region1"); err != topo.ErrNoNode {
+		t.Errorf("DeleteCellsAlias(missing): %v", err)
+	}
+
+	ca := &topo.CellsAlias{Cells: []string{"cell1", "cell2"}}
+	if err := ts.SaveCellsAlias("region1", ca); err != nil {
+		t.Fatalf("SaveCellsAlias: %v", err)
+	}
+	ca.Cells = append(ca.Cells, "cell3")
+	if err := ts.SaveCellsAlias("region1", ca); err != nil {
+		t.Fatalf("SaveCellsAlias(again): %v", err)
+	}
+	if err := ts.SaveCellsAlias("region2", &topo.CellsAlias{Cells: []string{"cell4"}}); err != nil {
+		t.Fatalf("SaveCellsAlias(region2): %v", err)
+	}
+	aliases, err := ts.GetCellsAliases()
+	if err != nil || len(aliases) != 2 || !reflect.DeepEqual(aliases["region1"], ca) {
+		t.Errorf("GetCellsAliases: %v %v", aliases, err)
+	}
+
+	if err := ts.DeleteCellsAlias("region2"); err != nil {
+		t.Errorf("DeleteCellsAlias: %v", err)
+	}
+	if aliases, err := ts.GetCellsAliases(); err != nil || len(aliases) != 1 {
+		t.Errorf("GetCellsAliases(after delete): %v %v", aliases, err)
+	}
+}
@@ -0,0 +1,72 @@
+// package test contains utilities to test topo.Server
+// implementations. If you are testing your implementation, you will
+// want to call CheckAll in your test method. For an example, look at
+// the tests in github.com/youtube/vitess/go/vt/zktopo.
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func CheckDiffReport(t *testing.T, ts topo.Server) {
+	if err := ts.CreateKeyspace("test_keyspace"); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	if err := ts.CreateShard("test_keyspace", "-80", &topo.Shard{}); err != nil {
+		t.Fatalf("CreateShard: %v", err)
+	}
+
+	uids, err := ts.GetDiffReports("test_keyspace", "-80")
+	if err != nil || len(uids) != 0 {
+		t.Errorf("GetDiffReports(empty): %v %v", uids, err)
+	}
+	if _, err := ts.GetDiffReport("test_keyspace", "-80", "0000000001"); err != topo.ErrNoNode {
+		t.Errorf("GetDiffReport(missing): %v", err)
+	}
+
+	dr := &topo.DiffReport{
+		Worker:            "SplitDiff",
+		SourceKeyspace:    "test_keyspace",
+		SourceShard:       "0",
+		SourceTablet:      topo.TabletAlias{Cell: "test", Uid: 1},
+		DestinationTablet: topo.TabletAlias{Cell: "test", Uid: 2},
+		StartTime:         10,
+		EndTime:           20,
+		Tables: map[string]*topo.TableDiffReport{
+			"t1": &topo.TableDiffReport{ProcessedRows: 3, MatchingRows: 2, ExtraRowsLeft: 1, Samples: []string{"extra row on the left: [1]"}},
+		},
+	}
+	uid1, err := ts.CreateDiffReport("test_keyspace", "-80", dr)
+	if err != nil {
+		t.Fatalf("CreateDiffReport: %v", err)
+	}
+	uid2, err := ts.CreateDiffReport("test_keyspace", "-80", &topo.DiffReport{Worker: "SplitDiff", Error: "interrupted"})
+	if err != nil {
+		t.Fatalf("CreateDiffReport: %v", err)
+	}
+	if uid1 == uid2 {
+		t.Errorf("CreateDiffReport returned the same id twice: %v", uid1)
+	}
+
+	uids, err = ts.GetDiffReports("test_keyspace", "-80")
+	if err != nil {
+		t.Errorf("GetDiffReports: %v", err)
+	}
+	if len(uids) != 2 || uids[0] != uid1 || uids[1] != uid2 {
+		t.Errorf("GetDiffReports: want %v, got %v", []string{uid1, uid2}, uids)
+	}
+
+	got, err := ts.GetDiffReport("test_keyspace", "-80", uid1)
+	if err != nil {
+		t.Fatalf("GetDiffReport: %v", err)
+	}
+	if !reflect.DeepEqual(got, dr) {
+		t.Errorf("GetDiffReport: want %#v, got %#v", dr, got)
+	}
+	if !got.HasDifferences() {
+		t.Errorf("GetDiffReport: the report should have differences")
+	}
+}
@@ -0,0 +1,55 @@
+// package test contains utilities to test topo.Server
+// implementations. If you are testing your implementation, you will
+// want to call CheckAll in your test method. For an example, look at
+// the tests in github.com/youtube/vitess/go/vt/zktopo.
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func CheckFreeze(t *testing.T, ts topo.Server) {
+	if _, err := ts.GetTopologyFreeze(); err != topo.ErrNoNode {
+		t.Errorf("GetTopologyFreeze(not frozen): %v", err)
+	}
+	if err := ts.UnfreezeTopology(); err != topo.ErrNoNode {
+		t.Errorf("UnfreezeTopology(not frozen): %v", err)
+	}
+
+	freeze := &topo.Freeze{Reason: "maintenance", Time: 1234}
+	if err := ts.FreezeTopology(freeze); err != nil {
+		t.Fatalf("FreezeTopology: %v", err)
+	}
+	if err := ts.FreezeTopology(freeze); err != topo.ErrNodeExists {
+		t.Errorf("FreezeTopology(again): %v", err)
+	}
+	if got, err := ts.GetTopologyFreeze(); err != nil || *got != *freeze {
+		t.Errorf("GetTopologyFreeze: %v %v", got, err)
+	}
+
+	// changes fail, reads work
+	// (the FrozenError may be wrapped by the implementation)
+	if err := ts.CreateKeyspace("test_keyspace"); err == nil || !strings.Contains(err.Error(), "topology is frozen") {
+		t.Errorf("CreateKeyspace(frozen): %v", err)
+	}
+	if _, err := ts.GetKeyspaces(); err != nil {
+		t.Errorf("GetKeyspaces(frozen): %v", err)
+	}
+
+	// unless the freeze is bypassed
+	*topo.BypassFreeze = true
+	if err := ts.CreateKeyspace("test_keyspace"); err != nil {
+		t.Errorf("CreateKeyspace(bypass): %v", err)
+	}
+	*topo.BypassFreeze = false
+
+	if err := ts.UnfreezeTopology(); err != nil {
+		t.Fatalf("UnfreezeTopology: %v", err)
+	}
+	if err := ts.CreateShard("test_keyspace", "0", &topo.Shard{}); err != nil {
+		t.Errorf("CreateShard(unfrozen): %v", err)
+	}
+}
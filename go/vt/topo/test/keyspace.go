@@ -44,4 +44,21 @@ func CheckKeyspace(t *testing.T, ts topo.Server) {
 	if len(keyspaces) != 2 || keyspaces[0] != "test_keyspace" || keyspaces[1] != "test_keyspace2" {
 		t.Errorf("GetKeyspaces: want %v, got %v", []string{"test_keyspace", "test_keyspace2"}, keyspaces)
 	}
+
+	if err := topo.CreateShard(ts, "test_keyspace", "0"); err != nil {
+		t.Fatalf("CreateShard: %v", err)
+	}
+	if err := ts.DeleteKeyspace("test_keyspace"); err != topo.ErrNotEmpty {
+		t.Errorf("DeleteKeyspace(with shards): %v", err)
+	}
+	if err := ts.DeleteKeyspace("test_keyspace2"); err != nil {
+		t.Errorf("DeleteKeyspace: %v", err)
+	}
+	if err := ts.DeleteKeyspace("test_keyspace2"); err != topo.ErrNoNode {
+		t.Errorf("DeleteKeyspace(again): %v", err)
+	}
+	keyspaces, err = ts.GetKeyspaces()
+	if err != nil || len(keyspaces) != 1 || keyspaces[0] != "test_keyspace" {
+		t.Errorf("GetKeyspaces(after delete): %v %v", keyspaces, err)
+	}
 }
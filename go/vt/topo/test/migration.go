@@ -0,0 +1,74 @@
+// package test contains utilities to test topo.Server
+// implementations. If you are testing your implementation, you will
+// want to call CheckAll in your test method. For an example, look at
+// the tests in github.com/youtube/vitess/go/vt/zktopo.
+package test
+
+import (
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func CheckSchemaMigration(t *testing.T, ts topo.Server) {
+	if err := ts.CreateKeyspace("test_keyspace"); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+
+	uids, err := ts.GetSchemaMigrations("test_keyspace")
+	if err != nil || len(uids) != 0 {
+		t.Errorf("GetSchemaMigrations(empty): %v %v", uids, err)
+	}
+	if _, err := ts.GetSchemaMigration("test_keyspace", "0000000001"); err != topo.ErrNoNode {
+		t.Errorf("GetSchemaMigration(missing): %v", err)
+	}
+	if err := ts.UpdateSchemaMigrationFields("test_keyspace", "0000000001", func(sm *topo.SchemaMigration) error {
+		return nil
+	}); err != topo.ErrNoNode {
+		t.Errorf("UpdateSchemaMigrationFields(missing): %v", err)
+	}
+
+	uid1, err := ts.CreateSchemaMigration("test_keyspace", topo.NewSchemaMigration("alter table t1 add column c int", []string{"-80", "80-"}))
+	if err != nil {
+		t.Fatalf("CreateSchemaMigration: %v", err)
+	}
+	uid2, err := ts.CreateSchemaMigration("test_keyspace", topo.NewSchemaMigration("alter table t2 add column c int", []string{"-80", "80-"}))
+	if err != nil {
+		t.Fatalf("CreateSchemaMigration: %v", err)
+	}
+	if uid1 == uid2 {
+		t.Errorf("CreateSchemaMigration returned the same id twice: %v", uid1)
+	}
+
+	uids, err = ts.GetSchemaMigrations("test_keyspace")
+	if err != nil {
+		t.Errorf("GetSchemaMigrations: %v", err)
+	}
+	if len(uids) != 2 || uids[0] != uid1 || uids[1] != uid2 {
+		t.Errorf("GetSchemaMigrations: want %v, got %v", []string{uid1, uid2}, uids)
+	}
+
+	if err := ts.UpdateSchemaMigrationFields("test_keyspace", uid1, func(sm *topo.SchemaMigration) error {
+		sm.State = topo.MIGRATION_RUNNING
+		sm.Shards["-80"].State = topo.MIGRATION_FAILED
+		sm.Shards["-80"].Attempts++
+		sm.Shards["-80"].Error = "tool failed"
+		return nil
+	}); err != nil {
+		t.Errorf("UpdateSchemaMigrationFields: %v", err)
+	}
+
+	sm, err := ts.GetSchemaMigration("test_keyspace", uid1)
+	if err != nil {
+		t.Fatalf("GetSchemaMigration: %v", err)
+	}
+	if sm.Sql != "alter table t1 add column c int" || sm.State != topo.MIGRATION_RUNNING {
+		t.Errorf("GetSchemaMigration: bad migration: %v", sm)
+	}
+	if s := sm.Shards["-80"]; s == nil || s.State != topo.MIGRATION_FAILED || s.Attempts != 1 || s.Error != "tool failed" {
+		t.Errorf("GetSchemaMigration: bad shard -80: %v", s)
+	}
+	if s := sm.Shards["80-"]; s == nil || s.State != topo.MIGRATION_PENDING {
+		t.Errorf("GetSchemaMigration: bad shard 80-: %v", s)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func CheckRoutingRules(t *testing.T, ts topo.Server) {
+	if rr, err := ts.GetRoutingRules(); err != nil || len(rr.Rules) != 0 {
+		t.Errorf("GetRoutingRules(empty): %v %v", rr, err)
+	}
+
+	rr := topo.NewRoutingRules()
+	rr.SetRule(&topo.RoutingRule{FromKeyspace: "ks1", FromTabletType: topo.TYPE_REPLICA, ToKeyspace: "ks2"})
+	if err := ts.SaveRoutingRules(rr); err != nil {
+		t.Fatalf("SaveRoutingRules: %v", err)
+	}
+	rr.SetRule(&topo.RoutingRule{FromKeyspace: "ks3", ToKeyspace: "ks3", ToTabletType: topo.TYPE_MASTER})
+	if err := ts.SaveRoutingRules(rr); err != nil {
+		t.Fatalf("SaveRoutingRules(again): %v", err)
+	}
+	got, err := ts.GetRoutingRules()
+	if err != nil || !reflect.DeepEqual(got, rr) {
+		t.Errorf("GetRoutingRules: want %v, got %v %v", rr, got, err)
+	}
+}
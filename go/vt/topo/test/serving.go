@@ -48,6 +48,12 @@ func CheckServingGraph(t *testing.T, ts topo.Server) {
 	if pm := addrs.Entries[0].NamedPortMap; pm["_vt"] != 1234 || pm["_mysql"] != 1235 || pm["_vts"] != 1236 {
 		t.Errorf("GetSrcTabletType(1).NamedPortmap: want %v, got %v", endPoints.Entries[0].NamedPortMap, pm)
 	}
+	if _, err := ts.GetEndPointsPerShard(cell, "test_keyspace", "-20"); err != topo.ErrNoNode {
+		t.Errorf("GetEndPointsPerShard(invalid): %v", err)
+	}
+	if perShard, err := ts.GetEndPointsPerShard(cell, "test_keyspace", "-10"); err != nil || len(perShard) != 1 || perShard[topo.TYPE_MASTER] == nil || len(perShard[topo.TYPE_MASTER].Entries) != 1 || perShard[topo.TYPE_MASTER].Entries[0].Uid != 1 {
+		t.Errorf("GetEndPointsPerShard: %v %v", err, perShard)
+	}
 
 	if err := ts.UpdateTabletEndpoint(cell, "test_keyspace", "-10", topo.TYPE_REPLICA, &topo.EndPoint{Uid: 2, Host: "host2"}); err != nil {
 		t.Errorf("UpdateTabletEndpoint(invalid): %v", err)
@@ -64,6 +70,18 @@ func CheckServingGraph(t *testing.T, ts topo.Server) {
 	if addrs, err := ts.GetEndPoints(cell, "test_keyspace", "-10", topo.TYPE_MASTER); err != nil || len(addrs.Entries) != 2 {
 		t.Errorf("GetEndPoints(2): %v %v", err, addrs)
 	}
+	if err := ts.RemoveTabletEndpoint(cell, "test_keyspace", "-10", topo.TYPE_REPLICA, 2); err != nil {
+		t.Errorf("RemoveTabletEndpoint(invalid): %v", err)
+	}
+	if err := ts.RemoveTabletEndpoint(cell, "test_keyspace", "-10", topo.TYPE_MASTER, 1); err != nil {
+		t.Errorf("RemoveTabletEndpoint(master): %v", err)
+	}
+	if err := ts.RemoveTabletEndpoint(cell, "test_keyspace", "-10", topo.TYPE_MASTER, 1); err != nil {
+		t.Errorf("RemoveTabletEndpoint(master, again): %v", err)
+	}
+	if addrs, err := ts.GetEndPoints(cell, "test_keyspace", "-10", topo.TYPE_MASTER); err != nil || len(addrs.Entries) != 1 || addrs.Entries[0].Uid != 3 {
+		t.Errorf("GetEndPoints(3): %v %v", err, addrs)
+	}
 
 	if err := ts.DeleteSrvTabletType(cell, "test_keyspace", "-10", topo.TYPE_REPLICA); err != topo.ErrNoNode {
 		t.Errorf("DeleteSrvTabletType(unknown): %v", err)
@@ -123,4 +141,67 @@ func CheckServingGraph(t *testing.T, ts topo.Server) {
 	if k, err := ts.GetSrvKeyspaceNames(cell); err != nil || len(k) != 1 || k[0] != "test_keyspace" {
 		t.Errorf("GetSrvKeyspaceNames(): %v", err)
 	}
+
+	if err := ts.DeleteSrvShard(cell, "test_keyspace", "-10"); err != nil {
+		t.Errorf("DeleteSrvShard: %v", err)
+	}
+	if _, err := ts.GetSrvShard(cell, "test_keyspace", "-10"); err != topo.ErrNoNode {
+		t.Errorf("GetSrvShard(deleted): %v", err)
+	}
+	if err := ts.DeleteSrvKeyspace(cell, "test_keyspace"); err != nil {
+		t.Errorf("DeleteSrvKeyspace: %v", err)
+	}
+	if _, err := ts.GetSrvKeyspace(cell, "test_keyspace"); err != topo.ErrNoNode {
+		t.Errorf("GetSrvKeyspace(deleted): %v", err)
+	}
+	if err := ts.DeleteSrvKeyspace(cell, "test_keyspace"); err != topo.ErrNoNode {
+		t.Errorf("DeleteSrvKeyspace(again): %v", err)
+	}
+}
+
+func CheckSrvKeyspaceMirror(t *testing.T, ts topo.Server) {
+	cell := getLocalCell(t, ts)
+
+	if _, err := ts.GetSrvKeyspaceMirror(cell, "test_keyspace"); err != topo.ErrNoNode {
+		t.Errorf("GetSrvKeyspaceMirror(missing): %v", err)
+	}
+	if names, err := ts.GetSrvKeyspaceMirrorNames(cell); err != nil || len(names) != 0 {
+		t.Errorf("GetSrvKeyspaceMirrorNames(empty): %v %v", names, err)
+	}
+
+	mirror := &topo.SrvKeyspaceMirror{
+		SrvKeyspace: &topo.SrvKeyspace{
+			TabletTypes: []topo.TabletType{topo.TYPE_MASTER},
+		},
+		EndPoints: map[string]map[topo.TabletType]*topo.EndPoints{
+			"-10": map[topo.TabletType]*topo.EndPoints{
+				topo.TYPE_MASTER: &topo.EndPoints{
+					Entries: []topo.EndPoint{
+						topo.EndPoint{Uid: 1, Host: "host1", NamedPortMap: map[string]int{"_vtocc": 1234}},
+					},
+				},
+			},
+		},
+		RebuildTime: 1234,
+	}
+	if err := ts.UpdateSrvKeyspaceMirror(cell, "test_keyspace", mirror); err != nil {
+		t.Fatalf("UpdateSrvKeyspaceMirror: %v", err)
+	}
+	mirror.RebuildTime = 1235
+	if err := ts.UpdateSrvKeyspaceMirror(cell, "test_keyspace", mirror); err != nil {
+		t.Fatalf("UpdateSrvKeyspaceMirror(again): %v", err)
+	}
+	got, err := ts.GetSrvKeyspaceMirror(cell, "test_keyspace")
+	if err != nil {
+		t.Fatalf("GetSrvKeyspaceMirror: %v", err)
+	}
+	if got.RebuildTime != 1235 || len(got.SrvKeyspace.TabletTypes) != 1 {
+		t.Errorf("GetSrvKeyspaceMirror: %#v", got)
+	}
+	if addrs := got.EndPoints["-10"][topo.TYPE_MASTER]; addrs == nil || len(addrs.Entries) != 1 || addrs.Entries[0].NamedPortMap["_vtocc"] != 1234 {
+		t.Errorf("GetSrvKeyspaceMirror end points: %v", got.EndPoints)
+	}
+	if names, err := ts.GetSrvKeyspaceMirrorNames(cell); err != nil || len(names) != 1 || names[0] != "test_keyspace" {
+		t.Errorf("GetSrvKeyspaceMirrorNames: %v %v", names, err)
+	}
 }
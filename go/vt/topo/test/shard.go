@@ -79,4 +79,13 @@ func CheckShard(t *testing.T, ts topo.Server) {
 		t.Errorf("GetShardNames(666): %v", err)
 	}
 
+	if err := ts.DeleteShard("test_keyspace", "B0-C0"); err != nil {
+		t.Errorf("DeleteShard: %v", err)
+	}
+	if _, err := ts.GetShard("test_keyspace", "B0-C0"); err != topo.ErrNoNode {
+		t.Errorf("GetShard(deleted): %v", err)
+	}
+	if err := ts.DeleteShard("test_keyspace", "B0-C0"); err != topo.ErrNoNode {
+		t.Errorf("DeleteShard(again): %v", err)
+	}
 }
@@ -74,6 +74,17 @@ func CheckTablet(t *testing.T, ts topo.Server) {
 		t.Errorf("GetTabletsByCell: want [%v], got %v", tablet.Alias, inCell)
 	}
 
+	if _, err := ts.GetTabletMapForCell("666"); err != topo.ErrNoNode {
+		t.Errorf("GetTabletMapForCell(666): %v", err)
+	}
+	tabletMap, err := ts.GetTabletMapForCell(cell)
+	if err != nil {
+		t.Errorf("GetTabletMapForCell: %v", err)
+	}
+	if tmi, ok := tabletMap[tablet.Alias]; len(tabletMap) != 1 || !ok || tmi.Hostname != tablet.Hostname || tmi.Version() != ti.Version() {
+		t.Errorf("GetTabletMapForCell: want %v, got %v", tablet.Alias, tabletMap)
+	}
+
 	ti.State = topo.STATE_READ_ONLY
 	if err := topo.UpdateTablet(ts, ti); err != nil {
 		t.Errorf("UpdateTablet: %v", err)
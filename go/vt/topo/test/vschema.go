@@ -0,0 +1,57 @@
+// package test contains utilities to test topo.Server
+// implementations. If you are testing your implementation, you will
+// want to call CheckAll in your test method. For an example, look at
+// the tests in github.com/youtube/vitess/go/vt/zktopo.
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func CheckVSchema(t *testing.T, ts topo.Server) {
+	if err := ts.SaveVSchema("test_keyspace", topo.NewVSchema(false)); err != topo.ErrNoNode {
+		t.Errorf("SaveVSchema(no keyspace): %v", err)
+	}
+	if err := ts.CreateKeyspace("test_keyspace"); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	if _, err := ts.GetVSchema("test_keyspace"); err != topo.ErrNoNode {
+		t.Errorf("GetVSchema(missing): %v", err)
+	}
+
+	vschema := topo.NewVSchema(true)
+	vschema.Tables["user"] = &topo.VSchemaTable{
+		ShardingKey: "user_id",
+		Lookups: []*topo.VSchemaLookup{{
+			Column:     "name",
+			Keyspace:   "lookup",
+			Table:      "name_user_idx",
+			FromColumn: "name",
+			ToColumn:   "keyspace_id",
+		}},
+	}
+	if err := ts.SaveVSchema("test_keyspace", vschema); err != nil {
+		t.Fatalf("SaveVSchema: %v", err)
+	}
+	got, err := ts.GetVSchema("test_keyspace")
+	if err != nil || !reflect.DeepEqual(got, vschema) {
+		t.Errorf("GetVSchema: want %#v, got %#v %v", vschema, got, err)
+	}
+
+	vschema.Tables["user_extra"] = &topo.VSchemaTable{ShardingKey: "user_id"}
+	if err := ts.SaveVSchema("test_keyspace", vschema); err != nil {
+		t.Fatalf("SaveVSchema(update): %v", err)
+	}
+	got, err = ts.GetVSchema("test_keyspace")
+	if err != nil || len(got.Tables) != 2 {
+		t.Errorf("GetVSchema(updated): %#v %v", got, err)
+	}
+
+	keyspaces, err := ts.GetKeyspaces()
+	if err != nil || len(keyspaces) != 1 {
+		t.Errorf("the vschema should not change the keyspaces: %v %v", keyspaces, err)
+	}
+}
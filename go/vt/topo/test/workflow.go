@@ -0,0 +1,78 @@
+// package test contains utilities to test topo.Server
+// implementations. If you are testing your implementation, you will
+// want to call CheckAll in your test method. For an example, look at
+// the tests in github.com/youtube/vitess/go/vt/zktopo.
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func CheckWorkflow(t *testing.T, ts topo.Server) {
+	if err := ts.CreateKeyspace("test_keyspace"); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+
+	uids, err := ts.GetWorkflows("test_keyspace")
+	if err != nil || len(uids) != 0 {
+		t.Errorf("GetWorkflows(empty): %v %v", uids, err)
+	}
+	if _, err := ts.GetWorkflow("test_keyspace", "0000000001"); err != topo.ErrNoNode {
+		t.Errorf("GetWorkflow(missing): %v", err)
+	}
+	if err := ts.UpdateWorkflowFields("test_keyspace", "0000000001", func(wf *topo.Workflow) error {
+		return nil
+	}); err != topo.ErrNoNode {
+		t.Errorf("UpdateWorkflowFields(missing): %v", err)
+	}
+
+	params := map[string]string{"shard": "0"}
+	uid1, err := ts.CreateWorkflow("test_keyspace", topo.NewWorkflow("Test", params, []string{"first", "second"}))
+	if err != nil {
+		t.Fatalf("CreateWorkflow: %v", err)
+	}
+	uid2, err := ts.CreateWorkflow("test_keyspace", topo.NewWorkflow("Test", params, []string{"first"}))
+	if err != nil {
+		t.Fatalf("CreateWorkflow: %v", err)
+	}
+	if uid1 == uid2 {
+		t.Errorf("CreateWorkflow returned the same id twice: %v", uid1)
+	}
+
+	uids, err = ts.GetWorkflows("test_keyspace")
+	if err != nil {
+		t.Errorf("GetWorkflows: %v", err)
+	}
+	if !reflect.DeepEqual(uids, []string{uid1, uid2}) {
+		t.Errorf("GetWorkflows: want %v, got %v", []string{uid1, uid2}, uids)
+	}
+
+	if err := ts.UpdateWorkflowFields("test_keyspace", uid1, func(wf *topo.Workflow) error {
+		wf.State = topo.WORKFLOW_FAILED
+		wf.Steps[0].State = topo.WORKFLOW_DONE
+		wf.Steps[1].State = topo.WORKFLOW_FAILED
+		wf.Steps[1].Error = "step failed"
+		wf.Data["position"] = "42"
+		return nil
+	}); err != nil {
+		t.Errorf("UpdateWorkflowFields: %v", err)
+	}
+
+	wf, err := ts.GetWorkflow("test_keyspace", uid1)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	if wf.Name != "Test" || wf.State != topo.WORKFLOW_FAILED || !reflect.DeepEqual(wf.Params, params) || wf.Data["position"] != "42" {
+		t.Errorf("GetWorkflow: bad workflow: %v", wf)
+	}
+	want := []*topo.WorkflowStep{
+		{Name: "first", State: topo.WORKFLOW_DONE},
+		{Name: "second", State: topo.WORKFLOW_FAILED, Error: "step failed"},
+	}
+	if !reflect.DeepEqual(wf.Steps, want) {
+		t.Errorf("GetWorkflow: bad steps: %v", wf.Steps)
+	}
+}
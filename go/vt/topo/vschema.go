@@ -0,0 +1,110 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+import (
+	"fmt"
+)
+
+// This file contains the VSchema object, the routing metadata of a
+// keyspace. It is stored in the global topology, so vtgate can find
+// the shards of a query without the client computing keyspace ids.
+
+// VSchema describes how the tables of a keyspace are sharded.
+type VSchema struct {
+	// Sharded is false for keyspaces with a single shard, that
+	// has all the rows of every table.
+	Sharded bool
+
+	// Resolver is the name of the key.KeyspaceIdResolver that
+	// computes keyspace ids from the sharding columns. Empty
+	// means numeric.
+	Resolver string
+
+	Tables map[string]*VSchemaTable
+}
+
+// VSchemaTable describes how the rows of a table are found.
+type VSchemaTable struct {
+	// ShardingKey is the column the keyspace id of a row is
+	// computed from. It is required in sharded keyspaces, unless
+	// ShardingColumns is set.
+	ShardingKey string
+
+	// ShardingColumns replaces ShardingKey when the keyspace id is
+	// computed from more than one column.
+	ShardingColumns []string
+
+	// Lookups are the other columns that can be mapped to
+	// keyspace ids, through a lookup table.
+	Lookups []*VSchemaLookup
+}
+
+// VSchemaLookup is a lookup table, in an unsharded keyspace, that
+// maps the values of Column to keyspace ids. FromColumn has the
+// values of Column, and ToColumn the keyspace ids.
+type VSchemaLookup struct {
+	Column     string
+	Keyspace   string
+	Table      string
+	FromColumn string
+	ToColumn   string
+}
+
+// NewVSchema returns an empty VSchema.
+func NewVSchema(sharded bool) *VSchema {
+	return &VSchema{
+		Sharded: sharded,
+		Tables:  make(map[string]*VSchemaTable),
+	}
+}
+
+// KeyColumns returns the columns the keyspace id of a row of the
+// table is computed from.
+func (table *VSchemaTable) KeyColumns() []string {
+	if len(table.ShardingColumns) != 0 {
+		return table.ShardingColumns
+	}
+	return []string{table.ShardingKey}
+}
+
+// Validate checks the VSchema is self-consistent. The checks
+// that need the rest of the topology are in the wrangler.
+func (vs *VSchema) Validate() error {
+	for name, table := range vs.Tables {
+		if name == "" {
+			return fmt.Errorf("table with no name")
+		}
+		if table == nil {
+			return fmt.Errorf("table %v has no description", name)
+		}
+		if !vs.Sharded {
+			if table.ShardingKey != "" || len(table.ShardingColumns) != 0 || len(table.Lookups) != 0 {
+				return fmt.Errorf("table %v of an unsharded keyspace cannot have a sharding key or lookups", name)
+			}
+			continue
+		}
+		if (table.ShardingKey == "") == (len(table.ShardingColumns) == 0) {
+			return fmt.Errorf("table %v has no sharding key, or both a sharding key and sharding columns", name)
+		}
+		columns := make(map[string]bool)
+		for _, column := range table.KeyColumns() {
+			if column == "" || columns[column] {
+				return fmt.Errorf("table %v has an empty or duplicate sharding column", name)
+			}
+			columns[column] = true
+		}
+		for _, lookup := range table.Lookups {
+			if lookup == nil || lookup.Column == "" || lookup.Keyspace == "" || lookup.Table == "" || lookup.FromColumn == "" || lookup.ToColumn == "" {
+				return fmt.Errorf("table %v has an incomplete lookup: %#v", name, lookup)
+			}
+			if columns[lookup.Column] {
+				return fmt.Errorf("table %v has more than one way to find the keyspace id of column %v", name, lookup.Column)
+			}
+			columns[lookup.Column] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+// This file contains the Workflow object, used to checkpoint
+// multi-step operations.
+
+// WorkflowState is the state of a Workflow, or of one of its steps.
+type WorkflowState string
+
+const (
+	// the workflow (or step) hasn't been started yet
+	WORKFLOW_PENDING = WorkflowState("pending")
+
+	// the workflow (or step) is running
+	WORKFLOW_RUNNING = WorkflowState("running")
+
+	// the workflow (or step) is done
+	WORKFLOW_DONE = WorkflowState("done")
+
+	// the workflow (or step) failed, it can be resumed or rolled back
+	WORKFLOW_FAILED = WorkflowState("failed")
+
+	// the workflow (or step) was rolled back
+	WORKFLOW_ROLLED_BACK = WorkflowState("rolled_back")
+
+	// the workflow was paused between two steps, it can be resumed
+	// or rolled back
+	WORKFLOW_PAUSED = WorkflowState("paused")
+)
+
+// WorkflowStep is the state of one step of a Workflow.
+type WorkflowStep struct {
+	Name  string
+	State WorkflowState
+
+	// Error is the error of the last failed attempt.
+	Error string
+}
+
+// Workflow is a multi-step operation, like a reparent or a served
+// type migration. It is stored in the global topology after every
+// step, so a failed workflow can be resumed from the step that
+// failed, or rolled back, by another process.
+type Workflow struct {
+	// Name is the kind of workflow, and Params its parameters:
+	// they are enough to re-create its steps.
+	Name   string
+	Params map[string]string
+
+	State WorkflowState
+	Steps []*WorkflowStep
+
+	// PauseRequested makes the workflow stop before its next step.
+	PauseRequested bool
+
+	// Data is saved by the steps, for the next ones.
+	Data map[string]string
+}
+
+// NewWorkflow returns a Workflow with all its steps in the
+// WORKFLOW_PENDING state.
+func NewWorkflow(name string, params map[string]string, steps []string) *Workflow {
+	wf := &Workflow{
+		Name:   name,
+		Params: params,
+		State:  WORKFLOW_PENDING,
+		Steps:  make([]*WorkflowStep, len(steps)),
+		Data:   make(map[string]string),
+	}
+	for i, step := range steps {
+		wf.Steps[i] = &WorkflowStep{Name: step, State: WORKFLOW_PENDING}
+	}
+	return wf
+}
@@ -87,6 +87,106 @@ func (tee *Tee) GetKnownCells() ([]string, error) {
 	return tee.readFrom.GetKnownCells()
 }
 
+func (tee *Tee) CreateCell(cell string, ci *topo.CellInfo) error {
+	if err := tee.primary.CreateCell(cell, ci); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.CreateCell(cell, ci); err != nil && err != topo.ErrNodeExists {
+		// not critical enough to fail
+		log.Warningf("secondary.CreateCell(%v) failed: %v", cell, err)
+	}
+	return nil
+}
+
+func (tee *Tee) GetCellInfo(cell string) (*topo.CellInfo, error) {
+	return tee.readFrom.GetCellInfo(cell)
+}
+
+func (tee *Tee) UpdateCellInfo(cell string, ci *topo.CellInfo) error {
+	if err := tee.primary.UpdateCellInfo(cell, ci); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.UpdateCellInfo(cell, ci); err != nil {
+		// not critical enough to fail
+		log.Warningf("secondary.UpdateCellInfo(%v) failed: %v", cell, err)
+	}
+	return nil
+}
+
+func (tee *Tee) DeleteCell(cell string) error {
+	if err := tee.primary.DeleteCell(cell); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.DeleteCell(cell); err != nil && err != topo.ErrNoNode {
+		// not critical enough to fail
+		log.Warningf("secondary.DeleteCell(%v) failed: %v", cell, err)
+	}
+	return nil
+}
+
+func (tee *Tee) SaveCellsAlias(alias string, ca *topo.CellsAlias) error {
+	if err := tee.primary.SaveCellsAlias(alias, ca); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.SaveCellsAlias(alias, ca); err != nil {
+		// not critical enough to fail
+		log.Warningf("secondary.SaveCellsAlias(%v) failed: %v", alias, err)
+	}
+	return nil
+}
+
+func (tee *Tee) GetCellsAliases() (map[string]*topo.CellsAlias, error) {
+	return tee.readFrom.GetCellsAliases()
+}
+
+func (tee *Tee) DeleteCellsAlias(alias string) error {
+	if err := tee.primary.DeleteCellsAlias(alias); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.DeleteCellsAlias(alias); err != nil && err != topo.ErrNoNode {
+		// not critical enough to fail
+		log.Warningf("secondary.DeleteCellsAlias(%v) failed: %v", alias, err)
+	}
+	return nil
+}
+
+//
+// Topology freeze, global.
+//
+
+func (tee *Tee) FreezeTopology(freeze *topo.Freeze) error {
+	if err := tee.primary.FreezeTopology(freeze); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.FreezeTopology(freeze); err != nil && err != topo.ErrNodeExists {
+		// not critical enough to fail
+		log.Warningf("secondary.FreezeTopology failed: %v", err)
+	}
+	return nil
+}
+
+func (tee *Tee) UnfreezeTopology() error {
+	if err := tee.primary.UnfreezeTopology(); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.UnfreezeTopology(); err != nil && err != topo.ErrNoNode {
+		// not critical enough to fail
+		log.Warningf("secondary.UnfreezeTopology failed: %v", err)
+	}
+	return nil
+}
+
+func (tee *Tee) GetTopologyFreeze() (*topo.Freeze, error) {
+	return tee.readFrom.GetTopologyFreeze()
+}
+
 //
 // Keyspace management, global.
 //
@@ -119,6 +219,18 @@ func (tee *Tee) DeleteKeyspaceShards(keyspace string) error {
 	return nil
 }
 
+func (tee *Tee) DeleteKeyspace(keyspace string) error {
+	if err := tee.primary.DeleteKeyspace(keyspace); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.DeleteKeyspace(keyspace); err != nil && err != topo.ErrNoNode {
+		// not critical enough to fail
+		log.Warningf("secondary.DeleteKeyspace(%v) failed: %v", keyspace, err)
+	}
+	return nil
+}
+
 //
 // Shard management, global.
 //
@@ -171,6 +283,120 @@ func (tee *Tee) GetShardNames(keyspace string) ([]string, error) {
 	return tee.readFrom.GetShardNames(keyspace)
 }
 
+func (tee *Tee) DeleteShard(keyspace, shard string) error {
+	if err := tee.primary.DeleteShard(keyspace, shard); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.DeleteShard(keyspace, shard); err != nil && err != topo.ErrNoNode {
+		// not critical enough to fail
+		log.Warningf("secondary.DeleteShard(%v, %v) failed: %v", keyspace, shard, err)
+	}
+	return nil
+}
+
+//
+// Schema migration management, global.
+// The migration ids are allocated by the topo.Server, so we only
+// store the migrations in the primary topo.Server.
+//
+
+func (tee *Tee) CreateSchemaMigration(keyspace string, sm *topo.SchemaMigration) (string, error) {
+	return tee.primary.CreateSchemaMigration(keyspace, sm)
+}
+
+func (tee *Tee) UpdateSchemaMigrationFields(keyspace, uid string, update func(*topo.SchemaMigration) error) error {
+	return tee.primary.UpdateSchemaMigrationFields(keyspace, uid, update)
+}
+
+func (tee *Tee) GetSchemaMigration(keyspace, uid string) (*topo.SchemaMigration, error) {
+	return tee.primary.GetSchemaMigration(keyspace, uid)
+}
+
+func (tee *Tee) GetSchemaMigrations(keyspace string) ([]string, error) {
+	return tee.primary.GetSchemaMigrations(keyspace)
+}
+
+//
+// Workflow management, global.
+// The workflow ids are allocated by the topo.Server, so we only
+// store the workflows in the primary topo.Server.
+//
+
+func (tee *Tee) CreateWorkflow(keyspace string, wf *topo.Workflow) (string, error) {
+	return tee.primary.CreateWorkflow(keyspace, wf)
+}
+
+func (tee *Tee) UpdateWorkflowFields(keyspace, uid string, update func(*topo.Workflow) error) error {
+	return tee.primary.UpdateWorkflowFields(keyspace, uid, update)
+}
+
+func (tee *Tee) GetWorkflow(keyspace, uid string) (*topo.Workflow, error) {
+	return tee.primary.GetWorkflow(keyspace, uid)
+}
+
+func (tee *Tee) GetWorkflows(keyspace string) ([]string, error) {
+	return tee.primary.GetWorkflows(keyspace)
+}
+
+//
+// Diff reports management, global.
+// The report ids are allocated by the topo.Server, so we only
+// store the reports in the primary topo.Server.
+//
+
+func (tee *Tee) CreateDiffReport(keyspace, shard string, dr *topo.DiffReport) (string, error) {
+	return tee.primary.CreateDiffReport(keyspace, shard, dr)
+}
+
+func (tee *Tee) GetDiffReport(keyspace, shard, uid string) (*topo.DiffReport, error) {
+	return tee.primary.GetDiffReport(keyspace, shard, uid)
+}
+
+func (tee *Tee) GetDiffReports(keyspace, shard string) ([]string, error) {
+	return tee.primary.GetDiffReports(keyspace, shard)
+}
+
+//
+// VSchema management, global.
+//
+
+func (tee *Tee) SaveVSchema(keyspace string, vschema *topo.VSchema) error {
+	if err := tee.primary.SaveVSchema(keyspace, vschema); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.SaveVSchema(keyspace, vschema); err != nil {
+		// not critical enough to fail
+		log.Warningf("secondary.SaveVSchema(%v) failed: %v", keyspace, err)
+	}
+	return nil
+}
+
+func (tee *Tee) GetVSchema(keyspace string) (*topo.VSchema, error) {
+	return tee.readFrom.GetVSchema(keyspace)
+}
+
+//
+// Routing rules management, global.
+//
+
+func (tee *Tee) SaveRoutingRules(rr *topo.RoutingRules) error {
+	if err := tee.primary.SaveRoutingRules(rr); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.SaveRoutingRules(rr); err != nil {
+		// not critical enough to fail
+		log.Warningf("secondary.SaveRoutingRules failed: %v", err)
+	}
+	return nil
+}
+
+func (tee *Tee) GetRoutingRules() (*topo.RoutingRules, error) {
+	return tee.readFrom.GetRoutingRules()
+}
+
 //
 // Tablet management, per cell.
 //
@@ -301,6 +527,10 @@ func (tee *Tee) GetTabletsByCell(cell string) ([]topo.TabletAlias, error) {
 	return tee.readFrom.GetTabletsByCell(cell)
 }
 
+func (tee *Tee) GetTabletMapForCell(cell string) (map[topo.TabletAlias]*topo.TabletInfo, error) {
+	return tee.readFrom.GetTabletMapForCell(cell)
+}
+
 //
 // Shard replication graph management, local.
 //
@@ -372,6 +602,10 @@ func (tee *Tee) GetEndPoints(cell, keyspace, shard string, tabletType topo.Table
 	return tee.readFrom.GetEndPoints(cell, keyspace, shard, tabletType)
 }
 
+func (tee *Tee) GetEndPointsPerShard(cell, keyspace, shard string) (map[topo.TabletType]*topo.EndPoints, error) {
+	return tee.readFrom.GetEndPointsPerShard(cell, keyspace, shard)
+}
+
 func (tee *Tee) DeleteSrvTabletType(cell, keyspace, shard string, tabletType topo.TabletType) error {
 	if err := tee.primary.DeleteSrvTabletType(cell, keyspace, shard, tabletType); err != nil {
 		return err
@@ -400,6 +634,18 @@ func (tee *Tee) GetSrvShard(cell, keyspace, shard string) (*topo.SrvShard, error
 	return tee.readFrom.GetSrvShard(cell, keyspace, shard)
 }
 
+func (tee *Tee) DeleteSrvShard(cell, keyspace, shard string) error {
+	if err := tee.primary.DeleteSrvShard(cell, keyspace, shard); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.DeleteSrvShard(cell, keyspace, shard); err != nil && err != topo.ErrNoNode {
+		// not critical enough to fail
+		log.Warningf("secondary.DeleteSrvShard(%v, %v, %v) failed: %v", cell, keyspace, shard, err)
+	}
+	return nil
+}
+
 func (tee *Tee) UpdateSrvKeyspace(cell, keyspace string, srvKeyspace *topo.SrvKeyspace) error {
 	if err := tee.primary.UpdateSrvKeyspace(cell, keyspace, srvKeyspace); err != nil {
 		return err
@@ -416,10 +662,42 @@ func (tee *Tee) GetSrvKeyspace(cell, keyspace string) (*topo.SrvKeyspace, error)
 	return tee.readFrom.GetSrvKeyspace(cell, keyspace)
 }
 
+func (tee *Tee) DeleteSrvKeyspace(cell, keyspace string) error {
+	if err := tee.primary.DeleteSrvKeyspace(cell, keyspace); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.DeleteSrvKeyspace(cell, keyspace); err != nil && err != topo.ErrNoNode {
+		// not critical enough to fail
+		log.Warningf("secondary.DeleteSrvKeyspace(%v, %v) failed: %v", cell, keyspace, err)
+	}
+	return nil
+}
+
 func (tee *Tee) GetSrvKeyspaceNames(cell string) ([]string, error) {
 	return tee.readFrom.GetSrvKeyspaceNames(cell)
 }
 
+func (tee *Tee) UpdateSrvKeyspaceMirror(cell, keyspace string, mirror *topo.SrvKeyspaceMirror) error {
+	if err := tee.primary.UpdateSrvKeyspaceMirror(cell, keyspace, mirror); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.UpdateSrvKeyspaceMirror(cell, keyspace, mirror); err != nil {
+		// not critical enough to fail
+		log.Warningf("secondary.UpdateSrvKeyspaceMirror(%v, %v) failed: %v", cell, keyspace, err)
+	}
+	return nil
+}
+
+func (tee *Tee) GetSrvKeyspaceMirror(cell, keyspace string) (*topo.SrvKeyspaceMirror, error) {
+	return tee.readFrom.GetSrvKeyspaceMirror(cell, keyspace)
+}
+
+func (tee *Tee) GetSrvKeyspaceMirrorNames(cell string) ([]string, error) {
+	return tee.readFrom.GetSrvKeyspaceMirrorNames(cell)
+}
+
 func (tee *Tee) UpdateTabletEndpoint(cell, keyspace, shard string, tabletType topo.TabletType, addr *topo.EndPoint) error {
 	if err := tee.primary.UpdateTabletEndpoint(cell, keyspace, shard, tabletType, addr); err != nil {
 		return err
@@ -432,6 +710,18 @@ func (tee *Tee) UpdateTabletEndpoint(cell, keyspace, shard string, tabletType to
 	return nil
 }
 
+func (tee *Tee) RemoveTabletEndpoint(cell, keyspace, shard string, tabletType topo.TabletType, uid uint32) error {
+	if err := tee.primary.RemoveTabletEndpoint(cell, keyspace, shard, tabletType, uid); err != nil {
+		return err
+	}
+
+	if err := tee.secondary.RemoveTabletEndpoint(cell, keyspace, shard, tabletType, uid); err != nil {
+		// not critical enough to fail
+		log.Warningf("secondary.RemoveTabletEndpoint(%v, %v, %v, %v, %v) failed: %v", cell, keyspace, shard, tabletType, uid, err)
+	}
+	return nil
+}
+
 //
 // Keyspace and Shard locks for actions, global.
 //
@@ -0,0 +1,418 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package vtexplain simulates how vtgate routes and rewrites queries,
+// from the VSchema and the shards of a keyspace, without connecting
+// to any database. It is meant to review schema and routing changes
+// before they are applied.
+package vtexplain
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// ROUTING_SHARD is the routing of the queries whose comment directive
+// names the shard. Other queries use the routings of
+// sqlparser.ExplainRouting, like vtgate Explain.
+const ROUTING_SHARD = "SHARD"
+
+// lookupShard is the only shard of the keyspaces of lookup tables.
+const lookupShard = "0"
+
+// ShardQuery is a query vtgate would send to a shard.
+type ShardQuery struct {
+	Keyspace      string
+	Shard         string
+	Sql           string
+	BindVariables map[string]interface{}
+
+	// PerRow is set for the queries sent once for each row
+	// returned by the previous query, with different bind
+	// variables.
+	PerRow bool
+}
+
+// Plan is the simulated execution of a statement.
+type Plan struct {
+	Sql     string
+	Routing string
+	Shards  []string
+
+	// Merge describes how the results of the shards are merged,
+	// or is empty if they are just concatenated.
+	Merge string
+
+	// Transaction is set if vtgate opens a transaction of its own
+	// to keep the lookup tables consistent with the statement.
+	Transaction bool
+
+	// Queries are the queries sent to the shards, in order.
+	Queries []ShardQuery
+}
+
+// Explainer simulates the queries of a keyspace.
+type Explainer struct {
+	keyspace  string
+	vschema   *topo.VSchema
+	shards    []key.KeyRange
+	normalize bool
+}
+
+// NewExplainer returns an Explainer for keyspace, whose tables are
+// described by vschema, and whose shards are given by shardingSpec,
+// in the form of key.ParseShardingSpec. normalize is the value of the
+// vtgate -normalize-queries flag to simulate.
+func NewExplainer(keyspace string, vschema *topo.VSchema, shardingSpec string, normalize bool) (*Explainer, error) {
+	if vschema == nil {
+		vschema = topo.NewVSchema(false)
+	}
+	if err := vschema.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid vschema: %v", err)
+	}
+	if _, err := key.GetResolver(vschema.Resolver); err != nil {
+		return nil, err
+	}
+	shards, err := key.ParseShardingSpec(shardingSpec)
+	if err != nil {
+		return nil, err
+	}
+	return &Explainer{
+		keyspace:  keyspace,
+		vschema:   vschema,
+		shards:    shards,
+		normalize: normalize,
+	}, nil
+}
+
+// shardName returns the name of the shard at index i, like vtgate
+// names the shards of a SrvKeyspace.
+func (ex *Explainer) shardName(i int) string {
+	if !ex.shards[i].IsPartial() {
+		return fmt.Sprintf("%v", i)
+	}
+	return fmt.Sprintf("%v-%v", ex.shards[i].Start.Hex(), ex.shards[i].End.Hex())
+}
+
+// Explain returns the simulated execution of sql.
+func (ex *Explainer) Explain(sql string, bindVariables map[string]interface{}) (*Plan, error) {
+	plan := &Plan{Sql: sql}
+	directives := sqlparser.ParseDirectives(sql)
+	if directives.IsSet(sqlparser.DIRECTIVE_SHARD) {
+		plan.Routing = ROUTING_SHARD
+		plan.Shards = []string{directives[sqlparser.DIRECTIVE_SHARD]}
+	} else {
+		tabletKeys := make([]key.KeyspaceId, len(ex.shards))
+		for i, shard := range ex.shards {
+			tabletKeys[i] = shard.End
+		}
+		explanation, err := sqlparser.ExplainRouting(sql, bindVariables, tabletKeys)
+		if err != nil {
+			return nil, err
+		}
+		plan.Routing = explanation.Routing
+		plan.Shards = make([]string, len(explanation.Shards))
+		for i, index := range explanation.Shards {
+			plan.Shards[i] = ex.shardName(index)
+		}
+	}
+
+	// vtgate normalizes the query before it changes the lookups
+	if ex.normalize {
+		if newSql, newBindVariables, ok := sqlparser.Normalize(sql, bindVariables); ok {
+			sql, bindVariables = newSql, newBindVariables
+		}
+	}
+	lookupQueries, err := ex.lookupQueries(sql, bindVariables, plan.Shards)
+	if err != nil {
+		return nil, err
+	}
+	if len(lookupQueries) != 0 {
+		plan.Transaction = true
+		plan.Queries = append(plan.Queries, lookupQueries...)
+	}
+	if len(plan.Shards) > 1 {
+		mergePlan, err := sqlparser.AnalyzeMerge(sql, bindVariables)
+		if err != nil {
+			return nil, err
+		}
+		if mergePlan != nil {
+			sql = mergePlan.Sql
+			plan.Merge = describeMerge(mergePlan)
+		}
+	}
+	for _, shard := range plan.Shards {
+		plan.Queries = append(plan.Queries, ShardQuery{Keyspace: ex.keyspace, Shard: shard, Sql: sql, BindVariables: bindVariables})
+	}
+	return plan, nil
+}
+
+// lookupQueries returns the changes of the lookup tables vtgate makes
+// for an insert into, or a delete from, a table with lookups. Like
+// vtgate, it rejects the updates of their sharding and lookup columns.
+func (ex *Explainer) lookupQueries(sql string, bindVariables map[string]interface{}, shards []string) ([]ShardQuery, error) {
+	insertTables := make(map[string]bool)
+	deleteColumns := make(map[string][]string)
+	for name, table := range ex.vschema.Tables {
+		if len(table.Lookups) == 0 {
+			continue
+		}
+		insertTables[name] = true
+		columns := append([]string(nil), table.KeyColumns()...)
+		for _, lookup := range table.Lookups {
+			columns = append(columns, lookup.Column)
+		}
+		deleteColumns[name] = columns
+	}
+	if len(insertTables) == 0 {
+		return nil, nil
+	}
+
+	tableName, columns, rows, err := sqlparser.InsertRows(sql, bindVariables, insertTables)
+	if err != nil {
+		return nil, err
+	}
+	if tableName != "" {
+		return ex.lookupInserts(ex.vschema.Tables[tableName], columns, rows)
+	}
+	tableName, selectSql, err := sqlparser.SelectForDelete(sql, deleteColumns)
+	if err != nil {
+		return nil, err
+	}
+	if tableName == "" {
+		// vtgate rejects the updates of sharding and lookup columns
+		return nil, sqlparser.CheckUpdate(sql, insertTables, deleteColumns)
+	}
+	var queries []ShardQuery
+	for _, shard := range shards {
+		queries = append(queries, ShardQuery{Keyspace: ex.keyspace, Shard: shard, Sql: selectSql, BindVariables: bindVariables})
+	}
+	for _, lookup := range ex.vschema.Tables[tableName].Lookups {
+		queries = append(queries, ShardQuery{
+			Keyspace: lookup.Keyspace,
+			Shard:    lookupShard,
+			Sql:      fmt.Sprintf("delete from %s where %s = :from and %s = :to", lookup.Table, lookup.FromColumn, lookup.ToColumn),
+			PerRow:   true,
+		})
+	}
+	return queries, nil
+}
+
+// lookupInserts returns the inserts into the lookup tables of table
+// for the given rows. Null values are not looked up.
+func (ex *Explainer) lookupInserts(table *topo.VSchemaTable, columns []string, rows [][]interface{}) ([]ShardQuery, error) {
+	resolver, err := key.GetResolver(ex.vschema.Resolver)
+	if err != nil {
+		return nil, err
+	}
+	keyColumns := table.KeyColumns()
+	keyspaceIds := make([]key.KeyspaceId, len(rows))
+	for i, row := range rows {
+		values := make([][]byte, len(keyColumns))
+		for j, column := range keyColumns {
+			index := columnIndex(columns, column)
+			if index == -1 || row[index] == nil {
+				return nil, fmt.Errorf("insert needs a value for %v to maintain its lookups", column)
+			}
+			values[j] = resolverValue(row[index])
+		}
+		if keyspaceIds[i], err = resolver.Resolve(values); err != nil {
+			return nil, err
+		}
+	}
+
+	var queries []ShardQuery
+	for _, lookup := range table.Lookups {
+		index := columnIndex(columns, lookup.Column)
+		if index == -1 {
+			continue
+		}
+		values := make([]string, 0, len(rows))
+		bindVariables := make(map[string]interface{})
+		for i, row := range rows {
+			if row[index] == nil {
+				continue
+			}
+			from := fmt.Sprintf("from%d", len(values))
+			to := fmt.Sprintf("to%d", len(values))
+			values = append(values, fmt.Sprintf("(:%s, :%s)", from, to))
+			bindVariables[from] = row[index]
+			bindVariables[to] = []byte(keyspaceIds[i])
+		}
+		if len(values) == 0 {
+			continue
+		}
+		queries = append(queries, ShardQuery{
+			Keyspace:      lookup.Keyspace,
+			Shard:         lookupShard,
+			Sql:           fmt.Sprintf("insert into %s(%s, %s) values %s", lookup.Table, lookup.FromColumn, lookup.ToColumn, strings.Join(values, ", ")),
+			BindVariables: bindVariables,
+		})
+	}
+	return queries, nil
+}
+
+func columnIndex(columns []string, column string) int {
+	for i, c := range columns {
+		if c == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolverValue returns the mysql text form of a value, as
+// key.KeyspaceIdResolver expects it.
+func resolverValue(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return []byte(fmt.Sprintf("%v", v))
+}
+
+// describeMerge returns how vtgate merges the results of the shards
+// for mergePlan.
+func describeMerge(mergePlan *sqlparser.MergePlan) string {
+	if mergePlan.Aggregates {
+		return "add up the counts and sums"
+	}
+	var parts []string
+	if mergePlan.Order != nil {
+		columns := make([]string, len(mergePlan.Order))
+		for i, order := range mergePlan.Order {
+			if order.Index == -1 {
+				columns[i] = order.Name
+			} else {
+				columns[i] = fmt.Sprintf("column %v", order.Index+1)
+			}
+			if order.Desc {
+				columns[i] += " desc"
+			}
+		}
+		// vtgate only merge-sorts numeric columns, and concatenates
+		// the results ordered by the others
+		parts = append(parts, "merge-sort on "+strings.Join(columns, ", ")+" if numeric")
+	}
+	if mergePlan.Offset != 0 {
+		parts = append(parts, fmt.Sprintf("skip %v rows", mergePlan.Offset))
+	}
+	if mergePlan.Limit != -1 {
+		parts = append(parts, fmt.Sprintf("keep %v rows", mergePlan.Limit))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// String returns the query and its bind variables, sorted by name.
+// Byte values, like keyspace ids, are shown in hexadecimal.
+func (sq *ShardQuery) String() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%v/%v: %v", sq.Keyspace, sq.Shard, sq.Sql)
+	if sq.PerRow {
+		buf.WriteString(" (for each row)")
+	}
+	names := make([]string, 0, len(sq.BindVariables))
+	for name := range sq.BindVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if i == 0 {
+			buf.WriteString(" [")
+		} else {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(buf, "%v=", name)
+		if b, ok := sq.BindVariables[name].([]byte); ok {
+			fmt.Fprintf(buf, "0x%x", b)
+		} else if err := sqlparser.EncodeValue(buf, sq.BindVariables[name]); err != nil {
+			fmt.Fprintf(buf, "%v", sq.BindVariables[name])
+		}
+	}
+	if len(names) != 0 {
+		buf.WriteString("]")
+	}
+	return buf.String()
+}
+
+// String returns a readable form of the plan, one line per item.
+func (plan *Plan) String() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%v\n", plan.Sql)
+	fmt.Fprintf(buf, "  routing: %v %v\n", plan.Routing, plan.Shards)
+	if plan.Merge != "" {
+		fmt.Fprintf(buf, "  merge: %v\n", plan.Merge)
+	}
+	if plan.Transaction {
+		buf.WriteString("  begin\n")
+	}
+	for _, sq := range plan.Queries {
+		fmt.Fprintf(buf, "  %v\n", sq.String())
+	}
+	if plan.Transaction {
+		buf.WriteString("  commit\n")
+	}
+	return buf.String()
+}
+
+// SplitStatements splits text into its statements, separated by
+// semicolons outside of quotes and comments. Empty statements and
+// lines starting with '#' or "--" are dropped.
+func SplitStatements(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	text = strings.Join(lines, "\n")
+
+	var statements []string
+	var quote byte
+	inComment := false
+	start := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inComment:
+			if c == '*' && i+1 < len(text) && text[i+1] == '/' {
+				inComment = false
+				i++
+			}
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '/' && i+1 < len(text) && text[i+1] == '*':
+			inComment = true
+			i++
+		case c == ';':
+			statements = appendStatement(statements, text[start:i])
+			start = i + 1
+		}
+	}
+	return appendStatement(statements, text[start:])
+}
+
+func appendStatement(statements []string, statement string) []string {
+	statement = strings.TrimSpace(statement)
+	if statement == "" {
+		return statements
+	}
+	return append(statements, statement)
+}
@@ -0,0 +1,161 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtexplain
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func testExplainer(t *testing.T, normalize bool) *Explainer {
+	vschema := topo.NewVSchema(true)
+	vschema.Tables["user"] = &topo.VSchemaTable{
+		ShardingKey: "entity_id",
+		Lookups: []*topo.VSchemaLookup{
+			{Column: "name", Keyspace: "lookup", Table: "name_idx", FromColumn: "name", ToColumn: "keyspace_id"},
+		},
+	}
+	vschema.Tables["music"] = &topo.VSchemaTable{ShardingKey: "entity_id"}
+	ex, err := NewExplainer("user", vschema, "-0000000000000002-", normalize)
+	if err != nil {
+		t.Fatalf("NewExplainer: %v", err)
+	}
+	return ex
+}
+
+func TestExplain(t *testing.T) {
+	ex := testExplainer(t, false)
+	testCases := []struct {
+		sql  string
+		want string
+	}{
+		{
+			"select * from music where entity_id = 1",
+			`select * from music where entity_id = 1
+  routing: CONDITION [-0000000000000002]
+  user/-0000000000000002: select * from music where entity_id = 1
+`,
+		},
+		{
+			"select a from music order by a desc limit 1, 2",
+			`select a from music order by a desc limit 1, 2
+  routing: SCATTER [-0000000000000002 0000000000000002-]
+  merge: merge-sort on column 1 desc if numeric, skip 1 rows, keep 2 rows
+  user/-0000000000000002: select a from music order by a desc limit 3
+  user/0000000000000002-: select a from music order by a desc limit 3
+`,
+		},
+		{
+			"select count(*) from music",
+			`select count(*) from music
+  routing: SCATTER [-0000000000000002 0000000000000002-]
+  merge: add up the counts and sums
+  user/-0000000000000002: select count(*) from music
+  user/0000000000000002-: select count(*) from music
+`,
+		},
+		{
+			"insert into user(entity_id, name) values (5, 'foo')",
+			`insert into user(entity_id, name) values (5, 'foo')
+  routing: VALUE [0000000000000002-]
+  begin
+  lookup/0: insert into name_idx(name, keyspace_id) values (:from0, :to0) [from0='foo', to0=0x0000000000000005]
+  user/0000000000000002-: insert into user(entity_id, name) values (5, 'foo')
+  commit
+`,
+		},
+		{
+			"delete from user where entity_id = 1",
+			`delete from user where entity_id = 1
+  routing: CONDITION [-0000000000000002]
+  begin
+  user/-0000000000000002: select entity_id, name from user where entity_id = 1 for update
+  lookup/0: delete from name_idx where name = :from and keyspace_id = :to (for each row)
+  user/-0000000000000002: delete from user where entity_id = 1
+  commit
+`,
+		},
+		{
+			"select /*vt+ SHARD=0000000000000002- */ * from user",
+			`select /*vt+ SHARD=0000000000000002- */ * from user
+  routing: SHARD [0000000000000002-]
+  user/0000000000000002-: select /*vt+ SHARD=0000000000000002- */ * from user
+`,
+		},
+	}
+	for _, tc := range testCases {
+		plan, err := ex.Explain(tc.sql, nil)
+		if err != nil {
+			t.Errorf("Explain(%q): %v", tc.sql, err)
+			continue
+		}
+		if got := plan.String(); got != tc.want {
+			t.Errorf("Explain(%q):\ngot:\n%v\nwant:\n%v", tc.sql, got, tc.want)
+		}
+	}
+
+	if _, err := ex.Explain("insert into user(name) values ('foo')", nil); err == nil || !strings.Contains(err.Error(), "needs a value for entity_id") {
+		t.Errorf("want an error for an insert without sharding key, got %v", err)
+	}
+	if _, err := ex.Explain("update user set name = 'bar' where entity_id = 1", nil); err == nil || !strings.Contains(err.Error(), "cannot change name") {
+		t.Errorf("want an error for an update of a lookup column, got %v", err)
+	}
+	if _, err := ex.Explain("select from", nil); err == nil {
+		t.Errorf("want an error for an invalid query")
+	}
+}
+
+func TestExplainNormalize(t *testing.T) {
+	ex := testExplainer(t, true)
+	plan, err := ex.Explain("select * from music where entity_id = 1 and a = 'x'", nil)
+	if err != nil {
+		t.Fatalf("Explain: %v", err)
+	}
+	want := []ShardQuery{{
+		Keyspace:      "user",
+		Shard:         "-0000000000000002",
+		Sql:           "select * from music where entity_id = :_vtn0 and a = :_vtn1",
+		BindVariables: map[string]interface{}{"_vtn0": int64(1), "_vtn1": "x"},
+	}}
+	if !reflect.DeepEqual(plan.Queries, want) {
+		t.Errorf("Explain: got %#v, want %#v", plan.Queries, want)
+	}
+}
+
+func TestNewExplainer(t *testing.T) {
+	if _, err := NewExplainer("user", nil, "-", false); err != nil {
+		t.Errorf("NewExplainer without vschema: %v", err)
+	}
+	if _, err := NewExplainer("user", nil, "80", false); err == nil {
+		t.Errorf("NewExplainer with an invalid sharding spec should fail")
+	}
+	vschema := topo.NewVSchema(true)
+	vschema.Tables["user"] = &topo.VSchemaTable{}
+	if _, err := NewExplainer("user", vschema, "-", false); err == nil {
+		t.Errorf("NewExplainer with an invalid vschema should fail")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	text := `# a comment
+select 1 from t;
+-- another comment
+select ';' from t /* ; */ where a = "\";";
+
+insert into t(a)
+  values (1)
+`
+	want := []string{
+		"select 1 from t",
+		`select ';' from t /* ; */ where a = "\";"`,
+		"insert into t(a)\n  values (1)",
+	}
+	if got := SplitStatements(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitStatements: got %q, want %q", got, want)
+	}
+}
@@ -5,6 +5,7 @@
 package vtgate
 
 import (
+	"flag"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -14,6 +15,8 @@ import (
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
+var endPointRefreshErrors = flag.Int("endpoint-refresh-errors", 2, "number of connection errors to a tablet after which its end point is read again from the serving graph, in case the tablet moved (0 to only read it again after -retry-delay)")
+
 type GetEndPointsFunc func() (*topo.EndPoints, error)
 
 // Balancer is a simple round-robin load balancer.
@@ -25,12 +28,20 @@ type Balancer struct {
 	index        int
 	getEndPoints GetEndPointsFunc
 	retryDelay   time.Duration
+	// name identifies the balancer in the circuit breaker stats,
+	// as keyspace.shard.type
+	name string
 }
 
 type addressStatus struct {
 	endPoint  topo.EndPoint
 	timeRetry time.Time
 	balancer  *Balancer
+	// errors is the number of times the end point was marked
+	// down since its last refresh.
+	errors int
+	// breaker avoids the end point after consecutive failures.
+	breaker circuitBreaker
 }
 
 // NewBalancer creates a Balancer. getAddreses is the function
@@ -48,8 +59,9 @@ func NewBalancer(getEndPoints GetEndPointsFunc, retryDelay time.Duration) *Balan
 // Get returns a single endpoint that was not recently marked down.
 // If it finds an address that was down for longer than retryDelay,
 // it refreshes the list of addresses and returns the next available
-// node. If all addresses are marked down, it waits and retries.
-// If a refresh fails, it returns an error.
+// node. The endpoints whose circuit breaker is tripped are only
+// returned if no other one is available. If all addresses are marked
+// down, it waits and retries. If a refresh fails, it returns an error.
 func (blc *Balancer) Get() (endPoint topo.EndPoint, err error) {
 	blc.mu.Lock()
 	defer blc.mu.Unlock()
@@ -63,14 +75,22 @@ func (blc *Balancer) Get() (endPoint topo.EndPoint, err error) {
 
 outer:
 	for {
+		now := time.Now()
+		tripped := -1
 		for i := range blc.addressNodes {
 			index := (blc.index + i + 1) % len(blc.addressNodes)
 			addrNode := blc.addressNodes[index]
 			if addrNode.timeRetry.IsZero() {
+				if !addrNode.breaker.allow(now) {
+					if tripped == -1 {
+						tripped = index
+					}
+					continue
+				}
 				blc.index = index
 				return addrNode.endPoint, nil
 			}
-			if time.Now().Sub(addrNode.timeRetry) > 0 {
+			if now.Sub(addrNode.timeRetry) > 0 {
 				addrNode.timeRetry = time.Time{}
 				err = blc.refresh()
 				if err != nil {
@@ -79,6 +99,11 @@ outer:
 				continue outer
 			}
 		}
+		if tripped != -1 {
+			// a tripped end point is better than waiting
+			blc.index = tripped
+			return blc.addressNodes[tripped].endPoint, nil
+		}
 		// Allow mark downs to happen while sleeping.
 		blc.mu.Unlock()
 		time.Sleep(blc.retryDelay + (1 * time.Millisecond))
@@ -89,29 +114,78 @@ outer:
 
 // MarkDown marks the specified address down. Such addresses
 // will not be used by Balancer for the duration of retryDelay.
+// After -endpoint-refresh-errors mark downs, the end points are
+// refreshed right away: if the tablet moved, its new address can be
+// used without waiting.
 func (blc *Balancer) MarkDown(uid uint32) {
 	blc.mu.Lock()
 	defer blc.mu.Unlock()
-	if index := findAddrNode(blc.addressNodes, uid); index != -1 {
-		log.Infof("Marking down %v at %v", uid, blc.addressNodes[index].endPoint.Host)
-		blc.addressNodes[index].timeRetry = time.Now().Add(blc.retryDelay)
+	index := findAddrNode(blc.addressNodes, uid)
+	if index == -1 {
+		return
+	}
+	addrNode := blc.addressNodes[index]
+	log.Infof("Marking down %v at %v", uid, addrNode.endPoint.Host)
+	now := time.Now()
+	addrNode.timeRetry = now.Add(blc.retryDelay)
+	addrNode.errors++
+	if addrNode.breaker.failure(now) {
+		log.Warningf("Circuit breaker tripped for %v at %v after %v consecutive failures", uid, addrNode.endPoint.Host, addrNode.breaker.failures)
+		circuitBreakerTrips.Add(blc.statsName(uid), 1)
+	}
+	if *endPointRefreshErrors > 0 && addrNode.errors >= *endPointRefreshErrors {
+		addrNode.errors = 0
+		if err := blc.refresh(); err != nil {
+			log.Warningf("cannot refresh end points after errors on %v: %v", uid, err)
+		}
 	}
 }
 
+// MarkSuccess records that a query to the specified address
+// succeeded, which closes its circuit breaker.
+func (blc *Balancer) MarkSuccess(uid uint32) {
+	blc.mu.Lock()
+	defer blc.mu.Unlock()
+	index := findAddrNode(blc.addressNodes, uid)
+	if index == -1 {
+		return
+	}
+	addrNode := blc.addressNodes[index]
+	if addrNode.breaker.success() {
+		log.Infof("Circuit breaker closed for %v at %v", uid, addrNode.endPoint.Host)
+		circuitBreakerRecoveries.Add(blc.statsName(uid), 1)
+	}
+}
+
+func (blc *Balancer) statsName(uid uint32) string {
+	return fmt.Sprintf("%v.%v", blc.name, uid)
+}
+
 func (blc *Balancer) refresh() error {
 	endPoints, err := blc.getEndPoints()
 	if err != nil {
 		return err
 	}
-	// Add new addressNodes
+	// Add new addressNodes, and update the ones that moved
 	if endPoints != nil {
 		for _, endPoint := range endPoints.Entries {
-			if index := findAddrNode(blc.addressNodes, endPoint.Uid); index == -1 {
+			index := findAddrNode(blc.addressNodes, endPoint.Uid)
+			if index == -1 {
 				addrNode := &addressStatus{
 					endPoint: endPoint,
 					balancer: blc,
 				}
 				blc.addressNodes = append(blc.addressNodes, addrNode)
+				continue
+			}
+			addrNode := blc.addressNodes[index]
+			if !topo.EndPointEquality(&addrNode.endPoint, &endPoint) {
+				// the new address wasn't tried yet
+				log.Infof("End point %v moved from %v to %v", endPoint.Uid, addrNode.endPoint.Host, endPoint.Host)
+				addrNode.endPoint = endPoint
+				addrNode.timeRetry = time.Time{}
+				addrNode.errors = 0
+				addrNode.breaker = circuitBreaker{}
 			}
 		}
 	}
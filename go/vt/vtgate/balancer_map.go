@@ -23,6 +23,8 @@ type BalancerMap struct {
 
 // NewBalancerMap builds a new BalancerMap. Each BalancerMap is dedicated to a
 // cell. serv is the TopoServ used to fetch the list of tablets when needed.
+// If the cell has no tablets for a shard and type, the tablets of the
+// sibling cells of its alias are used.
 func NewBalancerMap(serv SrvTopoServer, cell string) *BalancerMap {
 	return &BalancerMap{
 		Toposerv:  serv,
@@ -41,13 +43,15 @@ func (blm *BalancerMap) Balancer(keyspace, shard string, tabletType topo.TabletT
 		return blc
 	}
 	getAddresses := func() (*topo.EndPoints, error) {
-		endpoints, err := blm.Toposerv.GetEndPoints(blm.Cell, keyspace, shard, tabletType)
+		endpoints, err := topo.GetEndPointsWithFallback(blm.Toposerv, blm.Cell, keyspace, shard, tabletType)
 		if err != nil {
 			return nil, fmt.Errorf("endpoints fetch error: %v", err)
 		}
 		return endpoints, nil
 	}
-	return blm.set(key, NewBalancer(getAddresses, retryDelay))
+	blc = NewBalancer(getAddresses, retryDelay)
+	blc.name = fmt.Sprintf("%s.%s.%s", keyspace, shard, tabletType)
+	return blm.set(key, blc)
 }
 
 func (blm *BalancerMap) get(key string) (blc *Balancer, ok bool) {
@@ -7,6 +7,8 @@ package vtgate
 import (
 	"testing"
 	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
 )
 
 // This file uses the sandbox_test framework.
@@ -50,3 +52,25 @@ func TestTopoError(t *testing.T) {
 		t.Errorf("want %s, got %v", want, err)
 	}
 }
+
+func TestCellsAliasFallback(t *testing.T) {
+	resetSandbox()
+	sandboxEmptyCells["aa"] = true
+	blm := NewBalancerMap(new(sandboxTopo), "aa")
+	blc := blm.Balancer("test_keyspace", "5", "master", 1*time.Second)
+	// Without an alias, an empty cell has no addresses.
+	if _, err := blc.Get(); err == nil || err.Error() != "no available addresses" {
+		t.Errorf("want no available addresses, got %v", err)
+	}
+
+	// With an alias, the sibling cells are used.
+	sandboxCellsAliases["region"] = &topo.CellsAlias{Cells: []string{"aa", "bb"}}
+	endPointCounter = 0
+	endPoint, err := blc.Get()
+	if err != nil || endPoint.Uid != 5 {
+		t.Errorf("want 5, got %v %v", endPoint, err)
+	}
+	if endPointCounter != 2 {
+		t.Errorf("want 2 GetEndPoints calls, got %v", endPointCounter)
+	}
+}
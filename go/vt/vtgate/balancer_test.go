@@ -216,3 +216,111 @@ func TestRefresh(t *testing.T) {
 		t.Errorf("want non-zero, got 0")
 	}
 }
+
+func TestMarkDownMoved(t *testing.T) {
+	host := "old"
+	b := NewBalancer(func() (*topo.EndPoints, error) {
+		return &topo.EndPoints{
+			Entries: []topo.EndPoint{
+				topo.EndPoint{
+					Uid:          1,
+					Host:         host,
+					NamedPortMap: map[string]int{"vt": 1},
+				},
+			},
+		}, nil
+	}, RETRY_DELAY)
+	if addr, _ := b.Get(); addr.Host != "old" {
+		t.Errorf("want old, got %v", addr.Host)
+	}
+
+	// The tablet moved: after -endpoint-refresh-errors mark downs,
+	// the new address is used without waiting for the retry delay.
+	host = "new"
+	for i := 0; i < *endPointRefreshErrors; i++ {
+		b.MarkDown(1)
+	}
+	startTime := time.Now()
+	addr, _ := b.Get()
+	if addr.Host != "new" {
+		t.Errorf("want new, got %v", addr.Host)
+	}
+	if time.Now().Sub(startTime) >= RETRY_DELAY {
+		t.Errorf("Get waited for the retry delay")
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	savedFailures, savedCooldown := *circuitBreakerFailures, *circuitBreakerCooldown
+	*circuitBreakerFailures = 2
+	*circuitBreakerCooldown = 50 * time.Millisecond
+	defer func() {
+		*circuitBreakerFailures, *circuitBreakerCooldown = savedFailures, savedCooldown
+	}()
+
+	b := NewBalancer(endPoints3, time.Millisecond)
+	b.name = "ks.0.replica"
+	b.Get()
+	trips := circuitBreakerTrips.Counts()["ks.0.replica.0"]
+	for i := 0; i < 2; i++ {
+		b.MarkDown(0)
+		time.Sleep(2 * time.Millisecond)
+	}
+	if got := circuitBreakerTrips.Counts()["ks.0.replica.0"]; got != trips+1 {
+		t.Errorf("want %v trips, got %v", trips+1, got)
+	}
+	for i := 0; i < 6; i++ {
+		if addr, _ := b.Get(); addr.Uid == 0 {
+			t.Fatalf("tripped end point returned")
+		}
+	}
+
+	// after the cooldown, one query probes the end point
+	time.Sleep(*circuitBreakerCooldown)
+	probed := false
+	for i := 0; i < 3; i++ {
+		if addr, _ := b.Get(); addr.Uid == 0 {
+			probed = true
+		}
+	}
+	if !probed {
+		t.Fatalf("tripped end point not probed after the cooldown")
+	}
+	for i := 0; i < 6; i++ {
+		if addr, _ := b.Get(); addr.Uid == 0 {
+			t.Fatalf("end point returned again before the probe reported back")
+		}
+	}
+
+	recoveries := circuitBreakerRecoveries.Counts()["ks.0.replica.0"]
+	b.MarkSuccess(0)
+	if got := circuitBreakerRecoveries.Counts()["ks.0.replica.0"]; got != recoveries+1 {
+		t.Errorf("want %v recoveries, got %v", recoveries+1, got)
+	}
+	found := false
+	for i := 0; i < 3; i++ {
+		if addr, _ := b.Get(); addr.Uid == 0 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("recovered end point not returned")
+	}
+}
+
+func TestCircuitBreakerLastEndPoint(t *testing.T) {
+	savedFailures := *circuitBreakerFailures
+	*circuitBreakerFailures = 1
+	defer func() { *circuitBreakerFailures = savedFailures }()
+
+	b := NewBalancer(func() (*topo.EndPoints, error) {
+		return &topo.EndPoints{Entries: []topo.EndPoint{{Uid: 1, Host: "1"}}}, nil
+	}, time.Millisecond)
+	b.Get()
+	b.MarkDown(1)
+	time.Sleep(2 * time.Millisecond)
+	// the only end point of the shard is used even if tripped
+	if addr, err := b.Get(); err != nil || addr.Uid != 1 {
+		t.Errorf("want end point 1, got %v %v", addr, err)
+	}
+}
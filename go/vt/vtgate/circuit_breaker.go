@@ -0,0 +1,77 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+)
+
+// This file contains the circuit breaker of the end points: after
+// -circuit-breaker-failures consecutive failures, a Balancer stops
+// returning an end point as long as its shard has other ones, so a
+// sick tablet doesn't slow down every query with errors and retries.
+// Once -circuit-breaker-cooldown is over, a single query probes the
+// end point, and a success closes the breaker again.
+
+var (
+	circuitBreakerFailures = flag.Int("circuit-breaker-failures", 5, "number of consecutive failures of an end point after which it is avoided while its shard has other end points (0 to disable)")
+	circuitBreakerCooldown = flag.Duration("circuit-breaker-cooldown", 30*time.Second, "how long a tripped end point is avoided before a query probes it")
+
+	// the trips and recoveries, by keyspace.shard.type.uid
+	circuitBreakerTrips      = stats.NewCounters("VtgateCircuitBreakerTrips")
+	circuitBreakerRecoveries = stats.NewCounters("VtgateCircuitBreakerRecoveries")
+)
+
+// circuitBreaker is the breaker of an end point. It is protected by
+// the mutex of its Balancer.
+type circuitBreaker struct {
+	// failures is the number of consecutive failures
+	failures int
+	// trippedUntil is when the next probe can be sent, zero if the
+	// breaker is closed
+	trippedUntil time.Time
+}
+
+func (cb *circuitBreaker) tripped() bool {
+	return !cb.trippedUntil.IsZero()
+}
+
+// allow returns if the end point can be used at now. When the cooldown
+// is over, it lets one query through to probe the end point, and
+// avoids it again until that query reports back, or another cooldown
+// elapses.
+func (cb *circuitBreaker) allow(now time.Time) bool {
+	if !cb.tripped() {
+		return true
+	}
+	if now.Before(cb.trippedUntil) {
+		return false
+	}
+	cb.trippedUntil = now.Add(*circuitBreakerCooldown)
+	return true
+}
+
+// failure records a failure, and returns true if it trips the breaker.
+// A failed probe keeps the breaker tripped for another cooldown.
+func (cb *circuitBreaker) failure(now time.Time) bool {
+	cb.failures++
+	if *circuitBreakerFailures <= 0 || cb.failures < *circuitBreakerFailures {
+		return false
+	}
+	wasTripped := cb.tripped()
+	cb.trippedUntil = now.Add(*circuitBreakerCooldown)
+	return !wasTripped
+}
+
+// success records a success, and returns true if it closes a tripped
+// breaker.
+func (cb *circuitBreaker) success() bool {
+	wasTripped := cb.tripped()
+	*cb = circuitBreaker{}
+	return wasTripped
+}
@@ -0,0 +1,277 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/dtxresolver"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the transaction manager of vtgate: the
+transactions that span more than one shard are committed with a
+two-phase commit (see go/vt/tabletserver/twopc.go), and their
+metadata is recorded in the _vt.dtx table of the master of an
+unsharded keyspace (see go/vt/tabletserver/dtx.go):
+  1. the transaction is created in the PREPARE state, with its
+     participants
+  2. all the participants are prepared
+  3. the state goes to COMMIT: this is the commit decision
+  4. all the participants commit their prepared transaction
+  5. the metadata is deleted
+
+If vtgate dies in the middle, the transaction stays in doubt: the
+resolver of any vtgate finds the transactions older than the abandon
+age, and finishes them (see go/vt/dtxresolver, shared with vtctl and
+vttablet). A transaction still in the PREPARE state is
+rolled back, as its vtgate is most likely gone. Only one of the
+commit and the rollback decisions can be made, so a slow vtgate
+cannot commit a transaction the resolver rolled back.
+*/
+
+var (
+	dtxShard      = flag.String("dtx-shard", "", "keyspace/shard of the unsharded keyspace whose master keeps the metadata of the distributed transactions. If empty, the transactions that span more than one shard are committed one shard at a time")
+	dtxAbandonAge = flag.Duration("dtx-abandon-age", time.Minute, "distributed transactions older than this are resolved by the transaction resolver")
+)
+
+var dtxStats = stats.NewCounters("DistributedTransactions")
+
+// TransactionManager commits the distributed transactions, and
+// resolves the abandoned ones.
+type TransactionManager struct {
+	balancerMap *BalancerMap
+	retryDelay  time.Duration
+	retryCount  int
+	abandonAge  time.Duration
+	ticks       *timer.Timer
+
+	// mu protects conn, the connection to the master of the
+	// metadata shard.
+	mu   sync.Mutex
+	conn *ShardConn
+
+	resolver *dtxresolver.Resolver
+}
+
+// NewTransactionManager creates a TransactionManager for the metadata
+// kept in keyspace/shard.
+func NewTransactionManager(blm *BalancerMap, keyspace, shard string, abandonAge, retryDelay time.Duration, retryCount int) *TransactionManager {
+	tm := &TransactionManager{
+		balancerMap: blm,
+		retryDelay:  retryDelay,
+		retryCount:  retryCount,
+		abandonAge:  abandonAge,
+		ticks:       timer.NewTimer(abandonAge / 2),
+		conn:        NewShardConn(blm, keyspace, shard, topo.TYPE_MASTER, retryDelay, retryCount),
+	}
+	tm.resolver = dtxresolver.NewResolver(metadataConn{tm}, func(keyspace, shard string) (dtxresolver.ParticipantConn, error) {
+		return NewShardConn(tm.balancerMap, keyspace, shard, topo.TYPE_MASTER, tm.retryDelay, tm.retryCount), nil
+	})
+	return tm
+}
+
+// Open starts the resolver.
+func (tm *TransactionManager) Open() {
+	tm.ticks.Start(func() { tm.ResolveAbandoned() })
+}
+
+// Close stops the resolver.
+func (tm *TransactionManager) Close() {
+	tm.ticks.Stop()
+}
+
+// metadata calls action with the connection to the metadata shard.
+func (tm *TransactionManager) metadata(action func(conn *ShardConn) error) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return action(tm.conn)
+}
+
+// metadataConn is the connection to the metadata shard of the
+// resolver, shared with the commits.
+type metadataConn struct {
+	tm *TransactionManager
+}
+
+func (mc metadataConn) SetTransactionState(dtid string, from, to int64) error {
+	return mc.tm.metadata(func(conn *ShardConn) error {
+		return conn.SetTransactionState(dtid, from, to)
+	})
+}
+
+func (mc metadataConn) ConcludeTransaction(dtid string) error {
+	return mc.tm.metadata(func(conn *ShardConn) error {
+		return conn.ConcludeTransaction(dtid)
+	})
+}
+
+func (mc metadataConn) ReadTransactions(dtid string, abandonAge time.Duration) (dtxs []tproto.DistributedTransaction, err error) {
+	err = mc.tm.metadata(func(conn *ShardConn) error {
+		dtxs, err = conn.ReadTransactions(dtid, abandonAge)
+		return err
+	})
+	return dtxs, err
+}
+
+// shardConnsByShard sorts ShardConns by keyspace and shard.
+type shardConnsByShard []*ShardConn
+
+func (sc shardConnsByShard) Len() int      { return len(sc) }
+func (sc shardConnsByShard) Swap(i, j int) { sc[i], sc[j] = sc[j], sc[i] }
+func (sc shardConnsByShard) Less(i, j int) bool {
+	if sc[i].keyspace != sc[j].keyspace {
+		return sc[i].keyspace < sc[j].keyspace
+	}
+	return sc[i].shard < sc[j].shard
+}
+
+// Commit commits the transactions of conns with a two-phase commit.
+// The participants are prepared and committed in the order of their
+// keyspace and shard, and the transaction of the first one identifies
+// the distributed transaction.
+func (tm *TransactionManager) Commit(conns []*ShardConn) error {
+	conns = append([]*ShardConn(nil), conns...)
+	sort.Sort(shardConnsByShard(conns))
+	dtid := fmt.Sprintf("%v:%v:%v", conns[0].keyspace, conns[0].shard, conns[0].TransactionId())
+	participants := make([]tproto.DtxParticipant, len(conns))
+	for i, conn := range conns {
+		participants[i] = tproto.DtxParticipant{Keyspace: conn.keyspace, Shard: conn.shard}
+	}
+
+	if err := tm.metadata(func(conn *ShardConn) error {
+		return conn.CreateTransaction(dtid, participants)
+	}); err != nil {
+		for _, conn := range conns {
+			conn.Rollback()
+		}
+		return fmt.Errorf("cannot create distributed transaction %v: %v", dtid, err)
+	}
+
+	for i, conn := range conns {
+		originalId := conn.TransactionId()
+		if err := conn.Prepare(dtid); err != nil {
+			tm.abortPrepare(dtid, conns[:i], conn, originalId, conns[i+1:])
+			return fmt.Errorf("cannot prepare distributed transaction %v: %v", dtid, err)
+		}
+	}
+
+	committed, err := tm.resolver.Decide(dtid, true)
+	if err != nil {
+		dtxStats.Add("InDoubt", 1)
+		return fmt.Errorf("distributed transaction %v is in doubt, it will be resolved: %v", dtid, err)
+	}
+	if !committed {
+		// the resolver decided first
+		tm.resolver.ResolveParticipants(dtid, false, participants)
+		return fmt.Errorf("distributed transaction %v was rolled back by the resolver", dtid)
+	}
+	for _, conn := range conns {
+		if err := conn.CommitPrepared(dtid); err != nil {
+			// the transaction is committed, the resolver
+			// will finish it
+			log.Warningf("cannot commit prepared transaction %v: %v", dtid, err)
+			dtxStats.Add("InDoubt", 1)
+			return nil
+		}
+	}
+	tm.conclude(dtid)
+	dtxStats.Add("Commit", 1)
+	return nil
+}
+
+// abortPrepare rolls back a distributed transaction that failed to be
+// prepared on failed: the prepared participants are rolled back, and
+// so are the remaining ones.
+func (tm *TransactionManager) abortPrepare(dtid string, prepared []*ShardConn, failed *ShardConn, originalId int64, remaining []*ShardConn) {
+	dtxStats.Add("Rollback", 1)
+	committed, err := tm.resolver.Decide(dtid, false)
+	if err != nil || committed {
+		// cannot happen unless the metadata shard is down,
+		// the resolver will finish it
+		log.Errorf("cannot roll back distributed transaction %v: %v", dtid, err)
+		return
+	}
+	rec := concurrency.AllErrorRecorder{}
+	for _, conn := range prepared {
+		rec.RecordError(conn.RollbackPrepared(dtid, 0))
+	}
+	// failed may have prepared its transaction, or not
+	rec.RecordError(failed.RollbackPrepared(dtid, originalId))
+	for _, conn := range remaining {
+		conn.Rollback()
+	}
+	if rec.HasErrors() {
+		log.Warningf("cannot roll back prepared transaction %v: %v", dtid, rec.Error())
+		return
+	}
+	tm.conclude(dtid)
+}
+
+func (tm *TransactionManager) conclude(dtid string) {
+	if err := tm.resolver.Conclude(dtid); err != nil {
+		log.Warningf("cannot conclude distributed transaction %v: %v", dtid, err)
+	}
+}
+
+// ResolveTransaction finishes a distributed transaction: it is
+// committed if the commit decision was made, and rolled back
+// otherwise. A transaction still in the PREPARE state is only rolled
+// back once it is older than the abandon age.
+func (tm *TransactionManager) ResolveTransaction(dtid string) error {
+	if err := tm.resolver.ResolveTransaction(dtid, tm.abandonAge, false); err != nil {
+		return err
+	}
+	dtxStats.Add("Resolved", 1)
+	return nil
+}
+
+// ResolveAbandoned resolves the distributed transactions older than
+// the abandon age.
+func (tm *TransactionManager) ResolveAbandoned() {
+	var dtxs []tproto.DistributedTransaction
+	if err := tm.metadata(func(conn *ShardConn) (err error) {
+		dtxs, err = conn.ReadTransactions("", tm.abandonAge)
+		return err
+	}); err != nil {
+		log.Warningf("cannot read the abandoned distributed transactions: %v", err)
+		return
+	}
+	for i := range dtxs {
+		log.Infof("resolving abandoned distributed transaction %v in state %v", dtxs[i].Dtid, tproto.DtxStateNames[dtxs[i].State])
+		// the metadata master already checked their age
+		if err := tm.resolver.Resolve(&dtxs[i], 0, false); err != nil {
+			log.Warningf("%v", err)
+			continue
+		}
+		dtxStats.Add("Resolved", 1)
+	}
+}
+
+// newTransactionManagerFromFlags returns the TransactionManager
+// configured by the flags, or nil if there is none.
+func newTransactionManagerFromFlags(blm *BalancerMap, retryDelay time.Duration, retryCount int) *TransactionManager {
+	if *dtxShard == "" {
+		return nil
+	}
+	parts := strings.Split(*dtxShard, "/")
+	if len(parts) != 2 {
+		log.Fatalf("invalid -dtx-shard %v, expected keyspace/shard", *dtxShard)
+	}
+	tm := NewTransactionManager(blm, parts[0], parts[1], *dtxAbandonAge, retryDelay, retryCount)
+	tm.Open()
+	return tm
+}
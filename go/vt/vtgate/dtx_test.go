@@ -0,0 +1,118 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"testing"
+	"time"
+
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+// This file uses the sandbox_test framework. The metadata is kept in
+// shard "2".
+
+func newTestTransaction(t *testing.T) (stc *ScatterConn, sbc0, sbc1, sbcm *sandboxConn) {
+	resetSandbox()
+	blm := NewBalancerMap(new(sandboxTopo), "aa")
+	sbc0, sbc1, sbcm = &sandboxConn{}, &sandboxConn{}, &sandboxConn{}
+	testConns[0] = sbc0
+	testConns[1] = sbc1
+	testConns[2] = sbcm
+	stc = NewScatterConn(blm, "", 1*time.Millisecond, 3)
+	stc.txManager = NewTransactionManager(blm, "", "2", time.Minute, 1*time.Millisecond, 3)
+	stc.Begin()
+	if _, err := stc.Execute("query1", nil, "", []string{"0", "1"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	return stc, sbc0, sbc1, sbcm
+}
+
+func TestTransactionManagerCommit(t *testing.T) {
+	stc, sbc0, sbc1, sbcm := newTestTransaction(t)
+	if err := stc.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	for i, sbc := range []*sandboxConn{sbc0, sbc1} {
+		if sbc.PrepareCount != 1 || sbc.CommitPreparedCount != 1 || sbc.CommitCount != 0 {
+			t.Errorf("participant %v: got %v prepares, %v commits of prepared, %v commits", i, sbc.PrepareCount, sbc.CommitPreparedCount, sbc.CommitCount)
+		}
+	}
+	if len(sbcm.dtxs) != 0 {
+		t.Errorf("the metadata was not concluded: %v", sbcm.dtxs)
+	}
+}
+
+func TestTransactionManagerSingleShard(t *testing.T) {
+	resetSandbox()
+	blm := NewBalancerMap(new(sandboxTopo), "aa")
+	sbc0 := &sandboxConn{}
+	testConns[0] = sbc0
+	stc := NewScatterConn(blm, "", 1*time.Millisecond, 3)
+	stc.txManager = NewTransactionManager(blm, "", "2", time.Minute, 1*time.Millisecond, 3)
+	stc.Begin()
+	stc.Execute("query1", nil, "", []string{"0"})
+	if err := stc.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if sbc0.PrepareCount != 0 || sbc0.CommitCount != 1 {
+		t.Errorf("single shard transactions don't need a two-phase commit: %v prepares, %v commits", sbc0.PrepareCount, sbc0.CommitCount)
+	}
+}
+
+func TestTransactionManagerPrepareFailure(t *testing.T) {
+	stc, sbc0, sbc1, sbcm := newTestTransaction(t)
+	sbc1.mustFailServer = 1
+	if err := stc.Commit(); err == nil {
+		t.Fatalf("Commit should have failed")
+	}
+	// the shards are prepared in order: sbc0 was prepared when
+	// sbc1 failed
+	if sbc0.PrepareCount != 1 || sbc0.RollbackPreparedCount != 1 || sbc0.RollbackCount != 0 {
+		t.Errorf("sbc0: got %v prepares, %v rollbacks of prepared, %v rollbacks, want 1, 1 and 0", sbc0.PrepareCount, sbc0.RollbackPreparedCount, sbc0.RollbackCount)
+	}
+	if sbc1.RollbackPreparedCount != 1 || sbc1.RollbackCount != 0 {
+		t.Errorf("sbc1: got %v rollbacks of prepared, %v rollbacks, want 1 and 0", sbc1.RollbackPreparedCount, sbc1.RollbackCount)
+	}
+	if sbc0.CommitPreparedCount != 0 || sbc1.CommitPreparedCount != 0 {
+		t.Errorf("nothing should have been committed")
+	}
+	if len(sbcm.dtxs) != 0 {
+		t.Errorf("the metadata was not concluded: %v", sbcm.dtxs)
+	}
+	if stc.TransactionId() != 0 {
+		t.Errorf("the transaction was not cleared")
+	}
+}
+
+func TestTransactionManagerResolve(t *testing.T) {
+	resetSandbox()
+	blm := NewBalancerMap(new(sandboxTopo), "aa")
+	sbc0, sbc1, sbcm := &sandboxConn{}, &sandboxConn{}, &sandboxConn{}
+	testConns[0] = sbc0
+	testConns[1] = sbc1
+	testConns[2] = sbcm
+	participants := []tproto.DtxParticipant{{Keyspace: "", Shard: "0"}, {Keyspace: "", Shard: "1"}}
+	sbcm.dtxs = map[string]*tproto.DistributedTransaction{
+		"committed": {Dtid: "committed", State: tproto.DTX_COMMIT, Participants: participants},
+		"prepared":  {Dtid: "prepared", State: tproto.DTX_PREPARE, Participants: participants[:1]},
+	}
+	tm := NewTransactionManager(blm, "", "2", time.Minute, 1*time.Millisecond, 3)
+	tm.ResolveAbandoned()
+
+	if sbc0.CommitPreparedCount != 1 || sbc1.CommitPreparedCount != 1 {
+		t.Errorf("got %v and %v commits of prepared, want 1 and 1", sbc0.CommitPreparedCount, sbc1.CommitPreparedCount)
+	}
+	// the transaction still in the PREPARE state is rolled back
+	if sbc0.RollbackPreparedCount != 1 || sbc1.RollbackPreparedCount != 0 {
+		t.Errorf("got %v and %v rollbacks of prepared, want 1 and 0", sbc0.RollbackPreparedCount, sbc1.RollbackPreparedCount)
+	}
+	if len(sbcm.dtxs) != 0 {
+		t.Errorf("the metadata was not concluded: %v", sbcm.dtxs)
+	}
+	if err := tm.ResolveTransaction("unknown"); err == nil {
+		t.Errorf("ResolveTransaction of an unknown transaction should have failed")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+
+	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+// The routings reported by Explain for lookup queries. Other queries
+// use the routings of sqlparser.ExplainRouting.
+const (
+	// ROUTING_LOOKUP is used when the shards come from a lookup table.
+	ROUTING_LOOKUP = "LOOKUP"
+
+	// ROUTING_SHARD is used when a comment directive names the shard.
+	ROUTING_SHARD = "SHARD"
+)
+
+// Explain returns the shards a query would be sent to, how they
+// were found, and the query they would get, without executing it.
+// If query has a Table, it is routed like ExecuteLookup routes it,
+// which reads the lookup table. Otherwise, it is routed on the
+// conditions on its entity_id column, like client2 does.
+func (vtg *VTGate) Explain(context *rpcproto.Context, query *proto.QueryLookup, reply *proto.ExplainResult) error {
+	scatterConn, err := vtg.connections.Get(query.SessionId, "for explain")
+	if err != nil {
+		return fmt.Errorf("query: %s, session %d: %v", sqlparser.Sanitize(query.Sql), query.SessionId, err)
+	}
+	defer vtg.connections.Put(query.SessionId)
+	stc := scatterConn.(*ScatterConn)
+
+	if query.Table != "" {
+		reply.Routing, reply.Shards, err = vtg.routeLookup(stc, query)
+	} else {
+		reply.Routing, reply.Shards, err = vtg.routeEntityId(stc, query)
+	}
+	if err != nil {
+		return fmt.Errorf("query: %s: %v", sqlparser.Sanitize(query.Sql), err)
+	}
+	reply.Sql, reply.BindVariables = normalize(query.Sql, query.BindVariables)
+	return nil
+}
+
+// routeEntityId returns the shards of query, found with the routing
+// of sqlparser, and how they were found.
+func (vtg *VTGate) routeEntityId(stc *ScatterConn, query *proto.QueryLookup) (string, []string, error) {
+	srvKeyspace, err := vtg.balancerMap.Toposerv.GetSrvKeyspace(vtg.balancerMap.Cell, query.Keyspace)
+	if err != nil {
+		return "", nil, err
+	}
+	srvShards := srvShardsForType(srvKeyspace, stc.tabletType)
+	tabletKeys := make([]key.KeyspaceId, len(srvShards))
+	for i, srvShard := range srvShards {
+		tabletKeys[i] = srvShard.KeyRange.End
+	}
+	explanation, err := sqlparser.ExplainRouting(query.Sql, query.BindVariables, tabletKeys)
+	if err != nil {
+		return "", nil, err
+	}
+	shards := make([]string, len(explanation.Shards))
+	for i, index := range explanation.Shards {
+		shards[i] = srvShardName(index, &srvShards[index])
+	}
+	return explanation.Routing, shards, nil
+}
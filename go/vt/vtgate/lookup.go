@@ -0,0 +1,404 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+// This file maintains the lookup tables of the vschema, that map the
+// values of a column to the keyspace ids of the rows that have them.
+// Inserts and deletes on a table with lookups also change its lookup
+// tables, in the same transaction. Updates cannot change the sharding
+// or lookup columns. The keyspace id of a row is
+// computed from its sharding columns by the resolver of the keyspace.
+
+// lookupShard is the only shard of the keyspaces of lookup tables.
+const lookupShard = "0"
+
+// lookupTables returns the tables of keyspace that have lookups,
+// and the resolver of the keyspace.
+func (vtg *VTGate) lookupTables(keyspace string) (map[string]*topo.VSchemaTable, key.KeyspaceIdResolver, error) {
+	vschema, err := vtg.balancerMap.Toposerv.GetVSchema(keyspace)
+	if err == topo.ErrNoNode {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read vschema of %v: %v", keyspace, err)
+	}
+	if vschema == nil {
+		return nil, nil, nil
+	}
+	tables := make(map[string]*topo.VSchemaTable)
+	for name, table := range vschema.Tables {
+		if len(table.Lookups) != 0 {
+			tables[name] = table
+		}
+	}
+	if len(tables) == 0 {
+		return nil, nil, nil
+	}
+	resolver, err := key.GetResolver(vschema.Resolver)
+	if err != nil {
+		return nil, nil, fmt.Errorf("keyspace %v: %v", keyspace, err)
+	}
+	return tables, resolver, nil
+}
+
+// lookupChange is the change of the lookup tables of a table, for an
+// insert or a delete.
+type lookupChange struct {
+	table    *topo.VSchemaTable
+	resolver key.KeyspaceIdResolver
+
+	// for inserts
+	columns []string
+	rows    [][]interface{}
+
+	// for deletes
+	selectSql     string
+	bindVariables map[string]interface{}
+}
+
+// newLookupChanges returns the changes of the lookup tables needed
+// by queries, if any.
+func (vtg *VTGate) newLookupChanges(keyspace string, queries []tproto.BoundQuery) ([]*lookupChange, error) {
+	tables, resolver, err := vtg.lookupTables(keyspace)
+	if err != nil || len(tables) == 0 {
+		return nil, err
+	}
+	insertTables := make(map[string]bool, len(tables))
+	deleteColumns := make(map[string][]string, len(tables))
+	for name, table := range tables {
+		insertTables[name] = true
+		columns := append([]string(nil), table.KeyColumns()...)
+		for _, lookup := range table.Lookups {
+			columns = append(columns, lookup.Column)
+		}
+		deleteColumns[name] = columns
+	}
+
+	var changes []*lookupChange
+	for _, query := range queries {
+		table, columns, rows, err := sqlparser.InsertRows(query.Sql, query.BindVariables, insertTables)
+		if err != nil {
+			return nil, err
+		}
+		if table != "" {
+			changes = append(changes, &lookupChange{table: tables[table], resolver: resolver, columns: columns, rows: rows})
+			continue
+		}
+		table, selectSql, err := sqlparser.SelectForDelete(query.Sql, deleteColumns)
+		if err != nil {
+			return nil, err
+		}
+		if table != "" {
+			changes = append(changes, &lookupChange{table: tables[table], resolver: resolver, selectSql: selectSql, bindVariables: query.BindVariables})
+			continue
+		}
+		if err := sqlparser.CheckUpdate(query.Sql, insertTables, deleteColumns); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// withLookups applies the lookup changes needed by queries, then
+// calls exec to run them. It uses the transaction of the session, or
+// a transaction of its own if the session is not in one.
+func (vtg *VTGate) withLookups(stc *ScatterConn, keyspace string, shards []string, queries []tproto.BoundQuery, exec func() error) error {
+	changes, err := vtg.newLookupChanges(keyspace, queries)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return exec()
+	}
+
+	autocommit := stc.TransactionId() == 0
+	if autocommit {
+		if err := stc.Begin(); err != nil {
+			return err
+		}
+	}
+	err = func() error {
+		for _, change := range changes {
+			if err := change.apply(stc, keyspace, shards); err != nil {
+				return err
+			}
+		}
+		return exec()
+	}()
+	if autocommit {
+		if err != nil {
+			stc.Rollback()
+		} else {
+			err = stc.Commit()
+		}
+	}
+	return err
+}
+
+func (change *lookupChange) apply(stc *ScatterConn, keyspace string, shards []string) error {
+	if change.selectSql != "" {
+		return change.delete(stc, keyspace, shards)
+	}
+	return change.insert(stc)
+}
+
+func columnIndex(columns []string, column string) int {
+	for i, c := range columns {
+		if c == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// insert adds the values of the inserted rows to the lookup tables.
+// Null values are not looked up. The lookup shards commit first, so
+// a failed commit can only leave lookup rows that match no row.
+func (change *lookupChange) insert(stc *ScatterConn) error {
+	keyColumns := change.table.KeyColumns()
+	keyIndexes := make([]int, len(keyColumns))
+	for i, column := range keyColumns {
+		keyIndexes[i] = columnIndex(change.columns, column)
+		if keyIndexes[i] == -1 {
+			return fmt.Errorf("insert needs a value for %v to maintain its lookups", column)
+		}
+	}
+	keyspaceIds := make([]key.KeyspaceId, len(change.rows))
+	for i, row := range change.rows {
+		values := make([][]byte, len(keyIndexes))
+		for j, index := range keyIndexes {
+			if row[index] == nil {
+				return fmt.Errorf("insert needs a value for %v to maintain its lookups", keyColumns[j])
+			}
+			values[j] = resolverValue(row[index])
+		}
+		var err error
+		if keyspaceIds[i], err = change.resolver.Resolve(values); err != nil {
+			return err
+		}
+	}
+	for _, lookup := range change.table.Lookups {
+		index := columnIndex(change.columns, lookup.Column)
+		if index == -1 {
+			continue
+		}
+		values := make([]string, 0, len(change.rows))
+		bindVariables := make(map[string]interface{})
+		for i, row := range change.rows {
+			if row[index] == nil {
+				continue
+			}
+			from := fmt.Sprintf("from%d", len(values))
+			to := fmt.Sprintf("to%d", len(values))
+			values = append(values, fmt.Sprintf("(:%s, :%s)", from, to))
+			bindVariables[from] = row[index]
+			bindVariables[to] = []byte(keyspaceIds[i])
+		}
+		if len(values) == 0 {
+			continue
+		}
+		sql := fmt.Sprintf("insert into %s(%s, %s) values %s", lookup.Table, lookup.FromColumn, lookup.ToColumn, strings.Join(values, ", "))
+		if _, err := stc.Execute(sql, bindVariables, lookup.Keyspace, []string{lookupShard}); err != nil {
+			return fmt.Errorf("cannot insert into lookup table %v.%v: %v", lookup.Keyspace, lookup.Table, err)
+		}
+	}
+	return nil
+}
+
+// delete locks the rows about to be deleted, and removes their values
+// from the lookup tables. Locking the rows first also makes the shards
+// of the table commit before the lookup shards.
+func (change *lookupChange) delete(stc *ScatterConn, keyspace string, shards []string) error {
+	qr, err := stc.Execute(change.selectSql, change.bindVariables, keyspace, shards)
+	if err != nil {
+		return err
+	}
+	keyCount := len(change.table.KeyColumns())
+	keyspaceIds := make([]key.KeyspaceId, len(qr.Rows))
+	for i, row := range qr.Rows {
+		values := make([][]byte, keyCount)
+		for j := range values {
+			values[j] = row[j].Raw()
+		}
+		if keyspaceIds[i], err = change.resolver.Resolve(values); err != nil {
+			return err
+		}
+	}
+	for i, lookup := range change.table.Lookups {
+		queries := make([]tproto.BoundQuery, 0, len(qr.Rows))
+		sql := fmt.Sprintf("delete from %s where %s = :from and %s = :to", lookup.Table, lookup.FromColumn, lookup.ToColumn)
+		for j, row := range qr.Rows {
+			if row[keyCount+i].IsNull() {
+				continue
+			}
+			queries = append(queries, tproto.BoundQuery{
+				Sql: sql,
+				BindVariables: map[string]interface{}{
+					"from": bindValue(row[keyCount+i]),
+					"to":   []byte(keyspaceIds[j]),
+				},
+			})
+		}
+		if len(queries) == 0 {
+			continue
+		}
+		if _, err := stc.ExecuteBatch(queries, lookup.Keyspace, []string{lookupShard}); err != nil {
+			return fmt.Errorf("cannot delete from lookup table %v.%v: %v", lookup.Keyspace, lookup.Table, err)
+		}
+	}
+	return nil
+}
+
+// bindValue converts a value read from mysql to a bind variable.
+func bindValue(v sqltypes.Value) interface{} {
+	if v.IsNull() {
+		return nil
+	}
+	if v.IsNumeric() {
+		if i, err := v.ParseInt64(); err == nil {
+			return i
+		}
+		if u, err := v.ParseUint64(); err == nil {
+			return u
+		}
+	}
+	return v.Raw()
+}
+
+// resolverValue returns the mysql text form of a bind variable, as
+// key.KeyspaceIdResolver expects it.
+func resolverValue(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return []byte(fmt.Sprintf("%v", v))
+}
+
+// routeLookup returns the shards ExecuteLookup sends query to, and
+// how they were found: ROUTING_SHARD if a comment directive names
+// the shard, ROUTING_LOOKUP otherwise.
+func (vtg *VTGate) routeLookup(stc *ScatterConn, query *proto.QueryLookup) (string, []string, error) {
+	directives := sqlparser.ParseDirectives(query.Sql)
+	if directives.IsSet(sqlparser.DIRECTIVE_SHARD) {
+		return ROUTING_SHARD, []string{directives[sqlparser.DIRECTIVE_SHARD]}, nil
+	}
+	shards, err := vtg.lookupShards(stc, query.Keyspace, query.Table, query.Column, query.BindVariables, directives.IsSet(sqlparser.DIRECTIVE_ALLOW_FULL_SCAN))
+	return ROUTING_LOOKUP, shards, err
+}
+
+// lookupShards returns the shards of keyspace that have the rows
+// whose column has the value bound to its name in bindVariables. If
+// the column is not bound, and allowFullScan is set, it returns all
+// the shards.
+func (vtg *VTGate) lookupShards(stc *ScatterConn, keyspace, tableName, column string, bindVariables map[string]interface{}, allowFullScan bool) ([]string, error) {
+	tables, _, err := vtg.lookupTables(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	table, ok := tables[tableName]
+	if !ok {
+		return nil, fmt.Errorf("table %v of keyspace %v has no lookups", tableName, keyspace)
+	}
+	var lookup *topo.VSchemaLookup
+	for _, l := range table.Lookups {
+		if l.Column == column {
+			lookup = l
+			break
+		}
+	}
+	if lookup == nil {
+		return nil, fmt.Errorf("column %v of table %v has no lookup", column, tableName)
+	}
+	value, ok := bindVariables[column]
+	if !ok {
+		if !allowFullScan {
+			return nil, fmt.Errorf("missing bind variable %v", column)
+		}
+		srvKeyspace, err := vtg.balancerMap.Toposerv.GetSrvKeyspace(vtg.balancerMap.Cell, keyspace)
+		if err != nil {
+			return nil, err
+		}
+		return shardsForKeyRange(srvKeyspace, stc.tabletType, key.KeyRange{}), nil
+	}
+
+	sql := fmt.Sprintf("select %s from %s where %s = :value", lookup.ToColumn, lookup.Table, lookup.FromColumn)
+	qr, err := stc.Execute(sql, map[string]interface{}{"value": value}, lookup.Keyspace, []string{lookupShard})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read lookup table %v.%v: %v", lookup.Keyspace, lookup.Table, err)
+	}
+	if len(qr.Rows) == 0 {
+		return nil, nil
+	}
+	keyspaceIds := make([]key.KeyspaceId, len(qr.Rows))
+	for i, row := range qr.Rows {
+		keyspaceIds[i] = key.KeyspaceId(row[0].Raw())
+	}
+
+	srvKeyspace, err := vtg.balancerMap.Toposerv.GetSrvKeyspace(vtg.balancerMap.Cell, keyspace)
+	if err != nil {
+		return nil, err
+	}
+	return shardsForKeyspaceIds(srvKeyspace, stc.tabletType, keyspaceIds), nil
+}
+
+// shardsForKeyspaceIds returns the names of the shards of srvKeyspace,
+// for tabletType, that have the given keyspace ids.
+func shardsForKeyspaceIds(srvKeyspace *topo.SrvKeyspace, tabletType topo.TabletType, keyspaceIds []key.KeyspaceId) []string {
+	var shards []string
+	for i, srvShard := range srvShardsForType(srvKeyspace, tabletType) {
+		for _, keyspaceId := range keyspaceIds {
+			if srvShard.KeyRange.Contains(keyspaceId) {
+				shards = append(shards, srvShardName(i, &srvShard))
+				break
+			}
+		}
+	}
+	return shards
+}
+
+// shardsForKeyRange returns the names of the shards of srvKeyspace,
+// for tabletType, that intersect keyRange.
+func shardsForKeyRange(srvKeyspace *topo.SrvKeyspace, tabletType topo.TabletType, keyRange key.KeyRange) []string {
+	var shards []string
+	for i, srvShard := range srvShardsForType(srvKeyspace, tabletType) {
+		if key.KeyRangesIntersect(srvShard.KeyRange, keyRange) {
+			shards = append(shards, srvShardName(i, &srvShard))
+		}
+	}
+	return shards
+}
+
+// srvShardsForType returns the shards of srvKeyspace that serve
+// tabletType.
+func srvShardsForType(srvKeyspace *topo.SrvKeyspace, tabletType topo.TabletType) []topo.SrvShard {
+	if partition, ok := srvKeyspace.Partitions[tabletType]; ok {
+		return partition.Shards
+	}
+	return srvKeyspace.Shards
+}
+
+// srvShardName returns the name of the shard at index i of a
+// SrvKeyspace. Non-range based shards are named after their index.
+func srvShardName(i int, srvShard *topo.SrvShard) string {
+	if !srvShard.KeyRange.IsPartial() {
+		return fmt.Sprintf("%v", i)
+	}
+	return fmt.Sprintf("%v-%v", srvShard.KeyRange.Start.Hex(), srvShard.KeyRange.End.Hex())
+}
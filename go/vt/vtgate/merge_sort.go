@@ -0,0 +1,308 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+/*
+This file contains the merging of the results of a select sent to
+several shards (see sqlparser.AnalyzeMerge):
+- with an order by, the sorted results of each shard are merge-sorted,
+- with a limit, each shard returns at most offset+limit rows, and the
+  offset and limit are applied once merged,
+- counts and sums without group by are added up.
+Only the numeric columns are merge-sorted: the collation of the other
+columns is not known, and their values cannot be compared outside of
+MySQL. The results ordered by them are concatenated, as if the query
+had no order by.
+*/
+
+// streamMergeRows is the number of rows of the merged results sent
+// at once by StreamExecute.
+const streamMergeRows = 256
+
+// columnOrder is a sqlparser.MergeOrder resolved against the fields
+// of the results.
+type columnOrder struct {
+	index     int
+	fieldType int64
+	desc      bool
+}
+
+// resolveOrder returns the columns of order, or nil if one of them is
+// not numeric.
+func resolveOrder(order []sqlparser.MergeOrder, fields []mproto.Field) ([]columnOrder, error) {
+	columns := make([]columnOrder, len(order))
+	for i, o := range order {
+		columns[i] = columnOrder{index: o.Index, desc: o.Desc}
+		if o.Index == -1 {
+			for j, field := range fields {
+				if strings.ToLower(field.Name) == o.Name {
+					columns[i].index = j
+					break
+				}
+			}
+			if columns[i].index == -1 {
+				return nil, fmt.Errorf("cannot merge-sort the results: column %v is not in the results", o.Name)
+			}
+		}
+		if columns[i].index >= len(fields) {
+			return nil, fmt.Errorf("cannot merge-sort the results: column %v is not in the results", columns[i].index+1)
+		}
+		columns[i].fieldType = fields[columns[i].index].Type
+		if !mproto.IsNumericType(columns[i].fieldType) {
+			return nil, nil
+		}
+	}
+	return columns, nil
+}
+
+func compareRows(order []columnOrder, a, b []sqltypes.Value) int {
+	for _, o := range order {
+		if c := mproto.CompareValues(o.fieldType, a[o.index], b[o.index]); c != 0 {
+			if o.desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+type rowSorter struct {
+	order []columnOrder
+	rows  [][]sqltypes.Value
+}
+
+func (rs *rowSorter) Len() int {
+	return len(rs.rows)
+}
+
+func (rs *rowSorter) Swap(i, j int) {
+	rs.rows[i], rs.rows[j] = rs.rows[j], rs.rows[i]
+}
+
+func (rs *rowSorter) Less(i, j int) bool {
+	return compareRows(rs.order, rs.rows[i], rs.rows[j]) < 0
+}
+
+// applyLimit returns the rows of the limit clause of plan.
+func applyLimit(plan *sqlparser.MergePlan, rows [][]sqltypes.Value) [][]sqltypes.Value {
+	if plan.Offset >= int64(len(rows)) {
+		return nil
+	}
+	rows = rows[plan.Offset:]
+	if plan.Limit >= 0 && plan.Limit < int64(len(rows)) {
+		rows = rows[:plan.Limit]
+	}
+	return rows
+}
+
+// mergeResults merges the results of the shards according to plan.
+func mergeResults(plan *sqlparser.MergePlan, results []*mproto.QueryResult) (*mproto.QueryResult, error) {
+	qr := new(mproto.QueryResult)
+	for _, innerqr := range results {
+		appendResult(qr, innerqr)
+	}
+	if plan.Aggregates {
+		return aggregateResults(qr.Fields, results)
+	}
+	if plan.Order != nil && len(qr.Rows) > 1 {
+		order, err := resolveOrder(plan.Order, qr.Fields)
+		if err != nil {
+			return nil, err
+		}
+		// the rows of each shard are already sorted, and stay in
+		// the same order
+		if order != nil {
+			sort.Stable(&rowSorter{order, qr.Rows})
+		}
+	}
+	qr.Rows = applyLimit(plan, qr.Rows)
+	return qr, nil
+}
+
+// aggregateResults adds up the single row of each shard. The sums are
+// exact, and keep the largest number of decimals of the shard values.
+// NULL values, the sums of no rows, are ignored.
+func aggregateResults(fields []mproto.Field, results []*mproto.QueryResult) (*mproto.QueryResult, error) {
+	qr := &mproto.QueryResult{Fields: fields}
+	var sums []*big.Rat
+	var scales []int
+	for _, innerqr := range results {
+		for _, row := range innerqr.Rows {
+			if sums == nil {
+				sums = make([]*big.Rat, len(row))
+				scales = make([]int, len(row))
+			}
+			if len(row) != len(sums) {
+				return nil, fmt.Errorf("cannot add up the results: different column counts %v and %v", len(row), len(sums))
+			}
+			for i, v := range row {
+				if v.IsNull() {
+					continue
+				}
+				r, ok := new(big.Rat).SetString(v.String())
+				if !ok {
+					return nil, fmt.Errorf("cannot add up the results: %v is not a number", v.String())
+				}
+				if sums[i] == nil {
+					sums[i] = new(big.Rat)
+				}
+				sums[i].Add(sums[i], r)
+				if dot := strings.IndexByte(v.String(), '.'); dot != -1 && len(v.String())-dot-1 > scales[i] {
+					scales[i] = len(v.String()) - dot - 1
+				}
+			}
+		}
+	}
+	if sums == nil {
+		return qr, nil
+	}
+	row := make([]sqltypes.Value, len(sums))
+	for i, sum := range sums {
+		switch {
+		case sum == nil:
+			row[i] = sqltypes.NULL
+		case scales[i] == 0:
+			row[i] = sqltypes.MakeNumeric([]byte(sum.FloatString(0)))
+		default:
+			row[i] = sqltypes.MakeFractional([]byte(sum.FloatString(scales[i])))
+		}
+	}
+	qr.Rows = [][]sqltypes.Value{row}
+	qr.RowsAffected = 1
+	return qr, nil
+}
+
+// streamCursor reads the streamed results of a shard, row by row.
+type streamCursor struct {
+	results <-chan *mproto.QueryResult
+	fields  []mproto.Field
+	rows    [][]sqltypes.Value
+	done    bool
+}
+
+// fill reads results until there is a row, or the stream is over.
+func (sc *streamCursor) fill() {
+	for len(sc.rows) == 0 && !sc.done {
+		qr, ok := <-sc.results
+		if !ok {
+			sc.done = true
+			return
+		}
+		if sc.fields == nil {
+			sc.fields = qr.Fields
+		}
+		sc.rows = qr.Rows
+	}
+}
+
+// drain reads the rest of the stream, so the shard can finish.
+func (sc *streamCursor) drain() {
+	for _ = range sc.results {
+	}
+}
+
+// streamMerge merges the streamed results of the shards according to
+// plan, and sends them with sendReply: first the fields, then the
+// rows by batches of streamMergeRows. Only the current rows of each
+// shard are held in memory. Once the limit is reached, the rest of
+// the streams is read and dropped.
+func streamMerge(plan *sqlparser.MergePlan, streams []<-chan *mproto.QueryResult, sendReply func(reply interface{}) error) (err error) {
+	cursors := make([]*streamCursor, len(streams))
+	for i, results := range streams {
+		cursors[i] = &streamCursor{results: results}
+	}
+	defer func() {
+		for _, sc := range cursors {
+			sc.drain()
+		}
+	}()
+
+	var fields []mproto.Field
+	for _, sc := range cursors {
+		sc.fill()
+		if fields == nil {
+			fields = sc.fields
+		}
+	}
+	if fields == nil {
+		// no shard returned anything
+		return nil
+	}
+
+	if plan.Aggregates {
+		results := make([]*mproto.QueryResult, 0, len(cursors))
+		for _, sc := range cursors {
+			qr := &mproto.QueryResult{Rows: sc.rows}
+			for sc.rows = nil; !sc.done; sc.rows = nil {
+				sc.fill()
+				qr.Rows = append(qr.Rows, sc.rows...)
+			}
+			results = append(results, qr)
+		}
+		qr, err := aggregateResults(fields, results)
+		if err != nil {
+			return err
+		}
+		return sendReply(qr)
+	}
+
+	order, err := resolveOrder(plan.Order, fields)
+	if err != nil {
+		return err
+	}
+	if err := sendReply(&mproto.QueryResult{Fields: fields}); err != nil {
+		return err
+	}
+	skip, left := plan.Offset, plan.Limit
+	batch := make([][]sqltypes.Value, 0, streamMergeRows)
+	for left != 0 {
+		// the next row is the smallest of the current rows, the
+		// first shard wins the ties: without order, the shards
+		// are read one after the other
+		var next *streamCursor
+		for _, sc := range cursors {
+			if len(sc.rows) == 0 {
+				continue
+			}
+			if next == nil || compareRows(order, sc.rows[0], next.rows[0]) < 0 {
+				next = sc
+			}
+		}
+		if next == nil {
+			break
+		}
+		row := next.rows[0]
+		next.rows = next.rows[1:]
+		next.fill()
+		if skip > 0 {
+			skip--
+			continue
+		}
+		batch = append(batch, row)
+		left--
+		if len(batch) == streamMergeRows {
+			if err := sendReply(&mproto.QueryResult{Rows: batch}); err != nil {
+				return err
+			}
+			batch = make([][]sqltypes.Value, 0, streamMergeRows)
+		}
+	}
+	if len(batch) > 0 {
+		return sendReply(&mproto.QueryResult{Rows: batch})
+	}
+	return nil
+}
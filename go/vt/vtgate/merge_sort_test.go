@@ -0,0 +1,208 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+var mergeFields = []mproto.Field{{"id", 3}, {"name", 253}}
+
+func mergeRows(values ...interface{}) [][]sqltypes.Value {
+	rows := make([][]sqltypes.Value, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		row := make([]sqltypes.Value, 2)
+		for j, v := range values[i : i+2] {
+			switch v := v.(type) {
+			case nil:
+				row[j] = sqltypes.NULL
+			case int:
+				row[j] = sqltypes.MakeNumeric([]byte(fmt.Sprintf("%v", v)))
+			case string:
+				row[j] = sqltypes.MakeString([]byte(v))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestMergeResults(t *testing.T) {
+	results := []*mproto.QueryResult{
+		{Fields: mergeFields, Rows: mergeRows(1, "a", 4, "d", 7, "g")},
+		{Fields: mergeFields, Rows: mergeRows(nil, "z", 2, "b", 5, "e")},
+		{Fields: mergeFields, Rows: mergeRows(3, "c")},
+	}
+	plan := &sqlparser.MergePlan{Order: []sqlparser.MergeOrder{{Index: 0}}, Offset: 1, Limit: 4}
+	qr, err := mergeResults(plan, results)
+	if err != nil {
+		t.Fatalf("mergeResults: %v", err)
+	}
+	if want := mergeRows(1, "a", 2, "b", 3, "c", 4, "d"); !reflect.DeepEqual(qr.Rows, want) {
+		t.Errorf("mergeResults: got %v, want %v", qr.Rows, want)
+	}
+
+	plan = &sqlparser.MergePlan{Order: []sqlparser.MergeOrder{{Index: -1, Name: "id", Desc: true}}, Limit: -1}
+	qr, err = mergeResults(plan, []*mproto.QueryResult{{Fields: mergeFields, Rows: mergeRows(7, "g", 4, "d")}, {Fields: mergeFields, Rows: mergeRows(5, "e", 1, "a")}})
+	if err != nil {
+		t.Fatalf("mergeResults: %v", err)
+	}
+	if want := mergeRows(7, "g", 5, "e", 4, "d", 1, "a"); !reflect.DeepEqual(qr.Rows, want) {
+		t.Errorf("mergeResults by name: got %v, want %v", qr.Rows, want)
+	}
+
+	// a string column is not merge-sorted, its collation is not known
+	plan = &sqlparser.MergePlan{Order: []sqlparser.MergeOrder{{Index: 1}}, Limit: 4}
+	qr, err = mergeResults(plan, results)
+	if err != nil {
+		t.Fatalf("mergeResults: %v", err)
+	}
+	if want := mergeRows(1, "a", 4, "d", 7, "g", nil, "z"); !reflect.DeepEqual(qr.Rows, want) {
+		t.Errorf("mergeResults by a string column: got %v, want %v", qr.Rows, want)
+	}
+
+	plan = &sqlparser.MergePlan{Order: []sqlparser.MergeOrder{{Index: -1, Name: "missing"}}, Limit: -1}
+	if _, err := mergeResults(plan, results); err == nil {
+		t.Errorf("mergeResults with an unknown column should fail")
+	}
+}
+
+func TestAggregateResults(t *testing.T) {
+	fields := []mproto.Field{{"count(*)", 8}, {"sum(price)", 246}, {"sum(missing)", 246}}
+	results := []*mproto.QueryResult{
+		{Fields: fields, Rows: [][]sqltypes.Value{{sqltypes.MakeNumeric([]byte("3")), sqltypes.MakeFractional([]byte("1.25")), sqltypes.NULL}}},
+		{Fields: fields, Rows: [][]sqltypes.Value{{sqltypes.MakeNumeric([]byte("0")), sqltypes.NULL, sqltypes.NULL}}},
+		{Fields: fields, Rows: [][]sqltypes.Value{{sqltypes.MakeNumeric([]byte("18446744073709551615")), sqltypes.MakeFractional([]byte("0.5")), sqltypes.NULL}}},
+	}
+	qr, err := mergeResults(&sqlparser.MergePlan{Limit: -1, Aggregates: true}, results)
+	if err != nil {
+		t.Fatalf("mergeResults: %v", err)
+	}
+	want := [][]sqltypes.Value{{sqltypes.MakeNumeric([]byte("18446744073709551618")), sqltypes.MakeFractional([]byte("1.75")), sqltypes.NULL}}
+	if !reflect.DeepEqual(qr.Rows, want) {
+		t.Errorf("aggregateResults: got %v, want %v", qr.Rows, want)
+	}
+}
+
+func streamResults(results ...*mproto.QueryResult) <-chan *mproto.QueryResult {
+	ch := make(chan *mproto.QueryResult)
+	go func() {
+		for _, qr := range results {
+			ch <- qr
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+func TestStreamMerge(t *testing.T) {
+	streams := []<-chan *mproto.QueryResult{
+		streamResults(&mproto.QueryResult{Fields: mergeFields}, &mproto.QueryResult{Rows: mergeRows(1, "a", 4, "d")}, &mproto.QueryResult{Rows: mergeRows(7, "g")}),
+		streamResults(&mproto.QueryResult{Fields: mergeFields, Rows: mergeRows(2, "b", 5, "e")}, &mproto.QueryResult{Rows: mergeRows(8, "h", 9, "i")}),
+		streamResults(),
+		streamResults(&mproto.QueryResult{Fields: mergeFields}, &mproto.QueryResult{Rows: mergeRows(3, "c")}),
+	}
+	plan := &sqlparser.MergePlan{Order: []sqlparser.MergeOrder{{Index: 0}}, Offset: 2, Limit: 4}
+	var replies []*mproto.QueryResult
+	err := streamMerge(plan, streams, func(reply interface{}) error {
+		replies = append(replies, reply.(*mproto.QueryResult))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("streamMerge: %v", err)
+	}
+	want := []*mproto.QueryResult{{Fields: mergeFields}, {Rows: mergeRows(3, "c", 4, "d", 5, "e", 7, "g")}}
+	if !reflect.DeepEqual(replies, want) {
+		t.Errorf("streamMerge: got %v, want %v", replies, want)
+	}
+	// all the streams were read to the end
+	for i, stream := range streams {
+		if _, ok := <-stream; ok {
+			t.Errorf("stream %v was not drained", i)
+		}
+	}
+
+	// the streams ordered by a string column are concatenated
+	streams = []<-chan *mproto.QueryResult{
+		streamResults(&mproto.QueryResult{Fields: mergeFields, Rows: mergeRows(2, "B")}),
+		streamResults(&mproto.QueryResult{Fields: mergeFields, Rows: mergeRows(1, "a")}, &mproto.QueryResult{Rows: mergeRows(3, "c")}),
+	}
+	plan = &sqlparser.MergePlan{Order: []sqlparser.MergeOrder{{Index: 1}}, Limit: -1}
+	replies = nil
+	err = streamMerge(plan, streams, func(reply interface{}) error {
+		replies = append(replies, reply.(*mproto.QueryResult))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("streamMerge: %v", err)
+	}
+	want = []*mproto.QueryResult{{Fields: mergeFields}, {Rows: mergeRows(2, "B", 1, "a", 3, "c")}}
+	if !reflect.DeepEqual(replies, want) {
+		t.Errorf("streamMerge by a string column: got %v, want %v", replies, want)
+	}
+
+	// a send error stops the merge, and the streams are still drained
+	streams = []<-chan *mproto.QueryResult{
+		streamResults(&mproto.QueryResult{Fields: mergeFields, Rows: mergeRows(1, "a")}),
+		streamResults(&mproto.QueryResult{Fields: mergeFields, Rows: mergeRows(2, "b")}, &mproto.QueryResult{Rows: mergeRows(3, "c")}),
+	}
+	plan = &sqlparser.MergePlan{Order: []sqlparser.MergeOrder{{Index: 0}}, Limit: -1}
+	err = streamMerge(plan, streams, func(reply interface{}) error {
+		return fmt.Errorf("send error")
+	})
+	if err == nil || err.Error() != "send error" {
+		t.Errorf("streamMerge: want send error, got %v", err)
+	}
+	for i, stream := range streams {
+		if _, ok := <-stream; ok {
+			t.Errorf("stream %v was not drained", i)
+		}
+	}
+}
+
+func TestScatterConnMerge(t *testing.T) {
+	resetSandbox()
+	sbcs := make([]*sandboxConn, 3)
+	for i := range sbcs {
+		sbcs[i] = &sandboxConn{}
+		testConns[uint32(i)] = sbcs[i]
+	}
+	blm := NewBalancerMap(new(sandboxTopo), "aa")
+	stc := NewScatterConn(blm, "", 1*time.Millisecond, 3)
+	defer stc.Close()
+
+	// each shard returns at most offset+count rows
+	qr, err := stc.Execute("select id, value from t order by id limit 1, 1", nil, "", []string{"0", "1", "2"})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(qr.Rows) != 1 {
+		t.Errorf("Execute: want 1 row, got %v", qr.Rows)
+	}
+	for i, sbc := range sbcs {
+		if want := "select id, value from t order by id asc limit 2"; len(sbc.Queries) != 1 || sbc.Queries[0].Sql != want {
+			t.Errorf("shard %v: got %v, want %v", i, sbc.Queries, want)
+		}
+	}
+
+	var replies []*mproto.QueryResult
+	err = stc.StreamExecute("select id, value from t order by value desc limit 2", nil, "", []string{"0", "1", "2"}, func(reply interface{}) error {
+		replies = append(replies, reply.(*mproto.QueryResult))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamExecute: %v", err)
+	}
+	if len(replies) != 2 || len(replies[0].Fields) != 2 || len(replies[1].Rows) != 2 {
+		t.Errorf("StreamExecute: got %v", replies)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+var (
+	normalizeQueries = flag.Bool("normalize-queries", false, "replace the literals of queries with bind variables before sending them to the tablets, so queries that only differ by their values share a plan")
+	normalizeStats   = stats.NewCounters("VtgateQueryNormalizations")
+)
+
+// normalize replaces the literals of sql with bind variables, if
+// vtgate is configured to. Trailing comments, like the trace ones,
+// are kept.
+func normalize(sql string, bindVariables map[string]interface{}) (string, map[string]interface{}) {
+	if !*normalizeQueries {
+		return sql, bindVariables
+	}
+	newSql, newBindVariables, ok := sqlparser.Normalize(sql, bindVariables)
+	if !ok {
+		normalizeStats.Add("Unchanged", 1)
+		return sql, bindVariables
+	}
+	normalizeStats.Add("Normalized", 1)
+	return newSql, newBindVariables
+}
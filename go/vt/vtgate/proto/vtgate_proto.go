@@ -22,21 +22,29 @@ type VTGate interface {
 	GetSessionId(sessionParams *SessionParams, session *Session) error
 	ExecuteShard(context *rpcproto.Context, query *QueryShard, reply *mproto.QueryResult) error
 	ExecuteBatchShard(context *rpcproto.Context, batchQuery *BatchQueryShard, reply *tproto.QueryResultList) error
+	ExecuteLookup(context *rpcproto.Context, query *QueryLookup, reply *mproto.QueryResult) error
+	Explain(context *rpcproto.Context, query *QueryLookup, reply *ExplainResult) error
 	StreamExecuteShard(context *rpcproto.Context, query *QueryShard, sendReply func(interface{}) error) error
 	Begin(context *rpcproto.Context, session *Session, noOutput *rpc.UnusedResponse) error
 	Commit(context *rpcproto.Context, session *Session, noOutput *rpc.UnusedResponse) error
 	Rollback(context *rpcproto.Context, session *Session, noOutput *rpc.UnusedResponse) error
 	CloseSession(context *rpcproto.Context, session *Session, noOutput *rpc.UnusedResponse) error
+	InvalidateSchemaCache(context *rpcproto.Context, req *SchemaCacheInvalidation, noOutput *rpc.UnusedResponse) error
 }
 
+// SessionParams are the parameters of a new session. ReadAfterWrite
+// is the read-after-write consistency of the session: "" or "none",
+// "master" or "replica", see go/vt/vtgate/read_after_write.go.
 type SessionParams struct {
-	TabletType topo.TabletType
+	TabletType     topo.TabletType
+	ReadAfterWrite string
 }
 
 func (spm *SessionParams) MarshalBson(buf *bytes2.ChunkedWriter) {
 	lenWriter := bson.NewLenWriter(buf)
 
 	bson.EncodeString(buf, "TabletType", string(spm.TabletType))
+	bson.EncodeString(buf, "ReadAfterWrite", spm.ReadAfterWrite)
 
 	buf.WriteByte(0)
 	lenWriter.RecordLen()
@@ -51,6 +59,8 @@ func (spm *SessionParams) UnmarshalBson(buf *bytes.Buffer) {
 		switch key {
 		case "TabletType":
 			spm.TabletType = topo.TabletType(bson.DecodeString(buf, kind))
+		case "ReadAfterWrite":
+			spm.ReadAfterWrite = bson.DecodeString(buf, kind)
 		default:
 			panic(bson.NewBsonError("Unrecognized tag %s", key))
 		}
@@ -173,7 +183,134 @@ func (bqs *BatchQueryShard) UnmarshalBson(buf *bytes.Buffer) {
 	}
 }
 
+// QueryLookup is a query sent to the shards that have the rows
+// whose Column has the value of the bind variable named after it,
+// as found in the lookup table of Column in the vschema of Table.
+type QueryLookup struct {
+	Sql           string
+	BindVariables map[string]interface{}
+	SessionId     int64
+	Keyspace      string
+	Table         string
+	Column        string
+}
+
+func (qrl *QueryLookup) MarshalBson(buf *bytes2.ChunkedWriter) {
+	lenWriter := bson.NewLenWriter(buf)
+
+	bson.EncodeString(buf, "Sql", qrl.Sql)
+	tproto.EncodeBindVariablesBson(buf, "BindVariables", qrl.BindVariables)
+	bson.EncodeInt64(buf, "SessionId", qrl.SessionId)
+	bson.EncodeString(buf, "Keyspace", qrl.Keyspace)
+	bson.EncodeString(buf, "Table", qrl.Table)
+	bson.EncodeString(buf, "Column", qrl.Column)
+
+	buf.WriteByte(0)
+	lenWriter.RecordLen()
+}
+
+func (qrl *QueryLookup) UnmarshalBson(buf *bytes.Buffer) {
+	bson.Next(buf, 4)
+
+	kind := bson.NextByte(buf)
+	for kind != bson.EOO {
+		key := bson.ReadCString(buf)
+		switch key {
+		case "Sql":
+			qrl.Sql = bson.DecodeString(buf, kind)
+		case "BindVariables":
+			qrl.BindVariables = tproto.DecodeBindVariablesBson(buf, kind)
+		case "SessionId":
+			qrl.SessionId = bson.DecodeInt64(buf, kind)
+		case "Keyspace":
+			qrl.Keyspace = bson.DecodeString(buf, kind)
+		case "Table":
+			qrl.Table = bson.DecodeString(buf, kind)
+		case "Column":
+			qrl.Column = bson.DecodeString(buf, kind)
+		default:
+			panic(bson.NewBsonError("Unrecognized tag %s", key))
+		}
+		kind = bson.NextByte(buf)
+	}
+}
+
+// ExplainResult describes how a query would be executed.
+type ExplainResult struct {
+	// Routing is how the shards were found, see vtgate.Explain.
+	Routing string
+	Shards  []string
+	// Sql and BindVariables are the query the shards would get.
+	Sql           string
+	BindVariables map[string]interface{}
+}
+
+func (er *ExplainResult) MarshalBson(buf *bytes2.ChunkedWriter) {
+	lenWriter := bson.NewLenWriter(buf)
+
+	bson.EncodeString(buf, "Routing", er.Routing)
+	bson.EncodeStringArray(buf, "Shards", er.Shards)
+	bson.EncodeString(buf, "Sql", er.Sql)
+	tproto.EncodeBindVariablesBson(buf, "BindVariables", er.BindVariables)
+
+	buf.WriteByte(0)
+	lenWriter.RecordLen()
+}
+
+func (er *ExplainResult) UnmarshalBson(buf *bytes.Buffer) {
+	bson.Next(buf, 4)
+
+	kind := bson.NextByte(buf)
+	for kind != bson.EOO {
+		key := bson.ReadCString(buf)
+		switch key {
+		case "Routing":
+			er.Routing = bson.DecodeString(buf, kind)
+		case "Shards":
+			er.Shards = bson.DecodeStringArray(buf, kind)
+		case "Sql":
+			er.Sql = bson.DecodeString(buf, kind)
+		case "BindVariables":
+			er.BindVariables = tproto.DecodeBindVariablesBson(buf, kind)
+		default:
+			panic(bson.NewBsonError("Unrecognized tag %s", key))
+		}
+		kind = bson.NextByte(buf)
+	}
+}
+
 // RegisterAuthenticated registers the server.
 func RegisterAuthenticated(vtgate VTGate) {
 	rpcwrap.RegisterAuthenticated(vtgate)
 }
+
+// SchemaCacheInvalidation drops the cached schema query results of
+// Keyspace, or of all the keyspaces if it is empty.
+type SchemaCacheInvalidation struct {
+	Keyspace string
+}
+
+func (sci *SchemaCacheInvalidation) MarshalBson(buf *bytes2.ChunkedWriter) {
+	lenWriter := bson.NewLenWriter(buf)
+
+	bson.EncodeString(buf, "Keyspace", sci.Keyspace)
+
+	buf.WriteByte(0)
+	lenWriter.RecordLen()
+}
+
+func (sci *SchemaCacheInvalidation) UnmarshalBson(buf *bytes.Buffer) {
+	bson.Next(buf, 4)
+
+	kind := bson.NextByte(buf)
+	for kind != bson.EOO {
+		key := bson.ReadCString(buf)
+		switch key {
+		case "Keyspace":
+			sci.Keyspace = bson.DecodeString(buf, kind)
+		default:
+			panic(bson.NewBsonError("Unrecognized tag %s", key))
+		}
+		kind = bson.NextByte(buf)
+	}
+}
@@ -13,7 +13,8 @@ import (
 )
 
 type reflectSessionParams struct {
-	TabletType topo.TabletType
+	TabletType     topo.TabletType
+	ReadAfterWrite string
 }
 
 type badSessionParams struct {
@@ -22,13 +23,13 @@ type badSessionParams struct {
 }
 
 func TestSessionParams(t *testing.T) {
-	reflected, err := bson.Marshal(&reflectSessionParams{topo.TabletType("master")})
+	reflected, err := bson.Marshal(&reflectSessionParams{topo.TabletType("replica"), "master"})
 	if err != nil {
 		t.Error(err)
 	}
 	want := string(reflected)
 
-	custom := SessionParams{topo.TabletType("master")}
+	custom := SessionParams{topo.TabletType("replica"), "master"}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
 		t.Error(err)
@@ -185,6 +186,91 @@ func TestQueryShard(t *testing.T) {
 	}
 }
 
+type reflectQueryLookup struct {
+	Sql           string
+	BindVariables map[string]interface{}
+	SessionId     int64
+	Keyspace      string
+	Table         string
+	Column        string
+}
+
+type badQueryLookup struct {
+	Extra         int
+	Sql           string
+	BindVariables map[string]interface{}
+	SessionId     int64
+	Keyspace      string
+	Table         string
+	Column        string
+}
+
+func TestQueryLookup(t *testing.T) {
+	reflected, err := bson.Marshal(&reflectQueryLookup{
+		Sql:           "query",
+		BindVariables: map[string]interface{}{"name": "bob"},
+		SessionId:     1,
+		Keyspace:      "keyspace",
+		Table:         "user",
+		Column:        "name",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	want := string(reflected)
+
+	custom := QueryLookup{
+		Sql:           "query",
+		BindVariables: map[string]interface{}{"name": "bob"},
+		SessionId:     1,
+		Keyspace:      "keyspace",
+		Table:         "user",
+		Column:        "name",
+	}
+	encoded, err := bson.Marshal(&custom)
+	if err != nil {
+		t.Error(err)
+	}
+	got := string(encoded)
+	if want != got {
+		t.Errorf("want\n%#v, got\n%#v", want, got)
+	}
+
+	var unmarshalled QueryLookup
+	err = bson.Unmarshal(encoded, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+	if custom.Sql != unmarshalled.Sql {
+		t.Errorf("want %v, got %v", custom.Sql, unmarshalled.Sql)
+	}
+	if custom.SessionId != unmarshalled.SessionId {
+		t.Errorf("want %v, got %v", custom.SessionId, unmarshalled.SessionId)
+	}
+	if custom.Keyspace != unmarshalled.Keyspace {
+		t.Errorf("want %v, got %v", custom.Keyspace, unmarshalled.Keyspace)
+	}
+	if custom.Table != unmarshalled.Table {
+		t.Errorf("want %v, got %v", custom.Table, unmarshalled.Table)
+	}
+	if custom.Column != unmarshalled.Column {
+		t.Errorf("want %v, got %v", custom.Column, unmarshalled.Column)
+	}
+	if string(unmarshalled.BindVariables["name"].([]byte)) != "bob" {
+		t.Errorf("want %v, got %v", custom.BindVariables["name"], unmarshalled.BindVariables["name"])
+	}
+
+	unexpected, err := bson.Marshal(&badQueryLookup{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = bson.Unmarshal(unexpected, &unmarshalled)
+	want = "Unrecognized tag Extra"
+	if err == nil || want != err.Error() {
+		t.Errorf("want %v, got %v", want, err)
+	}
+}
+
 type reflectBoundQuery struct {
 	Sql           string
 	BindVariables map[string]interface{}
@@ -292,3 +378,84 @@ func TestBatchQueryShardBadType(t *testing.T) {
 		t.Errorf("want %v, got %v", want, err)
 	}
 }
+
+type reflectExplainResult struct {
+	Routing       string
+	Shards        []string
+	Sql           string
+	BindVariables map[string]interface{}
+}
+
+func TestExplainResult(t *testing.T) {
+	reflected, err := bson.Marshal(&reflectExplainResult{
+		Routing:       "LOOKUP",
+		Shards:        []string{"-80", "80-"},
+		Sql:           "query",
+		BindVariables: map[string]interface{}{"name": "bob"},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	want := string(reflected)
+
+	custom := ExplainResult{
+		Routing:       "LOOKUP",
+		Shards:        []string{"-80", "80-"},
+		Sql:           "query",
+		BindVariables: map[string]interface{}{"name": "bob"},
+	}
+	encoded, err := bson.Marshal(&custom)
+	if err != nil {
+		t.Error(err)
+	}
+	got := string(encoded)
+	if want != got {
+		t.Errorf("want\n%#v, got\n%#v", want, got)
+	}
+
+	var unmarshalled ExplainResult
+	err = bson.Unmarshal(encoded, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+	if custom.Routing != unmarshalled.Routing || custom.Sql != unmarshalled.Sql {
+		t.Errorf("want %v, got %v", custom, unmarshalled)
+	}
+	if len(unmarshalled.Shards) != 2 || unmarshalled.Shards[1] != "80-" {
+		t.Errorf("want %v, got %v", custom.Shards, unmarshalled.Shards)
+	}
+	if string(unmarshalled.BindVariables["name"].([]byte)) != "bob" {
+		t.Errorf("want %v, got %v", custom.BindVariables["name"], unmarshalled.BindVariables["name"])
+	}
+}
+
+type reflectSchemaCacheInvalidation struct {
+	Keyspace string
+}
+
+func TestSchemaCacheInvalidation(t *testing.T) {
+	reflected, err := bson.Marshal(&reflectSchemaCacheInvalidation{Keyspace: "user"})
+	if err != nil {
+		t.Error(err)
+	}
+	want := string(reflected)
+
+	custom := SchemaCacheInvalidation{Keyspace: "user"}
+	encoded, err := bson.Marshal(&custom)
+	if err != nil {
+		t.Error(err)
+	}
+	got := string(encoded)
+	if want != got {
+		t.Errorf("want\n%#v, got\n%#v", want, got)
+	}
+
+	var unmarshalled SchemaCacheInvalidation
+	err = bson.Unmarshal(encoded, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+	if custom != unmarshalled {
+		t.Errorf("want %v, got %#v", custom, unmarshalled)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+	"github.com/youtube/vitess/go/streamlog"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+// QueryLogger streams a record for every query vtgate executes. It
+// is served over HTTP by the vtgate binary.
+var QueryLogger = streamlog.New("VTGate", 50)
+
+// queryLogStats is the record sent to QueryLogger for one query.
+type queryLogStats struct {
+	Method       string
+	Sql          string
+	BindVarCount int
+	Keyspace     string
+	Shards       []string
+	RowsAffected int
+	StartTime    time.Time
+	EndTime      time.Time
+	Error        error
+	context      *rpcproto.Context
+}
+
+func newQueryLogStats(method string, context *rpcproto.Context, sql string, bindVars map[string]interface{}, keyspace string, shards []string) *queryLogStats {
+	return &queryLogStats{
+		Method:       method,
+		Sql:          sql,
+		BindVarCount: len(bindVars),
+		Keyspace:     keyspace,
+		Shards:       shards,
+		StartTime:    time.Now(),
+		context:      context,
+	}
+}
+
+// Send records the error, if any, and sends the stats to QueryLogger.
+func (stats *queryLogStats) Send(err error) {
+	stats.EndTime = time.Now()
+	stats.Error = err
+	QueryLogger.Send(stats)
+}
+
+func (stats *queryLogStats) RemoteAddr() string {
+	if stats.context == nil {
+		return ""
+	}
+	return stats.context.RemoteAddr
+}
+
+func (stats *queryLogStats) Username() string {
+	if stats.context == nil {
+		return ""
+	}
+	return stats.context.Username
+}
+
+// ErrorStr returns the error message, or an empty string if the
+// query succeeded.
+func (stats *queryLogStats) ErrorStr() string {
+	if stats.Error == nil {
+		return ""
+	}
+	return stats.Error.Error()
+}
+
+// Format returns a tab separated list of logged fields. If the
+// 'errors' parameter is set, successful queries are not returned.
+func (stats *queryLogStats) Format(params url.Values) string {
+	if _, errorsOnly := params["errors"]; errorsOnly && stats.Error == nil {
+		return ""
+	}
+	return fmt.Sprintf(
+		"%v\t%v\t%v\t%v\t%v\t%v\t%q\t%v\t%v\t%v\t%v\t%q\t\n",
+		stats.Method,
+		stats.RemoteAddr(),
+		stats.Username(),
+		stats.StartTime,
+		stats.EndTime,
+		stats.EndTime.Sub(stats.StartTime).Seconds(),
+		sqlparser.Sanitize(stats.Sql),
+		stats.BindVarCount,
+		stats.Keyspace,
+		strings.Join(stats.Shards, ","),
+		stats.RowsAffected,
+		stats.ErrorStr())
+}
+
+// sanitizeQueryShard returns a copy of query with its values removed
+// according to -query-sanitization, to be used in errors and logs.
+func sanitizeQueryShard(query *proto.QueryShard) *proto.QueryShard {
+	if !sqlparser.SanitizationEnabled() {
+		return query
+	}
+	sanitized := *query
+	sanitized.Sql = sqlparser.Sanitize(query.Sql)
+	sanitized.BindVariables = sqlparser.SanitizeBindVariables(query.BindVariables)
+	return &sanitized
+}
+
+// sanitizeBatchQueryShard is the batch version of sanitizeQueryShard.
+func sanitizeBatchQueryShard(batchQuery *proto.BatchQueryShard) *proto.BatchQueryShard {
+	if !sqlparser.SanitizationEnabled() {
+		return batchQuery
+	}
+	sanitized := *batchQuery
+	sanitized.Queries = make([]tproto.BoundQuery, len(batchQuery.Queries))
+	for i, q := range batchQuery.Queries {
+		sanitized.Queries[i] = tproto.BoundQuery{
+			Sql:           sqlparser.Sanitize(q.Sql),
+			BindVariables: sqlparser.SanitizeBindVariables(q.BindVariables),
+		}
+	}
+	return &sanitized
+}
+
+// sanitizeQueryLookup is the lookup version of sanitizeQueryShard.
+func sanitizeQueryLookup(query *proto.QueryLookup) *proto.QueryLookup {
+	if !sqlparser.SanitizationEnabled() {
+		return query
+	}
+	sanitized := *query
+	sanitized.Sql = sqlparser.Sanitize(query.Sql)
+	sanitized.BindVariables = sqlparser.SanitizeBindVariables(query.BindVariables)
+	return &sanitized
+}
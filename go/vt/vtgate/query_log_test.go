@@ -0,0 +1,42 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+)
+
+func TestQueryLogFormat(t *testing.T) {
+	context := &rpcproto.Context{RemoteAddr: "1.2.3.4:5", Username: "user"}
+	stats := newQueryLogStats("ExecuteShard", context, "select * from t where id = :id", map[string]interface{}{"id": 1}, "ks", []string{"-80", "80-"})
+	stats.RowsAffected = 3
+	stats.Send(nil)
+
+	line := stats.Format(url.Values{})
+	fields := strings.Split(strings.TrimSuffix(line, "\t\n"), "\t")
+	if len(fields) != 12 {
+		t.Fatalf("want 12 fields, got %v: %q", len(fields), line)
+	}
+	if fields[0] != "ExecuteShard" || fields[1] != "1.2.3.4:5" || fields[2] != "user" {
+		t.Errorf("bad caller fields: %q", line)
+	}
+	if fields[6] != `"select * from t where id = :id"` || fields[7] != "1" || fields[8] != "ks" || fields[9] != "-80,80-" || fields[10] != "3" || fields[11] != `""` {
+		t.Errorf("bad query fields: %q", line)
+	}
+	if line := stats.Format(url.Values{"errors": {"true"}}); line != "" {
+		t.Errorf("successful query should be filtered out with errors=true: %q", line)
+	}
+
+	stats.Send(fmt.Errorf("no such table"))
+	line = stats.Format(url.Values{"errors": {"true"}})
+	if !strings.HasSuffix(line, "\t\"no such table\"\t\n") {
+		t.Errorf("failed query should be returned with errors=true: %q", line)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"strings"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the read-after-write consistency of the sessions:
+once a session committed a write to a shard, its reads of that shard
+outside of transactions see the write. The writes of these sessions
+go to the masters, which return their replication group id after each
+commit (see -queryserver-config-report-commit-group-id), and the reads
+are sent:
+- to the master, in the RAW_MASTER mode,
+- to the session tablet type in the RAW_REPLICA mode, with a
+  MIN_GROUP_ID directive so a tablet that is behind refuses the
+  query. The query is then sent to the master.
+The mode of the session can be replaced for a query by the
+READ_AFTER_WRITE directive.
+*/
+
+const (
+	RAW_MASTER  = "master"
+	RAW_REPLICA = "replica"
+	RAW_NONE    = "none"
+)
+
+// errBehindGroupId is in the errors of the queries whose MIN_GROUP_ID
+// was not reached, see tabletserver.ERR_BEHIND_GROUP_ID.
+const errBehindGroupId = "behind group id"
+
+var readAfterWriteStats = stats.NewCounters("ReadAfterWrite")
+
+// checkReadAfterWrite returns an error if mode is not a valid
+// read-after-write mode for a session.
+func checkReadAfterWrite(mode string) error {
+	switch mode {
+	case "", RAW_NONE, RAW_MASTER, RAW_REPLICA:
+		return nil
+	}
+	return fmt.Errorf("invalid read-after-write mode %v", mode)
+}
+
+// recordWrites remembers the group ids of the shards written by the
+// committed transaction.
+func (stc *ScatterConn) recordWrites() {
+	if stc.readAfterWrite == "" {
+		return
+	}
+	for _, sdc := range stc.commitOrder {
+		stc.lastWrites[sdc.keyspace+"/"+sdc.shard] = sdc.CommitGroupId()
+	}
+}
+
+// readMode returns the read-after-write mode of a read of
+// keyspace/shard, and the group id it has to see. The mode is "" if
+// the read can go to any tablet of the session type.
+func (stc *ScatterConn) readMode(query, keyspace, shard string) (mode, groupId string) {
+	groupId, ok := stc.lastWrites[keyspace+"/"+shard]
+	if !ok {
+		return "", ""
+	}
+	mode = stc.readAfterWrite
+	if directive, ok := sqlparser.ParseDirectives(query)[sqlparser.DIRECTIVE_READ_AFTER_WRITE]; ok {
+		mode = directive
+	}
+	switch mode {
+	case RAW_MASTER:
+		return RAW_MASTER, ""
+	case RAW_REPLICA:
+		if stc.tabletType == topo.TYPE_MASTER {
+			return "", ""
+		}
+		if groupId == "" {
+			// the master does not report its group id
+			return RAW_MASTER, ""
+		}
+		return RAW_REPLICA, groupId
+	}
+	return "", ""
+}
+
+// readConnection returns the connection and the query to use for a
+// read in the given mode.
+func (stc *ScatterConn) readConnection(mode, groupId, query, keyspace, shard string) (*ShardConn, string) {
+	stc.connsMu.Lock()
+	defer stc.connsMu.Unlock()
+	readAfterWriteStats.Add(mode, 1)
+	if mode == RAW_MASTER {
+		return stc.shardConn(keyspace, shard, topo.TYPE_MASTER), query
+	}
+	// trailing comments are kept by vttablet
+	return stc.shardConn(keyspace, shard, stc.tabletType), fmt.Sprintf("%s /*vt+ %s=%s */", query, sqlparser.DIRECTIVE_MIN_GROUP_ID, groupId)
+}
+
+func isBehindGroupId(err error) bool {
+	return err != nil && strings.Contains(err.Error(), errBehindGroupId)
+}
+
+// readAfterWriteExecute executes a read in the given mode, falling
+// back to the master if the tablet is behind.
+func (stc *ScatterConn) readAfterWriteExecute(mode, groupId, query string, bindVars map[string]interface{}, keyspace, shard string) (*mproto.QueryResult, error) {
+	sdc, rquery := stc.readConnection(mode, groupId, query, keyspace, shard)
+	qr, err := sdc.Execute(rquery, bindVars)
+	if mode == RAW_REPLICA && isBehindGroupId(err) {
+		readAfterWriteStats.Add("Fallback", 1)
+		sdc, rquery = stc.readConnection(RAW_MASTER, "", query, keyspace, shard)
+		qr, err = sdc.Execute(rquery, bindVars)
+	}
+	return qr, err
+}
+
+// readAfterWriteStream is the streaming version of
+// readAfterWriteExecute. The tablets check the group id before
+// streaming any row, so a failed stream can be sent again.
+func (stc *ScatterConn) readAfterWriteStream(mode, groupId, query string, bindVars map[string]interface{}, keyspace, shard string, results chan<- *mproto.QueryResult) error {
+	sdc, rquery := stc.readConnection(mode, groupId, query, keyspace, shard)
+	sr, errFunc := sdc.StreamExecute(rquery, bindVars)
+	for qr := range sr {
+		results <- qr
+	}
+	err := errFunc()
+	if mode == RAW_REPLICA && isBehindGroupId(err) {
+		readAfterWriteStats.Add("Fallback", 1)
+		sdc, rquery = stc.readConnection(RAW_MASTER, "", query, keyspace, shard)
+		sr, errFunc = sdc.StreamExecute(rquery, bindVars)
+		for qr := range sr {
+			results <- qr
+		}
+		err = errFunc()
+	}
+	return err
+}
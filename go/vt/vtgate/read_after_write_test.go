@@ -0,0 +1,111 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// This file uses the sandbox_test framework. The replica of shard "0"
+// is tablet 0, and its master is tablet 10.
+
+func newReadAfterWriteConn(t *testing.T, mode string) (stc *ScatterConn, replica, master *sandboxConn) {
+	resetSandbox()
+	replica, master = &sandboxConn{}, &sandboxConn{commitGroupId: "2"}
+	testConns[0] = replica
+	testConns[10] = master
+	sandboxMasterUids["0"] = 10
+	blm := NewBalancerMap(new(sandboxTopo), "aa")
+	stc = NewScatterConn(blm, topo.TYPE_REPLICA, 1*time.Millisecond, 3)
+	stc.readAfterWrite = mode
+	if _, err := stc.Execute("select 1", nil, "", []string{"0"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	stc.Begin()
+	if _, err := stc.Execute("insert 1", nil, "", []string{"0"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if err := stc.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if replica.ExecCount != 1 || master.CommitCount != 1 {
+		t.Fatalf("the write should have gone to the master: %v execs on the replica, %v commits on the master", replica.ExecCount, master.CommitCount)
+	}
+	return stc, replica, master
+}
+
+func TestReadAfterWriteMaster(t *testing.T) {
+	stc, replica, master := newReadAfterWriteConn(t, RAW_MASTER)
+	if _, err := stc.Execute("select 2", nil, "", []string{"0"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if replica.ExecCount != 1 || master.Queries[len(master.Queries)-1].Sql != "select 2" {
+		t.Errorf("the read should have gone to the master: %v", master.Queries)
+	}
+
+	// the directive replaces the mode of the session
+	if _, err := stc.Execute("select 3 /*vt+ READ_AFTER_WRITE=none */", nil, "", []string{"0"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if replica.ExecCount != 2 {
+		t.Errorf("the read should have gone to the replica")
+	}
+}
+
+func TestReadAfterWriteReplica(t *testing.T) {
+	stc, replica, master := newReadAfterWriteConn(t, RAW_REPLICA)
+	if _, err := stc.Execute("select 2", nil, "", []string{"0"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	want := "select 2 /*vt+ MIN_GROUP_ID=2 */"
+	if got := replica.Queries[len(replica.Queries)-1].Sql; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// the replica is behind: the read is sent to the master
+	replica.mustFailBehind = 1
+	execCount := master.ExecCount
+	if _, err := stc.Execute("select 3", nil, "", []string{"0"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if master.ExecCount != execCount+1 || master.Queries[len(master.Queries)-1].Sql != "select 3" {
+		t.Errorf("the read should have gone to the master: %v", master.Queries)
+	}
+
+	// other shards are not affected
+	testConns[1] = &sandboxConn{}
+	if _, err := stc.Execute("select 4", nil, "", []string{"1"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got := testConns[1].(*sandboxConn).Queries[0].Sql; strings.Contains(got, "MIN_GROUP_ID") {
+		t.Errorf("unexpected directive in %v", got)
+	}
+}
+
+func TestReadAfterWriteReplicaNoGroupId(t *testing.T) {
+	stc, replica, master := newReadAfterWriteConn(t, RAW_REPLICA)
+	stc.lastWrites["/0"] = ""
+	if _, err := stc.Execute("select 2", nil, "", []string{"0"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if replica.ExecCount != 1 || master.Queries[len(master.Queries)-1].Sql != "select 2" {
+		t.Errorf("without group id, the read should have gone to the master")
+	}
+}
+
+func TestCheckReadAfterWrite(t *testing.T) {
+	for _, mode := range []string{"", RAW_NONE, RAW_MASTER, RAW_REPLICA} {
+		if err := checkReadAfterWrite(mode); err != nil {
+			t.Errorf("checkReadAfterWrite(%v): %v", mode, err)
+		}
+	}
+	if err := checkReadAfterWrite("rdonly"); err == nil {
+		t.Errorf("checkReadAfterWrite(rdonly) should have failed")
+	}
+}
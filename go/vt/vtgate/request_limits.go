@@ -0,0 +1,254 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+)
+
+/*
+This file contains the limits on the number of queries vtgate serves
+at once, in total and per keyspace. When a limit is reached, the next
+queries wait in a bounded queue, and fail with an overload error when
+the queue is full or their wait is too long. This way a slow keyspace
+or tablet makes vtgate fail fast instead of piling up requests until it
+runs out of memory. The transaction control calls (Begin, Commit,
+Rollback) are not limited, so a transaction can always be concluded.
+*/
+
+var (
+	maxInFlight            = flag.Int("max-in-flight", 0, "maximum number of queries served at once, the next ones wait in a queue (0 for no limit)")
+	maxInFlightPerKeyspace = flag.Int("max-in-flight-per-keyspace", 0, "maximum number of queries to a keyspace served at once, the next ones wait in a queue (0 for no limit)")
+	maxQueued              = flag.Int("max-queued", 1000, "maximum number of queries waiting for each in-flight limit, the next ones fail right away")
+	queueTimeout           = flag.Duration("queue-timeout", time.Second, "how long a query waits for an in-flight limit before failing (0 to wait forever)")
+)
+
+// globalLimit is the name of the global limit in the stats and errors.
+const globalLimit = "global"
+
+// ErrOverloaded is the prefix of the errors of the queries that were
+// rejected by a limit.
+const ErrOverloaded = "vtgate overloaded"
+
+// requestLimiter is one in-flight limit, with its queue.
+type requestLimiter struct {
+	name      string
+	sem       *sync2.Semaphore
+	maxQueued int64
+	inFlight  sync2.AtomicInt64
+	queued    sync2.AtomicInt64
+}
+
+func newRequestLimiter(name string, max, maxQueued int, timeout time.Duration) *requestLimiter {
+	return &requestLimiter{
+		name:      name,
+		sem:       sync2.NewSemaphore(max, timeout),
+		maxQueued: int64(maxQueued),
+	}
+}
+
+func (rl *requestLimiter) acquire(rls *RequestLimits) error {
+	if !rl.sem.TryAcquire() {
+		if rl.queued.Add(1) > rl.maxQueued {
+			rl.queued.Add(-1)
+			rls.overloads.Add(rl.name, 1)
+			return fmt.Errorf("%v: too many queries for %v, and %v already waiting", ErrOverloaded, rl.name, rl.maxQueued)
+		}
+		start := time.Now()
+		ok := rl.sem.Acquire()
+		rl.queued.Add(-1)
+		rls.waits.Record(rl.name, start)
+		if !ok {
+			rls.overloads.Add(rl.name, 1)
+			return fmt.Errorf("%v: too many queries for %v, timed out after %v in the queue", ErrOverloaded, rl.name, time.Now().Sub(start))
+		}
+	}
+	rl.inFlight.Add(1)
+	return nil
+}
+
+func (rl *requestLimiter) release() {
+	rl.inFlight.Add(-1)
+	rl.sem.Release()
+}
+
+// RequestLimits are the global and per-keyspace in-flight limits of
+// the queries. A nil RequestLimits limits nothing.
+type RequestLimits struct {
+	maxPerKeyspace int
+	maxQueued      int
+	timeout        time.Duration
+
+	// global is nil if there is no global limit
+	global *requestLimiter
+
+	// servedKeyspaces returns the keyspaces of the serving graph.
+	// Only they get a limit of their own, the other names sent by
+	// the clients are only subject to the global limit. If it is
+	// nil, all the keyspaces get a limit.
+	servedKeyspaces func() ([]string, error)
+
+	// servedTTL is how long the result of servedKeyspaces is used
+	// before it is read again.
+	servedTTL time.Duration
+
+	mu        sync.Mutex
+	keyspaces map[string]*requestLimiter
+
+	// served is the last result of servedKeyspaces, read at
+	// servedTime. It has its own mutex, so the other queries don't
+	// wait for the topology.
+	servedMu   sync.Mutex
+	served     map[string]bool
+	servedTime time.Time
+
+	// overloads counts the rejected queries, and waits times
+	// the queued ones, by limit name
+	overloads *stats.Counters
+	waits     *stats.Timings
+}
+
+// NewRequestLimits creates a RequestLimits. A max of 0 means no limit.
+func NewRequestLimits(max, maxPerKeyspace, maxQueued int, timeout time.Duration) *RequestLimits {
+	rls := &RequestLimits{
+		maxPerKeyspace: maxPerKeyspace,
+		maxQueued:      maxQueued,
+		timeout:        timeout,
+		servedTTL:      *srvTopoCacheTTL,
+		keyspaces:      make(map[string]*requestLimiter),
+		overloads:      stats.NewCounters(""),
+		waits:          stats.NewTimings(""),
+	}
+	if max > 0 {
+		rls.global = newRequestLimiter(globalLimit, max, maxQueued, timeout)
+	}
+	return rls
+}
+
+func newRequestLimitsFromFlags(blm *BalancerMap) *RequestLimits {
+	if *maxInFlight == 0 && *maxInFlightPerKeyspace == 0 {
+		return nil
+	}
+	rls := NewRequestLimits(*maxInFlight, *maxInFlightPerKeyspace, *maxQueued, *queueTimeout)
+	rls.servedKeyspaces = func() ([]string, error) {
+		return blm.Toposerv.GetSrvKeyspaceNames(blm.Cell)
+	}
+	stats.Publish("VtgateInFlight", stats.CountersFunc(rls.InFlight))
+	stats.Publish("VtgateQueued", stats.CountersFunc(rls.Queued))
+	stats.Publish("VtgateOverloads", rls.overloads)
+	stats.Publish("VtgateQueueWaits", rls.waits)
+	return rls
+}
+
+// keyspaceLimiter returns the limiter of keyspace, or nil if it has
+// none. The limiters are only created for the served keyspaces, so
+// the clients cannot add limiters and stats with any name they send.
+func (rls *RequestLimits) keyspaceLimiter(keyspace string) *requestLimiter {
+	if rls.maxPerKeyspace <= 0 {
+		return nil
+	}
+	rls.mu.Lock()
+	rl, ok := rls.keyspaces[keyspace]
+	rls.mu.Unlock()
+	if ok {
+		return rl
+	}
+	if !rls.isServed(keyspace) {
+		return nil
+	}
+
+	rls.mu.Lock()
+	defer rls.mu.Unlock()
+	rl, ok = rls.keyspaces[keyspace]
+	if !ok {
+		rl = newRequestLimiter(keyspace, rls.maxPerKeyspace, rls.maxQueued, rls.timeout)
+		rls.keyspaces[keyspace] = rl
+	}
+	return rl
+}
+
+// isServed returns true if keyspace is in the serving graph. The
+// served keyspaces are read at most once per servedTTL, so the
+// queries to the keyspaces without a limiter don't all read the
+// topology. If they cannot be read, the last known ones are used.
+func (rls *RequestLimits) isServed(keyspace string) bool {
+	if rls.servedKeyspaces == nil {
+		return true
+	}
+	rls.servedMu.Lock()
+	defer rls.servedMu.Unlock()
+	if time.Now().Sub(rls.servedTime) >= rls.servedTTL {
+		rls.servedTime = time.Now()
+		names, err := rls.servedKeyspaces()
+		if err == nil {
+			rls.served = make(map[string]bool, len(names))
+			for _, name := range names {
+				rls.served[name] = true
+			}
+		}
+	}
+	return rls.served[keyspace]
+}
+
+// Acquire waits for a query to keyspace to be allowed, and returns the
+// function to call when it is done. The keyspace limit is acquired
+// first, so the queries of a slow keyspace don't hold the global
+// slots while they wait.
+func (rls *RequestLimits) Acquire(keyspace string) (release func(), err error) {
+	if rls == nil {
+		return func() {}, nil
+	}
+	rl := rls.keyspaceLimiter(keyspace)
+	if rl != nil {
+		if err := rl.acquire(rls); err != nil {
+			return nil, err
+		}
+	}
+	if rls.global != nil {
+		if err := rls.global.acquire(rls); err != nil {
+			if rl != nil {
+				rl.release()
+			}
+			return nil, err
+		}
+	}
+	return func() {
+		if rls.global != nil {
+			rls.global.release()
+		}
+		if rl != nil {
+			rl.release()
+		}
+	}, nil
+}
+
+// InFlight returns the number of queries being served, by limit name.
+func (rls *RequestLimits) InFlight() map[string]int64 {
+	return rls.counts(func(rl *requestLimiter) int64 { return rl.inFlight.Get() })
+}
+
+// Queued returns the number of queries waiting, by limit name.
+func (rls *RequestLimits) Queued() map[string]int64 {
+	return rls.counts(func(rl *requestLimiter) int64 { return rl.queued.Get() })
+}
+
+func (rls *RequestLimits) counts(get func(rl *requestLimiter) int64) map[string]int64 {
+	rls.mu.Lock()
+	defer rls.mu.Unlock()
+	result := make(map[string]int64, len(rls.keyspaces)+1)
+	if rls.global != nil {
+		result[globalLimit] = get(rls.global)
+	}
+	for keyspace, rl := range rls.keyspaces {
+		result[keyspace] = get(rl)
+	}
+	return result
+}
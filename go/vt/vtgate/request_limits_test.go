@@ -0,0 +1,189 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestLimitsNil(t *testing.T) {
+	var rls *RequestLimits
+	release, err := rls.Acquire("ks")
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	release()
+}
+
+func TestRequestLimitsGlobal(t *testing.T) {
+	rls := NewRequestLimits(1, 0, 1, 20*time.Millisecond)
+	release, err := rls.Acquire("ks1")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if got := rls.InFlight()[globalLimit]; got != 1 {
+		t.Errorf("want 1 in flight, got %v", got)
+	}
+
+	// the second query waits in the queue, the third one is rejected
+	waitErr := make(chan error)
+	go func() {
+		_, err := rls.Acquire("ks2")
+		waitErr <- err
+	}()
+	for rls.Queued()[globalLimit] != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := rls.Acquire("ks2"); err == nil || !strings.Contains(err.Error(), "already waiting") {
+		t.Errorf("want queue full error, got %v", err)
+	}
+	if err := <-waitErr; err == nil || !strings.HasPrefix(err.Error(), ErrOverloaded) {
+		t.Errorf("want queue timeout error, got %v", err)
+	}
+	if got := rls.overloads.Counts()[globalLimit]; got != 2 {
+		t.Errorf("want 2 overloads, got %v", got)
+	}
+
+	// a queued query gets the slot of a finished one
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		release()
+	}()
+	release, err = rls.Acquire("ks2")
+	if err != nil {
+		t.Fatalf("Acquire after release: %v", err)
+	}
+	release()
+	if got := rls.InFlight()[globalLimit]; got != 0 {
+		t.Errorf("want 0 in flight, got %v", got)
+	}
+}
+
+func TestRequestLimitsPerKeyspace(t *testing.T) {
+	rls := NewRequestLimits(0, 1, 0, 0)
+	release, err := rls.Acquire("ks1")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if _, err := rls.Acquire("ks1"); err == nil {
+		t.Errorf("second query to ks1 should have been rejected")
+	}
+	release2, err := rls.Acquire("ks2")
+	if err != nil {
+		t.Errorf("a full keyspace should not block the others: %v", err)
+	} else {
+		release2()
+	}
+	release()
+	if release, err = rls.Acquire("ks1"); err != nil {
+		t.Errorf("Acquire after release: %v", err)
+	} else {
+		release()
+	}
+}
+
+func TestRequestLimitsServedKeyspaces(t *testing.T) {
+	rls := NewRequestLimits(0, 1, 0, 0)
+	rls.servedKeyspaces = func() ([]string, error) {
+		return []string{"ks1"}, nil
+	}
+	release, err := rls.Acquire("ks1")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer release()
+	if _, err := rls.Acquire("ks1"); err == nil {
+		t.Errorf("second query to ks1 should have been rejected")
+	}
+
+	// unknown keyspaces only get the global limit, and no stats
+	for i := 0; i < 2; i++ {
+		release, err := rls.Acquire("junk")
+		if err != nil {
+			t.Fatalf("Acquire of an unknown keyspace: %v", err)
+		}
+		defer release()
+	}
+	if _, ok := rls.InFlight()["junk"]; ok {
+		t.Errorf("an unknown keyspace should have no limit: %v", rls.InFlight())
+	}
+
+	rls.servedKeyspaces = func() ([]string, error) {
+		return nil, fmt.Errorf("topo down")
+	}
+	if _, err := rls.Acquire("ks1"); err == nil {
+		t.Errorf("ks1 should keep its limit")
+	}
+	if release, err := rls.Acquire("ks2"); err != nil {
+		t.Errorf("Acquire without serving graph: %v", err)
+	} else {
+		release()
+	}
+}
+
+func TestRequestLimitsServedKeyspacesCache(t *testing.T) {
+	rls := NewRequestLimits(0, 1, 0, 0)
+	rls.servedTTL = time.Hour
+	reads := 0
+	served := []string{"ks1"}
+	rls.servedKeyspaces = func() ([]string, error) {
+		reads++
+		return served, nil
+	}
+
+	// the unknown keyspaces don't read the serving graph each time
+	for i := 0; i < 3; i++ {
+		release, err := rls.Acquire("junk")
+		if err != nil {
+			t.Fatalf("Acquire of an unknown keyspace: %v", err)
+		}
+		release()
+	}
+	if reads != 1 {
+		t.Errorf("want 1 read of the served keyspaces, got %v", reads)
+	}
+
+	// a new keyspace gets its limit once the served ones are read again
+	served = []string{"ks1", "ks2"}
+	release, err := rls.Acquire("ks2")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer release()
+	if _, ok := rls.InFlight()["ks2"]; ok {
+		t.Errorf("ks2 should have no limit before the served keyspaces expire")
+	}
+	rls.servedTTL = 0
+	release2, err := rls.Acquire("ks2")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer release2()
+	if got := rls.InFlight()["ks2"]; got != 1 {
+		t.Errorf("want 1 in flight for ks2, got %v", got)
+	}
+
+	// the last known keyspaces are used when they cannot be read
+	rls.servedKeyspaces = func() ([]string, error) {
+		return nil, fmt.Errorf("topo down")
+	}
+	if _, err := rls.Acquire("ks2"); err == nil {
+		t.Errorf("ks2 should keep its limit")
+	}
+	rls.mu.Lock()
+	delete(rls.keyspaces, "ks1")
+	rls.mu.Unlock()
+	release3, err := rls.Acquire("ks1")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer release3()
+	if _, ok := rls.InFlight()["ks1"]; !ok {
+		t.Errorf("ks1 should still be served when the topology is down")
+	}
+}
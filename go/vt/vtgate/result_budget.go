@@ -0,0 +1,67 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"fmt"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/stats"
+)
+
+// This file contains the memory budget of the non-streaming requests:
+// the results of all their shards are merged in memory before being
+// sent, so a scatter query on many shards could exhaust the memory of
+// vtgate. Past the budget, the request fails and its rows are dropped.
+// StreamExecuteShard sends the rows as they come, and has no budget.
+
+var (
+	maxResultRows  = flag.Int64("max-result-rows", 0, "maximum number of rows in the merged results of a non-streaming request (0 for no limit)")
+	maxResultBytes = flag.Int64("max-result-bytes", 0, "maximum size of the values in the merged results of a non-streaming request (0 for no limit)")
+
+	// the requests that went over budget, by limit
+	resultBudgetExceeded = stats.NewCounters("VtgateResultBudgetExceeded")
+)
+
+// resultBudget counts the rows and bytes of the results of a request.
+// A nil resultBudget has no limit.
+type resultBudget struct {
+	maxRows  int64
+	maxBytes int64
+	rows     int64
+	bytes    int64
+}
+
+func newResultBudget() *resultBudget {
+	if *maxResultRows == 0 && *maxResultBytes == 0 {
+		return nil
+	}
+	return &resultBudget{maxRows: *maxResultRows, maxBytes: *maxResultBytes}
+}
+
+// add accounts for qr, and returns an error if the budget is exceeded.
+func (rb *resultBudget) add(qr *mproto.QueryResult) error {
+	if rb == nil {
+		return nil
+	}
+	rb.rows += int64(len(qr.Rows))
+	if rb.maxRows > 0 && rb.rows > rb.maxRows {
+		resultBudgetExceeded.Add("Rows", 1)
+		return fmt.Errorf("result too large: more than %v rows, use StreamExecuteShard", rb.maxRows)
+	}
+	if rb.maxBytes > 0 {
+		for _, row := range qr.Rows {
+			for _, v := range row {
+				rb.bytes += int64(len(v.Raw()))
+			}
+		}
+		if rb.bytes > rb.maxBytes {
+			resultBudgetExceeded.Add("Bytes", 1)
+			return fmt.Errorf("result too large: more than %v bytes, use StreamExecuteShard", rb.maxBytes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// This file applies the routing rules of the global topology (see
+// topo.RoutingRules) to the connections of vtgate, so the queries for
+// a keyspace and tablet type can be sent elsewhere during a migration
+// or an incident. The shard names are kept, so the target keyspace
+// has to be sharded the same way.
+
+var routingStats = stats.NewCounters("VtgateRoutingRules")
+
+// route returns the keyspace and tablet type to connect to for the
+// queries of keyspace and tabletType. If the rules cannot be read,
+// nothing is redirected.
+func (blm *BalancerMap) route(keyspace string, tabletType topo.TabletType) (string, topo.TabletType) {
+	rr, err := blm.Toposerv.GetRoutingRules()
+	if err != nil {
+		routingStats.Add("Error", 1)
+		log.Warningf("GetRoutingRules failed, not redirecting %v %v: %v", keyspace, tabletType, err)
+		return keyspace, tabletType
+	}
+	toKeyspace, toTabletType := rr.Route(keyspace, tabletType)
+	if toKeyspace != keyspace || toTabletType != tabletType {
+		routingStats.Add(keyspace+"."+string(tabletType), 1)
+	}
+	return toKeyspace, toTabletType
+}
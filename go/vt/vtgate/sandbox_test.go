@@ -40,6 +40,26 @@ var (
 
 	// dialMustFail specifies how often sandboxDialer must fail before succeeding
 	dialMustFail int
+
+	// sandboxSrvKeyspaces and sandboxVSchemas are returned by sandboxTopo
+	sandboxSrvKeyspaces map[string]*topo.SrvKeyspace
+	sandboxVSchemas     map[string]*topo.VSchema
+
+	// sandboxShardUids maps the shard names that are not numbers
+	// to the uid of their tablet
+	sandboxShardUids map[string]int
+
+	// sandboxMasterUids maps shard names to the uid of their
+	// master tablet, if it is not the same tablet
+	sandboxMasterUids map[string]int
+
+	// sandboxCellsAliases is returned by sandboxTopo, and the
+	// cells in sandboxEmptyCells have no endpoints
+	sandboxCellsAliases map[string]*topo.CellsAlias
+	sandboxEmptyCells   map[string]bool
+
+	// sandboxRoutingRules is returned by sandboxTopo
+	sandboxRoutingRules *topo.RoutingRules
 )
 
 var (
@@ -54,6 +74,13 @@ func resetSandbox() {
 	endPointCounter = 0
 	dialCounter = 0
 	dialMustFail = 0
+	sandboxSrvKeyspaces = make(map[string]*topo.SrvKeyspace)
+	sandboxVSchemas = make(map[string]*topo.VSchema)
+	sandboxShardUids = make(map[string]int)
+	sandboxMasterUids = make(map[string]int)
+	sandboxCellsAliases = make(map[string]*topo.CellsAlias)
+	sandboxEmptyCells = make(map[string]bool)
+	sandboxRoutingRules = topo.NewRoutingRules()
 }
 
 type sandboxTopo struct {
@@ -64,7 +91,35 @@ func (sct *sandboxTopo) GetSrvKeyspaceNames(cell string) ([]string, error) {
 }
 
 func (sct *sandboxTopo) GetSrvKeyspace(cell, keyspace string) (*topo.SrvKeyspace, error) {
-	panic(fmt.Errorf("not implemented"))
+	sandmu.Lock()
+	defer sandmu.Unlock()
+	srvKeyspace, ok := sandboxSrvKeyspaces[keyspace]
+	if !ok {
+		return nil, topo.ErrNoNode
+	}
+	return srvKeyspace, nil
+}
+
+func (sct *sandboxTopo) GetVSchema(keyspace string) (*topo.VSchema, error) {
+	sandmu.Lock()
+	defer sandmu.Unlock()
+	vschema, ok := sandboxVSchemas[keyspace]
+	if !ok {
+		return nil, topo.ErrNoNode
+	}
+	return vschema, nil
+}
+
+func (sct *sandboxTopo) GetCellsAliases() (map[string]*topo.CellsAlias, error) {
+	sandmu.Lock()
+	defer sandmu.Unlock()
+	return sandboxCellsAliases, nil
+}
+
+func (sct *sandboxTopo) GetRoutingRules() (*topo.RoutingRules, error) {
+	sandmu.Lock()
+	defer sandmu.Unlock()
+	return sandboxRoutingRules, nil
 }
 
 func (sct *sandboxTopo) GetEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) (*topo.EndPoints, error) {
@@ -75,9 +130,19 @@ func (sct *sandboxTopo) GetEndPoints(cell, keyspace, shard string, tabletType to
 		endPointMustFail--
 		return nil, fmt.Errorf("topo error")
 	}
-	uid, err := strconv.Atoi(shard)
-	if err != nil {
-		panic(err)
+	if sandboxEmptyCells[cell] {
+		return &topo.EndPoints{}, nil
+	}
+	uid, ok := sandboxMasterUids[shard]
+	if !ok || tabletType != topo.TYPE_MASTER {
+		uid, ok = sandboxShardUids[shard]
+	}
+	if !ok {
+		var err error
+		uid, err = strconv.Atoi(shard)
+		if err != nil {
+			panic(err)
+		}
 	}
 	return &topo.EndPoints{Entries: []topo.EndPoint{
 		{Uid: uint32(uid), Host: shard, NamedPortMap: map[string]int{"vt": 1}},
@@ -108,6 +173,7 @@ type sandboxConn struct {
 	mustFailConn   int
 	mustFailTxPool int
 	mustFailNotTx  int
+	mustFailBehind int
 	mustDelay      time.Duration
 
 	// These Count vars report how often the corresponding
@@ -118,8 +184,24 @@ type sandboxConn struct {
 	RollbackCount int
 	CloseCount    int
 
+	PrepareCount          int
+	CommitPreparedCount   int
+	RollbackPreparedCount int
+
 	// TransactionId is auto-generated on Begin
 	transactionId int64
+
+	// nextSequenceValue is the next value returned by GetSequenceValues
+	nextSequenceValue int64
+
+	// Queries has the queries sent to Execute and ExecuteBatch
+	Queries []tproto.BoundQuery
+
+	// dtxs is the transaction metadata
+	dtxs map[string]*tproto.DistributedTransaction
+
+	// commitGroupId is returned by CommitGroupId
+	commitGroupId string
 }
 
 func (sbc *sandboxConn) getError() error {
@@ -147,11 +229,16 @@ func (sbc *sandboxConn) getError() error {
 		sbc.mustFailNotTx--
 		return &ServerError{Code: ERR_NOT_IN_TX, Err: "not_in_tx: err"}
 	}
+	if sbc.mustFailBehind > 0 {
+		sbc.mustFailBehind--
+		return &ServerError{Code: ERR_NORMAL, Err: "error: behind group id 2, at 1"}
+	}
 	return nil
 }
 
 func (sbc *sandboxConn) Execute(query string, bindVars map[string]interface{}) (*mproto.QueryResult, error) {
 	sbc.ExecCount++
+	sbc.Queries = append(sbc.Queries, tproto.BoundQuery{Sql: query, BindVariables: bindVars})
 	if sbc.mustDelay != 0 {
 		time.Sleep(sbc.mustDelay)
 	}
@@ -163,6 +250,7 @@ func (sbc *sandboxConn) Execute(query string, bindVars map[string]interface{}) (
 
 func (sbc *sandboxConn) ExecuteBatch(queries []tproto.BoundQuery) (*tproto.QueryResultList, error) {
 	sbc.ExecCount++
+	sbc.Queries = append(sbc.Queries, queries...)
 	if sbc.mustDelay != 0 {
 		time.Sleep(sbc.mustDelay)
 	}
@@ -188,6 +276,16 @@ func (sbc *sandboxConn) StreamExecute(query string, bindVars map[string]interfac
 	return ch, func() error { return err }
 }
 
+func (sbc *sandboxConn) GetSequenceValues(sequence string, count int64) (int64, error) {
+	sbc.ExecCount++
+	if err := sbc.getError(); err != nil {
+		return 0, err
+	}
+	first := sbc.nextSequenceValue
+	sbc.nextSequenceValue += count
+	return first, nil
+}
+
 func (sbc *sandboxConn) Begin() error {
 	sbc.ExecCount++
 	sbc.BeginCount++
@@ -221,11 +319,85 @@ func (sbc *sandboxConn) Rollback() error {
 	return sbc.getError()
 }
 
+func (sbc *sandboxConn) Prepare(dtid string) error {
+	sbc.ExecCount++
+	sbc.PrepareCount++
+	sbc.transactionId = 0
+	return sbc.getError()
+}
+
+func (sbc *sandboxConn) CommitPrepared(dtid string) error {
+	sbc.ExecCount++
+	sbc.CommitPreparedCount++
+	return sbc.getError()
+}
+
+func (sbc *sandboxConn) RollbackPrepared(dtid string, originalId int64) error {
+	sbc.ExecCount++
+	sbc.RollbackPreparedCount++
+	return sbc.getError()
+}
+
+func (sbc *sandboxConn) CreateTransaction(dtid string, participants []tproto.DtxParticipant) error {
+	sbc.ExecCount++
+	if err := sbc.getError(); err != nil {
+		return err
+	}
+	if sbc.dtxs == nil {
+		sbc.dtxs = make(map[string]*tproto.DistributedTransaction)
+	}
+	if _, ok := sbc.dtxs[dtid]; ok {
+		return &ServerError{Code: ERR_NORMAL, Err: "error: duplicate dtid"}
+	}
+	sbc.dtxs[dtid] = &tproto.DistributedTransaction{Dtid: dtid, State: tproto.DTX_PREPARE, Participants: participants}
+	return nil
+}
+
+func (sbc *sandboxConn) SetTransactionState(dtid string, from, to int64) error {
+	sbc.ExecCount++
+	if err := sbc.getError(); err != nil {
+		return err
+	}
+	dtx, ok := sbc.dtxs[dtid]
+	if !ok || dtx.State != from {
+		return &ServerError{Code: ERR_NORMAL, Err: "error: wrong state"}
+	}
+	dtx.State = to
+	return nil
+}
+
+func (sbc *sandboxConn) ConcludeTransaction(dtid string) error {
+	sbc.ExecCount++
+	if err := sbc.getError(); err != nil {
+		return err
+	}
+	delete(sbc.dtxs, dtid)
+	return nil
+}
+
+func (sbc *sandboxConn) ReadTransactions(dtid string, abandonAge time.Duration) ([]tproto.DistributedTransaction, error) {
+	sbc.ExecCount++
+	if err := sbc.getError(); err != nil {
+		return nil, err
+	}
+	var result []tproto.DistributedTransaction
+	for _, dtx := range sbc.dtxs {
+		if dtid == "" || dtx.Dtid == dtid {
+			result = append(result, *dtx)
+		}
+	}
+	return result, nil
+}
+
 func (sbc *sandboxConn) TransactionId() int64 {
 	return sbc.transactionId
 }
 
 // Close does not change ExecCount
+func (sbc *sandboxConn) CommitGroupId() string {
+	return sbc.commitGroupId
+}
+
 func (sbc *sandboxConn) Close() error {
 	sbc.CloseCount++
 	return nil
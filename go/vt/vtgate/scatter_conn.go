@@ -13,7 +13,9 @@ import (
 	log "github.com/golang/glog"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/trace"
 	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 )
@@ -36,6 +38,14 @@ type ScatterConn struct {
 	connsMu        sync.Mutex
 	transactionIds map[*ShardConn]int64
 	commitOrder    []*ShardConn
+
+	// txManager commits the transactions that span more than
+	// one shard with a two-phase commit, if set.
+	txManager *TransactionManager
+
+	// Read-after-write consistency, see read_after_write.go
+	readAfterWrite string
+	lastWrites     map[string]string
 }
 
 // NewScatterConn creates a new ScatterConn. All input parameters are passed through
@@ -48,16 +58,22 @@ func NewScatterConn(blm *BalancerMap, tabletType topo.TabletType, retryDelay tim
 		retryDelay:  retryDelay,
 		retryCount:  retryCount,
 		shardConns:  make(map[string]*ShardConn),
+		lastWrites:  make(map[string]string),
 	}
 }
 
-// Execute executes a non-streaming query on the specified shards.
+// Execute executes a non-streaming query on the specified shards. The
+// results of the selects with an order by, a limit or aggregates are
+// merged like a single database would return them, see merge_sort.go.
+// The merged results have to fit in the -max-result-rows and
+// -max-result-bytes budget.
 func (stc *ScatterConn) Execute(query string, bindVars map[string]interface{}, keyspace string, shards []string) (*mproto.QueryResult, error) {
 	stc.mu.Lock()
 	defer stc.mu.Unlock()
 
 	qr := new(mproto.QueryResult)
 	allErrors := new(concurrency.AllErrorRecorder)
+	budget := newResultBudget()
 	switch len(shards) {
 	case 0:
 		return qr, nil
@@ -65,8 +81,18 @@ func (stc *ScatterConn) Execute(query string, bindVars map[string]interface{}, k
 		// Fast-path for single shard execution
 		var err error
 		qr, err = stc.execOnShard(query, bindVars, keyspace, shards[0])
+		if err == nil {
+			err = budget.add(qr)
+		}
 		allErrors.RecordError(err)
 	default:
+		plan, err := sqlparser.AnalyzeMerge(query, bindVars)
+		if err != nil {
+			return nil, err
+		}
+		if plan != nil {
+			query = plan.Sql
+		}
 		results := make(chan *mproto.QueryResult, len(shards))
 		var wg sync.WaitGroup
 		for shard := range unique(shards) {
@@ -85,9 +111,30 @@ func (stc *ScatterConn) Execute(query string, bindVars map[string]interface{}, k
 			wg.Wait()
 			close(results)
 		}()
+		var budgetErr error
+		var planResults []*mproto.QueryResult
 		for innerqr := range results {
+			// We still need to finish pumping
+			if budgetErr != nil {
+				continue
+			}
+			if budgetErr = budget.add(innerqr); budgetErr != nil {
+				// free the rows merged so far
+				qr = nil
+				planResults = nil
+				allErrors.RecordError(budgetErr)
+				continue
+			}
+			if plan != nil {
+				planResults = append(planResults, innerqr)
+				continue
+			}
 			appendResult(qr, innerqr)
 		}
+		if plan != nil && !allErrors.HasErrors() {
+			qr, err = mergeResults(plan, planResults)
+			allErrors.RecordError(err)
+		}
 	}
 	if allErrors.HasErrors() {
 		if stc.transactionId != 0 {
@@ -102,7 +149,8 @@ func (stc *ScatterConn) Execute(query string, bindVars map[string]interface{}, k
 	return qr, nil
 }
 
-// Execute executes a non-streaming query on the specified shards.
+// ExecuteBatch executes a group of queries on the specified shards.
+// All their merged results share the same budget as Execute.
 func (stc *ScatterConn) ExecuteBatch(queries []tproto.BoundQuery, keyspace string, shards []string) (qrs *tproto.QueryResultList, err error) {
 	stc.mu.Lock()
 	defer stc.mu.Unlock()
@@ -112,6 +160,7 @@ func (stc *ScatterConn) ExecuteBatch(queries []tproto.BoundQuery, keyspace strin
 	if len(shards) == 0 {
 		return qrs, nil
 	}
+	budget := newResultBudget()
 	results := make(chan *tproto.QueryResultList, len(shards))
 	var wg sync.WaitGroup
 	for shard := range unique(shards) {
@@ -135,8 +184,19 @@ func (stc *ScatterConn) ExecuteBatch(queries []tproto.BoundQuery, keyspace strin
 		wg.Wait()
 		close(results)
 	}()
+	var budgetErr error
 	for innerqr := range results {
+		// We still need to finish pumping
+		if budgetErr != nil {
+			continue
+		}
 		for i := range qrs.List {
+			if budgetErr = budget.add(&innerqr.List[i]); budgetErr != nil {
+				// free the rows merged so far
+				qrs = nil
+				allErrors.RecordError(budgetErr)
+				break
+			}
 			appendResult(&qrs.List[i], &innerqr.List[i])
 		}
 	}
@@ -154,6 +214,11 @@ func (stc *ScatterConn) ExecuteBatch(queries []tproto.BoundQuery, keyspace strin
 }
 
 // StreamExecute executes a streaming query on vttablet. The retry rules are the same.
+// The results are not buffered: each shard waits for the previous
+// chunk to be sent to the client before passing its next one, so a
+// slow client slows down the shards instead of growing vtgate. The
+// results of the selects with an order by, a limit or aggregates are
+// merged row by row, see merge_sort.go.
 func (stc *ScatterConn) StreamExecute(query string, bindVars map[string]interface{}, keyspace string, shards []string, sendReply func(reply interface{}) error) error {
 	stc.mu.Lock()
 	defer stc.mu.Unlock()
@@ -161,23 +226,56 @@ func (stc *ScatterConn) StreamExecute(query string, bindVars map[string]interfac
 	if stc.transactionId != 0 {
 		return fmt.Errorf("cannot stream in a transaction")
 	}
-	results := make(chan *mproto.QueryResult, len(shards))
+	var plan *sqlparser.MergePlan
+	if len(unique(shards)) > 1 {
+		var err error
+		if plan, err = sqlparser.AnalyzeMerge(query, bindVars); err != nil {
+			return err
+		}
+		if plan != nil {
+			query = plan.Sql
+		}
+	}
+	results := make(chan *mproto.QueryResult)
+	var streams []<-chan *mproto.QueryResult
 	allErrors := new(concurrency.AllErrorRecorder)
 	var wg sync.WaitGroup
 	for shard := range unique(shards) {
 		wg.Add(1)
-		go func(shard string) {
+		shardResults := results
+		if plan != nil {
+			// each shard has its own stream to merge
+			shardResults = make(chan *mproto.QueryResult)
+			streams = append(streams, shardResults)
+		}
+		go func(shard string, results chan *mproto.QueryResult) {
 			defer wg.Done()
-			sdc, _ := stc.getConnection(keyspace, shard)
-			sr, errFunc := sdc.StreamExecute(query, bindVars)
-			for qr := range sr {
-				results <- qr
+			if plan != nil {
+				defer close(results)
+			}
+			span, query := trace.StartSqlSpan("vtgate.streamOnShard", query, false)
+			span.Annotate("shard", shard)
+			defer span.Finish()
+			var err error
+			if mode, groupId := stc.readMode(query, keyspace, shard); mode != "" {
+				err = stc.readAfterWriteStream(mode, groupId, query, bindVars, keyspace, shard, results)
+			} else {
+				sdc, _ := stc.getConnection(keyspace, shard)
+				sr, errFunc := sdc.StreamExecute(query, bindVars)
+				for qr := range sr {
+					results <- qr
+				}
+				err = errFunc()
 			}
-			err := errFunc()
 			if err != nil {
 				allErrors.RecordError(err)
 			}
-		}(shard)
+		}(shard, shardResults)
+	}
+	if plan != nil {
+		allErrors.RecordError(streamMerge(plan, streams, sendReply))
+		wg.Wait()
+		return allErrors.Error()
 	}
 	go func() {
 		wg.Wait()
@@ -218,16 +316,23 @@ func (stc *ScatterConn) Commit() (err error) {
 	if stc.transactionId == 0 {
 		return fmt.Errorf("cannot commit: not in transaction")
 	}
-	committing := true
-	for _, tConn := range stc.commitOrder {
-		if !committing {
-			tConn.Rollback()
-			continue
-		}
-		if err = tConn.Commit(); err != nil {
-			committing = false
+	if stc.txManager != nil && len(stc.commitOrder) > 1 {
+		err = stc.txManager.Commit(stc.commitOrder)
+	} else {
+		committing := true
+		for _, tConn := range stc.commitOrder {
+			if !committing {
+				tConn.Rollback()
+				continue
+			}
+			if err = tConn.Commit(); err != nil {
+				committing = false
+			}
 		}
 	}
+	if err == nil {
+		stc.recordWrites()
+	}
 	stc.transactionIds = nil
 	stc.commitOrder = nil
 	stc.transactionId = 0
@@ -278,12 +383,13 @@ func (stc *ScatterConn) getConnection(keyspace, shard string) (*ShardConn, error
 	stc.connsMu.Lock()
 	defer stc.connsMu.Unlock()
 
-	key := fmt.Sprintf("%s.%s.%s", keyspace, stc.tabletType, shard)
-	sdc, ok := stc.shardConns[key]
-	if !ok {
-		sdc = NewShardConn(stc.balancerMap, keyspace, shard, stc.tabletType, stc.retryDelay, stc.retryCount)
-		stc.shardConns[key] = sdc
+	tabletType := stc.tabletType
+	if stc.transactionId != 0 && stc.readAfterWrite != "" {
+		// the writes of the read-after-write sessions go to the masters
+		tabletType = topo.TYPE_MASTER
 	}
+	keyspace, tabletType = stc.balancerMap.route(keyspace, tabletType)
+	sdc := stc.shardConn(keyspace, shard, tabletType)
 	if stc.transactionId != 0 {
 		if txid := sdc.TransactionId(); txid != 0 {
 			if txid != stc.transactionIds[sdc] {
@@ -307,7 +413,27 @@ func (stc *ScatterConn) getConnection(keyspace, shard string) (*ShardConn, error
 	return sdc, nil
 }
 
+// shardConn returns the ShardConn of keyspace/shard for tabletType,
+// creating it if needed. connsMu must be held.
+func (stc *ScatterConn) shardConn(keyspace, shard string, tabletType topo.TabletType) *ShardConn {
+	key := fmt.Sprintf("%s.%s.%s", keyspace, tabletType, shard)
+	sdc, ok := stc.shardConns[key]
+	if !ok {
+		sdc = NewShardConn(stc.balancerMap, keyspace, shard, tabletType, stc.retryDelay, stc.retryCount)
+		stc.shardConns[key] = sdc
+	}
+	return sdc
+}
+
 func (stc *ScatterConn) execOnShard(query string, bindVars map[string]interface{}, keyspace string, shard string) (qr *mproto.QueryResult, err error) {
+	span, query := trace.StartSqlSpan("vtgate.execOnShard", query, false)
+	span.Annotate("shard", shard)
+	defer span.Finish()
+	if stc.transactionId == 0 {
+		if mode, groupId := stc.readMode(query, keyspace, shard); mode != "" {
+			return stc.readAfterWriteExecute(mode, groupId, query, bindVars, keyspace, shard)
+		}
+	}
 	sdc, err := stc.getConnection(keyspace, shard)
 	if err != nil {
 		return nil, err
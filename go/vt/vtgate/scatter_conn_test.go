@@ -6,11 +6,13 @@ package vtgate
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/topo"
 )
 
 // This file uses the sandbox_test framework.
@@ -334,3 +336,72 @@ func TestScatterConnClose(t *testing.T) {
 		t.Errorf("want 1, got %d", sbc.CommitCount)
 	}
 }
+
+func TestScatterConnRoutingRules(t *testing.T) {
+	resetSandbox()
+	sandboxRoutingRules.SetRule(&topo.RoutingRule{FromKeyspace: "ks1", FromTabletType: topo.TYPE_REPLICA, ToKeyspace: "ks2", ToTabletType: topo.TYPE_RDONLY})
+	sandboxRoutingRules.SetRule(&topo.RoutingRule{FromKeyspace: "ks3", ToKeyspace: "ks4"})
+	blm := NewBalancerMap(new(sandboxTopo), "aa")
+
+	testCases := []struct {
+		keyspace     string
+		tabletType   topo.TabletType
+		wantKeyspace string
+		wantType     topo.TabletType
+	}{
+		{"ks1", topo.TYPE_REPLICA, "ks2", topo.TYPE_RDONLY},
+		{"ks1", topo.TYPE_MASTER, "ks1", topo.TYPE_MASTER},
+		{"ks3", topo.TYPE_MASTER, "ks4", topo.TYPE_MASTER},
+		{"ks5", topo.TYPE_REPLICA, "ks5", topo.TYPE_REPLICA},
+	}
+	for _, tc := range testCases {
+		stc := NewScatterConn(blm, tc.tabletType, 1*time.Millisecond, 3)
+		sdc, err := stc.getConnection(tc.keyspace, "0")
+		if err != nil {
+			t.Fatalf("getConnection(%v, %v): %v", tc.keyspace, tc.tabletType, err)
+		}
+		if sdc.keyspace != tc.wantKeyspace || sdc.tabletType != tc.wantType {
+			t.Errorf("getConnection(%v, %v): got %v %v, want %v %v", tc.keyspace, tc.tabletType, sdc.keyspace, sdc.tabletType, tc.wantKeyspace, tc.wantType)
+		}
+		stc.Close()
+	}
+}
+
+func TestScatterConnResultBudget(t *testing.T) {
+	resetSandbox()
+	savedRows, savedBytes := *maxResultRows, *maxResultBytes
+	defer func() { *maxResultRows, *maxResultBytes = savedRows, savedBytes }()
+	for i := 0; i < 3; i++ {
+		testConns[uint32(i)] = &sandboxConn{}
+	}
+	blm := NewBalancerMap(new(sandboxTopo), "aa")
+	stc := NewScatterConn(blm, "", 1*time.Millisecond, 3)
+
+	*maxResultRows = 2
+	if qr, err := stc.Execute("query", nil, "", []string{"0", "1"}); err != nil || len(qr.Rows) != 2 {
+		t.Errorf("Execute within budget: %v %v", qr, err)
+	}
+	if _, err := stc.Execute("query", nil, "", []string{"0", "1", "2"}); err == nil || !strings.Contains(err.Error(), "more than 2 rows") {
+		t.Errorf("want rows budget error, got %v", err)
+	}
+	queries := []tproto.BoundQuery{{"query1", nil}, {"query2", nil}}
+	if _, err := stc.ExecuteBatch(queries, "", []string{"0", "1"}); err == nil || !strings.Contains(err.Error(), "more than 2 rows") {
+		t.Errorf("want rows budget error for the batch, got %v", err)
+	}
+
+	*maxResultRows = 0
+	*maxResultBytes = 1
+	if _, err := stc.Execute("query", nil, "", []string{"0"}); err == nil || !strings.Contains(err.Error(), "more than 1 bytes") {
+		t.Errorf("want bytes budget error, got %v", err)
+	}
+
+	// streaming has no budget
+	count := 0
+	err := stc.StreamExecute("query", nil, "", []string{"0", "1", "2"}, func(r interface{}) error {
+		count += len(r.(*mproto.QueryResult).Rows)
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Errorf("StreamExecute: got %v rows, %v", count, err)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/youtube/vitess/go/cache"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/stats"
+)
+
+/*
+This file contains the cache of the results of the schema queries,
+like SHOW TABLES or the selects from information_schema, that the
+ORMs send a lot. The results are kept for -schema-cache-ttl, and the
+entries of a keyspace are dropped when a DDL goes through vtgate or
+when vtctl applies a schema change (see InvalidateSchemaCache).
+*/
+
+var (
+	schemaCacheTTL  = flag.Duration("schema-cache-ttl", 0, "how long the results of the schema queries (SHOW TABLES, selects from information_schema...) are cached, 0 disables the cache")
+	schemaCacheSize = flag.Int("schema-cache-size", 1000, "maximum number of results in the schema query cache")
+)
+
+// schemaQueryPrefixes are the query shapes that can be cached, once
+// lower-cased and with their spaces collapsed.
+var schemaQueryPrefixes = []string{
+	"show tables",
+	"show full tables",
+	"show table status",
+	"show columns ",
+	"show full columns ",
+	"show fields ",
+	"show full fields ",
+	"show index ",
+	"show indexes ",
+	"show keys ",
+	"show create table ",
+	"show databases",
+	"describe ",
+	"desc ",
+}
+
+// ddlPrefixes are the statements that invalidate the cache of their
+// keyspace.
+var ddlPrefixes = []string{"create ", "alter ", "drop ", "rename ", "truncate "}
+
+type schemaCacheEntry struct {
+	qr     *mproto.QueryResult
+	expire time.Time
+}
+
+func (entry *schemaCacheEntry) Size() int {
+	return 1
+}
+
+// SchemaCache is the cache of the schema query results. A nil
+// SchemaCache caches nothing.
+type SchemaCache struct {
+	ttl     time.Duration
+	results *cache.LRUCache
+	counts  *stats.Counters
+}
+
+// NewSchemaCache creates a SchemaCache of size results, kept for ttl.
+func NewSchemaCache(ttl time.Duration, size int) *SchemaCache {
+	return &SchemaCache{
+		ttl:     ttl,
+		results: cache.NewLRUCache(int64(size)),
+		counts:  stats.NewCounters(""),
+	}
+}
+
+func newSchemaCacheFromFlags() *SchemaCache {
+	if *schemaCacheTTL == 0 {
+		return nil
+	}
+	sc := NewSchemaCache(*schemaCacheTTL, *schemaCacheSize)
+	stats.Publish("SchemaCache", sc.counts)
+	stats.Publish("SchemaCacheLength", stats.IntFunc(sc.results.Length))
+	return sc
+}
+
+// normalizeSchemaQuery lower-cases sql and collapses its spaces.
+func normalizeSchemaQuery(sql string) string {
+	return strings.Join(strings.Fields(strings.ToLower(sql)), " ")
+}
+
+// isSchemaQuery returns true if the normalized query is one of the
+// cacheable read-only shapes.
+func isSchemaQuery(normalized string) bool {
+	for _, prefix := range schemaQueryPrefixes {
+		if strings.HasPrefix(normalized, prefix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(normalized, "select ") && strings.Contains(normalized, " information_schema.")
+}
+
+// isDDL returns true if the normalized query changes the schema.
+func isDDL(normalized string) bool {
+	for _, prefix := range ddlPrefixes {
+		if strings.HasPrefix(normalized, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the cache key of a query, or "" if its result cannot be
+// cached. Queries in transactions are never cached.
+func (sc *SchemaCache) Key(stc *ScatterConn, keyspace string, shards []string, sql string, bindVars map[string]interface{}) string {
+	if sc == nil || stc.TransactionId() != 0 {
+		return ""
+	}
+	normalized := normalizeSchemaQuery(sql)
+	if !isSchemaQuery(normalized) {
+		return ""
+	}
+	sorted := make([]string, len(shards))
+	copy(sorted, shards)
+	sort.Strings(sorted)
+	return fmt.Sprintf("%v/%v/%v/%v/%v", keyspace, stc.tabletType, strings.Join(sorted, ","), normalized, bindVars)
+}
+
+// Get returns the cached result for key, or nil.
+func (sc *SchemaCache) Get(key string) *mproto.QueryResult {
+	if sc == nil || key == "" {
+		return nil
+	}
+	value, ok := sc.results.Get(key)
+	if !ok {
+		sc.counts.Add("Misses", 1)
+		return nil
+	}
+	entry := value.(*schemaCacheEntry)
+	if time.Now().After(entry.expire) {
+		sc.results.Delete(key)
+		sc.counts.Add("Misses", 1)
+		return nil
+	}
+	sc.counts.Add("Hits", 1)
+	return entry.qr
+}
+
+// Set caches the result of the query of key.
+func (sc *SchemaCache) Set(key string, qr *mproto.QueryResult) {
+	if sc == nil || key == "" {
+		return
+	}
+	sc.results.Set(key, &schemaCacheEntry{qr: qr, expire: time.Now().Add(sc.ttl)})
+}
+
+// CheckDDL drops the results of keyspace if sql is a DDL.
+func (sc *SchemaCache) CheckDDL(keyspace, sql string) {
+	if sc == nil || !isDDL(normalizeSchemaQuery(sql)) {
+		return
+	}
+	sc.Invalidate(keyspace)
+}
+
+// Invalidate drops the results of keyspace, or all the results if
+// keyspace is empty.
+func (sc *SchemaCache) Invalidate(keyspace string) {
+	if sc == nil {
+		return
+	}
+	sc.counts.Add("Invalidations", 1)
+	if keyspace == "" {
+		sc.results.Clear()
+		return
+	}
+	for _, key := range sc.results.Keys() {
+		if strings.HasPrefix(key, keyspace+"/") {
+			sc.results.Delete(key)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/rpc"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+// This file uses the sandbox_test framework.
+
+func TestIsSchemaQuery(t *testing.T) {
+	testcases := []struct {
+		sql  string
+		want bool
+	}{
+		{"SHOW TABLES", true},
+		{"show  full\ttables like 'a%'", true},
+		{"show create table user", true},
+		{"DESCRIBE user", true},
+		{"select table_name from INFORMATION_SCHEMA.tables where table_schema = :db", true},
+		{"show processlist", false},
+		{"show slave status", false},
+		{"select * from user", false},
+		{"insert into information_schema.tables values (1)", false},
+	}
+	for _, tcase := range testcases {
+		if got := isSchemaQuery(normalizeSchemaQuery(tcase.sql)); got != tcase.want {
+			t.Errorf("isSchemaQuery(%q): got %v, want %v", tcase.sql, got, tcase.want)
+		}
+	}
+	if !isDDL(normalizeSchemaQuery("ALTER TABLE user ADD COLUMN a int")) || isDDL(normalizeSchemaQuery("select 1")) {
+		t.Errorf("isDDL is wrong")
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	resetSandbox()
+	blm := NewBalancerMap(new(sandboxTopo), "aa")
+	stc := NewScatterConn(blm, "", 1*time.Millisecond, 3)
+	sc := NewSchemaCache(time.Hour, 10)
+
+	if key := sc.Key(stc, "user", []string{"0"}, "select * from user", nil); key != "" {
+		t.Errorf("regular queries should not be cached: %v", key)
+	}
+	key := sc.Key(stc, "user", []string{"1", "0"}, "show tables", nil)
+	if key2 := sc.Key(stc, "user", []string{"0", "1"}, "SHOW  TABLES", nil); key2 != key {
+		t.Errorf("got different keys for the same query: %v and %v", key, key2)
+	}
+	if sc.Get(key) != nil {
+		t.Errorf("empty cache returned a result")
+	}
+	qr := &mproto.QueryResult{RowsAffected: 1}
+	sc.Set(key, qr)
+	if got := sc.Get(key); got != qr {
+		t.Errorf("got %v, want %v", got, qr)
+	}
+
+	otherKey := sc.Key(stc, "lookup", []string{"0"}, "show tables", nil)
+	sc.Set(otherKey, qr)
+	sc.CheckDDL("user", "select 1")
+	if sc.Get(key) == nil {
+		t.Errorf("a select should not invalidate the cache")
+	}
+	sc.CheckDDL("user", "create table a(id int)")
+	if sc.Get(key) != nil {
+		t.Errorf("a DDL should invalidate the cache of its keyspace")
+	}
+	if sc.Get(otherKey) == nil {
+		t.Errorf("a DDL should not invalidate the cache of the other keyspaces")
+	}
+	sc.Invalidate("")
+	if sc.Get(otherKey) != nil {
+		t.Errorf("the cache should be empty")
+	}
+
+	// expired results are not returned
+	sc = NewSchemaCache(time.Nanosecond, 10)
+	sc.Set(key, qr)
+	time.Sleep(time.Millisecond)
+	if sc.Get(key) != nil {
+		t.Errorf("expired results should not be returned")
+	}
+
+	// queries in transactions are not cached
+	stc.Begin()
+	if key := sc.Key(stc, "user", []string{"0"}, "show tables", nil); key != "" {
+		t.Errorf("queries in transactions should not be cached: %v", key)
+	}
+
+	// a nil cache caches nothing
+	var nilCache *SchemaCache
+	nilCache.Set(nilCache.Key(stc, "user", []string{"0"}, "show tables", nil), qr)
+	nilCache.Invalidate("user")
+}
+
+func TestVTGateSchemaCache(t *testing.T) {
+	sess := resetVTGate()
+	RpcVTGate.schemaCache = NewSchemaCache(time.Hour, 10)
+	defer func() { RpcVTGate.schemaCache = nil }()
+	sbc := &sandboxConn{}
+	testConns[0] = sbc
+	q := proto.QueryShard{
+		Sql:       "show tables",
+		SessionId: sess.SessionId,
+		Shards:    []string{"0"},
+	}
+	for i := 0; i < 2; i++ {
+		var qr mproto.QueryResult
+		if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err != nil {
+			t.Fatalf("ExecuteShard failed: %v", err)
+		}
+		if qr.RowsAffected != singleRowResult.RowsAffected {
+			t.Errorf("got %v, want %v", qr, singleRowResult)
+		}
+	}
+	if sbc.ExecCount != 1 {
+		t.Errorf("the second query should have been cached: %v execs", sbc.ExecCount)
+	}
+
+	var noOutput rpc.UnusedResponse
+	RpcVTGate.InvalidateSchemaCache(nil, &proto.SchemaCacheInvalidation{Keyspace: ""}, &noOutput)
+	var qr mproto.QueryResult
+	if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err != nil {
+		t.Fatalf("ExecuteShard failed: %v", err)
+	}
+	if sbc.ExecCount != 2 {
+		t.Errorf("the cache should have been invalidated: %v execs", sbc.ExecCount)
+	}
+}
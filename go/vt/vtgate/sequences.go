@@ -0,0 +1,107 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/sqlparser"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+var sequenceConfigFile = flag.String("sequence-config", "", "json file that maps keyspace and table names to the sequences generating the values of one of their columns")
+
+// SequenceConfig describes the sequence that generates the values
+// of a column, instead of a per-shard auto-increment. The sequence
+// table lives in Shard of the unsharded keyspace Keyspace.
+type SequenceConfig struct {
+	Column   string
+	Keyspace string
+	Shard    string
+	Sequence string
+}
+
+// sequence reserves values from the master of the sequence shard.
+// A ShardConn cannot be used concurrently, hence the mutex.
+type sequence struct {
+	SequenceConfig
+	mu   sync.Mutex
+	conn *ShardConn
+}
+
+func (seq *sequence) getValues(count int64) (int64, error) {
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+	return seq.conn.GetSequenceValues(seq.Sequence, count)
+}
+
+// sequences maps keyspaces to their tables that use a sequence.
+type sequences map[string]map[string]*sequence
+
+// loadSequences reads a json file of the form:
+// {"user": {"user_extra": {"Column": "id", "Keyspace": "lookup", "Shard": "0", "Sequence": "user_extra_seq"}}}
+func loadSequences(file string, blm *BalancerMap, retryDelay time.Duration, retryCount int) (sequences, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var configs map[string]map[string]SequenceConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("cannot parse %v: %v", file, err)
+	}
+	seqs := make(sequences)
+	for keyspace, tables := range configs {
+		seqs[keyspace] = make(map[string]*sequence)
+		for table, config := range tables {
+			if config.Column == "" || config.Keyspace == "" || config.Shard == "" || config.Sequence == "" {
+				return nil, fmt.Errorf("incomplete sequence config for %v.%v: %#v", keyspace, table, config)
+			}
+			seqs[keyspace][table] = &sequence{
+				SequenceConfig: config,
+				conn:           NewShardConn(blm, config.Keyspace, config.Shard, topo.TYPE_MASTER, retryDelay, retryCount),
+			}
+		}
+	}
+	return seqs, nil
+}
+
+// generate fills in the values of the sequence columns that are
+// missing or null in an insert into a table of keyspace. It returns
+// the query to send, its bind variables and the first generated
+// value, or 0 if there was nothing to generate.
+func (seqs sequences) generate(keyspace, sql string, bindVariables map[string]interface{}) (string, map[string]interface{}, int64, error) {
+	tables := seqs[keyspace]
+	if len(tables) == 0 {
+		return sql, bindVariables, 0, nil
+	}
+	columns := make(map[string]string, len(tables))
+	for table, seq := range tables {
+		columns[table] = seq.Column
+	}
+	newSql, table, args, err := sqlparser.RewriteSequenceInsert(sql, bindVariables, columns)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if len(args) == 0 {
+		return sql, bindVariables, 0, nil
+	}
+	first, err := tables[table].getValues(int64(len(args)))
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("cannot generate %v.%v: %v", table, tables[table].Column, err)
+	}
+	newBindVariables := make(map[string]interface{}, len(bindVariables)+len(args))
+	for k, v := range bindVariables {
+		newBindVariables[k] = v
+	}
+	for i, arg := range args {
+		newBindVariables[arg] = first + int64(i)
+	}
+	return newSql, newBindVariables, first, nil
+}
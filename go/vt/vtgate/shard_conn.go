@@ -46,6 +46,7 @@ func NewShardConn(blm *BalancerMap, keyspace, shard string, tabletType topo.Tabl
 // TxPoolFull causes a retry and all other errors are non-retry.
 func (sdc *ShardConn) canRetry(err error) bool {
 	if err == nil {
+		sdc.balancer.MarkSuccess(sdc.endPoint.Uid)
 		return false
 	}
 	if serverError, ok := err.(*ServerError); ok {
@@ -57,7 +58,9 @@ func (sdc *ShardConn) canRetry(err error) bool {
 		case ERR_RETRY, ERR_FATAL:
 			// No-op: treat these errors as operational by breaking out of this switch
 		default:
-			// Should not retry for normal server errors.
+			// Should not retry for normal server errors. The
+			// tablet answered, so it is healthy.
+			sdc.balancer.MarkSuccess(sdc.endPoint.Uid)
 			return false
 		}
 	}
@@ -124,6 +127,35 @@ func (sdc *ShardConn) ExecuteBatch(queries []tproto.BoundQuery) (qrs *tproto.Que
 	return qrs, sdc.WrapError(err)
 }
 
+// GetSequenceValues reserves count values from a sequence. The retry
+// rules are the same as Execute: a retried call may leave a gap in
+// the sequence, but the values are never handed out twice.
+func (sdc *ShardConn) GetSequenceValues(sequence string, count int64) (first int64, err error) {
+	for i := 0; i < sdc.retryCount; i++ {
+		if sdc.conn == nil {
+			var endPoint topo.EndPoint
+			endPoint, err = sdc.balancer.Get()
+			if err != nil {
+				return 0, sdc.WrapError(err)
+			}
+			var conn TabletConn
+			conn, err = GetDialer()(endPoint, sdc.keyspace, sdc.shard)
+			if err != nil {
+				sdc.balancer.MarkDown(endPoint.Uid)
+				continue
+			}
+			sdc.endPoint = endPoint
+			sdc.conn = conn
+		}
+		first, err = sdc.conn.GetSequenceValues(sequence, count)
+		if sdc.canRetry(err) {
+			continue
+		}
+		return first, sdc.WrapError(err)
+	}
+	return first, sdc.WrapError(err)
+}
+
 // StreamExecute executes a streaming query on vttablet. The retry rules are the same as Execute.
 // Calling other functions while streaming is not recommended.
 func (sdc *ShardConn) StreamExecute(query string, bindVars map[string]interface{}) (results <-chan *mproto.QueryResult, errFunc ErrFunc) {
@@ -204,6 +236,96 @@ func (sdc *ShardConn) Rollback() (err error) {
 	return sdc.WrapError(sdc.conn.Rollback())
 }
 
+// Prepare prepares the current transaction as dtid. There are no
+// retries on this operation.
+func (sdc *ShardConn) Prepare(dtid string) (err error) {
+	if sdc.TransactionId() == 0 {
+		return sdc.WrapError(fmt.Errorf("cannot prepare: not in transaction"))
+	}
+	return sdc.WrapError(sdc.conn.Prepare(dtid))
+}
+
+// CommitPrepared commits a prepared transaction. It is idempotent, so
+// the retry rules are the same as Execute.
+func (sdc *ShardConn) CommitPrepared(dtid string) error {
+	return sdc.withRetry(func(conn TabletConn) error {
+		return conn.CommitPrepared(dtid)
+	})
+}
+
+// RollbackPrepared rolls back a prepared transaction, or the
+// transaction originalId if it was not prepared. The retry rules are
+// the same as Execute.
+func (sdc *ShardConn) RollbackPrepared(dtid string, originalId int64) error {
+	return sdc.withRetry(func(conn TabletConn) error {
+		return conn.RollbackPrepared(dtid, originalId)
+	})
+}
+
+// CreateTransaction records the metadata of a distributed
+// transaction. The retry rules are the same as Execute.
+func (sdc *ShardConn) CreateTransaction(dtid string, participants []tproto.DtxParticipant) error {
+	return sdc.withRetry(func(conn TabletConn) error {
+		return conn.CreateTransaction(dtid, participants)
+	})
+}
+
+// SetTransactionState changes the state of a distributed transaction.
+// The retry rules are the same as Execute: a retried call fails if
+// the first one changed the state, so the caller has to read the
+// state back on errors.
+func (sdc *ShardConn) SetTransactionState(dtid string, from, to int64) error {
+	return sdc.withRetry(func(conn TabletConn) error {
+		return conn.SetTransactionState(dtid, from, to)
+	})
+}
+
+// ConcludeTransaction deletes the metadata of a distributed
+// transaction. The retry rules are the same as Execute.
+func (sdc *ShardConn) ConcludeTransaction(dtid string) error {
+	return sdc.withRetry(func(conn TabletConn) error {
+		return conn.ConcludeTransaction(dtid)
+	})
+}
+
+// ReadTransactions reads the metadata of distributed transactions.
+// The retry rules are the same as Execute.
+func (sdc *ShardConn) ReadTransactions(dtid string, abandonAge time.Duration) (dtxs []tproto.DistributedTransaction, err error) {
+	err = sdc.withRetry(func(conn TabletConn) (err error) {
+		dtxs, err = conn.ReadTransactions(dtid, abandonAge)
+		return err
+	})
+	return dtxs, err
+}
+
+// withRetry calls action with a vttablet connection, that it dials if
+// needed. The retry rules are the same as Execute.
+func (sdc *ShardConn) withRetry(action func(conn TabletConn) error) (err error) {
+	for i := 0; i < sdc.retryCount; i++ {
+		if sdc.conn == nil {
+			var endPoint topo.EndPoint
+			endPoint, err = sdc.balancer.Get()
+			if err != nil {
+				return sdc.WrapError(err)
+			}
+			var conn TabletConn
+			conn, err = GetDialer()(endPoint, sdc.keyspace, sdc.shard)
+			if err != nil {
+				sdc.balancer.MarkDown(endPoint.Uid)
+				continue
+			}
+			sdc.endPoint = endPoint
+			sdc.conn = conn
+		}
+		err = action(sdc.conn)
+		if sdc.canRetry(err) {
+			continue
+		}
+		return sdc.WrapError(err)
+	}
+	return sdc.WrapError(err)
+}
+
 func (sdc *ShardConn) TransactionId() int64 {
 	if sdc.conn == nil {
 		return 0
@@ -211,6 +333,14 @@ func (sdc *ShardConn) TransactionId() int64 {
 	return sdc.conn.TransactionId()
 }
 
+// CommitGroupId returns the group id returned by the last commit.
+func (sdc *ShardConn) CommitGroupId() string {
+	if sdc.conn == nil {
+		return ""
+	}
+	return sdc.conn.CommitGroupId()
+}
+
 // Close closes the underlying vttablet connection.
 func (sdc *ShardConn) Close() error {
 	if sdc.conn == nil {
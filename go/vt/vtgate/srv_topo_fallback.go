@@ -0,0 +1,102 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"time"
+
+	log "github.com/golang/glog"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// GlobalFallbackSrvTopoServer is a SrvTopoServer that reads the
+// serving graph of a cell from its copy in the global topology (see
+// topo.SrvKeyspaceMirror) when the topology server of the cell fails,
+// so vtgate can still route queries while it is down. The copy is
+// only as recent as the last keyspace rebuild, so every fallback logs
+// its age.
+type GlobalFallbackSrvTopoServer struct {
+	topo.Server
+	counts *stats.Counters
+}
+
+// NewGlobalFallbackSrvTopoServer creates a GlobalFallbackSrvTopoServer
+// based on the provided topo.Server.
+func NewGlobalFallbackSrvTopoServer(ts topo.Server) *GlobalFallbackSrvTopoServer {
+	return &GlobalFallbackSrvTopoServer{
+		Server: ts,
+		counts: stats.NewCounters("SrvTopoGlobalFallback"),
+	}
+}
+
+// cellDown returns true if err means the topology server of the cell
+// could not be read, as opposed to a missing node.
+func cellDown(err error) bool {
+	return err != nil && err != topo.ErrNoNode
+}
+
+// mirror reads the copy of the serving graph of a keyspace, and warns
+// about its age.
+func (server *GlobalFallbackSrvTopoServer) mirror(cell, keyspace string, cellErr error) (*topo.SrvKeyspaceMirror, error) {
+	mirror, err := server.Server.GetSrvKeyspaceMirror(cell, keyspace)
+	if err != nil {
+		server.counts.Add("Error", 1)
+		log.Errorf("cell %v topology failed (%v), and its copy for keyspace %v cannot be read: %v", cell, cellErr, keyspace, err)
+		return nil, cellErr
+	}
+	server.counts.Add(cell, 1)
+	age := time.Now().Sub(time.Unix(mirror.RebuildTime, 0))
+	log.Warningf("cell %v topology failed (%v), using the copy of keyspace %v from the global topology, rebuilt %v ago: it may be stale", cell, cellErr, keyspace, age)
+	return mirror, nil
+}
+
+func (server *GlobalFallbackSrvTopoServer) GetSrvKeyspaceNames(cell string) ([]string, error) {
+	names, err := server.Server.GetSrvKeyspaceNames(cell)
+	if !cellDown(err) {
+		return names, err
+	}
+	names, merr := server.Server.GetSrvKeyspaceMirrorNames(cell)
+	if merr != nil {
+		server.counts.Add("Error", 1)
+		log.Errorf("cell %v topology failed (%v), and its copy cannot be read: %v", cell, err, merr)
+		return nil, err
+	}
+	server.counts.Add(cell, 1)
+	log.Warningf("cell %v topology failed (%v), using the keyspace names of its copy in the global topology", cell, err)
+	return names, nil
+}
+
+func (server *GlobalFallbackSrvTopoServer) GetSrvKeyspace(cell, keyspace string) (*topo.SrvKeyspace, error) {
+	srvKeyspace, err := server.Server.GetSrvKeyspace(cell, keyspace)
+	if !cellDown(err) {
+		return srvKeyspace, err
+	}
+	mirror, err := server.mirror(cell, keyspace, err)
+	if err != nil {
+		return nil, err
+	}
+	if mirror.SrvKeyspace == nil {
+		return nil, topo.ErrNoNode
+	}
+	return mirror.SrvKeyspace, nil
+}
+
+func (server *GlobalFallbackSrvTopoServer) GetEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) (*topo.EndPoints, error) {
+	addrs, err := server.Server.GetEndPoints(cell, keyspace, shard, tabletType)
+	if !cellDown(err) {
+		return addrs, err
+	}
+	mirror, err := server.mirror(cell, keyspace, err)
+	if err != nil {
+		return nil, err
+	}
+	addrs, ok := mirror.EndPoints[shard][tabletType]
+	if !ok {
+		return nil, topo.ErrNoNode
+	}
+	return addrs, nil
+}
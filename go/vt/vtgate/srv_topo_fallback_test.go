@@ -0,0 +1,81 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// downCellTopo is a topo.Server whose cell topology is down, with a
+// copy of keyspace "ks" in the global topology.
+type downCellTopo struct {
+	topo.Server
+}
+
+var errCellDown = fmt.Errorf("cell down")
+
+func (dct *downCellTopo) GetSrvKeyspaceNames(cell string) ([]string, error) {
+	return nil, errCellDown
+}
+
+func (dct *downCellTopo) GetSrvKeyspace(cell, keyspace string) (*topo.SrvKeyspace, error) {
+	return nil, errCellDown
+}
+
+func (dct *downCellTopo) GetEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) (*topo.EndPoints, error) {
+	if keyspace == "missing" {
+		return nil, topo.ErrNoNode
+	}
+	return nil, errCellDown
+}
+
+func (dct *downCellTopo) GetSrvKeyspaceMirrorNames(cell string) ([]string, error) {
+	return []string{"ks"}, nil
+}
+
+func (dct *downCellTopo) GetSrvKeyspaceMirror(cell, keyspace string) (*topo.SrvKeyspaceMirror, error) {
+	if keyspace != "ks" {
+		return nil, topo.ErrNoNode
+	}
+	return &topo.SrvKeyspaceMirror{
+		SrvKeyspace: &topo.SrvKeyspace{TabletTypes: []topo.TabletType{topo.TYPE_MASTER}},
+		EndPoints: map[string]map[topo.TabletType]*topo.EndPoints{
+			"0": map[topo.TabletType]*topo.EndPoints{
+				topo.TYPE_MASTER: &topo.EndPoints{Entries: []topo.EndPoint{topo.EndPoint{Uid: 1, Host: "host1"}}},
+			},
+		},
+		RebuildTime: time.Now().Unix(),
+	}, nil
+}
+
+func TestGlobalFallbackSrvTopoServer(t *testing.T) {
+	server := NewGlobalFallbackSrvTopoServer(&downCellTopo{})
+
+	if names, err := server.GetSrvKeyspaceNames("cell1"); err != nil || len(names) != 1 || names[0] != "ks" {
+		t.Errorf("GetSrvKeyspaceNames: %v %v", names, err)
+	}
+	if srvKeyspace, err := server.GetSrvKeyspace("cell1", "ks"); err != nil || len(srvKeyspace.TabletTypes) != 1 {
+		t.Errorf("GetSrvKeyspace: %v %v", srvKeyspace, err)
+	}
+	if addrs, err := server.GetEndPoints("cell1", "ks", "0", topo.TYPE_MASTER); err != nil || len(addrs.Entries) != 1 || addrs.Entries[0].Host != "host1" {
+		t.Errorf("GetEndPoints: %v %v", addrs, err)
+	}
+	if _, err := server.GetEndPoints("cell1", "ks", "0", topo.TYPE_REPLICA); err != topo.ErrNoNode {
+		t.Errorf("GetEndPoints of a type missing from the copy: %v", err)
+	}
+
+	// the cell error is returned if there is no copy, and missing
+	// nodes don't fall back
+	if _, err := server.GetSrvKeyspace("cell1", "other"); err != errCellDown {
+		t.Errorf("GetSrvKeyspace without copy: %v", err)
+	}
+	if _, err := server.GetEndPoints("cell1", "missing", "0", topo.TYPE_MASTER); err != topo.ErrNoNode {
+		t.Errorf("GetEndPoints of a missing node: %v", err)
+	}
+}
@@ -33,6 +33,20 @@ type SrvTopoServer interface {
 	GetSrvKeyspace(cell, keyspace string) (*topo.SrvKeyspace, error)
 
 	GetEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) (*topo.EndPoints, error)
+
+	// GetCellsAliases is used to find the cells to fall back to
+	// when a cell has no endpoints. It is read from the global
+	// topology.
+	GetCellsAliases() (map[string]*topo.CellsAlias, error)
+
+	// GetVSchema is not part of the serving graph, but is read
+	// from the global topology the same way.
+	GetVSchema(keyspace string) (*topo.VSchema, error)
+
+	// GetRoutingRules returns the rules that redirect the queries
+	// of a keyspace and tablet type. They are read from the
+	// global topology.
+	GetRoutingRules() (*topo.RoutingRules, error)
 }
 
 // ResilientSrvTopoServer is an implementation of SrvTopoServer based
@@ -49,6 +63,9 @@ type ResilientSrvTopoServer struct {
 	srvKeyspaceNamesCache map[string]*srvKeyspaceNamesEntry
 	srvKeyspaceCache      map[string]*srvKeyspaceEntry
 	endPointsCache        map[string]*endPointsEntry
+	vschemaCache          map[string]*vschemaEntry
+	cellsAliasesEntry     cellsAliasesEntry
+	routingRulesEntry     routingRulesEntry
 }
 
 type srvKeyspaceNamesEntry struct {
@@ -75,6 +92,30 @@ type endPointsEntry struct {
 	value         *topo.EndPoints
 }
 
+type vschemaEntry struct {
+	// the mutex protects any access to this structure (read or write)
+	mutex sync.Mutex
+
+	insertionTime time.Time
+	value         *topo.VSchema
+}
+
+type cellsAliasesEntry struct {
+	// the mutex protects any access to this structure (read or write)
+	mutex sync.Mutex
+
+	insertionTime time.Time
+	value         map[string]*topo.CellsAlias
+}
+
+type routingRulesEntry struct {
+	// the mutex protects any access to this structure (read or write)
+	mutex sync.Mutex
+
+	insertionTime time.Time
+	value         *topo.RoutingRules
+}
+
 // NewResilientSrvTopoServer creates a new ResilientSrvTopoServer
 // based on the provided SrvTopoServer.
 func NewResilientSrvTopoServer(base SrvTopoServer) *ResilientSrvTopoServer {
@@ -85,6 +126,7 @@ func NewResilientSrvTopoServer(base SrvTopoServer) *ResilientSrvTopoServer {
 		srvKeyspaceNamesCache: make(map[string]*srvKeyspaceNamesEntry),
 		srvKeyspaceCache:      make(map[string]*srvKeyspaceEntry),
 		endPointsCache:        make(map[string]*endPointsEntry),
+		vschemaCache:          make(map[string]*vschemaEntry),
 	}
 }
 
@@ -219,3 +261,119 @@ func (server *ResilientSrvTopoServer) GetEndPoints(cell, keyspace, shard string,
 	entry.value = result
 	return result, nil
 }
+
+func (server *ResilientSrvTopoServer) GetVSchema(keyspace string) (*topo.VSchema, error) {
+	server.counts.Add(queryCategory, 1)
+
+	// find the entry in the cache, add it if not there
+	key := keyspace
+	server.mutex.Lock()
+	entry, ok := server.vschemaCache[key]
+	if !ok {
+		entry = &vschemaEntry{}
+		server.vschemaCache[key] = entry
+	}
+	server.mutex.Unlock()
+
+	// Lock the entry, and do everything holding the lock.  This
+	// means two concurrent requests will only issue one
+	// underlying query.
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	// If the entry is fresh enough, return it
+	if time.Now().Sub(entry.insertionTime) < *srvTopoCacheTTL {
+		return entry.value, nil
+	}
+
+	// not in cache or too old, get the real value. A keyspace
+	// with no vschema is cached as a nil value.
+	result, err := server.topoServer.GetVSchema(keyspace)
+	if err == topo.ErrNoNode {
+		result, err = nil, nil
+	}
+	if err != nil {
+		if entry.insertionTime.IsZero() {
+			server.counts.Add(errorCategory, 1)
+			log.Errorf("GetVSchema(%v) failed: %v (no cached value, returning error)", keyspace, err)
+			return nil, err
+		} else {
+			server.counts.Add(cachedCategory, 1)
+			log.Warningf("GetVSchema(%v) failed: %v (returning cached value)", keyspace, err)
+			return entry.value, nil
+		}
+	}
+
+	// save the value we got and the current time in the cache
+	entry.insertionTime = time.Now()
+	entry.value = result
+	return result, nil
+}
+
+func (server *ResilientSrvTopoServer) GetCellsAliases() (map[string]*topo.CellsAlias, error) {
+	server.counts.Add(queryCategory, 1)
+
+	// there is only one entry, lock it and do everything holding
+	// the lock.
+	entry := &server.cellsAliasesEntry
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	// If the entry is fresh enough, return it
+	if time.Now().Sub(entry.insertionTime) < *srvTopoCacheTTL {
+		return entry.value, nil
+	}
+
+	// not in cache or too old, get the real value
+	result, err := server.topoServer.GetCellsAliases()
+	if err != nil {
+		if entry.insertionTime.IsZero() {
+			server.counts.Add(errorCategory, 1)
+			log.Errorf("GetCellsAliases failed: %v (no cached value, returning error)", err)
+			return nil, err
+		} else {
+			server.counts.Add(cachedCategory, 1)
+			log.Warningf("GetCellsAliases failed: %v (returning cached value)", err)
+			return entry.value, nil
+		}
+	}
+
+	// save the value we got and the current time in the cache
+	entry.insertionTime = time.Now()
+	entry.value = result
+	return result, nil
+}
+
+func (server *ResilientSrvTopoServer) GetRoutingRules() (*topo.RoutingRules, error) {
+	server.counts.Add(queryCategory, 1)
+
+	// there is only one entry, lock it and do everything holding
+	// the lock.
+	entry := &server.routingRulesEntry
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	// If the entry is fresh enough, return it
+	if time.Now().Sub(entry.insertionTime) < *srvTopoCacheTTL {
+		return entry.value, nil
+	}
+
+	// not in cache or too old, get the real value
+	result, err := server.topoServer.GetRoutingRules()
+	if err != nil {
+		if entry.insertionTime.IsZero() {
+			server.counts.Add(errorCategory, 1)
+			log.Errorf("GetRoutingRules failed: %v (no cached value, returning error)", err)
+			return nil, err
+		} else {
+			server.counts.Add(cachedCategory, 1)
+			log.Warningf("GetRoutingRules failed: %v (returning cached value)", err)
+			return entry.value, nil
+		}
+	}
+
+	// save the value we got and the current time in the cache
+	entry.insertionTime = time.Now()
+	entry.value = result
+	return result, nil
+}
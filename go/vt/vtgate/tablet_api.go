@@ -6,6 +6,7 @@ package vtgate
 
 import (
 	"flag"
+	"time"
 
 	log "github.com/golang/glog"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
@@ -58,12 +59,37 @@ type TabletConn interface {
 	// be called after finishing the iteration over the channel to see if there were other errors.
 	StreamExecute(query string, bindVars map[string]interface{}) (<-chan *mproto.QueryResult, ErrFunc)
 
+	// GetSequenceValues reserves count consecutive values from a sequence
+	// table, and returns the first one.
+	GetSequenceValues(sequence string, count int64) (int64, error)
+
 	// Transaction support
 	Begin() error
 	Commit() error
 	Rollback() error
 	// TransactionId returns 0 if there is no transaction.
 	TransactionId() int64
+	// CommitGroupId returns the replication group id returned by
+	// the last Commit or CommitPrepared, or "" if vttablet does
+	// not report them.
+	CommitGroupId() string
+
+	// Two-phase commit support. Prepare ends the current
+	// transaction like Commit, but keeps it prepared on vttablet
+	// until CommitPrepared or RollbackPrepared. RollbackPrepared
+	// rolls back the transaction originalId instead if it was
+	// not prepared.
+	Prepare(dtid string) error
+	CommitPrepared(dtid string) error
+	RollbackPrepared(dtid string, originalId int64) error
+
+	// Transaction metadata support, see dtx.go.
+	CreateTransaction(dtid string, participants []tproto.DtxParticipant) error
+	SetTransactionState(dtid string, from, to int64) error
+	ConcludeTransaction(dtid string) error
+	// ReadTransactions returns the transaction dtid, or the
+	// transactions older than abandonAge if dtid is empty.
+	ReadTransactions(dtid string, abandonAge time.Duration) ([]tproto.DistributedTransaction, error)
 
 	// Close must be called for releasing resources.
 	Close() error
@@ -9,6 +9,7 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+	"time"
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/rpcplus"
@@ -16,12 +17,17 @@ import (
 	"github.com/youtube/vitess/go/vt/rpc"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vttls"
 )
 
 var (
 	tabletBsonUsername  = flag.String("tablet-bson-username", "", "user to use for bson rpc connections")
 	tabletBsonPassword  = flag.String("tablet-bson-password", "", "password to use for bson rpc connections (ignored if username is empty)")
 	tabletBsonEncrypted = flag.Bool("tablet-bson-encrypted", false, "use encryption to talk to vttablet")
+	tabletBsonCert      = flag.String("tablet-bson-cert", "", "client certificate to present to vttablet, with -tablet-bson-encrypted")
+	tabletBsonKey       = flag.String("tablet-bson-key", "", "client key for -tablet-bson-cert")
+	tabletBsonCaCert    = flag.String("tablet-bson-ca-cert", "", "CA to verify the vttablet certificates with, with -tablet-bson-encrypted (if empty, they are not verified)")
+	tabletBsonPort      = flag.String("tablet-bson-port", "vt", "name of the vttablet port to connect to, see the vttablet -named-ports flag (vts with -tablet-bson-encrypted)")
 )
 
 func init() {
@@ -29,18 +35,23 @@ func init() {
 }
 
 func DialTablet(endPoint topo.EndPoint, keyspace, shard string) (TabletConn, error) {
-	var addr string
+	portName := *tabletBsonPort
 	var config *tls.Config
 	if *tabletBsonEncrypted {
-		addr = fmt.Sprintf("%v:%v", endPoint.Host, endPoint.NamedPortMap["_vts"])
-		config = &tls.Config{}
-		config.InsecureSkipVerify = true
-	} else {
-		addr = fmt.Sprintf("%v:%v", endPoint.Host, endPoint.NamedPortMap["_vtocc"])
+		if portName == "vt" {
+			portName = "vts"
+		}
+		var err error
+		if config, err = vttls.ClientConfig(*tabletBsonCert, *tabletBsonKey, *tabletBsonCaCert, ""); err != nil {
+			return nil, tabletError(err)
+		}
+	}
+	addr, err := endPoint.Addr(topo.EndPointPortName(portName))
+	if err != nil {
+		return nil, tabletError(err)
 	}
 
 	conn := new(TabletBson)
-	var err error
 	if *tabletBsonUsername != "" {
 		conn.rpcClient, err = bsonrpc.DialAuthHTTP("tcp", addr, *tabletBsonUsername, *tabletBsonPassword, 0, config)
 	} else {
@@ -60,8 +71,9 @@ func DialTablet(endPoint topo.EndPoint, keyspace, shard string) (TabletConn, err
 
 // TabletBson implements a bson rpcplus implementation for TabletConn
 type TabletBson struct {
-	rpcClient *rpcplus.Client
-	session   tproto.Session
+	rpcClient     *rpcplus.Client
+	session       tproto.Session
+	commitGroupId string
 }
 
 func (conn *TabletBson) Execute(query string, bindVars map[string]interface{}) (*mproto.QueryResult, error) {
@@ -103,6 +115,19 @@ func (conn *TabletBson) StreamExecute(query string, bindVars map[string]interfac
 	return sr, func() error { return tabletError(c.Error) }
 }
 
+func (conn *TabletBson) GetSequenceValues(sequence string, count int64) (int64, error) {
+	req := &tproto.SequenceRequest{
+		Sequence:  sequence,
+		Count:     count,
+		SessionId: conn.session.SessionId,
+	}
+	var values tproto.SequenceValues
+	if err := conn.rpcClient.Call("SqlQuery.GetSequenceValues", req, &values); err != nil {
+		return 0, tabletError(err)
+	}
+	return values.First, nil
+}
+
 func (conn *TabletBson) Begin() error {
 	var txInfo tproto.TransactionInfo
 	err := conn.rpcClient.Call("SqlQuery.Begin", &conn.session, &txInfo)
@@ -114,8 +139,12 @@ func (conn *TabletBson) Begin() error {
 
 func (conn *TabletBson) Commit() error {
 	defer func() { conn.session.TransactionId = 0 }()
-	var noOutput rpc.UnusedResponse
-	return tabletError(conn.rpcClient.Call("SqlQuery.Commit", &conn.session, &noOutput))
+	var groupId string
+	err := conn.rpcClient.Call("SqlQuery.Commit", &conn.session, &groupId)
+	if err == nil {
+		conn.commitGroupId = groupId
+	}
+	return tabletError(err)
 }
 
 func (conn *TabletBson) Rollback() error {
@@ -124,10 +153,74 @@ func (conn *TabletBson) Rollback() error {
 	return tabletError(conn.rpcClient.Call("SqlQuery.Rollback", &conn.session, &noOutput))
 }
 
+func (conn *TabletBson) Prepare(dtid string) error {
+	req := &tproto.PreparedTransaction{
+		Dtid:          dtid,
+		TransactionId: conn.session.TransactionId,
+		SessionId:     conn.session.SessionId,
+	}
+	// Like Commit, no more statements can be sent in the
+	// transaction, even if Prepare fails.
+	defer func() { conn.session.TransactionId = 0 }()
+	var noOutput rpc.UnusedResponse
+	return tabletError(conn.rpcClient.Call("SqlQuery.Prepare", req, &noOutput))
+}
+
+func (conn *TabletBson) CommitPrepared(dtid string) error {
+	req := &tproto.PreparedTransaction{Dtid: dtid, SessionId: conn.session.SessionId}
+	var groupId string
+	err := conn.rpcClient.Call("SqlQuery.CommitPrepared", req, &groupId)
+	if err == nil {
+		conn.commitGroupId = groupId
+	}
+	return tabletError(err)
+}
+
+func (conn *TabletBson) RollbackPrepared(dtid string, originalId int64) error {
+	req := &tproto.PreparedTransaction{Dtid: dtid, TransactionId: originalId, SessionId: conn.session.SessionId}
+	var noOutput rpc.UnusedResponse
+	return tabletError(conn.rpcClient.Call("SqlQuery.RollbackPrepared", req, &noOutput))
+}
+
+func (conn *TabletBson) CreateTransaction(dtid string, participants []tproto.DtxParticipant) error {
+	req := &tproto.DistributedTransaction{
+		Dtid:         dtid,
+		Participants: participants,
+		SessionId:    conn.session.SessionId,
+	}
+	var noOutput rpc.UnusedResponse
+	return tabletError(conn.rpcClient.Call("SqlQuery.CreateTransaction", req, &noOutput))
+}
+
+func (conn *TabletBson) SetTransactionState(dtid string, from, to int64) error {
+	req := &tproto.DtxStateChange{Dtid: dtid, From: from, To: to, SessionId: conn.session.SessionId}
+	var noOutput rpc.UnusedResponse
+	return tabletError(conn.rpcClient.Call("SqlQuery.SetTransactionState", req, &noOutput))
+}
+
+func (conn *TabletBson) ConcludeTransaction(dtid string) error {
+	req := &tproto.PreparedTransaction{Dtid: dtid, SessionId: conn.session.SessionId}
+	var noOutput rpc.UnusedResponse
+	return tabletError(conn.rpcClient.Call("SqlQuery.ConcludeTransaction", req, &noOutput))
+}
+
+func (conn *TabletBson) ReadTransactions(dtid string, abandonAge time.Duration) ([]tproto.DistributedTransaction, error) {
+	req := &tproto.DtxQuery{Dtid: dtid, AbandonAge: int64(abandonAge), SessionId: conn.session.SessionId}
+	var reply tproto.DistributedTransactionList
+	if err := conn.rpcClient.Call("SqlQuery.ReadTransactions", req, &reply); err != nil {
+		return nil, tabletError(err)
+	}
+	return reply.List, nil
+}
+
 func (conn *TabletBson) TransactionId() int64 {
 	return conn.session.TransactionId
 }
 
+func (conn *TabletBson) CommitGroupId() string {
+	return conn.commitGroupId
+}
+
 func (conn *TabletBson) Close() error {
 	conn.session = tproto.Session{TransactionId: 0, SessionId: 0}
 	rpcClient := conn.rpcClient
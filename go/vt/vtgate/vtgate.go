@@ -8,19 +8,28 @@ package vtgate
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	log "github.com/golang/glog"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/pools"
 	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+	"github.com/youtube/vitess/go/trace"
 	"github.com/youtube/vitess/go/vt/rpc"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
 )
 
 var RpcVTGate *VTGate
 
+// RecentErrors keeps the last errors returned to the clients, for
+// the status page.
+var RecentErrors = servenv.NewErrorLog(20)
+
 // VTGate is the rpc interface to vtgate. Only one instance
 // can be created.
 type VTGate struct {
@@ -28,6 +37,10 @@ type VTGate struct {
 	connections *pools.Numbered
 	retryDelay  time.Duration
 	retryCount  int
+	sequences   sequences
+	txManager   *TransactionManager
+	schemaCache *SchemaCache
+	limits      *RequestLimits
 }
 
 func Init(blm *BalancerMap, retryDelay time.Duration, retryCount int) {
@@ -40,13 +53,42 @@ func Init(blm *BalancerMap, retryDelay time.Duration, retryCount int) {
 		retryDelay:  retryDelay,
 		retryCount:  retryCount,
 	}
+	if *sequenceConfigFile != "" {
+		seqs, err := loadSequences(*sequenceConfigFile, blm, retryDelay, retryCount)
+		if err != nil {
+			log.Fatalf("cannot load sequences: %v", err)
+		}
+		RpcVTGate.sequences = seqs
+	}
+	RpcVTGate.txManager = newTransactionManagerFromFlags(blm, retryDelay, retryCount)
+	RpcVTGate.schemaCache = newSchemaCacheFromFlags()
+	RpcVTGate.limits = newRequestLimitsFromFlags(blm)
 	proto.RegisterAuthenticated(RpcVTGate)
+	http.HandleFunc("/debug/health", healthCheck)
+}
+
+// healthCheck fails during the lameduck period of vtgate, so the load
+// balancers stop sending it new clients.
+func healthCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	if servenv.IsLameduck() {
+		w.Write([]byte("notok"))
+		return
+	}
+	w.Write([]byte("ok"))
 }
 
 // GetSessionId is the first request sent by the client to begin a session. The returned
 // id should be used for all subsequent communications.
 func (vtg *VTGate) GetSessionId(sessionParams *proto.SessionParams, session *proto.Session) error {
+	if err := checkReadAfterWrite(sessionParams.ReadAfterWrite); err != nil {
+		return err
+	}
 	scatterConn := NewScatterConn(vtg.balancerMap, sessionParams.TabletType, vtg.retryDelay, vtg.retryCount)
+	scatterConn.txManager = vtg.txManager
+	if sessionParams.ReadAfterWrite != RAW_NONE {
+		scatterConn.readAfterWrite = sessionParams.ReadAfterWrite
+	}
 	session.SessionId = scatterConn.Id
 	vtg.connections.Register(scatterConn.Id, scatterConn)
 	return nil
@@ -54,46 +96,210 @@ func (vtg *VTGate) GetSessionId(sessionParams *proto.SessionParams, session *pro
 
 // ExecuteShard executes a non-streaming query on the specified shards.
 func (vtg *VTGate) ExecuteShard(context *rpcproto.Context, query *proto.QueryShard, reply *mproto.QueryResult) error {
+	release, err := vtg.limits.Acquire(query.Keyspace)
+	if err != nil {
+		return fmt.Errorf("query: %s, session %d: %v", sqlparser.Sanitize(query.Sql), query.SessionId, err)
+	}
+	defer release()
 	scatterConn, err := vtg.connections.Get(query.SessionId, "for query")
 	if err != nil {
-		return fmt.Errorf("query: %s, session %d: %v", query.Sql, query.SessionId, err)
+		return fmt.Errorf("query: %s, session %d: %v", sqlparser.Sanitize(query.Sql), query.SessionId, err)
 	}
 	defer vtg.connections.Put(query.SessionId)
-	qr, err := scatterConn.(*ScatterConn).Execute(query.Sql, query.BindVariables, query.Keyspace, query.Shards)
+	logStats := newQueryLogStats("ExecuteShard", context, query.Sql, query.BindVariables, query.Keyspace, query.Shards)
+	sql, bindVars := normalize(query.Sql, query.BindVariables)
+	sql, bindVars, firstGenerated, err := vtg.sequences.generate(query.Keyspace, sql, bindVars)
+	if err != nil {
+		logStats.Send(err)
+		return fmt.Errorf("query: %s: %v", sqlparser.Sanitize(query.Sql), err)
+	}
+	span, sql := trace.StartSqlSpan("vtgate.ExecuteShard", sql, true)
+	span.Annotate("keyspace", query.Keyspace)
+	defer span.Finish()
+	stc := scatterConn.(*ScatterConn)
+	cacheKey := vtg.schemaCache.Key(stc, query.Keyspace, query.Shards, query.Sql, query.BindVariables)
+	qr := vtg.schemaCache.Get(cacheKey)
+	if qr == nil {
+		err = vtg.withLookups(stc, query.Keyspace, query.Shards, []tproto.BoundQuery{{Sql: sql, BindVariables: bindVars}}, func() (err error) {
+			qr, err = stc.Execute(sql, bindVars, query.Keyspace, query.Shards)
+			return err
+		})
+		if err == nil {
+			vtg.schemaCache.Set(cacheKey, qr)
+			vtg.schemaCache.CheckDDL(query.Keyspace, query.Sql)
+		}
+	}
+	if err == nil {
+		logStats.RowsAffected = int(qr.RowsAffected)
+	}
+	logStats.Send(err)
 	if err == nil {
 		*reply = *qr
+		if firstGenerated != 0 {
+			reply.InsertId = uint64(firstGenerated)
+		}
 	} else {
-		log.Errorf("ExecuteShard: %v, query: %#v", err, query)
+		log.Errorf("ExecuteShard: %v, query: %#v", err, sanitizeQueryShard(query))
+		RecentErrors.Record(fmt.Errorf("ExecuteShard: %v", err))
 	}
 	return err
 }
 
 // ExecuteBatchShard executes a group of queries on the specified shards.
 func (vtg *VTGate) ExecuteBatchShard(context *rpcproto.Context, batchQuery *proto.BatchQueryShard, reply *tproto.QueryResultList) error {
+	release, err := vtg.limits.Acquire(batchQuery.Keyspace)
+	if err != nil {
+		return fmt.Errorf("query: %v, session %d: %v", sanitizeBatchQueryShard(batchQuery).Queries, batchQuery.SessionId, err)
+	}
+	defer release()
 	scatterConn, err := vtg.connections.Get(batchQuery.SessionId, "for batch query")
 	if err != nil {
-		return fmt.Errorf("query: %v, session %d: %v", batchQuery.Queries, batchQuery.SessionId, err)
+		return fmt.Errorf("query: %v, session %d: %v", sanitizeBatchQueryShard(batchQuery).Queries, batchQuery.SessionId, err)
 	}
 	defer vtg.connections.Put(batchQuery.SessionId)
-	qrs, err := scatterConn.(*ScatterConn).ExecuteBatch(batchQuery.Queries, batchQuery.Keyspace, batchQuery.Shards)
+	queries := batchQuery.Queries
+	sqls := make([]string, len(queries))
+	bindVarCount := 0
+	for i, q := range queries {
+		sqls[i] = q.Sql
+		bindVarCount += len(q.BindVariables)
+	}
+	logStats := newQueryLogStats("ExecuteBatchShard", context, strings.Join(sqls, "; "), nil, batchQuery.Keyspace, batchQuery.Shards)
+	logStats.BindVarCount = bindVarCount
+	queries = make([]tproto.BoundQuery, len(batchQuery.Queries))
+	firstGenerated := make([]int64, len(queries))
+	for i, q := range batchQuery.Queries {
+		sql, bindVars := normalize(q.Sql, q.BindVariables)
+		sql, bindVars, first, err := vtg.sequences.generate(batchQuery.Keyspace, sql, bindVars)
+		if err != nil {
+			logStats.Send(err)
+			return fmt.Errorf("query: %s: %v", sqlparser.Sanitize(q.Sql), err)
+		}
+		queries[i] = tproto.BoundQuery{Sql: sql, BindVariables: bindVars}
+		firstGenerated[i] = first
+	}
+	if len(queries) > 0 && trace.Enabled() {
+		// the whole batch is one span, in the trace of the first query
+		span, _ := trace.StartSqlSpan("vtgate.ExecuteBatchShard", queries[0].Sql, true)
+		if span != nil {
+			span.Annotate("keyspace", batchQuery.Keyspace)
+			span.Annotate("queries", len(queries))
+			defer span.Finish()
+			traced := make([]tproto.BoundQuery, len(queries))
+			for i, q := range queries {
+				traced[i] = tproto.BoundQuery{Sql: trace.ReplaceComment(q.Sql, span.Context), BindVariables: q.BindVariables}
+			}
+			queries = traced
+		}
+	}
+	stc := scatterConn.(*ScatterConn)
+	var qrs *tproto.QueryResultList
+	err = vtg.withLookups(stc, batchQuery.Keyspace, batchQuery.Shards, queries, func() (err error) {
+		qrs, err = stc.ExecuteBatch(queries, batchQuery.Keyspace, batchQuery.Shards)
+		return err
+	})
+	if err == nil {
+		for _, q := range batchQuery.Queries {
+			vtg.schemaCache.CheckDDL(batchQuery.Keyspace, q.Sql)
+		}
+		for i, qr := range qrs.List {
+			logStats.RowsAffected += int(qr.RowsAffected)
+			if firstGenerated[i] != 0 {
+				qrs.List[i].InsertId = uint64(firstGenerated[i])
+			}
+		}
+	}
+	logStats.Send(err)
 	if err == nil {
 		*reply = *qrs
 	} else {
-		log.Errorf("ExecuteBatchShard: %v, queries: %#v", err, batchQuery)
+		log.Errorf("ExecuteBatchShard: %v, queries: %#v", err, sanitizeBatchQueryShard(batchQuery))
+		RecentErrors.Record(fmt.Errorf("ExecuteBatchShard: %v", err))
+	}
+	return err
+}
+
+// ExecuteLookup executes a non-streaming query on the shards found
+// through the lookup table of a column.
+func (vtg *VTGate) ExecuteLookup(context *rpcproto.Context, query *proto.QueryLookup, reply *mproto.QueryResult) error {
+	release, err := vtg.limits.Acquire(query.Keyspace)
+	if err != nil {
+		return fmt.Errorf("query: %s, session %d: %v", sqlparser.Sanitize(query.Sql), query.SessionId, err)
+	}
+	defer release()
+	scatterConn, err := vtg.connections.Get(query.SessionId, "for lookup query")
+	if err != nil {
+		return fmt.Errorf("query: %s, session %d: %v", sqlparser.Sanitize(query.Sql), query.SessionId, err)
+	}
+	defer vtg.connections.Put(query.SessionId)
+	logStats := newQueryLogStats("ExecuteLookup", context, query.Sql, query.BindVariables, query.Keyspace, nil)
+	stc := scatterConn.(*ScatterConn)
+	_, shards, err := vtg.routeLookup(stc, query)
+	if err != nil {
+		logStats.Send(err)
+		return fmt.Errorf("query: %s: %v", sqlparser.Sanitize(query.Sql), err)
+	}
+	logStats.Shards = shards
+	sql, bindVars := normalize(query.Sql, query.BindVariables)
+	sql, bindVars, firstGenerated, err := vtg.sequences.generate(query.Keyspace, sql, bindVars)
+	if err != nil {
+		logStats.Send(err)
+		return fmt.Errorf("query: %s: %v", sqlparser.Sanitize(query.Sql), err)
+	}
+	span, sql := trace.StartSqlSpan("vtgate.ExecuteLookup", sql, true)
+	span.Annotate("keyspace", query.Keyspace)
+	defer span.Finish()
+	qr := new(mproto.QueryResult)
+	if len(shards) != 0 {
+		// the DMLs change the lookup tables like ExecuteShard does
+		err = vtg.withLookups(stc, query.Keyspace, shards, []tproto.BoundQuery{{Sql: sql, BindVariables: bindVars}}, func() (err error) {
+			qr, err = stc.Execute(sql, bindVars, query.Keyspace, shards)
+			return err
+		})
+	}
+	if err == nil {
+		logStats.RowsAffected = int(qr.RowsAffected)
+	}
+	logStats.Send(err)
+	if err == nil {
+		*reply = *qr
+		if firstGenerated != 0 {
+			reply.InsertId = uint64(firstGenerated)
+		}
+	} else {
+		log.Errorf("ExecuteLookup: %v, query: %#v", err, sanitizeQueryLookup(query))
+		RecentErrors.Record(fmt.Errorf("ExecuteLookup: %v", err))
 	}
 	return err
 }
 
 // StreamExecuteShard executes a streaming query on the specified shards.
 func (vtg *VTGate) StreamExecuteShard(context *rpcproto.Context, query *proto.QueryShard, sendReply func(interface{}) error) error {
+	release, err := vtg.limits.Acquire(query.Keyspace)
+	if err != nil {
+		return fmt.Errorf("query: %s, session %d: %v", sqlparser.Sanitize(query.Sql), query.SessionId, err)
+	}
+	defer release()
 	scatterConn, err := vtg.connections.Get(query.SessionId, "for stream query")
 	if err != nil {
-		return fmt.Errorf("query: %s, session %d: %v", query.Sql, query.SessionId, err)
+		return fmt.Errorf("query: %s, session %d: %v", sqlparser.Sanitize(query.Sql), query.SessionId, err)
 	}
 	defer vtg.connections.Put(query.SessionId)
-	err = scatterConn.(*ScatterConn).StreamExecute(query.Sql, query.BindVariables, query.Keyspace, query.Shards, sendReply)
+	logStats := newQueryLogStats("StreamExecuteShard", context, query.Sql, query.BindVariables, query.Keyspace, query.Shards)
+	sql, bindVars := normalize(query.Sql, query.BindVariables)
+	span, sql := trace.StartSqlSpan("vtgate.StreamExecuteShard", sql, true)
+	span.Annotate("keyspace", query.Keyspace)
+	defer span.Finish()
+	err = scatterConn.(*ScatterConn).StreamExecute(sql, bindVars, query.Keyspace, query.Shards, func(reply interface{}) error {
+		if qr, ok := reply.(*mproto.QueryResult); ok {
+			logStats.RowsAffected += len(qr.Rows)
+		}
+		return sendReply(reply)
+	})
+	logStats.Send(err)
 	if err != nil {
-		log.Errorf("StreamExecuteShard: %v, query: %#v", err, query)
+		log.Errorf("StreamExecuteShard: %v, query: %#v", err, sanitizeQueryShard(query))
+		RecentErrors.Record(fmt.Errorf("StreamExecuteShard: %v", err))
 	}
 	return err
 }
@@ -108,6 +314,7 @@ func (vtg *VTGate) Begin(context *rpcproto.Context, session *proto.Session, noOu
 	err = scatterConn.(*ScatterConn).Begin()
 	if err != nil {
 		log.Errorf("Begin: %v, Session: %#v", err, session)
+		RecentErrors.Record(fmt.Errorf("Begin: %v", err))
 	}
 	return err
 }
@@ -122,6 +329,7 @@ func (vtg *VTGate) Commit(context *rpcproto.Context, session *proto.Session, noO
 	err = scatterConn.(*ScatterConn).Commit()
 	if err != nil {
 		log.Errorf("Commit: %v, Session: %#v", err, session)
+		RecentErrors.Record(fmt.Errorf("Commit: %v", err))
 	}
 	return err
 }
@@ -136,6 +344,7 @@ func (vtg *VTGate) Rollback(context *rpcproto.Context, session *proto.Session, n
 	err = scatterConn.(*ScatterConn).Rollback()
 	if err != nil {
 		log.Errorf("Rollback: %v, Session: %#v", err, session)
+		RecentErrors.Record(fmt.Errorf("Rollback: %v", err))
 	}
 	return err
 }
@@ -150,3 +359,10 @@ func (vtg *VTGate) CloseSession(context *rpcproto.Context, session *proto.Sessio
 	scatterConn.(*ScatterConn).Close()
 	return nil
 }
+
+// InvalidateSchemaCache drops the cached schema query results of a
+// keyspace. vtctl calls it after applying schema changes.
+func (vtg *VTGate) InvalidateSchemaCache(context *rpcproto.Context, req *proto.SchemaCacheInvalidation, noOutput *rpc.UnusedResponse) error {
+	vtg.schemaCache.Invalidate(req.Keyspace)
+	return nil
+}
@@ -5,6 +5,7 @@
 package vtgate
 
 import (
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
@@ -12,8 +13,11 @@ import (
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/pools"
+	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/rpc"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
 )
 
@@ -241,3 +245,341 @@ func TestVTGateClose(t *testing.T) {
 		t.Errorf("want %s, got %v", want, err)
 	}
 }
+
+func TestVTGateSequence(t *testing.T) {
+	sess := resetVTGate()
+	testConns[0] = &sandboxConn{}
+	seqConn := &sandboxConn{nextSequenceValue: 100}
+	testConns[1] = seqConn
+	RpcVTGate.sequences = sequences{"": {"user": &sequence{
+		SequenceConfig: SequenceConfig{Column: "id", Keyspace: "lookup", Shard: "1", Sequence: "user_seq"},
+		conn:           NewShardConn(RpcVTGate.balancerMap, "lookup", "1", "master", RpcVTGate.retryDelay, RpcVTGate.retryCount),
+	}}}
+
+	q := proto.QueryShard{
+		Sql:       "insert into user(name) values ('a'), ('b')",
+		SessionId: sess.SessionId,
+		Shards:    []string{"0"},
+	}
+	var qr mproto.QueryResult
+	if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if qr.InsertId != 100 || seqConn.nextSequenceValue != 102 {
+		t.Errorf("want insert id 100 and 2 values reserved, got %v and %v", qr.InsertId, seqConn.nextSequenceValue)
+	}
+
+	q.Sql = "insert into user(id, name) values (1, 'a')"
+	qr = mproto.QueryResult{}
+	if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if qr.InsertId != 0 || seqConn.nextSequenceValue != 102 {
+		t.Errorf("no value should be generated, got %v and %v", qr.InsertId, seqConn.nextSequenceValue)
+	}
+
+	bq := proto.BatchQueryShard{
+		Queries: []tproto.BoundQuery{{
+			"insert into user(id, name) values (:id, 'a')",
+			map[string]interface{}{"id": nil},
+		}, {
+			"query",
+			nil,
+		}},
+		SessionId: sess.SessionId,
+		Shards:    []string{"0"},
+	}
+	qrs := new(tproto.QueryResultList)
+	if err := RpcVTGate.ExecuteBatchShard(nil, &bq, qrs); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if qrs.List[0].InsertId != 102 || qrs.List[1].InsertId != 0 {
+		t.Errorf("want insert ids 102 and 0, got %v and %v", qrs.List[0].InsertId, qrs.List[1].InsertId)
+	}
+
+	q.Sql = "insert into user values (1, 'a')"
+	if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err == nil {
+		t.Errorf("insert without a column list should fail")
+	}
+}
+
+func TestVTGateLookup(t *testing.T) {
+	sess := resetVTGate()
+	lookupConn := &sandboxConn{}
+	lowConn := &sandboxConn{}
+	highConn := &sandboxConn{}
+	testConns[0] = lookupConn
+	testConns[1] = lowConn
+	testConns[2] = highConn
+	sandboxShardUids["-80"] = 1
+	sandboxShardUids["80-"] = 2
+	sandboxSrvKeyspaces["user"] = &topo.SrvKeyspace{Shards: []topo.SrvShard{
+		{KeyRange: key.KeyRange{Start: key.MinKey, End: key.KeyspaceId("\x80")}},
+		{KeyRange: key.KeyRange{Start: key.KeyspaceId("\x80"), End: key.MaxKey}},
+	}}
+	vschema := topo.NewVSchema(true)
+	vschema.Tables["user"] = &topo.VSchemaTable{
+		ShardingKey: "user_id",
+		Lookups: []*topo.VSchemaLookup{{
+			Column:     "name",
+			Keyspace:   "lookup",
+			Table:      "name_user_idx",
+			FromColumn: "name",
+			ToColumn:   "keyspace_id",
+		}},
+	}
+	sandboxVSchemas["user"] = vschema
+
+	q := proto.QueryShard{
+		Sql:       "insert into user(user_id, name) values (1, 'a'), (2, null)",
+		SessionId: sess.SessionId,
+		Keyspace:  "user",
+		Shards:    []string{"-80"},
+	}
+	var qr mproto.QueryResult
+	if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	wantQueries := []tproto.BoundQuery{{
+		"insert into name_user_idx(name, keyspace_id) values (:from0, :to0)",
+		map[string]interface{}{"from0": "a", "to0": []byte(key.Uint64Key(1).KeyspaceId())},
+	}}
+	if !reflect.DeepEqual(lookupConn.Queries, wantQueries) {
+		t.Errorf("want %#v, got %#v", wantQueries, lookupConn.Queries)
+	}
+	if lookupConn.CommitCount != 1 || lowConn.CommitCount != 1 {
+		t.Errorf("want 1 commit on each shard, got %v and %v", lookupConn.CommitCount, lowConn.CommitCount)
+	}
+
+	lookupConn.Queries = nil
+	lowConn.Queries = nil
+	q.Sql = "delete from user where user_id = 1"
+	if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	wantQueries = []tproto.BoundQuery{{
+		"delete from name_user_idx where name = :from and keyspace_id = :to",
+		map[string]interface{}{"from": []byte("foo"), "to": []byte(key.Uint64Key(1).KeyspaceId())},
+	}}
+	if !reflect.DeepEqual(lookupConn.Queries, wantQueries) {
+		t.Errorf("want %#v, got %#v", wantQueries, lookupConn.Queries)
+	}
+	if len(lowConn.Queries) != 2 || lowConn.Queries[0].Sql != "select user_id, name from user where user_id = 1 for update" {
+		t.Errorf("want a select for update then the delete, got %#v", lowConn.Queries)
+	}
+
+	lowConn.Queries = nil
+	q.Sql = "update user set name = 'b' where user_id = 1"
+	if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err == nil || !strings.Contains(err.Error(), "cannot change name") {
+		t.Errorf("want lookup column update error, got %v", err)
+	}
+	q.Sql = "update user set USER_ID = 3 where user_id = 1"
+	if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err == nil || !strings.Contains(err.Error(), "cannot change user_id") {
+		t.Errorf("want sharding column update error, got %v", err)
+	}
+	if len(lowConn.Queries) != 0 {
+		t.Errorf("want no query, got %#v", lowConn.Queries)
+	}
+	q.Sql = "update user set age = 3 where user_id = 1"
+	if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	lq := proto.QueryLookup{
+		Sql:           "select * from user where name = :name",
+		BindVariables: map[string]interface{}{"name": "foo"},
+		SessionId:     sess.SessionId,
+		Keyspace:      "user",
+		Table:         "user",
+		Column:        "name",
+	}
+	lowConn.ExecCount = 0
+	if err := RpcVTGate.ExecuteLookup(nil, &lq, &qr); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if lowConn.ExecCount != 1 || highConn.ExecCount != 0 {
+		t.Errorf("want the query on shard -80 only, got %v and %v", lowConn.ExecCount, highConn.ExecCount)
+	}
+
+	// comment directives bypass the lookup table
+	lookupConn.ExecCount = 0
+	lowConn.ExecCount = 0
+	lq.Sql = "select /*vt+ SHARD=80- */ * from user where name = :name"
+	if err := RpcVTGate.ExecuteLookup(nil, &lq, &qr); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if lookupConn.ExecCount != 0 || lowConn.ExecCount != 0 || highConn.ExecCount != 1 {
+		t.Errorf("want the query on shard 80- only, got %v, %v and %v", lookupConn.ExecCount, lowConn.ExecCount, highConn.ExecCount)
+	}
+	lq.Sql = "select * from user"
+	lq.BindVariables = nil
+	if err := RpcVTGate.ExecuteLookup(nil, &lq, &qr); err == nil || !strings.Contains(err.Error(), "missing bind variable name") {
+		t.Errorf("want missing bind variable error, got %v", err)
+	}
+	lq.Sql = "select /*vt+ ALLOW_FULL_SCAN */ * from user"
+	if err := RpcVTGate.ExecuteLookup(nil, &lq, &qr); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if lookupConn.ExecCount != 0 || lowConn.ExecCount != 1 || highConn.ExecCount != 2 {
+		t.Errorf("want the query on all shards, got %v, %v and %v", lookupConn.ExecCount, lowConn.ExecCount, highConn.ExecCount)
+	}
+
+	// the DMLs routed by a lookup maintain the lookup tables too
+	lookupConn.Queries = nil
+	lowConn.Queries = nil
+	lq.Sql = "delete from user where name = :name"
+	lq.BindVariables = map[string]interface{}{"name": "foo"}
+	if err := RpcVTGate.ExecuteLookup(nil, &lq, &qr); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	wantQueries = []tproto.BoundQuery{{
+		"delete from name_user_idx where name = :from and keyspace_id = :to",
+		map[string]interface{}{"from": []byte("foo"), "to": []byte(key.Uint64Key(1).KeyspaceId())},
+	}}
+	if len(lookupConn.Queries) != 2 || !reflect.DeepEqual(lookupConn.Queries[1:], wantQueries) {
+		t.Errorf("want the lookup then %#v, got %#v", wantQueries, lookupConn.Queries)
+	}
+	if len(lowConn.Queries) != 2 || lowConn.Queries[0].Sql != "select user_id, name from user where name = :name for update" {
+		t.Errorf("want a select for update then the delete, got %#v", lowConn.Queries)
+	}
+	lowConn.Queries = nil
+	lq.Sql = "update user set name = 'b' where name = :name"
+	if err := RpcVTGate.ExecuteLookup(nil, &lq, &qr); err == nil || !strings.Contains(err.Error(), "cannot change name") {
+		t.Errorf("want lookup column update error, got %v", err)
+	}
+	if len(lowConn.Queries) != 0 {
+		t.Errorf("want no query, got %#v", lowConn.Queries)
+	}
+
+	// and get the values of their sequences
+	seqConn := &sandboxConn{nextSequenceValue: 100}
+	testConns[3] = seqConn
+	RpcVTGate.sequences = sequences{"user": {"user": &sequence{
+		SequenceConfig: SequenceConfig{Column: "user_id", Keyspace: "lookup", Shard: "3", Sequence: "user_seq"},
+		conn:           NewShardConn(RpcVTGate.balancerMap, "lookup", "3", "master", RpcVTGate.retryDelay, RpcVTGate.retryCount),
+	}}}
+	lookupConn.Queries = nil
+	lq.Sql = "insert into user(name) values (:name)"
+	qr = mproto.QueryResult{}
+	if err := RpcVTGate.ExecuteLookup(nil, &lq, &qr); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if qr.InsertId != 100 || seqConn.nextSequenceValue != 101 {
+		t.Errorf("want insert id 100 and 1 value reserved, got %v and %v", qr.InsertId, seqConn.nextSequenceValue)
+	}
+	wantQueries = []tproto.BoundQuery{{
+		"insert into name_user_idx(name, keyspace_id) values (:from0, :to0)",
+		map[string]interface{}{"from0": "foo", "to0": []byte(key.Uint64Key(100).KeyspaceId())},
+	}}
+	if len(lookupConn.Queries) != 2 || !reflect.DeepEqual(lookupConn.Queries[1:], wantQueries) {
+		t.Errorf("want the lookup then %#v, got %#v", wantQueries, lookupConn.Queries)
+	}
+	RpcVTGate.sequences = nil
+
+	lookupConn.RollbackCount = 0
+	q.Sql = "insert into user(name) values ('a')"
+	if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err == nil || !strings.Contains(err.Error(), "needs a value for user_id") {
+		t.Errorf("want missing sharding key error, got %v", err)
+	}
+	lq.Column = "user_id"
+	if err := RpcVTGate.ExecuteLookup(nil, &lq, &qr); err == nil || !strings.Contains(err.Error(), "has no lookup") {
+		t.Errorf("want no lookup error, got %v", err)
+	}
+}
+
+func TestVTGateNormalize(t *testing.T) {
+	sess := resetVTGate()
+	sbc := &sandboxConn{}
+	testConns[0] = sbc
+	*normalizeQueries = true
+	defer func() { *normalizeQueries = false }()
+
+	q := proto.QueryShard{
+		Sql:       "select * from user where id = 1 and name = 'a' /* trailing */",
+		SessionId: sess.SessionId,
+		Shards:    []string{"0"},
+	}
+	var qr mproto.QueryResult
+	if err := RpcVTGate.ExecuteShard(nil, &q, &qr); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	want := []tproto.BoundQuery{{
+		Sql:           "select * from user where id = :_vtn0 and name = :_vtn1 /* trailing */",
+		BindVariables: map[string]interface{}{"_vtn0": int64(1), "_vtn1": "a"},
+	}}
+	if !reflect.DeepEqual(sbc.Queries, want) {
+		t.Errorf("want %#v, got %#v", want, sbc.Queries)
+	}
+	if q.BindVariables != nil {
+		t.Errorf("the bind variables of the client should not change, got %v", q.BindVariables)
+	}
+	if got := normalizeStats.Counts()["Normalized"]; got == 0 {
+		t.Errorf("want normalized queries to be counted, got %v", got)
+	}
+}
+
+func TestVTGateExplain(t *testing.T) {
+	sess := resetVTGate()
+	lookupConn := &sandboxConn{}
+	lowConn := &sandboxConn{}
+	highConn := &sandboxConn{}
+	testConns[0] = lookupConn
+	testConns[1] = lowConn
+	testConns[2] = highConn
+	sandboxShardUids["-80"] = 1
+	sandboxShardUids["80-"] = 2
+	sandboxSrvKeyspaces["user"] = &topo.SrvKeyspace{Shards: []topo.SrvShard{
+		{KeyRange: key.KeyRange{Start: key.MinKey, End: key.KeyspaceId("\x80")}},
+		{KeyRange: key.KeyRange{Start: key.KeyspaceId("\x80"), End: key.MaxKey}},
+	}}
+	vschema := topo.NewVSchema(true)
+	vschema.Tables["user"] = &topo.VSchemaTable{
+		ShardingKey: "user_id",
+		Lookups: []*topo.VSchemaLookup{{
+			Column:     "name",
+			Keyspace:   "lookup",
+			Table:      "name_user_idx",
+			FromColumn: "name",
+			ToColumn:   "keyspace_id",
+		}},
+	}
+	sandboxVSchemas["user"] = vschema
+
+	testCases := []struct {
+		query proto.QueryLookup
+		want  proto.ExplainResult
+	}{{
+		proto.QueryLookup{Sql: "select * from user where entity_id = :id", BindVariables: map[string]interface{}{"id": "\x90"}},
+		proto.ExplainResult{Routing: sqlparser.ROUTING_CONDITION, Shards: []string{"80-"}, Sql: "select * from user where entity_id = :id", BindVariables: map[string]interface{}{"id": "\x90"}},
+	}, {
+		proto.QueryLookup{Sql: "select * from user where name = 'a'"},
+		proto.ExplainResult{Routing: sqlparser.ROUTING_SCATTER, Shards: []string{"-80", "80-"}, Sql: "select * from user where name = 'a'"},
+	}, {
+		proto.QueryLookup{Sql: "select * from user where name = :name", BindVariables: map[string]interface{}{"name": "foo"}, Table: "user", Column: "name"},
+		proto.ExplainResult{Routing: ROUTING_LOOKUP, Shards: []string{"-80"}, Sql: "select * from user where name = :name", BindVariables: map[string]interface{}{"name": "foo"}},
+	}, {
+		proto.QueryLookup{Sql: "select /*vt+ SHARD=80- */ * from user", Table: "user", Column: "name"},
+		proto.ExplainResult{Routing: ROUTING_SHARD, Shards: []string{"80-"}, Sql: "select /*vt+ SHARD=80- */ * from user"},
+	}}
+	for _, tc := range testCases {
+		tc.query.SessionId = sess.SessionId
+		tc.query.Keyspace = "user"
+		var got proto.ExplainResult
+		if err := RpcVTGate.Explain(nil, &tc.query, &got); err != nil {
+			t.Errorf("Explain(%v): %v", tc.query.Sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Explain(%v): want %#v, got %#v", tc.query.Sql, tc.want, got)
+		}
+	}
+	if lowConn.ExecCount != 0 || highConn.ExecCount != 0 {
+		t.Errorf("explained queries should not be executed, got %v and %v", lowConn.ExecCount, highConn.ExecCount)
+	}
+
+	q := proto.QueryLookup{Sql: "select * from user where entity_id = :missing", SessionId: sess.SessionId, Keyspace: "user"}
+	var reply proto.ExplainResult
+	if err := RpcVTGate.Explain(nil, &q, &reply); err == nil {
+		t.Errorf("explaining a query with a missing bind variable should fail")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/jscfg"
 	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/stats/push"
 	"github.com/youtube/vitess/go/vt/dbconfigs"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/sqlparser"
@@ -47,6 +48,8 @@ func InitAgent(
 	mycnf *mysqlctl.Mycnf,
 	dbCredentialsFile string,
 	port, securePort int,
+	namedPorts map[string]int,
+	publishIPAddr bool,
 	mycnfFile, overridesFile string) (err error) {
 	schemaOverrides := loadSchemaOverrides(overridesFile)
 
@@ -69,6 +72,8 @@ func InitAgent(
 	if err != nil {
 		return err
 	}
+	agent.BinlogPlayerMap = binlogPlayerMap
+	agent.PublishIPAddr = publishIPAddr
 	agent.AddChangeCallback(func(oldTablet, newTablet topo.Tablet) {
 		allowQuery := true
 		var shardInfo *topo.ShardInfo
@@ -81,6 +86,10 @@ func InitAgent(
 				allowQuery = len(shardInfo.SourceShards) == 0
 			}
 		}
+		if newTablet.State == topo.STATE_FENCED {
+			// a master being demoted by a reparent
+			allowQuery = false
+		}
 
 		if newTablet.IsServingType() && allowQuery {
 			if dbcfgs.App.DbName == "" {
@@ -105,7 +114,12 @@ func InitAgent(
 					qrs.Add(qr)
 				}
 			}
-			ts.AllowQueries(dbcfgs.App, schemaOverrides, qrs)
+			ts.AllowQueries(dbcfgs, schemaOverrides, qrs)
+			if newTablet.Type == topo.TYPE_MASTER {
+				// the redo log of the previous master was
+				// replicated, prepare its transactions again
+				ts.RecoverPreparedTransactions()
+			}
 			// Disable before enabling to force existing streams to stop.
 			mysqlctl.DisableUpdateStreamService()
 			mysqlctl.EnableUpdateStreamService(dbcfgs)
@@ -124,6 +138,12 @@ func InitAgent(
 		statsKeyRangeStart.Set(string(newTablet.KeyRange.Start.Hex()))
 		statsKeyRangeEnd.Set(string(newTablet.KeyRange.End.Hex()))
 
+		// and tag the pushed stats with our location
+		push.SetTag("cell", newTablet.Alias.Cell)
+		push.SetTag("keyspace", newTablet.Keyspace)
+		push.SetTag("shard", newTablet.Shard)
+		push.SetTag("tablet_type", string(newTablet.Type))
+
 		// See if we need to start or stop any binlog player
 		if newTablet.Type == topo.TYPE_MASTER {
 			binlogPlayerMap.RefreshMap(newTablet, shardInfo)
@@ -132,16 +152,29 @@ func InitAgent(
 		}
 	})
 
-	if err := agent.Start(mysqld.Port(), port, securePort); err != nil {
+	if err := agent.Start(mysqld.Port(), port, securePort, namedPorts); err != nil {
 		return err
 	}
 
 	// register the RPC services from the agent
 	agent.RegisterQueryService(mysqld)
 
+	addStatusParts()
 	return nil
 }
 
+// EnterLameduck removes the tablet from the serving graph, at the
+// beginning of the lameduck period of vttablet. The queries are still
+// served until the query service is stopped.
+func EnterLameduck() {
+	if agent == nil {
+		return
+	}
+	if err := agent.RemoveServingAddr(); err != nil {
+		log.Warningf("cannot remove the tablet from the serving graph: %v", err)
+	}
+}
+
 func CloseAgent() {
 	if agent != nil {
 		agent.Stop()
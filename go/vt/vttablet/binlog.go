@@ -16,6 +16,7 @@ import (
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/mysql"
 	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/concurrency"
 	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/topo"
@@ -38,8 +39,16 @@ type BinlogPlayerController struct {
 	// Information about the source
 	sourceShard topo.SourceShard
 
-	// interrupted is the channel to close to stop the playback
+	// stopAtGroupId, if not empty, is the group id at which the
+	// player will stop
+	stopAtGroupId string
+
+	// interrupted is the channel to close to stop the playback,
+	// it is nil when the player is not running
 	interrupted chan struct{}
+
+	// done is closed when the playback loop exits
+	done chan struct{}
 }
 
 func NewBinlogPlayerController(ts topo.Server, dbConfig *mysql.ConnectionParams, mysqld *mysqlctl.Mysqld, cell string, keyRange key.KeyRange, sourceShard topo.SourceShard) *BinlogPlayerController {
@@ -50,7 +59,6 @@ func NewBinlogPlayerController(ts topo.Server, dbConfig *mysql.ConnectionParams,
 		cell:        cell,
 		keyRange:    keyRange,
 		sourceShard: sourceShard,
-		interrupted: make(chan struct{}, 1),
 	}
 	return blc
 }
@@ -59,27 +67,69 @@ func (bpc *BinlogPlayerController) String() string {
 	return "BinlogPlayerController(" + bpc.sourceShard.String() + ")"
 }
 
+// Start will start the player, it shouldn't be running.
 func (bpc *BinlogPlayerController) Start() {
-	log.Infof("%v: Starting binlog player", bpc)
+	bpc.StartUntil("")
+}
+
+// StartUntil will start the player, and stop it once it reaches
+// stopAtGroupId. If stopAtGroupId is empty, the player won't stop.
+func (bpc *BinlogPlayerController) StartUntil(stopAtGroupId string) {
+	if bpc.interrupted != nil {
+		log.Warningf("%v: already started", bpc)
+		return
+	}
+	log.Infof("%v: Starting binlog player (stop at group id '%v')", bpc, stopAtGroupId)
+	bpc.stopAtGroupId = stopAtGroupId
+	bpc.interrupted = make(chan struct{}, 1)
+	bpc.done = make(chan struct{}, 1)
 	go bpc.Loop()
 }
 
+// Stop will stop the player, and wait for it to exit. It is safe
+// to call it on a player that is not running.
 func (bpc *BinlogPlayerController) Stop() {
+	if bpc.interrupted == nil {
+		return
+	}
 	log.Infof("%v: Stopping binlog player", bpc)
 	close(bpc.interrupted)
+	<-bpc.done
+	bpc.interrupted = nil
+}
+
+// WaitForStop waits for the player to reach its stop position, and
+// cleans up after it. If it doesn't happen in time, the player is
+// stopped and an error is returned.
+func (bpc *BinlogPlayerController) WaitForStop(waitTimeout time.Duration) error {
+	select {
+	case <-bpc.done:
+		bpc.interrupted = nil
+		return nil
+	case <-time.After(waitTimeout):
+		bpc.Stop()
+		return fmt.Errorf("%v: timed out waiting to reach group id %v", bpc, bpc.stopAtGroupId)
+	}
 }
 
 func (bpc *BinlogPlayerController) Loop() {
+	defer close(bpc.done)
 	for {
 		err := bpc.Iteration()
 		if err == nil {
-			// this happens when we get interrupted
+			// this happens when we get interrupted, or
+			// reach our stop position
 			break
 		}
 		log.Warningf("%v: %v", bpc, err)
 
 		// sleep for a bit before retrying to connect
-		time.Sleep(5 * time.Second)
+		select {
+		case <-bpc.interrupted:
+			log.Infof("%v: Exited main binlog player loop", bpc)
+			return
+		case <-time.After(5 * time.Second):
+		}
 	}
 
 	log.Infof("%v: Exited main binlog player loop", bpc)
@@ -119,8 +169,9 @@ func (bpc *BinlogPlayerController) Iteration() (err error) {
 		return fmt.Errorf("can't read startPosition: %v", err)
 	}
 
-	// Find the server list for the source shard in our cell
-	addrs, err := bpc.ts.GetEndPoints(bpc.cell, bpc.sourceShard.Keyspace, bpc.sourceShard.Shard, topo.TYPE_REPLICA)
+	// Find the server list for the source shard in our cell (or
+	// in the sibling cells of our cell)
+	addrs, err := topo.GetEndPointsWithFallback(bpc.ts, bpc.cell, bpc.sourceShard.Keyspace, bpc.sourceShard.Shard, topo.TYPE_REPLICA)
 	if err != nil {
 		return fmt.Errorf("can't find any source tablet for %v %v %v: %v", bpc.cell, bpc.sourceShard.String(), topo.TYPE_REPLICA, err)
 	}
@@ -128,7 +179,16 @@ func (bpc *BinlogPlayerController) Iteration() (err error) {
 		return fmt.Errorf("empty source tablet list for %v %v %v", bpc.cell, bpc.sourceShard.String(), topo.TYPE_REPLICA)
 	}
 	newServerIndex := rand.Intn(len(addrs.Entries))
-	addr := fmt.Sprintf("%v:%v", addrs.Entries[newServerIndex].Host, addrs.Entries[newServerIndex].NamedPortMap["_vtocc"])
+	addr, err := addrs.Entries[newServerIndex].Addr(topo.DefaultPortName)
+	if err != nil {
+		return err
+	}
+
+	// tables, just get them
+	if len(bpc.sourceShard.Tables) > 0 {
+		player := mysqlctl.NewBinlogPlayerTables(vtClient, addr, bpc.sourceShard.Tables, startPosition, bpc.stopAtGroupId)
+		return player.ApplyBinlogEvents(bpc.interrupted)
+	}
 
 	// the data we have to replicate is the intersection of the
 	// source keyrange and our keyrange
@@ -137,19 +197,30 @@ func (bpc *BinlogPlayerController) Iteration() (err error) {
 		return fmt.Errorf("Source shard %v doesn't overlap destination shard %v", bpc.sourceShard.KeyRange, bpc.keyRange)
 	}
 
-	player := mysqlctl.NewBinlogPlayer(vtClient, addr, overlap, startPosition)
+	player := mysqlctl.NewBinlogPlayer(vtClient, addr, overlap, startPosition, bpc.stopAtGroupId)
 	return player.ApplyBinlogEvents(bpc.interrupted)
 }
 
+const (
+	// BPM_STATE_RUNNING means the players are replicating
+	BPM_STATE_RUNNING int64 = iota
+
+	// BPM_STATE_STOPPED means the players have been stopped
+	// explicitly (by StopBlp), and will stay stopped until
+	// restarted (by StartBlp)
+	BPM_STATE_STOPPED
+)
+
 // BinlogPlayerMap controls all the players
 type BinlogPlayerMap struct {
 	ts       topo.Server
 	dbConfig mysql.ConnectionParams
 	mysqld   *mysqlctl.Mysqld
 
-	// This mutex protects the map
+	// This mutex protects the map and the state
 	mu      sync.Mutex
-	players map[topo.SourceShard]*BinlogPlayerController
+	players map[uint32]*BinlogPlayerController // indexed by SourceShard.Uid
+	state   int64
 }
 
 func NewBinlogPlayerMap(ts topo.Server, dbConfig mysql.ConnectionParams, mysqld *mysqlctl.Mysqld) *BinlogPlayerMap {
@@ -157,7 +228,8 @@ func NewBinlogPlayerMap(ts topo.Server, dbConfig mysql.ConnectionParams, mysqld
 		ts:       ts,
 		dbConfig: dbConfig,
 		mysqld:   mysqld,
-		players:  make(map[topo.SourceShard]*BinlogPlayerController),
+		players:  make(map[uint32]*BinlogPlayerController),
+		state:    BPM_STATE_RUNNING,
 	}
 }
 
@@ -174,15 +246,17 @@ func (blm *BinlogPlayerMap) size() int64 {
 
 // addPlayer adds a new player to the map. It assumes we have the lock.
 func (blm *BinlogPlayerMap) addPlayer(cell string, keyRange key.KeyRange, sourceShard topo.SourceShard) {
-	bpc, ok := blm.players[sourceShard]
+	bpc, ok := blm.players[sourceShard.Uid]
 	if ok {
 		log.Infof("Already playing logs for %v", sourceShard)
 		return
 	}
 
 	bpc = NewBinlogPlayerController(blm.ts, &blm.dbConfig, blm.mysqld, cell, keyRange, sourceShard)
-	blm.players[sourceShard] = bpc
-	bpc.Start()
+	blm.players[sourceShard.Uid] = bpc
+	if blm.state == BPM_STATE_RUNNING {
+		bpc.Start()
+	}
 }
 
 func (blm *BinlogPlayerMap) StopAllPlayers() {
@@ -192,7 +266,8 @@ func (blm *BinlogPlayerMap) StopAllPlayers() {
 		bpc.Stop()
 		hadPlayers = true
 	}
-	blm.players = make(map[topo.SourceShard]*BinlogPlayerController)
+	blm.players = make(map[uint32]*BinlogPlayerController)
+	blm.state = BPM_STATE_RUNNING
 	blm.mu.Unlock()
 
 	if hadPlayers {
@@ -212,7 +287,7 @@ func (blm *BinlogPlayerMap) RefreshMap(tablet topo.Tablet, shardInfo *topo.Shard
 	blm.mu.Lock()
 
 	// get the existing sources and build a map of sources to remove
-	toRemove := make(map[topo.SourceShard]bool)
+	toRemove := make(map[uint32]bool)
 	hadPlayers := false
 	for source := range blm.players {
 		toRemove[source] = true
@@ -222,7 +297,7 @@ func (blm *BinlogPlayerMap) RefreshMap(tablet topo.Tablet, shardInfo *topo.Shard
 	// for each source, add it if not there, and delete from toRemove
 	for _, sourceShard := range shardInfo.SourceShards {
 		blm.addPlayer(tablet.Alias.Cell, tablet.KeyRange, sourceShard)
-		delete(toRemove, sourceShard)
+		delete(toRemove, sourceShard.Uid)
 	}
 	hasPlayers := len(shardInfo.SourceShards) > 0
 
@@ -248,3 +323,96 @@ func (blm *BinlogPlayerMap) EnableSuperToSetTimestamp() {
 		log.Info("Successfully set super_to_set_timestamp=1")
 	}
 }
+
+// Stop stops all the players, but keeps them in the map, so they
+// can be restarted by Start or RunUntil.
+func (blm *BinlogPlayerMap) Stop() {
+	blm.mu.Lock()
+	defer blm.mu.Unlock()
+	if blm.state == BPM_STATE_STOPPED {
+		log.Warningf("BinlogPlayerMap already stopped")
+		return
+	}
+	log.Infof("Stopping map of binlog players")
+	for _, bpc := range blm.players {
+		bpc.Stop()
+	}
+	blm.state = BPM_STATE_STOPPED
+}
+
+// Start restarts all the players that were stopped by Stop.
+func (blm *BinlogPlayerMap) Start() {
+	blm.mu.Lock()
+	defer blm.mu.Unlock()
+	if blm.state == BPM_STATE_RUNNING {
+		log.Warningf("BinlogPlayerMap already started")
+		return
+	}
+	log.Infof("Starting map of binlog players")
+	for _, bpc := range blm.players {
+		bpc.Start()
+	}
+	blm.state = BPM_STATE_RUNNING
+}
+
+// BlpPositionList returns the current position of all the players,
+// as saved in the blp_checkpoint table.
+func (blm *BinlogPlayerMap) BlpPositionList() (*mysqlctl.BlpPositionList, error) {
+	vtClient := mysqlctl.NewDbClient(&blm.dbConfig)
+	if err := vtClient.Connect(); err != nil {
+		return nil, fmt.Errorf("can't connect to database: %v", err)
+	}
+	defer vtClient.Close()
+
+	blm.mu.Lock()
+	defer blm.mu.Unlock()
+	result := &mysqlctl.BlpPositionList{}
+	for uid := range blm.players {
+		pos, err := mysqlctl.ReadStartPosition(vtClient, uid)
+		if err != nil {
+			return nil, err
+		}
+		result.Entries = append(result.Entries, *pos)
+	}
+	return result, nil
+}
+
+// RunUntil runs all the players until they reach the given
+// positions, and leaves them stopped. The map has to be stopped
+// when this is called.
+func (blm *BinlogPlayerMap) RunUntil(blpPositionList *mysqlctl.BlpPositionList, waitTimeout time.Duration) error {
+	blm.mu.Lock()
+	defer blm.mu.Unlock()
+	if blm.state != BPM_STATE_STOPPED {
+		return fmt.Errorf("RunUntil: BinlogPlayerMap must be stopped first")
+	}
+
+	// find the exact stop position for all players, to be sure
+	// we're not doing anything wrong
+	stopPositions := make(map[uint32]string)
+	for uid := range blm.players {
+		pos, err := blpPositionList.FindBlpPositionById(uid)
+		if err != nil {
+			return fmt.Errorf("RunUntil: %v", err)
+		}
+		stopPositions[uid] = pos.GroupId
+	}
+
+	// start all the players, and wait for them
+	for uid, bpc := range blm.players {
+		bpc.StartUntil(stopPositions[uid])
+	}
+	wg := sync.WaitGroup{}
+	rec := concurrency.AllErrorRecorder{}
+	for _, bpc := range blm.players {
+		wg.Add(1)
+		go func(bpc *BinlogPlayerController) {
+			defer wg.Done()
+			if err := bpc.WaitForStop(waitTimeout); err != nil {
+				rec.RecordError(err)
+			}
+		}(bpc)
+	}
+	wg.Wait()
+	return rec.Error()
+}
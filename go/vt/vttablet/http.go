@@ -7,6 +7,7 @@ package vttablet
 // This file handles the http server for snapshots, clones, ...
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
@@ -18,10 +19,13 @@ import (
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/cgzip"
+	"github.com/youtube/vitess/go/ioutil2"
 	vtenv "github.com/youtube/vitess/go/vt/env"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 )
 
+var snapshotServeMaxRate = flag.Int64("snapshot-serve-max-rate", 0, "maximum rate (in bytes per second) for all snapshot files served by this tablet, 0 for unlimited")
+
 // HttpHandleSnapshots handles the serving of files from the local tablet
 func HttpHandleSnapshots(mycnf *mysqlctl.Mycnf, uid uint32) {
 	// make a list of paths we can serve HTTP traffic from.
@@ -36,15 +40,18 @@ func HttpHandleSnapshots(mycnf *mysqlctl.Mycnf, uid uint32) {
 		mycnf.InnodbLogGroupHomeDir,
 	}
 
+	// all transfers share the same bandwidth
+	bl := ioutil2.NewBandwidthLimiter(*snapshotServeMaxRate)
+
 	// NOTE: trailing slash in pattern means we handle all paths with this prefix
 	http.Handle(mysqlctl.SnapshotURLPath+"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleSnapshot(w, r, snapshotDir, allowedPaths)
+		handleSnapshot(w, r, snapshotDir, allowedPaths, bl)
 	}))
 
 }
 
 // serve an individual query
-func handleSnapshot(rw http.ResponseWriter, req *http.Request, snapshotDir string, allowedPaths []string) {
+func handleSnapshot(rw http.ResponseWriter, req *http.Request, snapshotDir string, allowedPaths []string, bl *ioutil2.BandwidthLimiter) {
 	// if we get any error, we'll try to write a server error
 	// (it will fail if the header has already been written, but at least
 	// we won't crash vttablet)
@@ -88,7 +95,7 @@ func handleSnapshot(rw http.ResponseWriter, req *http.Request, snapshotDir strin
 			continue
 		}
 		if strings.HasPrefix(realPath, allowedPath) {
-			sendFile(rw, req, realPath)
+			sendFile(rw, req, realPath, bl)
 			return
 		}
 	}
@@ -98,7 +105,7 @@ func handleSnapshot(rw http.ResponseWriter, req *http.Request, snapshotDir strin
 }
 
 // custom function to serve files
-func sendFile(rw http.ResponseWriter, req *http.Request, path string) {
+func sendFile(rw http.ResponseWriter, req *http.Request, path string, bl *ioutil2.BandwidthLimiter) {
 	log.Infof("serve %v %v", req.URL.Path, path)
 	file, err := os.Open(path)
 	if err != nil {
@@ -125,33 +132,59 @@ func sendFile(rw http.ResponseWriter, req *http.Request, path string) {
 		return
 	}
 
-	// support Accept-Encoding header
-	var writer io.Writer = rw
-	var reader io.Reader = file
-	if !strings.HasSuffix(path, ".gz") {
-		ae := req.Header.Get("Accept-Encoding")
-
-		if strings.Contains(ae, "gzip") {
-			gz, err := cgzip.NewWriterLevel(rw, cgzip.Z_BEST_SPEED)
-			if err != nil {
-				http.Error(rw, err.Error(), http.StatusInternalServerError)
-				return
+	// support Range header, only for 'bytes=<start>-', which is
+	// what we use to resume transfers. We don't compress ranges.
+	// The output is sent at the allowed rate.
+	var writer io.Writer = ioutil2.NewLimitedWriter(rw, bl)
+	compressed := false
+	status := http.StatusOK
+	if rh := req.Header.Get("Range"); rh != "" {
+		var start int64
+		if _, err := fmt.Sscanf(rh, "bytes=%d-", &start); err != nil || start < 0 || !strings.HasSuffix(rh, "-") {
+			http.Error(rw, fmt.Sprintf("unsupported Range: %v", rh), http.StatusBadRequest)
+			return
+		}
+		if start >= fileinfo.Size() {
+			rw.Header().Set("Content-Range", fmt.Sprintf("bytes */%v", fileinfo.Size()))
+			http.Error(rw, "416 requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if _, err := file.Seek(start, os.SEEK_SET); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Range", fmt.Sprintf("bytes %v-%v/%v", start, fileinfo.Size()-1, fileinfo.Size()))
+		rw.Header().Set("Content-Length", fmt.Sprintf("%v", fileinfo.Size()-start))
+		status = http.StatusPartialContent
+	} else {
+		// support Accept-Encoding header
+		if !strings.HasSuffix(path, ".gz") {
+			ae := req.Header.Get("Accept-Encoding")
+
+			if strings.Contains(ae, "gzip") {
+				gz, err := cgzip.NewWriterLevel(writer, cgzip.Z_BEST_SPEED)
+				if err != nil {
+					http.Error(rw, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				rw.Header().Set("Content-Encoding", "gzip")
+				defer gz.Close()
+				writer = gz
+				compressed = true
 			}
-			rw.Header().Set("Content-Encoding", "gzip")
-			defer gz.Close()
-			writer = gz
 		}
-	}
 
-	// add content-length if we know it
-	if writer == rw && reader == file {
-		rw.Header().Set("Content-Length", fmt.Sprintf("%v", fileinfo.Size()))
+		// add content-length if we know it
+		if !compressed {
+			rw.Header().Set("Content-Length", fmt.Sprintf("%v", fileinfo.Size()))
+		}
 	}
 
 	// and just copy content out
 	rw.Header().Set("Last-Modified", fileinfo.ModTime().UTC().Format(http.TimeFormat))
-	rw.WriteHeader(http.StatusOK)
-	if _, err := io.Copy(writer, reader); err != nil {
+	rw.Header().Set("Accept-Ranges", "bytes")
+	rw.WriteHeader(status)
+	if _, err := io.Copy(writer, file); err != nil {
 		log.Warningf("transfer failed %v: %v", path, err)
 	}
 }
@@ -0,0 +1,30 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vttablet
+
+import (
+	"github.com/youtube/vitess/go/vt/servenv"
+)
+
+const tabletStatusHTML = `{{if .}}<table>
+  <tr><td>Alias</td><td>{{.Alias}}</td></tr>
+  <tr><td>Keyspace</td><td>{{.Keyspace}}</td></tr>
+  <tr><td>Shard</td><td>{{.Shard}}</td></tr>
+  <tr><td>Key range</td><td>{{.KeyRange}}</td></tr>
+  <tr><td>Type</td><td>{{.Type}}</td></tr>
+  <tr><td>State</td><td>{{.State}}</td></tr>
+  <tr><td>Parent</td><td>{{.Parent}}</td></tr>
+  <tr><td>MySQL</td><td>{{.MysqlAddr}}</td></tr>
+</table>{{else}}Tablet record not loaded yet.{{end}}`
+
+// addStatusParts adds the tablet section to the status page.
+func addStatusParts() {
+	servenv.AddStatusPart("Tablet", tabletStatusHTML, func() interface{} {
+		if agent == nil {
+			return nil
+		}
+		return agent.Tablet()
+	})
+}
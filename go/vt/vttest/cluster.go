@@ -0,0 +1,380 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package vttest launches a complete vitess cluster on the local
+machine, for the integration tests of applications: a zookeeper, a
+mysqld and a vttablet per tablet, and a vtgate. The cluster is
+described by a Topology, and set up like the python integration tests
+do, with the binaries of $VTROOT/bin. The data of zookeeper and of the
+mysqlds goes to $VTDATAROOT.
+
+A test would do:
+
+	cluster, err := vttest.NewCluster(&vttest.Topology{
+		Keyspaces: []*vttest.Keyspace{{
+			Name:   "user",
+			Shards: []string{"-80", "80-"},
+			Schema: "create table user(id bigint, name varchar(64), primary key(id))",
+		}},
+	}, vttest.Options{PortBase: 16000, TabletUidBase: 100})
+	if err != nil { ... }
+	if err := cluster.Start(); err != nil { ... }
+	defer cluster.TearDown()
+	// connect to cluster.VtgateAddr()
+*/
+package vttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/mysql"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/env"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// StartTimeout is how long Start waits for each vttablet and for
+// vtgate to serve.
+var StartTimeout = 30 * time.Second
+
+// Cluster is a test cluster. Its processes are started by Start, and
+// stopped by TearDown.
+type Cluster struct {
+	topology *Topology
+	options  Options
+	vtRoot   string
+
+	zkPorts    [3]int
+	tablets    []*Tablet
+	vtgatePort int
+
+	mu        sync.Mutex
+	processes []*exec.Cmd
+}
+
+// NewCluster checks topology, and assigns the uids and the free ports
+// of the cluster. It does not start anything.
+func NewCluster(topology *Topology, options Options) (*Cluster, error) {
+	if err := topology.validate(); err != nil {
+		return nil, err
+	}
+	if options.PortBase == 0 {
+		options.PortBase = 16000
+	}
+	if options.TabletUidBase == 0 {
+		options.TabletUidBase = 100
+	}
+	if options.LogDir == "" {
+		options.LogDir = path.Join(env.VtDataRoot(), "vttest")
+	}
+	vtRoot, err := env.VtRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &Cluster{topology: topology, options: options, vtRoot: vtRoot}
+	ports := &portAllocator{next: options.PortBase}
+	for i := range cluster.zkPorts {
+		cluster.zkPorts[i] = ports.get()
+	}
+	cluster.tablets = topology.tablets(options.TabletUidBase, ports)
+	cluster.vtgatePort = ports.get()
+	return cluster, nil
+}
+
+// Tablets returns the tablets of the cluster.
+func (cluster *Cluster) Tablets() []*Tablet {
+	return cluster.tablets
+}
+
+// VtgateAddr returns the address of vtgate.
+func (cluster *Cluster) VtgateAddr() string {
+	return fmt.Sprintf("localhost:%v", cluster.vtgatePort)
+}
+
+// ZkAddr returns the address of zookeeper.
+func (cluster *Cluster) ZkAddr() string {
+	return fmt.Sprintf("localhost:%v", cluster.zkPorts[2])
+}
+
+// ZkClientConfig returns the zookeeper client configuration of the
+// cluster, that ZK_CLIENT_CONFIG has to name to reach its topology.
+func (cluster *Cluster) ZkClientConfig() string {
+	return path.Join(cluster.options.LogDir, "zk-client-conf.json")
+}
+
+// Start launches the cluster, and returns once vtgate serves. If a
+// step fails, what was started is torn down.
+func (cluster *Cluster) Start() (err error) {
+	defer func() {
+		if err != nil {
+			log.Errorf("cannot start the cluster: %v", err)
+			cluster.TearDown()
+		}
+	}()
+
+	if err := os.MkdirAll(cluster.options.LogDir, 0775); err != nil {
+		return err
+	}
+	if err := cluster.startZk(); err != nil {
+		return err
+	}
+	if err := cluster.eachTablet(func(tablet *Tablet) error {
+		return cluster.mysqlctl(tablet, "-port", fmt.Sprint(tablet.Port), "-mysql-port", fmt.Sprint(tablet.MysqlPort), "init")
+	}); err != nil {
+		return err
+	}
+	if err := cluster.initTopology(); err != nil {
+		return err
+	}
+	if err := cluster.eachTablet(cluster.startVttablet); err != nil {
+		return err
+	}
+	if err := cluster.initKeyspaces(); err != nil {
+		return err
+	}
+	return cluster.startVtgate()
+}
+
+// TearDown stops all the processes of the cluster, and removes the
+// data of its mysqlds and of zookeeper.
+func (cluster *Cluster) TearDown() error {
+	allErrors := new(concurrency.AllErrorRecorder)
+	cluster.mu.Lock()
+	for _, cmd := range cluster.processes {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	cluster.processes = nil
+	cluster.mu.Unlock()
+
+	allErrors.RecordError(cluster.eachTablet(func(tablet *Tablet) error {
+		return cluster.mysqlctl(tablet, "teardown", "-force")
+	}))
+	allErrors.RecordError(cluster.run("zkctl", cluster.zkctlArgs("teardown")...))
+	return allErrors.Error()
+}
+
+// env returns the environment of the processes of the cluster.
+func (cluster *Cluster) env() []string {
+	return append(os.Environ(), "ZK_CLIENT_CONFIG="+cluster.ZkClientConfig())
+}
+
+// run runs a binary of $VTROOT/bin, and waits for it.
+func (cluster *Cluster) run(name string, args ...string) error {
+	args = append([]string{"-log_dir", cluster.options.LogDir}, args...)
+	cmd := exec.Command(path.Join(cluster.vtRoot, "bin", name), args...)
+	cmd.Env = cluster.env()
+	log.Infof("vttest: running %v %v", name, strings.Join(args, " "))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v %v failed: %v, %s", name, strings.Join(args, " "), err, output)
+	}
+	return nil
+}
+
+// start starts a binary of $VTROOT/bin, that runs until TearDown.
+// Its output goes to a file of the log directory.
+func (cluster *Cluster) start(logName, name string, args ...string) error {
+	args = append([]string{"-log_dir", cluster.options.LogDir}, args...)
+	output, err := os.Create(path.Join(cluster.options.LogDir, logName+".out"))
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	cmd := exec.Command(path.Join(cluster.vtRoot, "bin", name), args...)
+	cmd.Env = cluster.env()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	log.Infof("vttest: starting %v %v", name, strings.Join(args, " "))
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("cannot start %v: %v", name, err)
+	}
+	cluster.mu.Lock()
+	cluster.processes = append(cluster.processes, cmd)
+	cluster.mu.Unlock()
+	return nil
+}
+
+// eachTablet calls f for all the tablets, in parallel.
+func (cluster *Cluster) eachTablet(f func(tablet *Tablet) error) error {
+	wg := sync.WaitGroup{}
+	allErrors := new(concurrency.AllErrorRecorder)
+	for _, tablet := range cluster.tablets {
+		wg.Add(1)
+		go func(tablet *Tablet) {
+			defer wg.Done()
+			allErrors.RecordError(f(tablet))
+		}(tablet)
+	}
+	wg.Wait()
+	return allErrors.Error()
+}
+
+func (cluster *Cluster) zkctlArgs(action string) []string {
+	return []string{"-zk.cfg", fmt.Sprintf("1@localhost:%v:%v:%v", cluster.zkPorts[0], cluster.zkPorts[1], cluster.zkPorts[2]), action}
+}
+
+// startZk starts zookeeper, and writes the client configuration
+// that maps the cell and the global topology to it.
+func (cluster *Cluster) startZk() error {
+	if err := cluster.run("zkctl", cluster.zkctlArgs("init")...); err != nil {
+		return err
+	}
+	data, err := json.Marshal(map[string]string{
+		cluster.topology.Cell: cluster.ZkAddr(),
+		"global":              cluster.ZkAddr(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(cluster.ZkClientConfig(), data, 0664); err != nil {
+		return err
+	}
+	return cluster.run("zk", "touch", "-p", fmt.Sprintf("/zk/%v/vt", cluster.topology.Cell))
+}
+
+func (cluster *Cluster) mysqlctl(tablet *Tablet, args ...string) error {
+	return cluster.run("mysqlctl", append([]string{"-tablet-uid", fmt.Sprint(tablet.Alias.Uid)}, args...)...)
+}
+
+func (cluster *Cluster) vtctl(args ...string) error {
+	return cluster.run("vtctl", args...)
+}
+
+// initTopology creates the keyspaces and the tablets in the
+// topology, builds the serving graph, and creates the databases.
+func (cluster *Cluster) initTopology() error {
+	for _, keyspace := range cluster.topology.Keyspaces {
+		if err := cluster.vtctl("CreateKeyspace", keyspace.Name); err != nil {
+			return err
+		}
+	}
+	for _, tablet := range cluster.tablets {
+		if err := cluster.vtctl("InitTablet", "-force", "-parent", tablet.Alias.String(), "localhost", fmt.Sprint(tablet.MysqlPort), fmt.Sprint(tablet.Port), tablet.Keyspace, tablet.Shard, string(tablet.Type)); err != nil {
+			return err
+		}
+	}
+	for _, keyspace := range cluster.topology.Keyspaces {
+		for _, shard := range keyspace.Shards {
+			if err := cluster.vtctl("RebuildShardGraph", fmt.Sprintf("/zk/global/vt/keyspaces/%v/shards/%v", keyspace.Name, shard)); err != nil {
+				return err
+			}
+		}
+		if err := cluster.vtctl("RebuildKeyspaceGraph", keyspace.Name); err != nil {
+			return err
+		}
+	}
+	return cluster.eachTablet(func(tablet *Tablet) error {
+		mysqld := mysqlctl.NewMysqld(mysqlctl.NewMycnf(tablet.Alias.Uid, tablet.MysqlPort, mysqlctl.VtReplParams{}), mysql.ConnectionParams{}, mysql.ConnectionParams{})
+		if err := mysqld.ExecuteMysqlCommand("create database if not exists " + tablet.DbName()); err != nil {
+			return fmt.Errorf("cannot create database %v on %v: %v", tablet.DbName(), tablet.Alias, err)
+		}
+		return nil
+	})
+}
+
+// vttabletArgs returns the command line of the vttablet of tablet.
+func (cluster *Cluster) vttabletArgs(tablet *Tablet) []string {
+	args := []string{
+		"-port", fmt.Sprint(tablet.Port),
+		"-tablet-path", tablet.Alias.String(),
+	}
+	for _, name := range []string{"app", "dba", "repl"} {
+		args = append(args,
+			"-db-config-"+name+"-uname", "vt_"+name,
+			"-db-config-"+name+"-charset", "utf8",
+			"-db-config-"+name+"-dbname", tablet.DbName(),
+		)
+	}
+	return args
+}
+
+func (cluster *Cluster) startVttablet(tablet *Tablet) error {
+	if err := cluster.start(fmt.Sprintf("vttablet-%v", tablet.Alias.Uid), "vttablet", cluster.vttabletArgs(tablet)...); err != nil {
+		return err
+	}
+	return waitForVars(tablet.Port, func(vars map[string]interface{}) bool {
+		return vars["TabletStateName"] == "SERVING"
+	})
+}
+
+// initKeyspaces elects the masters, and applies the schemas and the
+// vschemas.
+func (cluster *Cluster) initKeyspaces() error {
+	for _, tablet := range cluster.tablets {
+		if tablet.Type != topo.TYPE_MASTER {
+			continue
+		}
+		if err := cluster.vtctl("ReparentShard", "-force", tablet.Keyspace+"/"+tablet.Shard, tablet.Alias.String()); err != nil {
+			return err
+		}
+	}
+	for _, keyspace := range cluster.topology.Keyspaces {
+		if keyspace.Schema != "" {
+			if err := cluster.vtctl("ApplySchemaKeyspace", "-simple", "-sql", keyspace.Schema, keyspace.Name); err != nil {
+				return err
+			}
+		}
+		if keyspace.VSchema != nil {
+			data, err := json.Marshal(keyspace.VSchema)
+			if err != nil {
+				return err
+			}
+			if err := cluster.vtctl("ApplyVSchema", "-vschema", string(data), keyspace.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (cluster *Cluster) startVtgate() error {
+	if err := cluster.start("vtgate", "vtgate", "-port", fmt.Sprint(cluster.vtgatePort), "-cell", cluster.topology.Cell); err != nil {
+		return err
+	}
+	return waitForVars(cluster.vtgatePort, func(vars map[string]interface{}) bool {
+		return true
+	})
+}
+
+// waitForVars waits until the /debug/vars of the process serving on
+// port satisfy ready, for up to StartTimeout.
+func waitForVars(port int, ready func(vars map[string]interface{}) bool) error {
+	url := fmt.Sprintf("http://localhost:%v/debug/vars", port)
+	deadline := time.Now().Add(StartTimeout)
+	for {
+		if vars, err := getVars(url); err == nil && ready(vars) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for %v", url)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func getVars(url string) (map[string]interface{}, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	vars := make(map[string]interface{})
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
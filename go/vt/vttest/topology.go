@@ -0,0 +1,165 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vttest
+
+import (
+	"fmt"
+	"net"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// This file contains the declarative description of a test cluster,
+// and the assignment of its tablet uids and ports.
+
+// Topology describes the keyspaces of a test cluster. All the
+// processes run on the local machine, in a single cell.
+type Topology struct {
+	// Cell is the name of the cell, "test" if empty.
+	Cell string
+
+	Keyspaces []*Keyspace
+}
+
+// Keyspace describes a keyspace of a test cluster.
+type Keyspace struct {
+	Name string
+
+	// Shards are the names of the shards: "0" for an unsharded
+	// keyspace, or key ranges like "-80" and "80-".
+	Shards []string
+
+	// Replicas and Rdonlys are the numbers of replica and rdonly
+	// tablets of each shard, besides its master.
+	Replicas int
+	Rdonlys  int
+
+	// Schema is applied to the masters of the keyspace once the
+	// cluster is up, if set. The statements are separated by
+	// semicolons.
+	Schema string
+
+	// VSchema is saved in the topology, if set.
+	VSchema *topo.VSchema
+}
+
+// Options are the settings of a test cluster that do not depend on
+// its topology.
+type Options struct {
+	// PortBase is the first port used by the cluster. The ports
+	// after it are assigned to zookeeper, to the tablets and
+	// mysqlds, then to vtgate. The ports that are in use when the
+	// cluster is created are skipped.
+	PortBase int
+
+	// TabletUidBase is the uid of the first tablet. The uids also
+	// name the data directories of the mysqlds in $VTDATAROOT.
+	TabletUidBase uint32
+
+	// LogDir receives the logs of the processes, and the
+	// zookeeper client configuration.
+	LogDir string
+}
+
+// Tablet is a tablet of a test cluster.
+type Tablet struct {
+	Alias     topo.TabletAlias
+	Keyspace  string
+	Shard     string
+	Type      topo.TabletType
+	Port      int
+	MysqlPort int
+}
+
+// DbName returns the name of the database of the tablet.
+func (tablet *Tablet) DbName() string {
+	return "vt_" + tablet.Keyspace
+}
+
+// validate checks the topology, and fills in the defaults.
+func (topology *Topology) validate() error {
+	if topology.Cell == "" {
+		topology.Cell = "test"
+	}
+	if len(topology.Keyspaces) == 0 {
+		return fmt.Errorf("topology has no keyspace")
+	}
+	names := make(map[string]bool)
+	for _, keyspace := range topology.Keyspaces {
+		if keyspace.Name == "" || names[keyspace.Name] {
+			return fmt.Errorf("topology has a keyspace with an empty or duplicate name")
+		}
+		names[keyspace.Name] = true
+		if len(keyspace.Shards) == 0 {
+			return fmt.Errorf("keyspace %v has no shard", keyspace.Name)
+		}
+		if keyspace.Replicas < 0 || keyspace.Rdonlys < 0 {
+			return fmt.Errorf("keyspace %v has a negative number of tablets", keyspace.Name)
+		}
+		if keyspace.VSchema != nil {
+			if err := keyspace.VSchema.Validate(); err != nil {
+				return fmt.Errorf("keyspace %v: %v", keyspace.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// portAllocator hands out consecutive ports, skipping the ones that
+// are in use.
+type portAllocator struct {
+	next int
+}
+
+func (pa *portAllocator) get() int {
+	for !portFree(pa.next) {
+		log.Infof("vttest: port %v is in use, skipping it", pa.next)
+		pa.next++
+	}
+	port := pa.next
+	pa.next++
+	return port
+}
+
+// portFree returns true if nothing listens on port, on any address.
+func portFree(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%v", port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// tablets returns the tablets of the topology, with their uids and
+// ports. The master of each shard comes first.
+func (topology *Topology) tablets(uidBase uint32, ports *portAllocator) []*Tablet {
+	var tablets []*Tablet
+	uid := uidBase
+	for _, keyspace := range topology.Keyspaces {
+		types := []topo.TabletType{topo.TYPE_MASTER}
+		for i := 0; i < keyspace.Replicas; i++ {
+			types = append(types, topo.TYPE_REPLICA)
+		}
+		for i := 0; i < keyspace.Rdonlys; i++ {
+			types = append(types, topo.TYPE_RDONLY)
+		}
+		for _, shard := range keyspace.Shards {
+			for _, tabletType := range types {
+				tablets = append(tablets, &Tablet{
+					Alias:     topo.TabletAlias{Cell: topology.Cell, Uid: uid},
+					Keyspace:  keyspace.Name,
+					Shard:     shard,
+					Type:      tabletType,
+					Port:      ports.get(),
+					MysqlPort: ports.get(),
+				})
+				uid++
+			}
+		}
+	}
+	return tablets
+}
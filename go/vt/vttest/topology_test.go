@@ -0,0 +1,138 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vttest
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/env"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func TestTopologyValidate(t *testing.T) {
+	testCases := []struct {
+		topology *Topology
+		err      string
+	}{
+		{&Topology{}, "no keyspace"},
+		{&Topology{Keyspaces: []*Keyspace{{Shards: []string{"0"}}}}, "empty or duplicate name"},
+		{&Topology{Keyspaces: []*Keyspace{{Name: "ks", Shards: []string{"0"}}, {Name: "ks", Shards: []string{"0"}}}}, "empty or duplicate name"},
+		{&Topology{Keyspaces: []*Keyspace{{Name: "ks"}}}, "no shard"},
+		{&Topology{Keyspaces: []*Keyspace{{Name: "ks", Shards: []string{"0"}, Replicas: -1}}}, "negative number"},
+		{&Topology{Keyspaces: []*Keyspace{{Name: "ks", Shards: []string{"0"}, VSchema: &topo.VSchema{Sharded: true, Tables: map[string]*topo.VSchemaTable{"t": {}}}}}}, "no sharding key"},
+	}
+	for _, tc := range testCases {
+		if err := tc.topology.validate(); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("validate(%#v): want error %q, got %v", tc.topology, tc.err, err)
+		}
+	}
+
+	topology := &Topology{Keyspaces: []*Keyspace{{Name: "ks", Shards: []string{"0"}}}}
+	if err := topology.validate(); err != nil || topology.Cell != "test" {
+		t.Errorf("validate: got cell %q, %v", topology.Cell, err)
+	}
+}
+
+func TestNewCluster(t *testing.T) {
+	defer os.Setenv("VTROOT", os.Getenv("VTROOT"))
+	os.Setenv("VTROOT", "/vt")
+
+	cluster, err := NewCluster(&Topology{
+		Cell: "nj",
+		Keyspaces: []*Keyspace{
+			{Name: "user", Shards: []string{"-80", "80-"}, Replicas: 1},
+			{Name: "lookup", Shards: []string{"0"}, Rdonlys: 1},
+		},
+	}, Options{PortBase: 1000, TabletUidBase: 10, LogDir: "/tmp/vttest"})
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	want := []*Tablet{
+		{topo.TabletAlias{Cell: "nj", Uid: 10}, "user", "-80", topo.TYPE_MASTER, 1003, 1004},
+		{topo.TabletAlias{Cell: "nj", Uid: 11}, "user", "-80", topo.TYPE_REPLICA, 1005, 1006},
+		{topo.TabletAlias{Cell: "nj", Uid: 12}, "user", "80-", topo.TYPE_MASTER, 1007, 1008},
+		{topo.TabletAlias{Cell: "nj", Uid: 13}, "user", "80-", topo.TYPE_REPLICA, 1009, 1010},
+		{topo.TabletAlias{Cell: "nj", Uid: 14}, "lookup", "0", topo.TYPE_MASTER, 1011, 1012},
+		{topo.TabletAlias{Cell: "nj", Uid: 15}, "lookup", "0", topo.TYPE_RDONLY, 1013, 1014},
+	}
+	if !reflect.DeepEqual(cluster.Tablets(), want) {
+		t.Errorf("Tablets: got %v, want %v", cluster.Tablets(), want)
+	}
+	if cluster.ZkAddr() != "localhost:1002" || cluster.VtgateAddr() != "localhost:1015" {
+		t.Errorf("got zk %v and vtgate %v", cluster.ZkAddr(), cluster.VtgateAddr())
+	}
+	if want := "/tmp/vttest/zk-client-conf.json"; cluster.ZkClientConfig() != want {
+		t.Errorf("ZkClientConfig: got %v, want %v", cluster.ZkClientConfig(), want)
+	}
+	if want := []string{"-zk.cfg", "1@localhost:1000:1001:1002", "init"}; !reflect.DeepEqual(cluster.zkctlArgs("init"), want) {
+		t.Errorf("zkctlArgs: got %v, want %v", cluster.zkctlArgs("init"), want)
+	}
+
+	args := strings.Join(cluster.vttabletArgs(want[4]), " ")
+	for _, arg := range []string{"-port 1011", "-tablet-path nj-0000000014", "-db-config-app-dbname vt_lookup", "-db-config-repl-uname vt_repl"} {
+		if !strings.Contains(args, arg) {
+			t.Errorf("vttabletArgs: %v is missing %v", args, arg)
+		}
+	}
+}
+
+func TestPortAllocator(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+	used := l.Addr().(*net.TCPAddr).Port
+	ports := &portAllocator{next: used}
+	if port := ports.get(); port <= used {
+		t.Errorf("got port %v, want a port after %v, which is in use", port, used)
+	}
+}
+
+func TestClusterStartTearDown(t *testing.T) {
+	vtRoot, err := env.VtRoot()
+	if err != nil {
+		t.Skipf("skipping: %v", err)
+	}
+	for _, name := range []string{"zkctl", "zk", "mysqlctl", "vtctl", "vttablet", "vtgate"} {
+		if _, err := os.Stat(path.Join(vtRoot, "bin", name)); err != nil {
+			t.Skipf("skipping: %v", err)
+		}
+	}
+	cluster, err := NewCluster(&Topology{
+		Keyspaces: []*Keyspace{{
+			Name:   "test_keyspace",
+			Shards: []string{"0"},
+			Schema: "create table t(id bigint, primary key(id))",
+		}},
+	}, Options{})
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+
+	if err := cluster.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := getVars(fmt.Sprintf("http://%v/debug/vars", cluster.VtgateAddr())); err != nil {
+		t.Errorf("vtgate does not serve: %v", err)
+	}
+	if err := cluster.TearDown(); err != nil {
+		t.Errorf("TearDown: %v", err)
+	}
+	if _, err := getVars(fmt.Sprintf("http://%v/debug/vars", cluster.VtgateAddr())); err == nil {
+		t.Errorf("vtgate still serves after TearDown")
+	}
+	for _, tablet := range cluster.Tablets() {
+		if !portFree(tablet.MysqlPort) {
+			t.Errorf("the mysqld of %v still runs after TearDown", tablet.Alias)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package vttls builds the TLS configurations used by the vitess
+// servers and clients, from certificate, key and CA files.
+package vttls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// loadCertPool returns a pool with the certificates of the PEM file.
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pemCerts, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemCerts) {
+		return nil, fmt.Errorf("no certificate found in %v", caFile)
+	}
+	return pool, nil
+}
+
+// ServerConfig returns the TLS configuration of a server using the
+// given certificate and key. If caFile is set, clients have to
+// present a certificate signed by one of its authorities.
+func ServerConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if caFile != "" {
+		if config.ClientCAs, err = loadCertPool(caFile); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// ClientConfig returns the TLS configuration of a client. If caFile
+// is set, the server certificate is verified against it (and
+// serverName, if set), otherwise it is not verified at all. If
+// certFile and keyFile are set, they are presented to the server.
+func ClientConfig(certFile, keyFile, caFile, serverName string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: serverName}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		var err error
+		if config.RootCAs, err = loadCertPool(caFile); err != nil {
+			return nil, err
+		}
+	} else {
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
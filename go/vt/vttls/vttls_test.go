@@ -0,0 +1,118 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vttls
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// createCert creates a certificate signed by parent (self-signed if
+// parent is nil), and writes it and its key in dir.
+func createCert(t *testing.T, dir, name string, isCA bool, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		DNSNames:              []string{name},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(path.Join(dir, name+"-cert.pem"), certPEM, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, name+"-key.pem"), keyPEM, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return cert, key
+}
+
+// handshake runs a TLS handshake between a client and a server
+// using the configurations, and returns the client error.
+func handshake(serverConfig, clientConfig *tls.Config) error {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		server := tls.Server(serverConn, serverConfig)
+		server.Handshake()
+		server.Close()
+	}()
+	client := tls.Client(clientConn, clientConfig)
+	return client.Handshake()
+}
+
+func TestClientServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vttls_test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey := createCert(t, dir, "ca", true, nil, nil)
+	createCert(t, dir, "server", false, ca, caKey)
+	createCert(t, dir, "client", false, ca, caKey)
+	createCert(t, dir, "other", true, nil, nil)
+	file := func(name string) string { return path.Join(dir, name) }
+
+	serverConfig, err := ServerConfig(file("server-cert.pem"), file("server-key.pem"), file("ca-cert.pem"))
+	if err != nil {
+		t.Fatalf("ServerConfig: %v", err)
+	}
+
+	// verified server, with a client certificate
+	clientConfig, err := ClientConfig(file("client-cert.pem"), file("client-key.pem"), file("ca-cert.pem"), "server")
+	if err != nil {
+		t.Fatalf("ClientConfig: %v", err)
+	}
+	if err := handshake(serverConfig, clientConfig); err != nil {
+		t.Errorf("handshake with valid certificates failed: %v", err)
+	}
+
+	// the server certificate is not signed by the client CA
+	clientConfig, err = ClientConfig(file("client-cert.pem"), file("client-key.pem"), file("other-cert.pem"), "server")
+	if err != nil {
+		t.Fatalf("ClientConfig: %v", err)
+	}
+	if err := handshake(serverConfig, clientConfig); err == nil {
+		t.Errorf("handshake with an unknown server CA should have failed")
+	}
+
+	if _, err := ServerConfig(file("server-cert.pem"), file("server-key.pem"), file("missing.pem")); err == nil {
+		t.Errorf("ServerConfig with a missing CA file should have failed")
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/jscfg"
+)
+
+// Resumable is implemented by workers that can save their progress
+// and be restarted from it after vtworker was restarted.
+type Resumable interface {
+	Worker
+
+	// CheckpointState returns the worker-specific state to
+	// save. It has to be JSON-serializable.
+	CheckpointState() interface{}
+
+	// RestoreCheckpoint is called before Run with the data
+	// previously returned by CheckpointState.
+	RestoreCheckpoint(data json.RawMessage) error
+}
+
+// Checkpoint is what is saved on disk: enough to re-create the
+// worker (the vtworker command and its arguments), and the worker
+// specific state.
+type Checkpoint struct {
+	Command string
+	Args    []string
+	Time    time.Time
+	State   json.RawMessage
+}
+
+// CheckpointStore saves and loads a Checkpoint in a file. A nil
+// *CheckpointStore is valid, and does nothing.
+type CheckpointStore struct {
+	mu       sync.Mutex
+	filename string
+	command  string
+	args     []string
+}
+
+// NewCheckpointStore returns a CheckpointStore using the given
+// file. It returns nil if filename is empty.
+func NewCheckpointStore(filename string) *CheckpointStore {
+	if filename == "" {
+		return nil
+	}
+	return &CheckpointStore{filename: filename}
+}
+
+// SetCommand remembers the command that created the current worker,
+// so it is saved along with the worker state.
+func (cs *CheckpointStore) SetCommand(command string, args []string) {
+	if cs == nil {
+		return
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.command = command
+	cs.args = args
+}
+
+// Save writes the current state of the worker, if it is Resumable.
+func (cs *CheckpointStore) Save(wrk Worker) error {
+	if cs == nil {
+		return nil
+	}
+	r, ok := wrk.(Resumable)
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(r.CheckpointState())
+	if err != nil {
+		return fmt.Errorf("cannot marshal checkpoint state: %v", err)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return jscfg.WriteJson(cs.filename, &Checkpoint{
+		Command: cs.command,
+		Args:    cs.args,
+		Time:    time.Now(),
+		State:   json.RawMessage(data),
+	})
+}
+
+// Load returns the saved checkpoint, or nil if there is none.
+func (cs *CheckpointStore) Load() (*Checkpoint, error) {
+	if cs == nil {
+		return nil, nil
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if _, err := os.Stat(cs.filename); os.IsNotExist(err) {
+		return nil, nil
+	}
+	cp := &Checkpoint{}
+	if err := jscfg.ReadJson(cs.filename, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Clear removes the checkpoint, once the worker is done.
+func (cs *CheckpointStore) Clear() error {
+	if cs == nil {
+		return nil
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err := os.Remove(cs.filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
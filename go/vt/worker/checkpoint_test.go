@@ -0,0 +1,100 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckpointStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cs := NewCheckpointStore(path.Join(dir, "checkpoint.json"))
+
+	// nothing saved yet
+	if cp, err := cs.Load(); err != nil || cp != nil {
+		t.Fatalf("Load on empty store: %v %v", cp, err)
+	}
+
+	// save a worker half way through
+	sw := NewSleepWorker(10 * time.Second)
+	sw.progress.Set(4)
+	cs.SetCommand("Sleep", []string{"10s"})
+	if err := cs.Save(sw); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// and restore it in a new one
+	cp, err := cs.Load()
+	if err != nil || cp == nil {
+		t.Fatalf("Load failed: %v %v", cp, err)
+	}
+	if cp.Command != "Sleep" || !reflect.DeepEqual(cp.Args, []string{"10s"}) {
+		t.Errorf("unexpected command: %v %v", cp.Command, cp.Args)
+	}
+	restored := NewSleepWorker(10 * time.Second)
+	if err := restored.RestoreCheckpoint(cp.State); err != nil {
+		t.Fatalf("RestoreCheckpoint failed: %v", err)
+	}
+	if restored.progress.Done() != 4 {
+		t.Errorf("unexpected restored progress: %v", restored.progress)
+	}
+
+	// clearing twice is fine
+	for i := 0; i < 2; i++ {
+		if err := cs.Clear(); err != nil {
+			t.Fatalf("Clear failed: %v", err)
+		}
+	}
+	if cp, err := cs.Load(); err != nil || cp != nil {
+		t.Fatalf("Load after Clear: %v %v", cp, err)
+	}
+
+	// a nil store does nothing
+	var nilStore *CheckpointStore
+	if err := nilStore.Save(sw); err != nil {
+		t.Errorf("nil Save failed: %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	sw := NewSleepWorker(time.Hour)
+	go sw.Cancel()
+	if err := sw.Run(); err != ErrInterrupted {
+		t.Fatalf("unexpected Run result: %v", err)
+	}
+	if sw.State() != WorkerStateCanceled {
+		t.Errorf("unexpected state: %v", sw.State())
+	}
+	// a second Cancel is fine
+	sw.Cancel()
+}
+
+func TestProgress(t *testing.T) {
+	p := &Progress{Name: "rows", total: 200, startTime: time.Now()}
+	if p.Percent() != 0 {
+		t.Errorf("unexpected initial percent: %v", p.Percent())
+	}
+	p.Add(50)
+	if p.Percent() != 25 {
+		t.Errorf("unexpected percent: %v", p.Percent())
+	}
+	p.Set(300)
+	if p.Percent() != 100 || p.ETA() != 0 {
+		t.Errorf("unexpected percent / ETA: %v %v", p.Percent(), p.ETA())
+	}
+	unknown := &Progress{Name: "rows"}
+	if unknown.Percent() != -1 || unknown.String() != "rows: 0" {
+		t.Errorf("unexpected unknown progress: %v %v", unknown.Percent(), unknown)
+	}
+}
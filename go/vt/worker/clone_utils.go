@@ -0,0 +1,413 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// This file contains utility functions shared by the clone and diff
+// workers: splitting tables into chunks, reading them, and routing
+// and writing rows.
+
+const (
+	// fetchTimeout is how long we wait for a single chunk read
+	// or write on a tablet.
+	fetchTimeout = 5 * time.Minute
+
+	// maxRowsPerChunk is the maximum number of rows a chunk read
+	// can return. Bigger tables should use more chunks.
+	maxRowsPerChunk = 1000000
+
+	// tableStatsBucketsPerChunk is how many histogram buckets we
+	// ask the source tablet for, per chunk, to balance the chunks.
+	tableStatsBucketsPerChunk = 4
+
+	// maxTableStatsBuckets caps the number of index dives the
+	// source tablet does for a table.
+	maxTableStatsBuckets = 256
+)
+
+// CopyConfig has the parameters used by the clone workers to copy
+// data from sources to destinations.
+type CopyConfig struct {
+	// SourceReaderCount is how many chunks are read concurrently.
+	SourceReaderCount int
+
+	// SourceRdonlyCount is how many rdonly tablets of the source
+	// shard the chunks are read from. They are all stopped at the
+	// same replication position.
+	SourceRdonlyCount int
+
+	// DestinationWriterCount is how many INSERTs are run
+	// concurrently on each destination.
+	DestinationWriterCount int
+
+	// InsertBatchSize is the maximum number of rows per INSERT.
+	InsertBatchSize int
+
+	// MinTableSizeForSplit is the minimum table size (in bytes) to
+	// split it into chunks.
+	MinTableSizeForSplit uint64
+
+	// MaxChunkSize is the maximum size (in bytes) of a chunk. Big
+	// tables are split in more than SourceReaderCount chunks so
+	// no chunk is bigger than this.
+	MaxChunkSize uint64
+
+	// MaxChunksPerSecond throttles the chunk reads, i.e. the
+	// queries on the source, 0 means unlimited.
+	MaxChunksPerSecond int
+
+	// MaxWritesPerSecond throttles the INSERTs on each
+	// destination, 0 means unlimited.
+	MaxWritesPerSecond int
+
+	// MaxReplicationLag pauses the copy while a serving slave of
+	// a destination shard is more than this many seconds behind
+	// its master, 0 means the lag is not monitored.
+	MaxReplicationLag uint
+
+	// Resume continues a copy that died, using the copy state
+	// saved on the destinations, see copy_state.go.
+	Resume bool
+}
+
+// RegisterCopyFlags registers the command line flags for a CopyConfig.
+func RegisterCopyFlags(subFlags *flag.FlagSet, config *CopyConfig) {
+	subFlags.IntVar(&config.SourceReaderCount, "source-reader-count", 10, "number of concurrent chunk readers on the source")
+	subFlags.IntVar(&config.SourceRdonlyCount, "source-rdonly-count", 1, "number of source rdonly tablets to read the chunks from, stopped at the same replication position")
+	subFlags.IntVar(&config.DestinationWriterCount, "destination-writer-count", 20, "number of concurrent INSERTs on each destination")
+	subFlags.IntVar(&config.InsertBatchSize, "insert-batch-size", 100, "maximum number of rows per INSERT")
+	subFlags.Uint64Var(&config.MinTableSizeForSplit, "min-table-size-for-split", 1024*1024, "tables bigger than this (in bytes) are read in multiple chunks")
+	subFlags.Uint64Var(&config.MaxChunkSize, "max-chunk-size", 64*1024*1024, "maximum size (in bytes) of a chunk")
+	subFlags.IntVar(&config.MaxChunksPerSecond, "max-chunks-per-second", 0, "maximum number of chunks read per second on the source (0 for unlimited)")
+	subFlags.IntVar(&config.MaxWritesPerSecond, "max-writes-per-second", 0, "maximum number of INSERTs per second on each destination (0 for unlimited)")
+	subFlags.BoolVar(&config.Resume, "resume", false, "resume a copy that died, skipping the chunks already copied")
+	subFlags.UintVar(&config.MaxReplicationLag, "max-replication-lag", 0, "pause the copy while the destination slaves are more than this many seconds behind (0 to not check)")
+}
+
+// chunk is a [Start, End) interval of the first primary key column
+// of a table. Start and End are SQL literals, an empty value means
+// the interval is unbounded on that side.
+type chunk struct {
+	Start string
+	End   string
+}
+
+func (c chunk) String() string {
+	return fmt.Sprintf("[%v,%v)", c.Start, c.End)
+}
+
+// findChunks returns the chunks to use to read a table in parallel.
+// It splits the table in at least minChunkCount chunks on its first
+// primary key column, and more if that would make any chunk bigger
+// than maxChunkSize. If the table is smaller than
+// minTableSizeForSplit, or its first primary key column is not an
+// integer, it returns a single chunk covering the whole table.
+// The chunk boundaries are balanced with the table statistics of the
+// tablet, and fall back to an uniform split of [min, max] if they're
+// not available.
+func findChunks(wr *wrangler.Wrangler, ti *topo.TabletInfo, td *mysqlctl.TableDefinition, minTableSizeForSplit, maxChunkSize uint64, minChunkCount int) ([]chunk, error) {
+	result := []chunk{chunk{}}
+	if len(td.PrimaryKeyColumns) == 0 || td.DataLength < minTableSizeForSplit {
+		return result, nil
+	}
+	chunkCount := int64(minChunkCount)
+	if maxChunkSize > 0 {
+		if c := int64(td.DataLength / maxChunkSize); c > chunkCount {
+			chunkCount = c
+		}
+	}
+	if chunkCount <= 1 {
+		return result, nil
+	}
+
+	bucketCount := int(chunkCount) * tableStatsBucketsPerChunk
+	if bucketCount > maxTableStatsBuckets {
+		bucketCount = maxTableStatsBuckets
+	}
+	ts, err := wr.ActionInitiator().GetTableStats(ti, td.Name, bucketCount, fetchTimeout)
+	if err != nil {
+		log.Warningf("cannot get table stats for table %v, using an uniform split: %v", td.Name, err)
+	} else if boundaries := ts.ChunkBoundaries(int(chunkCount)); len(boundaries) > 0 {
+		log.Infof("splitting table %v into %v chunks using %v", td.Name, len(boundaries)+1, ts)
+		return chunksFromBoundaries(boundaries), nil
+	}
+
+	pk := td.PrimaryKeyColumns[0]
+	query := fmt.Sprintf("SELECT MIN(%v), MAX(%v) FROM %v.%v", pk, pk, ti.DbName(), td.Name)
+	qr, err := wr.ActionInitiator().ExecuteFetch(ti, query, 1, false, false, fetchTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get min and max of %v for table %v: %v", pk, td.Name, err)
+	}
+	if len(qr.Rows) != 1 || qr.Rows[0][0].IsNull() || qr.Rows[0][1].IsNull() {
+		log.Infof("not splitting table %v into chunks, it's empty", td.Name)
+		return result, nil
+	}
+	min, err := strconv.ParseInt(qr.Rows[0][0].String(), 10, 64)
+	if err != nil {
+		log.Infof("splitting table %v into chunks by quantiles, %v is not an integer: %v", td.Name, pk, err)
+		return findQuantileChunks(wr, ti, td, chunkCount)
+	}
+	max, err := strconv.ParseInt(qr.Rows[0][1].String(), 10, 64)
+	if err != nil {
+		log.Infof("splitting table %v into chunks by quantiles, %v is not an integer: %v", td.Name, pk, err)
+		return findQuantileChunks(wr, ti, td, chunkCount)
+	}
+	interval := (max - min) / chunkCount
+	if interval == 0 {
+		log.Infof("not splitting table %v into chunks, min and max are too close: %v %v", td.Name, min, max)
+		return result, nil
+	}
+
+	boundaries := make([]int64, chunkCount-1)
+	for i := range boundaries {
+		boundaries[i] = min + interval*int64(i+1)
+	}
+	return chunksFromBoundaries(boundaries), nil
+}
+
+// findQuantileChunks splits a table whose first primary key column is
+// not an integer, a string for instance: the boundaries are the values
+// of the column at regular offsets, in the order (and collation) the
+// chunks are read with. Each boundary costs an index scan up to its
+// offset. There are enough chunks for each of them to be read by a
+// single query.
+func findQuantileChunks(wr *wrangler.Wrangler, ti *topo.TabletInfo, td *mysqlctl.TableDefinition, chunkCount int64) ([]chunk, error) {
+	pk := td.PrimaryKeyColumns[0]
+	table := ti.DbName() + "." + td.Name
+	qr, err := wr.ActionInitiator().ExecuteFetch(ti, "SELECT COUNT(*) FROM "+table, 1, false, false, fetchTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot count the rows of table %v: %v", td.Name, err)
+	}
+	if len(qr.Rows) != 1 {
+		return nil, fmt.Errorf("cannot count the rows of table %v: got %v rows", td.Name, len(qr.Rows))
+	}
+	rowCount, err := qr.Rows[0][0].ParseInt64()
+	if err != nil {
+		return nil, fmt.Errorf("cannot count the rows of table %v: %v", td.Name, err)
+	}
+
+	boundaries := make([]string, 0, chunkCount)
+	for _, offset := range quantileOffsets(rowCount, chunkCount) {
+		query := fmt.Sprintf("SELECT %v FROM %v ORDER BY %v LIMIT %v, 1", pk, table, pk, offset)
+		qr, err := wr.ActionInitiator().ExecuteFetch(ti, query, 1, false, false, fetchTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get the chunk boundaries of table %v: %v", td.Name, err)
+		}
+		if len(qr.Rows) != 1 || qr.Rows[0][0].IsNull() {
+			// rows were deleted since the count
+			break
+		}
+		b := bytes.NewBuffer(nil)
+		qr.Rows[0][0].EncodeSql(b)
+		boundaries = append(boundaries, b.String())
+	}
+	log.Infof("splitting table %v of %v rows into %v chunks by quantiles of %v", td.Name, rowCount, len(boundaries)+1, pk)
+	return chunksFromLiterals(boundaries), nil
+}
+
+// quantileOffsets returns the row offsets of the boundaries that split
+// rowCount rows into chunkCount chunks, or more if the chunks would
+// have more than half of maxRowsPerChunk rows.
+func quantileOffsets(rowCount, chunkCount int64) []int64 {
+	if min := rowCount/(maxRowsPerChunk/2) + 1; min > chunkCount {
+		chunkCount = min
+	}
+	if chunkCount > rowCount {
+		chunkCount = rowCount
+	}
+	if chunkCount <= 1 {
+		return nil
+	}
+	offsets := make([]int64, chunkCount-1)
+	for i := range offsets {
+		offsets[i] = rowCount * int64(i+1) / chunkCount
+	}
+	return offsets
+}
+
+// chunksFromBoundaries returns the len(boundaries)+1 chunks delimited
+// by the increasing boundaries. The first and last chunks are open.
+func chunksFromBoundaries(boundaries []int64) []chunk {
+	literals := make([]string, len(boundaries))
+	for i, b := range boundaries {
+		literals[i] = strconv.FormatInt(b, 10)
+	}
+	return chunksFromLiterals(literals)
+}
+
+// chunksFromLiterals returns the chunks delimited by the
+// non-decreasing SQL literals. The repeated boundaries are skipped, so
+// no chunk is empty.
+func chunksFromLiterals(boundaries []string) []chunk {
+	result := []chunk{chunk{}}
+	for _, b := range boundaries {
+		last := &result[len(result)-1]
+		if b == last.Start {
+			continue
+		}
+		last.End = b
+		result = append(result, chunk{Start: b})
+	}
+	return result
+}
+
+// buildSQLFromChunk returns the query to read a chunk of a table,
+// ordered by the orderBy columns, usually the primary key. where is
+// an optional additional condition.
+func buildSQLFromChunk(dbName string, td *mysqlctl.TableDefinition, columns []string, c chunk, where string, orderBy []string) string {
+	conditions := chunkConditions(td, c)
+	if where != "" {
+		conditions = append(conditions, "("+where+")")
+	}
+
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM " + dbName + "." + td.Name
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if len(orderBy) > 0 {
+		query += " ORDER BY " + strings.Join(orderBy, ", ")
+	}
+	return query
+}
+
+// readChunk reads a chunk of a table from a tablet.
+func readChunk(wr *wrangler.Wrangler, ti *topo.TabletInfo, query string) (*mproto.QueryResult, error) {
+	qr, err := wr.ActionInitiator().ExecuteFetch(ti, query, maxRowsPerChunk, true, false, fetchTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read chunk from %v: %v", ti.Alias, err)
+	}
+	return qr, nil
+}
+
+// RowSplitter splits rows between destination key ranges, using the
+// keyspace id computed by Resolver from the columns at KeyIndexes.
+type RowSplitter struct {
+	KeyRanges  []key.KeyRange
+	Resolver   key.KeyspaceIdResolver
+	KeyIndexes []int
+}
+
+// NewRowSplitter returns a RowSplitter for the given key ranges,
+// resolver and key column indexes.
+func NewRowSplitter(keyRanges []key.KeyRange, resolver key.KeyspaceIdResolver, keyIndexes []int) *RowSplitter {
+	return &RowSplitter{
+		KeyRanges:  keyRanges,
+		Resolver:   resolver,
+		KeyIndexes: keyIndexes,
+	}
+}
+
+// Split returns one list of rows per key range. It is an error to
+// have a row that doesn't belong to any key range.
+func (rs *RowSplitter) Split(rows [][]sqltypes.Value) ([][][]sqltypes.Value, error) {
+	result := make([][][]sqltypes.Value, len(rs.KeyRanges))
+	values := make([][]byte, len(rs.KeyIndexes))
+	for _, row := range rows {
+		for i, index := range rs.KeyIndexes {
+			if row[index].IsNull() {
+				return nil, fmt.Errorf("NULL keyspace id in row %v", row)
+			}
+			// values are all strings once they went through bson
+			values[i] = row[index].Raw()
+		}
+		k, err := rs.Resolver.Resolve(values)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for j, kr := range rs.KeyRanges {
+			if kr.Contains(k) {
+				result[j] = append(result[j], row)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("keyspace id %v is not in any destination key range", k.Hex())
+		}
+	}
+	return result, nil
+}
+
+// makeValueString returns the VALUES part of an INSERT statement
+// for the provided rows.
+func makeValueString(rows [][]sqltypes.Value) string {
+	buf := bytes.Buffer{}
+	for i, row := range rows {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('(')
+		for j, value := range row {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			value.EncodeSql(&buf)
+		}
+		buf.WriteByte(')')
+	}
+	return buf.String()
+}
+
+// chunkConditions returns the conditions on the first primary key
+// column that select the rows of a chunk.
+func chunkConditions(td *mysqlctl.TableDefinition, c chunk) []string {
+	conditions := make([]string, 0, 3)
+	if len(td.PrimaryKeyColumns) > 0 {
+		pk := td.PrimaryKeyColumns[0]
+		if c.Start != "" {
+			conditions = append(conditions, pk+">="+c.Start)
+		}
+		if c.End != "" {
+			conditions = append(conditions, pk+"<"+c.End)
+		}
+	}
+	return conditions
+}
+
+// buildDeleteFromChunk returns the query that deletes the rows of a
+// chunk, to copy it again.
+func buildDeleteFromChunk(dbName string, td *mysqlctl.TableDefinition, c chunk) string {
+	query := "DELETE FROM " + dbName + "." + td.Name
+	if conditions := chunkConditions(td, c); len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return query
+}
+
+// makeInsertQueries returns the INSERT statements to write rows into
+// a table, at most batchSize rows per statement.
+func makeInsertQueries(dbName, tableName string, columns []string, rows [][]sqltypes.Value, batchSize int) []string {
+	if batchSize <= 0 {
+		batchSize = len(rows)
+	}
+	prefix := "INSERT INTO " + dbName + "." + tableName + "(" + strings.Join(columns, ", ") + ") VALUES "
+	result := make([]string, 0, len(rows)/batchSize+1)
+	for len(rows) > 0 {
+		n := batchSize
+		if n > len(rows) {
+			n = len(rows)
+		}
+		result = append(result, prefix+makeValueString(rows[:n]))
+		rows = rows[n:]
+	}
+	return result
+}
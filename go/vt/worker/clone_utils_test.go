@@ -0,0 +1,158 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"reflect"
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+)
+
+func row(values ...string) []sqltypes.Value {
+	result := make([]sqltypes.Value, len(values))
+	for i, v := range values {
+		result[i] = sqltypes.MakeString([]byte(v))
+	}
+	return result
+}
+
+func TestRowSplitter(t *testing.T) {
+	keyRanges := []key.KeyRange{
+		key.KeyRange{Start: key.MinKey, End: key.Uint64Key(0x8000000000000000).KeyspaceId()},
+		key.KeyRange{Start: key.Uint64Key(0x8000000000000000).KeyspaceId(), End: key.MaxKey},
+	}
+	rs := NewRowSplitter(keyRanges, key.NumericResolver{}, []int{1})
+	rows := [][]sqltypes.Value{
+		row("1", "1"),
+		row("2", "9223372036854775808"), // 0x8000000000000000
+		row("3", "18446744073709551615"),
+		row("4", "42"),
+	}
+	split, err := rs.Split(rows)
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	if len(split[0]) != 2 || split[0][0][0].String() != "1" || split[0][1][0].String() != "4" {
+		t.Errorf("unexpected first range: %v", split[0])
+	}
+	if len(split[1]) != 2 || split[1][0][0].String() != "2" || split[1][1][0].String() != "3" {
+		t.Errorf("unexpected second range: %v", split[1])
+	}
+
+	if _, err := rs.Split([][]sqltypes.Value{row("1", "not a number")}); err == nil {
+		t.Errorf("Split should have failed on a bad keyspace id")
+	}
+	if _, err := rs.Split([][]sqltypes.Value{[]sqltypes.Value{sqltypes.MakeString([]byte("1")), sqltypes.Value{}}}); err == nil {
+		t.Errorf("Split should have failed on a NULL keyspace id")
+	}
+
+	// composite keys go through the resolver
+	rs = NewRowSplitter(keyRanges, key.HashResolver{}, []int{1, 2})
+	rows = [][]sqltypes.Value{row("1", "a", "b"), row("2", "c", "d"), row("3", "a", "b")}
+	split, err = rs.Split(rows)
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	kid, _ := key.HashResolver{}.Resolve([][]byte{[]byte("a"), []byte("b")})
+	first := 0
+	if !keyRanges[0].Contains(kid) {
+		first = 1
+	}
+	if len(split[first]) < 2 || split[first][0][0].String() != "1" || split[first][len(split[first])-1][0].String() != "3" {
+		t.Errorf("rows with the same key should be in the same range: %v", split)
+	}
+}
+
+func TestMakeInsertQueries(t *testing.T) {
+	rows := [][]sqltypes.Value{
+		row("1", "a"),
+		row("2", "b'c"),
+		[]sqltypes.Value{sqltypes.MakeNumeric([]byte("3")), sqltypes.Value{}},
+	}
+	queries := makeInsertQueries("vt_db", "t1", []string{"id", "msg"}, rows, 2)
+	want := []string{
+		"INSERT INTO vt_db.t1(id, msg) VALUES ('1','a'),('2','b\\'c')",
+		"INSERT INTO vt_db.t1(id, msg) VALUES (3,null)",
+	}
+	if len(queries) != len(want) {
+		t.Fatalf("unexpected queries: %v", queries)
+	}
+	for i, q := range queries {
+		if q != want[i] {
+			t.Errorf("query %v: got %v want %v", i, q, want[i])
+		}
+	}
+}
+
+func TestBuildSQLFromChunk(t *testing.T) {
+	td := &mysqlctl.TableDefinition{
+		Name:              "t1",
+		Columns:           []string{"id", "msg", "keyspace_id"},
+		PrimaryKeyColumns: []string{"id"},
+	}
+	testCases := []struct {
+		c     chunk
+		where string
+		want  string
+	}{
+		{chunk{}, "", "SELECT id, msg, keyspace_id FROM vt_db.t1 ORDER BY id"},
+		{chunk{"", "10"}, "", "SELECT id, msg, keyspace_id FROM vt_db.t1 WHERE id<10 ORDER BY id"},
+		{chunk{"10", "20"}, "", "SELECT id, msg, keyspace_id FROM vt_db.t1 WHERE id>=10 AND id<20 ORDER BY id"},
+		{chunk{"20", ""}, "keyspace_id>=5", "SELECT id, msg, keyspace_id FROM vt_db.t1 WHERE id>=20 AND (keyspace_id>=5) ORDER BY id"},
+	}
+	for _, tc := range testCases {
+		if got := buildSQLFromChunk("vt_db", td, td.Columns, tc.c, tc.where, td.PrimaryKeyColumns); got != tc.want {
+			t.Errorf("buildSQLFromChunk(%v, %v): got %v want %v", tc.c, tc.where, got, tc.want)
+		}
+	}
+	// a diff sorts the string keys with a binary collation
+	td.PrimaryKeyColumns = []string{"id", "msg"}
+	want := "SELECT id, msg, keyspace_id FROM vt_db.t1 ORDER BY id, BINARY msg"
+	if got := buildSQLFromChunk("vt_db", td, td.Columns, chunk{}, "", diffOrderBy(td, []int64{mproto.VT_LONG, 253})); got != want {
+		t.Errorf("buildSQLFromChunk with a diff order: got %v want %v", got, want)
+	}
+}
+
+func TestChunksFromBoundaries(t *testing.T) {
+	got := chunksFromBoundaries([]int64{10, 20})
+	want := []chunk{{"", "10"}, {"10", "20"}, {"20", ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chunksFromBoundaries: got %v want %v", got, want)
+	}
+	if got := chunksFromBoundaries(nil); !reflect.DeepEqual(got, []chunk{{}}) {
+		t.Errorf("chunksFromBoundaries(nil): got %v", got)
+	}
+}
+
+func TestChunksFromLiterals(t *testing.T) {
+	got := chunksFromLiterals([]string{"'b'", "'b'", "'m'"})
+	want := []chunk{{"", "'b'"}, {"'b'", "'m'"}, {"'m'", ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chunksFromLiterals: got %v want %v", got, want)
+	}
+}
+
+func TestQuantileOffsets(t *testing.T) {
+	testcases := []struct {
+		rowCount, chunkCount int64
+		want                 []int64
+	}{
+		{100, 4, []int64{25, 50, 75}},
+		{3, 10, []int64{1, 2}},
+		{0, 4, nil},
+		{100, 1, nil},
+		// chunks of at most maxRowsPerChunk/2 rows
+		{2 * maxRowsPerChunk, 2, []int64{maxRowsPerChunk * 2 / 5, maxRowsPerChunk * 4 / 5, maxRowsPerChunk * 6 / 5, maxRowsPerChunk * 8 / 5}},
+	}
+	for _, tc := range testcases {
+		if got := quantileOffsets(tc.rowCount, tc.chunkCount); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("quantileOffsets(%v, %v): got %v want %v", tc.rowCount, tc.chunkCount, got, tc.want)
+		}
+	}
+}
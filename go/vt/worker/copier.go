@@ -0,0 +1,435 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/sync2"
+	cc "github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// rowSplitFunc returns the rows to write on each destination master,
+// in the same order as tableCopier.destinationMasters.
+type rowSplitFunc func(rows [][]sqltypes.Value) ([][][]sqltypes.Value, error)
+
+// tableCopier has the logic shared by the clone workers. It copies
+// tables from stopped rdonly tablets in a source shard to the
+// masters of destination shards, and then sets up filtered
+// replication from the source shard to the destination shards.
+type tableCopier struct {
+	sw     *StatusWorker
+	wr     *wrangler.Wrangler
+	config CopyConfig
+
+	// populated by findSources. The chunks are read from all the
+	// sourceTablets, stopped at sourcePosition. sourceTablet is
+	// the first one, used for the schema and the chunk boundaries.
+	sourceTablet       *topo.TabletInfo
+	sourceTablets      []*topo.TabletInfo
+	sourcePosition     *mysqlctl.ReplicationPosition
+	sourcesChangedType []*topo.TabletInfo
+	sourcesStopped     []*topo.TabletInfo
+
+	// keepSourcesStopped is set if the copy, or the set up of
+	// filtered replication after it, failed after saving the copy
+	// state, so it can be resumed
+	keepSourcesStopped bool
+
+	// populated by the worker
+	destinationMasters []*topo.TabletInfo
+
+	// populated by resumeSources or copy
+	state *copyState
+
+	// populated by copy
+	tablesProgress *Progress
+	chunksProgress *Progress
+	rowsProgress   *Progress
+}
+
+func newTableCopier(sw *StatusWorker, wr *wrangler.Wrangler, config CopyConfig) *tableCopier {
+	return &tableCopier{
+		sw:     sw,
+		wr:     wr,
+		config: config,
+	}
+}
+
+// sourcesDescription returns the aliases of the source tablets.
+func (tc *tableCopier) sourcesDescription() string {
+	aliases := make([]string, len(tc.sourceTablets))
+	for i, ti := range tc.sourceTablets {
+		aliases[i] = ti.Alias.String()
+	}
+	return strings.Join(aliases, ", ")
+}
+
+// findSources finds the source rdonly tablets in keyspace/shard, and
+// stops them. When resuming, it uses the sources of the saved copy
+// state instead, which have to still be stopped at the same
+// position. The destination masters have to be known.
+func (tc *tableCopier) findSources(cell, keyspace, shard string) error {
+	if tc.config.Resume {
+		return tc.resumeSources()
+	}
+	count := tc.config.SourceRdonlyCount
+	if count < 1 {
+		count = 1
+	}
+	tablets, err := findRdonlys(tc.wr, cell, keyspace, shard, count)
+	if err != nil {
+		return err
+	}
+	return tc.stopSources(tablets)
+}
+
+// resumeSources reads the copy state of the destinations, and checks
+// its source tablets are still stopped at the saved position.
+func (tc *tableCopier) resumeSources() error {
+	cs, err := tc.readCopyState()
+	if err != nil {
+		return err
+	}
+	for _, alias := range cs.SourceTablets {
+		ti, err := tc.wr.TopoServer().GetTablet(alias)
+		if err != nil {
+			return fmt.Errorf("cannot read source tablet %v: %v", alias, err)
+		}
+		pos, err := tc.wr.ActionInitiator().SlavePosition(ti, 30*time.Second)
+		if err != nil {
+			return fmt.Errorf("cannot get replication position of %v: %v", ti.Alias, err)
+		}
+		if pos.MasterLogGroupId != cs.SourceGroupId || pos.SecondsBehindMaster != mysqlctl.InvalidLagSeconds {
+			return fmt.Errorf("cannot resume the copy, source tablet %v is not stopped at group id %v anymore (group id %v)", ti.Alias, cs.SourceGroupId, pos.MasterLogGroupId)
+		}
+		tc.sourceTablets = append(tc.sourceTablets, ti)
+		tc.sourcesChangedType = append(tc.sourcesChangedType, ti)
+		tc.sourcesStopped = append(tc.sourcesStopped, ti)
+		tc.sourcePosition = pos
+	}
+	tc.sourceTablet = tc.sourceTablets[0]
+	tc.state = cs
+	total, done := cs.progress()
+	log.Infof("resuming copy from %v at group id %v, %v of %v chunks already copied", tc.sourcesDescription(), tc.sourcePosition.MasterLogGroupId, done, total)
+	return nil
+}
+
+// stopSources takes the source rdonly tablets out of the serving
+// graph, stops their replication at the same position, and
+// remembers it.
+func (tc *tableCopier) stopSources(tablets []*topo.TabletInfo) error {
+	tc.sourceTablets = tablets
+	tc.sourceTablet = tablets[0]
+
+	for _, ti := range tablets {
+		tc.wr.ResetActionTimeout(30 * time.Second)
+		if err := tc.wr.ChangeType(ti.Alias, topo.TYPE_BACKUP, false); err != nil {
+			return fmt.Errorf("cannot change type of %v to %v: %v", ti.Alias, topo.TYPE_BACKUP, err)
+		}
+		tc.sourcesChangedType = append(tc.sourcesChangedType, ti)
+	}
+
+	for _, ti := range tablets {
+		tc.sourcesStopped = append(tc.sourcesStopped, ti)
+		if err := tc.wr.ActionInitiator().StopSlave(ti, 30*time.Second); err != nil {
+			return fmt.Errorf("cannot stop replication on %v: %v", ti.Alias, err)
+		}
+	}
+
+	var err error
+	if len(tablets) == 1 {
+		tc.sourcePosition, err = tc.wr.ActionInitiator().SlavePosition(tc.sourceTablet, 30*time.Second)
+		if err != nil {
+			return fmt.Errorf("cannot get replication position of %v: %v", tc.sourceTablet.Alias, err)
+		}
+	} else {
+		tc.sourcePosition, err = synchronizeSources(tc.wr, tablets)
+		if err != nil {
+			return err
+		}
+	}
+	log.Infof("source tablets %v stopped at group id %v", tc.sourcesDescription(), tc.sourcePosition.MasterLogGroupId)
+	return nil
+}
+
+// findTables returns the base tables of the source accepted by
+// include.
+func (tc *tableCopier) findTables(include func(table string) bool) ([]*mysqlctl.TableDefinition, error) {
+	sd, err := tc.wr.ActionInitiator().GetSchema(tc.sourceTablet, nil, false, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get schema from %v: %v", tc.sourceTablet.Alias, err)
+	}
+	tables := make([]*mysqlctl.TableDefinition, 0, len(sd.TableDefinitions))
+	for i, td := range sd.TableDefinitions {
+		if td.Type != mysqlctl.TABLE_BASE_TABLE || !include(td.Name) {
+			continue
+		}
+		tables = append(tables, &sd.TableDefinitions[i])
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no table to copy on %v", tc.sourceTablet.Alias)
+	}
+	return tables, nil
+}
+
+// copy copies the tables from the source to the destinations, one
+// chunk at a time. splitter returns, for each table, the function
+// that routes its rows to the destinations. The chunks are saved in
+// the copy state of the destinations, along with the ones that were
+// copied, and the chunks that were copied before are skipped when
+// resuming.
+func (tc *tableCopier) copy(tables []*mysqlctl.TableDefinition, splitter func(td *mysqlctl.TableDefinition) (rowSplitFunc, error)) error {
+	tc.tablesProgress = tc.sw.NewProgress("tables", int64(len(tables)))
+
+	resuming := tc.state != nil
+	if resuming {
+		if err := tc.state.verify(tables); err != nil {
+			return fmt.Errorf("cannot resume the copy: %v", err)
+		}
+	} else {
+		aliases := make([]topo.TabletAlias, len(tc.sourceTablets))
+		for i, ti := range tc.sourceTablets {
+			aliases[i] = ti.Alias
+		}
+		tc.state = newCopyState(aliases, tc.sourcePosition.MasterLogGroupId)
+		for _, td := range tables {
+			chunks, err := findChunks(tc.wr, tc.sourceTablet, td, tc.config.MinTableSizeForSplit, tc.config.MaxChunkSize, tc.config.SourceReaderCount)
+			if err != nil {
+				return err
+			}
+			for _, c := range chunks {
+				tc.state.Chunks[td.Name] = append(tc.state.Chunks[td.Name], chunkState{chunk: c})
+			}
+		}
+		if err := tc.saveCopyState(tc.state); err != nil {
+			return err
+		}
+	}
+	total, done := tc.state.progress()
+	tc.chunksProgress = tc.sw.NewProgress("chunks", total)
+	tc.chunksProgress.Set(done)
+	tc.rowsProgress = tc.sw.NewProgress("rows", 0)
+
+	err := tc.copyChunks(tables, splitter, resuming)
+	if err != nil {
+		tc.keepSourcesStopped = true
+	}
+	return err
+}
+
+// copyChunks copies the chunks of the copy state that were not
+// copied yet. When resuming, the rows of these chunks that were
+// copied before are deleted first.
+func (tc *tableCopier) copyChunks(tables []*mysqlctl.TableDefinition, splitter func(td *mysqlctl.TableDefinition) (rowSplitFunc, error), resuming bool) error {
+	chunkThrottler := newThrottler(tc.config.MaxChunksPerSecond)
+	defer chunkThrottler.Close()
+	writerSemaphores := make([]*sync2.Semaphore, len(tc.destinationMasters))
+	writerThrottlers := make([]*throttler, len(tc.destinationMasters))
+	for i := range writerSemaphores {
+		writerSemaphores[i] = sync2.NewSemaphore(tc.config.DestinationWriterCount, 0)
+		writerThrottlers[i] = newThrottler(tc.config.MaxWritesPerSecond)
+		defer writerThrottlers[i].Close()
+	}
+	lagMonitor := newLagMonitor(tc.config.MaxReplicationLag, func() (uint, error) {
+		return destinationLag(tc.wr, tc.destinationMasters)
+	}, lagCheckInterval)
+	defer lagMonitor.Close()
+
+	// the chunks are read from the sources in turn
+	sourceIndex := 0
+	rc := cc.NewResourceConstraint(tc.config.SourceReaderCount)
+	for _, td := range tables {
+		split, err := splitter(td)
+		if err != nil {
+			rc.RecordError(err)
+			break
+		}
+
+		chunks := tc.state.Chunks[td.Name]
+		remainingChunks := new(sync2.AtomicInt64)
+		for _, c := range chunks {
+			if !c.Done {
+				remainingChunks.Add(1)
+			}
+		}
+		if remainingChunks.Get() == 0 {
+			log.Infof("table %v was already copied", td.Name)
+			tc.tablesProgress.Add(1)
+			continue
+		}
+		for i, c := range chunks {
+			if c.Done {
+				continue
+			}
+			source := tc.sourceTablets[sourceIndex%len(tc.sourceTablets)]
+			sourceIndex++
+			rc.Add(1)
+			go func(source *topo.TabletInfo, td *mysqlctl.TableDefinition, i int, c chunk, split rowSplitFunc, remainingChunks *sync2.AtomicInt64) {
+				rc.Acquire()
+				defer rc.ReleaseAndDone()
+				if rc.HasErrors() {
+					return
+				}
+				if err := lagMonitor.Wait(tc.sw.Interrupted()); err != nil {
+					rc.RecordError(err)
+					return
+				}
+				if err := chunkThrottler.Wait(tc.sw.Interrupted()); err != nil {
+					rc.RecordError(err)
+					return
+				}
+
+				if resuming {
+					if err := tc.deleteChunk(td, c); err != nil {
+						rc.RecordError(err)
+						return
+					}
+				}
+				if err := tc.copyChunk(source, td, c, split, writerSemaphores, writerThrottlers); err != nil {
+					rc.RecordError(err)
+					return
+				}
+				if err := tc.markChunkDone(td.Name, i); err != nil {
+					rc.RecordError(err)
+					return
+				}
+				tc.chunksProgress.Add(1)
+				if remainingChunks.Add(-1) == 0 {
+					log.Infof("table %v copied", td.Name)
+					tc.tablesProgress.Add(1)
+				}
+			}(source, td, i, c.chunk, split, remainingChunks)
+		}
+	}
+	return rc.Wait()
+}
+
+// deleteChunk deletes the rows of a chunk on all the destinations:
+// it may have been partially copied before.
+func (tc *tableCopier) deleteChunk(td *mysqlctl.TableDefinition, c chunk) error {
+	for _, master := range tc.destinationMasters {
+		if _, err := tc.wr.ActionInitiator().ExecuteFetch(master, buildDeleteFromChunk(master.DbName(), td, c), 0, false, false, fetchTimeout); err != nil {
+			return fmt.Errorf("cannot delete chunk %v of table %v on %v: %v", c, td.Name, master.Alias, err)
+		}
+	}
+	return nil
+}
+
+// copyChunk reads one chunk from a source, and writes its rows to
+// the right destinations.
+func (tc *tableCopier) copyChunk(source *topo.TabletInfo, td *mysqlctl.TableDefinition, c chunk, split rowSplitFunc, writerSemaphores []*sync2.Semaphore, writerThrottlers []*throttler) error {
+	query := buildSQLFromChunk(source.DbName(), td, td.Columns, c, "", td.PrimaryKeyColumns)
+	qr, err := readChunk(tc.wr, source, query)
+	if err != nil {
+		return err
+	}
+	rowsPerDestination, err := split(qr.Rows)
+	if err != nil {
+		return fmt.Errorf("table %v chunk %v: %v", td.Name, c, err)
+	}
+
+	rec := cc.FirstErrorRecorder{}
+	wg := sync.WaitGroup{}
+	for i, rows := range rowsPerDestination {
+		master := tc.destinationMasters[i]
+		for _, insert := range makeInsertQueries(master.DbName(), td.Name, td.Columns, rows, tc.config.InsertBatchSize) {
+			wg.Add(1)
+			go func(i int, insert string) {
+				defer wg.Done()
+				writerSemaphores[i].Acquire()
+				defer writerSemaphores[i].Release()
+				if rec.HasErrors() {
+					return
+				}
+				if err := writerThrottlers[i].Wait(tc.sw.Interrupted()); err != nil {
+					rec.RecordError(err)
+					return
+				}
+				if _, err := tc.wr.ActionInitiator().ExecuteFetch(tc.destinationMasters[i], insert, 0, false, false, fetchTimeout); err != nil {
+					rec.RecordError(fmt.Errorf("cannot insert into %v on %v: %v", td.Name, tc.destinationMasters[i].Alias, err))
+				}
+			}(i, insert)
+		}
+	}
+	wg.Wait()
+	if rec.HasErrors() {
+		return rec.Error()
+	}
+	tc.rowsProgress.Add(int64(len(qr.Rows)))
+	return nil
+}
+
+// setUpFilteredReplication stores the source replication position
+// in the blp_checkpoint table of each destination master, adds
+// sourceShard to the SourceShards of each destination shard, and
+// clears the copy state.
+// destinationShards has to be in the same order as
+// destinationMasters.
+// Until the copy state is cleared, a failure keeps the sources
+// stopped, and resuming the copy runs this again: a checkpoint
+// that was already stored is kept, filtered replication may have
+// moved it.
+func (tc *tableCopier) setUpFilteredReplication(destinationShards []*topo.ShardInfo, sourceShard topo.SourceShard) error {
+	tc.keepSourcesStopped = true
+	for i, si := range destinationShards {
+		master := tc.destinationMasters[i]
+		query := fmt.Sprintf("INSERT IGNORE INTO _vt.blp_checkpoint (source_shard_uid, group_id, time_updated) VALUES (%v, %v, %v)", sourceShard.Uid, tc.sourcePosition.MasterLogGroupId, time.Now().Unix())
+		if _, err := tc.wr.ActionInitiator().ExecuteFetch(master, query, 0, false, false, 30*time.Second); err != nil {
+			return fmt.Errorf("cannot set blp_checkpoint on %v: %v", master.Alias, err)
+		}
+
+		tc.wr.ResetActionTimeout(30 * time.Second)
+		if err := tc.wr.SetSourceShards(si.Keyspace(), si.ShardName(), []topo.SourceShard{sourceShard}); err != nil {
+			return fmt.Errorf("cannot set SourceShards on %v/%v: %v", si.Keyspace(), si.ShardName(), err)
+		}
+
+		// Any action on the master makes it re-read its shard
+		// record, and start filtered replication.
+		actionPath, err := tc.wr.ActionInitiator().Ping(master.Alias)
+		if err == nil {
+			err = tc.wr.ActionInitiator().WaitForCompletion(actionPath, 30*time.Second)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot ping master %v to start filtered replication: %v", master.Alias, err)
+		}
+	}
+	if err := tc.clearCopyState(); err != nil {
+		return err
+	}
+	tc.keepSourcesStopped = false
+	return nil
+}
+
+// cleanUp restarts replication on the source tablets, and puts them
+// back in the serving graph. If the copy failed, the sources are
+// kept stopped so the copy can be resumed.
+func (tc *tableCopier) cleanUp() error {
+	if tc.keepSourcesStopped {
+		log.Warningf("keeping source tablets %v stopped at group id %v, so the copy can be resumed with -resume. To give up instead, run vtctl StartSlave and vtctl ChangeSlaveType <alias> %v on each of them", tc.sourcesDescription(), tc.sourcePosition.MasterLogGroupId, topo.TYPE_RDONLY)
+		return nil
+	}
+	rec := cc.AllErrorRecorder{}
+	for _, ti := range tc.sourcesStopped {
+		if err := tc.wr.ActionInitiator().StartSlave(ti, 30*time.Second); err != nil {
+			rec.RecordError(fmt.Errorf("cannot restart replication on %v: %v", ti.Alias, err))
+		}
+	}
+	for _, ti := range tc.sourcesChangedType {
+		tc.wr.ResetActionTimeout(30 * time.Second)
+		if err := tc.wr.ChangeType(ti.Alias, topo.TYPE_RDONLY, false); err != nil {
+			rec.RecordError(fmt.Errorf("cannot change type of %v back to %v: %v", ti.Alias, topo.TYPE_RDONLY, err))
+		}
+	}
+	return rec.Error()
+}
@@ -0,0 +1,233 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	tm "github.com/youtube/vitess/go/vt/tabletmanager"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+// fakeCopierTablets is what the tablets of the "fake_copier"
+// protocol know: the copy state of the destination, the queries it
+// ran, and the tablets whose replication was restarted.
+var fakeCopierTablets struct {
+	mu             sync.Mutex
+	copyState      [][]sqltypes.Value
+	queries        []string
+	startedSlaves  []topo.TabletAlias
+	failCheckpoint bool
+}
+
+// fakeCopierConn is the TabletManagerConn of the "fake_copier"
+// protocol. Its sources are stopped at group id 1234.
+type fakeCopierConn struct {
+	tm.TabletManagerConn
+}
+
+func (c *fakeCopierConn) ExecuteFetch(tablet *topo.TabletInfo, query string, maxRows int, wantFields, disableBinlogs bool, waitTime time.Duration) (*mproto.QueryResult, error) {
+	f := &fakeCopierTablets
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, query)
+	switch {
+	case f.failCheckpoint && strings.Contains(query, "blp_checkpoint"):
+		return nil, fmt.Errorf("lost connection to %v", tablet.Alias)
+	case query == readCopyStateQuery:
+		return &mproto.QueryResult{Rows: f.copyState}, nil
+	case query == "DELETE FROM _vt.copy_state":
+		f.copyState = nil
+	}
+	return &mproto.QueryResult{}, nil
+}
+
+func (c *fakeCopierConn) SlavePosition(tablet *topo.TabletInfo, waitTime time.Duration) (*mysqlctl.ReplicationPosition, error) {
+	return &mysqlctl.ReplicationPosition{MasterLogGroupId: "1234", SecondsBehindMaster: mysqlctl.InvalidLagSeconds}, nil
+}
+
+func (c *fakeCopierConn) StartSlave(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	f := &fakeCopierTablets
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.startedSlaves = append(f.startedSlaves, tablet.Alias)
+	return nil
+}
+
+func init() {
+	tm.RegisterTabletManagerConnFactory("fake_copier", func(ts topo.Server) tm.TabletManagerConn {
+		return &fakeCopierConn{}
+	})
+}
+
+// startFakeActionLoop runs the actions of a tablet, with a fake mysqld.
+func startFakeActionLoop(t *testing.T, ts topo.Server, alias topo.TabletAlias, done chan struct{}) {
+	go ts.ActionEventLoop(alias, func(actionPath, data string) error {
+		actionNode, err := tm.ActionNodeFromJson(data, actionPath)
+		if err != nil {
+			t.Errorf("ActionNodeFromJson: %v", err)
+			return nil
+		}
+		ta := tm.NewTabletActor(nil, &mysqlctl.FakeMysqlDaemon{}, ts, alias)
+		if err := ta.HandleAction(actionPath, actionNode.Action, actionNode.ActionGuid, false); err != nil {
+			t.Logf("HandleAction(%v): %v", actionNode.Action, err)
+		}
+		return nil
+	}, done)
+}
+
+func TestCopierResumeFilteredReplication(t *testing.T) {
+	flag.Set("tablet_manager_protocol", "fake_copier")
+	defer flag.Set("tablet_manager_protocol", "bson")
+	hookDir, err := ioutil.TempDir("", "copier_test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(hookDir)
+	flag.Set("vthook-dir", hookDir)
+	defer flag.Set("vthook-dir", "")
+
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := wrangler.New(ts, time.Minute, time.Second)
+	wr.UseRPCs = false
+	done := make(chan struct{})
+	defer close(done)
+	sourceMaster := &topo.Tablet{
+		Alias:    topo.TabletAlias{Cell: "cell1", Uid: 0},
+		Hostname: "cell1host",
+		Portmap:  map[string]int{"vt": 8100, "mysql": 3300},
+		IPAddr:   "100.0.0.0",
+		Keyspace: "source_keyspace",
+		Shard:    "0",
+		Type:     topo.TYPE_MASTER,
+		State:    topo.STATE_READ_WRITE,
+	}
+	source := &topo.Tablet{
+		Alias:    topo.TabletAlias{Cell: "cell1", Uid: 1},
+		Hostname: "cell1host",
+		Portmap:  map[string]int{"vt": 8101, "mysql": 3301},
+		IPAddr:   "100.0.0.1",
+		Keyspace: "source_keyspace",
+		Shard:    "0",
+		Type:     topo.TYPE_BACKUP,
+		State:    topo.STATE_READ_ONLY,
+	}
+	master := &topo.Tablet{
+		Alias:    topo.TabletAlias{Cell: "cell1", Uid: 2},
+		Hostname: "cell1host",
+		Portmap:  map[string]int{"vt": 8102, "mysql": 3302},
+		IPAddr:   "100.0.0.2",
+		Keyspace: "destination_keyspace",
+		Shard:    "0",
+		Type:     topo.TYPE_MASTER,
+		State:    topo.STATE_READ_WRITE,
+	}
+	for _, tablet := range []*topo.Tablet{sourceMaster, source, master} {
+		if err := wr.InitTablet(tablet, false, true, false); err != nil {
+			t.Fatalf("InitTablet(%v): %v", tablet.Alias, err)
+		}
+		startFakeActionLoop(t, ts, tablet.Alias, done)
+	}
+	sourceTi, err := ts.GetTablet(source.Alias)
+	if err != nil {
+		t.Fatalf("GetTablet: %v", err)
+	}
+	masterTi, err := ts.GetTablet(master.Alias)
+	if err != nil {
+		t.Fatalf("GetTablet: %v", err)
+	}
+	si, err := ts.GetShard("destination_keyspace", "0")
+	if err != nil {
+		t.Fatalf("GetShard: %v", err)
+	}
+	sourceShard := topo.SourceShard{Uid: 0, Keyspace: "source_keyspace", Shard: "0"}
+
+	// the copy is over, its state is saved
+	f := &fakeCopierTablets
+	f.copyState = [][]sqltypes.Value{copyStateRow("t1", "0", "", "", "1", "cell1-0000000001", "1234")}
+	f.failCheckpoint = true
+	sw := NewStatusWorker()
+	tc := newTableCopier(&sw, wr, CopyConfig{})
+	tc.destinationMasters = []*topo.TabletInfo{masterTi}
+	tc.sourceTablets = []*topo.TabletInfo{sourceTi}
+	tc.sourceTablet = sourceTi
+	tc.sourcesStopped = []*topo.TabletInfo{sourceTi}
+	tc.sourcePosition = &mysqlctl.ReplicationPosition{MasterLogGroupId: "1234"}
+
+	// a failure to set up filtered replication keeps the sources
+	// stopped and the copy state
+	if err := tc.setUpFilteredReplication([]*topo.ShardInfo{si}, sourceShard); err == nil || !strings.Contains(err.Error(), "cannot set blp_checkpoint") {
+		t.Fatalf("setUpFilteredReplication: want a blp_checkpoint error, got %v", err)
+	}
+	if !tc.keepSourcesStopped {
+		t.Errorf("the sources should be kept stopped")
+	}
+	if err := tc.cleanUp(); err != nil {
+		t.Errorf("cleanUp: %v", err)
+	}
+	if len(f.startedSlaves) != 0 || f.copyState == nil {
+		t.Errorf("the sources were restarted (%v) or the copy state was cleared (%v)", f.startedSlaves, f.copyState)
+	}
+
+	// resuming finds the copied chunks, and sets up filtered
+	// replication again
+	f.failCheckpoint = false
+	f.queries = nil
+	sw = NewStatusWorker()
+	tc = newTableCopier(&sw, wr, CopyConfig{Resume: true, SourceReaderCount: 1, DestinationWriterCount: 1})
+	tc.destinationMasters = []*topo.TabletInfo{masterTi}
+	if err := tc.findSources("cell1", "source_keyspace", "0"); err != nil {
+		t.Fatalf("findSources: %v", err)
+	}
+	if err := tc.copy([]*mysqlctl.TableDefinition{{Name: "t1"}}, func(td *mysqlctl.TableDefinition) (rowSplitFunc, error) {
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if err := tc.setUpFilteredReplication([]*topo.ShardInfo{si}, sourceShard); err != nil {
+		t.Fatalf("setUpFilteredReplication: %v", err)
+	}
+	want := []string{
+		readCopyStateQuery,
+		"INSERT IGNORE INTO _vt.blp_checkpoint (source_shard_uid, group_id, time_updated) VALUES (0, 1234, ",
+		"DELETE FROM _vt.copy_state",
+	}
+	if len(f.queries) != len(want) {
+		t.Fatalf("got queries %v, want %v", f.queries, want)
+	}
+	for i, query := range f.queries {
+		if !strings.HasPrefix(query, want[i]) {
+			t.Errorf("query %v: got %v, want %v", i, query, want[i])
+		}
+	}
+	if tc.keepSourcesStopped {
+		t.Errorf("the sources should be restarted")
+	}
+	if si, err = ts.GetShard("destination_keyspace", "0"); err != nil || !reflect.DeepEqual(si.SourceShards, []topo.SourceShard{sourceShard}) {
+		t.Errorf("SourceShards: got %v %v, want %v", si, err, sourceShard)
+	}
+	if err := tc.cleanUp(); err != nil {
+		t.Errorf("cleanUp: %v", err)
+	}
+	if len(f.startedSlaves) != 1 || f.startedSlaves[0] != source.Alias {
+		t.Errorf("got restarted sources %v, want %v", f.startedSlaves, source.Alias)
+	}
+	if ti, err := ts.GetTablet(source.Alias); err != nil || ti.Type != topo.TYPE_RDONLY {
+		t.Errorf("source should be rdonly again: %v %v", ti, err)
+	}
+}
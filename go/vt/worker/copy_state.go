@@ -0,0 +1,283 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// This file contains the copy state of the clone workers: the chunks
+// of each table, and whether they were copied. It is saved in the
+// _vt.copy_state table of each destination master, so a clone that
+// died can be resumed with -resume, as long as its source rdonly
+// tablets are still stopped at the same replication position.
+
+var createCopyStateQueries = []string{
+	"CREATE DATABASE IF NOT EXISTS _vt",
+	`CREATE TABLE IF NOT EXISTS _vt.copy_state (
+  table_name varbinary(256) NOT NULL,
+  chunk_index int NOT NULL,
+  chunk_start varbinary(256) NOT NULL,
+  chunk_end varbinary(256) NOT NULL,
+  done tinyint NOT NULL,
+  source_tablets varbinary(1024) NOT NULL,
+  source_group_id varbinary(256) NOT NULL,
+  primary key (table_name, chunk_index))`,
+}
+
+const readCopyStateQuery = "SELECT table_name, chunk_index, chunk_start, chunk_end, done, source_tablets, source_group_id FROM _vt.copy_state ORDER BY table_name, chunk_index"
+
+// chunkState is a chunk, and whether it was copied.
+type chunkState struct {
+	chunk
+	Done bool
+}
+
+// copyState is the state of a copy, as saved on the destinations.
+type copyState struct {
+	SourceTablets []topo.TabletAlias
+	SourceGroupId string
+
+	// Chunks has the chunks of each table, in order.
+	Chunks map[string][]chunkState
+}
+
+func newCopyState(sourceTablets []topo.TabletAlias, sourceGroupId string) *copyState {
+	return &copyState{
+		SourceTablets: sourceTablets,
+		SourceGroupId: sourceGroupId,
+		Chunks:        make(map[string][]chunkState),
+	}
+}
+
+// encodeString returns s as a quoted and escaped SQL string.
+func encodeString(s string) string {
+	buf := bytes.Buffer{}
+	sqltypes.MakeString([]byte(s)).EncodeSql(&buf)
+	return buf.String()
+}
+
+// encodeSources returns the source tablet aliases, separated by
+// commas.
+func (cs *copyState) encodeSources() string {
+	aliases := make([]string, len(cs.SourceTablets))
+	for i, alias := range cs.SourceTablets {
+		aliases[i] = alias.String()
+	}
+	return strings.Join(aliases, ",")
+}
+
+func decodeSources(value string) ([]topo.TabletAlias, error) {
+	parts := strings.Split(value, ",")
+	result := make([]topo.TabletAlias, len(parts))
+	for i, part := range parts {
+		alias, err := topo.ParseTabletAliasString(part)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = alias
+	}
+	return result, nil
+}
+
+// insertQueries returns the queries that save the state, one per
+// table.
+func (cs *copyState) insertQueries() []string {
+	tables := make([]string, 0, len(cs.Chunks))
+	for table := range cs.Chunks {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	result := make([]string, len(tables))
+	for i, table := range tables {
+		values := make([]string, len(cs.Chunks[table]))
+		for j, c := range cs.Chunks[table] {
+			done := 0
+			if c.Done {
+				done = 1
+			}
+			values[j] = fmt.Sprintf("(%v, %v, %v, %v, %v, %v, %v)", encodeString(table), j, encodeString(c.Start), encodeString(c.End), done, encodeString(cs.encodeSources()), encodeString(cs.SourceGroupId))
+		}
+		result[i] = "INSERT INTO _vt.copy_state (table_name, chunk_index, chunk_start, chunk_end, done, source_tablets, source_group_id) VALUES " + strings.Join(values, ", ")
+	}
+	return result
+}
+
+// chunkDoneQuery returns the query that marks a chunk as copied.
+func chunkDoneQuery(table string, index int) string {
+	return fmt.Sprintf("UPDATE _vt.copy_state SET done=1 WHERE table_name=%v AND chunk_index=%v", encodeString(table), index)
+}
+
+// copyStateFromQueryResult converts the rows of readCopyStateQuery.
+// It returns nil if there is no state.
+func copyStateFromQueryResult(qr *mproto.QueryResult) (*copyState, error) {
+	if len(qr.Rows) == 0 {
+		return nil, nil
+	}
+	var cs *copyState
+	for _, row := range qr.Rows {
+		if len(row) != 7 {
+			return nil, fmt.Errorf("unexpected copy_state row: %v", row)
+		}
+		if cs == nil {
+			aliases, err := decodeSources(row[5].String())
+			if err != nil {
+				return nil, fmt.Errorf("invalid source tablets in copy_state: %v", err)
+			}
+			cs = newCopyState(aliases, row[6].String())
+		}
+		if row[5].String() != cs.encodeSources() || row[6].String() != cs.SourceGroupId {
+			return nil, fmt.Errorf("copy_state has more than one source: %v@%v and %v@%v", cs.encodeSources(), cs.SourceGroupId, row[5].String(), row[6].String())
+		}
+		table := row[0].String()
+		index, err := strconv.Atoi(row[1].String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk index for table %v: %v", table, err)
+		}
+		if index != len(cs.Chunks[table]) {
+			return nil, fmt.Errorf("chunk %v of table %v is missing in copy_state", len(cs.Chunks[table]), table)
+		}
+		cs.Chunks[table] = append(cs.Chunks[table], chunkState{
+			chunk: chunk{Start: row[2].String(), End: row[3].String()},
+			Done:  row[4].String() == "1",
+		})
+	}
+	return cs, nil
+}
+
+// merge checks other was saved by the same copy, and keeps the
+// chunks as done only if they are done in both states: the chunks
+// are marked as done on each destination one after the other.
+func (cs *copyState) merge(other *copyState) error {
+	if cs.encodeSources() != other.encodeSources() || cs.SourceGroupId != other.SourceGroupId {
+		return fmt.Errorf("different sources: %v@%v and %v@%v", cs.encodeSources(), cs.SourceGroupId, other.encodeSources(), other.SourceGroupId)
+	}
+	if len(cs.Chunks) != len(other.Chunks) {
+		return fmt.Errorf("different number of tables: %v and %v", len(cs.Chunks), len(other.Chunks))
+	}
+	for table, chunks := range cs.Chunks {
+		otherChunks := other.Chunks[table]
+		if len(chunks) != len(otherChunks) {
+			return fmt.Errorf("different number of chunks for table %v: %v and %v", table, len(chunks), len(otherChunks))
+		}
+		for i := range chunks {
+			if chunks[i].chunk != otherChunks[i].chunk {
+				return fmt.Errorf("different chunk %v for table %v: %v and %v", i, table, chunks[i].chunk, otherChunks[i].chunk)
+			}
+			chunks[i].Done = chunks[i].Done && otherChunks[i].Done
+		}
+	}
+	return nil
+}
+
+// verify checks the state has the chunks of exactly the given
+// tables, and that they cover each table without gaps or overlaps.
+func (cs *copyState) verify(tables []*mysqlctl.TableDefinition) error {
+	if len(tables) != len(cs.Chunks) {
+		return fmt.Errorf("copy_state has %v tables, copying %v", len(cs.Chunks), len(tables))
+	}
+	for _, td := range tables {
+		chunks, ok := cs.Chunks[td.Name]
+		if !ok || len(chunks) == 0 {
+			return fmt.Errorf("table %v is not in copy_state", td.Name)
+		}
+		if chunks[0].Start != "" || chunks[len(chunks)-1].End != "" {
+			return fmt.Errorf("chunks of table %v don't cover the whole table: %v to %v", td.Name, chunks[0].Start, chunks[len(chunks)-1].End)
+		}
+		for i := 1; i < len(chunks); i++ {
+			if chunks[i].Start != chunks[i-1].End {
+				return fmt.Errorf("chunks %v and %v of table %v are not contiguous", chunks[i-1].chunk, chunks[i].chunk, td.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// progress returns the number of chunks, and of copied chunks.
+func (cs *copyState) progress() (total, done int64) {
+	for _, chunks := range cs.Chunks {
+		for _, c := range chunks {
+			total++
+			if c.Done {
+				done++
+			}
+		}
+	}
+	return
+}
+
+// saveCopyState writes a new copy state on all the destinations,
+// replacing any previous one.
+func (tc *tableCopier) saveCopyState(cs *copyState) error {
+	queries := append([]string{}, createCopyStateQueries...)
+	queries = append(queries, "DELETE FROM _vt.copy_state")
+	queries = append(queries, cs.insertQueries()...)
+	for _, master := range tc.destinationMasters {
+		for _, query := range queries {
+			if _, err := tc.wr.ActionInitiator().ExecuteFetch(master, query, 0, false, false, 30*time.Second); err != nil {
+				return fmt.Errorf("cannot save copy_state on %v: %v", master.Alias, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readCopyState reads and merges the copy state of all the
+// destinations.
+func (tc *tableCopier) readCopyState() (*copyState, error) {
+	var result *copyState
+	for _, master := range tc.destinationMasters {
+		qr, err := tc.wr.ActionInitiator().ExecuteFetch(master, readCopyStateQuery, maxRowsPerChunk, false, false, 30*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read copy_state on %v: %v", master.Alias, err)
+		}
+		cs, err := copyStateFromQueryResult(qr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid copy_state on %v: %v", master.Alias, err)
+		}
+		if cs == nil {
+			return nil, fmt.Errorf("no copy_state on %v, nothing to resume", master.Alias)
+		}
+		if result == nil {
+			result = cs
+		} else if err := result.merge(cs); err != nil {
+			return nil, fmt.Errorf("copy_state on %v doesn't match the other destinations: %v", master.Alias, err)
+		}
+	}
+	return result, nil
+}
+
+// markChunkDone records on all the destinations that a chunk was
+// copied.
+func (tc *tableCopier) markChunkDone(table string, index int) error {
+	for _, master := range tc.destinationMasters {
+		if _, err := tc.wr.ActionInitiator().ExecuteFetch(master, chunkDoneQuery(table, index), 0, false, false, 30*time.Second); err != nil {
+			return fmt.Errorf("cannot update copy_state on %v: %v", master.Alias, err)
+		}
+	}
+	return nil
+}
+
+// clearCopyState deletes the copy state on all the destinations,
+// once the copy is complete.
+func (tc *tableCopier) clearCopyState() error {
+	for _, master := range tc.destinationMasters {
+		if _, err := tc.wr.ActionInitiator().ExecuteFetch(master, "DELETE FROM _vt.copy_state", 0, false, false, 30*time.Second); err != nil {
+			return fmt.Errorf("cannot clear copy_state on %v: %v", master.Alias, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"reflect"
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func copyStateRow(values ...string) []sqltypes.Value {
+	row := make([]sqltypes.Value, len(values))
+	for i, v := range values {
+		row[i] = sqltypes.MakeString([]byte(v))
+	}
+	return row
+}
+
+func TestCopyState(t *testing.T) {
+	cs := newCopyState([]topo.TabletAlias{{Cell: "cell1", Uid: 12}, {Cell: "cell1", Uid: 13}}, "1234")
+	cs.Chunks["t1"] = []chunkState{{chunk{"", "10"}, true}, {chunk{"10", ""}, false}}
+	want := []string{"INSERT INTO _vt.copy_state (table_name, chunk_index, chunk_start, chunk_end, done, source_tablets, source_group_id) VALUES ('t1', 0, '', '10', 1, 'cell1-0000000012,cell1-0000000013', '1234'), ('t1', 1, '10', '', 0, 'cell1-0000000012,cell1-0000000013', '1234')"}
+	if got := cs.insertQueries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("insertQueries:\ngot  %v\nwant %v", got, want)
+	}
+	if got, want := chunkDoneQuery("t1", 1), "UPDATE _vt.copy_state SET done=1 WHERE table_name='t1' AND chunk_index=1"; got != want {
+		t.Errorf("chunkDoneQuery: got %v want %v", got, want)
+	}
+
+	qr := &mproto.QueryResult{Rows: [][]sqltypes.Value{
+		copyStateRow("t1", "0", "", "10", "1", "cell1-0000000012,cell1-0000000013", "1234"),
+		copyStateRow("t1", "1", "10", "", "0", "cell1-0000000012,cell1-0000000013", "1234"),
+	}}
+	got, err := copyStateFromQueryResult(qr)
+	if err != nil {
+		t.Fatalf("copyStateFromQueryResult failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, cs) {
+		t.Errorf("copyStateFromQueryResult: got %v want %v", got, cs)
+	}
+	if total, done := got.progress(); total != 2 || done != 1 {
+		t.Errorf("progress: got %v %v", total, done)
+	}
+
+	// a chunk marked as done on only one destination is not done
+	other := newCopyState(cs.SourceTablets, "1234")
+	other.Chunks["t1"] = []chunkState{{chunk{"", "10"}, false}, {chunk{"10", ""}, false}}
+	if err := got.merge(other); err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	if got.Chunks["t1"][0].Done {
+		t.Errorf("merge kept chunk 0 as done")
+	}
+	other.Chunks["t1"][1].Start = "11"
+	if err := got.merge(other); err == nil {
+		t.Errorf("merge of different chunks should have failed")
+	}
+
+	tables := []*mysqlctl.TableDefinition{{Name: "t1"}}
+	if err := cs.verify(tables); err != nil {
+		t.Errorf("verify failed: %v", err)
+	}
+	if err := cs.verify(append(tables, &mysqlctl.TableDefinition{Name: "t2"})); err == nil {
+		t.Errorf("verify with a missing table should have failed")
+	}
+	cs.Chunks["t1"][1].Start = "11"
+	if err := cs.verify(tables); err == nil {
+		t.Errorf("verify with a gap should have failed")
+	}
+
+	// rows with a missing chunk
+	qr.Rows = qr.Rows[1:]
+	if _, err := copyStateFromQueryResult(qr); err == nil {
+		t.Errorf("copyStateFromQueryResult with a missing chunk should have failed")
+	}
+}
+
+func TestBuildDeleteFromChunk(t *testing.T) {
+	td := &mysqlctl.TableDefinition{Name: "t1", PrimaryKeyColumns: []string{"id"}}
+	if got, want := buildDeleteFromChunk("vt_db", td, chunk{"10", "20"}), "DELETE FROM vt_db.t1 WHERE id>=10 AND id<20"; got != want {
+		t.Errorf("buildDeleteFromChunk: got %v want %v", got, want)
+	}
+	if got, want := buildDeleteFromChunk("vt_db", td, chunk{}), "DELETE FROM vt_db.t1"; got != want {
+		t.Errorf("buildDeleteFromChunk: got %v want %v", got, want)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// This file contains utility functions used by the diff workers:
+// building checksum queries, and comparing sorted lists of rows.
+
+// DiffConfig has the parameters used by the diff workers.
+type DiffConfig struct {
+	// ReaderCount is how many chunks are compared concurrently.
+	ReaderCount int
+
+	// MinTableSizeForSplit is the minimum table size (in bytes) to
+	// split it into chunks.
+	MinTableSizeForSplit uint64
+
+	// MaxChunkSize is the maximum size (in bytes) of a chunk.
+	MaxChunkSize uint64
+
+	// MaxChunksPerSecond throttles the chunk comparisons, i.e.
+	// the queries on the source and destination, 0 means
+	// unlimited.
+	MaxChunksPerSecond int
+}
+
+// RegisterDiffFlags registers the command line flags for a DiffConfig.
+func RegisterDiffFlags(subFlags *flag.FlagSet, config *DiffConfig) {
+	subFlags.IntVar(&config.ReaderCount, "reader-count", 10, "number of chunks compared concurrently")
+	subFlags.Uint64Var(&config.MinTableSizeForSplit, "min-table-size-for-split", 1024*1024, "tables bigger than this (in bytes) are compared in multiple chunks")
+	subFlags.Uint64Var(&config.MaxChunkSize, "max-chunk-size", 64*1024*1024, "maximum size (in bytes) of a chunk")
+	subFlags.IntVar(&config.MaxChunksPerSecond, "max-chunks-per-second", 0, "maximum number of chunks compared per second (0 for unlimited)")
+}
+
+// diffTableDefinition returns the table definition to use for a
+// diff: tables without a primary key are compared using all their
+// columns as the key.
+func diffTableDefinition(td *mysqlctl.TableDefinition) *mysqlctl.TableDefinition {
+	if len(td.PrimaryKeyColumns) > 0 {
+		return td
+	}
+	result := *td
+	result.PrimaryKeyColumns = td.Columns
+	return &result
+}
+
+// checksumColumns returns the columns to select to compare a table
+// row by row: the primary key columns, followed by a checksum of
+// the whole row.
+func checksumColumns(td *mysqlctl.TableDefinition) []string {
+	values := make([]string, len(td.Columns))
+	for i, column := range td.Columns {
+		values[i] = "COALESCE(HEX(" + column + "), 'NULL')"
+	}
+	result := make([]string, 0, len(td.PrimaryKeyColumns)+1)
+	result = append(result, td.PrimaryKeyColumns...)
+	return append(result, "CRC32(CONCAT_WS('#', "+strings.Join(values, ", ")+"))")
+}
+
+// keyRangeWhere returns the condition to only select the rows whose
+// keyspace id, stored as a keyType in column keyName, is in the key
+// range. It returns an empty string for the full key range.
+func keyRangeWhere(keyName string, keyType key.KeyspaceIdType, kr key.KeyRange) string {
+	conditions := make([]string, 0, 2)
+	if kr.Start != key.MinKey {
+		conditions = append(conditions, fmt.Sprintf("%v>=%v", keyName, keyType.SqlLiteral(kr.Start)))
+	}
+	if kr.End != key.MaxKey {
+		conditions = append(conditions, fmt.Sprintf("%v<%v", keyName, keyType.SqlLiteral(kr.End)))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// DiffReport has the result of the comparison of a table.
+type DiffReport struct {
+	ProcessedRows  int
+	MatchingRows   int
+	MismatchedRows int
+	ExtraRowsLeft  int
+	ExtraRowsRight int
+}
+
+// HasDifferences returns true if the diff found any difference.
+func (dr *DiffReport) HasDifferences() bool {
+	return dr.MismatchedRows > 0 || dr.ExtraRowsLeft > 0 || dr.ExtraRowsRight > 0
+}
+
+// Add adds the counts of other to dr.
+func (dr *DiffReport) Add(other *DiffReport) {
+	dr.ProcessedRows += other.ProcessedRows
+	dr.MatchingRows += other.MatchingRows
+	dr.MismatchedRows += other.MismatchedRows
+	dr.ExtraRowsLeft += other.ExtraRowsLeft
+	dr.ExtraRowsRight += other.ExtraRowsRight
+}
+
+func (dr *DiffReport) String() string {
+	return fmt.Sprintf("%v processed rows, %v matching, %v mismatched, %v extra on the left, %v extra on the right", dr.ProcessedRows, dr.MatchingRows, dr.MismatchedRows, dr.ExtraRowsLeft, dr.ExtraRowsRight)
+}
+
+// findKeyTypes returns the field types of the primary key columns of
+// a table.
+func findKeyTypes(wr *wrangler.Wrangler, ti *topo.TabletInfo, td *mysqlctl.TableDefinition) ([]int64, error) {
+	query := "SELECT " + strings.Join(td.PrimaryKeyColumns, ", ") + " FROM " + ti.DbName() + "." + td.Name + " LIMIT 0"
+	qr, err := wr.ActionInitiator().ExecuteFetch(ti, query, 1, true, false, fetchTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the key types of table %v: %v", td.Name, err)
+	}
+	if len(qr.Fields) != len(td.PrimaryKeyColumns) {
+		return nil, fmt.Errorf("cannot get the key types of table %v: got %v fields", td.Name, len(qr.Fields))
+	}
+	keyTypes := make([]int64, len(qr.Fields))
+	for i, field := range qr.Fields {
+		keyTypes[i] = field.Type
+	}
+	return keyTypes, nil
+}
+
+// diffOrderBy returns the order by columns of the chunk reads of a
+// diff. The non-numeric key columns are sorted with a binary
+// collation, the only one compareRows can compare with.
+func diffOrderBy(td *mysqlctl.TableDefinition, keyTypes []int64) []string {
+	result := make([]string, len(td.PrimaryKeyColumns))
+	for i, column := range td.PrimaryKeyColumns {
+		result[i] = column
+		if !mproto.IsNumericType(keyTypes[i]) {
+			result[i] = "BINARY " + column
+		}
+	}
+	return result
+}
+
+// compareRows compares the key columns of two rows, whose types are
+// keyTypes.
+func compareRows(left, right []sqltypes.Value, keyTypes []int64) int {
+	for i, keyType := range keyTypes {
+		if c := mproto.CompareValues(keyType, left[i], right[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// rowsEqual returns true if all the values of both rows are equal.
+func rowsEqual(left, right []sqltypes.Value) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if left[i].IsNull() != right[i].IsNull() || left[i].String() != right[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// diffRows compares two lists of rows sorted by their first key
+// columns, whose types are keyTypes, and returns the differences. The
+// first few mismatched keys are returned in samples, at most
+// maxSamples of them.
+func diffRows(left, right [][]sqltypes.Value, keyTypes []int64, maxSamples int) (dr *DiffReport, samples []string) {
+	keyCount := len(keyTypes)
+	dr = &DiffReport{}
+	addSample := func(prefix string, row []sqltypes.Value) {
+		if len(samples) < maxSamples {
+			samples = append(samples, fmt.Sprintf("%v %v", prefix, row[:keyCount]))
+		}
+	}
+	i, j := 0, 0
+	for i < len(left) || j < len(right) {
+		dr.ProcessedRows++
+		switch {
+		case j == len(right):
+			dr.ExtraRowsLeft++
+			addSample("extra row on the left:", left[i])
+			i++
+		case i == len(left):
+			dr.ExtraRowsRight++
+			addSample("extra row on the right:", right[j])
+			j++
+		default:
+			c := compareRows(left[i], right[j], keyTypes)
+			switch {
+			case c < 0:
+				dr.ExtraRowsLeft++
+				addSample("extra row on the left:", left[i])
+				i++
+			case c > 0:
+				dr.ExtraRowsRight++
+				addSample("extra row on the right:", right[j])
+				j++
+			default:
+				if rowsEqual(left[i], right[j]) {
+					dr.MatchingRows++
+				} else {
+					dr.MismatchedRows++
+					addSample("mismatched row:", left[i])
+				}
+				i++
+				j++
+			}
+		}
+	}
+	return dr, samples
+}
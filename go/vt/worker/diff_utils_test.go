@@ -0,0 +1,80 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/key"
+)
+
+func TestDiffRows(t *testing.T) {
+	left := [][]sqltypes.Value{
+		row("1", "100"),
+		row("2", "200"),
+		row("9", "900"),
+		row("10", "1000"),
+	}
+	right := [][]sqltypes.Value{
+		row("2", "200"),
+		row("3", "300"),
+		row("9", "901"),
+		row("10", "1000"),
+		row("11", "1100"),
+	}
+	intKey := []int64{mproto.VT_LONG}
+	dr, samples := diffRows(left, right, intKey, 2)
+	expected := DiffReport{
+		ProcessedRows:  6,
+		MatchingRows:   2,
+		MismatchedRows: 1,
+		ExtraRowsLeft:  1,
+		ExtraRowsRight: 2,
+	}
+	if *dr != expected {
+		t.Errorf("unexpected report: %v", dr)
+	}
+	if !dr.HasDifferences() {
+		t.Errorf("HasDifferences should be true")
+	}
+	if len(samples) != 2 {
+		t.Errorf("expected 2 samples, got %v", samples)
+	}
+
+	dr, _ = diffRows(left, left, intKey, 2)
+	if dr.HasDifferences() || dr.MatchingRows != 4 {
+		t.Errorf("unexpected report for identical rows: %v", dr)
+	}
+
+	// string keys are sorted with a binary collation: '10' < '9',
+	// and 'B' < 'a'
+	left = [][]sqltypes.Value{row("10", "1"), row("9", "2"), row("B", "3"), row("a", "4")}
+	right = [][]sqltypes.Value{row("10", "1"), row("9", "2"), row("B", "3"), row("a", "4")}
+	dr, _ = diffRows(left, right, []int64{253}, 2)
+	if dr.HasDifferences() || dr.MatchingRows != 4 {
+		t.Errorf("unexpected report for string keys: %v", dr)
+	}
+}
+
+func TestKeyRangeWhere(t *testing.T) {
+	table := []struct {
+		kr       key.KeyRange
+		kit      key.KeyspaceIdType
+		expected string
+	}{
+		{key.KeyRange{Start: key.MinKey, End: key.MaxKey}, key.KIT_UINT64, ""},
+		{key.KeyRange{Start: key.MinKey, End: key.KeyspaceId("\x80")}, key.KIT_UINT64, "keyspace_id<9223372036854775808"},
+		{key.KeyRange{Start: key.KeyspaceId("\x40"), End: key.KeyspaceId("\x80")}, key.KIT_UINT64, "keyspace_id>=4611686018427387904 AND keyspace_id<9223372036854775808"},
+		{key.KeyRange{Start: key.Uint64Key(12345).KeyspaceId(), End: key.MaxKey}, key.KIT_UINT64, "keyspace_id>=12345"},
+		{key.KeyRange{Start: key.KeyspaceId("\x40"), End: key.KeyspaceId("\x80\x00\x01")}, key.KIT_BYTES, "keyspace_id>=0x40 AND keyspace_id<0x800001"},
+	}
+	for _, x := range table {
+		if got := keyRangeWhere("keyspace_id", x.kit, x.kr); got != x.expected {
+			t.Errorf("keyRangeWhere(%v) = %v, expected %v", x.kr, got, x.expected)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/sync2"
+	cc "github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+const (
+	// syncReplicationTimeout is how long we wait for the tablets
+	// to reach the synchronization positions.
+	syncReplicationTimeout = 10 * time.Minute
+
+	// maxDiffSamples is how many mismatched rows we log per chunk.
+	maxDiffSamples = 10
+)
+
+// shardDiffer has the logic shared by the diff workers. It compares
+// the data of an rdonly tablet in a destination shard with the data
+// of an rdonly tablet in the source shard it is replicating from
+// with filtered replication.
+type shardDiffer struct {
+	sw     *StatusWorker
+	wr     *wrangler.Wrangler
+	name   string
+	config DiffConfig
+
+	// populated by findTargets
+	destinationShard  *topo.ShardInfo
+	source            topo.SourceShard
+	uid               uint32
+	sourceTablet      *topo.TabletInfo
+	destinationTablet *topo.TabletInfo
+	destinationMaster *topo.TabletInfo
+	changedTypes      []topo.TabletAlias
+
+	// populated by synchronizeReplication
+	blpStopped    bool
+	stoppedSlaves []*topo.TabletInfo
+
+	// populated by diff
+	tablesProgress *Progress
+	chunksProgress *Progress
+	reportsMu      sync.Mutex
+	reports        map[string]*DiffReport
+	samples        map[string][]string
+}
+
+// newShardDiffer returns a shardDiffer for the worker called name,
+// which is recorded in the diff reports.
+func newShardDiffer(sw *StatusWorker, wr *wrangler.Wrangler, name string, config DiffConfig) *shardDiffer {
+	return &shardDiffer{
+		sw:      sw,
+		wr:      wr,
+		name:    name,
+		config:  config,
+		reports: make(map[string]*DiffReport),
+		samples: make(map[string][]string),
+	}
+}
+
+// tabletsDescription returns the rdonly tablets used, if known.
+func (sd *shardDiffer) tabletsDescription() string {
+	if sd.sourceTablet == nil || sd.destinationTablet == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (source %v, destination %v)", sd.sourceTablet.Alias, sd.destinationTablet.Alias)
+}
+
+// reportLines returns the per-table reports, sorted by table name.
+func (sd *shardDiffer) reportLines() []string {
+	sd.reportsMu.Lock()
+	defer sd.reportsMu.Unlock()
+	tables := make([]string, 0, len(sd.reports))
+	for table := range sd.reports {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	result := make([]string, len(tables))
+	for i, table := range tables {
+		result[i] = fmt.Sprintf("%v: %v", table, sd.reports[table])
+	}
+	return result
+}
+
+// findTargets finds one rdonly in the destination shard and one in
+// its (only) source shard, and takes them out of the serving graph.
+func (sd *shardDiffer) findTargets(cell string, destination *topo.ShardInfo) error {
+	if len(destination.SourceShards) != 1 {
+		return fmt.Errorf("shard %v/%v has %v source shards, only one is supported", destination.Keyspace(), destination.ShardName(), len(destination.SourceShards))
+	}
+	source := destination.SourceShards[0]
+	sd.destinationShard = destination
+	sd.source = source
+	sd.uid = source.Uid
+
+	var err error
+	sd.sourceTablet, err = findRdonly(sd.wr, cell, source.Keyspace, source.Shard)
+	if err != nil {
+		return err
+	}
+	sd.destinationTablet, err = findRdonly(sd.wr, cell, destination.Keyspace(), destination.ShardName())
+	if err != nil {
+		return err
+	}
+	sd.destinationMaster, err = findMaster(sd.wr, destination.Keyspace(), destination.ShardName())
+	if err != nil {
+		return err
+	}
+
+	for _, ti := range []*topo.TabletInfo{sd.sourceTablet, sd.destinationTablet} {
+		sd.wr.ResetActionTimeout(30 * time.Second)
+		if err := sd.wr.ChangeType(ti.Alias, topo.TYPE_BACKUP, false); err != nil {
+			return fmt.Errorf("cannot change type of %v to %v: %v", ti.Alias, topo.TYPE_BACKUP, err)
+		}
+		sd.changedTypes = append(sd.changedTypes, ti.Alias)
+	}
+	return nil
+}
+
+// synchronizeReplication stops both rdonly tablets at the same
+// point in the source shard history:
+// 1 - stop filtered replication on the destination master, and get
+// its position in the source logs.
+// 2 - stop the source rdonly at or after that position.
+// 3 - run filtered replication on the destination master until it
+// reaches the position of the source rdonly, and get the master
+// position.
+// 4 - stop the destination rdonly at that master position.
+// 5 - restart filtered replication on the destination master.
+func (sd *shardDiffer) synchronizeReplication() error {
+	ai := sd.wr.ActionInitiator()
+
+	// 1 - stop filtered replication
+	sd.blpStopped = true
+	blpPositionList, err := ai.StopBlp(sd.destinationMaster, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("cannot stop filtered replication on %v: %v", sd.destinationMaster.Alias, err)
+	}
+	blpPos, err := blpPositionList.FindBlpPositionById(sd.uid)
+	if err != nil {
+		return fmt.Errorf("no filtered replication position on %v: %v", sd.destinationMaster.Alias, err)
+	}
+
+	// 2 - stop the source rdonly
+	sd.stoppedSlaves = append(sd.stoppedSlaves, sd.sourceTablet)
+	sourcePosition, err := ai.StopSlaveMinimum(sd.sourceTablet, blpPos.GroupId, syncReplicationTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot stop replication on %v at group id %v: %v", sd.sourceTablet.Alias, blpPos.GroupId, err)
+	}
+	log.Infof("source tablet %v stopped at group id %v", sd.sourceTablet.Alias, sourcePosition.MasterLogGroupId)
+
+	// 3 - catch up filtered replication
+	stopPositionList := &mysqlctl.BlpPositionList{
+		Entries: []mysqlctl.BlpPosition{
+			mysqlctl.BlpPosition{Uid: sd.uid, GroupId: sourcePosition.MasterLogGroupId},
+		},
+	}
+	masterPosition, err := ai.RunBlpUntil(sd.destinationMaster, stopPositionList, syncReplicationTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot run filtered replication on %v until group id %v: %v", sd.destinationMaster.Alias, sourcePosition.MasterLogGroupId, err)
+	}
+
+	// 4 - stop the destination rdonly
+	sd.stoppedSlaves = append(sd.stoppedSlaves, sd.destinationTablet)
+	destinationPosition, err := ai.StopSlaveMinimum(sd.destinationTablet, masterPosition.MasterLogGroupId, syncReplicationTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot stop replication on %v at group id %v: %v", sd.destinationTablet.Alias, masterPosition.MasterLogGroupId, err)
+	}
+	if destinationPosition.MasterLogGroupId != masterPosition.MasterLogGroupId {
+		return fmt.Errorf("destination tablet %v stopped at group id %v, expected %v", sd.destinationTablet.Alias, destinationPosition.MasterLogGroupId, masterPosition.MasterLogGroupId)
+	}
+
+	// 5 - restart filtered replication
+	if err := ai.StartBlp(sd.destinationMaster, 30*time.Second); err != nil {
+		return fmt.Errorf("cannot restart filtered replication on %v: %v", sd.destinationMaster.Alias, err)
+	}
+	sd.blpStopped = false
+	return nil
+}
+
+// diff compares the tables accepted by include on both rdonly
+// tablets, one chunk at a time, and records a report per table.
+// where is an optional condition to restrict the rows read on the
+// source. It returns an error if any difference was found. The
+// reports are then saved in the global topology, see saveReport.
+func (sd *shardDiffer) diff(include func(table string) bool, where string) error {
+	startTime := time.Now()
+	err := sd.compare(include, where)
+	if serr := sd.saveReport(startTime, err); serr != nil {
+		if err == nil {
+			return serr
+		}
+		log.Errorf("cannot save the diff report after another error: %v", serr)
+	}
+	return err
+}
+
+// compare does the work of diff.
+func (sd *shardDiffer) compare(include func(table string) bool, where string) error {
+	sourceSchema, err := sd.wr.ActionInitiator().GetSchema(sd.sourceTablet, nil, false, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("cannot get schema from %v: %v", sd.sourceTablet.Alias, err)
+	}
+	destinationSchema, err := sd.wr.ActionInitiator().GetSchema(sd.destinationTablet, nil, false, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("cannot get schema from %v: %v", sd.destinationTablet.Alias, err)
+	}
+	destinationTables := make(map[string]mysqlctl.TableDefinition)
+	for _, td := range destinationSchema.TableDefinitions {
+		destinationTables[td.Name] = td
+	}
+
+	// only diff the tables that are on both sides with the same
+	// columns, the others are differences already
+	rec := cc.AllErrorRecorder{}
+	tables := make([]*mysqlctl.TableDefinition, 0, len(sourceSchema.TableDefinitions))
+	for i, td := range sourceSchema.TableDefinitions {
+		if td.Type != mysqlctl.TABLE_BASE_TABLE || !include(td.Name) {
+			continue
+		}
+		dtd, ok := destinationTables[td.Name]
+		if !ok {
+			rec.RecordError(fmt.Errorf("table %v is missing on %v", td.Name, sd.destinationTablet.Alias))
+			continue
+		}
+		if strings.Join(td.Columns, ",") != strings.Join(dtd.Columns, ",") {
+			rec.RecordError(fmt.Errorf("table %v has different columns on %v (%v) and %v (%v)", td.Name, sd.sourceTablet.Alias, td.Columns, sd.destinationTablet.Alias, dtd.Columns))
+			continue
+		}
+		tables = append(tables, diffTableDefinition(&sourceSchema.TableDefinitions[i]))
+	}
+
+	sd.tablesProgress = sd.sw.NewProgress("tables", int64(len(tables)))
+	sd.chunksProgress = sd.sw.NewProgress("chunks", 0)
+
+	throttler := newThrottler(sd.config.MaxChunksPerSecond)
+	defer throttler.Close()
+	rc := cc.NewResourceConstraint(sd.config.ReaderCount)
+	for _, td := range tables {
+		chunks, err := findChunks(sd.wr, sd.sourceTablet, td, sd.config.MinTableSizeForSplit, sd.config.MaxChunkSize, sd.config.ReaderCount)
+		if err != nil {
+			rc.RecordError(err)
+			break
+		}
+		keyTypes, err := findKeyTypes(sd.wr, sd.sourceTablet, td)
+		if err != nil {
+			rc.RecordError(err)
+			break
+		}
+
+		sd.reportsMu.Lock()
+		sd.reports[td.Name] = &DiffReport{}
+		sd.reportsMu.Unlock()
+
+		remainingChunks := new(sync2.AtomicInt64)
+		remainingChunks.Set(int64(len(chunks)))
+		for _, c := range chunks {
+			rc.Add(1)
+			go func(td *mysqlctl.TableDefinition, keyTypes []int64, c chunk, remainingChunks *sync2.AtomicInt64) {
+				rc.Acquire()
+				defer rc.ReleaseAndDone()
+				if rc.HasErrors() {
+					return
+				}
+				if err := throttler.Wait(sd.sw.Interrupted()); err != nil {
+					rc.RecordError(err)
+					return
+				}
+				if err := sd.diffChunk(td, keyTypes, c, where); err != nil {
+					rc.RecordError(err)
+					return
+				}
+				sd.chunksProgress.Add(1)
+				if remainingChunks.Add(-1) == 0 {
+					log.Infof("table %v diffed", td.Name)
+					sd.tablesProgress.Add(1)
+				}
+			}(td, keyTypes, c, remainingChunks)
+		}
+	}
+	if err := rc.Wait(); err != nil {
+		return err
+	}
+
+	// and see if we found any difference
+	for _, line := range sd.reportLines() {
+		log.Infof("diff report: %v", line)
+	}
+	sd.reportsMu.Lock()
+	for table, dr := range sd.reports {
+		if dr.HasDifferences() {
+			rec.RecordError(fmt.Errorf("table %v has differences: %v", table, dr))
+		}
+	}
+	sd.reportsMu.Unlock()
+	return rec.Error()
+}
+
+// diffChunk compares one chunk of a table between the source and
+// destination rdonly tablets. keyTypes are the field types of the
+// primary key columns.
+func (sd *shardDiffer) diffChunk(td *mysqlctl.TableDefinition, keyTypes []int64, c chunk, where string) error {
+	columns := checksumColumns(td)
+	orderBy := diffOrderBy(td, keyTypes)
+	sourceResult, err := readChunk(sd.wr, sd.sourceTablet, buildSQLFromChunk(sd.sourceTablet.DbName(), td, columns, c, where, orderBy))
+	if err != nil {
+		return err
+	}
+	destinationResult, err := readChunk(sd.wr, sd.destinationTablet, buildSQLFromChunk(sd.destinationTablet.DbName(), td, columns, c, "", orderBy))
+	if err != nil {
+		return err
+	}
+
+	dr, samples := diffRows(sourceResult.Rows, destinationResult.Rows, keyTypes, maxDiffSamples)
+	for _, sample := range samples {
+		log.Warningf("table %v chunk %v: %v", td.Name, c, sample)
+	}
+	sd.reportsMu.Lock()
+	sd.reports[td.Name].Add(dr)
+	for _, sample := range samples {
+		if len(sd.samples[td.Name]) < maxDiffSamples {
+			sd.samples[td.Name] = append(sd.samples[td.Name], sample)
+		}
+	}
+	sd.reportsMu.Unlock()
+	return nil
+}
+
+// topoReport returns the reports of all the tables, as stored in the
+// global topology.
+func (sd *shardDiffer) topoReport(startTime time.Time, diffErr error) *topo.DiffReport {
+	result := &topo.DiffReport{
+		Worker:            sd.name,
+		SourceKeyspace:    sd.source.Keyspace,
+		SourceShard:       sd.source.Shard,
+		SourceTablet:      sd.sourceTablet.Alias,
+		DestinationTablet: sd.destinationTablet.Alias,
+		StartTime:         startTime.Unix(),
+		EndTime:           time.Now().Unix(),
+		Tables:            make(map[string]*topo.TableDiffReport),
+	}
+	if diffErr != nil {
+		result.Error = diffErr.Error()
+	}
+	sd.reportsMu.Lock()
+	defer sd.reportsMu.Unlock()
+	for table, dr := range sd.reports {
+		result.Tables[table] = &topo.TableDiffReport{
+			ProcessedRows:  dr.ProcessedRows,
+			MatchingRows:   dr.MatchingRows,
+			MismatchedRows: dr.MismatchedRows,
+			ExtraRowsLeft:  dr.ExtraRowsLeft,
+			ExtraRowsRight: dr.ExtraRowsRight,
+			Samples:        sd.samples[table],
+		}
+	}
+	return result
+}
+
+// saveReport stores the reports of all the tables in the global
+// topology, with the destination shard. They can be read with the
+// vtctl GetDiffReport command.
+func (sd *shardDiffer) saveReport(startTime time.Time, diffErr error) error {
+	report := sd.topoReport(startTime, diffErr)
+	keyspace, shard := sd.destinationShard.Keyspace(), sd.destinationShard.ShardName()
+	uid, err := sd.wr.TopoServer().CreateDiffReport(keyspace, shard, report)
+	if err != nil {
+		return fmt.Errorf("cannot save diff report for %v/%v: %v", keyspace, shard, err)
+	}
+	log.Infof("diff report saved as %v for %v/%v", uid, keyspace, shard)
+	return nil
+}
+
+// cleanUp restarts filtered replication if it is still stopped,
+// restarts replication on the rdonly tablets, and puts them back in
+// the serving graph.
+func (sd *shardDiffer) cleanUp() error {
+	rec := cc.AllErrorRecorder{}
+	if sd.blpStopped {
+		if err := sd.wr.ActionInitiator().StartBlp(sd.destinationMaster, 30*time.Second); err != nil {
+			rec.RecordError(fmt.Errorf("cannot restart filtered replication on %v: %v", sd.destinationMaster.Alias, err))
+		}
+	}
+	for _, ti := range sd.stoppedSlaves {
+		if _, err := sd.wr.ActionInitiator().ExecuteFetch(ti, "START SLAVE", 0, false, false, 30*time.Second); err != nil {
+			rec.RecordError(fmt.Errorf("cannot restart replication on %v: %v", ti.Alias, err))
+		}
+	}
+	for _, alias := range sd.changedTypes {
+		sd.wr.ResetActionTimeout(30 * time.Second)
+		if err := sd.wr.ChangeType(alias, topo.TYPE_RDONLY, false); err != nil {
+			rec.RecordError(fmt.Errorf("cannot change type of %v back to %v: %v", alias, topo.TYPE_RDONLY, err))
+		}
+	}
+	return rec.Error()
+}
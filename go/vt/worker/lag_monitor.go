@@ -0,0 +1,141 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+const (
+	// lagCheckInterval is how often the lagMonitor checks the
+	// replication lag of the destination slaves.
+	lagCheckInterval = 10 * time.Second
+)
+
+// lagMonitor pauses the clone workers while the replication lag of
+// the slaves of the destination shards is too high: the masters can
+// take the INSERTs a lot faster than their slaves can replicate them.
+// It is safe to use from multiple go routines.
+type lagMonitor struct {
+	maxLag   uint
+	checkLag func() (uint, error)
+	interval time.Duration
+
+	mu   sync.Mutex
+	lag  uint
+	done chan struct{}
+}
+
+// newLagMonitor returns a lagMonitor that calls checkLag every
+// interval, and pauses the workers while the lag is over maxLag
+// seconds. If maxLag is 0, the lag is not monitored.
+func newLagMonitor(maxLag uint, checkLag func() (uint, error), interval time.Duration) *lagMonitor {
+	lm := &lagMonitor{
+		maxLag:   maxLag,
+		checkLag: checkLag,
+		interval: interval,
+	}
+	if maxLag == 0 {
+		return lm
+	}
+	lm.done = make(chan struct{})
+	lm.check()
+	go func() {
+		for {
+			select {
+			case <-lm.done:
+				return
+			case <-time.After(interval):
+				lm.check()
+			}
+		}
+	}()
+	return lm
+}
+
+// check updates the lag. If checkLag fails, the previous lag is kept.
+func (lm *lagMonitor) check() {
+	lag, err := lm.checkLag()
+	if err != nil {
+		log.Warningf("cannot check replication lag: %v", err)
+		return
+	}
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if lag > lm.maxLag && lm.lag <= lm.maxLag {
+		log.Infof("replication lag is %vs, over %vs, pausing", lag, lm.maxLag)
+	} else if lag <= lm.maxLag && lm.lag > lm.maxLag {
+		log.Infof("replication lag is %vs, resuming", lag)
+	}
+	lm.lag = lag
+}
+
+// Lag returns the last known replication lag.
+func (lm *lagMonitor) Lag() uint {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.lag
+}
+
+// Wait blocks while the replication lag is too high. It returns
+// ErrInterrupted if interrupted is closed while waiting.
+func (lm *lagMonitor) Wait(interrupted <-chan struct{}) error {
+	if lm.maxLag == 0 {
+		return nil
+	}
+	for lm.Lag() > lm.maxLag {
+		select {
+		case <-interrupted:
+			return ErrInterrupted
+		case <-time.After(lm.interval):
+		}
+	}
+	return nil
+}
+
+// Close stops the monitoring.
+func (lm *lagMonitor) Close() {
+	if lm.done != nil {
+		close(lm.done)
+	}
+}
+
+// destinationLag returns the maximum replication lag of the serving
+// slaves of the shards of masters. Slaves that cannot be reached, or
+// whose replication is stopped, are ignored: they would pause the
+// workers forever.
+func destinationLag(wr *wrangler.Wrangler, masters []*topo.TabletInfo) (uint, error) {
+	var result uint
+	for _, master := range masters {
+		tablets, err := wrangler.GetTabletMapForShard(wr.TopoServer(), master.Keyspace, master.Shard)
+		if err != nil && err != topo.ErrPartialResult {
+			return 0, err
+		}
+		for _, ti := range tablets {
+			if ti.Type == topo.TYPE_MASTER || !topo.IsServingType(ti.Type) {
+				continue
+			}
+			pos, err := wr.ActionInitiator().SlavePosition(ti, 30*time.Second)
+			if err != nil {
+				log.Warningf("cannot get replication lag of %v: %v", ti.Alias, err)
+				continue
+			}
+			if pos.SecondsBehindMaster == mysqlctl.InvalidLagSeconds {
+				log.Warningf("replication is stopped on %v, ignoring its lag", ti.Alias)
+				continue
+			}
+			if pos.SecondsBehindMaster > result {
+				result = pos.SecondsBehindMaster
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLagMonitor(t *testing.T) {
+	var mu sync.Mutex
+	lag := uint(20)
+	checkLag := func() (uint, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if lag == 0 {
+			return 0, fmt.Errorf("no lag")
+		}
+		return lag, nil
+	}
+	lm := newLagMonitor(10, checkLag, 10*time.Millisecond)
+	defer lm.Close()
+
+	// too much lag, Wait blocks until interrupted
+	interrupted := make(chan struct{})
+	close(interrupted)
+	if err := lm.Wait(interrupted); err != ErrInterrupted {
+		t.Errorf("Wait with lag: got %v, want ErrInterrupted", err)
+	}
+
+	// the lag goes down, Wait returns
+	mu.Lock()
+	lag = 5
+	mu.Unlock()
+	if err := lm.Wait(make(chan struct{})); err != nil {
+		t.Errorf("Wait: %v", err)
+	}
+	if lm.Lag() != 5 {
+		t.Errorf("Lag: got %v, want 5", lm.Lag())
+	}
+
+	// errors keep the previous lag
+	mu.Lock()
+	lag = 0
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	if lm.Lag() != 5 {
+		t.Errorf("Lag after errors: got %v, want 5", lm.Lag())
+	}
+
+	// a disabled monitor never waits
+	disabled := newLagMonitor(0, checkLag, time.Hour)
+	defer disabled.Close()
+	if err := disabled.Wait(interrupted); err != nil {
+		t.Errorf("disabled Wait: %v", err)
+	}
+}
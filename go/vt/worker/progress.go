@@ -0,0 +1,79 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/youtube/vitess/go/sync2"
+)
+
+// Progress is a named counter used by workers to report how far
+// along they are in a phase (rows copied, chunks diffed, ...).
+// All methods are safe to call concurrently.
+type Progress struct {
+	Name string
+
+	done      sync2.AtomicInt64
+	total     int64
+	startTime time.Time
+}
+
+// Add records n more units of work as done.
+func (p *Progress) Add(n int64) {
+	p.done.Add(n)
+}
+
+// Set records the absolute number of units of work done (used when
+// resuming from a checkpoint).
+func (p *Progress) Set(n int64) {
+	p.done.Set(n)
+}
+
+// Done returns how many units of work have been completed.
+func (p *Progress) Done() int64 {
+	return p.done.Get()
+}
+
+// Total returns the expected total, or 0 if unknown.
+func (p *Progress) Total() int64 {
+	return p.total
+}
+
+// Percent returns the completion percentage, or -1 if the total is unknown.
+func (p *Progress) Percent() int {
+	if p.total <= 0 {
+		return -1
+	}
+	done := p.done.Get()
+	if done >= p.total {
+		return 100
+	}
+	return int(done * 100 / p.total)
+}
+
+// ETA returns the estimated remaining time based on the rate so far,
+// or 0 if it cannot be computed.
+func (p *Progress) ETA() time.Duration {
+	done := p.done.Get()
+	if p.total <= 0 || done <= 0 || done >= p.total {
+		return 0
+	}
+	elapsed := time.Now().Sub(p.startTime)
+	return time.Duration(float64(elapsed) * float64(p.total-done) / float64(done))
+}
+
+func (p *Progress) String() string {
+	done := p.done.Get()
+	if p.total <= 0 {
+		return fmt.Sprintf("%v: %v", p.Name, done)
+	}
+	result := fmt.Sprintf("%v: %v/%v (%v%%)", p.Name, done, p.total, p.Percent())
+	if eta := p.ETA(); eta > 0 {
+		result += fmt.Sprintf(" ETA %v", eta-eta%time.Second)
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// reshardWorkers runs the SplitClone and SplitDiff workers for the
+// Reshard workflow of the wrangler. The parameters it uses are:
+//   - cell: only use rdonly tablets in this cell
+//   - key_name: the keyspace id column
+//   - key_type: the type of the key column (uint64 or bytes)
+//   - resolver: the keyspace id resolver for the copy
+//   - exclude_tables: comma separated list of tables to exclude
+//   - clone_flags and diff_flags: flags for the CopyConfig and the
+//     DiffConfig, as they are given to vtworker.
+type reshardWorkers struct{}
+
+func init() {
+	wrangler.RegisterReshardWorkers(reshardWorkers{})
+}
+
+func excludeTablesParam(params map[string]string) []string {
+	if params["exclude_tables"] == "" {
+		return nil
+	}
+	return strings.Split(params["exclude_tables"], ",")
+}
+
+// SplitClone is part of the wrangler.ReshardWorkers interface.
+func (reshardWorkers) SplitClone(wr *wrangler.Wrangler, keyspace, shard string, params map[string]string) error {
+	if params["key_name"] == "" {
+		return fmt.Errorf("SplitClone needs a key_name")
+	}
+	resolverName := params["resolver"]
+	if resolverName == "" {
+		resolverName = "numeric"
+	}
+	resolver, err := key.GetResolver(resolverName)
+	if err != nil {
+		return err
+	}
+	config := CopyConfig{}
+	subFlags := flag.NewFlagSet("SplitClone", flag.ContinueOnError)
+	RegisterCopyFlags(subFlags, &config)
+	if err := subFlags.Parse(strings.Fields(params["clone_flags"])); err != nil {
+		return err
+	}
+	return NewSplitCloneWorker(wr, params["cell"], keyspace, shard, strings.Split(params["key_name"], ","), resolver, excludeTablesParam(params), config).Run()
+}
+
+// SplitDiff is part of the wrangler.ReshardWorkers interface.
+func (reshardWorkers) SplitDiff(wr *wrangler.Wrangler, keyspace, shard string, params map[string]string) error {
+	if params["key_name"] == "" {
+		return fmt.Errorf("SplitDiff needs a key_name")
+	}
+	keyType := params["key_type"]
+	if keyType == "" {
+		keyType = "uint64"
+	}
+	kit, err := key.ParseKeyspaceIdType(keyType)
+	if err != nil {
+		return err
+	}
+	config := DiffConfig{}
+	subFlags := flag.NewFlagSet("SplitDiff", flag.ContinueOnError)
+	RegisterDiffFlags(subFlags, &config)
+	if err := subFlags.Parse(strings.Fields(params["diff_flags"])); err != nil {
+		return err
+	}
+	return NewSplitDiffWorker(wr, params["cell"], keyspace, shard, params["key_name"], kit, excludeTablesParam(params), config).Run()
+}
@@ -0,0 +1,76 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"time"
+)
+
+// SleepWorker is a trivial Resumable worker that sleeps for a given
+// duration, one second at a time. It is used to test vtworker.
+type SleepWorker struct {
+	StatusWorker
+
+	duration time.Duration
+	progress *Progress
+}
+
+// sleepCheckpoint is the saved state of a SleepWorker.
+type sleepCheckpoint struct {
+	Slept int64
+}
+
+// NewSleepWorker returns a SleepWorker that will sleep for duration.
+func NewSleepWorker(duration time.Duration) *SleepWorker {
+	sw := &SleepWorker{
+		StatusWorker: NewStatusWorker(),
+		duration:     duration,
+	}
+	sw.progress = sw.NewProgress("seconds", int64(duration/time.Second))
+	return sw
+}
+
+func (sw *SleepWorker) StatusAsHTML() template.HTML {
+	return template.HTML(fmt.Sprintf("<b>Sleeping for:</b> %v</br>\n", sw.duration)) + sw.StatusHeaderAsHTML()
+}
+
+func (sw *SleepWorker) StatusAsText() string {
+	return fmt.Sprintf("Sleeping for: %v\n", sw.duration) + sw.StatusHeaderAsText()
+}
+
+func (sw *SleepWorker) CheckpointState() interface{} {
+	return &sleepCheckpoint{Slept: sw.progress.Done()}
+}
+
+func (sw *SleepWorker) RestoreCheckpoint(data json.RawMessage) error {
+	cp := &sleepCheckpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return err
+	}
+	sw.progress.Set(cp.Slept)
+	return nil
+}
+
+func (sw *SleepWorker) Run() error {
+	sw.SetState(WorkerStateRunning)
+	err := sw.run()
+	sw.RecordError(err)
+	return err
+}
+
+func (sw *SleepWorker) run() error {
+	for sw.progress.Done() < sw.progress.Total() {
+		select {
+		case <-sw.Interrupted():
+			return ErrInterrupted
+		case <-time.After(time.Second):
+		}
+		sw.progress.Add(1)
+	}
+	return nil
+}
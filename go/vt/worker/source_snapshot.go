@@ -0,0 +1,114 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// This file contains the consistent snapshot of the source rdonly
+// tablets of the clone workers. When the chunks are read from more
+// than one rdonly tablet, they all have to be stopped at the same
+// replication position, which is then where filtered replication
+// starts on the destinations.
+
+// mostAdvancedPosition returns the index of the position with the
+// highest group id.
+func mostAdvancedPosition(positions []*mysqlctl.ReplicationPosition) (int, error) {
+	result := -1
+	var max int64
+	for i, pos := range positions {
+		groupId, err := strconv.ParseInt(pos.MasterLogGroupId, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid group id %v: %v", pos.MasterLogGroupId, err)
+		}
+		if result == -1 || groupId > max {
+			result = i
+			max = groupId
+		}
+	}
+	if result == -1 {
+		return 0, fmt.Errorf("no position")
+	}
+	return result, nil
+}
+
+// startSlaveUntilQuery returns the query that makes a stopped slave
+// replicate until pos, and stop there.
+func startSlaveUntilQuery(pos *mysqlctl.ReplicationPosition) string {
+	return fmt.Sprintf("START SLAVE UNTIL MASTER_LOG_FILE='%v', MASTER_LOG_POS=%v", pos.MasterLogFile, pos.MasterLogPosition)
+}
+
+// synchronizeSources brings tablets, whose replication is stopped, to
+// the same position: the most advanced one. The other tablets
+// replicate until it, and are stopped again. It returns the common
+// position.
+func synchronizeSources(wr *wrangler.Wrangler, tablets []*topo.TabletInfo) (*mysqlctl.ReplicationPosition, error) {
+	ai := wr.ActionInitiator()
+	positions := make([]*mysqlctl.ReplicationPosition, len(tablets))
+	for i, ti := range tablets {
+		var err error
+		positions[i], err = ai.SlavePosition(ti, 30*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get replication position of %v: %v", ti.Alias, err)
+		}
+	}
+	i, err := mostAdvancedPosition(positions)
+	if err != nil {
+		return nil, err
+	}
+	target := positions[i]
+
+	for i, ti := range tablets {
+		if positions[i].MasterLogGroupId == target.MasterLogGroupId {
+			continue
+		}
+		log.Infof("catching up source tablet %v from group id %v to %v", ti.Alias, positions[i].MasterLogGroupId, target.MasterLogGroupId)
+		if _, err := ai.ExecuteFetch(ti, startSlaveUntilQuery(target), 0, false, false, 30*time.Second); err != nil {
+			return nil, fmt.Errorf("cannot start replication on %v until group id %v: %v", ti.Alias, target.MasterLogGroupId, err)
+		}
+		pos, err := waitForSQLThreadStop(wr, ti, syncReplicationTimeout)
+		if err != nil {
+			return nil, err
+		}
+		// START SLAVE UNTIL only stops the SQL thread
+		if err := ai.StopSlave(ti, 30*time.Second); err != nil {
+			return nil, fmt.Errorf("cannot stop replication on %v: %v", ti.Alias, err)
+		}
+		if pos.MasterLogGroupId != target.MasterLogGroupId {
+			return nil, fmt.Errorf("source tablet %v stopped at group id %v, expected %v", ti.Alias, pos.MasterLogGroupId, target.MasterLogGroupId)
+		}
+	}
+	return target, nil
+}
+
+// waitForSQLThreadStop waits until the replication SQL thread of a
+// tablet stops, and returns where it stopped.
+func waitForSQLThreadStop(wr *wrangler.Wrangler, ti *topo.TabletInfo, timeout time.Duration) (*mysqlctl.ReplicationPosition, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := wr.ActionInitiator().GetSlaveStatus(ti, 30*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get replication status of %v: %v", ti.Alias, err)
+		}
+		if !status.SlaveSQLRunning {
+			if status.LastSQLError != "" {
+				return nil, fmt.Errorf("replication failed on %v: %v", ti.Alias, status.LastSQLError)
+			}
+			return &status.Position, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for replication to stop on %v", ti.Alias)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+)
+
+func TestMostAdvancedPosition(t *testing.T) {
+	positions := []*mysqlctl.ReplicationPosition{
+		{MasterLogGroupId: "9"},
+		{MasterLogGroupId: "12"},
+		{MasterLogGroupId: "10"},
+	}
+	if i, err := mostAdvancedPosition(positions); err != nil || i != 1 {
+		t.Errorf("mostAdvancedPosition: got %v %v, want 1", i, err)
+	}
+	positions[0].MasterLogGroupId = "x"
+	if _, err := mostAdvancedPosition(positions); err == nil {
+		t.Errorf("mostAdvancedPosition with an invalid group id should have failed")
+	}
+	if _, err := mostAdvancedPosition(nil); err == nil {
+		t.Errorf("mostAdvancedPosition without positions should have failed")
+	}
+}
+
+func TestStartSlaveUntilQuery(t *testing.T) {
+	pos := &mysqlctl.ReplicationPosition{MasterLogFile: "vt-bin.000012", MasterLogPosition: 4567}
+	if got, want := startSlaveUntilQuery(pos), "START SLAVE UNTIL MASTER_LOG_FILE='vt-bin.000012', MASTER_LOG_POS=4567"; got != want {
+		t.Errorf("startSlaveUntilQuery: got %v want %v", got, want)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// SplitCloneWorker will clone the data from a source shard into the
+// destination shards that cover its key range, and then set up
+// filtered replication from the source shard to the destinations.
+//
+// The source is an rdonly tablet of the source shard. It is taken
+// out of the serving graph and its replication is stopped for the
+// duration of the copy, so the data is consistent with a known
+// replication position. The destinations are the masters of the
+// destination shards, which must already have the right schema.
+type SplitCloneWorker struct {
+	StatusWorker
+
+	wr            *wrangler.Wrangler
+	cell          string
+	keyspace      string
+	shard         string
+	keyColumns    []string
+	resolver      key.KeyspaceIdResolver
+	excludeTables []string
+	copier        *tableCopier
+
+	// populated during WorkerStateInit
+	sourceShard       *topo.ShardInfo
+	destinationShards []*topo.ShardInfo
+}
+
+// NewSplitCloneWorker returns a new SplitCloneWorker object. The
+// keyspace id of each row is computed from its keyColumns by resolver.
+func NewSplitCloneWorker(wr *wrangler.Wrangler, cell, keyspace, shard string, keyColumns []string, resolver key.KeyspaceIdResolver, excludeTables []string, config CopyConfig) *SplitCloneWorker {
+	scw := &SplitCloneWorker{
+		StatusWorker:  NewStatusWorker(),
+		wr:            wr,
+		cell:          cell,
+		keyspace:      keyspace,
+		shard:         shard,
+		keyColumns:    keyColumns,
+		resolver:      resolver,
+		excludeTables: excludeTables,
+	}
+	scw.copier = newTableCopier(&scw.StatusWorker, wr, config)
+	return scw
+}
+
+func (scw *SplitCloneWorker) description() string {
+	result := fmt.Sprintf("Cloning %v/%v using key %v", scw.keyspace, scw.shard, strings.Join(scw.keyColumns, ","))
+	if len(scw.destinationShards) > 0 {
+		names := make([]string, len(scw.destinationShards))
+		for i, si := range scw.destinationShards {
+			names[i] = si.ShardName()
+		}
+		result += " into " + strings.Join(names, ", ")
+	}
+	if len(scw.copier.sourceTablets) > 0 {
+		result += " from " + scw.copier.sourcesDescription()
+	}
+	return result
+}
+
+// StatusAsHTML is part of the Worker interface.
+func (scw *SplitCloneWorker) StatusAsHTML() template.HTML {
+	return template.HTML("<b>"+template.HTMLEscapeString(scw.description())+"</b></br>\n") + scw.StatusHeaderAsHTML()
+}
+
+// StatusAsText is part of the Worker interface.
+func (scw *SplitCloneWorker) StatusAsText() string {
+	return scw.description() + "\n" + scw.StatusHeaderAsText()
+}
+
+// Run is part of the Worker interface. It always runs the clean up
+// phase, even if the copy failed.
+func (scw *SplitCloneWorker) Run() error {
+	err := scw.run()
+
+	scw.SetState(WorkerStateCleanUp)
+	if cerr := scw.copier.cleanUp(); cerr != nil {
+		if err == nil {
+			err = cerr
+		} else {
+			log.Errorf("clean up failed after another error: %v", cerr)
+		}
+	}
+
+	scw.RecordError(err)
+	return err
+}
+
+func (scw *SplitCloneWorker) run() error {
+	// first state: read what we need to do
+	if err := scw.init(); err != nil {
+		return fmt.Errorf("init() failed: %v", err)
+	}
+	if err := scw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// second state: find targets
+	if err := scw.findTargets(); err != nil {
+		return fmt.Errorf("findTargets() failed: %v", err)
+	}
+	if err := scw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// third state: copy data
+	if err := scw.copy(); err != nil {
+		return fmt.Errorf("copy() failed: %v", err)
+	}
+	if err := scw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// last state: set up filtered replication
+	if err := scw.copier.setUpFilteredReplication(scw.destinationShards, topo.SourceShard{
+		Uid:      0,
+		Keyspace: scw.keyspace,
+		Shard:    scw.shard,
+		KeyRange: scw.sourceShard.KeyRange,
+	}); err != nil {
+		return fmt.Errorf("setUpFilteredReplication() failed: %v", err)
+	}
+	return nil
+}
+
+// init phase:
+// - read the source shard
+// - find the destination shards, i.e. the shards in the keyspace
+//   whose key range is strictly contained in the source key range
+func (scw *SplitCloneWorker) init() error {
+	scw.SetState(WorkerStateInit)
+
+	var err error
+	scw.sourceShard, err = scw.wr.TopoServer().GetShard(scw.keyspace, scw.shard)
+	if err != nil {
+		return fmt.Errorf("cannot read shard %v/%v: %v", scw.keyspace, scw.shard, err)
+	}
+
+	shards, err := scw.wr.TopoServer().GetShardNames(scw.keyspace)
+	if err != nil {
+		return fmt.Errorf("cannot list shards in keyspace %v: %v", scw.keyspace, err)
+	}
+	for _, shard := range shards {
+		if shard == scw.shard {
+			continue
+		}
+		si, err := scw.wr.TopoServer().GetShard(scw.keyspace, shard)
+		if err != nil {
+			return fmt.Errorf("cannot read shard %v/%v: %v", scw.keyspace, shard, err)
+		}
+		if !keyRangeContains(scw.sourceShard.KeyRange, si.KeyRange) {
+			continue
+		}
+		if len(si.SourceShards) > 0 {
+			return fmt.Errorf("destination shard %v/%v already has SourceShards: %v", scw.keyspace, shard, si.SourceShards)
+		}
+		scw.destinationShards = append(scw.destinationShards, si)
+	}
+	if len(scw.destinationShards) == 0 {
+		return fmt.Errorf("no destination shard found for %v/%v", scw.keyspace, scw.shard)
+	}
+	return nil
+}
+
+// keyRangeContains returns true if inner is fully contained in outer.
+func keyRangeContains(outer, inner key.KeyRange) bool {
+	if inner.Start < outer.Start {
+		return false
+	}
+	if outer.End == key.MaxKey {
+		return true
+	}
+	return inner.End != key.MaxKey && inner.End <= outer.End
+}
+
+// findTargets phase:
+// - find the masters of the destination shards
+// - find the rdonly tablets in the source shard (or the ones of the
+//   copy state when resuming)
+// - take them out of serving, and stop their replication at the
+//   same position
+func (scw *SplitCloneWorker) findTargets() error {
+	scw.SetState(WorkerStateFindTargets)
+
+	var err error
+	scw.copier.destinationMasters = make([]*topo.TabletInfo, len(scw.destinationShards))
+	for i, si := range scw.destinationShards {
+		scw.copier.destinationMasters[i], err = findMaster(scw.wr, si.Keyspace(), si.ShardName())
+		if err != nil {
+			return err
+		}
+	}
+
+	return scw.copier.findSources(scw.cell, scw.keyspace, scw.shard)
+}
+
+// copy phase: copies the data from the source to the destinations,
+// routing each row with its keyspace id.
+func (scw *SplitCloneWorker) copy() error {
+	scw.SetState(WorkerStateCopy)
+
+	tables, err := scw.copier.findTables(func(table string) bool {
+		return !tableInList(table, scw.excludeTables)
+	})
+	if err != nil {
+		return err
+	}
+
+	keyRanges := make([]key.KeyRange, len(scw.destinationShards))
+	for i, si := range scw.destinationShards {
+		keyRanges[i] = si.KeyRange
+	}
+	return scw.copier.copy(tables, func(td *mysqlctl.TableDefinition) (rowSplitFunc, error) {
+		keyIndexes := make([]int, len(scw.keyColumns))
+		for i, keyColumn := range scw.keyColumns {
+			keyIndexes[i] = -1
+			for j, column := range td.Columns {
+				if column == keyColumn {
+					keyIndexes[i] = j
+					break
+				}
+			}
+			if keyIndexes[i] == -1 {
+				return nil, fmt.Errorf("table %v doesn't have a %v column", td.Name, keyColumn)
+			}
+		}
+		return NewRowSplitter(keyRanges, scw.resolver, keyIndexes).Split, nil
+	})
+}
+
+// tableInList returns true if table is in tables.
+func tableInList(table string, tables []string) bool {
+	for _, t := range tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
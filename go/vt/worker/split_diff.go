@@ -0,0 +1,136 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"html/template"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// SplitDiffWorker compares the data in a destination shard of a
+// horizontal split with the data in its source shard, for the key
+// range of the destination.
+//
+// It uses an rdonly tablet in both the source and destination
+// shards. Filtered replication on the destination master is paused
+// while both rdonly tablets are stopped at the exact same point, so
+// the data they have is comparable.
+type SplitDiffWorker struct {
+	StatusWorker
+
+	wr            *wrangler.Wrangler
+	cell          string
+	keyspace      string
+	shard         string
+	keyName       string
+	keyType       key.KeyspaceIdType
+	excludeTables []string
+	differ        *shardDiffer
+
+	// populated during WorkerStateInit
+	shardInfo *topo.ShardInfo
+}
+
+// NewSplitDiffWorker returns a new SplitDiffWorker object.
+func NewSplitDiffWorker(wr *wrangler.Wrangler, cell, keyspace, shard, keyName string, keyType key.KeyspaceIdType, excludeTables []string, config DiffConfig) *SplitDiffWorker {
+	sdw := &SplitDiffWorker{
+		StatusWorker:  NewStatusWorker(),
+		wr:            wr,
+		cell:          cell,
+		keyspace:      keyspace,
+		shard:         shard,
+		keyName:       keyName,
+		keyType:       keyType,
+		excludeTables: excludeTables,
+	}
+	sdw.differ = newShardDiffer(&sdw.StatusWorker, wr, "SplitDiff", config)
+	return sdw
+}
+
+func (sdw *SplitDiffWorker) description() string {
+	return fmt.Sprintf("Diffing %v/%v using key %v", sdw.keyspace, sdw.shard, sdw.keyName) + sdw.differ.tabletsDescription()
+}
+
+// StatusAsHTML is part of the Worker interface.
+func (sdw *SplitDiffWorker) StatusAsHTML() template.HTML {
+	result := template.HTML("<b>"+template.HTMLEscapeString(sdw.description())+"</b></br>\n") + sdw.StatusHeaderAsHTML()
+	for _, line := range sdw.differ.reportLines() {
+		result += template.HTML(template.HTMLEscapeString(line) + "</br>\n")
+	}
+	return result
+}
+
+// StatusAsText is part of the Worker interface.
+func (sdw *SplitDiffWorker) StatusAsText() string {
+	result := sdw.description() + "\n" + sdw.StatusHeaderAsText()
+	for _, line := range sdw.differ.reportLines() {
+		result += line + "\n"
+	}
+	return result
+}
+
+// Run is part of the Worker interface. It always runs the clean up
+// phase, even if the diff failed.
+func (sdw *SplitDiffWorker) Run() error {
+	err := sdw.run()
+
+	sdw.SetState(WorkerStateCleanUp)
+	if cerr := sdw.differ.cleanUp(); cerr != nil {
+		if err == nil {
+			err = cerr
+		} else {
+			log.Errorf("clean up failed after another error: %v", cerr)
+		}
+	}
+
+	sdw.RecordError(err)
+	return err
+}
+
+func (sdw *SplitDiffWorker) run() error {
+	// first state: read what we need to do
+	sdw.SetState(WorkerStateInit)
+	var err error
+	sdw.shardInfo, err = sdw.wr.TopoServer().GetShard(sdw.keyspace, sdw.shard)
+	if err != nil {
+		return fmt.Errorf("init() failed: cannot read shard %v/%v: %v", sdw.keyspace, sdw.shard, err)
+	}
+	if err := sdw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// second state: find targets
+	sdw.SetState(WorkerStateFindTargets)
+	if err := sdw.differ.findTargets(sdw.cell, sdw.shardInfo); err != nil {
+		return fmt.Errorf("findTargets() failed: %v", err)
+	}
+	if err := sdw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// third phase: synchronize replication
+	sdw.SetState(WorkerStateSyncReplication)
+	if err := sdw.differ.synchronizeReplication(); err != nil {
+		return fmt.Errorf("synchronizeReplication() failed: %v", err)
+	}
+	if err := sdw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// fourth phase: diff, only the rows in our key range
+	sdw.SetState(WorkerStateDiff)
+	include := func(table string) bool {
+		return !tableInList(table, sdw.excludeTables)
+	}
+	if err := sdw.differ.diff(include, keyRangeWhere(sdw.keyName, sdw.keyType, sdw.shardInfo.KeyRange)); err != nil {
+		return fmt.Errorf("diff() failed: %v", err)
+	}
+	return nil
+}
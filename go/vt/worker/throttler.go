@@ -0,0 +1,52 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"time"
+)
+
+// throttler limits the rate at which workers do operations (chunk
+// reads, ...). It is safe to use from multiple go routines.
+type throttler struct {
+	ticker *time.Ticker
+}
+
+// newThrottler returns a throttler that allows maxPerSecond operations
+// per second. If maxPerSecond is 0, operations are not throttled.
+func newThrottler(maxPerSecond int) *throttler {
+	if maxPerSecond <= 0 {
+		return &throttler{}
+	}
+	return &throttler{
+		ticker: time.NewTicker(time.Second / time.Duration(maxPerSecond)),
+	}
+}
+
+// Wait blocks until the next operation is allowed. It returns
+// ErrInterrupted if interrupted is closed while waiting.
+func (t *throttler) Wait(interrupted <-chan struct{}) error {
+	if t.ticker == nil {
+		select {
+		case <-interrupted:
+			return ErrInterrupted
+		default:
+			return nil
+		}
+	}
+	select {
+	case <-interrupted:
+		return ErrInterrupted
+	case <-t.ticker.C:
+		return nil
+	}
+}
+
+// Close releases the resources used by the throttler.
+func (t *throttler) Close() {
+	if t.ticker != nil {
+		t.ticker.Stop()
+	}
+}
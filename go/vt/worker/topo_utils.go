@@ -0,0 +1,71 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"sort"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// findRdonly returns an rdonly tablet for the shard. If cell is not
+// empty, only tablets in that cell are considered. The choice is
+// deterministic (lowest alias first), so a restarted worker picks
+// the same tablet.
+func findRdonly(wr *wrangler.Wrangler, cell, keyspace, shard string) (*topo.TabletInfo, error) {
+	tablets, err := findRdonlys(wr, cell, keyspace, shard, 1)
+	if err != nil {
+		return nil, err
+	}
+	return tablets[0], nil
+}
+
+// findRdonlys returns count rdonly tablets for the shard, chosen
+// like findRdonly. It fails if the shard has fewer rdonly tablets.
+func findRdonlys(wr *wrangler.Wrangler, cell, keyspace, shard string, count int) ([]*topo.TabletInfo, error) {
+	tabletMap, err := wrangler.GetTabletMapForShard(wr.TopoServer(), keyspace, shard)
+	if err != nil && err != topo.ErrPartialResult {
+		return nil, fmt.Errorf("cannot read tablets for %v/%v: %v", keyspace, shard, err)
+	}
+
+	aliases := make(topo.TabletAliasList, 0, len(tabletMap))
+	for alias, ti := range tabletMap {
+		if ti.Type != topo.TYPE_RDONLY {
+			continue
+		}
+		if cell != "" && alias.Cell != cell {
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	if len(aliases) == 0 {
+		return nil, fmt.Errorf("no rdonly tablet found in %v/%v (cell %#v)", keyspace, shard, cell)
+	}
+	if len(aliases) < count {
+		return nil, fmt.Errorf("only %v rdonly tablets found in %v/%v (cell %#v), need %v", len(aliases), keyspace, shard, cell, count)
+	}
+	sort.Sort(aliases)
+	result := make([]*topo.TabletInfo, count)
+	for i := range result {
+		result[i] = tabletMap[aliases[i]]
+		log.Infof("using rdonly tablet %v for %v/%v", aliases[i], keyspace, shard)
+	}
+	return result, nil
+}
+
+// findMaster returns the master tablet of a shard.
+func findMaster(wr *wrangler.Wrangler, keyspace, shard string) (*topo.TabletInfo, error) {
+	si, err := wr.TopoServer().GetShard(keyspace, shard)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read shard %v/%v: %v", keyspace, shard, err)
+	}
+	if si.MasterAlias.IsZero() {
+		return nil, fmt.Errorf("shard %v/%v has no master", keyspace, shard)
+	}
+	return wr.TopoServer().GetTablet(si.MasterAlias)
+}
@@ -0,0 +1,197 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// VerticalSplitCloneWorker will clone a list of tables from a source
+// shard into a destination shard, usually in a different keyspace,
+// and then set up filtered replication for these tables from the
+// source to the destination.
+//
+// It works like the SplitCloneWorker: the source is a stopped rdonly
+// tablet, and the destination is the master of the destination
+// shard, which must already have the schema for the tables.
+type VerticalSplitCloneWorker struct {
+	StatusWorker
+
+	wr                  *wrangler.Wrangler
+	cell                string
+	sourceKeyspace      string
+	sourceShard         string
+	destinationKeyspace string
+	destinationShard    string
+	tables              []string
+	copier              *tableCopier
+
+	// populated during WorkerStateInit
+	sourceShardInfo      *topo.ShardInfo
+	destinationShardInfo *topo.ShardInfo
+}
+
+// NewVerticalSplitCloneWorker returns a new VerticalSplitCloneWorker object.
+func NewVerticalSplitCloneWorker(wr *wrangler.Wrangler, cell, sourceKeyspace, sourceShard, destinationKeyspace, destinationShard string, tables []string, config CopyConfig) *VerticalSplitCloneWorker {
+	vscw := &VerticalSplitCloneWorker{
+		StatusWorker:        NewStatusWorker(),
+		wr:                  wr,
+		cell:                cell,
+		sourceKeyspace:      sourceKeyspace,
+		sourceShard:         sourceShard,
+		destinationKeyspace: destinationKeyspace,
+		destinationShard:    destinationShard,
+		tables:              tables,
+	}
+	vscw.copier = newTableCopier(&vscw.StatusWorker, wr, config)
+	return vscw
+}
+
+func (vscw *VerticalSplitCloneWorker) description() string {
+	result := fmt.Sprintf("Cloning tables %v from %v/%v into %v/%v", strings.Join(vscw.tables, ", "), vscw.sourceKeyspace, vscw.sourceShard, vscw.destinationKeyspace, vscw.destinationShard)
+	if len(vscw.copier.sourceTablets) > 0 {
+		result += " from " + vscw.copier.sourcesDescription()
+	}
+	return result
+}
+
+// StatusAsHTML is part of the Worker interface.
+func (vscw *VerticalSplitCloneWorker) StatusAsHTML() template.HTML {
+	return template.HTML("<b>"+template.HTMLEscapeString(vscw.description())+"</b></br>\n") + vscw.StatusHeaderAsHTML()
+}
+
+// StatusAsText is part of the Worker interface.
+func (vscw *VerticalSplitCloneWorker) StatusAsText() string {
+	return vscw.description() + "\n" + vscw.StatusHeaderAsText()
+}
+
+// Run is part of the Worker interface. It always runs the clean up
+// phase, even if the copy failed.
+func (vscw *VerticalSplitCloneWorker) Run() error {
+	err := vscw.run()
+
+	vscw.SetState(WorkerStateCleanUp)
+	if cerr := vscw.copier.cleanUp(); cerr != nil {
+		if err == nil {
+			err = cerr
+		} else {
+			log.Errorf("clean up failed after another error: %v", cerr)
+		}
+	}
+
+	vscw.RecordError(err)
+	return err
+}
+
+func (vscw *VerticalSplitCloneWorker) run() error {
+	// first state: read what we need to do
+	if err := vscw.init(); err != nil {
+		return fmt.Errorf("init() failed: %v", err)
+	}
+	if err := vscw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// second state: find targets
+	if err := vscw.findTargets(); err != nil {
+		return fmt.Errorf("findTargets() failed: %v", err)
+	}
+	if err := vscw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// third state: copy data
+	if err := vscw.copy(); err != nil {
+		return fmt.Errorf("copy() failed: %v", err)
+	}
+	if err := vscw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// last state: set up filtered replication for our tables
+	if err := vscw.copier.setUpFilteredReplication([]*topo.ShardInfo{vscw.destinationShardInfo}, topo.SourceShard{
+		Uid:      0,
+		Keyspace: vscw.sourceKeyspace,
+		Shard:    vscw.sourceShard,
+		KeyRange: vscw.sourceShardInfo.KeyRange,
+		Tables:   vscw.tables,
+	}); err != nil {
+		return fmt.Errorf("setUpFilteredReplication() failed: %v", err)
+	}
+	return nil
+}
+
+// init phase:
+// - read the source and destination shards
+// - make sure the destination isn't already replicating from
+//   somewhere
+func (vscw *VerticalSplitCloneWorker) init() error {
+	vscw.SetState(WorkerStateInit)
+
+	if len(vscw.tables) == 0 {
+		return fmt.Errorf("no table to copy")
+	}
+	var err error
+	vscw.sourceShardInfo, err = vscw.wr.TopoServer().GetShard(vscw.sourceKeyspace, vscw.sourceShard)
+	if err != nil {
+		return fmt.Errorf("cannot read shard %v/%v: %v", vscw.sourceKeyspace, vscw.sourceShard, err)
+	}
+	vscw.destinationShardInfo, err = vscw.wr.TopoServer().GetShard(vscw.destinationKeyspace, vscw.destinationShard)
+	if err != nil {
+		return fmt.Errorf("cannot read shard %v/%v: %v", vscw.destinationKeyspace, vscw.destinationShard, err)
+	}
+	if len(vscw.destinationShardInfo.SourceShards) > 0 {
+		return fmt.Errorf("destination shard %v/%v already has SourceShards: %v", vscw.destinationKeyspace, vscw.destinationShard, vscw.destinationShardInfo.SourceShards)
+	}
+	return nil
+}
+
+// findTargets phase:
+// - find the master of the destination shard
+// - find the rdonly tablets in the source shard (or the ones of the
+//   copy state when resuming)
+// - take them out of serving, and stop their replication at the
+//   same position
+func (vscw *VerticalSplitCloneWorker) findTargets() error {
+	vscw.SetState(WorkerStateFindTargets)
+
+	master, err := findMaster(vscw.wr, vscw.destinationKeyspace, vscw.destinationShard)
+	if err != nil {
+		return err
+	}
+	vscw.copier.destinationMasters = []*topo.TabletInfo{master}
+
+	return vscw.copier.findSources(vscw.cell, vscw.sourceKeyspace, vscw.sourceShard)
+}
+
+// copy phase: copies our tables from the source to the destination,
+// all rows go to the only destination.
+func (vscw *VerticalSplitCloneWorker) copy() error {
+	vscw.SetState(WorkerStateCopy)
+
+	tables, err := vscw.copier.findTables(func(table string) bool {
+		return tableInList(table, vscw.tables)
+	})
+	if err != nil {
+		return err
+	}
+	if len(tables) != len(vscw.tables) {
+		return fmt.Errorf("found only %v of the %v tables to copy on %v", len(tables), len(vscw.tables), vscw.copier.sourceTablet.Alias)
+	}
+
+	return vscw.copier.copy(tables, func(td *mysqlctl.TableDefinition) (rowSplitFunc, error) {
+		return func(rows [][]sqltypes.Value) ([][][]sqltypes.Value, error) {
+			return [][][]sqltypes.Value{rows}, nil
+		}, nil
+	})
+}
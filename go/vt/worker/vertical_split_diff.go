@@ -0,0 +1,131 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"html/template"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// VerticalSplitDiffWorker compares the tables of a destination shard
+// of a vertical split with the same tables in its source shard.
+//
+// It works like the SplitDiffWorker, but the list of tables to
+// compare comes from the SourceShards of the destination shard, and
+// all their rows are compared.
+type VerticalSplitDiffWorker struct {
+	StatusWorker
+
+	wr       *wrangler.Wrangler
+	cell     string
+	keyspace string
+	shard    string
+	differ   *shardDiffer
+
+	// populated during WorkerStateInit
+	shardInfo *topo.ShardInfo
+}
+
+// NewVerticalSplitDiffWorker returns a new VerticalSplitDiffWorker object.
+func NewVerticalSplitDiffWorker(wr *wrangler.Wrangler, cell, keyspace, shard string, config DiffConfig) *VerticalSplitDiffWorker {
+	vsdw := &VerticalSplitDiffWorker{
+		StatusWorker: NewStatusWorker(),
+		wr:           wr,
+		cell:         cell,
+		keyspace:     keyspace,
+		shard:        shard,
+	}
+	vsdw.differ = newShardDiffer(&vsdw.StatusWorker, wr, "VerticalSplitDiff", config)
+	return vsdw
+}
+
+func (vsdw *VerticalSplitDiffWorker) description() string {
+	return fmt.Sprintf("Diffing vertically split %v/%v", vsdw.keyspace, vsdw.shard) + vsdw.differ.tabletsDescription()
+}
+
+// StatusAsHTML is part of the Worker interface.
+func (vsdw *VerticalSplitDiffWorker) StatusAsHTML() template.HTML {
+	result := template.HTML("<b>"+template.HTMLEscapeString(vsdw.description())+"</b></br>\n") + vsdw.StatusHeaderAsHTML()
+	for _, line := range vsdw.differ.reportLines() {
+		result += template.HTML(template.HTMLEscapeString(line) + "</br>\n")
+	}
+	return result
+}
+
+// StatusAsText is part of the Worker interface.
+func (vsdw *VerticalSplitDiffWorker) StatusAsText() string {
+	result := vsdw.description() + "\n" + vsdw.StatusHeaderAsText()
+	for _, line := range vsdw.differ.reportLines() {
+		result += line + "\n"
+	}
+	return result
+}
+
+// Run is part of the Worker interface. It always runs the clean up
+// phase, even if the diff failed.
+func (vsdw *VerticalSplitDiffWorker) Run() error {
+	err := vsdw.run()
+
+	vsdw.SetState(WorkerStateCleanUp)
+	if cerr := vsdw.differ.cleanUp(); cerr != nil {
+		if err == nil {
+			err = cerr
+		} else {
+			log.Errorf("clean up failed after another error: %v", cerr)
+		}
+	}
+
+	vsdw.RecordError(err)
+	return err
+}
+
+func (vsdw *VerticalSplitDiffWorker) run() error {
+	// first state: read what we need to do
+	vsdw.SetState(WorkerStateInit)
+	var err error
+	vsdw.shardInfo, err = vsdw.wr.TopoServer().GetShard(vsdw.keyspace, vsdw.shard)
+	if err != nil {
+		return fmt.Errorf("init() failed: cannot read shard %v/%v: %v", vsdw.keyspace, vsdw.shard, err)
+	}
+	if len(vsdw.shardInfo.SourceShards) != 1 || len(vsdw.shardInfo.SourceShards[0].Tables) == 0 {
+		return fmt.Errorf("init() failed: shard %v/%v doesn't have exactly one source shard with tables: %v", vsdw.keyspace, vsdw.shard, vsdw.shardInfo.SourceShards)
+	}
+	if err := vsdw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// second state: find targets
+	vsdw.SetState(WorkerStateFindTargets)
+	if err := vsdw.differ.findTargets(vsdw.cell, vsdw.shardInfo); err != nil {
+		return fmt.Errorf("findTargets() failed: %v", err)
+	}
+	if err := vsdw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// third phase: synchronize replication
+	vsdw.SetState(WorkerStateSyncReplication)
+	if err := vsdw.differ.synchronizeReplication(); err != nil {
+		return fmt.Errorf("synchronizeReplication() failed: %v", err)
+	}
+	if err := vsdw.CheckInterrupted(); err != nil {
+		return err
+	}
+
+	// fourth phase: diff all the rows of the replicated tables
+	vsdw.SetState(WorkerStateDiff)
+	tables := vsdw.shardInfo.SourceShards[0].Tables
+	include := func(table string) bool {
+		return tableInList(table, tables)
+	}
+	if err := vsdw.differ.diff(include, ""); err != nil {
+		return fmt.Errorf("diff() failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package worker contains the framework, utility methods and core
+functions for long running actions. 'vtworker' binary will use these.
+
+A worker is a long running job (a clone, a diff, ...) that is hosted
+by the vtworker process rather than by vtctl. It reports its progress
+through a status page, can be canceled, and can save checkpoints so
+it can be resumed if vtworker is restarted.
+*/
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"sync"
+	"time"
+)
+
+// Worker is the base interface for all long running workers.
+type Worker interface {
+	// StatusAsHTML returns the current worker status in HTML
+	StatusAsHTML() template.HTML
+
+	// StatusAsText returns the current worker status in plain text
+	StatusAsText() string
+
+	// Run is the main entry point for the worker. It will be called
+	// in a go routine. When Cancel() is called, Run should exit as
+	// soon as possible, and return ErrInterrupted.
+	Run() error
+
+	// Cancel should attempt to force the Worker to exit as soon
+	// as possible. Note that cleanup actions may still run after
+	// cancellation.
+	Cancel()
+}
+
+// ErrInterrupted is returned by workers that were canceled.
+var ErrInterrupted = errors.New("interrupted")
+
+// WorkerState is the state a worker is in. Workers may define
+// their own additional states.
+type WorkerState string
+
+const (
+	WorkerStateNotStarted      WorkerState = "not started"
+	WorkerStateRunning         WorkerState = "running"
+	WorkerStateInit            WorkerState = "initializing"
+	WorkerStateFindTargets     WorkerState = "finding target instances"
+	WorkerStateCopy            WorkerState = "copying the data"
+	WorkerStateSyncReplication WorkerState = "synchronizing replication"
+	WorkerStateDiff            WorkerState = "running the diff"
+	WorkerStateCleanUp         WorkerState = "cleaning up"
+	WorkerStateDone            WorkerState = "done"
+	WorkerStateError           WorkerState = "error"
+	WorkerStateCanceled        WorkerState = "canceled"
+)
+
+// StatusWorker is meant to be embedded by Worker implementations. It
+// keeps track of the worker state, of its progress counters, and
+// implements cancellation.
+type StatusWorker struct {
+	mu        sync.Mutex
+	state     WorkerState
+	err       error
+	startTime time.Time
+	progress  []*Progress
+
+	// interrupted is closed when Cancel is called
+	interrupted chan struct{}
+	cancelOnce  sync.Once
+}
+
+// NewStatusWorker returns a StatusWorker in the WorkerStateNotStarted state.
+func NewStatusWorker() StatusWorker {
+	return StatusWorker{
+		state:       WorkerStateNotStarted,
+		interrupted: make(chan struct{}),
+	}
+}
+
+// SetState changes the worker state.
+func (sw *StatusWorker) SetState(state WorkerState) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if state != WorkerStateNotStarted && sw.startTime.IsZero() {
+		sw.startTime = time.Now()
+	}
+	sw.state = state
+}
+
+// State returns the current worker state.
+func (sw *StatusWorker) State() WorkerState {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.state
+}
+
+// RecordError saves err as the final result of the worker, and
+// changes the state accordingly.
+func (sw *StatusWorker) RecordError(err error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.err = err
+	switch err {
+	case nil:
+		sw.state = WorkerStateDone
+	case ErrInterrupted:
+		sw.state = WorkerStateCanceled
+	default:
+		sw.state = WorkerStateError
+	}
+}
+
+// Error returns the error the worker ended with, if any.
+func (sw *StatusWorker) Error() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.err
+}
+
+// NewProgress creates and registers a new progress counter. total
+// can be 0 if unknown.
+func (sw *StatusWorker) NewProgress(name string, total int64) *Progress {
+	p := &Progress{Name: name, total: total, startTime: time.Now()}
+	sw.mu.Lock()
+	sw.progress = append(sw.progress, p)
+	sw.mu.Unlock()
+	return p
+}
+
+// ProgressList returns a copy of the registered progress counters.
+func (sw *StatusWorker) ProgressList() []*Progress {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	result := make([]*Progress, len(sw.progress))
+	copy(result, sw.progress)
+	return result
+}
+
+// Cancel is part of the Worker interface.
+func (sw *StatusWorker) Cancel() {
+	sw.cancelOnce.Do(func() {
+		close(sw.interrupted)
+	})
+}
+
+// Interrupted returns a channel that is closed when the worker is
+// canceled.
+func (sw *StatusWorker) Interrupted() <-chan struct{} {
+	return sw.interrupted
+}
+
+// CheckInterrupted returns ErrInterrupted if the worker was
+// canceled, nil otherwise. Long loops should call it regularly.
+func (sw *StatusWorker) CheckInterrupted() error {
+	select {
+	case <-sw.interrupted:
+		return ErrInterrupted
+	default:
+		return nil
+	}
+}
+
+// StatusHeaderAsText returns the state, running time and progress
+// counters as text. Workers can use it to build StatusAsText.
+func (sw *StatusWorker) StatusHeaderAsText() string {
+	sw.mu.Lock()
+	state, err, startTime := sw.state, sw.err, sw.startTime
+	sw.mu.Unlock()
+
+	result := fmt.Sprintf("State: %v\n", state)
+	if !startTime.IsZero() {
+		result += fmt.Sprintf("Running for: %v\n", time.Now().Sub(startTime))
+	}
+	if err != nil && err != ErrInterrupted {
+		result += fmt.Sprintf("Error: %v\n", err)
+	}
+	for _, p := range sw.ProgressList() {
+		result += p.String() + "\n"
+	}
+	return result
+}
+
+// StatusHeaderAsHTML is the HTML version of StatusHeaderAsText.
+func (sw *StatusWorker) StatusHeaderAsHTML() template.HTML {
+	sw.mu.Lock()
+	state, err, startTime := sw.state, sw.err, sw.startTime
+	sw.mu.Unlock()
+
+	result := "<b>State:</b> " + template.HTMLEscapeString(string(state)) + "</br>\n"
+	if !startTime.IsZero() {
+		result += fmt.Sprintf("<b>Running for:</b> %v</br>\n", time.Now().Sub(startTime))
+	}
+	if err != nil && err != ErrInterrupted {
+		result += "<b>Error:</b> " + template.HTMLEscapeString(err.Error()) + "</br>\n"
+	}
+	for _, p := range sw.ProgressList() {
+		result += template.HTMLEscapeString(p.String()) + "</br>\n"
+	}
+	return template.HTML(result)
+}
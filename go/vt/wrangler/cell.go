@@ -0,0 +1,193 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// cell related methods for Wrangler
+
+// AddCell registers a new cell in the global topology, with the
+// address of its topology server, so every process can find it
+// without a configuration change. It then rebuilds the serving
+// graph of all keyspaces in the cell.
+func (wr *Wrangler) AddCell(cell, serverAddress string) error {
+	if err := wr.ts.CreateCell(cell, &topo.CellInfo{ServerAddress: serverAddress}); err != nil {
+		return fmt.Errorf("CreateCell(%v) failed: %v", cell, err)
+	}
+
+	keyspaces, err := wr.ts.GetKeyspaces()
+	if err != nil {
+		return err
+	}
+	rec := concurrency.AllErrorRecorder{}
+	for _, keyspace := range keyspaces {
+		shards, err := wr.ts.GetShardNames(keyspace)
+		if err != nil && err != topo.ErrNoNode {
+			rec.RecordError(err)
+			continue
+		}
+		if len(shards) == 0 {
+			// nothing to serve
+			continue
+		}
+		log.Infof("Rebuilding keyspace %v in new cell %v", keyspace, cell)
+		rec.RecordError(wr.RebuildKeyspaceGraph(keyspace, []string{cell}, false))
+	}
+	return rec.Error()
+}
+
+// RemoveCell unregisters a cell. It fails if the cell still has
+// tablets, unless force is set. It removes the cell from the
+// shards and from its cells alias, and deletes the serving and
+// replication graphs of the shards in the cell. The topology server
+// of the cell is left alone.
+func (wr *Wrangler) RemoveCell(cell string, force bool) error {
+	if _, err := wr.ts.GetCellInfo(cell); err != nil {
+		return fmt.Errorf("cell %v is not registered in the global topology: %v", cell, err)
+	}
+
+	aliases, err := wr.ts.GetTabletsByCell(cell)
+	if err != nil && err != topo.ErrNoNode {
+		return err
+	}
+	if len(aliases) > 0 {
+		if !force {
+			return fmt.Errorf("cell %v still has %v tablets, scrap them first (or use -force): %v", cell, len(aliases), aliases)
+		}
+		log.Warningf("removing cell %v with %v tablets", cell, len(aliases))
+	}
+
+	keyspaces, err := wr.ts.GetKeyspaces()
+	if err != nil {
+		return err
+	}
+	for _, keyspace := range keyspaces {
+		shards, err := wr.ts.GetShardNames(keyspace)
+		if err != nil && err != topo.ErrNoNode {
+			return err
+		}
+		for _, shard := range shards {
+			if err := wr.removeShardCell(keyspace, shard, cell); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := wr.removeCellFromAliases(cell); err != nil {
+		return err
+	}
+	return wr.ts.DeleteCell(cell)
+}
+
+// SetCellsAlias creates or replaces a cells alias. The cells have to
+// be known, and not in another alias.
+func (wr *Wrangler) SetCellsAlias(alias string, cells []string) error {
+	knownCells, err := wr.ts.GetKnownCells()
+	if err != nil {
+		return err
+	}
+	for _, cell := range cells {
+		if !inCellList(cell, knownCells) {
+			return fmt.Errorf("cell %v is not a known cell", cell)
+		}
+	}
+
+	aliases, err := wr.ts.GetCellsAliases()
+	if err != nil {
+		return err
+	}
+	for name, ca := range aliases {
+		if name == alias {
+			continue
+		}
+		for _, cell := range cells {
+			if inCellList(cell, ca.Cells) {
+				return fmt.Errorf("cell %v is already in cells alias %v", cell, name)
+			}
+		}
+	}
+	return wr.ts.SaveCellsAlias(alias, &topo.CellsAlias{Cells: cells})
+}
+
+// removeCellFromAliases removes a cell from the cells alias it is in,
+// and deletes the alias if it was its last cell.
+func (wr *Wrangler) removeCellFromAliases(cell string) error {
+	aliases, err := wr.ts.GetCellsAliases()
+	if err != nil {
+		return err
+	}
+	for name, ca := range aliases {
+		cells := make([]string, 0, len(ca.Cells))
+		for _, c := range ca.Cells {
+			if c != cell {
+				cells = append(cells, c)
+			}
+		}
+		switch {
+		case len(cells) == len(ca.Cells):
+			continue
+		case len(cells) == 0:
+			err = wr.ts.DeleteCellsAlias(name)
+		default:
+			err = wr.ts.SaveCellsAlias(name, &topo.CellsAlias{Cells: cells})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeShardCell removes the cell from the shard, and deletes the
+// serving and replication graphs of the shard in the cell.
+func (wr *Wrangler) removeShardCell(keyspace, shard, cell string) error {
+	actionNode := wr.ai.UpdateShard()
+	lockPath, err := wr.lockShard(keyspace, shard, actionNode)
+	if err != nil {
+		return err
+	}
+
+	err = wr.removeShardCellLocked(keyspace, shard, cell)
+	return wr.unlockShard(keyspace, shard, actionNode, lockPath, err)
+}
+
+func (wr *Wrangler) removeShardCellLocked(keyspace, shard, cell string) error {
+	si, err := wr.ts.GetShard(keyspace, shard)
+	if err != nil {
+		return err
+	}
+	if si.HasCell(cell) {
+		cells := make([]string, 0, len(si.Cells))
+		for _, c := range si.Cells {
+			if c != cell {
+				cells = append(cells, c)
+			}
+		}
+		si.Cells = cells
+		if err := wr.ts.UpdateShard(si); err != nil {
+			return err
+		}
+	}
+
+	tabletTypes, err := wr.ts.GetSrvTabletTypesPerShard(cell, keyspace, shard)
+	if err != nil && err != topo.ErrNoNode {
+		return err
+	}
+	for _, tabletType := range tabletTypes {
+		if err := wr.ts.DeleteSrvTabletType(cell, keyspace, shard, tabletType); err != nil && err != topo.ErrNoNode {
+			return err
+		}
+	}
+	if err := wr.ts.DeleteShardReplication(cell, keyspace, shard); err != nil && err != topo.ErrNoNode {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+func TestAddRemoveCell(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	createTestTablet(t, wr, "cell1", 0, topo.TYPE_MASTER, topo.TabletAlias{})
+
+	if err := wr.AddCell("cell2", "cell2host:2181"); err != nil {
+		t.Fatalf("AddCell: %v", err)
+	}
+	if err := wr.AddCell("cell2", "cell2host:2181"); err == nil {
+		t.Errorf("AddCell of an existing cell should have failed")
+	}
+	cells, err := ts.GetKnownCells()
+	if err != nil || len(cells) != 2 || cells[1] != "cell2" {
+		t.Errorf("GetKnownCells: %v %v", cells, err)
+	}
+
+	if err := wr.SetCellsAlias("region", []string{"cell1", "cell2"}); err != nil {
+		t.Fatalf("SetCellsAlias: %v", err)
+	}
+	if err := wr.SetCellsAlias("other", []string{"cell2"}); err == nil {
+		t.Errorf("SetCellsAlias with a cell in another alias should have failed")
+	}
+	if err := wr.SetCellsAlias("other", []string{"cell3"}); err == nil {
+		t.Errorf("SetCellsAlias with an unknown cell should have failed")
+	}
+
+	alias := createTestTablet(t, wr, "cell2", 1, topo.TYPE_REPLICA, topo.TabletAlias{Cell: "cell1", Uid: 0})
+	if err := wr.RemoveCell("cell2", false); err == nil {
+		t.Errorf("RemoveCell with tablets should have failed")
+	}
+	if err := ts.DeleteTablet(alias); err != nil {
+		t.Fatalf("DeleteTablet: %v", err)
+	}
+	if err := wr.RemoveCell("cell2", false); err != nil {
+		t.Fatalf("RemoveCell: %v", err)
+	}
+	si, err := ts.GetShard("test_keyspace", "0")
+	if err != nil || si.HasCell("cell2") {
+		t.Errorf("shard should not have cell2 any more: %v %v", si, err)
+	}
+	if aliases, err := ts.GetCellsAliases(); err != nil || !reflect.DeepEqual(aliases["region"].Cells, []string{"cell1"}) {
+		t.Errorf("cell2 should have been removed from its alias: %v %v", aliases, err)
+	}
+	if _, err := ts.GetCellInfo("cell2"); err != topo.ErrNoNode {
+		t.Errorf("GetCellInfo(cell2): %v", err)
+	}
+	if err := wr.RemoveCell("cell1", false); err == nil {
+		t.Errorf("RemoveCell of a cell that is not registered should have failed")
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// The kinds of ServingGraphFinding.
+const (
+	// a SrvKeyspace for a keyspace that doesn't exist
+	FindingExtraKeyspace = "extra_keyspace"
+
+	// no SrvKeyspace for a keyspace with serving tablets in the cell
+	FindingMissingKeyspace = "missing_keyspace"
+
+	// no SrvShard for a shard with serving tablets in the cell
+	FindingMissingShard = "missing_shard"
+
+	// a shard of a SrvKeyspace that doesn't match any shard
+	FindingExtraShard = "extra_shard"
+
+	// a SrvShard with another key range than its shard
+	FindingKeyRangeMismatch = "key_range_mismatch"
+
+	// a serving tablet type without serving records
+	FindingMissingType = "missing_type"
+
+	// serving records of a type without serving tablets
+	FindingExtraType = "extra_type"
+
+	// a serving tablet that is not in the serving records
+	FindingMissingEndPoint = "missing_endpoint"
+
+	// a serving record of a tablet that is not serving
+	FindingExtraEndPoint = "extra_endpoint"
+
+	// a part of the key space not served by a SrvKeyspace partition
+	FindingKeyRangeGap = "key_range_gap"
+
+	// a part of the key space served twice by a SrvKeyspace partition
+	FindingKeyRangeOverlap = "key_range_overlap"
+)
+
+// ServingGraphFinding is a difference between the serving graph of a
+// cell and what the global keyspace, shard and tablet records say it
+// should be. It is meant to be exported as json for alerting.
+type ServingGraphFinding struct {
+	Kind        string
+	Cell        string
+	Keyspace    string
+	Shard       string          `json:",omitempty"`
+	TabletType  topo.TabletType `json:",omitempty"`
+	Description string
+}
+
+func (f ServingGraphFinding) String() string {
+	return fmt.Sprintf("%v: %v", f.Kind, f.Description)
+}
+
+// CheckServingGraph compares the serving graph of the cells with the
+// global records, and returns the differences. The serving graph
+// doesn't have to be rebuilt with served types, so the served types
+// of the shards are not checked.
+func (wr *Wrangler) CheckServingGraph(cells []string) ([]ServingGraphFinding, error) {
+	keyspaces, err := wr.ts.GetKeyspaces()
+	if err != nil {
+		return nil, err
+	}
+	var findings []ServingGraphFinding
+	for _, cell := range cells {
+		sgc := &servingGraphChecker{wr: wr, cell: cell}
+		if err := sgc.check(keyspaces); err != nil {
+			return nil, fmt.Errorf("cannot check the serving graph of cell %v: %v", cell, err)
+		}
+		findings = append(findings, sgc.findings...)
+	}
+	return findings, nil
+}
+
+// servingGraphChecker checks the serving graph of a cell.
+type servingGraphChecker struct {
+	wr       *Wrangler
+	cell     string
+	findings []ServingGraphFinding
+}
+
+func (sgc *servingGraphChecker) add(kind, keyspace, shard string, tabletType topo.TabletType, format string, args ...interface{}) {
+	sgc.findings = append(sgc.findings, ServingGraphFinding{
+		Kind:        kind,
+		Cell:        sgc.cell,
+		Keyspace:    keyspace,
+		Shard:       shard,
+		TabletType:  tabletType,
+		Description: fmt.Sprintf("cell %v: ", sgc.cell) + fmt.Sprintf(format, args...),
+	})
+}
+
+func (sgc *servingGraphChecker) check(keyspaces []string) error {
+	ts := sgc.wr.ts
+	srvKeyspaceNames, err := ts.GetSrvKeyspaceNames(sgc.cell)
+	if err != nil && err != topo.ErrNoNode {
+		return err
+	}
+	for _, keyspace := range srvKeyspaceNames {
+		if !strInList(keyspaces, keyspace) {
+			sgc.add(FindingExtraKeyspace, keyspace, "", "", "serving graph of keyspace %v, that doesn't exist", keyspace)
+		}
+	}
+
+	for _, keyspace := range keyspaces {
+		shards, err := ts.GetShardNames(keyspace)
+		if err != nil && err != topo.ErrNoNode {
+			return err
+		}
+		serving := false
+		shardInfos := make([]*topo.ShardInfo, 0, len(shards))
+		for _, shard := range shards {
+			si, err := ts.GetShard(keyspace, shard)
+			if err != nil {
+				return err
+			}
+			shardInfos = append(shardInfos, si)
+			if !si.HasCell(sgc.cell) {
+				continue
+			}
+			shardServing, err := sgc.checkShard(si)
+			if err != nil {
+				return err
+			}
+			serving = serving || shardServing
+		}
+
+		srvKeyspace, err := ts.GetSrvKeyspace(sgc.cell, keyspace)
+		switch err {
+		case nil:
+			sgc.checkSrvKeyspace(keyspace, srvKeyspace, shardInfos)
+		case topo.ErrNoNode:
+			if serving {
+				sgc.add(FindingMissingKeyspace, keyspace, "", "", "no serving graph for keyspace %v, that has serving tablets", keyspace)
+			}
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// checkShard compares the serving records of a shard with its
+// tablets in the cell, using the same rules as the shard rebuild. It
+// returns true if the shard has serving tablets in the cell.
+func (sgc *servingGraphChecker) checkShard(si *topo.ShardInfo) (bool, error) {
+	ts := sgc.wr.ts
+	keyspace, shard := si.Keyspace(), si.ShardName()
+	tabletMap, err := GetTabletMapForShard(ts, keyspace, shard)
+	if err != nil {
+		return false, err
+	}
+
+	// what the serving records should contain
+	expected := make(map[topo.TabletType]map[uint32]bool)
+	for alias, ti := range tabletMap {
+		if alias.Cell != sgc.cell || !ti.IsServingType() {
+			continue
+		}
+		if ti.Type != topo.TYPE_MASTER && ti.Parent != si.MasterAlias {
+			continue
+		}
+		if expected[ti.Type] == nil {
+			expected[ti.Type] = make(map[uint32]bool)
+		}
+		expected[ti.Type][alias.Uid] = true
+	}
+
+	// what they contain
+	endPointsPerType, err := ts.GetEndPointsPerShard(sgc.cell, keyspace, shard)
+	if err != nil && err != topo.ErrNoNode {
+		return false, err
+	}
+	tabletTypes := make([]topo.TabletType, 0, len(endPointsPerType))
+	for tabletType := range endPointsPerType {
+		tabletTypes = append(tabletTypes, tabletType)
+	}
+	found := make(map[topo.TabletType]bool)
+	for _, tabletType := range sortedTabletTypes(tabletTypes) {
+		addrs := endPointsPerType[tabletType]
+		found[tabletType] = true
+		if expected[tabletType] == nil {
+			sgc.add(FindingExtraType, keyspace, shard, tabletType, "serving records of type %v in %v/%v, that has no serving tablet of that type", tabletType, keyspace, shard)
+			continue
+		}
+		seen := make(map[uint32]bool)
+		for _, entry := range addrs.Entries {
+			seen[entry.Uid] = true
+			if !expected[tabletType][entry.Uid] {
+				sgc.add(FindingExtraEndPoint, keyspace, shard, tabletType, "%v serving record of %v/%v for tablet %v, that is not a serving %v", tabletType, keyspace, shard, topo.TabletAlias{Cell: sgc.cell, Uid: entry.Uid}, tabletType)
+			}
+		}
+		for _, uid := range sortedUids(expected[tabletType]) {
+			if !seen[uid] {
+				sgc.add(FindingMissingEndPoint, keyspace, shard, tabletType, "no %v serving record of %v/%v for tablet %v", tabletType, keyspace, shard, topo.TabletAlias{Cell: sgc.cell, Uid: uid})
+			}
+		}
+	}
+	expectedTypes := make([]topo.TabletType, 0, len(expected))
+	for tabletType := range expected {
+		expectedTypes = append(expectedTypes, tabletType)
+	}
+	for _, tabletType := range sortedTabletTypes(expectedTypes) {
+		if !found[tabletType] {
+			sgc.add(FindingMissingType, keyspace, shard, tabletType, "no %v serving records of %v/%v, that has %v serving tablets", tabletType, keyspace, shard, len(expected[tabletType]))
+		}
+	}
+
+	srvShard, err := ts.GetSrvShard(sgc.cell, keyspace, shard)
+	switch err {
+	case nil:
+		if srvShard.KeyRange != si.KeyRange {
+			sgc.add(FindingKeyRangeMismatch, keyspace, shard, "", "serving graph of %v/%v has key range %v, shard has %v", keyspace, shard, srvShard.KeyRange, si.KeyRange)
+		}
+	case topo.ErrNoNode:
+		if len(expected) > 0 {
+			sgc.add(FindingMissingShard, keyspace, shard, "", "no serving graph for shard %v/%v, that has serving tablets", keyspace, shard)
+		}
+	default:
+		return false, err
+	}
+	return len(expected) > 0, nil
+}
+
+// checkSrvKeyspace checks the shards of each partition of the
+// SrvKeyspace exist, and cover the key space exactly once.
+func (sgc *servingGraphChecker) checkSrvKeyspace(keyspace string, srvKeyspace *topo.SrvKeyspace, shardInfos []*topo.ShardInfo) {
+	partitions := srvKeyspace.Partitions
+	if len(partitions) == 0 {
+		// built without served types
+		partitions = map[topo.TabletType]*topo.KeyspacePartition{"": &topo.KeyspacePartition{Shards: srvKeyspace.Shards}}
+	}
+	tabletTypes := make([]topo.TabletType, 0, len(partitions))
+	for tabletType := range partitions {
+		tabletTypes = append(tabletTypes, tabletType)
+	}
+
+	for _, tabletType := range sortedTabletTypes(tabletTypes) {
+		srvShards := partitions[tabletType].Shards
+		for _, srvShard := range srvShards {
+			found := false
+			for _, si := range shardInfos {
+				if si.KeyRange == srvShard.KeyRange {
+					found = true
+					break
+				}
+			}
+			if !found {
+				sgc.add(FindingExtraShard, keyspace, "", tabletType, "serving graph of keyspace %v has a shard for key range %v, that doesn't exist", keyspace, srvShard.KeyRange)
+			}
+		}
+
+		keyRanges := make([]key.KeyRange, len(srvShards))
+		for i, srvShard := range srvShards {
+			keyRanges[i] = srvShard.KeyRange
+		}
+		gaps, overlaps := keyRangeCoverage(keyRanges)
+		for _, gap := range gaps {
+			sgc.add(FindingKeyRangeGap, keyspace, "", tabletType, "serving graph of keyspace %v doesn't cover key range %v for type %v", keyspace, gap, tabletType)
+		}
+		for _, overlap := range overlaps {
+			sgc.add(FindingKeyRangeOverlap, keyspace, "", tabletType, "serving graph of keyspace %v covers key range %v more than once for type %v", keyspace, overlap, tabletType)
+		}
+	}
+}
+
+// checkServedTypesCoverage checks that, for each served type (or only
+// the given ones, if any), the shards serving it partition the key
+// space: every keyspace id is served by exactly one shard. A hole
+// would only show up as client errors.
+func checkServedTypesCoverage(keyspace string, shards []*topo.ShardInfo, onlyTypes ...topo.TabletType) error {
+	keyRanges := make(map[topo.TabletType][]key.KeyRange)
+	for _, si := range shards {
+		for _, tabletType := range si.ServedTypes {
+			if len(onlyTypes) > 0 && !topo.IsTypeInList(tabletType, onlyTypes) {
+				continue
+			}
+			keyRanges[tabletType] = append(keyRanges[tabletType], si.KeyRange)
+		}
+	}
+	servedTypes := make([]topo.TabletType, 0, len(keyRanges))
+	for tabletType := range keyRanges {
+		servedTypes = append(servedTypes, tabletType)
+	}
+
+	var problems []string
+	for _, tabletType := range sortedTabletTypes(servedTypes) {
+		gaps, overlaps := keyRangeCoverage(keyRanges[tabletType])
+		for _, gap := range gaps {
+			problems = append(problems, fmt.Sprintf("%v is not served for type %v", gap, tabletType))
+		}
+		for _, overlap := range overlaps {
+			problems = append(problems, fmt.Sprintf("%v is served more than once for type %v", overlap, tabletType))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the served types of the shards of keyspace %v don't partition the key space: %v", keyspace, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// keyRangeCoverage returns the parts of the key space that are not
+// covered by the key ranges, and the ones covered more than once.
+func keyRangeCoverage(keyRanges []key.KeyRange) (gaps, overlaps []key.KeyRange) {
+	sorted := make([]key.KeyRange, len(keyRanges))
+	copy(sorted, keyRanges)
+	sort.Sort(keyRangesByStart(sorted))
+
+	next := key.MinKey
+	complete := false
+	for _, kr := range sorted {
+		switch {
+		case complete:
+			overlaps = append(overlaps, kr)
+			continue
+		case kr.Start < next:
+			end := kr.End
+			if end == key.MaxKey || next < end {
+				end = next
+			}
+			overlaps = append(overlaps, key.KeyRange{Start: kr.Start, End: end})
+		case kr.Start > next:
+			gaps = append(gaps, key.KeyRange{Start: next, End: kr.Start})
+		}
+		if kr.End == key.MaxKey {
+			complete = true
+		} else if next < kr.End {
+			next = kr.End
+		}
+	}
+	if !complete {
+		gaps = append(gaps, key.KeyRange{Start: next, End: key.MaxKey})
+	}
+	return gaps, overlaps
+}
+
+type keyRangesByStart []key.KeyRange
+
+func (krs keyRangesByStart) Len() int           { return len(krs) }
+func (krs keyRangesByStart) Less(i, j int) bool { return krs[i].Start < krs[j].Start }
+func (krs keyRangesByStart) Swap(i, j int)      { krs[i], krs[j] = krs[j], krs[i] }
+
+func sortedTabletTypes(tabletTypes []topo.TabletType) []topo.TabletType {
+	names := make([]string, len(tabletTypes))
+	for i, tabletType := range tabletTypes {
+		names[i] = string(tabletType)
+	}
+	sort.Strings(names)
+	result := make([]topo.TabletType, len(names))
+	for i, name := range names {
+		result[i] = topo.TabletType(name)
+	}
+	return result
+}
+
+func sortedUids(uids map[uint32]bool) []uint32 {
+	result := make([]uint32, 0, len(uids))
+	for uid := range uids {
+		result = append(result, uid)
+	}
+	sort.Sort(uint32Slice(result))
+	return result
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int           { return len(s) }
+func (s uint32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
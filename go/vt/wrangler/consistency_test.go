@@ -0,0 +1,151 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+func TestCheckServingGraph(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	wr.UseRPCs = false
+	masterAlias := createTestTablet(t, wr, "cell1", 0, topo.TYPE_MASTER, topo.TabletAlias{})
+	createTestTablet(t, wr, "cell1", 1, topo.TYPE_REPLICA, masterAlias)
+	if err := wr.RebuildKeyspaceGraph("test_keyspace", nil, false); err != nil {
+		t.Fatalf("RebuildKeyspaceGraph: %v", err)
+	}
+	checkKinds := func(want ...string) {
+		findings, err := wr.CheckServingGraph([]string{"cell1"})
+		if err != nil {
+			t.Fatalf("CheckServingGraph: %v", err)
+		}
+		var kinds []string
+		for _, f := range findings {
+			kinds = append(kinds, f.Kind)
+		}
+		if !reflect.DeepEqual(kinds, want) {
+			t.Errorf("got findings %v, want %v", findings, want)
+		}
+	}
+	checkKinds()
+
+	// break the serving graph
+	if err := ts.DeleteSrvTabletType("cell1", "test_keyspace", "0", topo.TYPE_REPLICA); err != nil {
+		t.Fatalf("DeleteSrvTabletType: %v", err)
+	}
+	addrs := topo.NewEndPoints()
+	addrs.Entries = append(addrs.Entries, *topo.NewAddr(5, "host5"))
+	if err := ts.UpdateEndPoints("cell1", "test_keyspace", "0", topo.TYPE_RDONLY, addrs); err != nil {
+		t.Fatalf("UpdateEndPoints: %v", err)
+	}
+	if err := ts.UpdateEndPoints("cell1", "test_keyspace", "0", topo.TYPE_MASTER, addrs); err != nil {
+		t.Fatalf("UpdateEndPoints: %v", err)
+	}
+	srvKeyspace := &topo.SrvKeyspace{
+		Partitions: map[topo.TabletType]*topo.KeyspacePartition{
+			topo.TYPE_MASTER: &topo.KeyspacePartition{Shards: []topo.SrvShard{
+				topo.SrvShard{},
+				topo.SrvShard{KeyRange: key.KeyRange{Start: "\x80"}},
+			}},
+		},
+	}
+	if err := ts.UpdateSrvKeyspace("cell1", "test_keyspace", srvKeyspace); err != nil {
+		t.Fatalf("UpdateSrvKeyspace: %v", err)
+	}
+	zconn := ts.(zktopo.TestServer).Server.(*zktopo.Server).GetZConn()
+	if _, err := zk.CreateRecursive(zconn, "/zk/cell1/vt/ns/other_keyspace", "{}", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil {
+		t.Fatalf("CreateRecursive: %v", err)
+	}
+	checkKinds(
+		FindingExtraKeyspace,
+		FindingExtraEndPoint,
+		FindingMissingEndPoint,
+		FindingExtraType,
+		FindingMissingType,
+		FindingExtraShard,
+		FindingKeyRangeOverlap,
+	)
+
+	// a rebuild fixes what it can
+	if err := wr.RebuildKeyspaceGraph("test_keyspace", nil, false); err != nil {
+		t.Fatalf("RebuildKeyspaceGraph: %v", err)
+	}
+	checkKinds(FindingExtraKeyspace)
+}
+
+func TestKeyRangeCoverage(t *testing.T) {
+	keyRanges := func(bounds ...key.KeyspaceId) []key.KeyRange {
+		var result []key.KeyRange
+		for i := 0; i < len(bounds); i += 2 {
+			result = append(result, key.KeyRange{Start: bounds[i], End: bounds[i+1]})
+		}
+		return result
+	}
+	for _, tc := range []struct {
+		keyRanges []key.KeyRange
+		gaps      []key.KeyRange
+		overlaps  []key.KeyRange
+	}{
+		{keyRanges("", ""), nil, nil},
+		{keyRanges("\x80", "", "", "\x80"), nil, nil},
+		{nil, []key.KeyRange{{}}, nil},
+		{keyRanges("", "\x40", "\x80", ""), []key.KeyRange{{Start: "\x40", End: "\x80"}}, nil},
+		{keyRanges("", "\x80"), []key.KeyRange{{Start: "\x80"}}, nil},
+		{keyRanges("", "\x80", "\x40", ""), nil, []key.KeyRange{{Start: "\x40", End: "\x80"}}},
+		{keyRanges("", "", "\x40", "\x80"), nil, []key.KeyRange{{Start: "\x40", End: "\x80"}}},
+	} {
+		gaps, overlaps := keyRangeCoverage(tc.keyRanges)
+		if !reflect.DeepEqual(gaps, tc.gaps) || !reflect.DeepEqual(overlaps, tc.overlaps) {
+			t.Errorf("keyRangeCoverage(%v): got %v %v, want %v %v", tc.keyRanges, gaps, overlaps, tc.gaps, tc.overlaps)
+		}
+	}
+}
+
+func TestServedTypesCoverage(t *testing.T) {
+	shard := func(start, end key.KeyspaceId, servedTypes ...topo.TabletType) *topo.ShardInfo {
+		return topo.NewShardInfo("test_keyspace", "", &topo.Shard{
+			KeyRange:    key.KeyRange{Start: start, End: end},
+			ServedTypes: servedTypes,
+		})
+	}
+
+	// -80 and 80- serve everything, 80-c0 and c0- are new
+	// destination shards that don't serve anything yet
+	shards := []*topo.ShardInfo{
+		shard("", "\x80", topo.TYPE_MASTER, topo.TYPE_REPLICA),
+		shard("\x80", "", topo.TYPE_MASTER, topo.TYPE_REPLICA),
+		shard("\x80", "\xc0"),
+		shard("\xc0", ""),
+	}
+	if err := checkServedTypesCoverage("test_keyspace", shards); err != nil {
+		t.Errorf("checkServedTypesCoverage: %v", err)
+	}
+
+	// only half the destination shards serve replica
+	shards[1].ServedTypes = []topo.TabletType{topo.TYPE_MASTER}
+	shards[2].ServedTypes = []topo.TabletType{topo.TYPE_REPLICA}
+	if err := checkServedTypesCoverage("test_keyspace", shards); err == nil {
+		t.Errorf("checkServedTypesCoverage with a gap should have failed")
+	}
+	if err := checkServedTypesCoverage("test_keyspace", shards, topo.TYPE_MASTER); err != nil {
+		t.Errorf("checkServedTypesCoverage(master): %v", err)
+	}
+
+	// both the source and a destination shard serve replica
+	shards[1].ServedTypes = []topo.TabletType{topo.TYPE_MASTER, topo.TYPE_REPLICA}
+	shards[3].ServedTypes = []topo.TabletType{topo.TYPE_REPLICA}
+	if err := checkServedTypesCoverage("test_keyspace", shards, topo.TYPE_REPLICA); err == nil {
+		t.Errorf("checkServedTypesCoverage with an overlap should have failed")
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"time"
+
+	"github.com/youtube/vitess/go/vt/dtxresolver"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+// This file contains the manual resolution of the in-doubt
+// distributed transactions, whose metadata is kept by the master of
+// an unsharded shard. It uses the same resolver as vtgate, see
+// go/vt/dtxresolver.
+
+// ListDistributedTransactions returns the distributed transactions
+// older than abandonAge, whose metadata is in keyspace/shard.
+func (wr *Wrangler) ListDistributedTransactions(keyspace, shard string, abandonAge time.Duration) ([]tproto.DistributedTransaction, error) {
+	conn, err := dtxresolver.DialShardMaster(wr.ts, keyspace, shard)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.ReadTransactions("", abandonAge)
+}
+
+// ResolveDistributedTransaction finishes the distributed transaction
+// dtid, whose metadata is in keyspace/shard: it is committed if the
+// commit decision was made, and rolled back otherwise. A transaction
+// still in the PREPARE state is only rolled back if it is older than
+// abandonAge, or if force is set: its vtgate may still be committing
+// it.
+func (wr *Wrangler) ResolveDistributedTransaction(keyspace, shard, dtid string, abandonAge time.Duration, force bool) error {
+	return dtxresolver.ResolveWithTopo(wr.ts, keyspace, shard, dtid, abandonAge, force)
+}
@@ -6,6 +6,8 @@ package wrangler
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 
 	log "github.com/golang/glog"
@@ -44,6 +46,51 @@ func (wr *Wrangler) unlockKeyspace(keyspace string, actionNode *tm.ActionNode, l
 	return err
 }
 
+// DeleteKeyspace deletes a keyspace. If it still has shards, it
+// fails, unless recursive is set: then its shards are deleted first,
+// with their tablets (see DeleteShard, all the shards are checked
+// before anything is deleted). Then the serving graph of the keyspace
+// is deleted in all cells, and the keyspace itself.
+func (wr *Wrangler) DeleteKeyspace(keyspace string, recursive, evenIfServing bool) error {
+	shards, err := wr.ts.GetShardNames(keyspace)
+	if err != nil && err != topo.ErrNoNode {
+		return err
+	}
+	if len(shards) > 0 && !recursive {
+		return fmt.Errorf("keyspace %v still has %v shards, delete them first (or use -recursive)", keyspace, len(shards))
+	}
+
+	shardInfos := make([]*topo.ShardInfo, len(shards))
+	shardTablets := make([][]*topo.TabletInfo, len(shards))
+	for i, shard := range shards {
+		if shardInfos[i], err = wr.ts.GetShard(keyspace, shard); err != nil {
+			return err
+		}
+		if shardTablets[i], err = wr.shardTablets(shardInfos[i]); err != nil {
+			return err
+		}
+		if err := checkDeletableTablets(shardInfos[i], shardTablets[i], recursive, evenIfServing); err != nil {
+			return err
+		}
+	}
+	for i, si := range shardInfos {
+		if err := wr.deleteShard(si, shardTablets[i]); err != nil {
+			return err
+		}
+	}
+
+	cells, err := wr.ts.GetKnownCells()
+	if err != nil {
+		return err
+	}
+	for _, cell := range cells {
+		if err := wr.ts.DeleteSrvKeyspace(cell, keyspace); err != nil && err != topo.ErrNoNode {
+			return fmt.Errorf("cannot delete the serving graph of %v in cell %v: %v", keyspace, cell, err)
+		}
+	}
+	return wr.ts.DeleteKeyspace(keyspace)
+}
+
 func (wr *Wrangler) MigrateServedTypes(keyspace, shard string, servedType topo.TabletType, reverse bool) error {
 	// we cannot migrate a master back, since when master migration
 	// is done, the source shards are dead
@@ -79,11 +126,6 @@ func (wr *Wrangler) MigrateServedTypes(keyspace, shard string, servedType topo.T
 		return fmt.Errorf("Cannot find any destination shard replicating from %v/%v", keyspace, shard)
 	}
 
-	// TODO(alainjobart) for a reverse split, we also need to find
-	// more sources. For now, a single source is all we need, but we
-	// still use a list of sources to not have to change the code later.
-	sourceShards := make([]*topo.ShardInfo, 0, 0)
-
 	// Verify the source has the type we're migrating
 	si, err := wr.ts.GetShard(keyspace, shard)
 	if err != nil {
@@ -102,48 +144,177 @@ func (wr *Wrangler) MigrateServedTypes(keyspace, shard string, servedType topo.T
 	if servedType == topo.TYPE_MASTER && len(si.ServedTypes) > 1 {
 		return fmt.Errorf("Cannot migrate master out of %v/%v until everything else is migrated out", keyspace, shard)
 	}
-	sourceShards = append(sourceShards, si)
 
-	// lock the shards: sources, then destinations
-	// (note they're all ordered by shard name)
-	actionNode := wr.ai.MigrateServedTypes(servedType)
-	sourceLockPath := make([]string, len(sourceShards))
-	for i, si := range sourceShards {
-		sourceLockPath[i], err = wr.lockShard(si.Keyspace(), si.ShardName(), actionNode)
-		if err != nil {
-			log.Errorf("Failed to lock source shard %v/%v, may need to unlock other shards manually", si.Keyspace(), si.ShardName())
-			return err
-		}
-	}
-	destinationLockPath := make([]string, len(destinationShards))
+	// the destinations are saved in the parameters, as a master
+	// migration stops their filtered replication, and we could
+	// not find them again when resuming
+	destinations := make([]string, len(destinationShards))
 	for i, si := range destinationShards {
-		destinationLockPath[i], err = wr.lockShard(si.Keyspace(), si.ShardName(), actionNode)
-		if err != nil {
-			log.Errorf("Failed to lock destination shard %v/%v, may need to unlock other shards manually", si.Keyspace(), si.ShardName())
-			return err
-		}
+		destinations[i] = si.ShardName()
 	}
+	_, err = wr.StartWorkflow(keyspace, migrateServedTypesWorkflow, map[string]string{
+		"keyspace":     keyspace,
+		"shard":        shard,
+		"destinations": strings.Join(destinations, ","),
+		"served_type":  string(servedType),
+		"reverse":      strconv.FormatBool(reverse),
+	})
+	return err
+}
 
-	// record the action error and all unlock errors
-	rec := concurrency.AllErrorRecorder{}
+// migrateServedTypesWorkflow is the workflow for served type
+// migrations. Its parameters are keyspace, shard, destinations (a
+// comma separated list of shards), served_type and reverse.
+const migrateServedTypesWorkflow = "MigrateServedTypes"
 
-	// execute the migration
-	rec.RecordError(wr.migrateServedTypes(sourceShards, destinationShards, servedType, reverse))
+func newMigrateServedTypesWorkflow(wr *Wrangler, params map[string]string) (*workflow, error) {
+	keyspace := params["keyspace"]
+	servedType := topo.TabletType(params["served_type"])
+	reverse, err := strconv.ParseBool(params["reverse"])
+	if err != nil {
+		return nil, err
+	}
+	// TODO(alainjobart) for a reverse split, we also need to find
+	// more sources. For now, a single source is all we need, but we
+	// still use a list of sources to not have to change the code later.
+	sources := []string{params["shard"]}
+	destinations := strings.Split(params["destinations"], ",")
+
+	// readShards re-reads all the shards so we are up to date
+	readShards := func() (sourceShards, destinationShards []*topo.ShardInfo, err error) {
+		sourceShards = make([]*topo.ShardInfo, len(sources))
+		for i, shard := range sources {
+			if sourceShards[i], err = wr.ts.GetShard(keyspace, shard); err != nil {
+				return nil, nil, err
+			}
+		}
+		destinationShards = make([]*topo.ShardInfo, len(destinations))
+		for i, shard := range destinations {
+			if destinationShards[i], err = wr.ts.GetShard(keyspace, shard); err != nil {
+				return nil, nil, err
+			}
+		}
+		return sourceShards, destinationShards, nil
+	}
 
-	// unlock the shards, we're done
-	for i := len(destinationShards) - 1; i >= 0; i-- {
-		rec.RecordError(wr.unlockShard(destinationShards[i].Keyspace(), destinationShards[i].ShardName(), actionNode, destinationLockPath[i], nil))
+	steps := make([]*workflowStep, 0, 5)
+	if servedType == topo.TYPE_MASTER {
+		// For master type migration, need to:
+		// - switch the source shards to read-only
+		// - gather all replication points
+		// - wait for filtered replication to catch up before we continue
+		// - disable filtered replication after the fact
+		steps = append(steps, &workflowStep{
+			name: "make_sources_read_only",
+			do: func(data map[string]string) error {
+				sourceShards, _, err := readShards()
+				if err != nil {
+					return err
+				}
+				return wr.makeMastersReadOnly(sourceShards)
+			},
+			undo: func(data map[string]string) error {
+				sourceShards, _, err := readShards()
+				if err != nil {
+					return err
+				}
+				return wr.makeMastersReadWrite(sourceShards)
+			},
+		}, &workflowStep{
+			name: "wait_for_filtered_replication",
+			do: func(data map[string]string) error {
+				sourceShards, destinationShards, err := readShards()
+				if err != nil {
+					return err
+				}
+				masterPositions, err := wr.getMastersPosition(sourceShards)
+				if err != nil {
+					return err
+				}
+				return wr.waitForFilteredReplication(masterPositions, destinationShards)
+			},
+		})
 	}
-	for i := len(sourceShards) - 1; i >= 0; i-- {
-		rec.RecordError(wr.unlockShard(sourceShards[i].Keyspace(), sourceShards[i].ShardName(), actionNode, sourceLockPath[i], nil))
+
+	updateShards := &workflowStep{
+		name: "update_shards",
+		do: func(data map[string]string) error {
+			sourceShards, destinationShards, err := readShards()
+			if err != nil {
+				return err
+			}
+			return wr.migrateServedTypes(sourceShards, destinationShards, servedType, reverse)
+		},
+		irreversible: servedType == topo.TYPE_MASTER,
 	}
+	if servedType != topo.TYPE_MASTER {
+		updateShards.undo = func(data map[string]string) error {
+			sourceShards, destinationShards, err := readShards()
+			if err != nil {
+				return err
+			}
+			return wr.migrateServedTypes(sourceShards, destinationShards, servedType, !reverse)
+		}
+	}
+	steps = append(steps, updateShards)
 
-	// rebuild the keyspace serving graph if there was no error
-	if rec.Error() == nil {
-		rec.RecordError(wr.RebuildKeyspaceGraph(keyspace, nil, true))
+	if servedType == topo.TYPE_MASTER {
+		// And tell the new shards masters they can now be read-write.
+		// Invoking a remote action will also make the tablet stop filtered
+		// replication.
+		steps = append(steps, &workflowStep{
+			name: "make_destinations_read_write",
+			do: func(data map[string]string) error {
+				_, destinationShards, err := readShards()
+				if err != nil {
+					return err
+				}
+				return wr.makeMastersReadWrite(destinationShards)
+			},
+			irreversible: true,
+		})
 	}
 
-	return rec.Error()
+	// rebuilding the keyspace serving graph locks the shards, so it
+	// runs after they are unlocked, and runs again after a rollback
+	rebuild := func(data map[string]string) error {
+		return wr.RebuildKeyspaceGraph(keyspace, nil, true)
+	}
+	steps = append(steps, &workflowStep{
+		name:     "rebuild_keyspace_graph",
+		do:       rebuild,
+		undo:     rebuild,
+		unlocked: true,
+	})
+
+	return &workflow{
+		steps: steps,
+		lock: func() (func(error) error, error) {
+			// lock the shards: sources, then destinations
+			// (note they're all ordered by shard name)
+			actionNode := wr.ai.MigrateServedTypes(servedType)
+			shards := append(append([]string{}, sources...), destinations...)
+			lockPaths := make([]string, 0, len(shards))
+			unlock := func(err error) error {
+				// record the action error and all unlock errors
+				rec := concurrency.AllErrorRecorder{}
+				rec.RecordError(err)
+				for i := len(lockPaths) - 1; i >= 0; i-- {
+					rec.RecordError(wr.unlockShard(keyspace, shards[i], actionNode, lockPaths[i], nil))
+				}
+				return rec.Error()
+			}
+			for _, shard := range shards {
+				lockPath, err := wr.lockShard(keyspace, shard, actionNode)
+				if err != nil {
+					log.Errorf("Failed to lock shard %v/%v", keyspace, shard)
+					return nil, unlock(err)
+				}
+				lockPaths = append(lockPaths, lockPath)
+			}
+			return unlock, nil
+		},
+	}, nil
 }
 
 func removeType(tabletType topo.TabletType, types []topo.TabletType) ([]topo.TabletType, bool) {
@@ -173,14 +344,11 @@ func (wr *Wrangler) makeMastersReadOnly(shards []*topo.ShardInfo) error {
 			defer wg.Done()
 
 			log.Infof("Making master %v read-only", si.MasterAlias)
-			actionPath, err := wr.ai.SetReadOnly(si.MasterAlias)
-			if err != nil {
+			if err := wr.SetReadOnly(si.MasterAlias, true); err != nil {
 				rec.RecordError(err)
 				return
 			}
 			log.Infof("Master %v is read-only", si.MasterAlias)
-
-			rec.RecordError(wr.ai.WaitForCompletion(actionPath, wr.actionTimeout()))
 		}(si)
 	}
 	wg.Wait()
@@ -253,8 +421,8 @@ func (wr *Wrangler) waitForFilteredReplication(sourcePositions map[*topo.ShardIn
 	return rec.Error()
 }
 
-// FIXME(alainjobart) no action to become read-write now, just use Ping,
-// that forces the shard reload and will stop replication.
+// makeMastersReadWrite refreshes the state of the masters of the
+// shards, which reloads the shard and will stop replication.
 func (wr *Wrangler) makeMastersReadWrite(shards []*topo.ShardInfo) error {
 	wg := sync.WaitGroup{}
 	rec := concurrency.AllErrorRecorder{}
@@ -262,55 +430,43 @@ func (wr *Wrangler) makeMastersReadWrite(shards []*topo.ShardInfo) error {
 		wg.Add(1)
 		go func(si *topo.ShardInfo) {
 			defer wg.Done()
-			log.Infof("Pinging master %v", si.MasterAlias)
+			log.Infof("Refreshing master %v", si.MasterAlias)
 
-			actionPath, err := wr.ai.Ping(si.MasterAlias)
+			ti, err := wr.ts.GetTablet(si.MasterAlias)
 			if err != nil {
 				rec.RecordError(err)
 				return
 			}
 
-			if err := wr.ai.WaitForCompletion(actionPath, wr.actionTimeout()); err != nil {
+			if err := wr.RefreshTabletState(ti); err != nil {
 				rec.RecordError(err)
 			} else {
 				log.Infof("%v responded", si.MasterAlias)
 			}
-
 		}(si)
 	}
 	wg.Wait()
 	return rec.Error()
 }
 
-// migrateServedTypes operates with all concerned shards locked.
+// migrateServedTypes updates the served types of the shards, with
+// all concerned shards locked. Shards that are already updated are
+// skipped, so it can be run again after a partial failure.
 func (wr *Wrangler) migrateServedTypes(sourceShards, destinationShards []*topo.ShardInfo, servedType topo.TabletType, reverse bool) error {
-
-	// re-read all the shards so we are up to date
-	var err error
-	for i, si := range sourceShards {
-		if sourceShards[i], err = wr.ts.GetShard(si.Keyspace(), si.ShardName()); err != nil {
-			return err
-		}
-	}
-	for i, si := range destinationShards {
-		if destinationShards[i], err = wr.ts.GetShard(si.Keyspace(), si.ShardName()); err != nil {
-			return err
-		}
-	}
-
-	// check and update all shard records, in memory only
+	// update all shard records, in memory only
+	changed := make([]*topo.ShardInfo, 0, len(sourceShards)+len(destinationShards))
 	for _, si := range sourceShards {
 		if reverse {
 			// need to add to source
-			if topo.IsTypeInList(servedType, si.ServedTypes) {
-				return fmt.Errorf("Source shard %v/%v is already serving type %v", si.Keyspace(), si.ShardName(), servedType)
+			if !topo.IsTypeInList(servedType, si.ServedTypes) {
+				si.ServedTypes = append(si.ServedTypes, servedType)
+				changed = append(changed, si)
 			}
-			si.ServedTypes = append(si.ServedTypes, servedType)
 		} else {
 			// need to remove from source
 			var found bool
-			if si.ServedTypes, found = removeType(servedType, si.ServedTypes); !found {
-				return fmt.Errorf("Source shard %v/%v is not serving type %v", si.Keyspace(), si.ShardName(), servedType)
+			if si.ServedTypes, found = removeType(servedType, si.ServedTypes); found {
+				changed = append(changed, si)
 			}
 		}
 	}
@@ -318,63 +474,51 @@ func (wr *Wrangler) migrateServedTypes(sourceShards, destinationShards []*topo.S
 		if reverse {
 			// need to remove from destination
 			var found bool
-			if si.ServedTypes, found = removeType(servedType, si.ServedTypes); !found {
-				return fmt.Errorf("Destination shard %v/%v is not serving type %v", si.Keyspace(), si.ShardName(), servedType)
+			if si.ServedTypes, found = removeType(servedType, si.ServedTypes); found {
+				changed = append(changed, si)
 			}
 		} else {
 			// need to add to destination
-			if topo.IsTypeInList(servedType, si.ServedTypes) {
-				return fmt.Errorf("Destination shard %v/%v is already serving type %v", si.Keyspace(), si.ShardName(), servedType)
+			if !topo.IsTypeInList(servedType, si.ServedTypes) {
+				si.ServedTypes = append(si.ServedTypes, servedType)
+				changed = append(changed, si)
+			}
+		}
+		// and disable filtered replication after a master migration
+		if servedType == topo.TYPE_MASTER && si.SourceShards != nil {
+			si.SourceShards = nil
+			if len(changed) == 0 || changed[len(changed)-1] != si {
+				changed = append(changed, si)
 			}
-			si.ServedTypes = append(si.ServedTypes, servedType)
 		}
 	}
 
-	// For master type migration, need to:
-	// - switch the source shards to read-only
-	// - gather all replication points
-	// - wait for filtered replication to catch up before we continue
-	// - disable filtered replication after the fact
-	if servedType == topo.TYPE_MASTER {
-		err := wr.makeMastersReadOnly(sourceShards)
+	// The shards serving the type, after the migration, have to
+	// partition the key space, or some keyspace ids would not be
+	// served, or served twice.
+	if len(changed) > 0 {
+		keyspace := changed[0].Keyspace()
+		shardMap, err := topo.FindAllShardsInKeyspace(wr.ts, keyspace)
 		if err != nil {
 			return err
 		}
-
-		masterPositions, err := wr.getMastersPosition(sourceShards)
-		if err != nil {
-			return err
+		for _, si := range changed {
+			shardMap[si.ShardName()] = si
 		}
-
-		if err := wr.waitForFilteredReplication(masterPositions, destinationShards); err != nil {
-			return err
+		shardInfos := make([]*topo.ShardInfo, 0, len(shardMap))
+		for _, si := range shardMap {
+			shardInfos = append(shardInfos, si)
 		}
-
-		for _, si := range destinationShards {
-			si.SourceShards = nil
+		if err := checkServedTypesCoverage(keyspace, shardInfos, servedType); err != nil {
+			return fmt.Errorf("cannot migrate %v: %v", servedType, err)
 		}
 	}
 
 	// All is good, we can save the shards now
-	for _, si := range sourceShards {
-		if err := wr.ts.UpdateShard(si); err != nil {
-			return err
-		}
-	}
-	for _, si := range destinationShards {
+	for _, si := range changed {
 		if err := wr.ts.UpdateShard(si); err != nil {
 			return err
 		}
 	}
-
-	// And tell the new shards masters they can now be read-write.
-	// Invoking a remote action will also make the tablet stop filtered
-	// replication.
-	if servedType == topo.TYPE_MASTER {
-		if err := wr.makeMastersReadWrite(destinationShards); err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
@@ -0,0 +1,326 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/golang/glog"
+	hk "github.com/youtube/vitess/go/vt/hook"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// This file contains the online schema change support. Instead of
+// running the ALTER statements in MySQL directly, which locks big
+// tables for a long time, the change is applied on the master of each
+// shard by an external online schema change tool (for instance
+// pt-online-schema-change), run by the 'online_schema_change' hook.
+//
+// The state of each migration is stored in the global topology, so
+// it can be throttled, canceled or retried from another vtctl. The
+// shards are migrated one at a time. Throttling a migration pauses
+// the shard being migrated, through the 'online_schema_change_throttle'
+// hook, and no new shard is started until it is unthrottled. Canceling
+// a migration takes effect before the next shard is started. A
+// migration stops at the first shard that fails: the following shards
+// stay pending until it is retried.
+
+const (
+	onlineSchemaChangeHook         = "online_schema_change"
+	onlineSchemaChangeThrottleHook = "online_schema_change_throttle"
+)
+
+// how often we check if a migration is throttled
+var schemaMigrationThrottleInterval = 5 * time.Second
+
+// ApplySchemaKeyspaceOnline creates a new SchemaMigration for all the
+// shards of the keyspace, and runs it. It returns the migration id,
+// even if the migration failed, so it can be retried.
+func (wr *Wrangler) ApplySchemaKeyspaceOnline(keyspace, change string) (string, error) {
+	shards, err := wr.ts.GetShardNames(keyspace)
+	if err != nil {
+		return "", err
+	}
+	if len(shards) == 0 {
+		return "", fmt.Errorf("no shards in keyspace %v", keyspace)
+	}
+
+	uid, err := wr.ts.CreateSchemaMigration(keyspace, topo.NewSchemaMigration(change, shards))
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Created schema migration %v/%v", keyspace, uid)
+	return uid, wr.RunSchemaMigration(keyspace, uid)
+}
+
+// RunSchemaMigration applies a SchemaMigration on all the shards
+// that are not complete yet, and stops at the first failure.
+func (wr *Wrangler) RunSchemaMigration(keyspace, uid string) error {
+	var sm *topo.SchemaMigration
+	if err := wr.ts.UpdateSchemaMigrationFields(keyspace, uid, func(m *topo.SchemaMigration) error {
+		if m.State == topo.MIGRATION_CANCELED {
+			return fmt.Errorf("schema migration %v/%v was canceled", keyspace, uid)
+		}
+		if m.State == topo.MIGRATION_PENDING {
+			m.State = topo.MIGRATION_RUNNING
+		}
+		sm = m
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	shards := make([]string, 0, len(sm.Shards))
+	for shard := range sm.Shards {
+		shards = append(shards, shard)
+	}
+	sort.Strings(shards)
+
+	for _, shard := range shards {
+		if err := wr.waitForSchemaMigration(keyspace, uid); err != nil {
+			return err
+		}
+
+		started := false
+		if err := wr.ts.UpdateSchemaMigrationFields(keyspace, uid, func(m *topo.SchemaMigration) error {
+			s := m.Shards[shard]
+			if s.State != topo.MIGRATION_PENDING {
+				started = false
+				return nil
+			}
+			s.State = topo.MIGRATION_RUNNING
+			s.Attempts++
+			s.Error = ""
+			started = true
+			return nil
+		}); err != nil {
+			return err
+		}
+		if !started {
+			continue
+		}
+
+		log.Infof("Applying schema migration %v/%v on shard %v", keyspace, uid, shard)
+		err := wr.applySchemaMigrationShard(keyspace, shard, uid, sm.Sql)
+		if err != nil {
+			log.Errorf("Schema migration %v/%v failed on shard %v: %v", keyspace, uid, shard, err)
+		}
+		if uerr := wr.ts.UpdateSchemaMigrationFields(keyspace, uid, func(m *topo.SchemaMigration) error {
+			s := m.Shards[shard]
+			if err != nil {
+				s.State = topo.MIGRATION_FAILED
+				s.Error = err.Error()
+				if m.State != topo.MIGRATION_CANCELED {
+					m.State = topo.MIGRATION_FAILED
+				}
+			} else {
+				s.State = topo.MIGRATION_COMPLETE
+			}
+			return nil
+		}); uerr != nil {
+			return uerr
+		}
+		if err != nil {
+			return fmt.Errorf("schema migration %v/%v failed on shard %v: %v", keyspace, uid, shard, err)
+		}
+	}
+
+	// compute the final state
+	var state topo.MigrationState
+	if err := wr.ts.UpdateSchemaMigrationFields(keyspace, uid, func(m *topo.SchemaMigration) error {
+		if m.State != topo.MIGRATION_CANCELED {
+			m.State = topo.MIGRATION_COMPLETE
+			for _, s := range m.Shards {
+				if s.State != topo.MIGRATION_COMPLETE {
+					m.State = topo.MIGRATION_FAILED
+				}
+			}
+		}
+		state = m.State
+		return nil
+	}); err != nil {
+		return err
+	}
+	if state != topo.MIGRATION_COMPLETE {
+		return fmt.Errorf("schema migration %v/%v is %v", keyspace, uid, state)
+	}
+	return nil
+}
+
+// waitForSchemaMigration returns when the migration can start a new
+// shard, i.e. when it is not throttled. It returns an error if the
+// migration was canceled.
+func (wr *Wrangler) waitForSchemaMigration(keyspace, uid string) error {
+	logged := false
+	for {
+		sm, err := wr.ts.GetSchemaMigration(keyspace, uid)
+		if err != nil {
+			return err
+		}
+		switch sm.State {
+		case topo.MIGRATION_CANCELED:
+			return fmt.Errorf("schema migration %v/%v was canceled", keyspace, uid)
+		case topo.MIGRATION_THROTTLED:
+			if !logged {
+				log.Infof("Schema migration %v/%v is throttled, waiting", keyspace, uid)
+				logged = true
+			}
+			time.Sleep(schemaMigrationThrottleInterval)
+		default:
+			return nil
+		}
+	}
+}
+
+// applySchemaMigrationShard runs the online schema change hook on
+// the master of a shard, and waits for it to finish. Meanwhile, it
+// throttles and unthrottles the hook with the migration.
+func (wr *Wrangler) applySchemaMigrationShard(keyspace, shard, uid, change string) error {
+	si, err := wr.ts.GetShard(keyspace, shard)
+	if err != nil {
+		return err
+	}
+	if si.MasterAlias.IsZero() {
+		return fmt.Errorf("no master in shard %v/%v", keyspace, shard)
+	}
+	ti, err := wr.ts.GetTablet(si.MasterAlias)
+	if err != nil {
+		return err
+	}
+
+	hook := &hk.Hook{
+		Name:       onlineSchemaChangeHook,
+		Parameters: []string{"--db-name=" + ti.DbName(), "--sql=" + change},
+		ExtraEnv: map[string]string{
+			"KEYSPACE":     keyspace,
+			"SHARD":        shard,
+			"MIGRATION_ID": uid,
+		},
+	}
+	actionPath, err := wr.ai.ExecuteHook(ti.Alias, hook)
+	if err != nil {
+		return err
+	}
+	var reply interface{}
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		reply, err = wr.ai.WaitForCompletionReply(actionPath, wr.actionTimeout())
+		done <- err
+	}()
+
+	throttled := false
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+			hr := reply.(*hk.HookResult)
+			if hr.ExitStatus != hk.HOOK_SUCCESS {
+				return fmt.Errorf("hook %v failed on %v (%v): %v", hook.Name, ti.Alias, hr.ExitStatus, hr.Stderr)
+			}
+			return nil
+		case <-time.After(schemaMigrationThrottleInterval):
+			sm, err := wr.ts.GetSchemaMigration(keyspace, uid)
+			if err != nil {
+				log.Warningf("Cannot read schema migration %v/%v: %v", keyspace, uid, err)
+				continue
+			}
+			if (sm.State == topo.MIGRATION_THROTTLED) != throttled {
+				throttled = !throttled
+				wr.throttleSchemaMigrationShard(ti, hook, throttled)
+			}
+		}
+	}
+}
+
+// throttleSchemaMigrationShard runs the online schema change throttle
+// hook on the master applying a change, with --throttle or
+// --unthrottle. It goes through an RPC, since the action queue of the
+// tablet is busy with the change. A failure is only logged, the
+// change goes on.
+func (wr *Wrangler) throttleSchemaMigrationShard(ti *topo.TabletInfo, applyHook *hk.Hook, throttle bool) {
+	parameter := "--unthrottle"
+	if throttle {
+		parameter = "--throttle"
+	}
+	hook := &hk.Hook{
+		Name:       onlineSchemaChangeThrottleHook,
+		Parameters: []string{"--db-name=" + ti.DbName(), parameter},
+		ExtraEnv:   applyHook.ExtraEnv,
+	}
+	hr, err := wr.ai.RpcExecuteHook(ti, hook, wr.actionTimeout())
+	if err == nil && hr.ExitStatus != hk.HOOK_SUCCESS {
+		err = fmt.Errorf("hook %v failed (%v): %v", hook.Name, hr.ExitStatus, hr.Stderr)
+	}
+	if err != nil {
+		log.Warningf("Cannot run %v %v on %v: %v", onlineSchemaChangeThrottleHook, parameter, ti.Alias, err)
+		return
+	}
+	log.Infof("Ran %v %v on %v", onlineSchemaChangeThrottleHook, parameter, ti.Alias)
+}
+
+// ThrottleSchemaMigration throttles or unthrottles a running
+// migration. A throttled migration pauses the shard being migrated,
+// and will not start any new shard.
+func (wr *Wrangler) ThrottleSchemaMigration(keyspace, uid string, throttle bool) error {
+	return wr.ts.UpdateSchemaMigrationFields(keyspace, uid, func(sm *topo.SchemaMigration) error {
+		if sm.State.IsDone() {
+			return fmt.Errorf("schema migration %v/%v is already %v", keyspace, uid, sm.State)
+		}
+		if throttle {
+			sm.State = topo.MIGRATION_THROTTLED
+		} else if sm.State == topo.MIGRATION_THROTTLED {
+			sm.State = topo.MIGRATION_RUNNING
+		}
+		return nil
+	})
+}
+
+// CancelSchemaMigration cancels a migration. The shard that is
+// currently being migrated, if any, is not interrupted, but no other
+// shard will be started.
+func (wr *Wrangler) CancelSchemaMigration(keyspace, uid string) error {
+	return wr.ts.UpdateSchemaMigrationFields(keyspace, uid, func(sm *topo.SchemaMigration) error {
+		if sm.State == topo.MIGRATION_COMPLETE {
+			return fmt.Errorf("schema migration %v/%v is already complete", keyspace, uid)
+		}
+		sm.State = topo.MIGRATION_CANCELED
+		for _, s := range sm.Shards {
+			if s.State == topo.MIGRATION_PENDING {
+				s.State = topo.MIGRATION_CANCELED
+			}
+		}
+		return nil
+	})
+}
+
+// RetrySchemaMigration restarts a failed or canceled migration, for
+// all the shards that are not complete. If force is set, it will also
+// restart a migration that looks like it is still running, for
+// instance if the vtctl that was running it died.
+func (wr *Wrangler) RetrySchemaMigration(keyspace, uid string, force bool) error {
+	if err := wr.ts.UpdateSchemaMigrationFields(keyspace, uid, func(sm *topo.SchemaMigration) error {
+		switch {
+		case sm.State == topo.MIGRATION_COMPLETE:
+			return fmt.Errorf("schema migration %v/%v is already complete", keyspace, uid)
+		case !sm.State.IsDone() && !force:
+			return fmt.Errorf("schema migration %v/%v is %v, use -force to retry it anyway", keyspace, uid, sm.State)
+		}
+		sm.State = topo.MIGRATION_RUNNING
+		for _, s := range sm.Shards {
+			if s.State != topo.MIGRATION_COMPLETE {
+				s.State = topo.MIGRATION_PENDING
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return wr.RunSchemaMigration(keyspace, uid)
+}
@@ -0,0 +1,162 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+// onlineSchemaChangeTestHook logs the shards it is run on, and fails
+// for the shards that have a fail_<shard> file.
+const onlineSchemaChangeTestHook = `#!/bin/sh
+dir=$(dirname $0)
+echo $SHARD >> $dir/log
+if [ -f $dir/fail_$SHARD ]; then
+  echo "change failed on $SHARD" >&2
+  exit 1
+fi
+`
+
+func TestSchemaMigration(t *testing.T) {
+	hookDir, err := ioutil.TempDir("", "migration_test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(hookDir)
+	if err := ioutil.WriteFile(path.Join(hookDir, onlineSchemaChangeHook), []byte(onlineSchemaChangeTestHook), 0755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	flag.Set("vthook-dir", hookDir)
+	defer flag.Set("vthook-dir", "")
+	defer func(interval time.Duration) {
+		schemaMigrationThrottleInterval = interval
+	}(schemaMigrationThrottleInterval)
+	schemaMigrationThrottleInterval = 10 * time.Millisecond
+
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	wr.UseRPCs = false
+	done := make(chan struct{})
+	defer close(done)
+	for i, shard := range []string{"-80", "80-"} {
+		tablet := &topo.Tablet{
+			Alias:    topo.TabletAlias{Cell: "cell1", Uid: uint32(i)},
+			Hostname: "cell1host",
+			Portmap:  map[string]int{"vt": 8100 + i, "mysql": 3300 + i},
+			IPAddr:   fmt.Sprintf("%v.0.0.1", 100+i),
+			Keyspace: "test_keyspace",
+			Shard:    shard,
+			Type:     topo.TYPE_MASTER,
+			State:    topo.STATE_READ_WRITE,
+		}
+		if err := wr.InitTablet(tablet, false, true, false); err != nil {
+			t.Fatalf("InitTablet(%v): %v", shard, err)
+		}
+		startFakeTabletActionLoop(t, wr, tablet.Alias, &mysqlctl.FakeMysqlDaemon{}, done)
+	}
+
+	checkLog := func(want ...string) {
+		data, _ := ioutil.ReadFile(path.Join(hookDir, "log"))
+		if got := strings.Fields(string(data)); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("hook ran on %v, want %v", got, want)
+		}
+		os.Remove(path.Join(hookDir, "log"))
+	}
+	checkState := func(uid string, want topo.MigrationState, shards ...topo.MigrationState) *topo.SchemaMigration {
+		sm, err := ts.GetSchemaMigration("test_keyspace", uid)
+		if err != nil {
+			t.Fatalf("GetSchemaMigration: %v", err)
+		}
+		if sm.State != want {
+			t.Errorf("migration state: got %v, want %v", sm.State, want)
+		}
+		for i, shard := range []string{"-80", "80-"} {
+			if sm.Shards[shard].State != shards[i] {
+				t.Errorf("shard %v state: got %v, want %v", shard, sm.Shards[shard].State, shards[i])
+			}
+		}
+		return sm
+	}
+
+	// a failure stops the migration, the next shards are not started
+	if err := ioutil.WriteFile(path.Join(hookDir, "fail_-80"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	uid, err := wr.ApplySchemaKeyspaceOnline("test_keyspace", "alter table t add column c int")
+	if err == nil || !strings.Contains(err.Error(), "failed on shard -80") {
+		t.Errorf("ApplySchemaKeyspaceOnline: want a failure on shard -80, got %v", err)
+	}
+	checkLog("-80")
+	sm := checkState(uid, topo.MIGRATION_FAILED, topo.MIGRATION_FAILED, topo.MIGRATION_PENDING)
+	if !strings.Contains(sm.Shards["-80"].Error, "change failed on -80") {
+		t.Errorf("shard -80 error: got %v", sm.Shards["-80"].Error)
+	}
+
+	// a retry runs the failed and pending shards
+	os.Remove(path.Join(hookDir, "fail_-80"))
+	if err := wr.RetrySchemaMigration("test_keyspace", uid, false); err != nil {
+		t.Fatalf("RetrySchemaMigration: %v", err)
+	}
+	checkLog("-80", "80-")
+	sm = checkState(uid, topo.MIGRATION_COMPLETE, topo.MIGRATION_COMPLETE, topo.MIGRATION_COMPLETE)
+	if sm.Shards["-80"].Attempts != 2 || sm.Shards["80-"].Attempts != 1 || sm.Shards["-80"].Error != "" {
+		t.Errorf("unexpected shard states after retry: %v %v", sm.Shards["-80"], sm.Shards["80-"])
+	}
+
+	// a complete migration can't be retried, canceled or throttled
+	if err := wr.RetrySchemaMigration("test_keyspace", uid, true); err == nil {
+		t.Errorf("RetrySchemaMigration of a complete migration should fail")
+	}
+	if err := wr.CancelSchemaMigration("test_keyspace", uid); err == nil {
+		t.Errorf("CancelSchemaMigration of a complete migration should fail")
+	}
+	if err := wr.ThrottleSchemaMigration("test_keyspace", uid, true); err == nil {
+		t.Errorf("ThrottleSchemaMigration of a complete migration should fail")
+	}
+
+	// a throttled migration waits, and stops when it is canceled
+	uid, err = ts.CreateSchemaMigration("test_keyspace", topo.NewSchemaMigration("alter table t add column d int", []string{"-80", "80-"}))
+	if err != nil {
+		t.Fatalf("CreateSchemaMigration: %v", err)
+	}
+	if err := wr.ThrottleSchemaMigration("test_keyspace", uid, true); err != nil {
+		t.Fatalf("ThrottleSchemaMigration: %v", err)
+	}
+	runErr := make(chan error)
+	go func() {
+		runErr <- wr.RunSchemaMigration("test_keyspace", uid)
+	}()
+	time.Sleep(10 * schemaMigrationThrottleInterval)
+	if err := wr.CancelSchemaMigration("test_keyspace", uid); err != nil {
+		t.Fatalf("CancelSchemaMigration: %v", err)
+	}
+	if err := <-runErr; err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Errorf("RunSchemaMigration: want a canceled error, got %v", err)
+	}
+	checkLog()
+	checkState(uid, topo.MIGRATION_CANCELED, topo.MIGRATION_CANCELED, topo.MIGRATION_CANCELED)
+
+	// a canceled migration doesn't run again, unless it is retried
+	if err := wr.RunSchemaMigration("test_keyspace", uid); err == nil {
+		t.Errorf("RunSchemaMigration of a canceled migration should fail")
+	}
+	checkLog()
+	if err := wr.RetrySchemaMigration("test_keyspace", uid, false); err != nil {
+		t.Fatalf("RetrySchemaMigration: %v", err)
+	}
+	checkLog("-80", "80-")
+	checkState(uid, topo.MIGRATION_COMPLETE, topo.MIGRATION_COMPLETE, topo.MIGRATION_COMPLETE)
+}
@@ -0,0 +1,133 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// This file contains the integration with an external MySQL failover
+// tool that exposes an orchestrator-like HTTP API.
+//
+// When -orchestrator-url is set, the master is put in maintenance mode
+// in the tool while we are reparenting it, so the tool doesn't try to
+// fail it over at the same time. The other direction is covered by
+// TabletExternallyReparented, which the tool should call (through
+// vtctl) after it performed a failover.
+
+var (
+	orchestratorUrl     = flag.String("orchestrator-url", "", "base url of the orchestrator API (for instance http://orchestrator:3000/api), if empty the failover tool is not informed of maintenance operations")
+	orchestratorTimeout = flag.Duration("orchestrator-timeout", 30*time.Second, "timeout for the calls to the orchestrator API")
+)
+
+// orchestratorOwner is the owner of the maintenances we start
+const orchestratorOwner = "vitess"
+
+// orchestratorResponse is the answer to every orchestrator API call
+type orchestratorResponse struct {
+	Code    string
+	Message string
+}
+
+// orchestratorCall calls an orchestrator API method with the given
+// path components, and checks its response.
+func orchestratorCall(method string, params ...string) error {
+	parts := []string{strings.TrimRight(*orchestratorUrl, "/"), method}
+	for _, p := range params {
+		parts = append(parts, url.QueryEscape(p))
+	}
+	client := &http.Client{Timeout: *orchestratorTimeout}
+	resp, err := client.Get(strings.Join(parts, "/"))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("orchestrator %v returned %v: %v", method, resp.Status, string(body))
+	}
+	or := orchestratorResponse{}
+	if err := json.Unmarshal(body, &or); err != nil {
+		return fmt.Errorf("cannot parse orchestrator %v response: %v", method, err)
+	}
+	if or.Code != "OK" {
+		return fmt.Errorf("orchestrator %v failed: %v", method, or.Message)
+	}
+	return nil
+}
+
+// beginOrchestratorMaintenance tells the failover tool not to act on
+// the mysqld of the tablet. It returns the function to call to end the
+// maintenance. Errors are only logged, as the failover tool is not
+// critical to the operation.
+func (wr *Wrangler) beginOrchestratorMaintenance(ti *topo.TabletInfo, reason string) func() {
+	if *orchestratorUrl == "" {
+		return func() {}
+	}
+	host, port := ti.Hostname, strconv.Itoa(ti.Portmap["mysql"])
+	log.Infof("begin orchestrator maintenance on %v (%v:%v): %v", ti.Alias, host, port, reason)
+	if err := orchestratorCall("begin-maintenance", host, port, orchestratorOwner, reason); err != nil {
+		log.Warningf("cannot begin orchestrator maintenance on %v: %v", ti.Alias, err)
+		return func() {}
+	}
+	return func() {
+		log.Infof("end orchestrator maintenance on %v (%v:%v)", ti.Alias, host, port)
+		if err := orchestratorCall("end-maintenance", host, port); err != nil {
+			log.Warningf("cannot end orchestrator maintenance on %v: %v", ti.Alias, err)
+		}
+	}
+}
+
+// TabletExternallyReparented is ShardExternallyReparented for the
+// shard of the provided tablet. It is meant to be called by the
+// external failover tool once the tablet's mysqld was promoted.
+func (wr *Wrangler) TabletExternallyReparented(tabletAlias topo.TabletAlias, scrapStragglers bool, acceptSuccessPercents int) error {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+	return wr.ShardExternallyReparented(ti.Keyspace, ti.Shard, tabletAlias, scrapStragglers, acceptSuccessPercents)
+}
+
+// FindTabletByMysqlAddr returns the tablet whose mysqld is at the
+// given host:port address, the host being either the hostname or the
+// IP address of the tablet. The failover tools only know about mysqld
+// addresses.
+func (wr *Wrangler) FindTabletByMysqlAddr(addr string) (topo.TabletAlias, error) {
+	cells, err := wr.ts.GetKnownCells()
+	if err != nil {
+		return topo.TabletAlias{}, err
+	}
+	for _, cell := range cells {
+		aliases, err := wr.ts.GetTabletsByCell(cell)
+		if err != nil {
+			return topo.TabletAlias{}, err
+		}
+		tabletMap, err := GetTabletMap(wr.ts, aliases)
+		if err != nil && err != topo.ErrPartialResult {
+			return topo.TabletAlias{}, err
+		}
+		for alias, ti := range tabletMap {
+			if ti.MysqlAddr() == addr || ti.MysqlIpAddr() == addr {
+				return alias, nil
+			}
+		}
+	}
+	return topo.TabletAlias{}, fmt.Errorf("no tablet with mysqld at %v", addr)
+}
@@ -0,0 +1,50 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+func TestOrchestratorMaintenance(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		fmt.Fprintf(w, `{"Code":"OK","Message":"done"}`)
+	}))
+	defer server.Close()
+	*orchestratorUrl = server.URL + "/api"
+	defer func() { *orchestratorUrl = "" }()
+
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	masterAlias := createTestTablet(t, wr, "cell1", 0, topo.TYPE_MASTER, topo.TabletAlias{})
+	ti, err := ts.GetTablet(masterAlias)
+	if err != nil {
+		t.Fatalf("GetTablet: %v", err)
+	}
+
+	endMaintenance := wr.beginOrchestratorMaintenance(ti, "test")
+	endMaintenance()
+	want := []string{"/api/begin-maintenance/cell1host/3300/vitess/test", "/api/end-maintenance/cell1host/3300"}
+	if len(calls) != 2 || calls[0] != want[0] || calls[1] != want[1] {
+		t.Errorf("bad orchestrator calls: got %v want %v", calls, want)
+	}
+
+	alias, err := wr.FindTabletByMysqlAddr("100.0.0.1:3300")
+	if err != nil || alias != masterAlias {
+		t.Errorf("FindTabletByMysqlAddr: got %v %v want %v", alias, err, masterAlias)
+	}
+	if _, err := wr.FindTabletByMysqlAddr("cell1host:3301"); err == nil {
+		t.Errorf("FindTabletByMysqlAddr should have failed")
+	}
+}
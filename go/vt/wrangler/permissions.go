@@ -7,6 +7,7 @@ package wrangler
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 
 	log "github.com/golang/glog"
@@ -33,6 +34,27 @@ func (wr *Wrangler) diffPermissions(masterPermissions *mysqlctl.Permissions, mas
 	mysqlctl.DiffPermissions(masterAlias.String(), masterPermissions, alias.String(), slavePermissions, er)
 }
 
+// checkMasterElectPermissions makes sure the master-elect has the
+// same permissions as the current master, so a reparent doesn't
+// expose drifted grants to the applications. Only a difference in
+// the grants asks to fix them, the errors getting the permissions
+// are returned as they are.
+func (wr *Wrangler) checkMasterElectPermissions(masterAlias, masterElectAlias topo.TabletAlias) error {
+	log.Infof("Gathering permissions for master %v and master-elect %v", masterAlias, masterElectAlias)
+	masterPermissions, err := wr.GetPermissions(masterAlias)
+	if err != nil {
+		return fmt.Errorf("cannot get the permissions of master %v: %v", masterAlias, err)
+	}
+	masterElectPermissions, err := wr.GetPermissions(masterElectAlias)
+	if err != nil {
+		return fmt.Errorf("cannot get the permissions of master-elect %v: %v", masterElectAlias, err)
+	}
+	if diffs := mysqlctl.DiffPermissionsToArray(masterAlias.String(), masterPermissions, masterElectAlias.String(), masterElectPermissions); len(diffs) > 0 {
+		return fmt.Errorf("master-elect %v has different permissions than master %v, fix the grants (see vtctl ValidatePermissionsShard) or use -skip-permissions-check before reparenting:\n%v", masterElectAlias, masterAlias, strings.Join(diffs, "\n"))
+	}
+	return nil
+}
+
 func (wr *Wrangler) ValidatePermissionsShard(keyspace, shard string) error {
 	si, err := wr.ts.GetShard(keyspace, shard)
 	if err != nil {
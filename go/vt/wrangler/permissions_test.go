@@ -0,0 +1,82 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+func newFakePermissions(privilege string) *mysqlctl.Permissions {
+	return &mysqlctl.Permissions{
+		UserPermissions: []*mysqlctl.UserPermission{
+			&mysqlctl.UserPermission{
+				Host:       "%",
+				User:       "vt_app",
+				Privileges: map[string]string{"Select_priv": "Y", "Insert_priv": privilege},
+			},
+		},
+	}
+}
+
+func TestCheckMasterElectPermissions(t *testing.T) {
+	defer func(protocol string) {
+		*tabletManagerProtocol = protocol
+	}(*tabletManagerProtocol)
+	*tabletManagerProtocol = "fake"
+
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	master := topo.TabletAlias{Cell: "cell1", Uid: 1}
+	masterElect := topo.TabletAlias{Cell: "cell1", Uid: 2}
+	for i, alias := range []topo.TabletAlias{master, masterElect} {
+		tablet := &topo.Tablet{
+			Alias:    alias,
+			Hostname: "cell1host",
+			Portmap:  map[string]int{"vt": 8100 + i, "mysql": 3300 + i},
+			IPAddr:   fmt.Sprintf("%v.0.0.1", 100+i),
+			Keyspace: "test_keyspace",
+			Shard:    "0",
+			Type:     topo.TYPE_REPLICA,
+		}
+		if err := ts.CreateTablet(tablet); err != nil {
+			t.Fatalf("CreateTablet(%v): %v", alias, err)
+		}
+	}
+	defer func() {
+		delete(fakePermissions, master)
+		delete(fakePermissions, masterElect)
+	}()
+
+	// same permissions
+	fakePermissions[master] = newFakePermissions("Y")
+	fakePermissions[masterElect] = newFakePermissions("Y")
+	if err := wr.checkMasterElectPermissions(master, masterElect); err != nil {
+		t.Errorf("checkMasterElectPermissions with the same permissions: %v", err)
+	}
+
+	// different permissions ask to fix the grants
+	fakePermissions[masterElect] = newFakePermissions("N")
+	err := wr.checkMasterElectPermissions(master, masterElect)
+	if err == nil || !strings.Contains(err.Error(), "has different permissions") || !strings.Contains(err.Error(), "fix the grants") {
+		t.Errorf("checkMasterElectPermissions with different permissions: want a grants error, got %v", err)
+	}
+
+	// an error getting the permissions is not about the grants
+	delete(fakePermissions, masterElect)
+	err = wr.checkMasterElectPermissions(master, masterElect)
+	if err == nil || !strings.Contains(err.Error(), "timeout waiting for") {
+		t.Errorf("checkMasterElectPermissions without an answer: want a timeout error, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "fix the grants") {
+		t.Errorf("checkMasterElectPermissions without an answer should not ask to fix the grants: %v", err)
+	}
+}
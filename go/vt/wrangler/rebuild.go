@@ -7,6 +7,7 @@ package wrangler
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/vt/concurrency"
@@ -126,6 +127,25 @@ func (wr *Wrangler) rebuildShardSrvGraph(shardInfo *topo.ShardInfo, tablets []*t
 
 	// we keep track of the existingDbTypeLocations we've already looked at
 	knownShardLocations := make(map[cellKeyspaceShard]bool)
+	findExistingDbTypes := func(shardLocation cellKeyspaceShard) error {
+		// only need to do this once per cell
+		if knownShardLocations[shardLocation] {
+			return nil
+		}
+		log.Infof("Getting tablet types on cell %v for %v/%v", shardLocation.cell, shardLocation.keyspace, shardLocation.shard)
+		tabletTypes, err := wr.ts.GetSrvTabletTypesPerShard(shardLocation.cell, shardLocation.keyspace, shardLocation.shard)
+		if err != nil {
+			if err != topo.ErrNoNode {
+				return err
+			}
+		} else {
+			for _, tabletType := range tabletTypes {
+				existingDbTypeLocations[cellKeyspaceShardType{shardLocation.cell, shardLocation.keyspace, shardLocation.shard, tabletType}] = true
+			}
+		}
+		knownShardLocations[shardLocation] = true
+		return nil
+	}
 
 	for _, tablet := range tablets {
 		// only look at tablets in the cells we want to rebuild
@@ -144,20 +164,8 @@ func (wr *Wrangler) rebuildShardSrvGraph(shardInfo *topo.ShardInfo, tablets []*t
 		// this is {cell,keyspace,shard}
 		// we'll get the children to find the existing types
 		shardLocation := cellKeyspaceShard{tablet.Tablet.Alias.Cell, tablet.Tablet.Keyspace, tablet.Shard}
-		// only need to do this once per cell
-		if !knownShardLocations[shardLocation] {
-			log.Infof("Getting tablet types on cell %v for %v/%v", tablet.Tablet.Alias.Cell, tablet.Tablet.Keyspace, tablet.Shard)
-			tabletTypes, err := wr.ts.GetSrvTabletTypesPerShard(tablet.Tablet.Alias.Cell, tablet.Tablet.Keyspace, tablet.Shard)
-			if err != nil {
-				if err != topo.ErrNoNode {
-					return err
-				}
-			} else {
-				for _, tabletType := range tabletTypes {
-					existingDbTypeLocations[cellKeyspaceShardType{tablet.Tablet.Alias.Cell, tablet.Tablet.Keyspace, tablet.Shard, tabletType}] = true
-				}
-			}
-			knownShardLocations[shardLocation] = true
+		if err := findExistingDbTypes(shardLocation); err != nil {
+			return err
 		}
 
 		// Check IsServingType after we have populated existingDbTypeLocations
@@ -182,6 +190,18 @@ func (wr *Wrangler) rebuildShardSrvGraph(shardInfo *topo.ShardInfo, tablets []*t
 		addrs.Entries = append(addrs.Entries, *entry)
 	}
 
+	// The cells of the shard that don't have a tablet any more (the
+	// last one was scrapped for instance) need their db types
+	// removed too.
+	for _, cell := range shardInfo.Cells {
+		if !inCellList(cell, cells) {
+			continue
+		}
+		if err := findExistingDbTypes(cellKeyspaceShard{cell, shardInfo.Keyspace(), shardInfo.ShardName()}); err != nil {
+			return err
+		}
+	}
+
 	// we're gonna parallelize a lot here
 	rec := concurrency.AllErrorRecorder{}
 	wg := sync.WaitGroup{}
@@ -325,6 +345,10 @@ func (wr *Wrangler) rebuildKeyspace(keyspace string, cells []string, useServedTy
 	//   value: topo.SrvKeyspace object being built
 	srvKeyspaceMap := make(map[cellKeyspace]*topo.SrvKeyspace)
 	for _, alias := range aliases {
+		// only rebuild the cells we want
+		if !inCellList(alias.Cell, cells) {
+			continue
+		}
 		keyspaceLocation := cellKeyspace{alias.Cell, keyspace}
 		if _, ok := srvKeyspaceMap[keyspaceLocation]; !ok {
 			// before adding keyspaceLocation to the map of
@@ -396,12 +420,7 @@ func (wr *Wrangler) rebuildKeyspace(keyspace string, cells []string, useServedTy
 	}
 
 	// and then finally save the keyspace objects
-	for ck, srvKeyspace := range srvKeyspaceMap {
-		if err := wr.ts.UpdateSrvKeyspace(ck.cell, ck.keyspace, srvKeyspace); err != nil {
-			return fmt.Errorf("writing serving data failed: %v", err)
-		}
-	}
-	return nil
+	return wr.saveSrvKeyspaces(shards, srvKeyspaceMap)
 }
 
 func (wr *Wrangler) rebuildKeyspaceWithServedTypes(shards []string, srvKeyspaceMap map[cellKeyspace]*topo.SrvKeyspace) error {
@@ -465,14 +484,47 @@ func (wr *Wrangler) rebuildKeyspaceWithServedTypes(shards []string, srvKeyspaceM
 	}
 
 	// and then finally save the keyspace objects
+	return wr.saveSrvKeyspaces(shards, srvKeyspaceMap)
+}
+
+// saveSrvKeyspaces saves the rebuilt keyspace objects, and the copy of
+// the serving graph of their cell in the global topology.
+func (wr *Wrangler) saveSrvKeyspaces(shards []string, srvKeyspaceMap map[cellKeyspace]*topo.SrvKeyspace) error {
 	for ck, srvKeyspace := range srvKeyspaceMap {
 		if err := wr.ts.UpdateSrvKeyspace(ck.cell, ck.keyspace, srvKeyspace); err != nil {
 			return fmt.Errorf("writing serving data failed: %v", err)
 		}
+		// the mirror is only used if the topology server of
+		// the cell is down, failing to save it is not fatal
+		if err := wr.mirrorSrvKeyspace(ck, shards, srvKeyspace); err != nil {
+			log.Warningf("cannot save the copy of the serving graph of cell %v for keyspace %v: %v", ck.cell, ck.keyspace, err)
+		}
 	}
 	return nil
 }
 
+// mirrorSrvKeyspace saves the copy of the serving graph of a keyspace
+// in a cell in the global topology, for the clients of the cell to
+// use if its topology server is down.
+func (wr *Wrangler) mirrorSrvKeyspace(ck cellKeyspace, shards []string, srvKeyspace *topo.SrvKeyspace) error {
+	mirror := &topo.SrvKeyspaceMirror{
+		SrvKeyspace: srvKeyspace,
+		EndPoints:   make(map[string]map[topo.TabletType]*topo.EndPoints),
+		RebuildTime: time.Now().Unix(),
+	}
+	for _, shard := range shards {
+		endPointsPerType, err := wr.ts.GetEndPointsPerShard(ck.cell, ck.keyspace, shard)
+		if err == topo.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		mirror.EndPoints[shard] = endPointsPerType
+	}
+	return wr.ts.UpdateSrvKeyspaceMirror(ck.cell, ck.keyspace, mirror)
+}
+
 // This is a quick and dirty tool to resurrect the TopologyServer data from the
 // canonical data stored in the tablet nodes.
 //
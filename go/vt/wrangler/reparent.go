@@ -13,8 +13,13 @@ Connect to N and record file/position from "show master status"
 
 On N: (Demote Master)
   SET GLOBAL READ_ONLY = 1;
+  SET GLOBAL SUPER_READ_ONLY = 1; (if mysqld has it)
   FLUSH TABLES WITH READ LOCK;
   UNLOCK TABLES;
+  check READ_ONLY, then mark the tablet record fenced, which stops
+  the query service of N. The reparent checks the record is fenced,
+  and the RPC waits for the query service to stop, before X is
+  promoted.
 
 While this is read-only, all the replicas should sync to the same point.
 
@@ -38,6 +43,7 @@ On X: (Promote Slave)
   SHOW MASTER STATUS;
     replication file,position
   INSERT INTO _vt.replication_log (time_created_ns, 'reparent check') VALUES (<time>);
+  INSERT INTO _vt.reparent_journal (time_created_ns, ...) VALUES (<time>, <action>, <old master>, X, <new pos>);
   INSERT INTO _vt.reparent_log (time_created_ns, 'last post', 'new pos') VALUES ... ;
   SHOW MASTER STATUS;
     wait file,position
@@ -57,6 +63,7 @@ For all slaves in majority N:
     START SLAVE;
     SELECT MASTER_POS_WAIT(file, pos, deadline)
     SELECT time_created FROM _vt.replication_log WHERE time_created_ns = <time>;
+    SELECT new_master_alias FROM _vt.reparent_journal WHERE time_created_ns = <time>;
 
 if no connection to N is available, ???
 
@@ -68,6 +75,8 @@ import (
 	"fmt"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/vt/events"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	tm "github.com/youtube/vitess/go/vt/tabletmanager"
 	"github.com/youtube/vitess/go/vt/topo"
@@ -85,7 +94,25 @@ const (
 //   though all the other necessary updates have been made.
 // forceReparentToCurrentMaster: mostly for test setups, this can
 //   cause data loss.
-func (wr *Wrangler) ReparentShard(keyspace, shard string, masterElectTabletAlias topo.TabletAlias, leaveMasterReadOnly, forceReparentToCurrentMaster bool) error {
+// skipPermissionsCheck: don't check the master-elect has the same
+//   permissions as the current master.
+func (wr *Wrangler) ReparentShard(keyspace, shard string, masterElectTabletAlias topo.TabletAlias, leaveMasterReadOnly, forceReparentToCurrentMaster, skipPermissionsCheck bool) error {
+	// a shard with a master is reparented gracefully, with a
+	// workflow that can be resumed or rolled back
+	if !forceReparentToCurrentMaster {
+		shardInfo, err := wr.ts.GetShard(keyspace, shard)
+		if err != nil {
+			return err
+		}
+		if !shardInfo.MasterAlias.IsZero() {
+			if shardInfo.MasterAlias == masterElectTabletAlias {
+				return fmt.Errorf("master-elect tablet %v is already master - specify -force to override", masterElectTabletAlias)
+			}
+			_, err := wr.PlannedReparent(keyspace, shard, masterElectTabletAlias, leaveMasterReadOnly, skipPermissionsCheck)
+			return err
+		}
+	}
+
 	// lock the shard
 	actionNode := wr.ai.ReparentShard(masterElectTabletAlias)
 	lockPath, err := wr.lockShard(keyspace, shard, actionNode)
@@ -94,13 +121,13 @@ func (wr *Wrangler) ReparentShard(keyspace, shard string, masterElectTabletAlias
 	}
 
 	// do the work
-	err = wr.reparentShardLocked(keyspace, shard, masterElectTabletAlias, leaveMasterReadOnly, forceReparentToCurrentMaster)
+	err = wr.reparentShardLocked(keyspace, shard, masterElectTabletAlias, leaveMasterReadOnly, forceReparentToCurrentMaster, skipPermissionsCheck)
 
 	// and unlock
 	return wr.unlockShard(keyspace, shard, actionNode, lockPath, err)
 }
 
-func (wr *Wrangler) reparentShardLocked(keyspace, shard string, masterElectTabletAlias topo.TabletAlias, leaveMasterReadOnly, forceReparentToCurrentMaster bool) error {
+func (wr *Wrangler) reparentShardLocked(keyspace, shard string, masterElectTabletAlias topo.TabletAlias, leaveMasterReadOnly, forceReparentToCurrentMaster, skipPermissionsCheck bool) error {
 	shardInfo, err := wr.ts.GetShard(keyspace, shard)
 	if err != nil {
 		return err
@@ -121,15 +148,28 @@ func (wr *Wrangler) reparentShardLocked(keyspace, shard string, masterElectTable
 		return fmt.Errorf("master-elect tablet %v not found in replication graph %v/%v %v", masterElectTabletAlias, keyspace, shard, mapKeys(tabletMap))
 	}
 
+	ev := &events.Reparent{
+		Keyspace:  keyspace,
+		Shard:     shard,
+		OldMaster: shardInfo.MasterAlias,
+		NewMaster: masterElectTabletAlias,
+		Status:    "started",
+	}
+	event.Dispatch(ev)
+
 	if !shardInfo.MasterAlias.IsZero() && !forceReparentToCurrentMaster {
-		err = wr.reparentShardGraceful(shardInfo, slaveTabletMap, masterTabletMap, masterElectTablet, leaveMasterReadOnly)
+		err = wr.reparentShardGraceful(shardInfo, masterElectTabletAlias, leaveMasterReadOnly, skipPermissionsCheck)
 	} else {
 		err = wr.reparentShardBrutal(shardInfo, slaveTabletMap, masterTabletMap, masterElectTablet, leaveMasterReadOnly, forceReparentToCurrentMaster)
 	}
 	if err == nil {
 		// only log if it works, if it fails we'll show the error
 		log.Infof("reparentShard finished")
+		ev.Status = "finished"
+	} else {
+		ev.Status = "failed: " + err.Error()
 	}
+	event.Dispatch(ev)
 	return err
 }
 
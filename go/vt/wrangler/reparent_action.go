@@ -254,17 +254,34 @@ func (wr *Wrangler) tabletReplicationPositions(tablets []*topo.TabletInfo) ([]*m
 	return positions, nil
 }
 
+// demoteMaster fences the master before a new master is promoted:
+// its mysql is made read-only, its tablet record fenced, and its
+// query service stopped (the RPC waits for it). The tablet record is
+// then checked.
 func (wr *Wrangler) demoteMaster(ti *topo.TabletInfo) (*mysqlctl.ReplicationPosition, error) {
 	log.Infof("demote master %v", ti.Alias)
-	actionPath, err := wr.ai.DemoteMaster(ti.Alias)
+	var err error
+	if wr.UseRPCs {
+		err = wr.ai.RpcDemoteMaster(ti, wr.actionTimeout())
+	} else {
+		var actionPath string
+		actionPath, err = wr.ai.DemoteMaster(ti.Alias)
+		if err == nil {
+			err = wr.ai.WaitForCompletion(actionPath, wr.actionTimeout())
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
-	err = wr.ai.WaitForCompletion(actionPath, wr.actionTimeout())
+
+	fenced, err := wr.ts.GetTablet(ti.Alias)
 	if err != nil {
 		return nil, err
 	}
-	return wr.ai.MasterPosition(ti, wr.actionTimeout())
+	if fenced.State != topo.STATE_FENCED {
+		return nil, fmt.Errorf("demoted master %v is in state %v, expected %v", ti.Alias, fenced.State, topo.STATE_FENCED)
+	}
+	return wr.ai.MasterPosition(fenced, wr.actionTimeout())
 }
 
 func (wr *Wrangler) promoteSlave(ti *topo.TabletInfo) (rsd *tm.RestartSlaveData, err error) {
@@ -351,11 +368,7 @@ func (wr *Wrangler) finishReparent(si *topo.ShardInfo, masterElect *topo.TabletI
 			log.Warningf("leaving master-elect read-only, change with: vtctl SetReadWrite %v", masterElect.Alias)
 		} else {
 			log.Infof("marking master-elect read-write %v", masterElect.Alias)
-			actionPath, err := wr.ai.SetReadWrite(masterElect.Alias)
-			if err == nil {
-				err = wr.ai.WaitForCompletion(actionPath, wr.actionTimeout())
-			}
-			if err != nil {
+			if err := wr.SetReadOnly(masterElect.Alias, false); err != nil {
 				log.Warningf("master master-elect read-write failed, leaving master-elect read-only, change with: vtctl SetReadWrite %v", masterElect.Alias)
 			}
 		}
@@ -50,6 +50,35 @@ func createTestTablet(t *testing.T, wr *Wrangler, cell string, uid uint32, table
 	return tablet.Alias
 }
 
+// fakePermissions are the permissions returned by
+// fakeTabletManagerConn, by tablet alias.
+var fakePermissions = make(map[topo.TabletAlias]*mysqlctl.Permissions)
+
+// fakeTabletManagerConn is the TabletManagerConn of the "fake"
+// protocol. It answers GetPermissions from fakePermissions, and
+// SlavePosition with an error. The other calls are not implemented.
+type fakeTabletManagerConn struct {
+	tm.TabletManagerConn
+}
+
+func (c *fakeTabletManagerConn) GetPermissions(tablet *topo.TabletInfo, waitTime time.Duration) (*mysqlctl.Permissions, error) {
+	p, ok := fakePermissions[tablet.Alias]
+	if !ok {
+		return nil, fmt.Errorf("timeout waiting for %v", tablet.Alias)
+	}
+	return p, nil
+}
+
+func (c *fakeTabletManagerConn) SlavePosition(tablet *topo.TabletInfo, waitTime time.Duration) (*mysqlctl.ReplicationPosition, error) {
+	return nil, fmt.Errorf("no replication on %v", tablet.Alias)
+}
+
+func init() {
+	tm.RegisterTabletManagerConnFactory("fake", func(ts topo.Server) tm.TabletManagerConn {
+		return &fakeTabletManagerConn{}
+	})
+}
+
 // startFakeTabletActionLoop will start the action loop for a fake tablet,
 // using mysqlDaemon as the backing mysqld.
 func startFakeTabletActionLoop(t *testing.T, wr *Wrangler, tabletAlias topo.TabletAlias, mysqlDaemon mysqlctl.MysqlDaemon, done chan struct{}) {
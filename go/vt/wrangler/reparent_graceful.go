@@ -5,21 +5,290 @@
 package wrangler
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/vt/events"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	tm "github.com/youtube/vitess/go/vt/tabletmanager"
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
-func (wr *Wrangler) reparentShardGraceful(si *topo.ShardInfo, slaveTabletMap, masterTabletMap map[topo.TabletAlias]*topo.TabletInfo, masterElectTablet *topo.TabletInfo, leaveMasterReadOnly bool) error {
-	// Validate a bunch of assumptions we make about the replication graph.
+// plannedReparentWorkflow is the workflow for graceful reparents.
+// Its parameters are keyspace, shard, master_elect,
+// leave_master_read_only and skip_permissions_check.
+const plannedReparentWorkflow = "PlannedReparent"
+
+// PlannedReparent reparents a shard that has a live master to the
+// master-elect tablet, as a workflow. It returns the workflow id,
+// so a failed reparent can be resumed or rolled back.
+func (wr *Wrangler) PlannedReparent(keyspace, shard string, masterElectTabletAlias topo.TabletAlias, leaveMasterReadOnly, skipPermissionsCheck bool) (string, error) {
+	shardInfo, err := wr.ts.GetShard(keyspace, shard)
+	if err != nil {
+		return "", err
+	}
+	ev := &events.Reparent{
+		Keyspace:  keyspace,
+		Shard:     shard,
+		OldMaster: shardInfo.MasterAlias,
+		NewMaster: masterElectTabletAlias,
+		Status:    "started",
+	}
+	event.Dispatch(ev)
+
+	uid, err := wr.StartWorkflow(keyspace, plannedReparentWorkflow, map[string]string{
+		"keyspace":               keyspace,
+		"shard":                  shard,
+		"master_elect":           masterElectTabletAlias.String(),
+		"leave_master_read_only": strconv.FormatBool(leaveMasterReadOnly),
+		"skip_permissions_check": strconv.FormatBool(skipPermissionsCheck),
+	})
+	if err == nil {
+		log.Infof("reparentShard finished")
+		ev.Status = "finished"
+	} else {
+		ev.Status = "failed: " + err.Error()
+	}
+	event.Dispatch(ev)
+	return uid, err
+}
+
+func newPlannedReparentWorkflow(wr *Wrangler, params map[string]string) (*workflow, error) {
+	keyspace, shard := params["keyspace"], params["shard"]
+	masterElectTabletAlias, err := topo.ParseTabletAliasString(params["master_elect"])
+	if err != nil {
+		return nil, err
+	}
+	leaveMasterReadOnly, err := strconv.ParseBool(params["leave_master_read_only"])
+	if err != nil {
+		return nil, err
+	}
+	// the workflows started before the parameter existed don't have it
+	skipPermissionsCheck := params["skip_permissions_check"] == "true"
+
+	return &workflow{
+		steps: wr.plannedReparentSteps(keyspace, shard, masterElectTabletAlias, leaveMasterReadOnly, skipPermissionsCheck),
+		lock: func() (func(error) error, error) {
+			actionNode := wr.ai.ReparentShard(masterElectTabletAlias)
+			lockPath, err := wr.lockShard(keyspace, shard, actionNode)
+			if err != nil {
+				return nil, err
+			}
+			si, err := wr.ts.GetShard(keyspace, shard)
+			if err != nil {
+				return nil, wr.unlockShard(keyspace, shard, actionNode, lockPath, err)
+			}
+			endMaintenance := wr.beginReparentMaintenance(si, masterElectTabletAlias)
+			return func(err error) error {
+				endMaintenance()
+				return wr.unlockShard(keyspace, shard, actionNode, lockPath, err)
+			}, nil
+		},
+	}, nil
+}
+
+// reparentShardGraceful runs the steps of a graceful reparent
+// without checkpoints. The shard has to be locked.
+func (wr *Wrangler) reparentShardGraceful(si *topo.ShardInfo, masterElectTabletAlias topo.TabletAlias, leaveMasterReadOnly, skipPermissionsCheck bool) error {
+	endMaintenance := wr.beginReparentMaintenance(si, masterElectTabletAlias)
+	defer endMaintenance()
+	return runStepsInMemory(wr.plannedReparentSteps(si.Keyspace(), si.ShardName(), masterElectTabletAlias, leaveMasterReadOnly, skipPermissionsCheck))
+}
+
+// beginReparentMaintenance tells the external failover tool, if any,
+// to leave the master of the shard alone while we demote it.
+func (wr *Wrangler) beginReparentMaintenance(si *topo.ShardInfo, masterElectTabletAlias topo.TabletAlias) func() {
+	if si.MasterAlias.IsZero() {
+		return func() {}
+	}
+	masterTablet, err := wr.ts.GetTablet(si.MasterAlias)
+	if err != nil {
+		log.Warningf("cannot read master %v: %v", si.MasterAlias, err)
+		return func() {}
+	}
+	return wr.beginOrchestratorMaintenance(masterTablet, "reparent to "+masterElectTabletAlias.String())
+}
+
+// plannedReparentSteps returns the steps of a graceful reparent. They
+// re-read the replication graph every time, and pass the old master,
+// its position and the promotion data to each other through the
+// workflow data.
+func (wr *Wrangler) plannedReparentSteps(keyspace, shard string, masterElectTabletAlias topo.TabletAlias, leaveMasterReadOnly, skipPermissionsCheck bool) []*workflowStep {
+	oldMaster := func(data map[string]string) (topo.TabletAlias, error) {
+		return topo.ParseTabletAliasString(data["old_master"])
+	}
+
+	return []*workflowStep{
+		&workflowStep{
+			name: "check",
+			do: func(data map[string]string) error {
+				tabletMap, err := GetTabletMapForShard(wr.ts, keyspace, shard)
+				if err != nil {
+					return err
+				}
+				masterElectTablet, ok := tabletMap[masterElectTabletAlias]
+				if !ok {
+					return fmt.Errorf("master-elect tablet %v not found in replication graph %v/%v %v", masterElectTabletAlias, keyspace, shard, mapKeys(tabletMap))
+				}
+				slaveTabletMap, masterTabletMap := sortedTabletMap(tabletMap)
+				masterTablet, err := wr.checkGracefulReparent(slaveTabletMap, masterTabletMap, masterElectTablet, skipPermissionsCheck)
+				if err != nil {
+					return err
+				}
+				data["old_master"] = masterTablet.Alias.String()
+				return nil
+			},
+		},
+		&workflowStep{
+			name: "demote_master",
+			do: func(data map[string]string) error {
+				alias, err := oldMaster(data)
+				if err != nil {
+					return err
+				}
+				masterTablet, err := wr.ts.GetTablet(alias)
+				if err != nil {
+					return err
+				}
+				masterPosition, err := wr.demoteMaster(masterTablet)
+				if err != nil {
+					// FIXME(msolomon) This suggests that the master is dead and we
+					// need to take steps. We could either pop a prompt, or make
+					// retrying the action painless.
+					return fmt.Errorf("demote master failed: %v, if the master is dead, run: vtctl -force ScrapTablet %v", err, alias)
+				}
+				data["master_position"], err = marshalWorkflowData(masterPosition)
+				return err
+			},
+			undo: func(data map[string]string) error {
+				alias, err := oldMaster(data)
+				if err != nil {
+					return err
+				}
+				return wr.SetReadOnly(alias, false)
+			},
+		},
+		&workflowStep{
+			name: "check_slave_consistency",
+			do: func(data map[string]string) error {
+				masterPosition := new(mysqlctl.ReplicationPosition)
+				if err := json.Unmarshal([]byte(data["master_position"]), masterPosition); err != nil {
+					return err
+				}
+				tabletMap, err := GetTabletMapForShard(wr.ts, keyspace, shard)
+				if err != nil {
+					return err
+				}
+				slaveTabletMap, _ := sortedTabletMap(tabletMap)
+				log.Infof("check slaves %v/%v", keyspace, shard)
+				if err := wr.checkSlaveConsistency(restartableTabletMap(slaveTabletMap), masterPosition); err != nil {
+					return fmt.Errorf("check slave consistency failed %v, demoted master is still fenced, run: vtctl SetReadWrite %v", err, data["old_master"])
+				}
+				return nil
+			},
+		},
+		&workflowStep{
+			name: "promote_slave",
+			do: func(data map[string]string) error {
+				masterElectTablet, err := wr.ts.GetTablet(masterElectTabletAlias)
+				if err != nil {
+					return err
+				}
+				rsd, err := wr.promoteSlave(masterElectTablet)
+				if err != nil {
+					// FIXME(msolomon) This suggests that the master-elect is dead.
+					// We need to classify certain errors as temporary and retry.
+					return fmt.Errorf("promote slave failed: %v, demoted master is still fenced, run: vtctl SetReadWrite %v", err, data["old_master"])
+				}
+				data["restart_slave_data"], err = marshalWorkflowData(rsd)
+				return err
+			},
+			irreversible: true,
+		},
+		&workflowStep{
+			name: "restart_slaves",
+			do: func(data map[string]string) error {
+				rsd := new(tm.RestartSlaveData)
+				if err := json.Unmarshal([]byte(data["restart_slave_data"]), rsd); err != nil {
+					return err
+				}
+				tabletMap, err := GetTabletMapForShard(wr.ts, keyspace, shard)
+				if err != nil {
+					return err
+				}
+				slaveTabletMap, _ := sortedTabletMap(tabletMap)
+				delete(slaveTabletMap, masterElectTabletAlias)
+
+				// Failing to restart some slaves is more of a
+				// warning at this point, it is reported once the
+				// reparent is finished.
+				majorityRestart, restartSlaveErr := wr.restartSlaves(slaveTabletMap, rsd)
+				data["majority_restart"] = strconv.FormatBool(majorityRestart)
+				data["restart_slaves_error"] = ""
+				if restartSlaveErr != nil {
+					data["restart_slaves_error"] = restartSlaveErr.Error()
+				}
+				return nil
+			},
+			irreversible: true,
+		},
+		&workflowStep{
+			name: "finish",
+			do: func(data map[string]string) error {
+				// For now, scrap the old master regardless of how many
+				// slaves restarted.
+				//
+				// FIXME(msolomon) We could reintroduce it and reparent it and use
+				// it as new replica.
+				log.Infof("scrap demoted master %v", data["old_master"])
+				alias, err := oldMaster(data)
+				if err != nil {
+					return err
+				}
+				scrapActionPath, scrapErr := wr.ai.Scrap(alias)
+				if scrapErr == nil {
+					scrapErr = wr.ai.WaitForCompletion(scrapActionPath, wr.actionTimeout())
+				}
+				if scrapErr != nil {
+					// The sub action is non-critical, so just warn.
+					log.Warningf("scrap demoted master failed: %v", scrapErr)
+				}
+
+				si, err := wr.ts.GetShard(keyspace, shard)
+				if err != nil {
+					return err
+				}
+				masterElectTablet, err := wr.ts.GetTablet(masterElectTabletAlias)
+				if err != nil {
+					return err
+				}
+				if err := wr.finishReparent(si, masterElectTablet, data["majority_restart"] == "true", leaveMasterReadOnly); err != nil {
+					return err
+				}
+				if data["restart_slaves_error"] != "" {
+					return fmt.Errorf("%v", data["restart_slaves_error"])
+				}
+				return nil
+			},
+			irreversible: true,
+		},
+	}
+}
+
+// checkGracefulReparent validates a bunch of assumptions we make
+// about the replication graph before a graceful reparent. It returns
+// the current master.
+func (wr *Wrangler) checkGracefulReparent(slaveTabletMap, masterTabletMap map[topo.TabletAlias]*topo.TabletInfo, masterElectTablet *topo.TabletInfo, skipPermissionsCheck bool) (*topo.TabletInfo, error) {
 	if len(masterTabletMap) != 1 {
 		aliases := make([]string, 0, len(masterTabletMap))
 		for _, v := range masterTabletMap {
 			aliases = append(aliases, v.String())
 		}
-		return fmt.Errorf("I have 0 or multiple masters / scrapped tablets in this shard replication graph, please scrap the non-master ones: %v", strings.Join(aliases, " "))
+		return nil, fmt.Errorf("I have 0 or multiple masters / scrapped tablets in this shard replication graph, please scrap the non-master ones: %v", strings.Join(aliases, " "))
 	}
 	var masterTablet *topo.TabletInfo
 	for _, v := range masterTabletMap {
@@ -27,88 +296,41 @@ func (wr *Wrangler) reparentShardGraceful(si *topo.ShardInfo, slaveTabletMap, ma
 	}
 
 	if masterTablet.Parent.Uid != topo.NO_TABLET {
-		return fmt.Errorf("master tablet should not have a ParentUid: %v %v", masterTablet.Parent.Uid, masterTablet.Alias)
+		return nil, fmt.Errorf("master tablet should not have a ParentUid: %v %v", masterTablet.Parent.Uid, masterTablet.Alias)
 	}
 
 	if masterTablet.Type != topo.TYPE_MASTER {
-		return fmt.Errorf("master tablet should not be type: %v %v", masterTablet.Type, masterTablet.Alias)
+		return nil, fmt.Errorf("master tablet should not be type: %v %v", masterTablet.Type, masterTablet.Alias)
 	}
 
 	if masterTablet.Alias.Uid == masterElectTablet.Alias.Uid {
-		return fmt.Errorf("master tablet should not match master elect - this must be forced: %v", masterTablet.Alias)
+		return nil, fmt.Errorf("master tablet should not match master elect - this must be forced: %v", masterTablet.Alias)
 	}
 
 	if _, ok := slaveTabletMap[masterElectTablet.Alias]; !ok {
-		return fmt.Errorf("master elect tablet not in replication graph %v %v/%v %v", masterElectTablet.Alias, masterTablet.Keyspace, masterTablet.Shard, mapKeys(slaveTabletMap))
+		return nil, fmt.Errorf("master elect tablet not in replication graph %v %v/%v %v", masterElectTablet.Alias, masterTablet.Keyspace, masterTablet.Shard, mapKeys(slaveTabletMap))
 	}
 
 	if err := wr.ValidateShard(masterTablet.Keyspace, masterTablet.Shard, true); err != nil {
-		return fmt.Errorf("ValidateShard verification failed: %v, if the master is dead, run: vtctl ScrapTablet -force %v", err, masterTablet.Alias)
+		return nil, fmt.Errorf("ValidateShard verification failed: %v, if the master is dead, run: vtctl ScrapTablet -force %v", err, masterTablet.Alias)
 	}
 
 	// Make sure all tablets have the right parent and reasonable positions.
-	err := wr.checkSlaveReplication(slaveTabletMap, masterTablet.Alias.Uid)
-	if err != nil {
-		return err
+	if err := wr.checkSlaveReplication(slaveTabletMap, masterTablet.Alias.Uid); err != nil {
+		return nil, err
 	}
 
 	// Check the master-elect is fit for duty - call out for hardware checks.
-	err = wr.checkMasterElect(masterElectTablet)
-	if err != nil {
-		return err
-	}
-
-	masterPosition, err := wr.demoteMaster(masterTablet)
-	if err != nil {
-		// FIXME(msolomon) This suggests that the master is dead and we
-		// need to take steps. We could either pop a prompt, or make
-		// retrying the action painless.
-		return fmt.Errorf("demote master failed: %v, if the master is dead, run: vtctl -force ScrapTablet %v", err, masterTablet.Alias)
-	}
-
-	log.Infof("check slaves %v/%v", masterTablet.Keyspace, masterTablet.Shard)
-	restartableSlaveTabletMap := restartableTabletMap(slaveTabletMap)
-	err = wr.checkSlaveConsistency(restartableSlaveTabletMap, masterPosition)
-	if err != nil {
-		return fmt.Errorf("check slave consistency failed %v, demoted master is still read only, run: vtctl SetReadWrite %v", err, masterTablet.Alias)
+	if err := wr.checkMasterElect(masterElectTablet); err != nil {
+		return nil, err
 	}
 
-	rsd, err := wr.promoteSlave(masterElectTablet)
-	if err != nil {
-		// FIXME(msolomon) This suggests that the master-elect is dead.
-		// We need to classify certain errors as temporary and retry.
-		return fmt.Errorf("promote slave failed: %v, demoted master is still read only: vtctl SetReadWrite %v", err, masterTablet.Alias)
-	}
-
-	// Once the slave is promoted, remove it from our map
-	delete(slaveTabletMap, masterElectTablet.Alias)
-
-	majorityRestart, restartSlaveErr := wr.restartSlaves(slaveTabletMap, rsd)
-
-	// For now, scrap the old master regardless of how many
-	// slaves restarted.
-	//
-	// FIXME(msolomon) We could reintroduce it and reparent it and use
-	// it as new replica.
-	log.Infof("scrap demoted master %v", masterTablet.Alias)
-	scrapActionPath, scrapErr := wr.ai.Scrap(masterTablet.Alias)
-	if scrapErr == nil {
-		scrapErr = wr.ai.WaitForCompletion(scrapActionPath, wr.actionTimeout())
-	}
-	if scrapErr != nil {
-		// The sub action is non-critical, so just warn.
-		log.Warningf("scrap demoted master failed: %v", scrapErr)
+	// Make sure the applications will see the same grants on the
+	// new master.
+	if skipPermissionsCheck {
+		log.Warningf("not checking the permissions of master-elect %v", masterElectTablet.Alias)
+	} else if err := wr.checkMasterElectPermissions(masterTablet.Alias, masterElectTablet.Alias); err != nil {
+		return nil, err
 	}
-
-	err = wr.finishReparent(si, masterElectTablet, majorityRestart, leaveMasterReadOnly)
-	if err != nil {
-		return err
-	}
-
-	if restartSlaveErr != nil {
-		// This is more of a warning at this point.
-		return restartSlaveErr
-	}
-
-	return nil
+	return masterTablet, nil
 }
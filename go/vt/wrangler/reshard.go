@@ -0,0 +1,198 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// reshardWorkflow is the workflow that reshards a keyspace from
+// start to finish. Its parameters are keyspace, source_shards and
+// destination_shards (comma separated lists), plus the parameters
+// of the ReshardWorkers.
+const reshardWorkflow = "Reshard"
+
+// ReshardWorkers run the data copy and the data diff of a Reshard.
+// They are implemented by the worker library, that registers itself
+// when linked in.
+type ReshardWorkers interface {
+	// SplitClone copies the data of the source shard to the
+	// destination shards, and sets up filtered replication.
+	SplitClone(wr *Wrangler, keyspace, shard string, params map[string]string) error
+
+	// SplitDiff compares the data of a destination shard with its
+	// source shard.
+	SplitDiff(wr *Wrangler, keyspace, shard string, params map[string]string) error
+}
+
+var reshardWorkers ReshardWorkers
+
+// RegisterReshardWorkers registers the ReshardWorkers to use.
+func RegisterReshardWorkers(rw ReshardWorkers) {
+	if reshardWorkers != nil {
+		log.Fatalf("ReshardWorkers already registered")
+	}
+	reshardWorkers = rw
+}
+
+// Reshard splits or merges the source shards of a keyspace into the
+// destination shards: it creates the destination shards, copies the
+// schema and the data, checks the data, and migrates the served
+// types one at a time. It returns the workflow id, to follow it with
+// GetWorkflows, and pause, resume or abort (roll back) it.
+//
+// The destination shards need a master before the schema is
+// copied. If they don't have one, the workflow fails, and can be
+// resumed once their tablets are up.
+func (wr *Wrangler) Reshard(keyspace string, sourceShards, destinationShards []string, params map[string]string) (string, error) {
+	if reshardWorkers == nil {
+		return "", fmt.Errorf("Reshard needs the worker library, that is not linked in this binary")
+	}
+	workflowParams := map[string]string{
+		"keyspace":           keyspace,
+		"source_shards":      strings.Join(sourceShards, ","),
+		"destination_shards": strings.Join(destinationShards, ","),
+	}
+	for k, v := range params {
+		workflowParams[k] = v
+	}
+	return wr.StartWorkflow(keyspace, reshardWorkflow, workflowParams)
+}
+
+func newReshardWorkflow(wr *Wrangler, params map[string]string) (*workflow, error) {
+	keyspace := params["keyspace"]
+	sources := strings.Split(params["source_shards"], ",")
+	destinations := strings.Split(params["destination_shards"], ",")
+	if reshardWorkers == nil {
+		return nil, fmt.Errorf("Reshard needs the worker library, that is not linked in this binary")
+	}
+
+	// forEach runs f for all the shards, in parallel
+	forEach := func(shards []string, f func(shard string) error) error {
+		wg := sync.WaitGroup{}
+		rec := concurrency.AllErrorRecorder{}
+		for _, shard := range shards {
+			wg.Add(1)
+			go func(shard string) {
+				defer wg.Done()
+				rec.RecordError(f(shard))
+			}(shard)
+		}
+		wg.Wait()
+		return rec.Error()
+	}
+
+	// migrate moves a served type from the sources to the
+	// destinations. Sources that are already migrated are skipped,
+	// so the step can be resumed.
+	migrate := func(servedType topo.TabletType, reverse bool) func(data map[string]string) error {
+		return func(data map[string]string) error {
+			for _, shard := range sources {
+				si, err := wr.ts.GetShard(keyspace, shard)
+				if err != nil {
+					return err
+				}
+				if topo.IsTypeInList(servedType, si.ServedTypes) == reverse {
+					log.Infof("Shard %v/%v already migrated for %v", keyspace, shard, servedType)
+					continue
+				}
+				if err := wr.MigrateServedTypes(keyspace, shard, servedType, reverse); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	// All the steps lock what they change themselves, so the
+	// workflow has no lock.
+	return &workflow{
+		steps: []*workflowStep{
+			&workflowStep{
+				name: "create_shards",
+				do: func(data map[string]string) error {
+					for _, shard := range destinations {
+						if _, err := wr.ts.GetShard(keyspace, shard); err != topo.ErrNoNode {
+							if err != nil {
+								return err
+							}
+							log.Infof("Shard %v/%v already exists", keyspace, shard)
+							continue
+						}
+						if err := topo.CreateShard(wr.ts, keyspace, shard); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+			&workflowStep{
+				name: "copy_schema",
+				do: func(data map[string]string) error {
+					si, err := wr.ts.GetShard(keyspace, sources[0])
+					if err != nil {
+						return err
+					}
+					var excludeTables []string
+					if params["exclude_tables"] != "" {
+						excludeTables = strings.Split(params["exclude_tables"], ",")
+					}
+					return forEach(destinations, func(shard string) error {
+						if err := wr.CopySchemaShard(si.MasterAlias, nil, excludeTables, true, keyspace, shard); err != nil {
+							return fmt.Errorf("cannot copy the schema to %v/%v (its tablets need to be up): %v", keyspace, shard, err)
+						}
+						return nil
+					})
+				},
+			},
+			&workflowStep{
+				name: "split_clone",
+				do: func(data map[string]string) error {
+					for _, shard := range sources {
+						if err := reshardWorkers.SplitClone(wr, keyspace, shard, params); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+				// stops filtered replication
+				undo: func(data map[string]string) error {
+					return forEach(destinations, func(shard string) error {
+						return wr.SetSourceShards(keyspace, shard, nil)
+					})
+				},
+			},
+			&workflowStep{
+				name: "split_diff",
+				do: func(data map[string]string) error {
+					return forEach(destinations, func(shard string) error {
+						return reshardWorkers.SplitDiff(wr, keyspace, shard, params)
+					})
+				},
+			},
+			&workflowStep{
+				name: "migrate_rdonly",
+				do:   migrate(topo.TYPE_RDONLY, false),
+				undo: migrate(topo.TYPE_RDONLY, true),
+			},
+			&workflowStep{
+				name: "migrate_replica",
+				do:   migrate(topo.TYPE_REPLICA, false),
+				undo: migrate(topo.TYPE_REPLICA, true),
+			},
+			&workflowStep{
+				name:         "migrate_master",
+				do:           migrate(topo.TYPE_MASTER, false),
+				irreversible: true,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// routing rules related methods for Wrangler
+
+// SetRoutingRule makes vtgate send the queries for fromKeyspace, and
+// fromType if not empty, to toKeyspace, and toType if not empty. The
+// target keyspace has to exist, and the types have to be serving
+// types.
+func (wr *Wrangler) SetRoutingRule(fromKeyspace string, fromType topo.TabletType, toKeyspace string, toType topo.TabletType) error {
+	for _, tt := range []topo.TabletType{fromType, toType} {
+		if tt != "" && !topo.IsServingType(tt) {
+			return fmt.Errorf("tablet type %v is not a serving type", tt)
+		}
+	}
+	keyspaces, err := wr.ts.GetKeyspaces()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, keyspace := range keyspaces {
+		if keyspace == toKeyspace {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("cannot route to unknown keyspace %v", toKeyspace)
+	}
+
+	rr, err := wr.ts.GetRoutingRules()
+	if err != nil {
+		return err
+	}
+	rr.SetRule(&topo.RoutingRule{
+		FromKeyspace:   fromKeyspace,
+		FromTabletType: fromType,
+		ToKeyspace:     toKeyspace,
+		ToTabletType:   toType,
+	})
+	log.Infof("routing keyspace %v type %v to keyspace %v type %v", fromKeyspace, fromType, toKeyspace, toType)
+	return wr.ts.SaveRoutingRules(rr)
+}
+
+// ClearRoutingRule removes the routing rule for keyspace and
+// tabletType (empty for the rule of all types).
+func (wr *Wrangler) ClearRoutingRule(keyspace string, tabletType topo.TabletType) error {
+	rr, err := wr.ts.GetRoutingRules()
+	if err != nil {
+		return err
+	}
+	if !rr.ClearRule(keyspace, tabletType) {
+		return fmt.Errorf("no routing rule for keyspace %v type %v", keyspace, tabletType)
+	}
+	return wr.ts.SaveRoutingRules(rr)
+}
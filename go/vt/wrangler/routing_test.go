@@ -0,0 +1,51 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+func TestRoutingRules(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	if err := ts.CreateKeyspace("ks2"); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+
+	if err := wr.SetRoutingRule("ks1", topo.TYPE_REPLICA, "ks3", ""); err == nil {
+		t.Errorf("SetRoutingRule to an unknown keyspace should have failed")
+	}
+	if err := wr.SetRoutingRule("ks1", topo.TYPE_SPARE, "ks2", ""); err == nil {
+		t.Errorf("SetRoutingRule of a non serving type should have failed")
+	}
+	if err := wr.SetRoutingRule("ks1", topo.TYPE_REPLICA, "ks2", topo.TYPE_RDONLY); err != nil {
+		t.Fatalf("SetRoutingRule: %v", err)
+	}
+	rr, err := ts.GetRoutingRules()
+	if err != nil {
+		t.Fatalf("GetRoutingRules: %v", err)
+	}
+	if ks, tt := rr.Route("ks1", topo.TYPE_REPLICA); ks != "ks2" || tt != topo.TYPE_RDONLY {
+		t.Errorf("Route(ks1, replica): got %v %v", ks, tt)
+	}
+	if ks, tt := rr.Route("ks1", topo.TYPE_MASTER); ks != "ks1" || tt != topo.TYPE_MASTER {
+		t.Errorf("Route(ks1, master): got %v %v", ks, tt)
+	}
+
+	if err := wr.ClearRoutingRule("ks1", ""); err == nil {
+		t.Errorf("ClearRoutingRule of a missing rule should have failed")
+	}
+	if err := wr.ClearRoutingRule("ks1", topo.TYPE_REPLICA); err != nil {
+		t.Fatalf("ClearRoutingRule: %v", err)
+	}
+	if rr, err := ts.GetRoutingRules(); err != nil || len(rr.Rules) != 0 {
+		t.Errorf("GetRoutingRules after clear: %v %v", rr, err)
+	}
+}
@@ -9,9 +9,12 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/event"
 	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/events"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/topo"
 )
@@ -25,8 +28,19 @@ func (wr *Wrangler) GetSchema(tabletAlias topo.TabletAlias, tables []string, inc
 	return wr.ai.GetSchema(ti, tables, includeViews, wr.actionTimeout())
 }
 
+// GetTableStats uses an RPC to get the approximate statistics of a
+// table from a remote tablet
+func (wr *Wrangler) GetTableStats(tabletAlias topo.TabletAlias, table string, bucketCount int) (*mysqlctl.TableStats, error) {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return nil, err
+	}
+
+	return wr.ai.GetTableStats(ti, table, bucketCount, wr.actionTimeout())
+}
+
 // helper method to asynchronously diff a schema
-func (wr *Wrangler) diffSchema(masterSchema *mysqlctl.SchemaDefinition, masterTabletAlias, alias topo.TabletAlias, includeViews bool, wg *sync.WaitGroup, er concurrency.ErrorRecorder) {
+func (wr *Wrangler) diffSchema(masterSchema *mysqlctl.SchemaDefinition, masterTabletAlias, alias topo.TabletAlias, excludeTables []string, includeViews bool, wg *sync.WaitGroup, er concurrency.ErrorRecorder) {
 	defer wg.Done()
 	log.Infof("Gathering schema for %v", alias)
 	slaveSchema, err := wr.GetSchema(alias, nil, includeViews)
@@ -34,12 +48,15 @@ func (wr *Wrangler) diffSchema(masterSchema *mysqlctl.SchemaDefinition, masterTa
 		er.RecordError(err)
 		return
 	}
+	slaveSchema = slaveSchema.FilterTables(excludeTables)
 
 	log.Infof("Diffing schema for %v", alias)
 	mysqlctl.DiffSchema(masterTabletAlias.String(), masterSchema, alias.String(), slaveSchema, er)
 }
 
-func (wr *Wrangler) ValidateSchemaShard(keyspace, shard string, includeViews bool) error {
+// ValidateSchemaShard checks all the tablets in a shard have the
+// same schema as the master, ignoring the tables in excludeTables.
+func (wr *Wrangler) ValidateSchemaShard(keyspace, shard string, excludeTables []string, includeViews bool) error {
 	si, err := wr.ts.GetShard(keyspace, shard)
 	if err != nil {
 		return err
@@ -54,6 +71,7 @@ func (wr *Wrangler) ValidateSchemaShard(keyspace, shard string, includeViews boo
 	if err != nil {
 		return err
 	}
+	masterSchema = masterSchema.FilterTables(excludeTables)
 
 	// read all the aliases in the shard, that is all tablets that are
 	// replicating from the master
@@ -71,7 +89,7 @@ func (wr *Wrangler) ValidateSchemaShard(keyspace, shard string, includeViews boo
 		}
 
 		wg.Add(1)
-		go wr.diffSchema(masterSchema, si.MasterAlias, alias, includeViews, &wg, &er)
+		go wr.diffSchema(masterSchema, si.MasterAlias, alias, excludeTables, includeViews, &wg, &er)
 	}
 	wg.Wait()
 	if er.HasErrors() {
@@ -80,7 +98,10 @@ func (wr *Wrangler) ValidateSchemaShard(keyspace, shard string, includeViews boo
 	return nil
 }
 
-func (wr *Wrangler) ValidateSchemaKeyspace(keyspace string, includeViews bool) error {
+// ValidateSchemaKeyspace checks all the tablets in a keyspace have
+// the same schema as the master of the first shard, ignoring the
+// tables in excludeTables.
+func (wr *Wrangler) ValidateSchemaKeyspace(keyspace string, excludeTables []string, includeViews bool) error {
 	// find all the shards
 	shards, err := wr.ts.GetShardNames(keyspace)
 	if err != nil {
@@ -93,7 +114,7 @@ func (wr *Wrangler) ValidateSchemaKeyspace(keyspace string, includeViews bool) e
 	}
 	sort.Strings(shards)
 	if len(shards) == 1 {
-		return wr.ValidateSchemaShard(keyspace, shards[0], includeViews)
+		return wr.ValidateSchemaShard(keyspace, shards[0], excludeTables, includeViews)
 	}
 
 	// find the reference schema using the first shard's master
@@ -110,6 +131,7 @@ func (wr *Wrangler) ValidateSchemaKeyspace(keyspace string, includeViews bool) e
 	if err != nil {
 		return err
 	}
+	referenceSchema = referenceSchema.FilterTables(excludeTables)
 
 	// then diff with all other tablets everywhere
 	er := concurrency.AllErrorRecorder{}
@@ -127,7 +149,7 @@ func (wr *Wrangler) ValidateSchemaKeyspace(keyspace string, includeViews bool) e
 		}
 
 		wg.Add(1)
-		go wr.diffSchema(referenceSchema, referenceAlias, alias, includeViews, &wg, &er)
+		go wr.diffSchema(referenceSchema, referenceAlias, alias, excludeTables, includeViews, &wg, &er)
 	}
 
 	// then diffs all tablets in the other shards
@@ -151,7 +173,7 @@ func (wr *Wrangler) ValidateSchemaKeyspace(keyspace string, includeViews bool) e
 
 		for _, alias := range aliases {
 			wg.Add(1)
-			go wr.diffSchema(referenceSchema, referenceAlias, alias, includeViews, &wg, &er)
+			go wr.diffSchema(referenceSchema, referenceAlias, alias, excludeTables, includeViews, &wg, &er)
 		}
 	}
 	wg.Wait()
@@ -161,6 +183,60 @@ func (wr *Wrangler) ValidateSchemaKeyspace(keyspace string, includeViews bool) e
 	return nil
 }
 
+// CopySchemaShard copies the schema of a source tablet to the master
+// of a destination shard, so it can be used as the destination of a
+// clone. The database is created if needed. Only the tables listed
+// in tables (or all tables if empty), minus the ones in
+// excludeTables, are copied.
+func (wr *Wrangler) CopySchemaShard(srcTabletAlias topo.TabletAlias, tables, excludeTables []string, includeViews bool, keyspace, shard string) error {
+	sd, err := wr.GetSchema(srcTabletAlias, tables, includeViews)
+	if err != nil {
+		return err
+	}
+	sd = sd.FilterTables(excludeTables)
+
+	si, err := wr.ts.GetShard(keyspace, shard)
+	if err != nil {
+		return err
+	}
+	if si.MasterAlias.Uid == topo.NO_TABLET {
+		return fmt.Errorf("No master in shard %v/%v", keyspace, shard)
+	}
+	ti, err := wr.ts.GetTablet(si.MasterAlias)
+	if err != nil {
+		return err
+	}
+
+	// create the database first, so we can apply the rest as a
+	// regular schema change that replicates to the slaves
+	sqls, err := sd.ToSQLStrings(ti.DbName())
+	if err != nil {
+		return err
+	}
+	log.Infof("Creating database %v on %v", ti.DbName(), ti.Alias)
+	if _, err := wr.ai.ExecuteFetch(ti, sqls[0], 0, false, false, wr.actionTimeout()); err != nil {
+		return fmt.Errorf("cannot create database %v on %v: %v", ti.DbName(), ti.Alias, err)
+	}
+	if len(sqls) > 1 {
+		log.Infof("Copying %v tables and views to %v", len(sqls)-1, ti.Alias)
+		sc := &mysqlctl.SchemaChange{Sql: strings.Join(sqls[1:], ";\n"), Force: false, AllowReplication: true}
+		if _, err := wr.ApplySchema(si.MasterAlias, sc); err != nil {
+			return err
+		}
+	}
+
+	// and check the result
+	destinationSd, err := wr.GetSchema(si.MasterAlias, tables, includeViews)
+	if err != nil {
+		return err
+	}
+	destinationSd = destinationSd.FilterTables(excludeTables)
+	if diffs := mysqlctl.DiffSchemaToArray("source", sd, "destination", destinationSd); len(diffs) > 0 {
+		return fmt.Errorf("schema copy from %v to %v failed: %v", srcTabletAlias, si.MasterAlias, strings.Join(diffs, "\n"))
+	}
+	return nil
+}
+
 func (wr *Wrangler) PreflightSchema(tabletAlias topo.TabletAlias, change string) (*mysqlctl.SchemaChangeResult, error) {
 	actionPath, err := wr.ai.PreflightSchema(tabletAlias, change)
 	if err != nil {
@@ -176,6 +252,9 @@ func (wr *Wrangler) PreflightSchema(tabletAlias topo.TabletAlias, change string)
 
 func (wr *Wrangler) ApplySchema(tabletAlias topo.TabletAlias, sc *mysqlctl.SchemaChange) (*mysqlctl.SchemaChangeResult, error) {
 	actionPath, err := wr.ai.ApplySchema(tabletAlias, sc)
+	if err != nil {
+		return nil, err
+	}
 
 	// the timeout is for the entire action, so it might be too big
 	// for an individual tablet
@@ -224,6 +303,11 @@ func (wr *Wrangler) lockAndApplySchemaShard(shardInfo *topo.ShardInfo, preflight
 	}
 
 	scr, err := wr.applySchemaShard(shardInfo, preflight, masterTabletAlias, change, newParentTabletAlias, simple, force)
+	ev := &events.SchemaChange{Keyspace: keyspace, Shard: shard, Change: change, Status: "applied"}
+	if err != nil {
+		ev.Status = "failed: " + err.Error()
+	}
+	event.Dispatch(ev)
 	return scr, wr.unlockShard(keyspace, shard, actionNode, lockPath, err)
 }
 
@@ -371,18 +455,7 @@ func (wr *Wrangler) applySchemaShardComplex(statusArray []*TabletStatus, shardIn
 	// if newParentTabletAlias is passed in, use that as the new master
 	if !newParentTabletAlias.IsZero() {
 		log.Infof("Reparenting with new master set to %v", newParentTabletAlias)
-		tabletMap, err := GetTabletMapForShard(wr.ts, shardInfo.Keyspace(), shardInfo.ShardName())
-		if err != nil {
-			return nil, err
-		}
-
-		slaveTabletMap, masterTabletMap := sortedTabletMap(tabletMap)
-		newMasterTablet, err := wr.ts.GetTablet(newParentTabletAlias)
-		if err != nil {
-			return nil, err
-		}
-
-		err = wr.reparentShardGraceful(shardInfo, slaveTabletMap, masterTabletMap, newMasterTablet /*leaveMasterReadOnly*/, false)
+		err := wr.reparentShardGraceful(shardInfo, newParentTabletAlias /*leaveMasterReadOnly*/, false /*skipPermissionsCheck*/, false)
 		if err != nil {
 			return nil, err
 		}
@@ -427,7 +500,14 @@ func (wr *Wrangler) applySchemaKeyspace(keyspace string, change string, simple,
 	}
 	if len(shards) == 1 {
 		log.Infof("Only one shard in keyspace %v, using ApplySchemaShard", keyspace)
-		return wr.ApplySchemaShard(keyspace, shards[0], change, topo.TabletAlias{}, simple, force)
+		scr, err := wr.ApplySchemaShard(keyspace, shards[0], change, topo.TabletAlias{}, simple, force)
+		if err != nil {
+			return nil, err
+		}
+		if err := wr.verifySchemaShard(keyspace, shards[0], scr.AfterSchema, simple); err != nil {
+			return nil, err
+		}
+		return scr, nil
 	}
 
 	// Get schema on all shard masters in parallel
@@ -487,10 +567,11 @@ func (wr *Wrangler) applySchemaKeyspace(keyspace string, change string, simple,
 	if err != nil {
 		return nil, err
 	}
+	log.Infof("Preflight schema versions: before %v, after %v", preflight.BeforeSchema.Version, preflight.AfterSchema.Version)
 
 	// for each shard, apply the change
 	log.Infof("Applying change on all shards")
-	var applyErr error
+	er := concurrency.AllErrorRecorder{}
 	for i, shard := range shards {
 		wg.Add(1)
 		go func(i int, shard string) {
@@ -498,17 +579,77 @@ func (wr *Wrangler) applySchemaKeyspace(keyspace string, change string, simple,
 
 			_, err := wr.lockAndApplySchemaShard(shardInfos[i], preflight, keyspace, shard, shardInfos[i].MasterAlias, change, topo.TabletAlias{}, simple, force)
 			if err != nil {
-				mu.Lock()
-				applyErr = err
-				mu.Unlock()
-				return
+				er.RecordError(fmt.Errorf("shard %v: %v", shard, err))
 			}
 		}(i, shard)
 	}
 	wg.Wait()
-	if applyErr != nil {
-		return nil, applyErr
+	if er.HasErrors() {
+		return nil, er.Error()
+	}
+
+	// and make sure all tablets have the new schema
+	log.Infof("Verifying schema on all shards")
+	for _, shard := range shards {
+		wg.Add(1)
+		go func(shard string) {
+			defer wg.Done()
+			er.RecordError(wr.verifySchemaShard(keyspace, shard, preflight.AfterSchema, simple))
+		}(shard)
+	}
+	wg.Wait()
+	if er.HasErrors() {
+		return nil, er.Error()
 	}
 
 	return &mysqlctl.SchemaChangeResult{BeforeSchema: preflight.BeforeSchema, AfterSchema: preflight.AfterSchema}, nil
 }
+
+// verifySchemaShard checks all the tablets in the replication graph
+// of a shard (but the LAG ones) have the expected schema. The slaves
+// may take a while to get the change through replication, so we keep
+// checking until the action timeout expires. The master is only
+// checked if includeMaster is true, as the complex schema change
+// doesn't apply the change on it.
+func (wr *Wrangler) verifySchemaShard(keyspace, shard string, expected *mysqlctl.SchemaDefinition, includeMaster bool) error {
+	tabletMap, err := GetTabletMapForShard(wr.ts, keyspace, shard)
+	if err != nil {
+		return err
+	}
+
+	er := concurrency.AllErrorRecorder{}
+	wg := sync.WaitGroup{}
+	for _, ti := range tabletMap {
+		if !topo.IsInReplicationGraph(ti.Type) || ti.Type == topo.TYPE_LAG {
+			continue
+		}
+		if ti.Type == topo.TYPE_MASTER && !includeMaster {
+			continue
+		}
+
+		wg.Add(1)
+		go func(ti *topo.TabletInfo) {
+			defer wg.Done()
+			for {
+				sd, err := wr.ai.GetSchema(ti, nil, false, wr.actionTimeout())
+				if err != nil {
+					er.RecordError(fmt.Errorf("cannot get schema for %v: %v", ti.Alias, err))
+					return
+				}
+				diffs := mysqlctl.DiffSchemaToArray("expected", expected, ti.Alias.String(), sd)
+				if len(diffs) == 0 {
+					log.Infof("Tablet %v has the expected schema (version %v)", ti.Alias, sd.Version)
+					return
+				}
+				if wr.actionTimeout() < time.Second {
+					er.RecordError(fmt.Errorf("tablet %v doesn't have the expected schema: %v", ti.Alias, strings.Join(diffs, "\n")))
+					return
+				}
+				log.Infof("Tablet %v doesn't have the expected schema yet, waiting", ti.Alias)
+				time.Sleep(time.Second)
+			}
+		}(ti)
+	}
+	wg.Wait()
+	return er.Error()
+}
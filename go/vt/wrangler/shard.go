@@ -5,6 +5,8 @@
 package wrangler
 
 import (
+	"fmt"
+
 	log "github.com/golang/glog"
 	tm "github.com/youtube/vitess/go/vt/tabletmanager"
 	"github.com/youtube/vitess/go/vt/topo"
@@ -39,6 +41,30 @@ func (wr *Wrangler) unlockShard(keyspace, shard string, actionNode *tm.ActionNod
 	return err
 }
 
+// SetSourceShards changes the SourceShards parameter of a shard, so
+// its master starts filtered replication from them. It does not
+// notify the master, it will pick up the change on its next action.
+func (wr *Wrangler) SetSourceShards(keyspace, shard string, sourceShards []topo.SourceShard) error {
+	actionNode := wr.ai.UpdateShard()
+	lockPath, err := wr.lockShard(keyspace, shard, actionNode)
+	if err != nil {
+		return err
+	}
+
+	err = wr.setSourceShards(keyspace, shard, sourceShards)
+	return wr.unlockShard(keyspace, shard, actionNode, lockPath, err)
+}
+
+func (wr *Wrangler) setSourceShards(keyspace, shard string, sourceShards []topo.SourceShard) error {
+	shardInfo, err := wr.ts.GetShard(keyspace, shard)
+	if err != nil {
+		return err
+	}
+
+	shardInfo.SourceShards = sourceShards
+	return wr.ts.UpdateShard(shardInfo)
+}
+
 // SetShardServedTypes changes the ServedTypes parameter of a shard.
 // It does not rebuild any serving graph or do any consistency check (yet).
 func (wr *Wrangler) SetShardServedTypes(keyspace, shard string, servedTypes []topo.TabletType) error {
@@ -62,3 +88,92 @@ func (wr *Wrangler) setShardServedTypes(keyspace, shard string, servedTypes []to
 	shardInfo.ServedTypes = servedTypes
 	return wr.ts.UpdateShard(shardInfo)
 }
+
+// DeleteShard deletes a shard. If it still has tablets, it fails,
+// unless recursive is set: then its tablets are deleted first (and
+// if one of them is serving, it fails unless evenIfServing is set).
+// Then the replication and serving graphs of the shard are deleted
+// in all its cells, and the shard itself.
+//
+// The serving graph of the keyspace is not rebuilt.
+func (wr *Wrangler) DeleteShard(keyspace, shard string, recursive, evenIfServing bool) error {
+	si, err := wr.ts.GetShard(keyspace, shard)
+	if err != nil {
+		return err
+	}
+	tablets, err := wr.shardTablets(si)
+	if err != nil {
+		return err
+	}
+	if err := checkDeletableTablets(si, tablets, recursive, evenIfServing); err != nil {
+		return err
+	}
+	if err := wr.deleteShard(si, tablets); err != nil {
+		return err
+	}
+	log.Warningf("deleted shard %v/%v, the serving graph of the keyspace needs to be rebuilt", keyspace, shard)
+	return nil
+}
+
+// shardTablets returns all the tablets of the shard, including the
+// ones not in the replication graph (like scrapped tablets). All the
+// cells of the shard have to be reachable.
+func (wr *Wrangler) shardTablets(si *topo.ShardInfo) ([]*topo.TabletInfo, error) {
+	var result []*topo.TabletInfo
+	for _, cell := range si.Cells {
+		tablets, err := GetAllTablets(wr.ts, cell)
+		if err != nil {
+			if err == topo.ErrNoNode {
+				continue
+			}
+			return nil, fmt.Errorf("cannot list the tablets of cell %v: %v", cell, err)
+		}
+		for _, ti := range tablets {
+			if ti.Keyspace == si.Keyspace() && ti.Shard == si.ShardName() {
+				result = append(result, ti)
+			}
+		}
+	}
+	return result, nil
+}
+
+// checkDeletableTablets returns an error if the tablets of a shard
+// prevent it from being deleted.
+func checkDeletableTablets(si *topo.ShardInfo, tablets []*topo.TabletInfo, recursive, evenIfServing bool) error {
+	if len(tablets) == 0 {
+		return nil
+	}
+	if !recursive {
+		return fmt.Errorf("shard %v/%v still has %v tablets, delete them first (or use -recursive)", si.Keyspace(), si.ShardName(), len(tablets))
+	}
+	if evenIfServing {
+		return nil
+	}
+	for _, ti := range tablets {
+		if ti.IsServingType() {
+			return fmt.Errorf("tablet %v of shard %v/%v is serving as %v, scrap it first (or use -even-if-serving)", ti.Alias, si.Keyspace(), si.ShardName(), ti.Type)
+		}
+	}
+	return nil
+}
+
+// deleteShard deletes the tablets, the replication and serving graphs,
+// and the shard record, in that order.
+func (wr *Wrangler) deleteShard(si *topo.ShardInfo, tablets []*topo.TabletInfo) error {
+	keyspace, shard := si.Keyspace(), si.ShardName()
+	for _, ti := range tablets {
+		log.Infof("deleting tablet %v of shard %v/%v", ti.Alias, keyspace, shard)
+		if err := wr.ts.DeleteTablet(ti.Alias); err != nil && err != topo.ErrNoNode {
+			return fmt.Errorf("cannot delete tablet %v: %v", ti.Alias, err)
+		}
+	}
+	for _, cell := range si.Cells {
+		if err := wr.ts.DeleteShardReplication(cell, keyspace, shard); err != nil && err != topo.ErrNoNode {
+			return fmt.Errorf("cannot delete the replication graph of %v/%v in cell %v: %v", keyspace, shard, cell, err)
+		}
+		if err := wr.ts.DeleteSrvShard(cell, keyspace, shard); err != nil && err != topo.ErrNoNode {
+			return fmt.Errorf("cannot delete the serving graph of %v/%v in cell %v: %v", keyspace, shard, cell, err)
+		}
+	}
+	return wr.ts.DeleteShard(keyspace, shard)
+}
@@ -0,0 +1,67 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+func TestDeleteShardAndKeyspace(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
+	wr := New(ts, time.Minute, time.Second)
+	wr.UseRPCs = false
+	masterAlias := createTestTablet(t, wr, "cell1", 0, topo.TYPE_MASTER, topo.TabletAlias{})
+	createTestTablet(t, wr, "cell2", 1, topo.TYPE_SPARE, masterAlias)
+	if err := wr.RebuildKeyspaceGraph("test_keyspace", nil, false); err != nil {
+		t.Fatalf("RebuildKeyspaceGraph: %v", err)
+	}
+
+	// the tablets prevent the deletion, the serving ones even with
+	// recursive
+	if err := wr.DeleteShard("test_keyspace", "0", false, false); err == nil {
+		t.Errorf("DeleteShard with tablets should have failed")
+	}
+	if err := wr.DeleteKeyspace("test_keyspace", false, false); err == nil {
+		t.Errorf("DeleteKeyspace with shards should have failed")
+	}
+	if err := wr.DeleteKeyspace("test_keyspace", true, false); err == nil {
+		t.Errorf("DeleteKeyspace with a serving tablet should have failed")
+	}
+	if _, err := ts.GetTablet(masterAlias); err != nil {
+		t.Errorf("a failed DeleteKeyspace should not delete anything: %v", err)
+	}
+
+	if err := wr.DeleteShard("test_keyspace", "0", true, true); err != nil {
+		t.Fatalf("DeleteShard: %v", err)
+	}
+	for _, cell := range []string{"cell1", "cell2"} {
+		if aliases, err := ts.GetTabletsByCell(cell); err != nil || len(aliases) != 0 {
+			t.Errorf("tablets left in %v: %v %v", cell, aliases, err)
+		}
+		if _, err := ts.GetShardReplication(cell, "test_keyspace", "0"); err != topo.ErrNoNode {
+			t.Errorf("replication graph left in %v: %v", cell, err)
+		}
+	}
+	if _, err := ts.GetSrvShard("cell1", "test_keyspace", "0"); err != topo.ErrNoNode {
+		t.Errorf("serving graph left: %v", err)
+	}
+	if _, err := ts.GetShard("test_keyspace", "0"); err != topo.ErrNoNode {
+		t.Errorf("shard left: %v", err)
+	}
+
+	if err := wr.DeleteKeyspace("test_keyspace", false, false); err != nil {
+		t.Fatalf("DeleteKeyspace: %v", err)
+	}
+	if _, err := ts.GetSrvKeyspace("cell1", "test_keyspace"); err != topo.ErrNoNode {
+		t.Errorf("keyspace serving graph left: %v", err)
+	}
+	if keyspaces, err := ts.GetKeyspaces(); err != nil || len(keyspaces) != 0 {
+		t.Errorf("keyspace left: %v %v", keyspaces, err)
+	}
+}
@@ -6,8 +6,11 @@ package wrangler
 
 import (
 	"fmt"
+	"time"
 
 	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
 	tm "github.com/youtube/vitess/go/vt/tabletmanager"
 	"github.com/youtube/vitess/go/vt/topo"
 )
@@ -158,8 +161,15 @@ func (wr *Wrangler) InitTablet(tablet *topo.Tablet, force, createShardAndKeyspac
 	return err
 }
 
-// Scrap a tablet. If force is used, we write to topo.Server
-// directly and don't remote-execute the command.
+// Scrap a tablet: it is marked scrapped, removed from the
+// replication graph, and removed from the serving graph of its
+// cell. If force is used, we write to topo.Server directly and don't
+// remote-execute the command, for when the tablet is unreachable.
+//
+// The shard is locked while the tablet is scrapped and the serving
+// graph rebuilt, so other shard actions see both changes or none of
+// them. If skipRebuild is used, the serving graph is left alone, and
+// still points at the tablet until the next rebuild.
 //
 // If we scrap the master for a shard, we will clear its record
 // from the Shard object (only if that was the right master)
@@ -172,66 +182,69 @@ func (wr *Wrangler) Scrap(tabletAlias topo.TabletAlias, force, skipRebuild bool)
 	rebuildRequired := ti.Tablet.IsServingType()
 	wasMaster := ti.Type == topo.TYPE_MASTER
 
-	if force {
-		err = tm.Scrap(wr.ts, ti.Alias, force)
-	} else {
-		actionPath, err = wr.ai.Scrap(ti.Alias)
+	if !rebuildRequired {
+		log.Infof("Rebuild not required")
+		return wr.scrapTablet(ti, force)
 	}
+	if skipRebuild {
+		log.Warningf("Rebuild required, but skipping it")
+		return wr.scrapTablet(ti, force)
+	}
+
+	actionNode := wr.ai.UpdateShard()
+	lockPath, err := wr.lockShard(ti.Keyspace, ti.Shard, actionNode)
 	if err != nil {
 		return "", err
 	}
 
-	if !rebuildRequired {
-		log.Infof("Rebuild not required")
-		return
+	err = wr.scrapLocked(ti, force, wasMaster)
+	return "", wr.unlockShard(ti.Keyspace, ti.Shard, actionNode, lockPath, err)
+}
+
+// scrapTablet runs the scrap action on the tablet, or changes the
+// topology directly if force is set.
+func (wr *Wrangler) scrapTablet(ti *topo.TabletInfo, force bool) (actionPath string, err error) {
+	if force {
+		return "", tm.Scrap(wr.ts, ti.Alias, force)
 	}
-	if skipRebuild {
-		log.Warningf("Rebuild required, but skipping it")
-		return
+	return wr.ai.Scrap(ti.Alias)
+}
+
+// scrapLocked scraps a serving tablet, and removes it from the Shard
+// object and the serving graph. It has to be run with the shard lock.
+func (wr *Wrangler) scrapLocked(ti *topo.TabletInfo, force, wasMaster bool) error {
+	actionPath, err := wr.scrapTablet(ti, force)
+	if err != nil {
+		return err
 	}
 
 	// wait for the remote Scrap if necessary
 	if actionPath != "" {
-		err = wr.ai.WaitForCompletion(actionPath, wr.actionTimeout())
-		if err != nil {
-			return "", err
+		if err := wr.ai.WaitForCompletion(actionPath, wr.actionTimeout()); err != nil {
+			return err
 		}
 	}
 
 	// update the Shard object if the master was scrapped
 	if wasMaster {
-		actionNode := wr.ai.UpdateShard()
-		lockPath, err := wr.lockShard(ti.Keyspace, ti.Shard, actionNode)
-		if err != nil {
-			return "", err
-		}
-
-		// read the shard with the lock
 		si, err := wr.ts.GetShard(ti.Keyspace, ti.Shard)
 		if err != nil {
-			return "", wr.unlockShard(ti.Keyspace, ti.Shard, actionNode, lockPath, err)
+			return err
 		}
 
 		// update it if the right alias is there
-		if si.MasterAlias == tabletAlias {
+		if si.MasterAlias == ti.Alias {
 			si.MasterAlias = topo.TabletAlias{}
-
-			// write it back
 			if err := wr.ts.UpdateShard(si); err != nil {
-				return "", wr.unlockShard(ti.Keyspace, ti.Shard, actionNode, lockPath, err)
+				return err
 			}
 		} else {
-			log.Warningf("Scrapping master %v from shard %v/%v but master in Shard object was %v", tabletAlias, ti.Keyspace, ti.Shard, si.MasterAlias)
-		}
-
-		// and unlock
-		if err := wr.unlockShard(ti.Keyspace, ti.Shard, actionNode, lockPath, err); err != nil {
-			return "", err
+			log.Warningf("Scrapping master %v from shard %v/%v but master in Shard object was %v", ti.Alias, ti.Keyspace, ti.Shard, si.MasterAlias)
 		}
 	}
 
-	// and rebuild the original shard / keyspace
-	return "", wr.RebuildShardGraph(ti.Keyspace, ti.Shard, []string{ti.Alias.Cell})
+	// and rebuild the serving graph of the cell
+	return wr.rebuildShard(ti.Keyspace, ti.Shard, []string{ti.Alias.Cell}, false /*ignorePartialResult*/)
 }
 
 // Change the type of tablet and recompute all necessary derived paths in the
@@ -337,3 +350,163 @@ func (wr *Wrangler) changeTypeInternal(tabletAlias topo.TabletAlias, dbType topo
 	}
 	return nil
 }
+
+// ExecuteFetch runs a query on the tablet's MySQL instance as the
+// dba user. If disableBinlogs is set, the query won't replicate.
+func (wr *Wrangler) ExecuteFetch(tabletAlias topo.TabletAlias, query string, maxRows int, wantFields, disableBinlogs bool) (*mproto.QueryResult, error) {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return nil, err
+	}
+	return wr.ai.ExecuteFetch(ti, query, maxRows, wantFields, disableBinlogs, wr.actionTimeout())
+}
+
+// GetReparentJournal returns the last limit entries of the reparent
+// journal of a tablet, most recent first.
+func (wr *Wrangler) GetReparentJournal(tabletAlias topo.TabletAlias, limit int) ([]*mysqlctl.ReparentJournalEntry, error) {
+	qr, err := wr.ExecuteFetch(tabletAlias, mysqlctl.ReparentJournalQuery(limit), limit, false, false)
+	if err != nil {
+		return nil, err
+	}
+	return mysqlctl.ReparentJournalFromQueryResult(qr)
+}
+
+// InitAndJoinTablet creates or updates the tablet record like
+// InitTablet does, and then makes the tablet part of its shard: a
+// slave tablet has its replication pointed at the shard master, and
+// a serving tablet is added to the serving graph of its cell.
+// The tablet's vttablet must be running, and for a slave its mysqld
+// must have been restored from a snapshot of the shard. It can be
+// run again on the same tablet.
+func (wr *Wrangler) InitAndJoinTablet(tablet *topo.Tablet, force, createShardAndKeyspace bool) error {
+	if err := wr.InitTablet(tablet, force, createShardAndKeyspace, true /*update*/); err != nil {
+		return err
+	}
+	if !tablet.IsInReplicationGraph() {
+		return nil
+	}
+
+	if tablet.Type.IsSlaveType() {
+		if err := wr.ReparentTablet(tablet.Alias); err != nil {
+			return fmt.Errorf("cannot point tablet %v at the master of shard %v/%v, was a snapshot restored on it? %v", tablet.Alias, tablet.Keyspace, tablet.Shard, err)
+		}
+	}
+
+	if tablet.IsServingType() {
+		return wr.RebuildShardGraph(tablet.Keyspace, tablet.Shard, []string{tablet.Alias.Cell})
+	}
+	return nil
+}
+
+// PurgeScrappedTablets deletes the records of the tablets of the
+// cells that were scrapped more than retention ago, and returns their
+// aliases. If keyspace is set, only the tablets of the keyspace (and
+// of the shard, if set) are purged.
+//
+// Tablets scrapped before the scrap time was recorded have no scrap
+// time, and are purged.
+func (wr *Wrangler) PurgeScrappedTablets(cells []string, keyspace, shard string, retention time.Duration) ([]topo.TabletAlias, error) {
+	cutoff := time.Now().Add(-retention).Unix()
+	var purged []topo.TabletAlias
+	for _, cell := range cells {
+		aliases, err := wr.ts.GetTabletsByCell(cell)
+		if err != nil && err != topo.ErrNoNode {
+			return purged, err
+		}
+		for _, alias := range aliases {
+			ti, err := wr.ts.GetTablet(alias)
+			if err != nil {
+				if err == topo.ErrNoNode {
+					continue
+				}
+				return purged, err
+			}
+			if ti.Type != topo.TYPE_SCRAP || ti.ScrapTime > cutoff {
+				continue
+			}
+			if keyspace != "" && (ti.Keyspace != keyspace || (shard != "" && ti.Shard != shard)) {
+				continue
+			}
+			log.Infof("Purging tablet %v, scrapped at %v", alias, time.Unix(ti.ScrapTime, 0))
+			if err := wr.ts.DeleteTablet(alias); err != nil && err != topo.ErrNoNode {
+				return purged, err
+			}
+			purged = append(purged, alias)
+		}
+	}
+	return purged, nil
+}
+
+// PingTablet checks the tablet is alive, and returns the round-trip
+// time. With RPCs, the action queue of the tablet is not used, so
+// health checks don't wait behind (or block) real actions.
+func (wr *Wrangler) PingTablet(ti *topo.TabletInfo) (time.Duration, error) {
+	if wr.UseRPCs {
+		return wr.ai.RpcPing(ti, wr.actionTimeout())
+	}
+	start := time.Now()
+	actionPath, err := wr.ai.Ping(ti.Alias)
+	if err != nil {
+		return 0, err
+	}
+	if err := wr.ai.WaitForCompletion(actionPath, wr.actionTimeout()); err != nil {
+		return 0, fmt.Errorf("%v: %v", actionPath, err)
+	}
+	return time.Now().Sub(start), nil
+}
+
+// RefreshTabletState makes the tablet re-read its record and
+// reconcile its serving state with it. Without RPCs, a Ping action
+// does the same, as the tablet reloads its record after any action.
+func (wr *Wrangler) RefreshTabletState(ti *topo.TabletInfo) error {
+	if wr.UseRPCs {
+		return wr.ai.RpcRefreshState(ti, wr.actionTimeout())
+	}
+	actionPath, err := wr.ai.Ping(ti.Alias)
+	if err != nil {
+		return err
+	}
+	return wr.ai.WaitForCompletion(actionPath, wr.actionTimeout())
+}
+
+// SetReadOnly makes the mysql of a tablet read-only, or read-write,
+// and checks the tablet recorded the change.
+func (wr *Wrangler) SetReadOnly(tabletAlias topo.TabletAlias, rdonly bool) error {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+
+	if wr.UseRPCs {
+		if rdonly {
+			err = wr.ai.RpcSetReadOnly(ti, wr.actionTimeout())
+		} else {
+			err = wr.ai.RpcSetReadWrite(ti, wr.actionTimeout())
+		}
+	} else {
+		var actionPath string
+		if rdonly {
+			actionPath, err = wr.ai.SetReadOnly(tabletAlias)
+		} else {
+			actionPath, err = wr.ai.SetReadWrite(tabletAlias)
+		}
+		if err == nil {
+			err = wr.ai.WaitForCompletion(actionPath, wr.actionTimeout())
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	want := topo.STATE_READ_WRITE
+	if rdonly {
+		want = topo.STATE_READ_ONLY
+	}
+	if ti, err = wr.ts.GetTablet(tabletAlias); err != nil {
+		return err
+	}
+	if ti.State != want {
+		return fmt.Errorf("tablet %v is in state %v, expected %v", tabletAlias, ti.State, want)
+	}
+	return nil
+}
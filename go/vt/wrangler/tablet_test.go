@@ -0,0 +1,280 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+func TestPurgeScrappedTablets(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
+	wr := New(ts, time.Minute, time.Second)
+	wr.UseRPCs = false
+	masterAlias := createTestTablet(t, wr, "cell1", 0, topo.TYPE_MASTER, topo.TabletAlias{})
+	oldAlias := createTestTablet(t, wr, "cell1", 1, topo.TYPE_SPARE, masterAlias)
+	newAlias := createTestTablet(t, wr, "cell2", 2, topo.TYPE_SPARE, masterAlias)
+
+	// scrapping records the scrap time
+	before := time.Now().Unix()
+	for _, alias := range []topo.TabletAlias{oldAlias, newAlias} {
+		if _, err := wr.Scrap(alias, true, false); err != nil {
+			t.Fatalf("Scrap(%v): %v", alias, err)
+		}
+	}
+	ti, err := ts.GetTablet(oldAlias)
+	if err != nil {
+		t.Fatalf("GetTablet: %v", err)
+	}
+	if ti.Type != topo.TYPE_SCRAP || ti.ScrapTime < before {
+		t.Errorf("unexpected scrapped tablet: %v", ti)
+	}
+	ti.ScrapTime -= 3 * 3600
+	if err := topo.UpdateTablet(ts, ti); err != nil {
+		t.Fatalf("UpdateTablet: %v", err)
+	}
+
+	// a scrapped tablet is kept for the retention, and only the
+	// scrapped tablets are purged
+	cells := []string{"cell1", "cell2"}
+	purged, err := wr.PurgeScrappedTablets(cells, "", "", time.Hour)
+	if err != nil {
+		t.Fatalf("PurgeScrappedTablets: %v", err)
+	}
+	if want := []topo.TabletAlias{oldAlias}; !reflect.DeepEqual(purged, want) {
+		t.Errorf("got purged %v, want %v", purged, want)
+	}
+	if _, err := ts.GetTablet(oldAlias); err != topo.ErrNoNode {
+		t.Errorf("purged tablet still exists: %v", err)
+	}
+	for _, alias := range []topo.TabletAlias{masterAlias, newAlias} {
+		if _, err := ts.GetTablet(alias); err != nil {
+			t.Errorf("tablet %v should not have been purged: %v", alias, err)
+		}
+	}
+
+	// the keyspace filter
+	if purged, err := wr.PurgeScrappedTablets(cells, "other_keyspace", "", 0); err != nil || len(purged) != 0 {
+		t.Errorf("PurgeScrappedTablets(other_keyspace): %v %v", purged, err)
+	}
+	if purged, err := wr.PurgeScrappedTablets(cells, "test_keyspace", "0", 0); err != nil || !reflect.DeepEqual(purged, []topo.TabletAlias{newAlias}) {
+		t.Errorf("PurgeScrappedTablets(test_keyspace/0): %v %v", purged, err)
+	}
+}
+
+func TestScrapTablet(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	wr.UseRPCs = false
+	masterAlias := createTestTablet(t, wr, "cell1", 0, topo.TYPE_MASTER, topo.TabletAlias{})
+	replicaAlias := createTestTablet(t, wr, "cell1", 1, topo.TYPE_REPLICA, masterAlias)
+	if err := wr.RebuildKeyspaceGraph("test_keyspace", nil, false); err != nil {
+		t.Fatalf("RebuildKeyspaceGraph: %v", err)
+	}
+
+	// the scrapped replica is gone from both graphs
+	if _, err := wr.Scrap(replicaAlias, true, false); err != nil {
+		t.Fatalf("Scrap(replica): %v", err)
+	}
+	sr, err := ts.GetShardReplication("cell1", "test_keyspace", "0")
+	if err != nil {
+		t.Fatalf("GetShardReplication: %v", err)
+	}
+	for _, rl := range sr.ReplicationLinks {
+		if rl.TabletAlias == replicaAlias {
+			t.Errorf("scrapped tablet still in the replication graph: %v", sr)
+		}
+	}
+	if addrs, err := ts.GetEndPoints("cell1", "test_keyspace", "0", topo.TYPE_REPLICA); err != topo.ErrNoNode {
+		t.Errorf("scrapped tablet still in the serving graph: %v %v", addrs, err)
+	}
+
+	// the scrapped master is also removed from the shard
+	if _, err := wr.Scrap(masterAlias, true, false); err != nil {
+		t.Fatalf("Scrap(master): %v", err)
+	}
+	si, err := ts.GetShard("test_keyspace", "0")
+	if err != nil {
+		t.Fatalf("GetShard: %v", err)
+	}
+	if !si.MasterAlias.IsZero() {
+		t.Errorf("scrapped master still in the shard: %v", si.MasterAlias)
+	}
+	if addrs, err := ts.GetEndPoints("cell1", "test_keyspace", "0", topo.TYPE_MASTER); err != topo.ErrNoNode {
+		t.Errorf("scrapped master still in the serving graph: %v %v", addrs, err)
+	}
+}
+
+func TestSetReadOnly(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	wr.UseRPCs = false
+	masterAlias := createTestTablet(t, wr, "cell1", 0, topo.TYPE_MASTER, topo.TabletAlias{})
+
+	done := make(chan struct{})
+	defer close(done)
+	mysqlDaemon := &mysqlctl.FakeMysqlDaemon{ReadOnly: true}
+	startFakeTabletActionLoop(t, wr, masterAlias, mysqlDaemon, done)
+
+	checkState := func(want topo.TabletState) {
+		ti, err := ts.GetTablet(masterAlias)
+		if err != nil {
+			t.Fatalf("GetTablet: %v", err)
+		}
+		if ti.State != want {
+			t.Errorf("tablet state is %v, want %v", ti.State, want)
+		}
+	}
+
+	if err := wr.SetReadOnly(masterAlias, false); err != nil {
+		t.Fatalf("SetReadOnly(false): %v", err)
+	}
+	if mysqlDaemon.ReadOnly {
+		t.Errorf("mysql is still read-only")
+	}
+	checkState(topo.STATE_READ_WRITE)
+
+	if err := wr.SetReadOnly(masterAlias, true); err != nil {
+		t.Fatalf("SetReadOnly(true): %v", err)
+	}
+	if !mysqlDaemon.ReadOnly {
+		t.Errorf("mysql is still read-write")
+	}
+	checkState(topo.STATE_READ_ONLY)
+
+	// a change that doesn't take is an error, and is not recorded
+	mysqlDaemon.ReadOnlyStuck = true
+	if err := wr.SetReadOnly(masterAlias, false); err == nil {
+		t.Errorf("SetReadOnly(false) with a stuck read_only should have failed")
+	}
+	checkState(topo.STATE_READ_ONLY)
+}
+
+func TestDemoteMasterFencing(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	wr.UseRPCs = false
+	masterAlias := createTestTablet(t, wr, "cell1", 0, topo.TYPE_MASTER, topo.TabletAlias{})
+
+	done := make(chan struct{})
+	defer close(done)
+	mysqlDaemon := &mysqlctl.FakeMysqlDaemon{ReadOnly: false, ReadOnlyStuck: true}
+	startFakeTabletActionLoop(t, wr, masterAlias, mysqlDaemon, done)
+
+	// a master that stays read-write is not fenced
+	ti, err := ts.GetTablet(masterAlias)
+	if err != nil {
+		t.Fatalf("GetTablet: %v", err)
+	}
+	if _, err := wr.demoteMaster(ti); err == nil {
+		t.Errorf("demoteMaster with a stuck read_only should have failed")
+	}
+	if ti, err = ts.GetTablet(masterAlias); err != nil || ti.State != topo.STATE_READ_WRITE {
+		t.Errorf("master should still be read-write: %v %v", ti.State, err)
+	}
+
+	// the master position is read with an RPC this test cannot
+	// serve, but the master is fenced before that
+	mysqlDaemon.ReadOnlyStuck = false
+	wr.demoteMaster(ti)
+	if !mysqlDaemon.ReadOnly {
+		t.Errorf("mysql is still read-write")
+	}
+	if ti, err = ts.GetTablet(masterAlias); err != nil || ti.State != topo.STATE_FENCED {
+		t.Errorf("master should be fenced: %v %v", ti.State, err)
+	}
+
+	// SetReadWrite lifts the fence
+	if err := wr.SetReadOnly(masterAlias, false); err != nil {
+		t.Fatalf("SetReadOnly(false): %v", err)
+	}
+	if ti, err = ts.GetTablet(masterAlias); err != nil || ti.State != topo.STATE_READ_WRITE {
+		t.Errorf("master should be read-write again: %v %v", ti.State, err)
+	}
+}
+
+func TestInitAndJoinTablet(t *testing.T) {
+	defer func(protocol string) {
+		*tabletManagerProtocol = protocol
+	}(*tabletManagerProtocol)
+	*tabletManagerProtocol = "fake"
+
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	wr.UseRPCs = false
+	newTablet := func(uid uint32, shard string, tabletType topo.TabletType) *topo.Tablet {
+		return &topo.Tablet{
+			Alias:    topo.TabletAlias{Cell: "cell1", Uid: uid},
+			Hostname: "cell1host",
+			Portmap:  map[string]int{"vt": 8100 + int(uid), "mysql": 3300 + int(uid)},
+			IPAddr:   "100.0.0.1",
+			Keyspace: "test_keyspace",
+			Shard:    shard,
+			Type:     tabletType,
+			State:    topo.STATE_READ_WRITE,
+		}
+	}
+	checkReplication := func(alias topo.TabletAlias, wantParent topo.TabletAlias) {
+		sri, err := ts.GetShardReplication("cell1", "test_keyspace", "0")
+		if err != nil {
+			t.Fatalf("GetShardReplication: %v", err)
+		}
+		link, err := sri.GetReplicationLink(alias)
+		if err != nil {
+			t.Errorf("tablet %v is not in the replication graph: %v", alias, err)
+		} else if link.Parent != wantParent {
+			t.Errorf("tablet %v has parent %v in the replication graph, want %v", alias, link.Parent, wantParent)
+		}
+	}
+
+	// the master creates the shard, it is the root of the
+	// replication graph, and is added to the serving graph
+	master := newTablet(0, "0", topo.TYPE_MASTER)
+	if err := wr.InitAndJoinTablet(master, false, true); err != nil {
+		t.Fatalf("InitAndJoinTablet(master): %v", err)
+	}
+	if _, err := ts.GetTablet(master.Alias); err != nil {
+		t.Errorf("master was not created: %v", err)
+	}
+	if si, err := ts.GetShard("test_keyspace", "0"); err != nil || si.MasterAlias != master.Alias {
+		t.Errorf("shard master: %v %v", si, err)
+	}
+	if addrs, err := ts.GetEndPoints("cell1", "test_keyspace", "0", topo.TYPE_MASTER); err != nil || len(addrs.Entries) != 1 {
+		t.Errorf("master is not in the serving graph: %v %v", addrs, err)
+	}
+
+	// it can be run again on the same tablet
+	if err := wr.InitAndJoinTablet(master, false, true); err != nil {
+		t.Errorf("InitAndJoinTablet(master) again: %v", err)
+	}
+
+	// a slave gets the master as parent, and a failure to point its
+	// replication at it is reported
+	replica := newTablet(1, "0", topo.TYPE_REPLICA)
+	replica.State = topo.STATE_READ_ONLY
+	err := wr.InitAndJoinTablet(replica, false, true)
+	if err == nil || !strings.Contains(err.Error(), "cannot point tablet") || !strings.Contains(err.Error(), "no replication on") {
+		t.Errorf("InitAndJoinTablet(replica): want a reparent error, got %v", err)
+	}
+	checkReplication(replica.Alias, master.Alias)
+
+	// a tablet in a shard that doesn't exist is not created
+	bad := newTablet(2, "80-", topo.TYPE_REPLICA)
+	if err := wr.InitAndJoinTablet(bad, false, false); err == nil || !strings.Contains(err.Error(), "missing parent shard") {
+		t.Errorf("InitAndJoinTablet(bad shard): want a missing shard error, got %v", err)
+	}
+	if _, err := ts.GetTablet(bad.Alias); err != topo.ErrNoNode {
+		t.Errorf("tablet in a bad shard was created: %v", err)
+	}
+	if _, err := ts.GetShard("test_keyspace", "80-"); err != topo.ErrNoNode {
+		t.Errorf("bad shard was created: %v", err)
+	}
+}
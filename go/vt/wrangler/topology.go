@@ -1,11 +1,12 @@
 package wrangler
 
 import (
-	"fmt"
+	"net"
 	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/youtube/vitess/go/netutil"
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
@@ -121,11 +122,14 @@ type TabletNode struct {
 }
 
 func (tn TabletNode) ShortName() string {
-	hostPart := strings.SplitN(tn.Host, ".", 2)[0]
+	hostPart := tn.Host
+	if net.ParseIP(hostPart) == nil {
+		hostPart = strings.SplitN(tn.Host, ".", 2)[0]
+	}
 	if tn.Port == 0 {
 		return hostPart
 	}
-	return fmt.Sprintf("%v:%v", hostPart, tn.Port)
+	return netutil.JoinHostPort(hostPart, tn.Port)
 }
 
 func TabletNodeFromTabletInfo(ti *topo.TabletInfo) (*TabletNode, error) {
@@ -218,15 +222,11 @@ func (wr *Wrangler) ServingGraph(cell string) (*ServingGraph, error) {
 		}
 		for _, shard := range shards {
 			servingGraph.Keyspaces[keyspace][shard] = make(TabletNodesByType)
-			tabletTypes, err := wr.ts.GetSrvTabletTypesPerShard(cell, keyspace, shard)
+			endPointsPerType, err := wr.ts.GetEndPointsPerShard(cell, keyspace, shard)
 			if err != nil {
 				return nil, err
 			}
-			for _, tabletType := range tabletTypes {
-				endPoints, err := wr.ts.GetEndPoints(cell, keyspace, shard, tabletType)
-				if err != nil {
-					return nil, err
-				}
+			for tabletType, endPoints := range endPointsPerType {
 				for _, endPoint := range endPoints.Entries {
 					servingGraph.Keyspaces[keyspace][shard][string(tabletType)] = append(servingGraph.Keyspaces[keyspace][shard][string(tabletType)], TabletNodeFromEndPoint(endPoint, cell))
 				}
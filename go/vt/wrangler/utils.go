@@ -68,29 +68,20 @@ func GetTabletMapForShard(ts topo.Server, keyspace, shard string) (map[topo.Tabl
 
 // Return a sorted list of tablets.
 func GetAllTablets(ts topo.Server, cell string) ([]*topo.TabletInfo, error) {
-	aliases, err := ts.GetTabletsByCell(cell)
+	tabletMap, err := ts.GetTabletMapForCell(cell)
 	if err != nil {
 		return nil, err
 	}
+	aliases := make([]topo.TabletAlias, 0, len(tabletMap))
+	for tabletAlias := range tabletMap {
+		aliases = append(aliases, tabletAlias)
+	}
 	sort.Sort(topo.TabletAliasList(aliases))
 
-	tabletMap, err := GetTabletMap(ts, aliases)
-	if err != nil {
-		// we got another error than ZNONODE
-		return nil, err
+	tablets := make([]*topo.TabletInfo, len(aliases))
+	for i, tabletAlias := range aliases {
+		tablets[i] = tabletMap[tabletAlias]
 	}
-	tablets := make([]*topo.TabletInfo, 0, len(aliases))
-	for _, tabletAlias := range aliases {
-		tabletInfo, ok := tabletMap[tabletAlias]
-		if !ok {
-			// tablet disappeared on us (GetTabletMap ignores
-			// ZNONODE), just echo a warning
-			log.Warningf("failed to load tablet %v", tabletAlias)
-		} else {
-			tablets = append(tablets, tabletInfo)
-		}
-	}
-
 	return tablets, nil
 }
 
@@ -127,6 +127,24 @@ func (wr *Wrangler) validateKeyspace(keyspace string, pingTablets bool, wg *sync
 			wg.Done()
 		}(shard)
 	}
+
+	// Validate the shards partition the key space for each served type.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		shardMap, err := topo.FindAllShardsInKeyspace(wr.ts, keyspace)
+		if err != nil {
+			results <- vresult{"topo.FindAllShardsInKeyspace(" + keyspace + ")", err}
+			return
+		}
+		shardInfos := make([]*topo.ShardInfo, 0, len(shardMap))
+		for _, si := range shardMap {
+			shardInfos = append(shardInfos, si)
+		}
+		if err := checkServedTypesCoverage(keyspace, shardInfos); err != nil {
+			results <- vresult{keyspace, err}
+		}
+	}()
 }
 
 // FIXME(msolomon) This validate presumes the master is up and running.
@@ -250,15 +268,8 @@ func (wr *Wrangler) pingTablets(tabletMap map[topo.TabletAlias]*topo.TabletInfo,
 				return
 			}
 
-			actionPath, err := wr.ai.Ping(tabletAlias)
-			if err != nil {
-				results <- vresult{tabletAlias.String(), fmt.Errorf("%v: %v %v", actionPath, err, tabletInfo.Hostname)}
-				return
-			}
-
-			err = wr.ai.WaitForCompletion(actionPath, wr.actionTimeout())
-			if err != nil {
-				results <- vresult{tabletAlias.String(), fmt.Errorf("%v: %v %v", actionPath, err, tabletInfo.Hostname)}
+			if _, err := wr.PingTablet(tabletInfo); err != nil {
+				results <- vresult{tabletAlias.String(), fmt.Errorf("ping failed: %v %v", err, tabletInfo.Hostname)}
 			}
 		}(tabletAlias, tabletInfo)
 	}
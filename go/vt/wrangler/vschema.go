@@ -0,0 +1,85 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// ApplyVSchema validates the VSchema of a keyspace against the rest
+// of the topology, and saves it.
+func (wr *Wrangler) ApplyVSchema(keyspace string, vschema *topo.VSchema) error {
+	if err := wr.validateVSchema(keyspace, vschema); err != nil {
+		return err
+	}
+	log.Infof("Saving vschema for keyspace %v", keyspace)
+	return wr.ts.SaveVSchema(keyspace, vschema)
+}
+
+// ValidateVSchema checks the stored VSchema of a keyspace is still
+// consistent with the rest of the topology.
+func (wr *Wrangler) ValidateVSchema(keyspace string) error {
+	vschema, err := wr.ts.GetVSchema(keyspace)
+	if err != nil {
+		return fmt.Errorf("cannot read vschema of keyspace %v: %v", keyspace, err)
+	}
+	return wr.validateVSchema(keyspace, vschema)
+}
+
+func (wr *Wrangler) validateVSchema(keyspace string, vschema *topo.VSchema) error {
+	if err := vschema.Validate(); err != nil {
+		return fmt.Errorf("invalid vschema for keyspace %v: %v", keyspace, err)
+	}
+	shards, err := wr.ts.GetShardNames(keyspace)
+	if err != nil {
+		return fmt.Errorf("cannot read shards of keyspace %v: %v", keyspace, err)
+	}
+	if !vschema.Sharded && len(shards) > 1 {
+		return fmt.Errorf("keyspace %v is unsharded in its vschema, but has %v shards", keyspace, len(shards))
+	}
+
+	// the lookup tables have to be in existing unsharded keyspaces
+	checked := make(map[string]bool)
+	for name, table := range vschema.Tables {
+		for _, lookup := range table.Lookups {
+			if checked[lookup.Keyspace] {
+				continue
+			}
+			if err := wr.validateLookupKeyspace(lookup.Keyspace); err != nil {
+				return fmt.Errorf("invalid lookup for %v.%v: %v", name, lookup.Column, err)
+			}
+			checked[lookup.Keyspace] = true
+		}
+	}
+	return nil
+}
+
+func (wr *Wrangler) validateLookupKeyspace(keyspace string) error {
+	shards, err := wr.ts.GetShardNames(keyspace)
+	if err != nil {
+		return fmt.Errorf("cannot read shards of keyspace %v: %v", keyspace, err)
+	}
+	if len(shards) != 1 {
+		return fmt.Errorf("keyspace %v has %v shards, it should be unsharded", keyspace, len(shards))
+	}
+	// vtgate sends the lookup queries to shard 0
+	if shards[0] != "0" {
+		return fmt.Errorf("the shard of keyspace %v should be named 0, not %v", keyspace, shards[0])
+	}
+	vschema, err := wr.ts.GetVSchema(keyspace)
+	switch err {
+	case nil:
+		if vschema.Sharded {
+			return fmt.Errorf("keyspace %v is sharded in its vschema", keyspace)
+		}
+	case topo.ErrNoNode:
+	default:
+		return err
+	}
+	return nil
+}
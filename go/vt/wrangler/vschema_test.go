@@ -0,0 +1,76 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+func TestApplyVSchema(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	for _, ks := range []struct{ keyspace, shard string }{
+		{"user", "-80"},
+		{"user", "80-"},
+		{"lookup", "0"},
+	} {
+		if err := ts.CreateKeyspace(ks.keyspace); err != nil && err != topo.ErrNodeExists {
+			t.Fatalf("CreateKeyspace: %v", err)
+		}
+		if err := topo.CreateShard(ts, ks.keyspace, ks.shard); err != nil {
+			t.Fatalf("CreateShard: %v", err)
+		}
+	}
+
+	vschema := topo.NewVSchema(true)
+	vschema.Tables["user"] = &topo.VSchemaTable{
+		ShardingKey: "user_id",
+		Lookups: []*topo.VSchemaLookup{{
+			Column:     "name",
+			Keyspace:   "lookup",
+			Table:      "name_user_idx",
+			FromColumn: "name",
+			ToColumn:   "keyspace_id",
+		}},
+	}
+	if err := wr.ApplyVSchema("user", vschema); err != nil {
+		t.Fatalf("ApplyVSchema: %v", err)
+	}
+	if err := wr.ValidateVSchema("user"); err != nil {
+		t.Errorf("ValidateVSchema: %v", err)
+	}
+
+	testCases := []struct {
+		keyspace string
+		vschema  *topo.VSchema
+		want     string
+	}{
+		{"user", topo.NewVSchema(false), "unsharded in its vschema"},
+		{"user", &topo.VSchema{Sharded: true, Tables: map[string]*topo.VSchemaTable{"t": {}}}, "no sharding key"},
+		{"user", &topo.VSchema{Sharded: true, Tables: map[string]*topo.VSchemaTable{"t": {
+			ShardingKey: "id",
+			Lookups:     []*topo.VSchemaLookup{{Column: "name", Keyspace: "user", Table: "idx", FromColumn: "name", ToColumn: "keyspace_id"}},
+		}}}, "should be unsharded"},
+		{"lookup", &topo.VSchema{Tables: map[string]*topo.VSchemaTable{"t": {ShardingKey: "id"}}}, "cannot have a sharding key"},
+	}
+	for _, tc := range testCases {
+		if err := wr.ApplyVSchema(tc.keyspace, tc.vschema); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("ApplyVSchema(%#v): want %v, got %v", tc.vschema, tc.want, err)
+		}
+	}
+
+	// the lookup keyspace can't become sharded under the user keyspace
+	if err := ts.SaveVSchema("lookup", topo.NewVSchema(true)); err != nil {
+		t.Fatalf("SaveVSchema: %v", err)
+	}
+	if err := wr.ValidateVSchema("user"); err == nil || !strings.Contains(err.Error(), "is sharded") {
+		t.Errorf("ValidateVSchema: want sharded lookup keyspace error, got %v", err)
+	}
+}
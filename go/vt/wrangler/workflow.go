@@ -0,0 +1,354 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// This file contains the workflow framework. A workflow is a
+// multi-step operation whose progress is checkpointed in the global
+// topology after every step. When a step fails, the workflow stops,
+// and can later be resumed from the failed step, or rolled back, by
+// another vtctl.
+//
+// The steps are re-created from the workflow name and parameters
+// every time the workflow runs, by the factory registered in
+// workflowFactories. What the steps need to pass to each other is
+// saved in the data of the workflow, so it survives a restart.
+
+// workflowStep is one step of a workflow.
+type workflowStep struct {
+	name string
+
+	// do runs the step. It can save values in data, for the
+	// next steps. It may be run again if it failed, so it has to
+	// cope with a partial previous run.
+	do func(data map[string]string) error
+
+	// undo reverts the step, for rollbacks. It is nil for the
+	// steps that have nothing to revert.
+	undo func(data map[string]string) error
+
+	// irreversible steps cannot be rolled back once started.
+	irreversible bool
+
+	// unlocked steps are run after the workflow lock is released,
+	// for steps that take locks themselves. They have to be the
+	// last steps of the workflow. They are also rolled back last.
+	unlocked bool
+}
+
+// workflow is what a factory builds from the parameters of a
+// topo.Workflow.
+type workflow struct {
+	steps []*workflowStep
+
+	// lock, if set, is called before the steps are run or rolled
+	// back, and returns the function to call with their error
+	// once they are done.
+	lock func() (unlock func(error) error, err error)
+}
+
+// workflowFactories maps a workflow name to its factory.
+var workflowFactories = make(map[string]func(wr *Wrangler, params map[string]string) (*workflow, error))
+
+func init() {
+	// the factories can start workflows themselves, so they are
+	// registered here to avoid an initialization loop
+	workflowFactories[plannedReparentWorkflow] = newPlannedReparentWorkflow
+	workflowFactories[migrateServedTypesWorkflow] = newMigrateServedTypesWorkflow
+	workflowFactories[reshardWorkflow] = newReshardWorkflow
+}
+
+func (wr *Wrangler) newWorkflow(name string, params map[string]string) (*workflow, error) {
+	factory, ok := workflowFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown workflow %v", name)
+	}
+	return factory(wr, params)
+}
+
+// runStepsInMemory runs steps without checkpoints, for callers that
+// don't need to resume them.
+func runStepsInMemory(steps []*workflowStep) error {
+	data := make(map[string]string)
+	for _, step := range steps {
+		if err := step.do(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartWorkflow creates a new workflow in the keyspace, and runs
+// it. It returns the workflow id, even if the workflow failed, so it
+// can be resumed or rolled back.
+func (wr *Wrangler) StartWorkflow(keyspace, name string, params map[string]string) (string, error) {
+	wf, err := wr.newWorkflow(name, params)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, len(wf.steps))
+	for i, step := range wf.steps {
+		names[i] = step.name
+	}
+	uid, err := wr.ts.CreateWorkflow(keyspace, topo.NewWorkflow(name, params, names))
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Created workflow %v/%v: %v %v", keyspace, uid, name, params)
+	return uid, wr.runWorkflow(keyspace, uid, wf)
+}
+
+// ResumeWorkflow runs a failed or paused workflow again, from the
+// step that failed, or the step it was paused before.
+func (wr *Wrangler) ResumeWorkflow(keyspace, uid string) error {
+	wf, err := wr.loadWorkflow(keyspace, uid)
+	if err != nil {
+		return err
+	}
+	return wr.runWorkflow(keyspace, uid, wf)
+}
+
+// loadWorkflow re-creates the steps of a stored workflow.
+func (wr *Wrangler) loadWorkflow(keyspace, uid string) (*workflow, error) {
+	record, err := wr.ts.GetWorkflow(keyspace, uid)
+	if err != nil {
+		return nil, err
+	}
+	wf, err := wr.newWorkflow(record.Name, record.Params)
+	if err != nil {
+		return nil, err
+	}
+	if len(wf.steps) != len(record.Steps) {
+		return nil, fmt.Errorf("workflow %v/%v has %v steps, expected %v", keyspace, uid, len(record.Steps), len(wf.steps))
+	}
+	for i, step := range wf.steps {
+		if record.Steps[i].Name != step.name {
+			return nil, fmt.Errorf("step %v of workflow %v/%v is %v, expected %v", i, keyspace, uid, record.Steps[i].Name, step.name)
+		}
+	}
+	return wf, nil
+}
+
+// lockWorkflow calls the lock function of the workflow, if any. It
+// returns the function to call to release the lock, with the
+// error of the operation. Releasing the lock a second time is a no-op.
+func lockWorkflow(wf *workflow) (func(error) error, error) {
+	if wf.lock == nil {
+		return func(err error) error { return err }, nil
+	}
+	unlock, err := wf.lock()
+	if err != nil {
+		return nil, err
+	}
+	released := false
+	return func(err error) error {
+		if released {
+			return err
+		}
+		released = true
+		return unlock(err)
+	}, nil
+}
+
+// runWorkflow runs the steps of the workflow that are not done yet.
+func (wr *Wrangler) runWorkflow(keyspace, uid string, wf *workflow) (err error) {
+	unlock, err := lockWorkflow(wf)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = unlock(err)
+	}()
+
+	var record *topo.Workflow
+	if err := wr.ts.UpdateWorkflowFields(keyspace, uid, func(w *topo.Workflow) error {
+		if w.State == topo.WORKFLOW_DONE || w.State == topo.WORKFLOW_ROLLED_BACK {
+			return fmt.Errorf("workflow %v/%v is %v", keyspace, uid, w.State)
+		}
+		w.State = topo.WORKFLOW_RUNNING
+		w.PauseRequested = false
+		record = w
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	data := record.Data
+	if data == nil {
+		data = make(map[string]string)
+	}
+	for i, step := range wf.steps {
+		if step.unlocked {
+			if err := unlock(nil); err != nil {
+				return err
+			}
+		}
+		if record.Steps[i].State == topo.WORKFLOW_DONE {
+			continue
+		}
+		if paused, err := wr.pauseWorkflowIfRequested(keyspace, uid); err != nil || paused {
+			return err
+		}
+		log.Infof("Running step %v of workflow %v/%v", step.name, keyspace, uid)
+		if err := wr.setWorkflowStepState(keyspace, uid, i, topo.WORKFLOW_RUNNING, nil, data); err != nil {
+			return err
+		}
+		stepErr := step.do(data)
+		if stepErr != nil {
+			if err := wr.setWorkflowStepState(keyspace, uid, i, topo.WORKFLOW_FAILED, stepErr, data); err != nil {
+				log.Warningf("cannot save the failure of workflow %v/%v: %v", keyspace, uid, err)
+			}
+			return fmt.Errorf("step %v of workflow %v/%v failed: %v, fix the problem then run: vtctl ResumeWorkflow %v %v (or RollbackWorkflow)", step.name, keyspace, uid, stepErr, keyspace, uid)
+		}
+		if err := wr.setWorkflowStepState(keyspace, uid, i, topo.WORKFLOW_DONE, nil, data); err != nil {
+			return err
+		}
+	}
+
+	return wr.ts.UpdateWorkflowFields(keyspace, uid, func(w *topo.Workflow) error {
+		w.State = topo.WORKFLOW_DONE
+		return nil
+	})
+}
+
+// pauseWorkflowIfRequested moves the workflow to the paused state if
+// a pause was requested, and returns true if it did.
+func (wr *Wrangler) pauseWorkflowIfRequested(keyspace, uid string) (bool, error) {
+	record, err := wr.ts.GetWorkflow(keyspace, uid)
+	if err != nil || !record.PauseRequested {
+		return false, err
+	}
+	paused := false
+	err = wr.ts.UpdateWorkflowFields(keyspace, uid, func(w *topo.Workflow) error {
+		if w.PauseRequested {
+			w.State = topo.WORKFLOW_PAUSED
+			paused = true
+		}
+		return nil
+	})
+	if paused {
+		log.Infof("Workflow %v/%v paused, resume it with: vtctl ResumeWorkflow %v %v", keyspace, uid, keyspace, uid)
+	}
+	return paused, err
+}
+
+// PauseWorkflow asks a running workflow to stop before its next
+// step. The workflow can then be resumed or rolled back.
+func (wr *Wrangler) PauseWorkflow(keyspace, uid string) error {
+	return wr.ts.UpdateWorkflowFields(keyspace, uid, func(w *topo.Workflow) error {
+		switch w.State {
+		case topo.WORKFLOW_DONE, topo.WORKFLOW_ROLLED_BACK:
+			return fmt.Errorf("workflow %v/%v is %v", keyspace, uid, w.State)
+		}
+		w.PauseRequested = true
+		return nil
+	})
+}
+
+// setWorkflowStepState checkpoints the state of a step, and the data
+// of the workflow. A failed step also fails the workflow.
+func (wr *Wrangler) setWorkflowStepState(keyspace, uid string, index int, state topo.WorkflowState, stepErr error, data map[string]string) error {
+	return wr.ts.UpdateWorkflowFields(keyspace, uid, func(w *topo.Workflow) error {
+		w.Steps[index].State = state
+		if stepErr != nil {
+			w.Steps[index].Error = stepErr.Error()
+		} else {
+			w.Steps[index].Error = ""
+		}
+		if state == topo.WORKFLOW_FAILED {
+			w.State = topo.WORKFLOW_FAILED
+		}
+		w.Data = data
+		return nil
+	})
+}
+
+// RollbackWorkflow reverts the steps of a workflow that were run, in
+// reverse order. It fails if one of them is irreversible.
+func (wr *Wrangler) RollbackWorkflow(keyspace, uid string) (err error) {
+	wf, err := wr.loadWorkflow(keyspace, uid)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockWorkflow(wf)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = unlock(err)
+	}()
+
+	record, err := wr.ts.GetWorkflow(keyspace, uid)
+	if err != nil {
+		return err
+	}
+	if record.State == topo.WORKFLOW_ROLLED_BACK {
+		return fmt.Errorf("workflow %v/%v is already rolled back", keyspace, uid)
+	}
+	for i, step := range wf.steps {
+		if step.irreversible && record.Steps[i].State != topo.WORKFLOW_PENDING {
+			return fmt.Errorf("step %v of workflow %v/%v cannot be rolled back", step.name, keyspace, uid)
+		}
+	}
+
+	data := record.Data
+	if data == nil {
+		data = make(map[string]string)
+	}
+	// the locked steps are rolled back first, in reverse order, and
+	// then the unlocked ones, with the lock released
+	order := make([]int, 0, len(wf.steps))
+	for _, unlocked := range []bool{false, true} {
+		for i := len(wf.steps) - 1; i >= 0; i-- {
+			if wf.steps[i].unlocked == unlocked {
+				order = append(order, i)
+			}
+		}
+	}
+	for _, i := range order {
+		step := wf.steps[i]
+		if record.Steps[i].State == topo.WORKFLOW_PENDING || record.Steps[i].State == topo.WORKFLOW_ROLLED_BACK {
+			continue
+		}
+		if step.unlocked {
+			if err := unlock(nil); err != nil {
+				return err
+			}
+		}
+		if step.undo != nil {
+			log.Infof("Rolling back step %v of workflow %v/%v", step.name, keyspace, uid)
+			if stepErr := step.undo(data); stepErr != nil {
+				if err := wr.setWorkflowStepState(keyspace, uid, i, topo.WORKFLOW_FAILED, stepErr, data); err != nil {
+					log.Warningf("cannot save the failure of workflow %v/%v: %v", keyspace, uid, err)
+				}
+				return fmt.Errorf("rollback of step %v of workflow %v/%v failed: %v", step.name, keyspace, uid, stepErr)
+			}
+		}
+		if err := wr.setWorkflowStepState(keyspace, uid, i, topo.WORKFLOW_ROLLED_BACK, nil, data); err != nil {
+			return err
+		}
+	}
+
+	return wr.ts.UpdateWorkflowFields(keyspace, uid, func(w *topo.Workflow) error {
+		w.State = topo.WORKFLOW_ROLLED_BACK
+		return nil
+	})
+}
+
+// marshalWorkflowData encodes a value to save in the data of a workflow.
+func marshalWorkflowData(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
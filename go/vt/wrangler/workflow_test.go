@@ -0,0 +1,150 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+func TestWorkflow(t *testing.T) {
+	// a test workflow that logs what it does, and fails its
+	// steps as long as they are in fail
+	var calls []string
+	var pauseErr error
+	fail := map[string]bool{}
+	workflowFactories["Test"] = func(wr *Wrangler, params map[string]string) (*workflow, error) {
+		step := func(name string, irreversible bool) *workflowStep {
+			return &workflowStep{
+				name: name,
+				do: func(data map[string]string) error {
+					calls = append(calls, "do "+name)
+					if fail[name] {
+						return fmt.Errorf("%v failed", name)
+					}
+					data[name] = params["value"]
+					if params["pause"] == "true" && name == "first" {
+						// this workflow is the last one
+						uids, _ := wr.ts.GetWorkflows("test_keyspace")
+						pauseErr = wr.PauseWorkflow("test_keyspace", uids[len(uids)-1])
+					}
+					return nil
+				},
+				undo: func(data map[string]string) error {
+					calls = append(calls, "undo "+name+"="+data[name])
+					return nil
+				},
+				irreversible: irreversible,
+			}
+		}
+		return &workflow{
+			steps: []*workflowStep{step("first", false), step("second", false), step("third", params["irreversible"] == "true")},
+			lock: func() (func(error) error, error) {
+				calls = append(calls, "lock")
+				return func(err error) error {
+					calls = append(calls, "unlock")
+					return err
+				}, nil
+			},
+		}, nil
+	}
+	defer delete(workflowFactories, "Test")
+
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(ts, time.Minute, time.Second)
+	if err := ts.CreateKeyspace("test_keyspace"); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	checkCalls := func(want ...string) {
+		if !reflect.DeepEqual(calls, want) {
+			t.Errorf("got calls %v, want %v", calls, want)
+		}
+		calls = nil
+	}
+
+	// run with a failure, then resume from the failed step
+	fail["second"] = true
+	uid, err := wr.StartWorkflow("test_keyspace", "Test", map[string]string{"value": "v"})
+	if err == nil {
+		t.Fatalf("StartWorkflow should have failed")
+	}
+	checkCalls("lock", "do first", "do second", "unlock")
+	wf, err := ts.GetWorkflow("test_keyspace", uid)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	if wf.State != topo.WORKFLOW_FAILED || wf.Steps[0].State != topo.WORKFLOW_DONE || wf.Steps[1].State != topo.WORKFLOW_FAILED || wf.Steps[1].Error != "second failed" || wf.Data["first"] != "v" {
+		t.Errorf("unexpected failed workflow: %v", wf)
+	}
+
+	delete(fail, "second")
+	if err := wr.ResumeWorkflow("test_keyspace", uid); err != nil {
+		t.Fatalf("ResumeWorkflow: %v", err)
+	}
+	checkCalls("lock", "do second", "do third", "unlock")
+	if wf, err = ts.GetWorkflow("test_keyspace", uid); err != nil || wf.State != topo.WORKFLOW_DONE {
+		t.Errorf("unexpected done workflow: %v %v", wf, err)
+	}
+	if err := wr.ResumeWorkflow("test_keyspace", uid); err == nil {
+		t.Errorf("ResumeWorkflow of a done workflow should have failed")
+	}
+	checkCalls("lock", "unlock")
+
+	// rollback goes in reverse order, and only for the steps that ran
+	if err := wr.RollbackWorkflow("test_keyspace", uid); err != nil {
+		t.Fatalf("RollbackWorkflow: %v", err)
+	}
+	checkCalls("lock", "undo third=v", "undo second=v", "undo first=v", "unlock")
+	if wf, err = ts.GetWorkflow("test_keyspace", uid); err != nil || wf.State != topo.WORKFLOW_ROLLED_BACK {
+		t.Errorf("unexpected rolled back workflow: %v %v", wf, err)
+	}
+
+	fail["second"] = true
+	uid, _ = wr.StartWorkflow("test_keyspace", "Test", nil)
+	calls = nil
+	if err := wr.RollbackWorkflow("test_keyspace", uid); err != nil {
+		t.Fatalf("RollbackWorkflow: %v", err)
+	}
+	checkCalls("lock", "undo second=", "undo first=", "unlock")
+
+	// irreversible steps cannot be rolled back once they ran
+	delete(fail, "second")
+	uid, err = wr.StartWorkflow("test_keyspace", "Test", map[string]string{"irreversible": "true"})
+	if err != nil {
+		t.Fatalf("StartWorkflow: %v", err)
+	}
+	calls = nil
+	if err := wr.RollbackWorkflow("test_keyspace", uid); err == nil {
+		t.Errorf("RollbackWorkflow should have failed")
+	}
+	checkCalls("lock", "unlock")
+
+	// a pause requested during a step stops the workflow before
+	// the next one
+	uid, err = wr.StartWorkflow("test_keyspace", "Test", map[string]string{"value": "v", "pause": "true"})
+	if err != nil || pauseErr != nil {
+		t.Fatalf("StartWorkflow: %v %v", err, pauseErr)
+	}
+	checkCalls("lock", "do first", "unlock")
+	if wf, err = ts.GetWorkflow("test_keyspace", uid); err != nil || wf.State != topo.WORKFLOW_PAUSED || wf.Steps[1].State != topo.WORKFLOW_PENDING {
+		t.Errorf("unexpected paused workflow: %v %v", wf, err)
+	}
+	if err := wr.ResumeWorkflow("test_keyspace", uid); err != nil {
+		t.Fatalf("ResumeWorkflow: %v", err)
+	}
+	checkCalls("lock", "do second", "do third", "unlock")
+	if err := wr.PauseWorkflow("test_keyspace", uid); err == nil {
+		t.Errorf("PauseWorkflow of a done workflow should have failed")
+	}
+
+	if _, err := wr.StartWorkflow("test_keyspace", "Unknown", nil); err == nil {
+		t.Errorf("StartWorkflow of an unknown workflow should have failed")
+	}
+}
@@ -20,7 +20,9 @@ const (
 var tabletManagerProtocol = flag.String("tablet_manager_protocol", "bson", "the protocol to use to talk to vttablet")
 
 type Wrangler struct {
+	// ts is baseTs bound to the deadline of the current action
 	ts          topo.Server
+	baseTs      topo.Server
 	ai          *tm.ActionInitiator
 	deadline    time.Time
 	lockTimeout time.Duration
@@ -39,7 +41,14 @@ type Wrangler struct {
 //   know that out action will fail. However, automated action will need some time to
 //   arbitrate the locks.
 func New(ts topo.Server, actionTimeout, lockTimeout time.Duration) *Wrangler {
-	return &Wrangler{ts, tm.NewActionInitiator(ts, *tabletManagerProtocol), time.Now().Add(actionTimeout), lockTimeout, true}
+	wr := &Wrangler{
+		baseTs:      ts,
+		ai:          tm.NewActionInitiator(ts, *tabletManagerProtocol),
+		lockTimeout: lockTimeout,
+		UseRPCs:     true,
+	}
+	wr.ResetActionTimeout(actionTimeout)
+	return wr
 }
 
 func (wr *Wrangler) actionTimeout() time.Duration {
@@ -58,8 +67,11 @@ func (wr *Wrangler) ActionInitiator() *tm.ActionInitiator {
 // object that is going to be re-used:
 // - vtctl will not call this, as it does one action
 // - vtctld will call this, as it re-uses the same wrangler for actions
+// The topology calls fail once the action timed out, or the process
+// is interrupted, instead of blocking on a hung topology server.
 func (wr *Wrangler) ResetActionTimeout(actionTimeout time.Duration) {
 	wr.deadline = time.Now().Add(actionTimeout)
+	wr.ts = topo.WithDeadline(wr.baseTs, wr.deadline, interrupted)
 }
 
 // signal handling
@@ -5,16 +5,37 @@
 package zktopo
 
 import (
+	"encoding/json"
+	"fmt"
+	"path"
 	"sort"
 
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
 )
 
 /*
 This file contains the cell management methods of zktopo.Server
+
+Cells are either in the zk client config file, or registered in
+/zk/global/vt/cells/<cell> with the address of their zookeeper
+servers. The zk library reads the registered cells when it needs
+them, and caches their address (see zk.SetCellAddrResolver).
+
+Cells aliases are in /zk/global/vt/cells_aliases/<alias>.
 */
 
+const (
+	globalCellsPath        = "/zk/global/vt/cells"
+	globalCellsAliasesPath = "/zk/global/vt/cells_aliases"
+)
+
 func (zkts *Server) GetKnownCells() ([]string, error) {
+	if err := zkts.registerCells(); err != nil {
+		return nil, err
+	}
 	cellsWithGlobal := zk.ZkKnownCells(false)
 	cells := make([]string, 0, len(cellsWithGlobal))
 	for _, cell := range cellsWithGlobal {
@@ -25,3 +46,140 @@ func (zkts *Server) GetKnownCells() ([]string, error) {
 	sort.Strings(cells)
 	return cells, nil
 }
+
+// registerCells gives the addresses of the cells registered in the
+// global topology to the zk library, so they can be used like the
+// cells of the config file.
+func (zkts *Server) registerCells() error {
+	children, _, err := zkts.zconn.Children(globalCellsPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return nil
+		}
+		return err
+	}
+	for _, cell := range children {
+		ci, err := zkts.GetCellInfo(cell)
+		if err != nil {
+			return err
+		}
+		zk.RegisterCellAddr(cell, ci.ServerAddress)
+	}
+	return nil
+}
+
+func (zkts *Server) CreateCell(cell string, ci *topo.CellInfo) error {
+	zkCellPath := path.Join(globalCellsPath, cell)
+	if _, err := zk.CreateRecursive(zkts.zconn, zkCellPath, jscfg.ToJson(ci), 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+			err = topo.ErrNodeExists
+		}
+		return err
+	}
+	zk.RegisterCellAddr(cell, ci.ServerAddress)
+
+	// and provision the paths in the cell itself
+	for _, zkPath := range []string{tabletDirectoryForCell(cell), zkPathForCell(cell)} {
+		if _, err := zk.CreateRecursive(zkts.zconn, zkPath, "", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil && !zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+			return fmt.Errorf("error creating cell path %v: %v", zkPath, err)
+		}
+	}
+	return nil
+}
+
+func (zkts *Server) GetCellInfo(cell string) (*topo.CellInfo, error) {
+	data, _, err := zkts.zconn.Get(path.Join(globalCellsPath, cell))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+
+	ci := &topo.CellInfo{}
+	if err = json.Unmarshal([]byte(data), ci); err != nil {
+		return nil, err
+	}
+	return ci, nil
+}
+
+func (zkts *Server) UpdateCellInfo(cell string, ci *topo.CellInfo) error {
+	if _, err := zkts.zconn.Set(path.Join(globalCellsPath, cell), jscfg.ToJson(ci), -1); err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return err
+	}
+	zk.RegisterCellAddr(cell, ci.ServerAddress)
+	return nil
+}
+
+// resolveCellAddr returns the address of a cell registered in the
+// global topology, for the zk library.
+func (zkts *Server) resolveCellAddr(cell string) (string, error) {
+	ci, err := zkts.GetCellInfo(cell)
+	switch err {
+	case nil:
+		return ci.ServerAddress, nil
+	case topo.ErrNoNode:
+		return "", nil
+	}
+	return "", err
+}
+
+func (zkts *Server) DeleteCell(cell string) error {
+	if err := zkts.zconn.Delete(path.Join(globalCellsPath, cell), -1); err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return err
+	}
+	zk.RegisterCellAddr(cell, "")
+	return nil
+}
+
+func (zkts *Server) SaveCellsAlias(alias string, ca *topo.CellsAlias) error {
+	zkPath := path.Join(globalCellsAliasesPath, alias)
+	data := jscfg.ToJson(ca)
+	_, err := zkts.zconn.Set(zkPath, data, -1)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		_, err = zk.CreateRecursive(zkts.zconn, zkPath, data, 0, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	}
+	return err
+}
+
+func (zkts *Server) GetCellsAliases() (map[string]*topo.CellsAlias, error) {
+	children, _, err := zkts.zconn.Children(globalCellsAliasesPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return map[string]*topo.CellsAlias{}, nil
+		}
+		return nil, err
+	}
+
+	result := make(map[string]*topo.CellsAlias, len(children))
+	for _, alias := range children {
+		data, _, err := zkts.zconn.Get(path.Join(globalCellsAliasesPath, alias))
+		if err != nil {
+			if zookeeper.IsError(err, zookeeper.ZNONODE) {
+				// deleted in the meantime
+				continue
+			}
+			return nil, err
+		}
+		ca := &topo.CellsAlias{}
+		if err = json.Unmarshal([]byte(data), ca); err != nil {
+			return nil, fmt.Errorf("bad cells alias data %v", err)
+		}
+		result[alias] = ca
+	}
+	return result, nil
+}
+
+func (zkts *Server) DeleteCellsAlias(alias string) error {
+	err := zkts.zconn.Delete(path.Join(globalCellsAliasesPath, alias), -1)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		err = topo.ErrNoNode
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the diff reports management code for zktopo.Server
+*/
+
+func diffReportsPath(keyspace, shard string) string {
+	return path.Join(globalKeyspacesPath, keyspace, "shards", shard, "diffs")
+}
+
+func (zkts *Server) CreateDiffReport(keyspace, shard string, dr *topo.DiffReport) (string, error) {
+	diffsPath := diffReportsPath(keyspace, shard)
+	if _, err := zk.CreateRecursive(zkts.zconn, diffsPath, "", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil && !zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+		return "", err
+	}
+	diffPath, err := zkts.zconn.Create(diffsPath+"/", jscfg.ToJson(dr), zookeeper.SEQUENCE, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	if err != nil {
+		return "", err
+	}
+	return path.Base(diffPath), nil
+}
+
+func (zkts *Server) GetDiffReport(keyspace, shard, uid string) (*topo.DiffReport, error) {
+	zkPath := path.Join(diffReportsPath(keyspace, shard), uid)
+	data, _, err := zkts.zconn.Get(zkPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+
+	dr := &topo.DiffReport{}
+	if err = json.Unmarshal([]byte(data), dr); err != nil {
+		return nil, err
+	}
+	return dr, nil
+}
+
+func (zkts *Server) GetDiffReports(keyspace, shard string) ([]string, error) {
+	children, _, err := zkts.zconn.Children(diffReportsPath(keyspace, shard))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	sort.Strings(children)
+	return children, nil
+}
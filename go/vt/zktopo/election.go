@@ -0,0 +1,136 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the leader election code for zktopo.Server. It is
+used by processes that need at most one instance running per shard,
+like the janitor, or globally, like vtctld. Candidates create an
+ephemeral sequence node under
+/zk/global/vt/keyspaces/<keyspace>/shards/<shard>/<name> or
+/zk/global/vt/elections/<name>, and the lowest one is the leader.
+*/
+
+const (
+	// how long we wait on the queue lock before checking again
+	electionWaitTime = time.Hour
+
+	globalElectionsPath = "/zk/global/vt/elections"
+)
+
+// ElectShardLeader blocks until this process is the leader of the
+// election 'name' for the shard, or until interrupted is closed. It
+// returns the path of the leader node. The leadership ends when
+// ReleaseLeader is called, or when the zookeeper session is lost.
+func (zkts *Server) ElectShardLeader(keyspace, shard, name, contents string, interrupted chan struct{}) (string, error) {
+	return zkts.electLeader(path.Join(globalKeyspacesPath, keyspace, "shards", shard, name), contents, interrupted)
+}
+
+// ElectGlobalLeader is ElectShardLeader for elections that are not
+// tied to a shard.
+func (zkts *Server) ElectGlobalLeader(name, contents string, interrupted chan struct{}) (string, error) {
+	return zkts.electLeader(path.Join(globalElectionsPath, name), contents, interrupted)
+}
+
+// GetGlobalLeader returns the contents of the leader node of the
+// election 'name', or topo.ErrNoNode if there is no leader.
+func (zkts *Server) GetGlobalLeader(name string) (string, error) {
+	electionDir := path.Join(globalElectionsPath, name)
+	children, _, err := zkts.zconn.Children(electionDir)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return "", err
+	}
+	if len(children) == 0 {
+		return "", topo.ErrNoNode
+	}
+	sort.Strings(children)
+	contents, _, err := zkts.zconn.Get(path.Join(electionDir, children[0]))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return "", err
+	}
+	return contents, nil
+}
+
+func (zkts *Server) electLeader(electionDir, contents string, interrupted chan struct{}) (string, error) {
+	if _, err := zk.CreateRecursive(zkts.zconn, electionDir, "", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil && !zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+		return "", err
+	}
+
+	// the trailing slash creates the sequence node as a child
+	leaderPath, err := zkts.zconn.Create(electionDir+"/", contents, zookeeper.EPHEMERAL|zookeeper.SEQUENCE, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		err = zk.ObtainQueueLock(zkts.zconn, leaderPath, electionWaitTime, interrupted)
+		switch err {
+		case nil:
+			return leaderPath, nil
+		case zk.ErrTimeout:
+			log.Infof("still waiting to be the leader of %v", electionDir)
+			continue
+		}
+
+		zkts.zconn.Delete(leaderPath, -1)
+		if err == zk.ErrInterrupted {
+			return "", topo.ErrInterrupted
+		}
+		return "", fmt.Errorf("failed to be elected leader of %v: %v", electionDir, err)
+	}
+}
+
+// WatchLeader returns a channel that is closed when the leader node
+// returned by ElectShardLeader or ElectGlobalLeader goes away.
+func (zkts *Server) WatchLeader(leaderPath string) (<-chan struct{}, error) {
+	stat, watch, err := zkts.zconn.ExistsW(leaderPath)
+	if err != nil {
+		return nil, err
+	}
+	lost := make(chan struct{})
+	if stat == nil {
+		close(lost)
+		return lost, nil
+	}
+	go func() {
+		for {
+			event := <-watch
+			if event.Ok() && event.Type != zookeeper.EVENT_DELETED {
+				// node changed, keep watching
+				stat, watch, err = zkts.zconn.ExistsW(leaderPath)
+				if err == nil && stat != nil {
+					continue
+				}
+			}
+			log.Warningf("lost leadership %v: %v", leaderPath, event)
+			close(lost)
+			return
+		}
+	}()
+	return lost, nil
+}
+
+// ReleaseLeader gives up the leadership.
+func (zkts *Server) ReleaseLeader(leaderPath string) error {
+	return zkts.zconn.Delete(leaderPath, -1)
+}
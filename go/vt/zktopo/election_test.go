@@ -0,0 +1,68 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func TestGlobalElection(t *testing.T) {
+	zkts := NewTestServer(t, []string{"test"}).(TestServer).Server.(*Server)
+
+	if _, err := zkts.GetGlobalLeader("vtctld"); err != topo.ErrNoNode {
+		t.Errorf("want ErrNoNode before the election, got %v", err)
+	}
+	firstPath, err := zkts.ElectGlobalLeader("vtctld", "first:8080", nil)
+	if err != nil {
+		t.Fatalf("ElectGlobalLeader: %v", err)
+	}
+	if leader, err := zkts.GetGlobalLeader("vtctld"); err != nil || leader != "first:8080" {
+		t.Errorf("want first:8080 as the leader, got %v %v", leader, err)
+	}
+	lost, err := zkts.WatchLeader(firstPath)
+	if err != nil {
+		t.Fatalf("WatchLeader: %v", err)
+	}
+
+	elected := make(chan string)
+	go func() {
+		secondPath, err := zkts.ElectGlobalLeader("vtctld", "second:8080", nil)
+		if err != nil {
+			t.Errorf("ElectGlobalLeader: %v", err)
+		}
+		elected <- secondPath
+	}()
+	select {
+	case <-elected:
+		t.Fatalf("the second candidate should wait for the first one")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if err := zkts.ReleaseLeader(firstPath); err != nil {
+		t.Fatalf("ReleaseLeader: %v", err)
+	}
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Errorf("the first candidate should have lost the leadership")
+	}
+	select {
+	case <-elected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the second candidate should have been elected")
+	}
+	if leader, err := zkts.GetGlobalLeader("vtctld"); err != nil || leader != "second:8080" {
+		t.Errorf("want second:8080 as the leader, got %v %v", leader, err)
+	}
+
+	interrupted := make(chan struct{})
+	close(interrupted)
+	if _, err := zkts.ElectGlobalLeader("vtctld", "third:8080", interrupted); err != topo.ErrInterrupted {
+		t.Errorf("want ErrInterrupted, got %v", err)
+	}
+}
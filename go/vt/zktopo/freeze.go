@@ -0,0 +1,128 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the topology freeze code for zktopo.Server
+
+The freeze is stored in /zk/global/vt/freeze. All the changes go
+through a freezeCheckConn, that checks the node doesn't exist first.
+*/
+
+const (
+	globalFreezePath = "/zk/global/vt/freeze"
+)
+
+func (zkts *Server) FreezeTopology(freeze *topo.Freeze) error {
+	_, err := zkts.zconn.Create(globalFreezePath, jscfg.ToJson(freeze), 0, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+		err = topo.ErrNodeExists
+	}
+	return err
+}
+
+func (zkts *Server) UnfreezeTopology() error {
+	err := zkts.zconn.Delete(globalFreezePath, -1)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		err = topo.ErrNoNode
+	}
+	return err
+}
+
+func (zkts *Server) GetTopologyFreeze() (*topo.Freeze, error) {
+	return getTopologyFreeze(zkts.zconn)
+}
+
+func getTopologyFreeze(zconn zk.Conn) (*topo.Freeze, error) {
+	data, _, err := zconn.Get(globalFreezePath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+
+	freeze := &topo.Freeze{}
+	if err = json.Unmarshal([]byte(data), freeze); err != nil {
+		return nil, fmt.Errorf("bad freeze data %v", err)
+	}
+	return freeze, nil
+}
+
+// freezeCheckConn is a zk.Conn that fails all changes while the
+// topology is frozen, except the ones of the freeze itself.
+type freezeCheckConn struct {
+	zk.Conn
+}
+
+// ChildrenWithData forwards to the connection, so it can use its
+// faster implementation.
+func (conn *freezeCheckConn) ChildrenWithData(zkPath string) (map[string]zk.ChildData, error) {
+	return zk.ChildrenWithData(conn.Conn, zkPath)
+}
+
+// checkFreeze returns a FrozenError if the topology is frozen. If
+// the freeze cannot be read, the change is allowed, so the cells can
+// still work when the global topology is unreachable.
+func (conn *freezeCheckConn) checkFreeze(zkPath string) error {
+	if *topo.BypassFreeze || zkPath == globalFreezePath {
+		return nil
+	}
+	freeze, err := getTopologyFreeze(conn.Conn)
+	switch err {
+	case nil:
+		return &topo.FrozenError{Freeze: freeze}
+	case topo.ErrNoNode:
+		return nil
+	}
+	log.Warningf("cannot read the topology freeze, allowing change of %v: %v", zkPath, err)
+	return nil
+}
+
+func (conn *freezeCheckConn) Create(zkPath, value string, flags int, aclv []zookeeper.ACL) (string, error) {
+	if err := conn.checkFreeze(zkPath); err != nil {
+		return "", err
+	}
+	return conn.Conn.Create(zkPath, value, flags, aclv)
+}
+
+func (conn *freezeCheckConn) Set(zkPath, value string, version int) (zk.Stat, error) {
+	if err := conn.checkFreeze(zkPath); err != nil {
+		return nil, err
+	}
+	return conn.Conn.Set(zkPath, value, version)
+}
+
+func (conn *freezeCheckConn) Delete(zkPath string, version int) error {
+	if err := conn.checkFreeze(zkPath); err != nil {
+		return err
+	}
+	return conn.Conn.Delete(zkPath, version)
+}
+
+func (conn *freezeCheckConn) RetryChange(zkPath string, flags int, acl []zookeeper.ACL, changeFunc zk.ChangeFunc) error {
+	if err := conn.checkFreeze(zkPath); err != nil {
+		return err
+	}
+	return conn.Conn.RetryChange(zkPath, flags, acl, changeFunc)
+}
+
+func (conn *freezeCheckConn) SetACL(zkPath string, aclv []zookeeper.ACL, version int) error {
+	if err := conn.checkFreeze(zkPath); err != nil {
+		return err
+	}
+	return conn.Conn.SetACL(zkPath, aclv, version)
+}
@@ -0,0 +1,215 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the garbage collection of the orphaned nodes of
+zktopo.Server: the nodes that refer to a keyspace or a shard that
+doesn't exist any more, and the lock nodes left behind by processes
+that died while holding them.
+*/
+
+// Orphan is a node that can be garbage collected.
+type Orphan struct {
+	// Path is the zk path of the node, deleted recursively.
+	Path string
+
+	// Reason explains why the node is an orphan.
+	Reason string
+}
+
+func (o Orphan) String() string {
+	return fmt.Sprintf("%v: %v", o.Path, o.Reason)
+}
+
+// FindOrphans returns the orphaned nodes of a keyspace, or of all
+// keyspaces if keyspace is empty:
+//   - the tablets of a keyspace or shard that doesn't exist
+//   - the serving and replication graphs of a keyspace or shard that
+//     doesn't exist
+//   - the keyspace and shard lock nodes older than lockAge
+//
+// The tablets, serving and replication graphs are searched in the
+// given cells.
+func (zkts *Server) FindOrphans(cells []string, keyspace string, lockAge time.Duration) ([]Orphan, error) {
+	// shardNames maps the existing keyspaces to their shards
+	keyspaces, err := zkts.GetKeyspaces()
+	if err != nil {
+		return nil, err
+	}
+	shardNames := make(map[string]map[string]bool)
+	for _, ks := range keyspaces {
+		shards, err := zkts.GetShardNames(ks)
+		if err != nil && err != topo.ErrNoNode {
+			return nil, err
+		}
+		shardNames[ks] = make(map[string]bool)
+		for _, shard := range shards {
+			shardNames[ks][shard] = true
+		}
+	}
+	// missing returns why a shard is an orphan, or ""
+	missing := func(ks, shard string) string {
+		if shardNames[ks] == nil {
+			return fmt.Sprintf("keyspace %v doesn't exist", ks)
+		}
+		if shard != "" && !shardNames[ks][shard] {
+			return fmt.Sprintf("shard %v/%v doesn't exist", ks, shard)
+		}
+		return ""
+	}
+
+	var orphans []Orphan
+	for _, cell := range cells {
+		cellOrphans, err := zkts.findCellOrphans(cell, keyspace, missing)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, cellOrphans...)
+	}
+
+	// leftover locks
+	for _, ks := range keyspaces {
+		if keyspace != "" && ks != keyspace {
+			continue
+		}
+		actionDirs := []string{path.Join(globalKeyspacesPath, ks, "action")}
+		shards := make([]string, 0, len(shardNames[ks]))
+		for shard := range shardNames[ks] {
+			shards = append(shards, shard)
+		}
+		sort.Strings(shards)
+		for _, shard := range shards {
+			actionDirs = append(actionDirs, zkts.ShardActionPath(ks, shard))
+		}
+		for _, actionDir := range actionDirs {
+			lockOrphans, err := zkts.findOldLocks(actionDir, lockAge)
+			if err != nil {
+				return nil, err
+			}
+			orphans = append(orphans, lockOrphans...)
+		}
+	}
+	return orphans, nil
+}
+
+// findCellOrphans returns the orphaned tablets, serving graph and
+// replication graph nodes of a cell.
+func (zkts *Server) findCellOrphans(cell, keyspace string, missing func(ks, shard string) string) ([]Orphan, error) {
+	var orphans []Orphan
+
+	aliases, err := zkts.GetTabletsByCell(cell)
+	if err != nil && err != topo.ErrNoNode {
+		return nil, err
+	}
+	for _, alias := range aliases {
+		ti, err := zkts.GetTablet(alias)
+		if err != nil {
+			if err == topo.ErrNoNode {
+				continue
+			}
+			return nil, err
+		}
+		// idle tablets have no keyspace
+		if ti.Keyspace == "" || (keyspace != "" && ti.Keyspace != keyspace) {
+			continue
+		}
+		if reason := missing(ti.Keyspace, ti.Shard); reason != "" {
+			orphans = append(orphans, Orphan{TabletPathForAlias(alias), fmt.Sprintf("tablet %v: %v", alias, reason)})
+		}
+	}
+
+	for _, graph := range []struct {
+		name string
+		path string
+	}{
+		{"serving graph", zkPathForCell(cell)},
+		{"replication graph", path.Join("/zk", cell, "vt", "replication")},
+	} {
+		keyspaces, err := zkts.sortedChildren(graph.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, ks := range keyspaces {
+			if keyspace != "" && ks != keyspace {
+				continue
+			}
+			ksPath := path.Join(graph.path, ks)
+			if reason := missing(ks, ""); reason != "" {
+				orphans = append(orphans, Orphan{ksPath, fmt.Sprintf("%v of cell %v: %v", graph.name, cell, reason)})
+				continue
+			}
+			shards, err := zkts.sortedChildren(ksPath)
+			if err != nil {
+				return nil, err
+			}
+			for _, shard := range shards {
+				if reason := missing(ks, shard); reason != "" {
+					orphans = append(orphans, Orphan{path.Join(ksPath, shard), fmt.Sprintf("%v of cell %v: %v", graph.name, cell, reason)})
+				}
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// findOldLocks returns the lock nodes of an action directory that
+// were created more than lockAge ago.
+func (zkts *Server) findOldLocks(actionDir string, lockAge time.Duration) ([]Orphan, error) {
+	children, err := zkts.sortedChildren(actionDir)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []Orphan
+	for _, child := range children {
+		lockPath := path.Join(actionDir, child)
+		stat, err := zkts.zconn.Exists(lockPath)
+		if err != nil {
+			return nil, err
+		}
+		if stat == nil {
+			// unlocked in the meantime
+			continue
+		}
+		if age := time.Since(stat.CTime()); age > lockAge {
+			orphans = append(orphans, Orphan{lockPath, fmt.Sprintf("lock held for %v", age)})
+		}
+	}
+	return orphans, nil
+}
+
+// sortedChildren returns the sorted children of a node, or nothing
+// if it doesn't exist.
+func (zkts *Server) sortedChildren(zkPath string) ([]string, error) {
+	children, _, err := zkts.zconn.Children(zkPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sort.Strings(children)
+	return children, nil
+}
+
+// DeleteOrphan deletes an orphaned node found by FindOrphans.
+func (zkts *Server) DeleteOrphan(orphan Orphan) error {
+	err := zk.DeleteRecursive(zkts.zconn, orphan.Path, -1)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		return nil
+	}
+	return err
+}
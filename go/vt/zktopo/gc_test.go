@@ -0,0 +1,87 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+func TestFindOrphans(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	zkts := ts.(TestServer).Server.(*Server)
+	if err := ts.CreateKeyspace("test_keyspace"); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	if err := topo.CreateShard(ts, "test_keyspace", "0"); err != nil {
+		t.Fatalf("CreateShard: %v", err)
+	}
+	for uid, shard := range []string{"0", "1"} {
+		tablet := &topo.Tablet{
+			Alias:    topo.TabletAlias{Cell: "test", Uid: uint32(uid)},
+			Hostname: "localhost",
+			Keyspace: "test_keyspace",
+			Shard:    shard,
+			Type:     topo.TYPE_REPLICA,
+			State:    topo.STATE_READ_ONLY,
+		}
+		if err := ts.CreateTablet(tablet); err != nil {
+			t.Fatalf("CreateTablet: %v", err)
+		}
+	}
+	for _, ks := range []string{"test_keyspace", "other_keyspace"} {
+		if _, err := zk.CreateRecursive(zkts.zconn, zkPathForVtShard("test", ks, "1"), "", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil {
+			t.Fatalf("CreateRecursive: %v", err)
+		}
+	}
+	if _, err := ts.LockShardForAction("test_keyspace", "0", "lock", time.Second, nil); err != nil {
+		t.Fatalf("LockShardForAction: %v", err)
+	}
+
+	// with a long lock age, the lock is not found
+	orphans, err := zkts.FindOrphans([]string{"test"}, "", time.Hour)
+	if err != nil {
+		t.Fatalf("FindOrphans: %v", err)
+	}
+	var paths []string
+	for _, o := range orphans {
+		paths = append(paths, o.Path)
+	}
+	want := []string{
+		"/zk/test/vt/tablets/0000000001",
+		"/zk/test/vt/ns/other_keyspace",
+		"/zk/test/vt/ns/test_keyspace/1",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("got orphans %v, want %v", orphans, want)
+	}
+
+	// the keyspace filter and the lock age are applied
+	orphans, err = zkts.FindOrphans([]string{"test"}, "other_keyspace", 0)
+	if err != nil || len(orphans) != 1 || orphans[0].Path != "/zk/test/vt/ns/other_keyspace" {
+		t.Errorf("FindOrphans(other_keyspace): %v %v", orphans, err)
+	}
+	orphans, err = zkts.FindOrphans([]string{"test"}, "test_keyspace", 0)
+	if err != nil || len(orphans) != 3 || orphans[2].Path[:len("/zk/global/vt/keyspaces/test_keyspace/shards/0/action/")] != "/zk/global/vt/keyspaces/test_keyspace/shards/0/action/" {
+		t.Fatalf("FindOrphans(test_keyspace): %v %v", orphans, err)
+	}
+
+	for _, o := range orphans {
+		if err := zkts.DeleteOrphan(o); err != nil {
+			t.Errorf("DeleteOrphan(%v): %v", o, err)
+		}
+	}
+	if orphans, err := zkts.FindOrphans([]string{"test"}, "test_keyspace", 0); err != nil || len(orphans) != 0 {
+		t.Errorf("FindOrphans(after delete): %v %v", orphans, err)
+	}
+	if _, err := ts.GetTablet(topo.TabletAlias{Cell: "test", Uid: 0}); err != nil {
+		t.Errorf("tablet of an existing shard should still be there: %v", err)
+	}
+}
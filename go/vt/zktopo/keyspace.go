@@ -68,3 +68,19 @@ func (zkts *Server) DeleteKeyspaceShards(keyspace string) error {
 	}
 	return nil
 }
+
+func (zkts *Server) DeleteKeyspace(keyspace string) error {
+	shards, _, err := zkts.zconn.Children(path.Join(globalKeyspacesPath, keyspace, "shards"))
+	if err != nil && !zookeeper.IsError(err, zookeeper.ZNONODE) {
+		return err
+	}
+	if len(shards) > 0 {
+		return topo.ErrNotEmpty
+	}
+
+	err = zk.DeleteRecursive(zkts.zconn, path.Join(globalKeyspacesPath, keyspace), -1)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		err = topo.ErrNoNode
+	}
+	return err
+}
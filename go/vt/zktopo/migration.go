@@ -0,0 +1,93 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the schema migration management code for zktopo.Server
+*/
+
+func schemaMigrationsPath(keyspace string) string {
+	return path.Join(globalKeyspacesPath, keyspace, "migrations")
+}
+
+func (zkts *Server) CreateSchemaMigration(keyspace string, sm *topo.SchemaMigration) (string, error) {
+	migrationsPath := schemaMigrationsPath(keyspace)
+	if _, err := zk.CreateRecursive(zkts.zconn, migrationsPath, "", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil && !zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+		return "", err
+	}
+	migrationPath, err := zkts.zconn.Create(migrationsPath+"/", jscfg.ToJson(sm), zookeeper.SEQUENCE, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	if err != nil {
+		return "", err
+	}
+	return path.Base(migrationPath), nil
+}
+
+func (zkts *Server) UpdateSchemaMigrationFields(keyspace, uid string, update func(*topo.SchemaMigration) error) error {
+	zkPath := path.Join(schemaMigrationsPath(keyspace), uid)
+	f := func(oldValue string, oldStat zk.Stat) (string, error) {
+		// RetryChange would create a missing node, we don't want that
+		if oldValue == "" {
+			return "", topo.ErrNoNode
+		}
+		sm := &topo.SchemaMigration{}
+		if err := json.Unmarshal([]byte(oldValue), sm); err != nil {
+			return "", err
+		}
+
+		if err := update(sm); err != nil {
+			return "", err
+		}
+		return jscfg.ToJson(sm), nil
+	}
+	err := zkts.zconn.RetryChange(zkPath, 0, zookeeper.WorldACL(zookeeper.PERM_ALL), f)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return err
+	}
+	return nil
+}
+
+func (zkts *Server) GetSchemaMigration(keyspace, uid string) (*topo.SchemaMigration, error) {
+	zkPath := path.Join(schemaMigrationsPath(keyspace), uid)
+	data, _, err := zkts.zconn.Get(zkPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+
+	sm := &topo.SchemaMigration{}
+	if err = json.Unmarshal([]byte(data), sm); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+func (zkts *Server) GetSchemaMigrations(keyspace string) ([]string, error) {
+	children, _, err := zkts.zconn.Children(schemaMigrationsPath(keyspace))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	sort.Strings(children)
+	return children, nil
+}
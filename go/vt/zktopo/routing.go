@@ -0,0 +1,46 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the routing rules management code for zktopo.Server
+*/
+
+const globalRoutingRulesPath = "/zk/global/vt/routing_rules"
+
+func (zkts *Server) SaveRoutingRules(rr *topo.RoutingRules) error {
+	data := jscfg.ToJson(rr)
+	_, err := zkts.zconn.Set(globalRoutingRulesPath, data, -1)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		_, err = zk.CreateRecursive(zkts.zconn, globalRoutingRulesPath, data, 0, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	}
+	return err
+}
+
+func (zkts *Server) GetRoutingRules() (*topo.RoutingRules, error) {
+	data, _, err := zkts.zconn.Get(globalRoutingRulesPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return topo.NewRoutingRules(), nil
+		}
+		return nil, err
+	}
+
+	rr := topo.NewRoutingRules()
+	if err = json.Unmarshal([]byte(data), rr); err != nil {
+		return nil, fmt.Errorf("bad routing rules data %v", err)
+	}
+	return rr, nil
+}
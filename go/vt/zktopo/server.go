@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"path"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/youtube/vitess/go/stats"
@@ -19,6 +21,10 @@ import (
 // Server is the zookeeper topo.Server implementation.
 type Server struct {
 	zconn zk.Conn
+
+	// the pending UpdateTabletEndpoint batches, by serving graph node
+	endPointMu      sync.Mutex
+	endPointUpdates map[string]*endPointUpdate
 }
 
 func (zkts *Server) Close() {
@@ -31,25 +37,45 @@ func (zkts *Server) GetZConn() zk.Conn {
 
 // NewServer can be used to create a custom Server
 // (for tests for instance) but it cannot change the globally
-// registered one.
+// registered one. The changes go through the topology freeze check,
+// and the write rate limit. The calls are limited to
+// -zk.call-timeout.
 func NewServer(zconn zk.Conn) *Server {
-	return &Server{zconn: zconn}
+	return &Server{zconn: &zk.DeadlineConn{Conn: &freezeCheckConn{&writeLimitConn{Conn: zconn}}}}
+}
+
+// WithDeadline returns a Server using the same connection, whose
+// calls fail with zk.ErrCallTimeout after deadline, and with
+// zk.ErrCallInterrupted once interrupted is closed.
+func (zkts *Server) WithDeadline(deadline time.Time, interrupted chan struct{}) topo.Server {
+	conn := zkts.zconn.(*zk.DeadlineConn).Conn
+	return &Server{zconn: &zk.DeadlineConn{Conn: conn, Deadline: deadline, Interrupted: interrupted}}
 }
 
 func init() {
 	zconn := zk.NewMetaConn(false)
 	stats.PublishJSONFunc("ZkMetaConn", zconn.String)
-	topo.RegisterServer("zookeeper", NewServer(zconn))
+	zkts := NewServer(zconn)
+	zk.SetCellAddrResolver(zkts.resolveCellAddr)
+	topo.RegisterServer("zookeeper", zkts)
 }
 
 //
 // These helper methods are for ZK specific things
 //
 
+func (zkts *Server) KeyspaceActionPath(keyspace string) string {
+	return globalKeyspacesPath + "/" + keyspace + "/action"
+}
+
 func (zkts *Server) ShardActionPath(keyspace, shard string) string {
 	return "/zk/global/vt/keyspaces/" + keyspace + "/shards/" + shard + "/action"
 }
 
+func (zkts *Server) ShardActionLogPath(keyspace, shard string) string {
+	return "/zk/global/vt/keyspaces/" + keyspace + "/shards/" + shard + "/actionlog"
+}
+
 // PurgeActions removes all queued actions, leaving the action node
 // itself in place.
 //
@@ -118,6 +144,86 @@ func (zkts *Server) StaleActions(zkActionPath string, maxStaleness time.Duration
 	return staleActions, nil
 }
 
+// QueuedAction is an action node of an action queue.
+type QueuedAction struct {
+	Path string
+	Data string
+
+	// Age is how long since the node was last changed.
+	Age time.Duration
+}
+
+// GetActionQueue returns the action nodes of an action queue, in
+// queue order. This can be used for tablets, shards and keyspaces.
+func (zkts *Server) GetActionQueue(zkActionPath string) ([]QueuedAction, error) {
+	if path.Base(zkActionPath) != "action" {
+		return nil, fmt.Errorf("not action path: %v", zkActionPath)
+	}
+
+	children, _, err := zkts.zconn.Children(zkActionPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sort.Strings(children)
+
+	actions := make([]QueuedAction, 0, len(children))
+	for _, child := range children {
+		actionPath := path.Join(zkActionPath, child)
+		data, stat, err := zkts.zconn.Get(actionPath)
+		if err != nil {
+			if zookeeper.IsError(err, zookeeper.ZNONODE) {
+				// finished in the meantime
+				continue
+			}
+			return nil, fmt.Errorf("GetActionQueue(%v) err: %v", zkActionPath, err)
+		}
+		actions = append(actions, QueuedAction{actionPath, data, time.Since(stat.MTime())})
+	}
+	return actions, nil
+}
+
+// RequeueAction replaces the content of a tablet action with data,
+// and pokes the action queue so the tablet agent processes it again.
+// This is only useful for an action left behind by a dead vtaction.
+func (zkts *Server) RequeueAction(actionPath, data string) error {
+	if _, err := actionPathToTabletAlias(actionPath); err != nil {
+		return fmt.Errorf("only tablet actions can be requeued: %v", err)
+	}
+	if _, err := zkts.zconn.Set(actionPath, data, -1); err != nil {
+		return err
+	}
+
+	// The agent removes the invalid nodes of its action queue, and
+	// processes the queue again when it changes.
+	pokePath := path.Join(path.Dir(actionPath), "requeue")
+	_, err := zkts.zconn.Create(pokePath, "", 0, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	if err != nil && !zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+		return err
+	}
+	return nil
+}
+
+// CancelAction stores data as the result of an action in the action
+// log, so its waiters return, and removes the action from its queue.
+// For a shard or keyspace action, this breaks the lock it holds.
+func (zkts *Server) CancelAction(actionPath, data string) error {
+	if path.Base(path.Dir(actionPath)) != "action" {
+		return fmt.Errorf("not action path: %v", actionPath)
+	}
+	actionLogPath := strings.Replace(actionPath, "/action/", "/actionlog/", 1)
+	if _, err := zk.CreateRecursive(zkts.zconn, actionLogPath, data, 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil && !zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+		return err
+	}
+	err := zk.DeleteRecursive(zkts.zconn, actionPath, -1)
+	if err != nil && !zookeeper.IsError(err, zookeeper.ZNONODE) {
+		return err
+	}
+	return nil
+}
+
 // PruneActionLogs prunes old actionlog entries. Returns how many
 // entries were purged (even if there was an error).
 //
@@ -0,0 +1,95 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func TestActionQueue(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	zkts := ts.(TestServer).Server.(*Server)
+	if err := ts.CreateKeyspace("test_keyspace"); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	if err := topo.CreateShard(ts, "test_keyspace", "0"); err != nil {
+		t.Fatalf("CreateShard: %v", err)
+	}
+	tablet := &topo.Tablet{
+		Alias:    topo.TabletAlias{Cell: "test", Uid: 1},
+		Hostname: "localhost",
+		Keyspace: "test_keyspace",
+		Shard:    "0",
+		Type:     topo.TYPE_REPLICA,
+		State:    topo.STATE_READ_ONLY,
+	}
+	if err := ts.CreateTablet(tablet); err != nil {
+		t.Fatalf("CreateTablet: %v", err)
+	}
+
+	tabletActionPath := TabletActionPathForAlias(tablet.Alias)
+	actionPath, err := ts.WriteTabletAction(tablet.Alias, "first")
+	if err != nil {
+		t.Fatalf("WriteTabletAction: %v", err)
+	}
+	if _, err := ts.WriteTabletAction(tablet.Alias, "second"); err != nil {
+		t.Fatalf("WriteTabletAction: %v", err)
+	}
+	actions, err := zkts.GetActionQueue(tabletActionPath)
+	if err != nil || len(actions) != 2 || actions[0].Path != actionPath || actions[0].Data != "first" || actions[1].Data != "second" {
+		t.Fatalf("GetActionQueue: %v %v", actions, err)
+	}
+	if actions[0].Age < 0 || actions[0].Age > time.Minute {
+		t.Errorf("unexpected action age: %v", actions[0].Age)
+	}
+
+	// requeueing rewrites the action, and pokes the queue
+	if err := zkts.RequeueAction(actionPath, "first again"); err != nil {
+		t.Fatalf("RequeueAction: %v", err)
+	}
+	if data, _, err := zkts.zconn.Get(actionPath); err != nil || data != "first again" {
+		t.Errorf("requeued action: %v %v", data, err)
+	}
+	if stat, err := zkts.zconn.Exists(path.Join(tabletActionPath, "requeue")); err != nil || stat == nil {
+		t.Errorf("action queue not poked: %v", err)
+	}
+
+	// cancelling logs the action and removes it
+	if err := zkts.CancelAction(actionPath, "cancelled"); err != nil {
+		t.Fatalf("CancelAction: %v", err)
+	}
+	if data, err := ts.WaitForTabletAction(actionPath, time.Second, nil); err != nil || data != "cancelled" {
+		t.Errorf("cancelled action log: %v %v", data, err)
+	}
+	if stat, err := zkts.zconn.Exists(actionPath); err != nil || stat != nil {
+		t.Errorf("cancelled action still queued: %v", err)
+	}
+
+	// shard actions can be cancelled, not requeued
+	lockPath, err := ts.LockShardForAction("test_keyspace", "0", "lock", time.Second, nil)
+	if err != nil {
+		t.Fatalf("LockShardForAction: %v", err)
+	}
+	if actions, err := zkts.GetActionQueue(zkts.ShardActionPath("test_keyspace", "0")); err != nil || len(actions) != 1 || actions[0].Path != lockPath {
+		t.Errorf("GetActionQueue(shard): %v %v", actions, err)
+	}
+	if err := zkts.RequeueAction(lockPath, "lock"); err == nil {
+		t.Errorf("RequeueAction of a shard action should have failed")
+	}
+	if err := zkts.CancelAction(lockPath, "cancelled"); err != nil {
+		t.Fatalf("CancelAction: %v", err)
+	}
+	if _, err := ts.LockShardForAction("test_keyspace", "0", "lock", time.Second, nil); err != nil {
+		t.Errorf("LockShardForAction after CancelAction: %v", err)
+	}
+
+	if actions, err := zkts.GetActionQueue(zkts.KeyspaceActionPath("test_keyspace")); err != nil || len(actions) != 0 {
+		t.Errorf("GetActionQueue(keyspace): %v %v", actions, err)
+	}
+}
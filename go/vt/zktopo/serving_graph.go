@@ -6,9 +6,11 @@ package zktopo
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"path"
 	"sort"
+	"time"
 
 	"github.com/youtube/vitess/go/jscfg"
 	"github.com/youtube/vitess/go/vt/topo"
@@ -18,7 +20,15 @@ import (
 
 /*
 This file contains the serving graph management code of zktopo.Server
+
+The copies of the serving graph of the cells are in:
+/zk/global/vt/ns_mirrors/<cell>/<keyspace>
 */
+
+const globalServingMirrorsPath = "/zk/global/vt/ns_mirrors"
+
+var endPointBatchWindow = flag.Duration("topo_endpoint_batch_window", 0, "how long UpdateTabletEndpoint waits for other updates of the same serving graph node, to write them all at once (0 to write right away)")
+
 func zkPathForCell(cell string) string {
 	return fmt.Sprintf("/zk/%v/vt/ns", cell)
 }
@@ -86,6 +96,28 @@ func (zkts *Server) GetEndPoints(cell, keyspace, shard string, tabletType topo.T
 	return result, nil
 }
 
+func (zkts *Server) GetEndPointsPerShard(cell, keyspace, shard string) (map[topo.TabletType]*topo.EndPoints, error) {
+	children, err := zk.ChildrenWithData(zkts.zconn, zkPathForVtShard(cell, keyspace, shard))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+
+	result := make(map[topo.TabletType]*topo.EndPoints, len(children))
+	for tt, cd := range children {
+		addrs := &topo.EndPoints{}
+		if len(cd.Data) > 0 {
+			if err := json.Unmarshal([]byte(cd.Data), addrs); err != nil {
+				return nil, fmt.Errorf("EndPoints unmarshal failed: %v %v", cd.Data, err)
+			}
+		}
+		result[topo.TabletType(tt)] = addrs
+	}
+	return result, nil
+}
+
 func (zkts *Server) DeleteSrvTabletType(cell, keyspace, shard string, tabletType topo.TabletType) error {
 	path := zkPathForVtName(cell, keyspace, shard, tabletType)
 	err := zkts.zconn.Delete(path, -1)
@@ -123,6 +155,14 @@ func (zkts *Server) GetSrvShard(cell, keyspace, shard string) (*topo.SrvShard, e
 	return srvShard, nil
 }
 
+func (zkts *Server) DeleteSrvShard(cell, keyspace, shard string) error {
+	err := zk.DeleteRecursive(zkts.zconn, zkPathForVtShard(cell, keyspace, shard), -1)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		err = topo.ErrNoNode
+	}
+	return err
+}
+
 func (zkts *Server) UpdateSrvKeyspace(cell, keyspace string, srvKeyspace *topo.SrvKeyspace) error {
 	path := zkPathForVtKeyspace(cell, keyspace)
 	data := jscfg.ToJson(srvKeyspace)
@@ -148,6 +188,14 @@ func (zkts *Server) GetSrvKeyspace(cell, keyspace string) (*topo.SrvKeyspace, er
 	return srvKeyspace, nil
 }
 
+func (zkts *Server) DeleteSrvKeyspace(cell, keyspace string) error {
+	err := zk.DeleteRecursive(zkts.zconn, zkPathForVtKeyspace(cell, keyspace), -1)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		err = topo.ErrNoNode
+	}
+	return err
+}
+
 func (zkts *Server) GetSrvKeyspaceNames(cell string) ([]string, error) {
 	children, _, err := zkts.zconn.Children(zkPathForCell(cell))
 	if err != nil {
@@ -161,9 +209,53 @@ func (zkts *Server) GetSrvKeyspaceNames(cell string) ([]string, error) {
 	return children, nil
 }
 
+// zkPathForSrvKeyspaceMirror returns the path of the copy of the
+// serving graph of a keyspace in a cell, in the global topology.
+func zkPathForSrvKeyspaceMirror(cell, keyspace string) string {
+	return path.Join(globalServingMirrorsPath, cell, keyspace)
+}
+
+func (zkts *Server) UpdateSrvKeyspaceMirror(cell, keyspace string, mirror *topo.SrvKeyspaceMirror) error {
+	zkPath := zkPathForSrvKeyspaceMirror(cell, keyspace)
+	data := jscfg.ToJson(mirror)
+	_, err := zkts.zconn.Set(zkPath, data, -1)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		_, err = zk.CreateRecursive(zkts.zconn, zkPath, data, 0, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	}
+	return err
+}
+
+func (zkts *Server) GetSrvKeyspaceMirror(cell, keyspace string) (*topo.SrvKeyspaceMirror, error) {
+	data, _, err := zkts.zconn.Get(zkPathForSrvKeyspaceMirror(cell, keyspace))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+	mirror := &topo.SrvKeyspaceMirror{}
+	if err := json.Unmarshal([]byte(data), mirror); err != nil {
+		return nil, fmt.Errorf("SrvKeyspaceMirror unmarshal failed: %v %v", data, err)
+	}
+	return mirror, nil
+}
+
+func (zkts *Server) GetSrvKeyspaceMirrorNames(cell string) ([]string, error) {
+	children, _, err := zkts.zconn.Children(path.Join(globalServingMirrorsPath, cell))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	sort.Strings(children)
+	return children, nil
+}
+
 var skipUpdateErr = fmt.Errorf("skip update")
 
-func (zkts *Server) updateTabletEndpoint(oldValue string, oldStat zk.Stat, addr *topo.EndPoint) (newValue string, err error) {
+func (zkts *Server) updateTabletEndpoints(oldValue string, oldStat zk.Stat, addrs []*topo.EndPoint) (newValue string, err error) {
 	if oldStat == nil {
 		// The incoming object doesn't exist - we haven't been placed in the serving
 		// graph yet, so don't update. Assume the next process that rebuilds the graph
@@ -171,40 +263,109 @@ func (zkts *Server) updateTabletEndpoint(oldValue string, oldStat zk.Stat, addr
 		return "", skipUpdateErr
 	}
 
-	var addrs *topo.EndPoints
+	endPoints := topo.NewEndPoints()
 	if oldValue != "" {
-		addrs = &topo.EndPoints{}
-		if len(oldValue) > 0 {
-			if err := json.Unmarshal([]byte(oldValue), addrs); err != nil {
-				return "", fmt.Errorf("EndPoints unmarshal failed: %v %v", oldValue, err)
-			}
+		if err := json.Unmarshal([]byte(oldValue), endPoints); err != nil {
+			return "", fmt.Errorf("EndPoints unmarshal failed: %v %v", oldValue, err)
 		}
+	}
 
+	changed := oldValue == ""
+	for _, addr := range addrs {
 		foundTablet := false
-		for i, entry := range addrs.Entries {
+		for i, entry := range endPoints.Entries {
 			if entry.Uid == addr.Uid {
 				foundTablet = true
 				if !topo.EndPointEquality(&entry, addr) {
-					addrs.Entries[i] = *addr
+					endPoints.Entries[i] = *addr
+					changed = true
 				}
 				break
 			}
 		}
 
 		if !foundTablet {
-			addrs.Entries = append(addrs.Entries, *addr)
+			endPoints.Entries = append(endPoints.Entries, *addr)
+			changed = true
 		}
-	} else {
-		addrs = topo.NewEndPoints()
-		addrs.Entries = append(addrs.Entries, *addr)
 	}
-	return jscfg.ToJson(addrs), nil
+	if !changed {
+		// the tablets restarted with the same addresses
+		return "", skipUpdateErr
+	}
+	return jscfg.ToJson(endPoints), nil
+}
+
+// endPointUpdate is a batch of UpdateTabletEndpoint calls for the
+// same node, written together at the end of the batch window.
+type endPointUpdate struct {
+	addrs []*topo.EndPoint
+	done  chan struct{}
+	err   error
 }
 
 func (zkts *Server) UpdateTabletEndpoint(cell, keyspace, shard string, tabletType topo.TabletType, addr *topo.EndPoint) error {
 	path := zkPathForVtName(cell, keyspace, shard, tabletType)
+	if *endPointBatchWindow <= 0 {
+		return zkts.writeTabletEndpoints(path, []*topo.EndPoint{addr})
+	}
+
+	// join the batch for this node, or start one
+	zkts.endPointMu.Lock()
+	if zkts.endPointUpdates == nil {
+		zkts.endPointUpdates = make(map[string]*endPointUpdate)
+	}
+	update, ok := zkts.endPointUpdates[path]
+	if !ok {
+		update = &endPointUpdate{done: make(chan struct{})}
+		zkts.endPointUpdates[path] = update
+		time.AfterFunc(*endPointBatchWindow, func() {
+			zkts.endPointMu.Lock()
+			delete(zkts.endPointUpdates, path)
+			zkts.endPointMu.Unlock()
+			update.err = zkts.writeTabletEndpoints(path, update.addrs)
+			close(update.done)
+		})
+	}
+	update.addrs = append(update.addrs, addr)
+	zkts.endPointMu.Unlock()
+
+	<-update.done
+	return update.err
+}
+
+func (zkts *Server) RemoveTabletEndpoint(cell, keyspace, shard string, tabletType topo.TabletType, uid uint32) error {
+	path := zkPathForVtName(cell, keyspace, shard, tabletType)
+	f := func(oldValue string, oldStat zk.Stat) (string, error) {
+		if oldStat == nil || oldValue == "" {
+			return "", skipUpdateErr
+		}
+		endPoints := topo.NewEndPoints()
+		if err := json.Unmarshal([]byte(oldValue), endPoints); err != nil {
+			return "", fmt.Errorf("EndPoints unmarshal failed: %v %v", oldValue, err)
+		}
+		entries := make([]topo.EndPoint, 0, len(endPoints.Entries))
+		for _, entry := range endPoints.Entries {
+			if entry.Uid != uid {
+				entries = append(entries, entry)
+			}
+		}
+		if len(entries) == len(endPoints.Entries) {
+			return "", skipUpdateErr
+		}
+		endPoints.Entries = entries
+		return jscfg.ToJson(endPoints), nil
+	}
+	err := zkts.zconn.RetryChange(path, 0, zookeeper.WorldACL(zookeeper.PERM_ALL), f)
+	if err == skipUpdateErr || zookeeper.IsError(err, zookeeper.ZNONODE) {
+		err = nil
+	}
+	return err
+}
+
+func (zkts *Server) writeTabletEndpoints(path string, addrs []*topo.EndPoint) error {
 	f := func(oldValue string, oldStat zk.Stat) (string, error) {
-		return zkts.updateTabletEndpoint(oldValue, oldStat, addr)
+		return zkts.updateTabletEndpoints(oldValue, oldStat, addrs)
 	}
 	err := zkts.zconn.RetryChange(path, 0, zookeeper.WorldACL(zookeeper.PERM_ALL), f)
 	if err == skipUpdateErr || zookeeper.IsError(err, zookeeper.ZNONODE) {
@@ -0,0 +1,72 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func TestUpdateTabletEndpointBatch(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	zkts := ts.(TestServer).Server.(*Server)
+	if err := ts.UpdateEndPoints("test", "test_keyspace", "0", topo.TYPE_REPLICA, topo.NewEndPoints()); err != nil {
+		t.Fatalf("UpdateEndPoints: %v", err)
+	}
+
+	*endPointBatchWindow = 50 * time.Millisecond
+	defer func() { *endPointBatchWindow = 0 }()
+	wg := sync.WaitGroup{}
+	for uid := uint32(1); uid <= 3; uid++ {
+		wg.Add(1)
+		go func(uid uint32) {
+			defer wg.Done()
+			if err := ts.UpdateTabletEndpoint("test", "test_keyspace", "0", topo.TYPE_REPLICA, topo.NewAddr(uid, "host")); err != nil {
+				t.Errorf("UpdateTabletEndpoint(%v): %v", uid, err)
+			}
+		}(uid)
+	}
+	wg.Wait()
+
+	addrs, err := ts.GetEndPoints("test", "test_keyspace", "0", topo.TYPE_REPLICA)
+	if err != nil || len(addrs.Entries) != 3 {
+		t.Fatalf("unexpected endpoints: %v %v", addrs, err)
+	}
+	// the three updates were written at once
+	_, stat, err := zkts.zconn.Get(zkPathForVtName("test", "test_keyspace", "0", topo.TYPE_REPLICA))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if stat.Version() != 1 {
+		t.Errorf("got %v writes, want 1", stat.Version())
+	}
+
+	// an update that doesn't change anything is not written
+	if err := ts.UpdateTabletEndpoint("test", "test_keyspace", "0", topo.TYPE_REPLICA, topo.NewAddr(2, "host")); err != nil {
+		t.Errorf("UpdateTabletEndpoint: %v", err)
+	}
+	if _, stat, err = zkts.zconn.Get(zkPathForVtName("test", "test_keyspace", "0", topo.TYPE_REPLICA)); err != nil || stat.Version() != 1 {
+		t.Errorf("unchanged endpoint was written: %v %v", stat.Version(), err)
+	}
+}
+
+func TestWriteLimit(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+
+	*writeRate = 20
+	defer func() { *writeRate = 0 }()
+	start := time.Now()
+	for _, keyspace := range []string{"ks1", "ks2", "ks3"} {
+		if err := ts.CreateKeyspace(keyspace); err != nil {
+			t.Fatalf("CreateKeyspace: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("writes were not rate limited, took %v", elapsed)
+	}
+}
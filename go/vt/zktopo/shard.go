@@ -106,3 +106,11 @@ func (zkts *Server) GetShardNames(keyspace string) ([]string, error) {
 	sort.Strings(children)
 	return children, nil
 }
+
+func (zkts *Server) DeleteShard(keyspace, shard string) error {
+	err := zk.DeleteRecursive(zkts.zconn, path.Join(globalKeyspacesPath, keyspace, "shards", shard), -1)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		err = topo.ErrNoNode
+	}
+	return err
+}
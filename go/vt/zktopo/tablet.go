@@ -178,3 +178,27 @@ func (zkts *Server) GetTabletsByCell(cell string) ([]topo.TabletAlias, error) {
 	}
 	return result, nil
 }
+
+func (zkts *Server) GetTabletMapForCell(cell string) (map[topo.TabletAlias]*topo.TabletInfo, error) {
+	children, err := zk.ChildrenWithData(zkts.zconn, tabletDirectoryForCell(cell))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+
+	result := make(map[topo.TabletAlias]*topo.TabletInfo, len(children))
+	for child, cd := range children {
+		uid, err := topo.ParseUid(child)
+		if err != nil {
+			return nil, err
+		}
+		ti, err := tabletInfoFromJson(cd.Data, int64(cd.Stat.Version()))
+		if err != nil {
+			return nil, err
+		}
+		result[topo.TabletAlias{Cell: cell, Uid: uid}] = ti
+	}
+	return result, nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"fmt"
+	"path"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the tablet mirrors of zktopo.Server: a copy of the
+tablet records of a cell, kept in the global topology or in a peer
+cell, to restore the tablet records if the topology server of the
+cell is lost. Nothing reads the mirrors but the restore.
+
+The mirror of cell <cell> in <mirror cell> is in:
+/zk/<mirror cell>/vt/tablet_mirrors/<cell>/<tablet alias>
+*/
+
+// TabletMirrorPath returns the path of the mirror of the tablets of
+// a cell. mirrorCell is either "global", or another cell.
+func TabletMirrorPath(mirrorCell, cell string) string {
+	return fmt.Sprintf("/zk/%v/vt/tablet_mirrors/%v", mirrorCell, cell)
+}
+
+func checkMirrorCell(mirrorCell, cell string) error {
+	if mirrorCell == cell {
+		return fmt.Errorf("cannot mirror the tablets of cell %v in itself", cell)
+	}
+	return nil
+}
+
+// MirrorTablets copies the tablet records of a cell into its mirror in
+// mirrorCell, and removes the records of the tablets that were
+// deleted from the mirror. It returns how many records it changed.
+//
+// A cell without tablets is most likely a lost cell waiting to be
+// restored, so its mirror is not pruned.
+func (zkts *Server) MirrorTablets(cell, mirrorCell string) (int, error) {
+	if err := checkMirrorCell(mirrorCell, cell); err != nil {
+		return 0, err
+	}
+	aliases, err := zkts.GetTabletsByCell(cell)
+	if err != nil && err != topo.ErrNoNode {
+		return 0, err
+	}
+	mirrorPath := TabletMirrorPath(mirrorCell, cell)
+
+	changes := 0
+	tablets := make(map[string]bool)
+	for _, alias := range aliases {
+		data, _, err := zkts.zconn.Get(TabletPathForAlias(alias))
+		if err != nil {
+			if zookeeper.IsError(err, zookeeper.ZNONODE) {
+				continue
+			}
+			return changes, err
+		}
+		tablets[alias.String()] = true
+
+		zkPath := path.Join(mirrorPath, alias.String())
+		mirrorData, _, err := zkts.zconn.Get(zkPath)
+		switch {
+		case err == nil:
+			if mirrorData == data {
+				continue
+			}
+			_, err = zkts.zconn.Set(zkPath, data, -1)
+		case zookeeper.IsError(err, zookeeper.ZNONODE):
+			_, err = zk.CreateRecursive(zkts.zconn, zkPath, data, 0, zookeeper.WorldACL(zookeeper.PERM_ALL))
+		}
+		if err != nil {
+			return changes, err
+		}
+		changes++
+	}
+
+	if len(tablets) == 0 {
+		log.Warningf("cell %v has no tablets, not pruning its mirror %v", cell, mirrorPath)
+		return changes, nil
+	}
+	children, err := zkts.sortedChildren(mirrorPath)
+	if err != nil {
+		return changes, err
+	}
+	for _, child := range children {
+		if tablets[child] {
+			continue
+		}
+		if err := zkts.zconn.Delete(path.Join(mirrorPath, child), -1); err != nil && !zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return changes, err
+		}
+		changes++
+	}
+	return changes, nil
+}
+
+// RestoreTablets creates the tablet records of a cell that are in its
+// mirror in mirrorCell but not in the cell, and adds them to the
+// replication graph. It returns the restored tablets. The serving
+// graph of the cell then needs to be rebuilt.
+func (zkts *Server) RestoreTablets(cell, mirrorCell string) ([]topo.TabletAlias, error) {
+	if err := checkMirrorCell(mirrorCell, cell); err != nil {
+		return nil, err
+	}
+	mirrorPath := TabletMirrorPath(mirrorCell, cell)
+	children, err := zkts.sortedChildren(mirrorPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(children) == 0 {
+		return nil, fmt.Errorf("no tablet mirror for cell %v in %v", cell, mirrorPath)
+	}
+
+	var restored []topo.TabletAlias
+	for _, child := range children {
+		data, _, err := zkts.zconn.Get(path.Join(mirrorPath, child))
+		if err != nil {
+			return restored, err
+		}
+		tablet, err := tabletFromJson(data)
+		if err != nil {
+			return restored, fmt.Errorf("bad tablet mirror %v: %v", child, err)
+		}
+
+		if tablet.IsInReplicationGraph() {
+			if err := zkts.CreateShardReplication(cell, tablet.Keyspace, tablet.Shard, &topo.ShardReplication{}); err != nil && err != topo.ErrNodeExists {
+				return restored, err
+			}
+		}
+		switch err := topo.CreateTablet(zkts, tablet); err {
+		case nil:
+			restored = append(restored, tablet.Alias)
+		case topo.ErrNodeExists:
+			log.Infof("tablet %v already exists, not restoring it", tablet.Alias)
+		default:
+			return restored, err
+		}
+	}
+	return restored, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func TestTabletMirror(t *testing.T) {
+	ts := NewTestServer(t, []string{"test", "peer"})
+	zkts := ts.(TestServer).Server.(*Server)
+	if err := topo.CreateShard(ts, "test_keyspace", "0"); err != nil {
+		t.Fatalf("CreateShard: %v", err)
+	}
+	if err := ts.CreateShardReplication("test", "test_keyspace", "0", &topo.ShardReplication{}); err != nil {
+		t.Fatalf("CreateShardReplication: %v", err)
+	}
+	master := topo.TabletAlias{Cell: "test", Uid: 0}
+	replica := topo.TabletAlias{Cell: "test", Uid: 1}
+	for _, tablet := range []*topo.Tablet{
+		{Alias: master, Hostname: "host0", Keyspace: "test_keyspace", Shard: "0", Type: topo.TYPE_MASTER, State: topo.STATE_READ_WRITE},
+		{Alias: replica, Parent: master, Hostname: "host1", Keyspace: "test_keyspace", Shard: "0", Type: topo.TYPE_REPLICA, State: topo.STATE_READ_ONLY},
+	} {
+		if err := topo.CreateTablet(ts, tablet); err != nil {
+			t.Fatalf("CreateTablet: %v", err)
+		}
+	}
+
+	if _, err := zkts.MirrorTablets("test", "test"); err == nil {
+		t.Errorf("MirrorTablets in the same cell should have failed")
+	}
+	for _, mirrorCell := range []string{"global", "peer"} {
+		if changes, err := zkts.MirrorTablets("test", mirrorCell); err != nil || changes != 2 {
+			t.Errorf("MirrorTablets(%v): %v %v", mirrorCell, changes, err)
+		}
+	}
+	if changes, err := zkts.MirrorTablets("test", "global"); err != nil || changes != 0 {
+		t.Errorf("MirrorTablets(again): %v %v", changes, err)
+	}
+
+	// lose the cell, and restore it from the peer cell
+	for _, alias := range []topo.TabletAlias{master, replica} {
+		if err := ts.DeleteTablet(alias); err != nil {
+			t.Fatalf("DeleteTablet: %v", err)
+		}
+	}
+	if err := ts.DeleteShardReplication("test", "test_keyspace", "0"); err != nil {
+		t.Fatalf("DeleteShardReplication: %v", err)
+	}
+	if changes, err := zkts.MirrorTablets("test", "peer"); err != nil || changes != 0 {
+		t.Errorf("MirrorTablets of a lost cell should not prune the mirror: %v %v", changes, err)
+	}
+	restored, err := zkts.RestoreTablets("test", "peer")
+	if err != nil {
+		t.Fatalf("RestoreTablets: %v", err)
+	}
+	if want := []topo.TabletAlias{master, replica}; !reflect.DeepEqual(restored, want) {
+		t.Errorf("got restored %v, want %v", restored, want)
+	}
+	ti, err := ts.GetTablet(replica)
+	if err != nil || ti.Hostname != "host1" || ti.Parent != master {
+		t.Errorf("unexpected restored tablet: %v %v", ti, err)
+	}
+	sr, err := ts.GetShardReplication("test", "test_keyspace", "0")
+	if err != nil || len(sr.ReplicationLinks) != 1 || sr.ReplicationLinks[0].TabletAlias != replica {
+		t.Errorf("unexpected restored replication graph: %v %v", sr, err)
+	}
+	if restored, err := zkts.RestoreTablets("test", "peer"); err != nil || len(restored) != 0 {
+		t.Errorf("RestoreTablets(again): %v %v", restored, err)
+	}
+
+	// a deleted tablet is pruned from the mirror
+	if err := ts.DeleteTablet(master); err != nil {
+		t.Fatalf("DeleteTablet: %v", err)
+	}
+	if changes, err := zkts.MirrorTablets("test", "global"); err != nil || changes != 1 {
+		t.Errorf("MirrorTablets(pruned): %v %v", changes, err)
+	}
+	if children, err := zkts.sortedChildren(TabletMirrorPath("global", "test")); err != nil || !reflect.DeepEqual(children, []string{replica.String()}) {
+		t.Errorf("unexpected mirror: %v %v", children, err)
+	}
+}
@@ -2,6 +2,7 @@ package zktopo
 
 import (
 	"fmt"
+	"sort"
 	"testing"
 
 	"github.com/youtube/vitess/go/vt/topo"
@@ -30,6 +31,23 @@ func NewTestServer(t *testing.T, cells []string) topo.Server {
 	return TestServer{Server: NewServer(zconn), localCells: cells}
 }
 
+// GetKnownCells returns the cells of the test, and the cells
+// registered with CreateCell.
 func (s TestServer) GetKnownCells() ([]string, error) {
-	return s.localCells, nil
+	registered, _, err := s.Server.(*Server).zconn.Children(globalCellsPath)
+	if err != nil && !zookeeper.IsError(err, zookeeper.ZNONODE) {
+		return nil, err
+	}
+	cells := append([]string{}, s.localCells...)
+	for _, cell := range registered {
+		found := false
+		for _, c := range s.localCells {
+			found = found || c == cell
+		}
+		if !found {
+			cells = append(cells, cell)
+		}
+	}
+	sort.Strings(cells)
+	return cells, nil
 }
@@ -0,0 +1,54 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the VSchema management code for zktopo.Server
+*/
+
+func vschemaPath(keyspace string) string {
+	return path.Join(globalKeyspacesPath, keyspace, "vschema")
+}
+
+func (zkts *Server) SaveVSchema(keyspace string, vschema *topo.VSchema) error {
+	zkPath := vschemaPath(keyspace)
+	data := jscfg.ToJson(vschema)
+	_, err := zkts.zconn.Set(zkPath, data, -1)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		// the parent keyspace node has to exist, so we don't
+		// create it recursively
+		_, err = zkts.zconn.Create(zkPath, data, 0, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	}
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		err = topo.ErrNoNode
+	}
+	return err
+}
+
+func (zkts *Server) GetVSchema(keyspace string) (*topo.VSchema, error) {
+	data, _, err := zkts.zconn.Get(vschemaPath(keyspace))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+
+	vschema := &topo.VSchema{}
+	if err = json.Unmarshal([]byte(data), vschema); err != nil {
+		return nil, fmt.Errorf("bad vschema data %v", err)
+	}
+	return vschema, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the workflow management code for zktopo.Server
+*/
+
+func workflowsPath(keyspace string) string {
+	return path.Join(globalKeyspacesPath, keyspace, "workflows")
+}
+
+func (zkts *Server) CreateWorkflow(keyspace string, wf *topo.Workflow) (string, error) {
+	workflowsPath := workflowsPath(keyspace)
+	if _, err := zk.CreateRecursive(zkts.zconn, workflowsPath, "", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil && !zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+		return "", err
+	}
+	workflowPath, err := zkts.zconn.Create(workflowsPath+"/", jscfg.ToJson(wf), zookeeper.SEQUENCE, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	if err != nil {
+		return "", err
+	}
+	return path.Base(workflowPath), nil
+}
+
+func (zkts *Server) UpdateWorkflowFields(keyspace, uid string, update func(*topo.Workflow) error) error {
+	zkPath := path.Join(workflowsPath(keyspace), uid)
+	f := func(oldValue string, oldStat zk.Stat) (string, error) {
+		// RetryChange would create a missing node, we don't want that
+		if oldValue == "" {
+			return "", topo.ErrNoNode
+		}
+		wf := &topo.Workflow{}
+		if err := json.Unmarshal([]byte(oldValue), wf); err != nil {
+			return "", err
+		}
+
+		if err := update(wf); err != nil {
+			return "", err
+		}
+		return jscfg.ToJson(wf), nil
+	}
+	err := zkts.zconn.RetryChange(zkPath, 0, zookeeper.WorldACL(zookeeper.PERM_ALL), f)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return err
+	}
+	return nil
+}
+
+func (zkts *Server) GetWorkflow(keyspace, uid string) (*topo.Workflow, error) {
+	zkPath := path.Join(workflowsPath(keyspace), uid)
+	data, _, err := zkts.zconn.Get(zkPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+
+	wf := &topo.Workflow{}
+	if err = json.Unmarshal([]byte(data), wf); err != nil {
+		return nil, err
+	}
+	return wf, nil
+}
+
+func (zkts *Server) GetWorkflows(keyspace string) ([]string, error) {
+	children, _, err := zkts.zconn.Children(workflowsPath(keyspace))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	sort.Strings(children)
+	return children, nil
+}
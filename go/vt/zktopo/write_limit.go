@@ -0,0 +1,82 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+var (
+	writeRate = flag.Int("topo_write_rate", 0, "maximum number of topology writes per second for this process (0 for no limit)")
+
+	writeLimitWaits = stats.NewTimings("TopoWriteLimitWaits")
+)
+
+// writeLimitConn is a zk.Conn that limits the rate of its changes to
+// -topo_write_rate per second, so a process can't flood the topology
+// servers. The changes over the rate wait for their turn.
+type writeLimitConn struct {
+	zk.Conn
+
+	mu sync.Mutex
+	// next is when the next change is allowed
+	next time.Time
+}
+
+// ChildrenWithData forwards to the connection, so it can use its
+// faster implementation. Reads are not limited.
+func (conn *writeLimitConn) ChildrenWithData(zkPath string) (map[string]zk.ChildData, error) {
+	return zk.ChildrenWithData(conn.Conn, zkPath)
+}
+
+func (conn *writeLimitConn) wait(op string) {
+	if *writeRate <= 0 {
+		return
+	}
+	conn.mu.Lock()
+	now := time.Now()
+	if conn.next.Before(now) {
+		conn.next = now
+	}
+	delay := conn.next.Sub(now)
+	conn.next = conn.next.Add(time.Second / time.Duration(*writeRate))
+	conn.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+		writeLimitWaits.Add(op, delay)
+	}
+}
+
+func (conn *writeLimitConn) Create(zkPath, value string, flags int, aclv []zookeeper.ACL) (string, error) {
+	conn.wait("Create")
+	return conn.Conn.Create(zkPath, value, flags, aclv)
+}
+
+func (conn *writeLimitConn) Set(zkPath, value string, version int) (zk.Stat, error) {
+	conn.wait("Set")
+	return conn.Conn.Set(zkPath, value, version)
+}
+
+func (conn *writeLimitConn) Delete(zkPath string, version int) error {
+	conn.wait("Delete")
+	return conn.Conn.Delete(zkPath, version)
+}
+
+func (conn *writeLimitConn) RetryChange(zkPath string, flags int, acl []zookeeper.ACL, changeFunc zk.ChangeFunc) error {
+	conn.wait("RetryChange")
+	return conn.Conn.RetryChange(zkPath, flags, acl, changeFunc)
+}
+
+func (conn *writeLimitConn) SetACL(zkPath string, aclv []zookeeper.ACL, version int) error {
+	conn.wait("SetACL")
+	return conn.Conn.SetACL(zkPath, aclv, version)
+}
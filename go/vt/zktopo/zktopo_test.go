@@ -6,6 +6,21 @@ import (
 	"github.com/youtube/vitess/go/vt/topo/test"
 )
 
+func TestCell(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	test.CheckCell(t, ts)
+}
+
+func TestCellsAlias(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	test.CheckCellsAlias(t, ts)
+}
+
+func TestFreeze(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	test.CheckFreeze(t, ts)
+}
+
 func TestKeyspace(t *testing.T) {
 	ts := NewTestServer(t, []string{"test"})
 	test.CheckKeyspace(t, ts)
@@ -16,6 +31,21 @@ func TestShard(t *testing.T) {
 	test.CheckShard(t, ts)
 }
 
+func TestSchemaMigration(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	test.CheckSchemaMigration(t, ts)
+}
+
+func TestWorkflow(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	test.CheckWorkflow(t, ts)
+}
+
+func TestDiffReport(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	test.CheckDiffReport(t, ts)
+}
+
 func TestTablet(t *testing.T) {
 	ts := NewTestServer(t, []string{"test"})
 	test.CheckTablet(t, ts)
@@ -31,6 +61,11 @@ func TestServingGraph(t *testing.T) {
 	test.CheckServingGraph(t, ts)
 }
 
+func TestSrvKeyspaceMirror(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	test.CheckSrvKeyspaceMirror(t, ts)
+}
+
 func TestKeyspaceLock(t *testing.T) {
 	ts := NewTestServer(t, []string{"test"})
 	test.CheckKeyspaceLock(t, ts)
@@ -50,3 +85,13 @@ func TestActions(t *testing.T) {
 	ts := NewTestServer(t, []string{"test"})
 	test.CheckActions(t, ts)
 }
+
+func TestVSchema(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	test.CheckVSchema(t, ts)
+}
+
+func TestRoutingRules(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	test.CheckRoutingRules(t, ts)
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/golang/glog"
@@ -28,6 +29,7 @@ var (
 	globalAddrs    = flag.String("zk.global-addrs", "", "list of global zookeeper servers (host:port, ...)")
 	baseTimeout    = flag.Duration("zk.base-timeout", DEFAULT_BASE_TIMEOUT, "zk or zkocc base timeout (see zkconn.go and zkoccconn.go)")
 	connectTimeout = flag.Duration("zk.connect-timeout", 30*time.Second, "zk connect timeout")
+	cellCacheTTL   = flag.Duration("zk.cell-cache-ttl", time.Minute, "how long the addresses of the cells registered in the global topology are cached before being read again")
 )
 
 // Read the cell from -zk.local-cell, or the environment ZK_CLIENT_LOCAL_CELL
@@ -79,15 +81,118 @@ func getConfigPaths() []string {
 	return zkConfigPaths
 }
 
-func getCellAddrMap() map[string]string {
-	var cellAddrMap map[string]string
+// zkCellConfig is the configuration for one cell in the zk client
+// config file. A cell is either just its address list, or an object
+// with the address list and the credentials to authenticate the
+// connections, like {"addr": "host1:2181,host2:2181", "auth_scheme":
+// "digest", "auth_credentials": "user:password"}.
+type zkCellConfig struct {
+	Addr            string `json:"addr"`
+	AuthScheme      string `json:"auth_scheme"`
+	AuthCredentials string `json:"auth_credentials"`
+	Tls             bool   `json:"tls"`
+}
+
+func (zcc *zkCellConfig) UnmarshalJSON(data []byte) error {
+	var addr string
+	if err := json.Unmarshal(data, &addr); err == nil {
+		zcc.Addr = addr
+		return nil
+	}
+	type plainConfig zkCellConfig
+	return json.Unmarshal(data, (*plainConfig)(zcc))
+}
+
+// CellAddrResolver returns the address of a cell that is not in the
+// config file, or "" if the cell is unknown.
+type CellAddrResolver func(cell string) (string, error)
+
+// registeredCell is the address of a registered cell, and when it
+// was registered.
+type registeredCell struct {
+	addr       string
+	registered time.Time
+}
+
+var (
+	registeredCellsMutex sync.Mutex
+	registeredCells      = make(map[string]registeredCell)
+	cellAddrResolver     CellAddrResolver
+)
+
+// RegisterCellAddr registers the address of a cell that may not be
+// in the config file, like the cells registered in the global
+// topology. The config file wins if it has the cell.
+func RegisterCellAddr(cell, addr string) {
+	registeredCellsMutex.Lock()
+	defer registeredCellsMutex.Unlock()
+	if addr == "" {
+		delete(registeredCells, cell)
+	} else {
+		registeredCells[cell] = registeredCell{addr, time.Now()}
+	}
+}
+
+// SetCellAddrResolver sets the function that finds the cells that
+// are not in the config file, like zktopo does with the cells
+// registered in the global topology. The addresses it returns are
+// cached for -zk.cell-cache-ttl, so a cell can move to other
+// zookeeper servers without changing the config file of every host.
+func SetCellAddrResolver(resolver CellAddrResolver) {
+	registeredCellsMutex.Lock()
+	defer registeredCellsMutex.Unlock()
+	cellAddrResolver = resolver
+}
+
+// resolveCellAddr returns the address of a cell that is not in the
+// config file: the registered one, read again with the resolver if
+// it is older than -zk.cell-cache-ttl. If the resolver fails, the
+// previous address is used.
+func resolveCellAddr(cell string) string {
+	registeredCellsMutex.Lock()
+	rc, ok := registeredCells[cell]
+	resolver := cellAddrResolver
+	registeredCellsMutex.Unlock()
+	if resolver == nil || (ok && time.Now().Sub(rc.registered) < *cellCacheTTL) {
+		return rc.addr
+	}
+
+	addr, err := resolver(cell)
+	if err != nil {
+		log.Warningf("cannot resolve zk cell %v, using cached address %#v: %v", cell, rc.addr, err)
+		return rc.addr
+	}
+	if addr != rc.addr {
+		log.Infof("zk cell %v is now at %v", cell, addr)
+	}
+	RegisterCellAddr(cell, addr)
+	return addr
+}
+
+func getCellConfigMap() map[string]zkCellConfig {
+	cellConfigMap := readCellConfigMap()
+	registeredCellsMutex.Lock()
+	defer registeredCellsMutex.Unlock()
+	if len(registeredCells) > 0 && cellConfigMap == nil {
+		cellConfigMap = make(map[string]zkCellConfig)
+	}
+	for cell, rc := range registeredCells {
+		if _, ok := cellConfigMap[cell]; !ok {
+			cellConfigMap[cell] = zkCellConfig{Addr: rc.addr}
+		}
+	}
+	return cellConfigMap
+}
+
+func readCellConfigMap() map[string]zkCellConfig {
+	var cellConfigMap map[string]zkCellConfig
 	for _, configPath := range getConfigPaths() {
 		file, err := os.Open(configPath)
 		if err != nil {
 			log.Infof("error reading config file: %v: %v", configPath, err)
 			continue
 		}
-		err = json.NewDecoder(file).Decode(&cellAddrMap)
+		err = json.NewDecoder(file).Decode(&cellConfigMap)
 		file.Close()
 		if err != nil {
 			log.Infof("error decoding config file %v: %v", configPath, err)
@@ -96,9 +201,29 @@ func getCellAddrMap() map[string]string {
 
 		break
 	}
+	return cellConfigMap
+}
+
+func getCellAddrMap() map[string]string {
+	cellAddrMap := make(map[string]string)
+	for cell, config := range getCellConfigMap() {
+		cellAddrMap[cell] = config.Addr
+	}
 	return cellAddrMap
 }
 
+// getZkAddrConfig returns the configuration of the cell served by
+// zkAddr. Addresses that are not in the config file (for instance
+// the ones passed with -zk.global-addrs) have no credentials.
+func getZkAddrConfig(zkAddr string) zkCellConfig {
+	for _, config := range getCellConfigMap() {
+		if config.Addr == zkAddr {
+			return config
+		}
+	}
+	return zkCellConfig{Addr: zkAddr}
+}
+
 func ZkPathToZkAddr(zkPath string, useCache bool) (string, error) {
 	cell, err := ZkCellFromZkPath(zkPath)
 	if err != nil {
@@ -119,6 +244,8 @@ func ZkPathToZkAddr(zkPath string, useCache bool) (string, error) {
 	}
 	if useCache {
 		cell += ":_zkocc"
+	} else if _, ok := readCellConfigMap()[cell]; !ok && !isGlobalCell(cell) {
+		cellAddrMap[cell] = resolveCellAddr(cell)
 	}
 
 	addr := cellAddrMap[cell]
@@ -129,6 +256,12 @@ func ZkPathToZkAddr(zkPath string, useCache bool) (string, error) {
 	return "", fmt.Errorf("no addr found for zk cell: %#v", cell)
 }
 
+// isGlobalCell returns true for the global cell, and the dc-specific
+// global cells. Their address cannot come from the global topology.
+func isGlobalCell(cell string) bool {
+	return cell == "global" || strings.HasSuffix(cell, "-global")
+}
+
 // returns all the known cells, alphabetically ordered. It will
 // include 'global' if there is a dc-specific global cell or a global cell
 func ZkKnownCells(useCache bool) []string {
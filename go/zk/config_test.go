@@ -7,6 +7,7 @@ package zk
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"sort"
 	"testing"
@@ -72,3 +73,123 @@ func TestZkConfig(t *testing.T) {
 		t.Errorf("ZkKnownCells(true) failed, expected %v got %v", []string{fakeCell}, knownCells)
 	}
 }
+
+func TestZkCellConfig(t *testing.T) {
+	configPath := fmt.Sprintf("./.zk-test-conf-%v", time.Now().UnixNano())
+	defer func() {
+		os.Remove(configPath)
+	}()
+	if err := os.Setenv("ZK_CLIENT_CONFIG", configPath); err != nil {
+		t.Errorf("setenv ZK_CLIENT_CONFIG failed: %v", err)
+	}
+
+	config := `{
+  "plain": "localhost:2181",
+  "secure": {"addr": "localhost:2182", "auth_scheme": "digest", "auth_credentials": "user:password"},
+  "encrypted": {"addr": "localhost:2183", "tls": true}
+}`
+	if err := ioutil.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	zkAddr, err := ZkPathToZkAddr("/zk/secure/vt", false)
+	if err != nil || zkAddr != "localhost:2182" {
+		t.Errorf("ZkPathToZkAddr(secure) = %v, %v", zkAddr, err)
+	}
+
+	want := zkCellConfig{Addr: "localhost:2182", AuthScheme: "digest", AuthCredentials: "user:password"}
+	if got := getZkAddrConfig("localhost:2182"); got != want {
+		t.Errorf("getZkAddrConfig: want %#v, got %#v", want, got)
+	}
+	if got := getZkAddrConfig("localhost:2181"); got.AuthScheme != "" {
+		t.Errorf("plain cell should have no credentials: %#v", got)
+	}
+	if got := getZkAddrConfig("otherhost:2181"); got.Addr != "otherhost:2181" || got.AuthScheme != "" {
+		t.Errorf("unknown address should have no credentials: %#v", got)
+	}
+
+	if _, _, err := DialZkTimeout("localhost:2183", time.Second, time.Second); err != errZkTlsNotSupported {
+		t.Errorf("TLS cell should not be dialed: %v", err)
+	}
+}
+
+func TestRegisterCellAddr(t *testing.T) {
+	configPath := fmt.Sprintf("./.zk-test-conf-%v", time.Now().UnixNano())
+	defer func() {
+		os.Remove(configPath)
+	}()
+	if err := os.Setenv("ZK_CLIENT_CONFIG", configPath); err != nil {
+		t.Errorf("setenv ZK_CLIENT_CONFIG failed: %v", err)
+	}
+	if err := ioutil.WriteFile(configPath, []byte(`{"cell1": "localhost:2181"}`), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	RegisterCellAddr("cell1", "otherhost:2181")
+	RegisterCellAddr("cell2", "localhost:2182")
+	defer RegisterCellAddr("cell1", "")
+	defer RegisterCellAddr("cell2", "")
+
+	// the config file wins
+	if zkAddr, err := ZkPathToZkAddr("/zk/cell1/vt", false); err != nil || zkAddr != "localhost:2181" {
+		t.Errorf("ZkPathToZkAddr(cell1) = %v, %v", zkAddr, err)
+	}
+	if zkAddr, err := ZkPathToZkAddr("/zk/cell2/vt", false); err != nil || zkAddr != "localhost:2182" {
+		t.Errorf("ZkPathToZkAddr(cell2) = %v, %v", zkAddr, err)
+	}
+	if knownCells := ZkKnownCells(false); len(knownCells) != 2 || knownCells[0] != "cell1" || knownCells[1] != "cell2" {
+		t.Errorf("ZkKnownCells(false) = %v", knownCells)
+	}
+
+	RegisterCellAddr("cell2", "")
+	if _, err := ZkPathToZkAddr("/zk/cell2/vt", false); err == nil {
+		t.Errorf("ZkPathToZkAddr(cell2) should have failed")
+	}
+}
+
+func TestCellAddrResolver(t *testing.T) {
+	configPath := fmt.Sprintf("./.zk-test-conf-%v", time.Now().UnixNano())
+	defer func() {
+		os.Remove(configPath)
+	}()
+	if err := os.Setenv("ZK_CLIENT_CONFIG", configPath); err != nil {
+		t.Errorf("setenv ZK_CLIENT_CONFIG failed: %v", err)
+	}
+	if err := ioutil.WriteFile(configPath, []byte(`{"cell1": "localhost:2181"}`), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	calls := 0
+	addr := "localhost:2182"
+	SetCellAddrResolver(func(cell string) (string, error) {
+		calls++
+		if cell != "cell2" {
+			return "", nil
+		}
+		return addr, nil
+	})
+	defer SetCellAddrResolver(nil)
+	defer RegisterCellAddr("cell2", "")
+
+	// the config file doesn't need the resolver
+	if zkAddr, err := ZkPathToZkAddr("/zk/cell1/vt", false); err != nil || zkAddr != "localhost:2181" || calls != 0 {
+		t.Errorf("ZkPathToZkAddr(cell1) = %v, %v, %v calls", zkAddr, err, calls)
+	}
+	if zkAddr, err := ZkPathToZkAddr("/zk/cell2/vt", false); err != nil || zkAddr != "localhost:2182" || calls != 1 {
+		t.Errorf("ZkPathToZkAddr(cell2) = %v, %v, %v calls", zkAddr, err, calls)
+	}
+	if _, err := ZkPathToZkAddr("/zk/cell3/vt", false); err == nil {
+		t.Errorf("ZkPathToZkAddr(cell3) should have failed")
+	}
+
+	// the address is cached for -zk.cell-cache-ttl
+	addr = "localhost:2183"
+	if zkAddr, _ := ZkPathToZkAddr("/zk/cell2/vt", false); zkAddr != "localhost:2182" {
+		t.Errorf("ZkPathToZkAddr(cell2) should be cached: %v", zkAddr)
+	}
+	defer func(ttl time.Duration) { *cellCacheTTL = ttl }(*cellCacheTTL)
+	*cellCacheTTL = 0
+	if zkAddr, _ := ZkPathToZkAddr("/zk/cell2/vt", false); zkAddr != "localhost:2183" {
+		t.Errorf("ZkPathToZkAddr(cell2) should have been resolved again: %v", zkAddr)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zk
+
+import (
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+	"launchpad.net/gozk/zookeeper"
+)
+
+var (
+	callTimeout = flag.Duration("zk.call-timeout", 30*time.Second, "maximum duration of a zookeeper call through a DeadlineConn (0 for no limit)")
+
+	// the calls that timed out, by operation
+	callTimeouts = stats.NewCounters("ZkCallTimeouts")
+
+	// ErrCallTimeout is returned by DeadlineConn when a call takes
+	// longer than -zk.call-timeout, or goes past its deadline.
+	ErrCallTimeout = errors.New("zk: call timed out")
+
+	// ErrCallInterrupted is returned by DeadlineConn when its
+	// Interrupted channel is closed during a call.
+	ErrCallInterrupted = errors.New("zk: call interrupted")
+)
+
+// DeadlineConn is a Conn that doesn't wait for its calls more than
+// -zk.call-timeout, nor past its Deadline, nor after its Interrupted
+// channel is closed. This way a hung server cannot block the callers
+// forever. The abandoned calls still complete in the background, so
+// a change that timed out may have been applied.
+//
+// The watches are not affected, only the calls that register them.
+type DeadlineConn struct {
+	Conn
+
+	// Deadline is when all the calls fail, if not zero.
+	Deadline time.Time
+
+	// Interrupted makes the calls fail when closed, if not nil.
+	Interrupted chan struct{}
+}
+
+// call runs f, and returns an error if we stopped waiting for it.
+// f has to store its results in its own variables, that can only be
+// read if call returns nil.
+func (conn *DeadlineConn) call(op string, f func()) error {
+	timeout := *callTimeout
+	if !conn.Deadline.IsZero() {
+		left := conn.Deadline.Sub(time.Now())
+		if left <= 0 {
+			callTimeouts.Add(op, 1)
+			return ErrCallTimeout
+		}
+		if timeout == 0 || left < timeout {
+			timeout = left
+		}
+	}
+	if timeout == 0 && conn.Interrupted == nil {
+		f()
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-done:
+		return nil
+	case <-expired:
+		callTimeouts.Add(op, 1)
+		return ErrCallTimeout
+	case <-conn.Interrupted:
+		return ErrCallInterrupted
+	}
+}
+
+func (conn *DeadlineConn) Get(path string) (string, Stat, error) {
+	var data string
+	var stat Stat
+	var err error
+	if cerr := conn.call("Get", func() { data, stat, err = conn.Conn.Get(path) }); cerr != nil {
+		return "", nil, cerr
+	}
+	return data, stat, err
+}
+
+func (conn *DeadlineConn) GetW(path string) (string, Stat, <-chan zookeeper.Event, error) {
+	var data string
+	var stat Stat
+	var watch <-chan zookeeper.Event
+	var err error
+	if cerr := conn.call("GetW", func() { data, stat, watch, err = conn.Conn.GetW(path) }); cerr != nil {
+		return "", nil, nil, cerr
+	}
+	return data, stat, watch, err
+}
+
+func (conn *DeadlineConn) Children(path string) ([]string, Stat, error) {
+	var children []string
+	var stat Stat
+	var err error
+	if cerr := conn.call("Children", func() { children, stat, err = conn.Conn.Children(path) }); cerr != nil {
+		return nil, nil, cerr
+	}
+	return children, stat, err
+}
+
+func (conn *DeadlineConn) ChildrenW(path string) ([]string, Stat, <-chan zookeeper.Event, error) {
+	var children []string
+	var stat Stat
+	var watch <-chan zookeeper.Event
+	var err error
+	if cerr := conn.call("ChildrenW", func() { children, stat, watch, err = conn.Conn.ChildrenW(path) }); cerr != nil {
+		return nil, nil, nil, cerr
+	}
+	return children, stat, watch, err
+}
+
+// ChildrenWithData bounds the whole scan, and uses the faster
+// implementation of the connection, if any.
+func (conn *DeadlineConn) ChildrenWithData(path string) (map[string]ChildData, error) {
+	var result map[string]ChildData
+	var err error
+	if cerr := conn.call("ChildrenWithData", func() { result, err = ChildrenWithData(conn.Conn, path) }); cerr != nil {
+		return nil, cerr
+	}
+	return result, err
+}
+
+func (conn *DeadlineConn) Exists(path string) (Stat, error) {
+	var stat Stat
+	var err error
+	if cerr := conn.call("Exists", func() { stat, err = conn.Conn.Exists(path) }); cerr != nil {
+		return nil, cerr
+	}
+	return stat, err
+}
+
+func (conn *DeadlineConn) ExistsW(path string) (Stat, <-chan zookeeper.Event, error) {
+	var stat Stat
+	var watch <-chan zookeeper.Event
+	var err error
+	if cerr := conn.call("ExistsW", func() { stat, watch, err = conn.Conn.ExistsW(path) }); cerr != nil {
+		return nil, nil, cerr
+	}
+	return stat, watch, err
+}
+
+func (conn *DeadlineConn) Create(path, value string, flags int, aclv []zookeeper.ACL) (string, error) {
+	var pathCreated string
+	var err error
+	if cerr := conn.call("Create", func() { pathCreated, err = conn.Conn.Create(path, value, flags, aclv) }); cerr != nil {
+		return "", cerr
+	}
+	return pathCreated, err
+}
+
+func (conn *DeadlineConn) Set(path, value string, version int) (Stat, error) {
+	var stat Stat
+	var err error
+	if cerr := conn.call("Set", func() { stat, err = conn.Conn.Set(path, value, version) }); cerr != nil {
+		return nil, cerr
+	}
+	return stat, err
+}
+
+func (conn *DeadlineConn) Delete(path string, version int) error {
+	var err error
+	if cerr := conn.call("Delete", func() { err = conn.Conn.Delete(path, version) }); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+func (conn *DeadlineConn) RetryChange(path string, flags int, acl []zookeeper.ACL, changeFunc ChangeFunc) error {
+	var err error
+	if cerr := conn.call("RetryChange", func() { err = conn.Conn.RetryChange(path, flags, acl, changeFunc) }); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+func (conn *DeadlineConn) ACL(path string) ([]zookeeper.ACL, Stat, error) {
+	var aclv []zookeeper.ACL
+	var stat Stat
+	var err error
+	if cerr := conn.call("ACL", func() { aclv, stat, err = conn.Conn.ACL(path) }); cerr != nil {
+		return nil, nil, cerr
+	}
+	return aclv, stat, err
+}
+
+func (conn *DeadlineConn) SetACL(path string, aclv []zookeeper.ACL, version int) error {
+	var err error
+	if cerr := conn.call("SetACL", func() { err = conn.Conn.SetACL(path, aclv, version) }); cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zk
+
+import (
+	"testing"
+	"time"
+)
+
+// hungConn is a Conn whose Get blocks until release is closed.
+type hungConn struct {
+	Conn
+	release chan struct{}
+}
+
+func (conn *hungConn) Get(path string) (string, Stat, error) {
+	<-conn.release
+	return "data", &ZkStat{}, nil
+}
+
+func TestDeadlineConn(t *testing.T) {
+	hung := &hungConn{release: make(chan struct{})}
+	defer close(hung.release)
+
+	conn := &DeadlineConn{Conn: hung, Deadline: time.Now().Add(10 * time.Millisecond)}
+	if _, _, err := conn.Get("/zk/test"); err != ErrCallTimeout {
+		t.Errorf("Get past the deadline: got %v, want ErrCallTimeout", err)
+	}
+
+	interrupted := make(chan struct{})
+	conn = &DeadlineConn{Conn: hung, Interrupted: interrupted}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(interrupted)
+	}()
+	if _, _, err := conn.Get("/zk/test"); err != ErrCallInterrupted {
+		t.Errorf("interrupted Get: got %v, want ErrCallInterrupted", err)
+	}
+
+	saved := *callTimeout
+	*callTimeout = 10 * time.Millisecond
+	defer func() { *callTimeout = saved }()
+	conn = &DeadlineConn{Conn: hung}
+	if _, _, err := conn.Get("/zk/test"); err != ErrCallTimeout {
+		t.Errorf("Get longer than -zk.call-timeout: got %v, want ErrCallTimeout", err)
+	}
+}
+
+func TestDeadlineConnPassThrough(t *testing.T) {
+	hung := &hungConn{release: make(chan struct{})}
+	close(hung.release)
+	conn := &DeadlineConn{Conn: hung, Deadline: time.Now().Add(time.Minute)}
+	if data, _, err := conn.Get("/zk/test"); err != nil || data != "data" {
+		t.Errorf("Get: got %v %v, want data", data, err)
+	}
+}
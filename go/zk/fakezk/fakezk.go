@@ -95,7 +95,7 @@ func (conn *zconn) Get(zkPath string) (data string, stat zk.Stat, err error) {
 	if len(rest) != 0 {
 		return "", nil, zkError(zookeeper.ZNONODE, "get", zkPath)
 	}
-	return node.content, node, nil
+	return node.content, *node, nil
 }
 
 func (conn *zconn) GetW(zkPath string) (data string, stat zk.Stat, watch <-chan zookeeper.Event, err error) {
@@ -111,7 +111,7 @@ func (conn *zconn) GetW(zkPath string) (data string, stat zk.Stat, watch <-chan
 	}
 	c := make(chan zookeeper.Event, 1)
 	node.changeWatches = append(node.changeWatches, c)
-	return node.content, node, c, nil
+	return node.content, *node, c, nil
 }
 
 func (conn *zconn) Children(zkPath string) (children []string, stat zk.Stat, err error) {
@@ -129,7 +129,7 @@ func (conn *zconn) Children(zkPath string) (children []string, stat zk.Stat, err
 	for name := range node.children {
 		children = append(children, name)
 	}
-	return children, node, nil
+	return children, *node, nil
 }
 
 func (conn *zconn) ChildrenW(zkPath string) (children []string, stat zk.Stat, watch <-chan zookeeper.Event, err error) {
@@ -149,7 +149,7 @@ func (conn *zconn) ChildrenW(zkPath string) (children []string, stat zk.Stat, wa
 	for name := range node.children {
 		children = append(children, name)
 	}
-	return children, node, c, nil
+	return children, *node, c, nil
 }
 
 func (conn *zconn) Exists(zkPath string) (stat zk.Stat, err error) {
@@ -180,7 +180,7 @@ func (conn *zconn) ExistsW(zkPath string) (stat zk.Stat, watch <-chan zookeeper.
 		return nil, c, nil
 	}
 	node.existWatches = append(node.existWatches, c)
-	return node, c, nil
+	return *node, c, nil
 
 }
 
@@ -202,7 +202,7 @@ func (conn *zconn) Create(zkPath, value string, flags int, aclv []zookeeper.ACL)
 
 	zxid := conn.getZxid()
 	name := rest[0]
-	if flags == zookeeper.SEQUENCE && name == "" {
+	if flags&zookeeper.SEQUENCE != 0 && name == "" {
 		sequence := node.nextSequence()
 		name = sequence
 		zkPath = zkPath + sequence
@@ -274,7 +274,7 @@ func (conn *zconn) Set(zkPath, value string, version int) (stat zk.Stat, err err
 		}
 	}
 	node.changeWatches = nil
-	return node, nil
+	return *node, nil
 }
 
 func (conn *zconn) Delete(zkPath string, version int) (err error) {
@@ -304,8 +304,12 @@ func (conn *zconn) Delete(zkPath string, version int) (err error) {
 	for _, watch := range node.changeWatches {
 		watch <- event
 	}
+	for _, watch := range node.childrenWatches {
+		watch <- event
+	}
 	node.existWatches = nil
 	node.changeWatches = nil
+	node.childrenWatches = nil
 	childrenEvent := zookeeper.Event{
 		Type:  zookeeper.EVENT_CHILD,
 		Path:  zkPath,
@@ -313,7 +317,10 @@ func (conn *zconn) Delete(zkPath string, version int) (err error) {
 
 	for _, watch := range parent.childrenWatches {
 		watch <- childrenEvent
+		close(watch)
 	}
+	parent.childrenWatches = nil
+	parent.cversion++
 	return nil
 }
 
@@ -328,30 +335,7 @@ func (conn *zconn) Close() error {
 }
 
 func (conn *zconn) RetryChange(path string, flags int, acl []zookeeper.ACL, changeFunc zk.ChangeFunc) error {
-	for {
-		oldValue, oldStat, err := conn.Get(path)
-		if err != nil && !zookeeper.IsError(err, zookeeper.ZNONODE) {
-			return err
-		}
-		newValue, err := changeFunc(oldValue, oldStat)
-		if err != nil {
-			return err
-		}
-		if oldStat == nil {
-			_, err := conn.Create(path, newValue, flags, acl)
-			if err == nil || !zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
-				return err
-			}
-			continue
-		}
-		if newValue == oldValue {
-			return nil // Nothing to do.
-		}
-		_, err = conn.Set(path, newValue, oldStat.Version())
-		if err == nil || !zookeeper.IsError(err, zookeeper.ZBADVERSION) && !zookeeper.IsError(err, zookeeper.ZNONODE) {
-			return err
-		}
-	}
+	return zk.ChangeWithRetries(conn, path, flags, acl, changeFunc)
 }
 
 func (conn *zconn) ACL(zkPath string) (acl []zookeeper.ACL, stat zk.Stat, err error) {
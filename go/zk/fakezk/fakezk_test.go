@@ -5,6 +5,8 @@
 package fakezk
 
 import (
+	"expvar"
+	"flag"
 	"sort"
 	"strings"
 	"testing"
@@ -115,6 +117,75 @@ func TestChildren(t *testing.T) {
 
 }
 
+func TestChildrenWithData(t *testing.T) {
+	conn := NewConn()
+	defer conn.Close()
+	for _, path := range []string{"/zk", "/zk/foo", "/zk/bar"} {
+		if _, err := conn.Create(path, "data of "+path, 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil {
+			t.Fatalf("conn.Create: %v", err)
+		}
+	}
+	children, err := zk.ChildrenWithData(conn, "/zk")
+	if err != nil {
+		t.Fatalf(`zk.ChildrenWithData("/zk"): %v`, err)
+	}
+	if len(children) != 2 || children["foo"].Data != "data of /zk/foo" || children["bar"].Data != "data of /zk/bar" {
+		t.Errorf("unexpected children: %v", children)
+	}
+	if _, err := zk.ChildrenWithData(conn, "/zk/missing"); !zookeeper.IsError(err, zookeeper.ZNONODE) {
+		t.Errorf("zk.ChildrenWithData of a missing node: got %v, want ZNONODE", err)
+	}
+}
+
+func TestWatchRecursive(t *testing.T) {
+	conn := NewConn()
+	defer conn.Close()
+	if _, err := conn.Create("/zk", "", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil {
+		t.Fatalf("conn.Create: %v", err)
+	}
+
+	rw := zk.WatchRecursive(conn, "/zk/root")
+	expect := func(eventType zk.WatchEventType, path, data string) {
+		select {
+		case event := <-rw.Events():
+			if event.Type != eventType || event.Path != path || event.Data != data {
+				t.Errorf("unexpected event: got %#v, want %v %v %v", event, eventType, path, data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %v %v", eventType, path)
+		}
+	}
+
+	for _, path := range []string{"/zk/root", "/zk/root/a"} {
+		if _, err := conn.Create(path, "data", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil {
+			t.Fatalf("conn.Create: %v", err)
+		}
+		expect(zk.WatchCreated, path, "data")
+	}
+	if _, err := conn.Create("/zk/root/a/b", "b1", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil {
+		t.Fatalf("conn.Create: %v", err)
+	}
+	expect(zk.WatchCreated, "/zk/root/a/b", "b1")
+	if _, err := conn.Set("/zk/root/a/b", "b2", -1); err != nil {
+		t.Fatalf("conn.Set: %v", err)
+	}
+	expect(zk.WatchChanged, "/zk/root/a/b", "b2")
+	for _, path := range []string{"/zk/root/a/b", "/zk/root/a"} {
+		if err := conn.Delete(path, -1); err != nil {
+			t.Fatalf("conn.Delete: %v", err)
+		}
+		expect(zk.WatchDeleted, path, "")
+	}
+	if _, err := conn.Create("/zk/root/c", "c", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil {
+		t.Fatalf("conn.Create: %v", err)
+	}
+	expect(zk.WatchCreated, "/zk/root/c", "c")
+
+	rw.Stop()
+	for _ = range rw.Events() {
+	}
+}
+
 func TestWatches(t *testing.T) {
 	conn := NewConn()
 	defer conn.Close()
@@ -257,3 +328,46 @@ func TestFromFile(t *testing.T) {
 		t.Errorf("conn.Get(/zk/testing/vt/ns/test_keyspace/0/master) returned bad value: %v", data)
 	}
 }
+
+func TestRetryChange(t *testing.T) {
+	conn := NewConn()
+	defer conn.Close()
+	if _, err := zk.CreateRecursive(conn, "/zk/foo", "0", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil {
+		t.Fatalf("CreateRecursive: %v", err)
+	}
+
+	// a change that conflicts once goes through
+	conflicts := 1
+	changeFunc := func(oldValue string, oldStat zk.Stat) (string, error) {
+		if conflicts > 0 {
+			conflicts--
+			if _, err := conn.Set("/zk/foo", oldValue+"x", -1); err != nil {
+				t.Fatalf("conn.Set: %v", err)
+			}
+		}
+		return oldValue + "1", nil
+	}
+	if err := conn.RetryChange("/zk/foo", 0, zookeeper.WorldACL(zookeeper.PERM_ALL), changeFunc); err != nil {
+		t.Fatalf("RetryChange: %v", err)
+	}
+	if data, _, _ := conn.Get("/zk/foo"); data != "0x1" {
+		t.Errorf("got %q, wanted %q", data, "0x1")
+	}
+
+	// a change that always conflicts gives up
+	flag.Set("zk.retry-change-max-retries", "3")
+	flag.Set("zk.retry-change-backoff", "1ms")
+	defer flag.Set("zk.retry-change-max-retries", "100")
+	defer flag.Set("zk.retry-change-backoff", "10ms")
+	conflicts = 1000
+	if err := conn.RetryChange("/zk/foo", 0, zookeeper.WorldACL(zookeeper.PERM_ALL), changeFunc); err != zk.ErrTooManyConflicts {
+		t.Errorf("RetryChange: got %v, wanted ErrTooManyConflicts", err)
+	}
+	if got, want := 1000-conflicts, 4; got != want {
+		t.Errorf("got %v attempts, wanted %v", got, want)
+	}
+	// one conflict for the first change, four for the second one
+	if counts := expvar.Get("ZkRetryChangeConflicts").String(); counts != `{"/zk/foo": 5}` {
+		t.Errorf("unexpected conflict counts: %v", counts)
+	}
+}
@@ -9,9 +9,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/youtube/vitess/go/stats"
 	"launchpad.net/gozk/zookeeper"
 )
 
+// callTimings tracks the latency of each zookeeper call, including
+// the retries.
+var callTimings = stats.NewTimings("ZkMetaConnCalls")
+
 type Stat interface {
 	Czxid() int64
 	Mzxid() int64
@@ -108,6 +113,7 @@ func shouldRetry(err error) bool {
 }
 
 func (conn *MetaConn) Get(path string) (data string, stat Stat, err error) {
+	defer callTimings.Record("Get", time.Now())
 	var zconn Conn
 	for i := 0; i < maxAttempts; i++ {
 		zconn, err = conn.connCache.ConnForPath(path)
@@ -123,6 +129,7 @@ func (conn *MetaConn) Get(path string) (data string, stat Stat, err error) {
 }
 
 func (conn *MetaConn) GetW(path string) (data string, stat Stat, watch <-chan zookeeper.Event, err error) {
+	defer callTimings.Record("GetW", time.Now())
 	zconn, err := conn.connCache.ConnForPath(path)
 	if err != nil {
 		return
@@ -131,6 +138,7 @@ func (conn *MetaConn) GetW(path string) (data string, stat Stat, watch <-chan zo
 }
 
 func (conn *MetaConn) Children(path string) (children []string, stat Stat, err error) {
+	defer callTimings.Record("Children", time.Now())
 	var zconn Conn
 	for i := 0; i < maxAttempts; i++ {
 		zconn, err = conn.connCache.ConnForPath(path)
@@ -145,7 +153,24 @@ func (conn *MetaConn) Children(path string) (children []string, stat Stat, err e
 	return
 }
 
+func (conn *MetaConn) ChildrenWithData(path string) (result map[string]ChildData, err error) {
+	defer callTimings.Record("ChildrenWithData", time.Now())
+	var zconn Conn
+	for i := 0; i < maxAttempts; i++ {
+		zconn, err = conn.connCache.ConnForPath(path)
+		if err != nil {
+			return
+		}
+		result, err = ChildrenWithData(zconn, resolveZkPath(path))
+		if !shouldRetry(err) {
+			return
+		}
+	}
+	return
+}
+
 func (conn *MetaConn) ChildrenW(path string) (children []string, stat Stat, watch <-chan zookeeper.Event, err error) {
+	defer callTimings.Record("ChildrenW", time.Now())
 	zconn, err := conn.connCache.ConnForPath(path)
 	if err != nil {
 		return
@@ -154,6 +179,7 @@ func (conn *MetaConn) ChildrenW(path string) (children []string, stat Stat, watc
 }
 
 func (conn *MetaConn) Exists(path string) (stat Stat, err error) {
+	defer callTimings.Record("Exists", time.Now())
 	var zconn Conn
 	for i := 0; i < maxAttempts; i++ {
 		zconn, err = conn.connCache.ConnForPath(path)
@@ -169,6 +195,7 @@ func (conn *MetaConn) Exists(path string) (stat Stat, err error) {
 }
 
 func (conn *MetaConn) ExistsW(path string) (stat Stat, watch <-chan zookeeper.Event, err error) {
+	defer callTimings.Record("ExistsW", time.Now())
 	zconn, err := conn.connCache.ConnForPath(path)
 	if err != nil {
 		return
@@ -177,6 +204,7 @@ func (conn *MetaConn) ExistsW(path string) (stat Stat, watch <-chan zookeeper.Ev
 }
 
 func (conn *MetaConn) Create(path, value string, flags int, aclv []zookeeper.ACL) (pathCreated string, err error) {
+	defer callTimings.Record("Create", time.Now())
 	var zconn Conn
 	for i := 0; i < maxAttempts; i++ {
 		zconn, err = conn.connCache.ConnForPath(path)
@@ -192,6 +220,7 @@ func (conn *MetaConn) Create(path, value string, flags int, aclv []zookeeper.ACL
 }
 
 func (conn *MetaConn) Set(path, value string, version int) (stat Stat, err error) {
+	defer callTimings.Record("Set", time.Now())
 	var zconn Conn
 	for i := 0; i < maxAttempts; i++ {
 		zconn, err = conn.connCache.ConnForPath(path)
@@ -207,6 +236,7 @@ func (conn *MetaConn) Set(path, value string, version int) (stat Stat, err error
 }
 
 func (conn *MetaConn) Delete(path string, version int) (err error) {
+	defer callTimings.Record("Delete", time.Now())
 	var zconn Conn
 	for i := 0; i < maxAttempts; i++ {
 		zconn, err = conn.connCache.ConnForPath(path)
@@ -226,6 +256,7 @@ func (conn *MetaConn) Close() error {
 }
 
 func (conn *MetaConn) RetryChange(path string, flags int, acl []zookeeper.ACL, changeFunc ChangeFunc) error {
+	defer callTimings.Record("RetryChange", time.Now())
 	zconn, err := conn.connCache.ConnForPath(path)
 	if err != nil {
 		return err
@@ -234,6 +265,7 @@ func (conn *MetaConn) RetryChange(path string, flags int, acl []zookeeper.ACL, c
 }
 
 func (conn *MetaConn) ACL(path string) (acl []zookeeper.ACL, stat Stat, err error) {
+	defer callTimings.Record("ACL", time.Now())
 	var zconn Conn
 	for i := 0; i < maxAttempts; i++ {
 		zconn, err = conn.connCache.ConnForPath(path)
@@ -249,6 +281,7 @@ func (conn *MetaConn) ACL(path string) (acl []zookeeper.ACL, stat Stat, err erro
 }
 
 func (conn *MetaConn) SetACL(path string, aclv []zookeeper.ACL, version int) (err error) {
+	defer callTimings.Record("SetACL", time.Now())
 	var zconn Conn
 	for i := 0; i < maxAttempts; i++ {
 		zconn, err = conn.connCache.ConnForPath(path)
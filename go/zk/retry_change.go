@@ -0,0 +1,76 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zk
+
+import (
+	"errors"
+	"flag"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"launchpad.net/gozk/zookeeper"
+)
+
+var (
+	retryChangeMaxRetries = flag.Int("zk.retry-change-max-retries", 100, "how many times RetryChange retries a change that conflicts with other changes before giving up (0 for no limit)")
+	retryChangeBackoff    = flag.Duration("zk.retry-change-backoff", 10*time.Millisecond, "how long RetryChange waits after a conflict, doubled after each conflict of the same change")
+
+	// the conflicts of RetryChange, by path, to find the hot spots
+	retryChangeConflicts = stats.NewCounters("ZkRetryChangeConflicts")
+
+	// ErrTooManyConflicts is returned by RetryChange when it gives
+	// up after -zk.retry-change-max-retries conflicts.
+	ErrTooManyConflicts = errors.New("zk: RetryChange gave up after too many conflicts")
+)
+
+// the longest wait between two attempts of RetryChange
+const maxRetryChangeBackoff = time.Second
+
+// ChangeWithRetries implements Conn.RetryChange with the Get, Create
+// and Set of zconn: it applies changeFunc to the value of the node,
+// and writes the result if the node didn't change in the meantime.
+// Otherwise, it waits and starts again, until the change goes through
+// or it conflicted -zk.retry-change-max-retries times.
+func ChangeWithRetries(zconn Conn, zkPath string, flags int, acl []zookeeper.ACL, changeFunc ChangeFunc) error {
+	backoff := *retryChangeBackoff
+	for conflicts := 0; ; conflicts++ {
+		if conflicts > 0 {
+			retryChangeConflicts.Add(zkPath, 1)
+			if *retryChangeMaxRetries > 0 && conflicts > *retryChangeMaxRetries {
+				log.Warningf("RetryChange(%v) gave up after %v conflicts", zkPath, conflicts)
+				return ErrTooManyConflicts
+			}
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > maxRetryChangeBackoff {
+				backoff = maxRetryChangeBackoff
+			}
+		}
+
+		oldValue, oldStat, err := zconn.Get(zkPath)
+		if err != nil && !zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return err
+		}
+		newValue, err := changeFunc(oldValue, oldStat)
+		if err != nil {
+			return err
+		}
+		if oldStat == nil {
+			_, err := zconn.Create(zkPath, newValue, flags, acl)
+			if err == nil || !zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+				return err
+			}
+			continue
+		}
+		if newValue == oldValue {
+			// nothing to do
+			return nil
+		}
+		_, err = zconn.Set(zkPath, newValue, oldStat.Version())
+		if err == nil || !zookeeper.IsError(err, zookeeper.ZBADVERSION) && !zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zk
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"launchpad.net/gozk/zookeeper"
+)
+
+// WatchEventType is the type of a WatchEvent.
+type WatchEventType int
+
+const (
+	// WatchCreated is sent when a node appears in the subtree,
+	// including for the nodes present when the watch starts.
+	WatchCreated WatchEventType = iota
+	// WatchChanged is sent when the data of a node changes.
+	WatchChanged
+	// WatchDeleted is sent when a node is removed from the subtree.
+	WatchDeleted
+)
+
+func (t WatchEventType) String() string {
+	switch t {
+	case WatchCreated:
+		return "created"
+	case WatchChanged:
+		return "changed"
+	case WatchDeleted:
+		return "deleted"
+	}
+	return fmt.Sprintf("WatchEventType(%d)", int(t))
+}
+
+// WatchEvent describes a change in a subtree watched by
+// WatchRecursive. Data is the new content of the node, it is empty
+// for WatchDeleted.
+type WatchEvent struct {
+	Type WatchEventType
+	Path string
+	Data string
+}
+
+func (e WatchEvent) String() string {
+	return fmt.Sprintf("%v %v", e.Type, e.Path)
+}
+
+// watchRetryDelay is how long we wait before registering the watches
+// of a node again, after a session event or an error.
+var watchRetryDelay = 2 * time.Second
+
+// RecursiveWatch maintains data and children watches on all the nodes
+// of a subtree, and turns the zookeeper events into a stream of
+// WatchEvent. The watches are registered again when they are lost
+// (disconnection, session expiration), and the changes missed in the
+// meantime are sent as regular events.
+type RecursiveWatch struct {
+	zconn  Conn
+	root   string
+	events chan WatchEvent
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu sync.Mutex
+	// watching has the paths that have a watching goroutine
+	watching map[string]bool
+}
+
+// WatchRecursive starts watching the subtree under zkPath. The root
+// node doesn't need to exist yet. Call Stop when done, the events
+// channel is closed afterwards.
+func WatchRecursive(zconn Conn, zkPath string) *RecursiveWatch {
+	rw := &RecursiveWatch{
+		zconn:    zconn,
+		root:     zkPath,
+		events:   make(chan WatchEvent, 100),
+		done:     make(chan struct{}),
+		watching: make(map[string]bool),
+	}
+	rw.watch(zkPath)
+	return rw
+}
+
+// Events returns the channel the events are sent on.
+func (rw *RecursiveWatch) Events() <-chan WatchEvent {
+	return rw.events
+}
+
+// Stop removes all the watches, and closes the events channel.
+func (rw *RecursiveWatch) Stop() {
+	close(rw.done)
+	go func() {
+		rw.wg.Wait()
+		close(rw.events)
+	}()
+}
+
+// watch starts the goroutine watching zkPath, if there is none yet.
+func (rw *RecursiveWatch) watch(zkPath string) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.watching[zkPath] {
+		return
+	}
+	rw.watching[zkPath] = true
+	rw.wg.Add(1)
+	go rw.watchNode(zkPath)
+}
+
+func (rw *RecursiveWatch) send(event WatchEvent) bool {
+	select {
+	case rw.events <- event:
+		return true
+	case <-rw.done:
+		return false
+	}
+}
+
+// wait returns false if the watch was stopped during the delay.
+func (rw *RecursiveWatch) wait(delay time.Duration) bool {
+	select {
+	case <-time.After(delay):
+		return true
+	case <-rw.done:
+		return false
+	}
+}
+
+// watchNode watches the data and children of a node until it is
+// deleted (or forever for the root), or the watch is stopped.
+func (rw *RecursiveWatch) watchNode(zkPath string) {
+	defer func() {
+		rw.mu.Lock()
+		delete(rw.watching, zkPath)
+		rw.mu.Unlock()
+		rw.wg.Done()
+	}()
+
+	exists := false
+	// czxid and version identify the last content we sent
+	var czxid int64
+	version := 0
+	var dataWatch, childrenWatch <-chan zookeeper.Event
+	for {
+		if dataWatch == nil {
+			data, stat, watch, err := rw.zconn.GetW(zkPath)
+			switch {
+			case err == nil:
+				dataWatch = watch
+				if exists && stat.Czxid() != czxid {
+					// deleted and created again while we
+					// were not watching
+					if !rw.send(WatchEvent{Type: WatchDeleted, Path: zkPath}) {
+						return
+					}
+					exists = false
+				}
+				if !exists {
+					exists = true
+					if !rw.send(WatchEvent{WatchCreated, zkPath, data}) {
+						return
+					}
+				} else if stat.Version() != version {
+					if !rw.send(WatchEvent{WatchChanged, zkPath, data}) {
+						return
+					}
+				}
+				czxid = stat.Czxid()
+				version = stat.Version()
+			case zookeeper.IsError(err, zookeeper.ZNONODE):
+				if exists && !rw.send(WatchEvent{Type: WatchDeleted, Path: zkPath}) {
+					return
+				}
+				if zkPath != rw.root {
+					return
+				}
+				// wait for the root to be created
+				exists = false
+				childrenWatch = nil
+				if !rw.waitForRoot() {
+					return
+				}
+				continue
+			default:
+				log.Warningf("cannot watch %v, retrying: %v", zkPath, err)
+				if !rw.wait(watchRetryDelay) {
+					return
+				}
+				continue
+			}
+		}
+
+		if childrenWatch == nil {
+			children, _, watch, err := rw.zconn.ChildrenW(zkPath)
+			switch {
+			case err == nil:
+				childrenWatch = watch
+				for _, child := range children {
+					rw.watch(path.Join(zkPath, child))
+				}
+			case zookeeper.IsError(err, zookeeper.ZNONODE):
+				// deleted since GetW, the data watch will tell us
+			default:
+				log.Warningf("cannot watch the children of %v, retrying: %v", zkPath, err)
+				if !rw.wait(watchRetryDelay) {
+					return
+				}
+				continue
+			}
+		}
+
+		select {
+		case event, ok := <-dataWatch:
+			dataWatch = nil
+			if !ok || !event.Ok() {
+				rw.watchLost(zkPath, event)
+				childrenWatch = nil
+				if !rw.wait(watchRetryDelay) {
+					return
+				}
+			}
+		case event, ok := <-childrenWatch:
+			childrenWatch = nil
+			if !ok || !event.Ok() {
+				rw.watchLost(zkPath, event)
+				dataWatch = nil
+				if !rw.wait(watchRetryDelay) {
+					return
+				}
+			}
+		case <-rw.done:
+			return
+		}
+	}
+}
+
+// waitForRoot waits for the root node to be created. It returns false
+// if the watch was stopped.
+func (rw *RecursiveWatch) waitForRoot() bool {
+	for {
+		stat, watch, err := rw.zconn.ExistsW(rw.root)
+		if err != nil {
+			log.Warningf("cannot watch %v, retrying: %v", rw.root, err)
+			if !rw.wait(watchRetryDelay) {
+				return false
+			}
+			continue
+		}
+		if stat != nil {
+			return true
+		}
+		select {
+		case <-watch:
+		case <-rw.done:
+			return false
+		}
+	}
+}
+
+func (rw *RecursiveWatch) watchLost(zkPath string, event zookeeper.Event) {
+	log.Infof("watch on %v lost (%v), registering it again", zkPath, event)
+}
@@ -0,0 +1,160 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zk
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/youtube/vitess/go/stats"
+	"launchpad.net/gozk/zookeeper"
+)
+
+// This file accounts for the watches set through ZkConn, by path
+// prefix, to find the components that leak them: a watch is
+// outstanding on the server until it fires, or the session ends.
+
+var watchStatsDepth = flag.Int("zk.watch-stats-depth", 4, "number of path components of the prefixes the zk watches are accounted by, for instance 4 for /zk/<cell>/vt/tablets")
+
+// WatchCounts are the watch counters of a path prefix.
+type WatchCounts struct {
+	// Created is the number of watches set.
+	Created int64
+	// Fired is the number of watches that received their event.
+	Fired int64
+	// Abandoned is the number of watches that were dropped by a
+	// session event (disconnection, expiration, close) before
+	// firing.
+	Abandoned int64
+}
+
+// Outstanding is the number of watches still set on the server.
+func (wc WatchCounts) Outstanding() int64 {
+	return wc.Created - wc.Fired - wc.Abandoned
+}
+
+var (
+	watchCountsMu sync.Mutex
+	watchCounts   = make(map[string]*WatchCounts)
+)
+
+func init() {
+	stats.PublishJSONFunc("ZkWatches", watchStatsJSON)
+	http.HandleFunc("/debug/zkwatches", serveWatchStats)
+}
+
+// watchPrefix returns the prefix zkPath is accounted under.
+func watchPrefix(zkPath string) string {
+	parts := strings.Split(zkPath, "/")
+	if *watchStatsDepth > 0 && len(parts) > *watchStatsDepth+1 {
+		parts = parts[:*watchStatsDepth+1]
+	}
+	return strings.Join(parts, "/")
+}
+
+func addWatchCounts(prefix string, add func(wc *WatchCounts)) {
+	watchCountsMu.Lock()
+	defer watchCountsMu.Unlock()
+	wc, ok := watchCounts[prefix]
+	if !ok {
+		wc = &WatchCounts{}
+		watchCounts[prefix] = wc
+	}
+	add(wc)
+}
+
+// trackWatch accounts for a new watch on zkPath, and returns the
+// channel to give to the caller instead of watch.
+func trackWatch(zkPath string, watch <-chan zookeeper.Event) <-chan zookeeper.Event {
+	if watch == nil {
+		return nil
+	}
+	prefix := watchPrefix(zkPath)
+	addWatchCounts(prefix, func(wc *WatchCounts) { wc.Created++ })
+
+	c := make(chan zookeeper.Event, 1)
+	go func() {
+		first := true
+		for event := range watch {
+			if first {
+				first = false
+				if event.Type == zookeeper.EVENT_SESSION || !event.Ok() {
+					addWatchCounts(prefix, func(wc *WatchCounts) { wc.Abandoned++ })
+				} else {
+					addWatchCounts(prefix, func(wc *WatchCounts) { wc.Fired++ })
+				}
+			}
+			c <- event
+		}
+		if first {
+			addWatchCounts(prefix, func(wc *WatchCounts) { wc.Abandoned++ })
+		}
+		close(c)
+	}()
+	return c
+}
+
+// WatchStats returns a copy of the watch counters, by path prefix.
+func WatchStats() map[string]WatchCounts {
+	watchCountsMu.Lock()
+	defer watchCountsMu.Unlock()
+	result := make(map[string]WatchCounts, len(watchCounts))
+	for prefix, wc := range watchCounts {
+		result[prefix] = *wc
+	}
+	return result
+}
+
+func watchStatsJSON() string {
+	data, err := json.Marshal(WatchStats())
+	if err != nil {
+		return fmt.Sprintf("{\"error\": %q}", err.Error())
+	}
+	return string(data)
+}
+
+// serveWatchStats lists the watch counters, the prefixes with the
+// most outstanding watches first.
+func serveWatchStats(w http.ResponseWriter, r *http.Request) {
+	counts := WatchStats()
+	prefixes := make([]string, 0, len(counts))
+	for prefix := range counts {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Sort(byOutstanding{prefixes, counts})
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "%12v %12v %12v %12v  %v\n", "Outstanding", "Created", "Fired", "Abandoned", "Prefix")
+	for _, prefix := range prefixes {
+		wc := counts[prefix]
+		fmt.Fprintf(w, "%12v %12v %12v %12v  %v\n", wc.Outstanding(), wc.Created, wc.Fired, wc.Abandoned, prefix)
+	}
+}
+
+type byOutstanding struct {
+	prefixes []string
+	counts   map[string]WatchCounts
+}
+
+func (bo byOutstanding) Len() int {
+	return len(bo.prefixes)
+}
+
+func (bo byOutstanding) Swap(i, j int) {
+	bo.prefixes[i], bo.prefixes[j] = bo.prefixes[j], bo.prefixes[i]
+}
+
+func (bo byOutstanding) Less(i, j int) bool {
+	oi, oj := bo.counts[bo.prefixes[i]].Outstanding(), bo.counts[bo.prefixes[j]].Outstanding()
+	if oi != oj {
+		return oi > oj
+	}
+	return bo.prefixes[i] < bo.prefixes[j]
+}
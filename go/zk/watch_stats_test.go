@@ -0,0 +1,50 @@
+// Copyright 2013, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zk
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"launchpad.net/gozk/zookeeper"
+)
+
+func TestWatchStats(t *testing.T) {
+	if prefix := watchPrefix("/zk/test/vt/tablets/0000000001/action"); prefix != "/zk/test/vt/tablets" {
+		t.Errorf("watchPrefix: got %v", prefix)
+	}
+
+	fired := make(chan zookeeper.Event, 1)
+	abandoned := make(chan zookeeper.Event, 1)
+	closed := make(chan zookeeper.Event)
+	outstanding := make(chan zookeeper.Event)
+	watches := []<-chan zookeeper.Event{
+		trackWatch("/zk/test/vt/watchstats/1", fired),
+		trackWatch("/zk/test/vt/watchstats/2", abandoned),
+		trackWatch("/zk/test/vt/watchstats/3", closed),
+		trackWatch("/zk/test/vt/watchstats/4", outstanding),
+	}
+	fired <- zookeeper.Event{Type: zookeeper.EVENT_CHANGED, State: zookeeper.STATE_CONNECTED}
+	close(fired)
+	abandoned <- zookeeper.Event{Type: zookeeper.EVENT_SESSION, State: zookeeper.STATE_CONNECTING}
+	close(abandoned)
+	close(closed)
+	for _, watch := range watches[:3] {
+		for _ = range watch {
+		}
+	}
+
+	want := WatchCounts{Created: 4, Fired: 1, Abandoned: 2}
+	if got := WatchStats()["/zk/test/vt/watchstats"]; got != want {
+		t.Errorf("WatchStats: got %+v, want %+v", got, want)
+	}
+
+	w := httptest.NewRecorder()
+	serveWatchStats(w, nil)
+	if !strings.Contains(w.Body.String(), "1            4            1            2  /zk/test/vt/watchstats") {
+		t.Errorf("unexpected /debug/zkwatches:\n%v", w.Body.String())
+	}
+}
@@ -73,6 +73,10 @@ type ZkConn struct {
 // (after each timeout), and may *never* send an event if the TCP connections
 // always fail. Use DialZkTimeout to enforce a timeout for the initial connect.
 func DialZk(zkAddr string, baseTimeout time.Duration) (*ZkConn, <-chan zookeeper.Event, error) {
+	config := getZkAddrConfig(zkAddr)
+	if config.Tls {
+		return nil, nil, errZkTlsNotSupported
+	}
 	resolvedZkAddr, err := resolveZkAddr(zkAddr)
 	if err != nil {
 		return nil, nil, err
@@ -87,6 +91,9 @@ func DialZk(zkAddr string, baseTimeout time.Duration) (*ZkConn, <-chan zookeeper
 		if event.State != zookeeper.STATE_CONNECTED {
 			err = fmt.Errorf("zk connect failed: %v", event.State)
 		}
+		if err == nil {
+			err = addAuth(zconn, config)
+		}
 		if err == nil {
 			return &ZkConn{zconn}, session, nil
 		} else {
@@ -97,6 +104,10 @@ func DialZk(zkAddr string, baseTimeout time.Duration) (*ZkConn, <-chan zookeeper
 }
 
 func DialZkTimeout(zkAddr string, baseTimeout time.Duration, connectTimeout time.Duration) (*ZkConn, <-chan zookeeper.Event, error) {
+	config := getZkAddrConfig(zkAddr)
+	if config.Tls {
+		return nil, nil, errZkTlsNotSupported
+	}
 	resolvedZkAddr, err := resolveZkAddr(zkAddr)
 	if err != nil {
 		return nil, nil, err
@@ -116,6 +127,9 @@ func DialZkTimeout(zkAddr string, baseTimeout time.Duration, connectTimeout time
 				err = fmt.Errorf("zk connect failed: %v", event.State)
 			}
 		}
+		if err == nil {
+			err = addAuth(zconn, config)
+		}
 
 		if err == nil {
 			return &ZkConn{zconn}, session, nil
@@ -126,6 +140,23 @@ func DialZkTimeout(zkAddr string, baseTimeout time.Duration, connectTimeout time
 	return nil, nil, err
 }
 
+// The zookeeper C library cannot encrypt its connections, so a cell
+// configured to require TLS cannot be reached.
+var errZkTlsNotSupported = fmt.Errorf("zk TLS connections are not supported by the zookeeper client library")
+
+// addAuth authenticates a new connection with the credentials of its
+// cell, if any. A connection that fails to authenticate is not used,
+// so we never fall back to unauthenticated access.
+func addAuth(zconn *zookeeper.Conn, config zkCellConfig) error {
+	if config.AuthScheme == "" {
+		return nil
+	}
+	if err := zconn.AddAuth(config.AuthScheme, config.AuthCredentials); err != nil {
+		return fmt.Errorf("zk auth failed for %v with scheme %v: %v", config.Addr, config.AuthScheme, err)
+	}
+	return nil
+}
+
 // resolveZkAddr takes a comma-separated list of host:post addresses,
 // and resolves the host to replace it with the IP address.
 // If a resolution fails, the host is skipped.
@@ -165,6 +196,7 @@ func (conn *ZkConn) GetW(path string) (data string, stat Stat, watch <-chan zook
 	sem.Acquire()
 	defer sem.Release()
 	data, s, watch, err := conn.conn.GetW(path)
+	watch = trackWatch(path, watch)
 	if s == nil {
 		// Handle nil-nil interface conversion.
 		stat = nil
@@ -191,6 +223,7 @@ func (conn *ZkConn) ChildrenW(path string) (children []string, stat Stat, watch
 	sem.Acquire()
 	defer sem.Release()
 	children, s, watch, err := conn.conn.ChildrenW(path)
+	watch = trackWatch(path, watch)
 	if s == nil {
 		// Handle nil-nil interface conversion.
 		stat = nil
@@ -215,6 +248,7 @@ func (conn *ZkConn) ExistsW(path string) (stat Stat, watch <-chan zookeeper.Even
 	sem.Acquire()
 	defer sem.Release()
 	s, w, err := conn.conn.ExistsW(path)
+	w = trackWatch(path, w)
 	if s == nil {
 		// Handle nil-nil interface conversion.
 		return nil, w, err
@@ -251,12 +285,9 @@ func (conn *ZkConn) Close() error {
 	return conn.conn.Close()
 }
 
+// RetryChange gives up after too many conflicts, see ChangeWithRetries.
 func (conn *ZkConn) RetryChange(path string, flags int, acl []zookeeper.ACL, changeFunc ChangeFunc) error {
-	sem.Acquire()
-	defer sem.Release()
-	return conn.conn.RetryChange(path, flags, acl, func(oldValue string, oldStat *zookeeper.Stat) (newValue string, err error) {
-		return changeFunc(oldValue, oldStat)
-	})
+	return ChangeWithRetries(conn, path, flags, acl, changeFunc)
 }
 
 func (conn *ZkConn) ACL(path string) (acls []zookeeper.ACL, stat Stat, err error) {
@@ -72,6 +72,30 @@ func (conn *ZkoccConn) Children(path string) (children []string, stat Stat, err
 	return zkNode.Children, &zkNode.Stat, nil
 }
 
+// ChildrenWithData reads all the children with a single GetV call.
+// GetV fails if any child is missing, so if some were deleted since
+// we listed them, they are read one by one instead.
+func (conn *ZkoccConn) ChildrenWithData(path string) (map[string]ChildData, error) {
+	children, _, err := conn.Children(path)
+	if err != nil {
+		return nil, err
+	}
+	zkPathV := &ZkPathV{Paths: make([]string, len(children))}
+	for i, child := range children {
+		zkPathV.Paths[i] = path + "/" + child
+	}
+	zkNodeV := &ZkNodeV{}
+	if err := conn.rpcClient.Call("ZkReader.GetV", zkPathV, zkNodeV); err != nil {
+		log.Infof("zkocc GetV of the children of %v failed, reading them one by one: %v", path, err)
+		return getChildren(conn, path, children)
+	}
+	result := make(map[string]ChildData, len(children))
+	for i, zkNode := range zkNodeV.Nodes {
+		result[children[i]] = ChildData{Data: zkNode.Data, Stat: &zkNode.Stat}
+	}
+	return result, nil
+}
+
 func (conn *ZkoccConn) ChildrenW(path string) (children []string, stat Stat, watch <-chan zookeeper.Event, err error) {
 	panic(ZkoccUnimplementedError("ChildrenW"))
 }
@@ -6,6 +6,7 @@ package zk
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"math/rand"
 	"path"
@@ -28,6 +29,8 @@ var (
 	ErrTimeout = errors.New("zkutil: obtaining lock timed out")
 )
 
+var fetchConcurrency = flag.Int("zk.fetch-concurrency", 32, "maximum number of concurrent reads of ChildrenWithData")
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -114,6 +117,74 @@ func ChildrenRecursive(zconn Conn, zkPath string) ([]string, error) {
 	return pathList, nil
 }
 
+// ChildData is the content of a child node returned by
+// ChildrenWithData.
+type ChildData struct {
+	Data string
+	Stat Stat
+}
+
+// childrenWithDataConn is implemented by the connections that have a
+// faster way to read the children of a node with their data.
+type childrenWithDataConn interface {
+	ChildrenWithData(zkPath string) (map[string]ChildData, error)
+}
+
+// ChildrenWithData returns the data of all the children of zkPath,
+// indexed by child name. The children are read in parallel, at most
+// -zk.fetch-concurrency at a time, so a directory scan costs about
+// one round trip instead of one per child. The children deleted
+// during the scan are skipped.
+func ChildrenWithData(zconn Conn, zkPath string) (map[string]ChildData, error) {
+	if cwd, ok := zconn.(childrenWithDataConn); ok {
+		return cwd.ChildrenWithData(zkPath)
+	}
+	children, _, err := zconn.Children(zkPath)
+	if err != nil {
+		return nil, err
+	}
+	return getChildren(zconn, zkPath, children)
+}
+
+// getChildren reads the given children of zkPath in parallel.
+func getChildren(zconn Conn, zkPath string, children []string) (map[string]ChildData, error) {
+	concurrency := *fetchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan bool, concurrency)
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	result := make(map[string]ChildData, len(children))
+	var err error
+	for _, child := range children {
+		wg.Add(1)
+		sem <- true
+		go func(child string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			data, stat, zkErr := zconn.Get(path.Join(zkPath, child))
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case zkErr == nil:
+				result[child] = ChildData{Data: data, Stat: stat}
+			case zookeeper.IsError(zkErr, zookeeper.ZNONODE):
+				// deleted since we listed it
+			default:
+				err = zkErr
+			}
+		}(child)
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // resolve paths like:
 // /zk/nyc/vt/tablets/*/action
 // /zk/global/vt/keyspaces/*/shards/*/action
@@ -163,6 +163,39 @@ class TabletConnection(object):
     except gorpc.GoRpcError as e:
       raise convert_exception(e, str(self))
 
+  def prepare(self, dtid):
+    """Prepares the current transaction as the distributed transaction dtid.
+
+    On success, the transaction is not the current one any more: it
+    is finished by commit_prepared or rollback_prepared.
+    """
+    if not self.transaction_id:
+      raise dbexceptions.ProgrammingError('prepare without a transaction')
+    req = self._make_req()
+    req['Dtid'] = dtid
+    try:
+      self.client.call('SqlQuery.Prepare', req)
+      self.transaction_id = 0
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self))
+
+  def commit_prepared(self, dtid):
+    req = {'Dtid': dtid, 'SessionId': self.session_id}
+    try:
+      response = self.client.call('SqlQuery.CommitPrepared', req)
+      return response.reply
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self))
+
+  def rollback_prepared(self, dtid, original_id=0):
+    req = {'Dtid': dtid, 'TransactionId': original_id,
+           'SessionId': self.session_id}
+    try:
+      response = self.client.call('SqlQuery.RollbackPrepared', req)
+      return response.reply
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self))
+
   def _execute(self, sql, bind_variables):
     new_binds = field_types.convert_bind_vars(bind_variables)
     req = self._make_req()
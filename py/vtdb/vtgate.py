@@ -58,9 +58,12 @@ class TabletConnection(object):
   _stream_result = None
   _stream_result_index = None
 
-  def __init__(self, addr, tablet_type, keyspace, shard, timeout, user=None, password=None, encrypted=False, keyfile=None, certfile=None):
+  # read_after_write is the read-after-write consistency of the
+  # session: None, 'master' or 'replica'.
+  def __init__(self, addr, tablet_type, keyspace, shard, timeout, user=None, password=None, encrypted=False, keyfile=None, certfile=None, read_after_write=None):
     self.addr = addr
     self.tablet_type = tablet_type
+    self.read_after_write = read_after_write
     self.keyspace = keyspace
     self.shard = shard
     self.timeout = timeout
@@ -76,6 +79,8 @@ class TabletConnection(object):
 
       self.client.dial()
       params = {'TabletType': self.tablet_type}
+      if self.read_after_write:
+        params['ReadAfterWrite'] = self.read_after_write
       response = self.client.call('VTGate.GetSessionId', params)
       self.session_id = response.reply['SessionId']
     except gorpc.GoRpcError as e:
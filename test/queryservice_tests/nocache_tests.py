@@ -6,6 +6,7 @@ from vtdb import cursor
 
 import framework
 import nocache_cases
+import test_env
 
 class TestNocache(framework.TestCase):
   def test_data(self):
@@ -99,6 +100,66 @@ class TestNocache(framework.TestCase):
     self.assertEqual(vstart.mget("Transactions.Histograms.Aborted.Count", 0)+1, vend.Transactions.Histograms.Aborted.Count)
     self.assertEqual(vstart.mget("TransactionCompletion.Histograms.Rollback.Count", 0)+1, vend.TransactionCompletion.Histograms.Rollback.Count)
 
+  def test_prepare_commit(self):
+    vstart = self.env.debug_vars()
+    self.env.conn.begin()
+    self.env.execute("insert into vtocc_test values(4, null, null, null)")
+    self.env.conn.prepare("test_keyspace:0:1")
+    self.assertEqual(self.env.conn.transaction_id, 0)
+    cu = self.env.execute("select * from vtocc_test")
+    self.assertEqual(cu.rowcount, 3)
+    self.env.conn.commit_prepared("test_keyspace:0:1")
+    cu = self.env.execute("select * from vtocc_test")
+    self.assertEqual(cu.rowcount, 4)
+    # a resolved transaction can be committed again
+    self.env.conn.commit_prepared("test_keyspace:0:1")
+    vend = self.env.debug_vars()
+    self.assertEqual(vstart.mget("TwoPC.Prepare", 0)+1, vend.TwoPC.Prepare)
+    self.assertEqual(vstart.mget("TwoPC.CommitPrepared", 0)+1, vend.TwoPC.CommitPrepared)
+    self.env.conn.begin()
+    self.env.execute("delete from vtocc_test where intval=4")
+    self.env.conn.commit()
+
+  def test_prepare_rollback(self):
+    vstart = self.env.debug_vars()
+    self.env.conn.begin()
+    self.env.execute("insert into vtocc_test values(4, null, null, null)")
+    self.env.conn.prepare("test_keyspace:0:2")
+    self.env.conn.rollback_prepared("test_keyspace:0:2")
+    cu = self.env.execute("select * from vtocc_test")
+    self.assertEqual(cu.rowcount, 3)
+    vend = self.env.debug_vars()
+    self.assertEqual(vstart.mget("TwoPC.RollbackPrepared", 0)+1, vend.TwoPC.RollbackPrepared)
+
+    # a transaction that was not prepared yet is rolled back by its id
+    self.env.conn.begin()
+    self.env.execute("insert into vtocc_test values(4, null, null, null)")
+    transaction_id = self.env.conn.transaction_id
+    self.env.conn.rollback_prepared("test_keyspace:0:3", transaction_id)
+    self.env.conn.transaction_id = 0
+    cu = self.env.execute("select * from vtocc_test")
+    self.assertEqual(cu.rowcount, 3)
+
+  def test_prepared_recovery(self):
+    # only vttablet prepares the transactions again, when it becomes
+    # the master
+    if not isinstance(self.env, test_env.VttabletTestEnv):
+      return
+    self.env.conn.begin()
+    self.env.execute("insert into vtocc_test values(4, null, null, null)")
+    self.env.conn.prepare("test_keyspace:0:4")
+    self.env.restart_vttablet()
+    vend = self.env.debug_vars()
+    self.assertEqual(vend.mget("TwoPC.Recovered", 0), 1)
+    cu = self.env.execute("select * from vtocc_test where intval=4")
+    self.assertEqual(cu.rowcount, 0)
+    self.env.conn.commit_prepared("test_keyspace:0:4")
+    cu = self.env.execute("select * from vtocc_test where intval=4")
+    self.assertEqual(cu.rowcount, 1)
+    self.env.conn.begin()
+    self.env.execute("delete from vtocc_test where intval=4")
+    self.env.conn.commit()
+
   def test_nontx_dml(self):
     vstart = self.env.debug_vars()
     try:
@@ -179,14 +179,14 @@ class VttabletTestEnv(TestEnv):
     utils.run_vtctl('CreateKeyspace -force /zk/global/vt/keyspaces/test_keyspace')
     self.tablet.init_tablet('master', 'test_keyspace', '0')
 
-    customrules = '/tmp/customrules.json'
-    self.create_customrules(customrules)
-    schema_override = '/tmp/schema_override.json'
-    self.create_schema_override(schema_override)
-    if utils.options.memcache:
-      self.tablet.start_vttablet(memcache=True, customrules=customrules, schema_override=schema_override)
-    else:
-      self.tablet.start_vttablet(customrules=customrules, schema_override=schema_override)
+    self.customrules = '/tmp/customrules.json'
+    self.create_customrules(self.customrules)
+    self.schema_override = '/tmp/schema_override.json'
+    self.create_schema_override(self.schema_override)
+    self.start_vttablet()
+
+  def start_vttablet(self):
+    self.tablet.start_vttablet(memcache=utils.options.memcache, customrules=self.customrules, schema_override=self.schema_override, extra_args=['-queryserver-config-twopc-enable'])
 
     # FIXME(szopa): This is necessary here only because of a bug that
     # makes the qs reload its config only after an action.
@@ -199,7 +199,7 @@ class VttabletTestEnv(TestEnv):
         self.txlog = framework.Tailer(open('/tmp/vtocc_txlog.log'), flush=self.tablet.flush)
         self.log = framework.Tailer(open(os.path.join(self.tablet.tablet_dir, 'vttablet.INFO')), flush=self.tablet.flush)
         querylog_file = '/tmp/vtocc_streamlog_%s.log' % self.tablet.port
-        utils.run_bg(['curl', '-s', '-N', 'http://localhost:9461/debug/querylog?full=true'], stdout=open(querylog_file, 'w'))
+        self.querylogger = utils.run_bg(['curl', '-s', '-N', 'http://localhost:9461/debug/querylog?full=true'], stdout=open(querylog_file, 'w'))
         time.sleep(1)
         self.querylog = framework.Tailer(open(querylog_file), sleep=0.1)
 
@@ -209,6 +209,13 @@ class VttabletTestEnv(TestEnv):
           raise
         time.sleep(1)
 
+  def restart_vttablet(self):
+    """Restarts vttablet: it serves again as the master."""
+    self.tablet.kill_vttablet()
+    self.txlogger.terminate()
+    self.querylogger.terminate()
+    self.start_vttablet()
+
   def tearDown(self):
     self.tablet.kill_vttablet()
     try:
@@ -306,7 +313,8 @@ class VtoccTestEnv(TestEnv):
       "-db-config-app-unixsocket", self.mysqldir+"/mysql.sock",
       "-db-config-app-uname", 'vt_dba',   # use vt_dba as some tests depend on 'drop'
       "-db-config-app-keyspace", "test_keyspace",
-      "-db-config-app-shard", "0"
+      "-db-config-app-shard", "0",
+      "-queryserver-config-twopc-enable"
     ]
     if utils.options.memcache:
       memcache = self.mysqldir+"/memcache.sock"